@@ -79,6 +79,9 @@ const (
 
 	osConfigPollIntervalDefault = 10
 	osConfigMetadataPollTimeout = 60
+
+	inventoryExportIntervalDefault = time.Hour
+	inventoryExportKeepDefault     = 24
 )
 
 var (
@@ -86,6 +89,20 @@ var (
 	debug               = flag.Bool("debug", false, "set debug log verbosity")
 	stdout              = flag.Bool("stdout", false, "log to stdout")
 	disableLocalLogging = flag.Bool("disable_local_logging", false, "disable logging using event log or syslog")
+	logFormat           = flag.String("log_format", "text", "format of the local and stdout logs, text or json")
+	logFile             = flag.String("log_file", "", "also log to this file, rotating it by size and age")
+	logFileMaxSizeMB    = flag.Int("log_file_max_size_mb", 10, "size in MiB at which -log_file is rotated")
+	logFileMaxAge       = flag.Duration("log_file_max_age", 0, "age at which -log_file is rotated, 0 only rotates by size")
+	logFileMaxBackups   = flag.Int("log_file_max_backups", 5, "number of rotated -log_file backups kept")
+	logFileRetention    = flag.Duration("log_file_retention", 0, "age at which rotated -log_file backups are removed, 0 keeps them")
+	logSinks            = flag.String("log_sinks", "", "comma separated sinks to also log to with structured fields, syslog or journald")
+	syslogAddress       = flag.String("syslog_address", "", "syslog server of the syslog sink, udp://host:port, tcp://host:port, unix:///path or empty for the local syslog")
+	metricsAddress      = flag.String("metrics_address", "", "serve the Prometheus metrics on this address, e.g. localhost:9752, empty to not serve them")
+	inventoryAddress    = flag.String("inventory_address", "", "serve the last reported inventory as JSON on this loopback address, e.g. localhost:9753, empty to not serve it")
+	controlSocket       = flag.String("control_socket", "", "serve the gRPC control API on this unix socket, e.g. /run/google_osconfig_agent/control.sock, empty to not serve it")
+	taskWorkers         = flag.Int("task_workers", 1, "number of tasks that may run at the same time, tasks of the same name, like two patch runs, never do")
+	taskQueueCapacity   = flag.Int("task_queue_capacity", 0, "number of tasks that may be queued, tasks requested on the control API beyond it are refused, 0 is no limit")
+	metricsTextfile     = flag.String("metrics_textfile", "", "write the Prometheus metrics to this file every minute for a textfile collector, e.g. /var/lib/node_exporter/osconfig.prom")
 
 	agentConfig   = &config{}
 	agentConfigMx sync.RWMutex
@@ -129,6 +146,30 @@ type config struct {
 	guestPoliciesEnabled    bool
 	osInventoryEnabled      bool
 	guestAttributesEnabled  bool
+	inventoryAnonymize      string
+	inventoryHistoryDays    int
+	inventoryHistoryDelta   bool
+	inventoryAnomalies      string
+	inventoryExportDir      string
+	inventoryExportInterval time.Duration
+	inventoryExportFormats  string
+	inventoryExportKeep     int
+	inventoryExportMaxAge   time.Duration
+	protectedPackages       string
+	restartServices         string
+	patchEnv                string
+	credentials             string
+	cloudTags               string
+	commandAudit            bool
+	commandAuditRedact      string
+	httpProxy               string
+	httpsProxy              string
+	noProxy                 string
+	mirrors                 string
+	featureFlags            string
+	webhooks                []Webhook
+	exporters               []Exporter
+	maintenanceWindows      []MaintenanceWindow
 }
 
 func (c *config) parseFeatures(features string, enabled bool) {
@@ -216,6 +257,22 @@ type attributesJSON struct {
 	OSConfigEnabled       string       `json:"enable-osconfig"`
 	DisabledFeatures      string       `json:"osconfig-disabled-features"`
 	EnableGuestAttributes string       `json:"enable-guest-attributes"`
+	InventoryAnonymize    string       `json:"osconfig-inventory-anonymize"`
+	InventoryHistoryDays  *json.Number `json:"osconfig-inventory-history-days"`
+	InventoryHistoryDelta string       `json:"osconfig-inventory-history-delta"`
+	InventoryAnomalies    string       `json:"osconfig-inventory-anomalies"`
+	ProtectedPackages     string       `json:"osconfig-protected-packages"`
+	RestartServices       string       `json:"osconfig-restart-services"`
+	PatchEnv              string       `json:"osconfig-patch-env"`
+	Credentials           string       `json:"osconfig-credentials"`
+	CloudTags             string       `json:"osconfig-cloud-tags"`
+	CommandAudit          string       `json:"osconfig-command-audit"`
+	CommandAuditRedact    string       `json:"osconfig-command-audit-redact"`
+	HTTPProxy             string       `json:"osconfig-http-proxy"`
+	HTTPSProxy            string       `json:"osconfig-https-proxy"`
+	NoProxy               string       `json:"osconfig-no-proxy"`
+	Mirrors               string       `json:"osconfig-mirrors"`
+	FeatureFlags          string       `json:"osconfig-feature-flags"`
 }
 
 func createConfigFromMetadata(md metadataJSON) *config {
@@ -227,6 +284,7 @@ func createConfigFromMetadata(md metadataJSON) *config {
 		debugEnabled:            debugEnabledDefault,
 		svcEndpoint:             prodEndpoint,
 		osConfigPollInterval:    osConfigPollIntervalDefault,
+		inventoryExportKeep:     inventoryExportKeepDefault,
 
 		googetRepoFilePath: googetRepoFilePath,
 		zypperRepoFilePath: zypperRepoFilePath,
@@ -341,7 +399,94 @@ func createConfigFromMetadata(md metadataJSON) *config {
 		c.guestAttributesEnabled = parseBool(md.Instance.Attributes.EnableGuestAttributes)
 	}
 
-	// Flags take precedence over metadata.
+	c.inventoryAnonymize = md.Project.Attributes.InventoryAnonymize
+	if md.Instance.Attributes.InventoryAnonymize != "" {
+		c.inventoryAnonymize = md.Instance.Attributes.InventoryAnonymize
+	}
+
+	for _, days := range []*json.Number{md.Project.Attributes.InventoryHistoryDays, md.Instance.Attributes.InventoryHistoryDays} {
+		if days == nil {
+			continue
+		}
+		if val, err := days.Int64(); err == nil && val >= 0 {
+			c.inventoryHistoryDays = int(val)
+		}
+	}
+	if md.Project.Attributes.InventoryHistoryDelta != "" {
+		c.inventoryHistoryDelta = parseBool(md.Project.Attributes.InventoryHistoryDelta)
+	}
+	if md.Instance.Attributes.InventoryHistoryDelta != "" {
+		c.inventoryHistoryDelta = parseBool(md.Instance.Attributes.InventoryHistoryDelta)
+	}
+
+	c.inventoryAnomalies = md.Project.Attributes.InventoryAnomalies
+	if md.Instance.Attributes.InventoryAnomalies != "" {
+		c.inventoryAnomalies = md.Instance.Attributes.InventoryAnomalies
+	}
+
+	c.protectedPackages = md.Project.Attributes.ProtectedPackages
+	if md.Instance.Attributes.ProtectedPackages != "" {
+		c.protectedPackages = md.Instance.Attributes.ProtectedPackages
+	}
+
+	c.restartServices = md.Project.Attributes.RestartServices
+	if md.Instance.Attributes.RestartServices != "" {
+		c.restartServices = md.Instance.Attributes.RestartServices
+	}
+
+	c.patchEnv = md.Project.Attributes.PatchEnv
+	if md.Instance.Attributes.PatchEnv != "" {
+		c.patchEnv = md.Instance.Attributes.PatchEnv
+	}
+
+	c.credentials = md.Project.Attributes.Credentials
+	if md.Instance.Attributes.Credentials != "" {
+		c.credentials = md.Instance.Attributes.Credentials
+	}
+
+	c.cloudTags = md.Project.Attributes.CloudTags
+	if md.Instance.Attributes.CloudTags != "" {
+		c.cloudTags = md.Instance.Attributes.CloudTags
+	}
+
+	if md.Project.Attributes.CommandAudit != "" {
+		c.commandAudit = parseBool(md.Project.Attributes.CommandAudit)
+	}
+	if md.Instance.Attributes.CommandAudit != "" {
+		c.commandAudit = parseBool(md.Instance.Attributes.CommandAudit)
+	}
+
+	c.commandAuditRedact = md.Project.Attributes.CommandAuditRedact
+	if md.Instance.Attributes.CommandAuditRedact != "" {
+		c.commandAuditRedact = md.Instance.Attributes.CommandAuditRedact
+	}
+
+	for _, v := range []struct {
+		dst               *string
+		project, instance string
+	}{
+		{&c.httpProxy, md.Project.Attributes.HTTPProxy, md.Instance.Attributes.HTTPProxy},
+		{&c.httpsProxy, md.Project.Attributes.HTTPSProxy, md.Instance.Attributes.HTTPSProxy},
+		{&c.noProxy, md.Project.Attributes.NoProxy, md.Instance.Attributes.NoProxy},
+		{&c.mirrors, md.Project.Attributes.Mirrors, md.Instance.Attributes.Mirrors},
+	} {
+		*v.dst = v.project
+		if v.instance != "" {
+			*v.dst = v.instance
+		}
+	}
+
+	flags := map[string]string{}
+	parseFeatureFlags(md.Project.Attributes.FeatureFlags, flags)
+	parseFeatureFlags(md.Instance.Attributes.FeatureFlags, flags)
+	c.featureFlags = formatFeatureFlags(flags)
+
+	// The config file takes precedence over metadata.
+	if f := getFileConfig(); f != nil {
+		f.apply(c)
+	}
+
+	// Flags take precedence over metadata and the config file.
 	if *debug {
 		c.debugEnabled = true
 	}
@@ -352,9 +497,12 @@ func createConfigFromMetadata(md metadataJSON) *config {
 }
 
 func setSVCEndpoint(md metadataJSON, c *config) {
+	f := getFileConfig()
 	switch {
 	case *endpoint != prodEndpoint:
 		c.svcEndpoint = *endpoint
+	case f != nil && f.Endpoint != "":
+		c.svcEndpoint = f.Endpoint
 	case md.Instance.Attributes.OSConfigEndpoint != "":
 		c.svcEndpoint = md.Instance.Attributes.OSConfigEndpoint
 	case md.Instance.Attributes.OSConfigEndpointOld != "":
@@ -383,7 +531,8 @@ func formatMetadataError(err error) error {
 	return err
 }
 
-func getMetadata(suffix string) ([]byte, string, error) {
+// MetadataHost is the host of the metadata server.
+func MetadataHost() string {
 	host := os.Getenv(metadataHostEnv)
 	if host == "" {
 		// Using 169.254.169.254 instead of "metadata" here because Go
@@ -393,7 +542,11 @@ func getMetadata(suffix string) ([]byte, string, error) {
 		// being stable anyway.
 		host = metadataIP
 	}
-	computeMetadataURL := "http://" + host + "/computeMetadata/v1/" + suffix
+	return host
+}
+
+func getMetadata(suffix string) ([]byte, string, error) {
+	computeMetadataURL := "http://" + MetadataHost() + "/computeMetadata/v1/" + suffix
 	req, err := http.NewRequest("GET", computeMetadataURL, nil)
 	if err != nil {
 		return nil, "", err
@@ -429,7 +582,8 @@ func GetCacheDirWindows() string {
 }
 
 // WatchConfig looks for changes in metadata keys. Upon receiving successful response,
-// it create a new agent config.
+// it create a new agent config. It also returns when ReloadConfigFile changed
+// the config.
 func WatchConfig(ctx context.Context) error {
 	var md []byte
 	var webError error
@@ -465,15 +619,12 @@ func WatchConfig(ctx context.Context) error {
 			unmarshalErrorCount = 0
 			lEtag.set(eTag)
 
-			newAgentConfig := createConfigFromMetadata(metadataConfig)
-
-			agentConfigMx.Lock()
-			if agentConfig.asSha256() != newAgentConfig.asSha256() {
-				agentConfig = newAgentConfig
-				agentConfigMx.Unlock()
+			updateMx.Lock()
+			changed := updateConfig(metadataConfig)
+			updateMx.Unlock()
+			if changed {
 				break
 			}
-			agentConfigMx.Unlock()
 		}
 
 		// Try up to 12 times (60s) to wait for slow network initialization, after
@@ -490,6 +641,8 @@ func WatchConfig(ctx context.Context) error {
 			return webError
 		case <-ctx.Done():
 			return nil
+		case <-configReloaded:
+			return nil
 		case <-loopTicker.C:
 			continue
 		}
@@ -532,6 +685,79 @@ func DisableLocalLogging() bool {
 	return *disableLocalLogging
 }
 
+// LogFormat flag, "text" or "json".
+func LogFormat() string {
+	return *logFormat
+}
+
+// LogFile flag, the file to log to, empty to not log to a file.
+func LogFile() string {
+	return *logFile
+}
+
+// LogFileMaxSize is the -log_file_max_size_mb flag in bytes.
+func LogFileMaxSize() int64 {
+	return int64(*logFileMaxSizeMB) << 20
+}
+
+// LogFileMaxAge flag.
+func LogFileMaxAge() time.Duration {
+	return *logFileMaxAge
+}
+
+// LogFileMaxBackups flag.
+func LogFileMaxBackups() int {
+	return *logFileMaxBackups
+}
+
+// LogFileRetention flag.
+func LogFileRetention() time.Duration {
+	return *logFileRetention
+}
+
+// LogSinks flag, the sinks to log to.
+func LogSinks() []string {
+	if *logSinks == "" {
+		return nil
+	}
+	return strings.Split(*logSinks, ",")
+}
+
+// SyslogAddress flag.
+func SyslogAddress() string {
+	return *syslogAddress
+}
+
+// MetricsAddress flag.
+func MetricsAddress() string {
+	return *metricsAddress
+}
+
+// InventoryAddress flag.
+func InventoryAddress() string {
+	return *inventoryAddress
+}
+
+// ControlSocket flag.
+func ControlSocket() string {
+	return *controlSocket
+}
+
+// TaskWorkers flag.
+func TaskWorkers() int {
+	return *taskWorkers
+}
+
+// TaskQueueCapacity flag.
+func TaskQueueCapacity() int {
+	return *taskQueueCapacity
+}
+
+// MetricsTextfile flag.
+func MetricsTextfile() string {
+	return *metricsTextfile
+}
+
 // SvcEndpoint is the OS Config service endpoint.
 func SvcEndpoint() string {
 	return getAgentConfig().svcEndpoint
@@ -648,6 +874,192 @@ func GuestAttributesEnabled() bool {
 	return getAgentConfig().guestAttributesEnabled
 }
 
+// InventoryAnonymize returns the inventory anonymization setting, a comma
+// separated list of field=mode pairs, see inventory.ParseAnonymizeConfig.
+func InventoryAnonymize() string {
+	return getAgentConfig().inventoryAnonymize
+}
+
+// InventoryHistoryDays is the number of days of Windows update and
+// application history reported with the inventory, 0 reports all of it.
+func InventoryHistoryDays() int {
+	return getAgentConfig().inventoryHistoryDays
+}
+
+// InventoryHistoryDelta reports whether only Windows update and application
+// history entries not yet acknowledged by the service are reported.
+func InventoryHistoryDelta() bool {
+	return getAgentConfig().inventoryHistoryDelta
+}
+
+// InventoryAnomalies returns the inventory anomaly detection setting, a comma
+// separated list of key=value pairs, see inventory.ParseAnomalyConfig.
+func InventoryAnomalies() string {
+	return getAgentConfig().inventoryAnomalies
+}
+
+// InventoryExportDir is the directory the inventory is exported to, empty
+// if it is not exported.
+func InventoryExportDir() string {
+	return getAgentConfig().inventoryExportDir
+}
+
+// InventoryExportInterval is the interval of the inventory exports.
+func InventoryExportInterval() time.Duration {
+	if i := getAgentConfig().inventoryExportInterval; i > 0 {
+		return i
+	}
+	return inventoryExportIntervalDefault
+}
+
+// InventoryExportFormats are the formats of the inventory exports, json or
+// spdx.
+func InventoryExportFormats() []string {
+	if f := getAgentConfig().inventoryExportFormats; f != "" {
+		return strings.Split(f, ",")
+	}
+	return []string{"json"}
+}
+
+// InventoryExportKeep is the number of inventory exports kept, 0 keeps all
+// of them.
+func InventoryExportKeep() int {
+	return getAgentConfig().inventoryExportKeep
+}
+
+// InventoryExportMaxAge is the age at which inventory exports are removed,
+// 0 keeps them.
+func InventoryExportMaxAge() time.Duration {
+	return getAgentConfig().inventoryExportMaxAge
+}
+
+// ProtectedPackages returns the packages that must not be removed or
+// downgraded in addition to the built-in ones, a comma separated list in
+// the metadata.
+func ProtectedPackages() []string {
+	var names []string
+	for _, name := range strings.Split(getAgentConfig().protectedPackages, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RestartServices returns the systemd services the agent restarts after
+// patching if they still use files the update replaced, unit names or
+// patterns like "php*-fpm", a comma separated list in the metadata.
+func RestartServices() []string {
+	var names []string
+	for _, name := range strings.Split(getAgentConfig().restartServices, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// PatchEnv returns the "KEY=value" entries to add to the environment of the
+// package manager commands of patch runs, a semicolon separated list in the
+// metadata since values like no_proxy contain commas.
+func PatchEnv() []string {
+	var env []string
+	for _, e := range strings.Split(getAgentConfig().patchEnv, ";") {
+		if e = strings.TrimSpace(e); strings.Contains(e, "=") {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// Credentials returns the credential provider setting for fetching
+// artifacts and keys, a comma separated list of prefix=provider pairs, see
+// external.ParseCredentialRules.
+func Credentials() string {
+	return getAgentConfig().credentials
+}
+
+// CloudTags returns the clouds to read the instance tags from, a comma
+// separated list, see cloudtags.ParseProviders.
+func CloudTags() string {
+	return getAgentConfig().cloudTags
+}
+
+// CommandAudit reports whether the package manager commands are logged to
+// the command audit log, see util.AuditRunner.
+func CommandAudit() bool {
+	return getAgentConfig().commandAudit
+}
+
+// CommandAuditRedact returns the words marking arguments as sensitive in the
+// command audit log in addition to the built-in ones, a comma separated list
+// in the metadata.
+func CommandAuditRedact() []string {
+	var words []string
+	for _, w := range strings.Split(getAgentConfig().commandAuditRedact, ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// Webhook is a webhook the agent calls with the events of its hooks, see
+// hooks.RegisterWebhook.
+type Webhook struct {
+	URL string
+	// Secret signs the requests if not empty.
+	Secret string
+	// Events are the hook points the webhook is called for.
+	Events  []string
+	Timeout time.Duration
+}
+
+// Webhooks returns the webhooks of the config file.
+func Webhooks() []Webhook {
+	return getAgentConfig().webhooks
+}
+
+// Exporter is an exporter the agent sends the events of its hooks to, see
+// the exporter package.
+type Exporter struct {
+	// URL selects the exporter and its destination, e.g.
+	// "gs://bucket/prefix/" or "stdout".
+	URL string
+	// Events are the hook points the exporter is called for, the inventory
+	// and patch results if empty.
+	Events  []string
+	Timeout time.Duration
+}
+
+// Exporters returns the exporters of the config file.
+func Exporters() []Exporter {
+	return getAgentConfig().exporters
+}
+
+// MaintenanceWindow is a recurring window the agent patches the system in,
+// see the maintenance package.
+type MaintenanceWindow struct {
+	Name string
+	// Schedule is the cron expression of the window starts.
+	Schedule string
+	Duration time.Duration
+	// TimeZone is the IANA time zone of Schedule, empty for UTC.
+	TimeZone string
+	// Security, Minimal and Excludes are the patch options of the runs.
+	Security bool
+	Minimal  bool
+	Excludes []string
+	// Reboot is when the runs reboot the system, "default", "always" or
+	// "never", see control.PatchRequest.
+	Reboot string
+}
+
+// MaintenanceWindows returns the maintenance windows of the config file.
+func MaintenanceWindows() []MaintenanceWindow {
+	return getAgentConfig().maintenanceWindows
+}
+
 type idToken struct {
 	exp *time.Time
 	raw string
@@ -733,6 +1145,12 @@ func OldRestartFile() string {
 	return oldRestartFileLinux
 }
 
+// ProvisionMarkerFile is the location of the file the provision action
+// writes its result to.
+func ProvisionMarkerFile() string {
+	return filepath.Join(CacheDir(), "osconfig_provisioned.json")
+}
+
 // CacheDir is the location of the cache directory.
 func CacheDir() string {
 	if runtime.GOOS == "windows" {
@@ -0,0 +1,113 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feature flags, see FeatureEnabled.
+const (
+	// FeatureInventoryDBCache reuses the last listing of the deb and rpm
+	// packages while their database is unchanged.
+	FeatureInventoryDBCache = "inventory_db_cache"
+)
+
+// featureDefaults are the states of the feature flags that are not set.
+var featureDefaults = map[string]bool{
+	FeatureInventoryDBCache: true,
+}
+
+// parseFeatureFlags parses a comma separated list of name=value pairs into
+// flags, overriding the ones already set.
+func parseFeatureFlags(s string, flags map[string]string) {
+	for _, f := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(f), "=")
+		if ok && name != "" {
+			flags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+}
+
+// formatFeatureFlags is the inverse of parseFeatureFlags, sorted so equal
+// flags give equal configs.
+func formatFeatureFlags(flags map[string]string) string {
+	var pairs []string
+	for name, value := range flags {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parseRollout parses a feature flag value, "true", "false" or a rollout
+// percentage like "25%".
+func parseRollout(value string) (float64, error) {
+	if pct, ok := strings.CutSuffix(value, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid rollout percentage %q", value)
+		}
+		return p, nil
+	}
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid feature flag value %q, want true, false or a percentage", value)
+	}
+	if on {
+		return 100, nil
+	}
+	return 0, nil
+}
+
+// rolloutBucket places the instance in one of 100 buckets for the flag, the
+// same instance gets the same bucket every time but the instances in a
+// partial rollout differ between flags.
+func rolloutBucket(name, instance string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + instance))
+	return float64(h.Sum32() % 100)
+}
+
+// FeatureEnabled reports whether the feature flag name is on for this
+// instance. Flags are set with the osconfig-feature-flags metadata, a comma
+// separated list of name=value pairs where instance values override project
+// ones, or the feature_flags of the config file. A value is true, false or a
+// percentage of the instances to roll the feature out to, e.g.
+// "inventory_db_cache=25%", picked by a hash of the instance ID. Flags that
+// are not set or invalid have their default.
+func FeatureEnabled(name string) bool {
+	c := getAgentConfig()
+	flags := map[string]string{}
+	parseFeatureFlags(c.featureFlags, flags)
+	value, ok := flags[name]
+	if !ok {
+		return featureDefaults[name]
+	}
+	pct, err := parseRollout(value)
+	if err != nil {
+		return featureDefaults[name]
+	}
+	instance := c.instanceID
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	return rolloutBucket(name, instance) < pct
+}
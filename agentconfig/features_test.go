@@ -0,0 +1,82 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFeatureEnabled(t *testing.T) {
+	var md metadataJSON
+	md.Project.Attributes.FeatureFlags = "on=true,off=true,half=50%"
+	md.Instance.Attributes.FeatureFlags = "off=false, bad=maybe"
+
+	old := getAgentConfig()
+	defer func() { agentConfig = &old }()
+	agentConfig = createConfigFromMetadata(md)
+
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"on", true},
+		{"off", false},
+		{"bad", false},
+		{"unset", false},
+		{FeatureInventoryDBCache, true},
+	} {
+		if got := FeatureEnabled(tt.name); got != tt.want {
+			t.Errorf("FeatureEnabled(%q) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+
+	// A partial rollout is stable for an instance and covers about the given
+	// share of instances.
+	var enabled int
+	for i := 0; i < 1000; i++ {
+		agentConfig.instanceID = fmt.Sprint(i)
+		got := FeatureEnabled("half")
+		if got != FeatureEnabled("half") {
+			t.Fatalf("FeatureEnabled(%q) is not stable for instance %d", "half", i)
+		}
+		if got {
+			enabled++
+		}
+	}
+	if enabled < 400 || enabled > 600 {
+		t.Errorf("FeatureEnabled(%q) is on for %d of 1000 instances, want about 500", "half", enabled)
+	}
+}
+
+func TestParseRollout(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"true", 100, false},
+		{"false", 0, false},
+		{"12.5%", 12.5, false},
+		{"101%", 0, true},
+		{"-1%", 0, true},
+		{"yes", 0, true},
+	} {
+		got, err := parseRollout(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRollout(%q) = %v, %v, want %v, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileLinux   = "/etc/osconfig/osconfig_agent.yaml"
+	configFileWindows = "C:/ProgramData/Google/OSConfig/osconfig_agent.yaml"
+
+	minPollInterval = time.Minute
+)
+
+var (
+	configFile = flag.String("config_file", "", "YAML agent configuration file, defaults to "+configFileLinux+" on Linux and "+configFileWindows+" on Windows if it exists")
+
+	// fileConf is the configuration file loaded by LoadConfigFile, nil if
+	// there is none.
+	fileConf *fileConfig
+	// fileConfSum is the SHA256 of the configuration file last loaded.
+	fileConfSum string
+)
+
+// fileConfig is the schema of the agent configuration file. Settings that
+// are set override the metadata, flags still take precedence.
+//
+//	endpoint: us-central1-osconfig.googleapis.com:443
+//	poll_interval: 10m
+//	log_level: debug
+//	features:
+//	  tasks: true
+//	  guest_policies: false
+//	  os_inventory: true
+//	  guest_attributes: true
+//	paths:
+//	  apt_repo_file: /etc/apt/sources.list.d/google_osconfig_managed.list
+//	inventory:
+//	  history_days: 30
+//	  export:
+//	    dir: /var/lib/google_osconfig_agent/inventory
+//	    interval: 1h
+//	    formats: [json, spdx]
+//	    keep: 24
+//	patch:
+//	  protected_packages: [kernel, openssh-server]
+//	  restart_services: [nginx, php*-fpm]
+//	  env:
+//	    http_proxy: http://proxy:3128
+//	proxy:
+//	  https: http://proxy:3128
+//	  no_proxy: .internal
+//	mirrors:
+//	  https://packages.cloud.google.com/: https://mirror.example.com/gcp/
+//	feature_flags:
+//	  inventory_db_cache: 25%
+//	command_audit:
+//	  enabled: true
+//	  redact: [passphrase]
+//	webhooks:
+//	- url: https://cmdb.example.com/osconfig
+//	  secret: s3cr3t
+//	  events: [inventory-change, after-patch]
+//	  timeout: 2m
+//	exporters:
+//	- url: gs://reports-bucket/osconfig/
+//	- url: s3://reports/osconfig/?region=eu-west-1
+//	  events: [after-patch]
+//	maintenance_windows:
+//	- name: weekend
+//	  schedule: "0 2 * * 6"
+//	  duration: 4h
+//	  time_zone: Europe/Berlin
+//	  security: true
+//	  excludes: [kernel*]
+type fileConfig struct {
+	Endpoint     string         `yaml:"endpoint"`
+	PollInterval *time.Duration `yaml:"poll_interval"`
+	LogLevel     string         `yaml:"log_level"`
+	Features     struct {
+		Tasks           *bool `yaml:"tasks"`
+		GuestPolicies   *bool `yaml:"guest_policies"`
+		OSInventory     *bool `yaml:"os_inventory"`
+		GuestAttributes *bool `yaml:"guest_attributes"`
+	} `yaml:"features"`
+	Paths struct {
+		AptRepoFile    string `yaml:"apt_repo_file"`
+		YumRepoFile    string `yaml:"yum_repo_file"`
+		ZypperRepoFile string `yaml:"zypper_repo_file"`
+		GooGetRepoFile string `yaml:"googet_repo_file"`
+	} `yaml:"paths"`
+	Inventory struct {
+		Anonymize    string `yaml:"anonymize"`
+		HistoryDays  *int   `yaml:"history_days"`
+		HistoryDelta *bool  `yaml:"history_delta"`
+		Anomalies    string `yaml:"anomalies"`
+		Export       struct {
+			Dir      string         `yaml:"dir"`
+			Interval *time.Duration `yaml:"interval"`
+			Formats  []string       `yaml:"formats"`
+			Keep     *int           `yaml:"keep"`
+			MaxAge   *time.Duration `yaml:"max_age"`
+		} `yaml:"export"`
+	} `yaml:"inventory"`
+	Patch struct {
+		ProtectedPackages []string          `yaml:"protected_packages"`
+		RestartServices   []string          `yaml:"restart_services"`
+		Env               map[string]string `yaml:"env"`
+	} `yaml:"patch"`
+	Proxy struct {
+		HTTP    string `yaml:"http"`
+		HTTPS   string `yaml:"https"`
+		NoProxy string `yaml:"no_proxy"`
+	} `yaml:"proxy"`
+	Mirrors      map[string]string `yaml:"mirrors"`
+	FeatureFlags map[string]string `yaml:"feature_flags"`
+	Credentials  string            `yaml:"credentials"`
+	CloudTags    string            `yaml:"cloud_tags"`
+	CommandAudit struct {
+		Enabled *bool    `yaml:"enabled"`
+		Redact  []string `yaml:"redact"`
+	} `yaml:"command_audit"`
+	Webhooks []struct {
+		URL     string         `yaml:"url"`
+		Secret  string         `yaml:"secret"`
+		Events  []string       `yaml:"events"`
+		Timeout *time.Duration `yaml:"timeout"`
+	} `yaml:"webhooks"`
+	Exporters []struct {
+		URL     string         `yaml:"url"`
+		Events  []string       `yaml:"events"`
+		Timeout *time.Duration `yaml:"timeout"`
+	} `yaml:"exporters"`
+	MaintenanceWindows []struct {
+		Name     string         `yaml:"name"`
+		Schedule string         `yaml:"schedule"`
+		Duration *time.Duration `yaml:"duration"`
+		TimeZone string         `yaml:"time_zone"`
+		Security bool           `yaml:"security"`
+		Minimal  bool           `yaml:"minimal"`
+		Excludes []string       `yaml:"excludes"`
+		Reboot   string         `yaml:"reboot"`
+	} `yaml:"maintenance_windows"`
+}
+
+// validate checks the values the schema can't, returning all the problems
+// found.
+func (f *fileConfig) validate() error {
+	var errs []string
+	if f.Endpoint != "" {
+		if _, _, err := net.SplitHostPort(f.Endpoint); err != nil {
+			errs = append(errs, fmt.Sprintf("endpoint: %q is not of the form host:port", f.Endpoint))
+		}
+	}
+	if f.PollInterval != nil && *f.PollInterval < minPollInterval {
+		errs = append(errs, fmt.Sprintf("poll_interval: must be at least %s, got %s", minPollInterval, *f.PollInterval))
+	}
+	switch f.LogLevel {
+	case "", "debug", "info":
+	default:
+		errs = append(errs, fmt.Sprintf("log_level: must be debug or info, got %q", f.LogLevel))
+	}
+	for _, p := range []struct{ name, path string }{
+		{"apt_repo_file", f.Paths.AptRepoFile},
+		{"yum_repo_file", f.Paths.YumRepoFile},
+		{"zypper_repo_file", f.Paths.ZypperRepoFile},
+		{"googet_repo_file", f.Paths.GooGetRepoFile},
+	} {
+		if p.path != "" && !filepath.IsAbs(p.path) {
+			errs = append(errs, fmt.Sprintf("paths.%s: must be an absolute path, got %q", p.name, p.path))
+		}
+	}
+	if f.Inventory.HistoryDays != nil && *f.Inventory.HistoryDays < 0 {
+		errs = append(errs, fmt.Sprintf("inventory.history_days: must not be negative, got %d", *f.Inventory.HistoryDays))
+	}
+	if e := f.Inventory.Export; e.Dir != "" || e.Interval != nil || e.Formats != nil || e.Keep != nil || e.MaxAge != nil {
+		if !filepath.IsAbs(e.Dir) {
+			errs = append(errs, fmt.Sprintf("inventory.export.dir: must be an absolute path, got %q", e.Dir))
+		}
+		if e.Interval != nil && *e.Interval < minPollInterval {
+			errs = append(errs, fmt.Sprintf("inventory.export.interval: must be at least %s, got %s", minPollInterval, *e.Interval))
+		}
+		for _, format := range e.Formats {
+			if format != "json" && format != "spdx" {
+				errs = append(errs, fmt.Sprintf("inventory.export.formats: must be json or spdx, got %q", format))
+			}
+		}
+		if e.Keep != nil && *e.Keep < 0 {
+			errs = append(errs, fmt.Sprintf("inventory.export.keep: must not be negative, got %d", *e.Keep))
+		}
+		if e.MaxAge != nil && *e.MaxAge < 0 {
+			errs = append(errs, fmt.Sprintf("inventory.export.max_age: must not be negative, got %s", *e.MaxAge))
+		}
+	}
+	for _, k := range sortedKeys(f.Patch.Env) {
+		if k == "" || strings.ContainsAny(k, "=;") || strings.Contains(f.Patch.Env[k], ";") {
+			errs = append(errs, fmt.Sprintf("patch.env: invalid entry %q: %q, names can't contain '=' or ';' and values can't contain ';'", k, f.Patch.Env[k]))
+		}
+	}
+	for _, p := range []struct{ name, proxy string }{
+		{"proxy.http", f.Proxy.HTTP},
+		{"proxy.https", f.Proxy.HTTPS},
+	} {
+		if p.proxy == "" {
+			continue
+		}
+		if u, err := url.Parse(p.proxy); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s: %q is not a proxy URL like http://proxy:3128", p.name, p.proxy))
+		}
+	}
+	for _, from := range sortedKeys(f.Mirrors) {
+		to := f.Mirrors[from]
+		if strings.ContainsAny(from+to, ",=") || to == "" {
+			errs = append(errs, fmt.Sprintf("mirrors: invalid entry %q: %q, URLs can't contain ',' or '='", from, to))
+		}
+	}
+	for _, name := range sortedKeys(f.FeatureFlags) {
+		if strings.ContainsAny(name+f.FeatureFlags[name], ",=") {
+			errs = append(errs, fmt.Sprintf("feature_flags.%s: names and values can't contain ',' or '='", name))
+		} else if _, err := parseRollout(f.FeatureFlags[name]); err != nil {
+			errs = append(errs, fmt.Sprintf("feature_flags.%s: %v", name, err))
+		}
+	}
+	for i, w := range f.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("webhooks[%d].url: %q is not an http or https URL", i, w.URL))
+		}
+		if len(w.Events) == 0 {
+			errs = append(errs, fmt.Sprintf("webhooks[%d].events: must list at least one event", i))
+		}
+		if w.Timeout != nil && *w.Timeout < 0 {
+			errs = append(errs, fmt.Sprintf("webhooks[%d].timeout: must not be negative, got %s", i, *w.Timeout))
+		}
+	}
+	for i, e := range f.Exporters {
+		u, err := url.Parse(e.URL)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Sprintf("exporters[%d].url: %v", i, err))
+		case e.URL == "stdout", u.Scheme == "stdout", u.Scheme == "pubsub" && u.Host != "":
+		case u.Scheme == "file":
+			if !filepath.IsAbs(u.Path) {
+				errs = append(errs, fmt.Sprintf("exporters[%d].url: file path must be absolute, got %q", i, u.Path))
+			}
+		case u.Scheme == "gs", u.Scheme == "s3":
+			if u.Host == "" {
+				errs = append(errs, fmt.Sprintf("exporters[%d].url: %q has no bucket", i, e.URL))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("exporters[%d].url: %q is not stdout or a file, gs, s3 or pubsub URL", i, e.URL))
+		}
+		if e.Timeout != nil && *e.Timeout < 0 {
+			errs = append(errs, fmt.Sprintf("exporters[%d].timeout: must not be negative, got %s", i, *e.Timeout))
+		}
+	}
+	names := map[string]bool{}
+	for i, w := range f.MaintenanceWindows {
+		if w.Name == "" || names[w.Name] {
+			errs = append(errs, fmt.Sprintf("maintenance_windows[%d].name: must be set and unique, got %q", i, w.Name))
+		}
+		names[w.Name] = true
+		if len(strings.Fields(w.Schedule)) != 5 && !strings.HasPrefix(w.Schedule, "@") {
+			errs = append(errs, fmt.Sprintf("maintenance_windows[%d].schedule: %q is not a cron expression", i, w.Schedule))
+		}
+		if w.Duration == nil || *w.Duration < time.Minute {
+			errs = append(errs, fmt.Sprintf("maintenance_windows[%d].duration: must be at least 1m0s", i))
+		}
+		if _, err := time.LoadLocation(w.TimeZone); err != nil {
+			errs = append(errs, fmt.Sprintf("maintenance_windows[%d].time_zone: %v", i, err))
+		}
+		switch w.Reboot {
+		case "", "default", "always", "never":
+		default:
+			errs = append(errs, fmt.Sprintf("maintenance_windows[%d].reboot: must be default, always or never, got %q", i, w.Reboot))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// apply overrides the settings of c that are set in f, except the endpoint
+// which setSVCEndpoint handles.
+func (f *fileConfig) apply(c *config) {
+	if f.PollInterval != nil {
+		c.osConfigPollInterval = int(*f.PollInterval / time.Minute)
+	}
+	switch f.LogLevel {
+	case "debug":
+		c.debugEnabled = true
+	case "info":
+		c.debugEnabled = false
+	}
+	setBool(&c.taskNotificationEnabled, f.Features.Tasks)
+	setBool(&c.guestPoliciesEnabled, f.Features.GuestPolicies)
+	setBool(&c.osInventoryEnabled, f.Features.OSInventory)
+	setBool(&c.guestAttributesEnabled, f.Features.GuestAttributes)
+	setString(&c.aptRepoFilePath, f.Paths.AptRepoFile)
+	setString(&c.yumRepoFilePath, f.Paths.YumRepoFile)
+	setString(&c.zypperRepoFilePath, f.Paths.ZypperRepoFile)
+	setString(&c.googetRepoFilePath, f.Paths.GooGetRepoFile)
+	setString(&c.inventoryAnonymize, f.Inventory.Anonymize)
+	if f.Inventory.HistoryDays != nil {
+		c.inventoryHistoryDays = *f.Inventory.HistoryDays
+	}
+	setBool(&c.inventoryHistoryDelta, f.Inventory.HistoryDelta)
+	setString(&c.inventoryAnomalies, f.Inventory.Anomalies)
+	setString(&c.inventoryExportDir, f.Inventory.Export.Dir)
+	if f.Inventory.Export.Interval != nil {
+		c.inventoryExportInterval = *f.Inventory.Export.Interval
+	}
+	if f.Inventory.Export.Formats != nil {
+		c.inventoryExportFormats = strings.Join(f.Inventory.Export.Formats, ",")
+	}
+	if f.Inventory.Export.Keep != nil {
+		c.inventoryExportKeep = *f.Inventory.Export.Keep
+	}
+	if f.Inventory.Export.MaxAge != nil {
+		c.inventoryExportMaxAge = *f.Inventory.Export.MaxAge
+	}
+	if f.Patch.ProtectedPackages != nil {
+		c.protectedPackages = strings.Join(f.Patch.ProtectedPackages, ",")
+	}
+	if f.Patch.RestartServices != nil {
+		c.restartServices = strings.Join(f.Patch.RestartServices, ",")
+	}
+	if f.Patch.Env != nil {
+		var env []string
+		for _, k := range sortedKeys(f.Patch.Env) {
+			env = append(env, k+"="+f.Patch.Env[k])
+		}
+		c.patchEnv = strings.Join(env, ";")
+	}
+	setString(&c.httpProxy, f.Proxy.HTTP)
+	setString(&c.httpsProxy, f.Proxy.HTTPS)
+	setString(&c.noProxy, f.Proxy.NoProxy)
+	if f.Mirrors != nil {
+		var mirrors []string
+		for _, from := range sortedKeys(f.Mirrors) {
+			mirrors = append(mirrors, from+"="+f.Mirrors[from])
+		}
+		c.mirrors = strings.Join(mirrors, ",")
+	}
+	if len(f.FeatureFlags) > 0 {
+		flags := map[string]string{}
+		parseFeatureFlags(c.featureFlags, flags)
+		for name, value := range f.FeatureFlags {
+			flags[strings.ToLower(name)] = value
+		}
+		c.featureFlags = formatFeatureFlags(flags)
+	}
+	setString(&c.credentials, f.Credentials)
+	setString(&c.cloudTags, f.CloudTags)
+	setBool(&c.commandAudit, f.CommandAudit.Enabled)
+	if f.CommandAudit.Redact != nil {
+		c.commandAuditRedact = strings.Join(f.CommandAudit.Redact, ",")
+	}
+	for _, w := range f.Webhooks {
+		webhook := Webhook{URL: w.URL, Secret: w.Secret, Events: w.Events}
+		if w.Timeout != nil {
+			webhook.Timeout = *w.Timeout
+		}
+		c.webhooks = append(c.webhooks, webhook)
+	}
+	for _, e := range f.Exporters {
+		exporter := Exporter{URL: e.URL, Events: e.Events}
+		if e.Timeout != nil {
+			exporter.Timeout = *e.Timeout
+		}
+		c.exporters = append(c.exporters, exporter)
+	}
+	for _, w := range f.MaintenanceWindows {
+		c.maintenanceWindows = append(c.maintenanceWindows, MaintenanceWindow{
+			Name:     w.Name,
+			Schedule: w.Schedule,
+			Duration: *w.Duration,
+			TimeZone: w.TimeZone,
+			Security: w.Security,
+			Minimal:  w.Minimal,
+			Excludes: w.Excludes,
+			Reboot:   w.Reboot,
+		})
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func setBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// parseConfigFile decodes and validates a configuration file, unknown
+// settings are errors.
+func parseConfigFile(data []byte) (*fileConfig, error) {
+	f := &fileConfig{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ConfigFile is the path of the agent configuration file.
+func ConfigFile() string {
+	if *configFile != "" {
+		return *configFile
+	}
+	if runtime.GOOS == "windows" {
+		return configFileWindows
+	}
+	return configFileLinux
+}
+
+// readConfigFile reads the agent configuration file, returning nil data if
+// there is none and it was not set with -config_file.
+func readConfigFile() ([]byte, error) {
+	data, err := os.ReadFile(ConfigFile())
+	if err != nil {
+		if os.IsNotExist(err) && *configFile == "" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	return data, nil
+}
+
+// LoadConfigFile loads the agent configuration file, its settings are
+// applied from the next WatchConfig on. A missing file is only an error if
+// it was set with -config_file.
+func LoadConfigFile() error {
+	data, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	var f *fileConfig
+	if data != nil {
+		if f, err = parseConfigFile(data); err != nil {
+			return fmt.Errorf("invalid config file %s: %v", ConfigFile(), err)
+		}
+	}
+	agentConfigMx.Lock()
+	defer agentConfigMx.Unlock()
+	fileConf, fileConfSum = f, fmt.Sprintf("%x", sha256.Sum256(data))
+	return nil
+}
+
+func getFileConfig() *fileConfig {
+	agentConfigMx.RLock()
+	defer agentConfigMx.RUnlock()
+	return fileConf
+}
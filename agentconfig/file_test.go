@@ -0,0 +1,177 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr []string
+	}{
+		{"Empty", "", nil},
+		{"Valid", "endpoint: host:443\npoll_interval: 5m\nlog_level: debug\npaths:\n  yum_repo_file: /etc/yum.repos.d/managed.repo\n", nil},
+		{"UnknownField", "features:\n  taskz: true\n", []string{"line 2", "field taskz not found"}},
+		{"WrongType", "inventory:\n  history_days: many\n", []string{"line 2", "cannot unmarshal"}},
+		{"InvalidValues", "endpoint: host\npoll_interval: 30s\nlog_level: trace\npaths:\n  apt_repo_file: managed.list\ninventory:\n  history_days: -1\n", []string{
+			`endpoint: "host" is not of the form host:port`,
+			"poll_interval: must be at least 1m0s, got 30s",
+			`log_level: must be debug or info, got "trace"`,
+			`paths.apt_repo_file: must be an absolute path, got "managed.list"`,
+			"inventory.history_days: must not be negative, got -1",
+		}},
+		{"InvalidExport", "inventory:\n  export:\n    interval: 10s\n    formats: [xml]\n    keep: -1\n", []string{
+			`inventory.export.dir: must be an absolute path, got ""`,
+			"inventory.export.interval: must be at least 1m0s, got 10s",
+			`inventory.export.formats: must be json or spdx, got "xml"`,
+			"inventory.export.keep: must not be negative, got -1",
+		}},
+		{"InvalidEnv", "patch:\n  env:\n    A;B: c\n", []string{`patch.env: invalid entry "A;B"`}},
+		{"InvalidProxy", "proxy:\n  https: proxy\nmirrors:\n  https://a/: \"\"\n", []string{`proxy.https: "proxy" is not a proxy URL`, `mirrors: invalid entry "https://a/"`}},
+		{"InvalidWebhook", "webhooks:\n- url: ftp://host/hook\n  events: []\n", []string{`webhooks[0].url: "ftp://host/hook" is not an http or https URL`, "webhooks[0].events: must list at least one event"}},
+		{"InvalidExporter", "exporters:\n- url: ftp://host/reports\n- url: file://reports.ndjson\n- url: gs:///prefix\n  timeout: -1s\n", []string{
+			`exporters[0].url: "ftp://host/reports" is not stdout or a file, gs, s3 or pubsub URL`,
+			`exporters[1].url: file path must be absolute, got ""`,
+			`exporters[2].url: "gs:///prefix" has no bucket`,
+			"exporters[2].timeout: must not be negative, got -1s",
+		}},
+		{"InvalidMaintenanceWindow", "maintenance_windows:\n- name: a\n  schedule: daily\n  time_zone: Mars/Olympus\n- name: a\n  schedule: 0 2 * * 6\n  duration: 1h\n  reboot: sometimes\n", []string{
+			`maintenance_windows[0].schedule: "daily" is not a cron expression`,
+			"maintenance_windows[0].duration: must be at least 1m0s",
+			"maintenance_windows[0].time_zone: unknown time zone Mars/Olympus",
+			`maintenance_windows[1].name: must be set and unique, got "a"`,
+			`maintenance_windows[1].reboot: must be default, always or never, got "sometimes"`,
+		}},
+		{"InvalidFeatureFlag", "feature_flags:\n  a: 200%\n  b: maybe\n", []string{`feature_flags.a: invalid rollout percentage "200%"`, `feature_flags.b: invalid feature flag value "maybe"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigFile([]byte(tt.data))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("parseConfigFile() error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("parseConfigFile() got nil error, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("parseConfigFile() error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osconfig_agent.yaml")
+	data := `
+endpoint: "{zone}-file.googleapis.com:443"
+poll_interval: 15m
+features:
+  tasks: true
+  os_inventory: false
+inventory:
+  export:
+    dir: /var/lib/inventory
+    formats: [json, spdx]
+    keep: 0
+patch:
+  protected_packages: [kernel, openssh-server]
+  restart_services: [nginx, php*-fpm]
+  env:
+    no_proxy: a,b
+    http_proxy: http://proxy:3128
+command_audit:
+  enabled: true
+webhooks:
+- url: https://cmdb.example.com/osconfig
+  secret: s3cr3t
+  events: [inventory-change]
+  timeout: 2m
+exporters:
+- url: stdout
+- url: s3://reports/osconfig/?region=eu-west-1
+  events: [after-patch]
+  timeout: 1m
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { *configFile = old }(*configFile)
+	*configFile = path
+	defer func() { fileConf, fileConfSum = nil, "" }()
+	if err := LoadConfigFile(); err != nil {
+		t.Fatalf("LoadConfigFile() error: %v", err)
+	}
+
+	var md metadataJSON
+	md.Instance.Zone = "projects/1/zones/us-west1-b"
+	md.Instance.Attributes.InventoryEnabled = "true"
+	md.Instance.Attributes.PatchEnv = "http_proxy=http://other:3128"
+	c := createConfigFromMetadata(md)
+
+	if want := "us-west1-b-file.googleapis.com:443"; c.svcEndpoint != want {
+		t.Errorf("svcEndpoint = %q, want %q", c.svcEndpoint, want)
+	}
+	if want := 15 * time.Minute; time.Duration(c.osConfigPollInterval)*time.Minute != want {
+		t.Errorf("osConfigPollInterval = %d, want %s", c.osConfigPollInterval, want)
+	}
+	if !c.taskNotificationEnabled || c.osInventoryEnabled || !c.commandAudit {
+		t.Errorf("got tasks %t, inventory %t, command audit %t, want true, false, true", c.taskNotificationEnabled, c.osInventoryEnabled, c.commandAudit)
+	}
+	if c.inventoryExportDir != "/var/lib/inventory" || c.inventoryExportFormats != "json,spdx" || c.inventoryExportKeep != 0 {
+		t.Errorf("got inventory export to %q as %q keeping %d, want /var/lib/inventory, json,spdx, 0", c.inventoryExportDir, c.inventoryExportFormats, c.inventoryExportKeep)
+	}
+	if want := "kernel,openssh-server"; c.protectedPackages != want {
+		t.Errorf("protectedPackages = %q, want %q", c.protectedPackages, want)
+	}
+	if want := "nginx,php*-fpm"; c.restartServices != want {
+		t.Errorf("restartServices = %q, want %q", c.restartServices, want)
+	}
+	if want := "http_proxy=http://proxy:3128;no_proxy=a,b"; c.patchEnv != want {
+		t.Errorf("patchEnv = %q, want %q", c.patchEnv, want)
+	}
+	wantHooks := []Webhook{{URL: "https://cmdb.example.com/osconfig", Secret: "s3cr3t", Events: []string{"inventory-change"}, Timeout: 2 * time.Minute}}
+	if !reflect.DeepEqual(c.webhooks, wantHooks) {
+		t.Errorf("webhooks = %+v, want %+v", c.webhooks, wantHooks)
+	}
+	wantExporters := []Exporter{{URL: "stdout"}, {URL: "s3://reports/osconfig/?region=eu-west-1", Events: []string{"after-patch"}, Timeout: time.Minute}}
+	if !reflect.DeepEqual(c.exporters, wantExporters) {
+		t.Errorf("exporters = %+v, want %+v", c.exporters, wantExporters)
+	}
+
+	// The endpoint flag takes precedence over the config file.
+	defer func(old string) { *endpoint = old }(*endpoint)
+	*endpoint = "flag:443"
+	if c := createConfigFromMetadata(md); c.svcEndpoint != "flag:443" {
+		t.Errorf("svcEndpoint = %q, want %q", c.svcEndpoint, "flag:443")
+	}
+
+	*configFile = filepath.Join(t.TempDir(), "missing.yaml")
+	if err := LoadConfigFile(); err == nil {
+		t.Error("LoadConfigFile() with a missing -config_file got nil error")
+	}
+}
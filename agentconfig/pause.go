@@ -0,0 +1,181 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Subsystems that can be paused.
+const (
+	SubsystemInventory    = "inventory"
+	SubsystemPatching     = "patching"
+	SubsystemPolicy       = "policy"
+	SubsystemDriftWatcher = "drift-watcher"
+)
+
+var (
+	// Subsystems lists all subsystems that can be paused.
+	Subsystems = []string{SubsystemInventory, SubsystemPatching, SubsystemPolicy, SubsystemDriftWatcher}
+	// ErrNegativePause is returned by Pause for a negative duration.
+	ErrNegativePause = errors.New("pause duration is negative")
+
+	pauseMx   sync.Mutex
+	pauseFile = func() string { return filepath.Join(CacheDir(), "osconfig_paused.json") }
+)
+
+// pauseState maps a subsystem to the time its pause ends, a zero time means
+// the subsystem is paused until it is resumed.
+type pauseState map[string]time.Time
+
+// PauseFile is the location of the persisted pause state.
+func PauseFile() string {
+	return pauseFile()
+}
+
+func validSubsystem(subsystem string) error {
+	for _, s := range Subsystems {
+		if s == subsystem {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown subsystem %q, valid subsystems are %q", subsystem, Subsystems)
+}
+
+func loadPauseState() (pauseState, error) {
+	state := pauseState{}
+	data, err := ioutil.ReadFile(PauseFile())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing pause state %q: %v", PauseFile(), err)
+	}
+	return state, nil
+}
+
+func savePauseState(state pauseState) error {
+	// Drop expired pauses so the file does not grow.
+	for s, until := range state {
+		if !until.IsZero() && time.Now().After(until) {
+			delete(state, s)
+		}
+	}
+	if len(state) == 0 {
+		if err := os.Remove(PauseFile()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(PauseFile()), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(PauseFile(), data, 0600)
+}
+
+// Pause pauses a subsystem for the duration d, or until Resume is called if
+// d is zero. The pause state is persisted across agent restarts.
+func Pause(subsystem string, d time.Duration) error {
+	if err := validSubsystem(subsystem); err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("%w: %s", ErrNegativePause, d)
+	}
+	pauseMx.Lock()
+	defer pauseMx.Unlock()
+
+	state, err := loadPauseState()
+	if err != nil {
+		return err
+	}
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	state[subsystem] = until
+	return savePauseState(state)
+}
+
+// Resume resumes a paused subsystem.
+func Resume(subsystem string) error {
+	if err := validSubsystem(subsystem); err != nil {
+		return err
+	}
+	pauseMx.Lock()
+	defer pauseMx.Unlock()
+
+	state, err := loadPauseState()
+	if err != nil {
+		return err
+	}
+	delete(state, subsystem)
+	return savePauseState(state)
+}
+
+// PausedUntil reports whether a subsystem is currently paused and when the
+// pause ends, a zero time means it is paused until resumed.
+func PausedUntil(subsystem string) (time.Time, bool) {
+	pauseMx.Lock()
+	defer pauseMx.Unlock()
+
+	state, err := loadPauseState()
+	if err != nil {
+		// Don't let a corrupt pause file stop the agent from working.
+		return time.Time{}, false
+	}
+	until, ok := state[subsystem]
+	if !ok || (!until.IsZero() && time.Now().After(until)) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// Paused reports whether a subsystem is currently paused.
+func Paused(subsystem string) bool {
+	_, paused := PausedUntil(subsystem)
+	return paused
+}
+
+// PauseMessage returns a description of a subsystem pause for logs and task
+// results.
+func PauseMessage(subsystem string) string {
+	until, paused := PausedUntil(subsystem)
+	switch {
+	case !paused:
+		return fmt.Sprintf("%s is not paused", subsystem)
+	case until.IsZero():
+		return fmt.Sprintf("%s is paused on this instance until resumed", subsystem)
+	default:
+		return fmt.Sprintf("%s is paused on this instance until %s", subsystem, until.Format(time.RFC3339))
+	}
+}
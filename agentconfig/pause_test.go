@@ -0,0 +1,85 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { pauseFile = f }(pauseFile)
+	pauseFile = func() string { return filepath.Join(dir, "paused.json") }
+
+	if Paused(SubsystemPatching) {
+		t.Fatalf("patching paused before Pause was called")
+	}
+	if err := Pause("foo", 0); err == nil {
+		t.Errorf("did not get expected error pausing unknown subsystem")
+	}
+	if err := Pause(SubsystemPatching, -time.Hour); !errors.Is(err, ErrNegativePause) {
+		t.Errorf("Pause with a negative duration = %v, want %v", err, ErrNegativePause)
+	}
+	if Paused(SubsystemPatching) {
+		t.Errorf("patching paused by a negative duration")
+	}
+
+	if err := Pause(SubsystemPatching, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pause(SubsystemInventory, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if until, ok := PausedUntil(SubsystemPatching); !ok || !until.IsZero() {
+		t.Errorf("PausedUntil(%q) = (%v, %v), want (zero time, true)", SubsystemPatching, until, ok)
+	}
+	if until, ok := PausedUntil(SubsystemInventory); !ok || until.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("PausedUntil(%q) = (%v, %v), want about an hour from now", SubsystemInventory, until, ok)
+	}
+	if Paused(SubsystemPolicy) {
+		t.Errorf("%q paused but only %q and %q were", SubsystemPolicy, SubsystemPatching, SubsystemInventory)
+	}
+
+	if err := Resume(SubsystemPatching); err != nil {
+		t.Fatal(err)
+	}
+	if Paused(SubsystemPatching) {
+		t.Errorf("%q still paused after Resume", SubsystemPatching)
+	}
+
+	// Expired pauses are ignored and cleaned up on the next write.
+	if err := Pause(SubsystemPolicy, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if Paused(SubsystemPolicy) {
+		t.Errorf("%q still paused after the pause expired", SubsystemPolicy)
+	}
+	if err := Resume(SubsystemInventory); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(PauseFile()); !os.IsNotExist(err) {
+		t.Errorf("pause file should be removed once nothing is paused, stat error: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	proxyFuncMx  sync.Mutex
+	proxyFunc    func(*url.URL) (*url.URL, error)
+	proxyFuncKey httpproxy.Config
+)
+
+func (c *config) proxyConfig() httpproxy.Config {
+	return httpproxy.Config{HTTPProxy: c.httpProxy, HTTPSProxy: c.httpsProxy, NoProxy: c.noProxy}
+}
+
+// ProxyEnv returns the http_proxy, https_proxy and no_proxy variables, in
+// lower and upper case, of the proxy settings for the environment of
+// spawned commands. It is empty if no proxy is configured, the commands then
+// inherit the agent environment.
+func ProxyEnv() []string {
+	c := getAgentConfig()
+	pc := c.proxyConfig()
+	var env []string
+	for _, v := range []struct{ name, value string }{
+		{"http_proxy", pc.HTTPProxy},
+		{"https_proxy", pc.HTTPSProxy},
+		{"no_proxy", pc.NoProxy},
+	} {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value, strings.ToUpper(v.name)+"="+v.value)
+		}
+	}
+	return env
+}
+
+// Proxy returns the proxy for req from the osconfig-http-proxy,
+// osconfig-https-proxy and osconfig-no-proxy settings, or from the agent
+// environment if none are set, for http.Transport.Proxy.
+func Proxy(req *http.Request) (*url.URL, error) {
+	c := getAgentConfig()
+	pc := c.proxyConfig()
+	if pc == (httpproxy.Config{}) {
+		return http.ProxyFromEnvironment(req)
+	}
+
+	proxyFuncMx.Lock()
+	if proxyFunc == nil || pc != proxyFuncKey {
+		proxyFunc, proxyFuncKey = pc.ProxyFunc(), pc
+	}
+	f := proxyFunc
+	proxyFuncMx.Unlock()
+	return f(req.URL)
+}
+
+// parseMirrors parses a comma separated list of from=to URL prefix pairs,
+// skipping malformed entries.
+func parseMirrors(s string) map[string]string {
+	mirrors := map[string]string{}
+	for _, m := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(m), "=")
+		if ok && from != "" && to != "" {
+			mirrors[from] = to
+		}
+	}
+	return mirrors
+}
+
+// Mirrors returns the URL prefix rewrites of the osconfig-mirrors setting,
+// a comma separated list of from=to pairs in the metadata, e.g.
+// "https://packages.cloud.google.com/=https://mirror.example.com/gcp/".
+func Mirrors() map[string]string {
+	return parseMirrors(getAgentConfig().mirrors)
+}
+
+// MirrorURL rewrites u to its mirror, the longest matching prefix of
+// Mirrors wins. u is returned as is if no mirror matches.
+func MirrorURL(u string) string {
+	mirrors := Mirrors()
+	var prefixes []string
+	for from := range mirrors {
+		if strings.HasPrefix(u, from) {
+			prefixes = append(prefixes, from)
+		}
+	}
+	if len(prefixes) == 0 {
+		return u
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return mirrors[prefixes[0]] + strings.TrimPrefix(u, prefixes[0])
+}
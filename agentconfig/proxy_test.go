@@ -0,0 +1,75 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProxy(t *testing.T) {
+	var md metadataJSON
+	md.Project.Attributes.HTTPSProxy = "http://project-proxy:3128"
+	md.Instance.Attributes.HTTPSProxy = "http://proxy:3128"
+	md.Instance.Attributes.NoProxy = ".internal"
+	md.Project.Attributes.Mirrors = "https://example.com/=https://mirror/all/,https://example.com/debian/=https://mirror/debian/"
+
+	old := getAgentConfig()
+	defer func() { agentConfig = &old }()
+	agentConfig = createConfigFromMetadata(md)
+
+	want := []string{"https_proxy=http://proxy:3128", "HTTPS_PROXY=http://proxy:3128", "no_proxy=.internal", "NO_PROXY=.internal"}
+	if diff := cmp.Diff(want, ProxyEnv()); diff != "" {
+		t.Errorf("ProxyEnv() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, tt := range []struct {
+		url, want string
+	}{
+		{"https://repo.example.org/", "http://proxy:3128"},
+		{"https://repo.internal/", ""},
+		{"http://repo.example.org/", ""},
+	} {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy(%s) error: %v", tt.url, err)
+		}
+		var got string
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("Proxy(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		url, want string
+	}{
+		{"https://example.com/debian/dists/stable", "https://mirror/debian/dists/stable"},
+		{"https://example.com/centos/", "https://mirror/all/centos/"},
+		{"https://other.com/debian/", "https://other.com/debian/"},
+	} {
+		if got := MirrorURL(tt.url); got != tt.want {
+			t.Errorf("MirrorURL(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+// configFileReloadInterval is how often WatchConfigFile checks the config
+// file for changes.
+const configFileReloadInterval = time.Minute
+
+var (
+	// updateMx serializes building and swapping in a new config, so a
+	// config file reload can't overwrite a newer metadata change and the
+	// subscribers are notified in order.
+	updateMx sync.Mutex
+	// lastMetadata is the metadata the active config was built from.
+	lastMetadata metadataJSON
+
+	subscribers      []*subscriber
+	subscribersMx    sync.Mutex
+	nextSubscriberID int
+
+	// configReloaded wakes up WatchConfig when the config file changed the
+	// config.
+	configReloaded = make(chan struct{}, 1)
+)
+
+type subscriber struct {
+	id int
+	f  func()
+}
+
+// Subscribe calls f after each change of the agent configuration, whether
+// from metadata or the config file, e.g. to apply a new poll interval
+// without restarting the agent. The calls are not concurrent, f should not
+// block. The returned function unsubscribes f.
+func Subscribe(f func()) func() {
+	subscribersMx.Lock()
+	defer subscribersMx.Unlock()
+	nextSubscriberID++
+	id := nextSubscriberID
+	subscribers = append(subscribers, &subscriber{id: id, f: f})
+	return func() {
+		subscribersMx.Lock()
+		defer subscribersMx.Unlock()
+		for i, s := range subscribers {
+			if s.id == id {
+				subscribers = append(subscribers[:i:i], subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func notifySubscribers() {
+	subscribersMx.Lock()
+	subs := append([]*subscriber(nil), subscribers...)
+	subscribersMx.Unlock()
+	for _, s := range subs {
+		s.f()
+	}
+}
+
+// updateConfig builds the config from md and the loaded config file and
+// swaps it in if it changed, notifying the subscribers. It reports whether
+// the config changed, called with updateMx held.
+func updateConfig(md metadataJSON) bool {
+	c := createConfigFromMetadata(md)
+	agentConfigMx.Lock()
+	lastMetadata = md
+	if agentConfig.asSha256() == c.asSha256() {
+		agentConfigMx.Unlock()
+		return false
+	}
+	agentConfig = c
+	agentConfigMx.Unlock()
+	notifySubscribers()
+	return true
+}
+
+// ReloadConfigFile loads the config file again if its content changed and
+// applies it on top of the last metadata. An invalid file is reported once
+// and the previous settings are kept.
+func ReloadConfigFile() error {
+	data, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	updateMx.Lock()
+	defer updateMx.Unlock()
+	agentConfigMx.Lock()
+	if sum == fileConfSum {
+		agentConfigMx.Unlock()
+		return nil
+	}
+	fileConfSum = sum
+	md := lastMetadata
+	agentConfigMx.Unlock()
+
+	var f *fileConfig
+	if data != nil {
+		if f, err = parseConfigFile(data); err != nil {
+			return fmt.Errorf("invalid config file %s, keeping the previous settings: %v", ConfigFile(), err)
+		}
+	}
+	agentConfigMx.Lock()
+	fileConf = f
+	agentConfigMx.Unlock()
+
+	if updateConfig(md) {
+		select {
+		case configReloaded <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// WatchConfigFile reloads the config file when it changes until ctx is
+// done.
+func WatchConfigFile(ctx context.Context) {
+	ticker := time.NewTicker(configFileReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ReloadConfigFile(); err != nil {
+				clog.Errorf(ctx, "Error reloading config file: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osconfig_agent.yaml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("poll_interval: 5m\n")
+	defer func(old string) { *configFile = old }(*configFile)
+	*configFile = path
+	defer func() { fileConf, fileConfSum = nil, "" }()
+	if err := LoadConfigFile(); err != nil {
+		t.Fatalf("LoadConfigFile() error: %v", err)
+	}
+	updateMx.Lock()
+	updateConfig(metadataJSON{})
+	updateMx.Unlock()
+
+	var calls int
+	unsubscribe := Subscribe(func() { calls++ })
+
+	// An unchanged file is not applied again.
+	if err := ReloadConfigFile(); err != nil || calls != 0 {
+		t.Fatalf("ReloadConfigFile() of an unchanged file got error %v and %d notifications, want none", err, calls)
+	}
+
+	write("poll_interval: 20m\n")
+	if err := ReloadConfigFile(); err != nil {
+		t.Fatalf("ReloadConfigFile() error: %v", err)
+	}
+	if calls != 1 || SvcPollInterval() != 20*time.Minute {
+		t.Errorf("got %d notifications and poll interval %s, want 1 and 20m", calls, SvcPollInterval())
+	}
+	select {
+	case <-configReloaded:
+	default:
+		t.Error("ReloadConfigFile() did not wake up WatchConfig")
+	}
+
+	// An invalid file is reported once and the previous settings kept.
+	write("poll_interval: 1s\n")
+	if err := ReloadConfigFile(); err == nil {
+		t.Error("ReloadConfigFile() of an invalid file got nil error")
+	}
+	if err := ReloadConfigFile(); err != nil {
+		t.Errorf("ReloadConfigFile() of the same invalid file got error: %v", err)
+	}
+	if calls != 1 || SvcPollInterval() != 20*time.Minute {
+		t.Errorf("got %d notifications and poll interval %s, want 1 and 20m", calls, SvcPollInterval())
+	}
+
+	unsubscribe()
+	write("poll_interval: 30m\n")
+	if err := ReloadConfigFile(); err != nil {
+		t.Fatalf("ReloadConfigFile() error: %v", err)
+	}
+	if calls != 1 || SvcPollInterval() != 30*time.Minute {
+		t.Errorf("got %d notifications and poll interval %s after unsubscribing, want 1 and 30m", calls, SvcPollInterval())
+	}
+	<-configReloaded
+}
@@ -30,6 +30,7 @@ import (
 	agentendpoint "cloud.google.com/go/osconfig/agentendpoint/apiv1"
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/cloudtags"
 	"github.com/GoogleCloudPlatform/osconfig/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/retryutil"
 	"github.com/GoogleCloudPlatform/osconfig/tasker"
@@ -45,6 +46,10 @@ import (
 
 const apiRetrySec = 600
 
+// PatchTaskName is the task name of patch runs, also of the ones started on
+// the agent itself, so that no two of them run at the same time.
+const PatchTaskName = "PatchRun"
+
 var (
 	errServerCancel      = errors.New("task canceled by server")
 	errServiceNotEnabled = errors.New("service is not enabled for this project")
@@ -82,8 +87,10 @@ func NewClient(ctx context.Context) (*Client, error) {
 
 // Close cancels WaitForTaskNotification and closes the underlying ClientConn.
 func (c *Client) Close() error {
-	// Lock so nothing can use the client while we are closing.
+	// Lock so nothing can use the client while we are closing, tasks still
+	// queued see it is closed once they get the lock.
 	c.mx.Lock()
+	defer c.mx.Unlock()
 	if c.cancel != nil {
 		c.cancel()
 	}
@@ -105,7 +112,7 @@ func (c *Client) RegisterAgent(ctx context.Context) error {
 
 	oi := &osinfo.OSInfo{}
 	if agentconfig.OSInventoryEnabled() {
-		oi, err = osinfo.Get()
+		oi, err = osinfo.Get(ctx)
 		if err != nil {
 			// Log the error but still call RegisterAgent (fields will be empty).
 			clog.Errorf(ctx, "osinfo.Get() error: %v", err)
@@ -130,8 +137,12 @@ func (c *Client) RegisterAgent(ctx context.Context) error {
 		return err
 	})
 	clog.DebugRPC(ctx, "RegisterAgent", nil, resp)
+	if err != nil {
+		return err
+	}
 
-	return err
+	c.replaySpool(ctx)
+	return nil
 }
 
 // reportInventory calls ReportInventory with the provided inventory.
@@ -215,13 +226,22 @@ func (c *Client) reportTaskComplete(ctx context.Context, req *agentendpointpb.Re
 	req.InstanceIdToken = token
 
 	var res *agentendpointpb.ReportTaskCompleteResponse
+	var rpcErr error
 	err = retryutil.RetryAPICall(ctx, apiRetrySec*time.Second, "ReportTaskComplete", func() error {
-		res, err = c.raw.ReportTaskComplete(ctx, req)
-		return err
+		res, rpcErr = c.raw.ReportTaskComplete(ctx, req)
+		return rpcErr
 	})
 	clog.DebugRPC(ctx, "ReportTaskComplete", nil, res)
 
 	if err != nil {
+		// The task is done, report it once the endpoint is reachable again.
+		if unreachable(rpcErr) {
+			serr := spoolTaskComplete(ctx, req)
+			if serr == nil {
+				return nil
+			}
+			clog.Errorf(ctx, "Error spooling task report: %v", serr)
+		}
 		return fmt.Errorf("error calling ReportTaskComplete: %w", err)
 	}
 	return nil
@@ -243,7 +263,7 @@ func (c *Client) runTask(ctx context.Context) {
 		}
 
 		clog.Debugf(ctx, "Received task: %s.", task.GetTaskType())
-		ctx := clog.WithLabels(ctx, map[string]string{"task_type": task.GetTaskType().String()})
+		ctx := clog.WithLabels(clog.WithLabels(ctx, cloudtags.Labels()), map[string]string{"task_type": task.GetTaskType().String()})
 		switch task.GetTaskType() {
 		case agentendpointpb.TaskType_APPLY_PATCHES:
 			if err := c.RunApplyPatches(ctx, task); err != nil {
@@ -280,10 +300,19 @@ func (c *Client) handleStream(ctx context.Context, stream agentendpointpb.AgentE
 			// We have been canceled.
 			return nil
 		case c.noti <- struct{}{}:
-			tasker.Enqueue(ctx, "TaskNotification", func() {
+			// Notified tasks, like patch runs, go ahead of routine work.
+			tasker.EnqueueWithPriority(ctx, "TaskNotification", tasker.PriorityHigh, func(ctx context.Context) {
+				if ctx.Err() != nil {
+					// We have been canceled while queued.
+					return
+				}
 				// We lock so that this task will complete before the client can get canceled.
 				c.mx.Lock()
 				defer c.mx.Unlock()
+				if c.closed {
+					// The client was closed while this task was queued.
+					return
+				}
 				select {
 				case <-ctx.Done():
 					// We have been canceled.
@@ -326,7 +355,7 @@ func (c *Client) loadTaskFromState(ctx context.Context) error {
 	if st != nil && st.PatchTask != nil {
 		st.PatchTask.client = c
 		st.PatchTask.state = st
-		tasker.Enqueue(ctx, "PatchRun", func() {
+		tasker.EnqueueWithPriority(ctx, PatchTaskName, tasker.PriorityHigh, func(ctx context.Context) {
 			st.PatchTask.run(ctx)
 		})
 	}
@@ -362,8 +391,9 @@ func (c *Client) waitForTask(ctx context.Context) error {
 func (c *Client) WaitForTaskNotification(ctx context.Context) {
 	c.mx.Lock()
 	defer c.mx.Unlock()
-	if c.cancel != nil {
-		// WaitForTaskNotification is already running on this client.
+	if c.cancel != nil || c.closed {
+		// WaitForTaskNotification is already running on this client, or
+		// the client is closed.
 		return
 	}
 	clog.Debugf(ctx, "Running WaitForTaskNotification")
@@ -77,7 +77,7 @@ func (c *BetaClient) Closed() bool {
 
 // LookupEffectiveGuestPolicies calls the agentendpoint service LookupEffectiveGuestPolicies.
 func (c *BetaClient) LookupEffectiveGuestPolicies(ctx context.Context) (res *agentendpointpb.EffectiveGuestPolicy, err error) {
-	info, err := osinfo.Get()
+	info, err := osinfo.Get(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +34,9 @@ import (
 
 	agentendpoint "cloud.google.com/go/osconfig/agentendpoint/apiv1"
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/spool"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
 	"golang.org/x/oauth2/jws"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -70,11 +73,22 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
+	// Don't spool reports to the cache directory of the agent.
+	spoolDir, err := os.MkdirTemp("", "osconfig_report_spool")
+	if err != nil {
+		fmt.Printf("Error creating spool directory: %v", err)
+		os.Exit(1)
+	}
+	reportSpool = spool.New(spoolDir, maxSpooledReports)
+	// Nor record the changes of the tests in its state journal.
+	statedb.Default = statedb.New(filepath.Join(spoolDir, "state.jsonl"), 0)
+
 	opts := logger.LogOpts{LoggerName: "OSConfigAgent", Debug: true, Writers: []io.Writer{os.Stdout}}
 	logger.Init(context.Background(), opts)
 
 	out := m.Run()
 	ts.Close()
+	os.RemoveAll(spoolDir)
 	os.Exit(out)
 }
 
@@ -278,6 +292,53 @@ func TestWaitForTaskErrors(t *testing.T) {
 	}
 }
 
+// notificationStream delivers n task notifications and then io.EOF.
+type notificationStream struct {
+	agentendpointpb.AgentEndpointService_ReceiveTaskNotificationClient
+	n int
+}
+
+func (s *notificationStream) Recv() (*agentendpointpb.ReceiveTaskNotificationResponse, error) {
+	if s.n == 0 {
+		return nil, io.EOF
+	}
+	s.n--
+	return &agentendpointpb.ReceiveTaskNotificationResponse{}, nil
+}
+
+func TestTaskNotificationAfterClose(t *testing.T) {
+	ctx := context.Background()
+	srv := newAgentEndpointServiceTestServer()
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.s.Stop()
+
+	// Hold the task queue so the notification only starts after Close.
+	release := make(chan struct{})
+	tasker.Enqueue(ctx, "Block", func(context.Context) { <-release })
+
+	if err := tc.client.handleStream(ctx, &notificationStream{n: 1}); err != io.EOF {
+		t.Fatalf("handleStream: got %v, want io.EOF", err)
+	}
+	if err := tc.client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	ran := make(chan struct{})
+	tasker.Enqueue(ctx, "AfterClose", func(context.Context) { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(10 * time.Second):
+		t.Fatal("task queue is stuck on a notification queued before Close")
+	}
+	if srv.taskStart {
+		t.Error("expected StartNextTask to not have been called after Close")
+	}
+}
+
 func TestLoadPatchTaskFromState(t *testing.T) {
 	ctx := context.Background()
 	srv := newAgentEndpointServiceTestServer()
@@ -317,20 +378,21 @@ func TestLoadPatchTaskFromState(t *testing.T) {
 	if err := ioutil.WriteFile(taskStateFile, []byte(fmt.Sprintf(`{"PatchTask":{"TaskID":"%s", "PatchStep": "%s"}}`, taskID, patching)), 0600); err != nil {
 		t.Fatal(err)
 	}
+	srv.execTaskComplete = true
+	srv.applyConfigTaskComplete = true
 	if err := tc.client.loadTaskFromState(ctx); err != nil {
 		t.Fatal(err)
 	}
 
-	srv.execTaskComplete = true
-	srv.applyConfigTaskComplete = true
 	// Launch another patch task, this should run AFTER the task loaded from state file
 	if err := tc.client.waitForTask(ctx); err != nil {
 		t.Errorf("did not expect error from a closed stream: %v", err)
 	}
+	// The notification is still queued, wait for it to find no more tasks.
+	done := make(chan struct{})
+	tasker.EnqueueWithPriority(ctx, "Done", tasker.PriorityLow, func(context.Context) { close(done) })
+	<-done
 
-	if srv.taskStart {
-		t.Error("did not expect ReportTaskStart to have been called")
-	}
 	if !srv.patchTaskProgress {
 		t.Error("expected ReportTaskProgress for TaskType_APPLY_PATCHES to have been called")
 	}
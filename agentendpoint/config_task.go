@@ -25,6 +25,7 @@ import (
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/config"
 	"github.com/GoogleCloudPlatform/osconfig/pretty"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
 )
@@ -236,6 +237,41 @@ func enforceConfigResourceState(ctx context.Context, res *resource, rCompliance
 	return true, hasError
 }
 
+// stateChange returns the change recorded in the state journal once
+// configResource was enforced.
+func stateChange(configResource *agentendpointpb.OSPolicy_Resource, origin string) *statedb.Change {
+	c := &statedb.Change{Name: configResource.GetId(), Action: "enforced", Origin: origin}
+	switch {
+	case configResource.GetPkg() != nil:
+		pkg := configResource.GetPkg()
+		c.Kind = statedb.KindPackage
+		for _, name := range []string{pkg.GetApt().GetName(), pkg.GetYum().GetName(), pkg.GetZypper().GetName(), pkg.GetGooget().GetName()} {
+			if name != "" {
+				c.Name = name
+			}
+		}
+		switch pkg.GetDesiredState() {
+		case agentendpointpb.OSPolicy_Resource_PackageResource_INSTALLED:
+			c.Action = "installed"
+		case agentendpointpb.OSPolicy_Resource_PackageResource_REMOVED:
+			c.Action = "removed"
+		}
+	case configResource.GetFile() != nil:
+		c.Kind = statedb.KindFile
+		c.Name = configResource.GetFile().GetPath()
+		if configResource.GetFile().GetState() == agentendpointpb.OSPolicy_Resource_FileResource_ABSENT {
+			c.Action = "removed"
+		} else {
+			c.Action = "written"
+		}
+	case configResource.GetRepository() != nil:
+		c.Kind = statedb.KindRepository
+	case configResource.GetExec() != nil:
+		c.Kind = statedb.KindExec
+	}
+	return c
+}
+
 func postCheckConfigResourceState(ctx context.Context, res *resource, rCompliance *agentendpointpb.OSPolicyResourceCompliance, configResource *agentendpointpb.OSPolicy_Resource) {
 	ctx = clog.WithLabels(ctx, map[string]string{"resource_id": configResource.GetId()})
 	clog.Debugf(ctx, "Running step 'check state post enforcement' on resource %q.", configResource.GetId())
@@ -375,6 +411,12 @@ func (c *configTask) run(ctx context.Context) error {
 		return c.handleErrorState(ctx, rcsErrMsg, err)
 	}
 
+	if agentconfig.Paused(agentconfig.SubsystemPolicy) {
+		msg := fmt.Sprintf("Not applying OSPolicies: %s", agentconfig.PauseMessage(agentconfig.SubsystemPolicy))
+		clog.Infof(ctx, msg)
+		return c.reportCompletedState(ctx, msg, agentendpointpb.ApplyConfigTaskOutput_FAILED)
+	}
+
 	if len(c.Task.GetOsPolicies()) == 0 {
 		clog.Infof(ctx, "No OSPolicies to apply.")
 		return c.reportCompletedState(ctx, "", agentendpointpb.ApplyConfigTaskOutput_SUCCEEDED)
@@ -428,6 +470,9 @@ func (c *configTask) run(ctx context.Context) error {
 			// We do however stop further execution of this polcy on enforce error.
 			enforcementActionTaken, hasError := enforceConfigResourceState(ctx, res, rCompliance, configResource)
 			if enforcementActionTaken {
+				if !hasError {
+					statedb.Record(ctx, stateChange(configResource, osPolicy.GetOsPolicyAssignment()+"/"+osPolicy.GetId()))
+				}
 				// On any change we trigger post check for all previous resouces,
 				// even if there was an error.
 				c.markPostCheckRequired()
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/GoogleCloudPlatform/osconfig/config"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -473,3 +474,40 @@ func TestTruncateMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestStateChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource *agentendpointpb.OSPolicy_Resource
+		want     *statedb.Change
+	}{
+		{
+			"apt package",
+			&agentendpointpb.OSPolicy_Resource{Id: "r", ResourceType: &agentendpointpb.OSPolicy_Resource_Pkg{Pkg: &agentendpointpb.OSPolicy_Resource_PackageResource{
+				DesiredState:  agentendpointpb.OSPolicy_Resource_PackageResource_REMOVED,
+				SystemPackage: &agentendpointpb.OSPolicy_Resource_PackageResource_Apt{Apt: &agentendpointpb.OSPolicy_Resource_PackageResource_APT{Name: "vim"}},
+			}}},
+			&statedb.Change{Kind: statedb.KindPackage, Name: "vim", Action: "removed", Origin: "a/p"},
+		},
+		{
+			"file",
+			&agentendpointpb.OSPolicy_Resource{Id: "r", ResourceType: &agentendpointpb.OSPolicy_Resource_File_{File: &agentendpointpb.OSPolicy_Resource_FileResource{
+				Path:  "/etc/motd",
+				State: agentendpointpb.OSPolicy_Resource_FileResource_CONTENTS_MATCH,
+			}}},
+			&statedb.Change{Kind: statedb.KindFile, Name: "/etc/motd", Action: "written", Origin: "a/p"},
+		},
+		{
+			"exec",
+			&agentendpointpb.OSPolicy_Resource{Id: "r", ResourceType: &agentendpointpb.OSPolicy_Resource_Exec{Exec: &agentendpointpb.OSPolicy_Resource_ExecResource{}}},
+			&statedb.Change{Kind: statedb.KindExec, Name: "r", Action: "enforced", Origin: "a/p"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stateChange(tt.resource, "a/p"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stateChange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
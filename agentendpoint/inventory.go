@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/attributes"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/heartbeat"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
 	"github.com/GoogleCloudPlatform/osconfig/inventory"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
 	"github.com/GoogleCloudPlatform/osconfig/retryutil"
@@ -25,14 +28,85 @@ const (
 
 // ReportInventory writes inventory to guest attributes and reports it to agent endpoint.
 func (c *Client) ReportInventory(ctx context.Context) {
+	if agentconfig.Paused(agentconfig.SubsystemInventory) {
+		clog.Infof(ctx, "Skipping inventory report: %s.", agentconfig.PauseMessage(agentconfig.SubsystemInventory))
+		heartbeat.RunFromContext(ctx).Skip(agentconfig.PauseMessage(agentconfig.SubsystemInventory))
+		return
+	}
+	if err := hooks.Run(ctx, hooks.BeforeInventory, nil); err != nil {
+		clog.Errorf(ctx, "Error running %s hooks: %v", hooks.BeforeInventory, err)
+	}
 	state := inventory.Get(ctx)
 
+	if cfg, err := inventory.ParseAnomalyConfig(agentconfig.InventoryAnomalies()); err != nil {
+		clog.Errorf(ctx, "Invalid inventory anomaly setting: %v", err)
+	} else if cfg.Enabled() {
+		detectAnomalies(ctx, state, cfg)
+	}
+
+	anon, err := inventory.ParseAnonymizeConfig(agentconfig.InventoryAnonymize(), strconv.FormatInt(agentconfig.NumericProjectID(), 10))
+	if err != nil {
+		// Don't risk sending data that was supposed to be anonymized.
+		clog.Errorf(ctx, "Not reporting inventory, invalid inventory anonymization setting: %v", err)
+		heartbeat.RunFromContext(ctx).Fail(err)
+		return
+	}
+	inventory.Anonymize(state, anon)
+	inventory.LimitHistoryDepth(state, agentconfig.InventoryHistoryDays(), time.Now())
+	inventory.SetLatest(state)
+	publishChanges(ctx, state)
+
 	if agentconfig.GuestAttributesEnabled() && !agentconfig.DisableInventoryWrite() {
 		clog.Infof(ctx, "Writing inventory to guest attributes")
 		write(ctx, state, inventoryURL)
 	}
 
 	c.report(ctx, state)
+
+	if err := hooks.Run(ctx, hooks.AfterInventory, state); err != nil {
+		clog.Errorf(ctx, "Error running %s hooks: %v", hooks.AfterInventory, err)
+	}
+}
+
+// detectAnomalies compares the installed packages to the ones of the last
+// inventory and runs the InventoryAnomaly hooks for unusual changes.
+func detectAnomalies(ctx context.Context, state *inventory.InstanceInventory, cfg inventory.AnomalyConfig) {
+	if state.InstalledPackages == nil {
+		return
+	}
+	prev, err := inventory.LoadLastPackages()
+	if err != nil {
+		clog.Errorf(ctx, "Error loading last inventory packages: %v", err)
+	}
+	if anomalies := inventory.DetectAnomalies(prev, state.InstalledPackages, cfg); len(anomalies) > 0 {
+		for _, a := range anomalies {
+			clog.Warningf(ctx, "Inventory anomaly %s: %s.", a.Type, a.Message)
+		}
+		if err := hooks.Run(ctx, hooks.InventoryAnomaly, anomalies); err != nil {
+			clog.Errorf(ctx, "Error running %s hooks: %v", hooks.InventoryAnomaly, err)
+		}
+	}
+	if err := inventory.SaveLastPackages(state.InstalledPackages); err != nil {
+		clog.Errorf(ctx, "Error saving inventory packages: %v", err)
+	}
+}
+
+// publishChanges compares state to the last inventory and runs the
+// InventoryChange hooks with the changes.
+func publishChanges(ctx context.Context, state *inventory.InstanceInventory) {
+	prev, err := inventory.LoadLastInventory()
+	if err != nil {
+		clog.Errorf(ctx, "Error loading last inventory: %v", err)
+	}
+	if changes := inventory.Changes(prev, state); len(changes) > 0 {
+		clog.Infof(ctx, "%d package changes since the last inventory.", len(changes))
+		if err := hooks.Run(ctx, hooks.InventoryChange, changes); err != nil {
+			clog.Errorf(ctx, "Error running %s hooks: %v", hooks.InventoryChange, err)
+		}
+	}
+	if err := inventory.SaveLastInventory(state); err != nil {
+		clog.Errorf(ctx, "Error saving last inventory: %v", err)
+	}
 }
 
 func write(ctx context.Context, state *inventory.InstanceInventory, url string) {
@@ -49,6 +123,14 @@ func write(ctx context.Context, state *inventory.InstanceInventory, url string)
 			if err := attributes.PostAttribute(u, strings.NewReader(f.String())); err != nil {
 				clog.Errorf(ctx, "postAttribute error: %v", err)
 			}
+		case reflect.Map:
+			if f.Len() == 0 {
+				continue
+			}
+			clog.Debugf(ctx, "postAttributeCompressed %s", u)
+			if err := attributes.PostAttributeCompressed(u, f.Interface()); err != nil {
+				clog.Errorf(ctx, "postAttributeCompressed error: %v", err)
+			}
 		case reflect.Ptr:
 			switch reflect.Indirect(f).Kind() {
 			case reflect.Struct:
@@ -63,31 +145,58 @@ func write(ctx context.Context, state *inventory.InstanceInventory, url string)
 
 func (c *Client) report(ctx context.Context, state *inventory.InstanceInventory) {
 	clog.Debugf(ctx, "Reporting instance inventory to agent endpoint.")
-	inventory := formatInventory(ctx, state)
+	reported := state
+	if agentconfig.InventoryHistoryDelta() {
+		// Only send the Windows update and application history not yet
+		// acknowledged, large histories are otherwise resent on every run.
+		if ack, err := inventory.LoadHistoryAck(); err != nil {
+			clog.Errorf(ctx, "Error loading inventory history acknowledgement, reporting full history: %v", err)
+		} else {
+			reported = inventory.HistoryDelta(state, ack)
+		}
+	}
+	formatted := formatInventory(ctx, reported)
+	heartbeat.RunFromContext(ctx).AddItems(len(formatted.GetInstalledPackages()))
+
+	c.replaySpool(ctx)
 
 	reportFull := false
 	var res *agentendpointpb.ReportInventoryResponse
-	var err error
+	// rpcErr is the error of the last call, RetryAPICall doesn't keep its
+	// status.
+	var rpcErr error
 	f := func() error {
-		res, err = c.reportInventory(ctx, inventory, reportFull)
-		if err != nil {
-			return err
+		res, rpcErr = c.reportInventory(ctx, formatted, reportFull)
+		return rpcErr
+	}
+	fail := func(msg string, err error) {
+		if unreachable(rpcErr) {
+			if serr := spoolInventory(ctx, formatted); serr != nil {
+				clog.Errorf(ctx, "Error spooling inventory report: %v", serr)
+			}
 		}
-		return nil
+		clog.Errorf(ctx, "%s: %v", msg, err)
+		heartbeat.RunFromContext(ctx).Fail(err)
 	}
 
-	if err = retryutil.RetryAPICall(ctx, apiRetrySec*time.Second, "ReportInventory", f); err != nil {
-		clog.Errorf(ctx, "Error reporting inventory checksum: %v", err)
+	if err := retryutil.RetryAPICall(ctx, apiRetrySec*time.Second, "ReportInventory", f); err != nil {
+		fail("Error reporting inventory checksum", err)
 		return
 	}
 
 	if res.GetReportFullInventory() {
 		reportFull = true
-		if err = retryutil.RetryAPICall(ctx, apiRetrySec*time.Second, "ReportInventory", f); err != nil {
-			clog.Errorf(ctx, "Error reporting full inventory: %v", err)
+		if err := retryutil.RetryAPICall(ctx, apiRetrySec*time.Second, "ReportInventory", f); err != nil {
+			fail("Error reporting full inventory", err)
 			return
 		}
 	}
+
+	if agentconfig.InventoryHistoryDelta() {
+		if err := inventory.SaveHistoryAck(inventory.NewHistoryAck(state)); err != nil {
+			clog.Errorf(ctx, "Error saving inventory history acknowledgement: %v", err)
+		}
+	}
 }
 
 func formatInventory(ctx context.Context, state *inventory.InstanceInventory) *agentendpointpb.Inventory {
@@ -219,7 +328,7 @@ func formatPackages(ctx context.Context, pkgs *packages.Packages, shortName stri
 		}
 		softwarePackages = append(softwarePackages, temp...)
 	}
-	// Ignore Pip and Gem packages.
+	// Ignore Pip, Gem and Brew packages.
 
 	return softwarePackages
 }
@@ -17,10 +17,10 @@ package agentendpoint
 import (
 	"context"
 	"errors"
-	"regexp"
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/ospatch"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -42,15 +42,24 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 			ospatch.AptGetDryRun(r.Task.GetDryRun()),
 			ospatch.AptGetExcludes(excludes),
 			ospatch.AptGetExclusivePackages(r.Task.GetPatchConfig().GetApt().GetExclusivePackages()),
+			ospatch.AptGetCheckpoint(r.checkpoint("apt")),
+			ospatch.AptGetProgress(r.progress),
+			ospatch.AptGetEnv(agentconfig.PatchEnv()),
 		}
 		switch r.Task.GetPatchConfig().GetApt().GetType() {
 		case agentendpointpb.AptSettings_DIST:
 			opts = append(opts, ospatch.AptGetUpgradeType(packages.AptGetDistUpgrade))
 		}
 		clog.Debugf(ctx, "Installing APT package updates.")
-		if err := retryutil.RetryFunc(ctx, retryPeriod, "installing APT package updates", func() error { return ospatch.RunAptGetUpgrade(ctx, opts...) }); err != nil {
+		var res *ospatch.PatchResult
+		if err := retryutil.RetryFunc(ctx, retryPeriod, "installing APT package updates", func() error {
+			var err error
+			res, err = ospatch.RunAptGetUpgrade(ctx, opts...)
+			return err
+		}); err != nil {
 			errs = append(errs, err.Error())
 		}
+		r.addResult(res)
 	}
 	if packages.YumExists && packages.RPMQueryExists {
 		excludes, err := convertInputToExcludes(r.Task.GetPatchConfig().GetYum().GetExcludes())
@@ -63,11 +72,20 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 			ospatch.YumUpdateExcludes(excludes),
 			ospatch.YumExclusivePackages(r.Task.GetPatchConfig().GetYum().GetExclusivePackages()),
 			ospatch.YumDryRun(r.Task.GetDryRun()),
+			ospatch.YumCheckpoint(r.checkpoint("yum")),
+			ospatch.YumProgress(r.progress),
+			ospatch.YumEnv(agentconfig.PatchEnv()),
 		}
 		clog.Debugf(ctx, "Installing YUM package updates.")
-		if err := retryutil.RetryFunc(ctx, retryPeriod, "installing YUM package updates", func() error { return ospatch.RunYumUpdate(ctx, opts...) }); err != nil {
+		var res *ospatch.PatchResult
+		if err := retryutil.RetryFunc(ctx, retryPeriod, "installing YUM package updates", func() error {
+			var err error
+			res, err = ospatch.RunYumUpdate(ctx, opts...)
+			return err
+		}); err != nil {
 			errs = append(errs, err.Error())
 		}
+		r.addResult(res)
 	}
 	if packages.ZypperExists && packages.RPMQueryExists {
 		excludes, err := convertInputToExcludes(r.Task.GetPatchConfig().GetZypper().GetExcludes())
@@ -82,11 +100,20 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 			ospatch.ZypperUpdateWithExcludes(excludes),
 			ospatch.ZypperUpdateWithExclusivePatches(r.Task.GetPatchConfig().GetZypper().GetExclusivePatches()),
 			ospatch.ZypperUpdateDryrun(r.Task.GetDryRun()),
+			ospatch.ZypperUpdateCheckpoint(r.checkpoint("zypper")),
+			ospatch.ZypperUpdateProgress(r.progress),
+			ospatch.ZypperPatchEnv(agentconfig.PatchEnv()),
 		}
 		clog.Debugf(ctx, "Installing Zypper updates.")
-		if err := retryutil.RetryFunc(ctx, retryPeriod, "installing Zypper updates", func() error { return ospatch.RunZypperPatch(ctx, opts...) }); err != nil {
+		var res *ospatch.PatchResult
+		if err := retryutil.RetryFunc(ctx, retryPeriod, "installing Zypper updates", func() error {
+			var err error
+			res, err = ospatch.RunZypperPatch(ctx, opts...)
+			return err
+		}); err != nil {
 			errs = append(errs, err.Error())
 		}
+		r.addResult(res)
 	}
 	if errs == nil {
 		return nil
@@ -94,26 +121,16 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 	return errors.New(strings.Join(errs, ",\n"))
 }
 
+// convertInputToExcludes parses the excludes of the patch config, see
+// ospatch.ParseExclude for the format.
 func convertInputToExcludes(input []string) ([]*ospatch.Exclude, error) {
 	var output []*ospatch.Exclude
 	for _, s := range input {
-		if len(s) >= 2 && (s)[0] == '/' && s[len(s)-1] == '/' {
-			exclude, err := regexExcludeFromString(s[1 : len(s)-1])
-			if err != nil {
-				return nil, err
-			}
-			output = append(output, exclude)
-		} else {
-			output = append(output, ospatch.CreateStringExclude(&s))
+		exclude, err := ospatch.ParseExclude(s)
+		if err != nil {
+			return nil, err
 		}
+		output = append(output, exclude)
 	}
 	return output, nil
 }
-
-func regexExcludeFromString(s string) (*ospatch.Exclude, error) {
-	compile, err := regexp.Compile(s)
-	if err != nil {
-		return nil, err
-	}
-	return ospatch.CreateRegexExclude(compile), nil
-}
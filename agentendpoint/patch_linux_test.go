@@ -15,17 +15,24 @@
 package agentendpoint
 
 import (
+	"context"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
 )
 
 func TestExcludeConversion(t *testing.T) {
 	regex, _ := regexp.Compile("PackageName")
 	emptyRegex, _ := regexp.Compile("")
+	glob, _ := ospatch.CreateGlobExclude("kernel*")
+	version, _ := ospatch.CreateVersionExclude("openssl", "<", "3.0.14")
 
 	tests := []struct {
 		name  string
@@ -38,6 +45,8 @@ func TestExcludeConversion(t *testing.T) {
 		{name: "CornerCaseRegex", input: []string{"//"}, want: []*ospatch.Exclude{ospatch.CreateRegexExclude(emptyRegex)}},
 		{name: "CornerCaseStrictString", input: []string{"/"}, want: CreateStringExcludes("/")},
 		{name: "CornerCaseEmptyString", input: []string{""}, want: CreateStringExcludes("")},
+		{name: "GlobConversion", input: []string{"kernel*"}, want: []*ospatch.Exclude{glob}},
+		{name: "VersionConversion", input: []string{"openssl<3.0.14"}, want: []*ospatch.Exclude{version}},
 	}
 
 	for _, tt := range tests {
@@ -71,3 +80,79 @@ func CreateStringExcludes(pkgs ...string) []*ospatch.Exclude {
 
 	return excludes
 }
+
+func TestRestartServices(t *testing.T) {
+	defer func(old func(context.Context, []string) (*ospatch.ServiceRestarts, error)) {
+		restartOutdatedServices = old
+	}(restartOutdatedServices)
+	calls := 0
+	want := &ospatch.ServiceRestarts{Restarted: []string{"nginx.service"}, Manual: []string{"sshd.service"}}
+	restartOutdatedServices = func(context.Context, []string) (*ospatch.ServiceRestarts, error) {
+		calls++
+		return want, nil
+	}
+
+	r := &patchTask{Task: &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{DryRun: true}}}
+	r.restartServices(context.Background())
+	if calls != 0 || r.ServiceRestarts != nil {
+		t.Errorf("restartServices() in a dry run checked services")
+	}
+
+	r.Task.DryRun = false
+	r.restartServices(context.Background())
+	if !reflect.DeepEqual(r.ServiceRestarts, want) {
+		t.Errorf("ServiceRestarts = %+v, want %+v", r.ServiceRestarts, want)
+	}
+}
+
+func TestRunLocalPatch(t *testing.T) {
+	taskStateFile = filepath.Join(t.TempDir(), "testState")
+	defer func(apt, dpkg, yum, zypper bool) {
+		packages.AptExists, packages.DpkgQueryExists, packages.YumExists, packages.ZypperExists = apt, dpkg, yum, zypper
+	}(packages.AptExists, packages.DpkgQueryExists, packages.YumExists, packages.ZypperExists)
+	packages.AptExists, packages.DpkgQueryExists, packages.YumExists, packages.ZypperExists = false, false, false, false
+	defer func(old func(context.Context) (bool, error)) { systemRebootRequired = old }(systemRebootRequired)
+	rebootChecks := 0
+	systemRebootRequired = func(context.Context) (bool, error) {
+		rebootChecks++
+		return true, nil
+	}
+	ctx := context.Background()
+
+	// The patch task has no client, reporting to the service would panic.
+	task := &agentendpointpb.ApplyPatchesTask{DryRun: true}
+	if _, err := RunLocalPatch(ctx, "local-1", task, nil); err != nil {
+		t.Fatalf("RunLocalPatch: %v", err)
+	}
+	if rebootChecks == 0 {
+		t.Error("RunLocalPatch did not check whether a reboot is required")
+	}
+	st, err := loadState(taskStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != nil && st.PatchTask != nil {
+		t.Errorf("task state after RunLocalPatch = %+v, want no patch task", st.PatchTask)
+	}
+
+	packages.AptExists, packages.DpkgQueryExists = true, true
+	task.PatchConfig = &agentendpointpb.PatchConfig{Apt: &agentendpointpb.AptSettings{Excludes: []string{"/["}}}
+	if _, err := RunLocalPatch(ctx, "local-2", task, nil); err == nil || !strings.Contains(err.Error(), "Failed to apply patches") {
+		t.Errorf("RunLocalPatch with an invalid exclude = %v, want the patch failure", err)
+	}
+}
+
+func TestLocalPatchTaskState(t *testing.T) {
+	taskStateFile = filepath.Join(t.TempDir(), "testState")
+	r := &patchTask{state: &taskState{}, TaskID: "local-1", Local: true, Task: &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{}}}
+	if err := r.setStep(patching); err != nil {
+		t.Fatal(err)
+	}
+	st, err := loadState(taskStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.PatchTask == nil || !st.PatchTask.Local {
+		t.Errorf("saved patch task = %+v, want a local one so a resumed patch is not reported", st.PatchTask)
+	}
+}
@@ -16,20 +16,28 @@ package agentendpoint
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"github.com/GoogleCloudPlatform/osconfig/metrics"
 	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+	"github.com/GoogleCloudPlatform/osconfig/sdnotify"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
 )
 
-func systemRebootRequired(ctx context.Context) (bool, error) {
-	return ospatch.SystemRebootRequired(ctx)
-}
+var (
+	systemRebootRequired    = ospatch.SystemRebootRequired
+	restartOutdatedServices = ospatch.RestartServices
+)
 
 type patchStep string
 
@@ -37,6 +45,10 @@ const (
 	prePatch  = "PrePatch"
 	patching  = "Patching"
 	postPatch = "PostPatch"
+
+	// patchKeepAlive is how long systemd timeouts and the watchdog are held
+	// off while patches are being applied.
+	patchKeepAlive = time.Hour
 )
 
 type patchTask struct {
@@ -50,10 +62,35 @@ type patchTask struct {
 	StartedAt   time.Time `json:",omitempty"`
 	PatchStep   patchStep `json:",omitempty"`
 	RebootCount int
+	// RebootMarker is set while the system reboots, see verifyReboot.
+	RebootMarker *rebootMarker `json:",omitempty"`
+	// ServiceRestarts are the services restarted after patching and those
+	// still needing a restart, see restartServices.
+	ServiceRestarts *ospatch.ServiceRestarts `json:",omitempty"`
+	// Local is set for patches started on the agent itself, see
+	// RunLocalPatch, their progress and outcome are not reported to the
+	// service.
+	Local bool `json:",omitempty"`
+
+	// progress, results and failure are only kept by the agent process
+	// running a local patch, they are not saved.
+	progress ospatch.ProgressFunc
+	results  []*ospatch.PatchResult
+	// failure is the error message the patch completed with.
+	failure string
 
 	// TODO: add Attempts and track number of retries with backoff, jitter, etc.
 }
 
+// checkpoint returns the CheckpointConfig for the runs of manager, so a patch
+// interrupted by the agent stopping resumes once it is restarted.
+func (r *patchTask) checkpoint(manager string) *ospatch.CheckpointConfig {
+	return &ospatch.CheckpointConfig{
+		Path:  filepath.Join(agentconfig.CacheDir(), "osconfig_patch_"+manager+".checkpoint"),
+		RunID: r.TaskID,
+	}
+}
+
 func (r *patchTask) saveState() error {
 	r.state.PatchTask = r
 	return r.state.save(taskStateFile)
@@ -113,18 +150,50 @@ func (r *patchTask) reportCanceled(ctx context.Context) error {
 }
 
 func (r *patchTask) reportCompletedState(ctx context.Context, errMsg string, output *agentendpointpb.ReportTaskCompleteRequest_ApplyPatchesTaskOutput) error {
-	req := &agentendpointpb.ReportTaskCompleteRequest{
-		TaskId:       r.TaskID,
-		TaskType:     agentendpointpb.TaskType_APPLY_PATCHES,
-		ErrorMessage: errMsg,
-		Output:       output,
+	outcome := strings.ToLower(output.ApplyPatchesTaskOutput.GetState().String())
+	if errMsg == errServerCancel.Error() {
+		outcome = "canceled"
 	}
-	if err := r.client.reportTaskComplete(ctx, req); err != nil {
-		return fmt.Errorf("error reporting completed state: %v", err)
+	metrics.PatchRuns.Inc(outcome)
+	r.failure = errMsg
+
+	if !r.Local {
+		req := &agentendpointpb.ReportTaskCompleteRequest{
+			TaskId:       r.TaskID,
+			TaskType:     agentendpointpb.TaskType_APPLY_PATCHES,
+			ErrorMessage: errMsg,
+			Output:       output,
+		}
+		if err := r.client.reportTaskComplete(ctx, req); err != nil {
+			return fmt.Errorf("error reporting completed state: %v", err)
+		}
+	}
+	data := r.hookData()
+	data.State = output.ApplyPatchesTaskOutput.GetState().String()
+	data.ErrorMessage = errMsg
+	if sr := r.ServiceRestarts; sr != nil {
+		data.RestartedServices, data.ServicesNeedingRestart = sr.Restarted, sr.Manual
+	}
+	if err := hooks.Run(ctx, hooks.AfterPatch, data); err != nil {
+		clog.Errorf(ctx, "Error running %s hooks: %v", hooks.AfterPatch, err)
 	}
 	return nil
 }
 
+func (r *patchTask) hookData() *hooks.PatchData {
+	data := &hooks.PatchData{TaskID: r.TaskID}
+	if r.Task == nil {
+		return data
+	}
+	data.DryRun = r.Task.GetDryRun()
+	if cfg := r.Task.GetPatchConfig(); cfg != nil {
+		if b, err := protojson.Marshal(cfg); err == nil {
+			data.PatchConfig = b
+		}
+	}
+	return data
+}
+
 func (r *patchTask) reportContinuingState(ctx context.Context, patchState agentendpointpb.ApplyPatchesTaskProgress_State) error {
 	st, ok := r.lastProgressState[patchState]
 	if ok && st.After(time.Now().Add(sameStateTimeWindow)) {
@@ -132,19 +201,21 @@ func (r *patchTask) reportContinuingState(ctx context.Context, patchState agente
 		return nil
 	}
 
-	req := &agentendpointpb.ReportTaskProgressRequest{
-		TaskId:   r.TaskID,
-		TaskType: agentendpointpb.TaskType_APPLY_PATCHES,
-		Progress: &agentendpointpb.ReportTaskProgressRequest_ApplyPatchesTaskProgress{
-			ApplyPatchesTaskProgress: &agentendpointpb.ApplyPatchesTaskProgress{State: patchState},
-		},
-	}
-	res, err := r.client.reportTaskProgress(ctx, req)
-	if err != nil {
-		return fmt.Errorf("error reporting state %s: %v", patchState, err)
-	}
-	if res.GetTaskDirective() == agentendpointpb.TaskDirective_STOP {
-		return errServerCancel
+	if !r.Local {
+		req := &agentendpointpb.ReportTaskProgressRequest{
+			TaskId:   r.TaskID,
+			TaskType: agentendpointpb.TaskType_APPLY_PATCHES,
+			Progress: &agentendpointpb.ReportTaskProgressRequest_ApplyPatchesTaskProgress{
+				ApplyPatchesTaskProgress: &agentendpointpb.ApplyPatchesTaskProgress{State: patchState},
+			},
+		}
+		res, err := r.client.reportTaskProgress(ctx, req)
+		if err != nil {
+			return fmt.Errorf("error reporting state %s: %v", patchState, err)
+		}
+		if res.GetTaskDirective() == agentendpointpb.TaskDirective_STOP {
+			return errServerCancel
+		}
 	}
 
 	if r.lastProgressState == nil {
@@ -154,6 +225,13 @@ func (r *patchTask) reportContinuingState(ctx context.Context, patchState agente
 	return r.saveState()
 }
 
+// addResult records the result of a package manager run, see RunLocalPatch.
+func (r *patchTask) addResult(res *ospatch.PatchResult) {
+	if res != nil {
+		r.results = append(r.results, res)
+	}
+}
+
 // TODO: Add MaxRebootCount so we don't loop endlessly.
 
 func (r *patchTask) prePatchReboot(ctx context.Context) error {
@@ -201,6 +279,7 @@ func (r *patchTask) rebootIfNeeded(ctx context.Context, prePatch bool) error {
 	}
 
 	r.RebootCount++
+	r.RebootMarker = newRebootMarker(ctx)
 	if err := r.saveState(); err != nil {
 		return fmt.Errorf("error saving state: %v", err)
 	}
@@ -215,6 +294,24 @@ func (r *patchTask) rebootIfNeeded(ctx context.Context, prePatch bool) error {
 	}
 }
 
+// restartServices restarts the allowlisted services still using files the
+// update replaced, see agentconfig.RestartServices, and logs the ones that
+// need a manual restart.
+func (r *patchTask) restartServices(ctx context.Context) {
+	if runtime.GOOS != "linux" || r.Task.GetDryRun() {
+		return
+	}
+	res, err := restartOutdatedServices(ctx, agentconfig.RestartServices())
+	if err != nil {
+		clog.Warningf(ctx, "Error checking for services needing a restart: %v", err)
+		return
+	}
+	r.ServiceRestarts = res
+	if len(res.Manual) > 0 {
+		clog.Warningf(ctx, "Services using files replaced by the update need a manual restart: %q", res.Manual)
+	}
+}
+
 func (r *patchTask) run(ctx context.Context) (err error) {
 	ctx = clog.WithLabels(ctx, r.state.Labels)
 	clog.Infof(ctx, "Beginning ApplyPatchesTask")
@@ -227,17 +324,37 @@ func (r *patchTask) run(ctx context.Context) (err error) {
 			return
 		}
 		r.complete(ctx)
-		if agentconfig.OSInventoryEnabled() {
-			go r.client.ReportInventory(ctx)
+		// A local patch has no client, unless it was resumed after a reboot.
+		if agentconfig.OSInventoryEnabled() && r.client != nil {
+			// The task context is canceled once the task returns.
+			go r.client.ReportInventory(context.WithoutCancel(ctx))
 		}
 	}()
 
+	if m := r.RebootMarker; m != nil {
+		problems := r.verifyReboot(ctx, m)
+		r.RebootMarker = nil
+		if err := r.saveState(); err != nil {
+			return r.reportFailed(ctx, fmt.Sprintf("Error saving agent step: %v", err))
+		}
+		if len(problems) != 0 {
+			return r.reportFailed(ctx, fmt.Sprintf("Post-reboot verification failed: %s", strings.Join(problems, "; ")))
+		}
+		clog.Infof(ctx, "Post-reboot verification succeeded.")
+	}
+
 	for {
 		clog.Debugf(ctx, "Running PatchStep %q.", r.PatchStep)
 		switch r.PatchStep {
 		default:
 			return r.reportFailed(ctx, fmt.Sprintf("unknown step: %q", r.PatchStep))
 		case prePatch:
+			if agentconfig.Paused(agentconfig.SubsystemPatching) {
+				return r.reportFailed(ctx, fmt.Sprintf("Not applying patches: %s", agentconfig.PauseMessage(agentconfig.SubsystemPatching)))
+			}
+			if err := hooks.Run(ctx, hooks.BeforePatch, r.hookData()); err != nil {
+				clog.Errorf(ctx, "Error running %s hooks: %v", hooks.BeforePatch, err)
+			}
 			r.StartedAt = time.Now()
 			if err := r.setStep(patching); err != nil {
 				return r.reportFailed(ctx, fmt.Sprintf("Error saving agent step: %v", err))
@@ -253,7 +370,13 @@ func (r *patchTask) run(ctx context.Context) (err error) {
 			if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_APPLYING_PATCHES); err != nil {
 				return r.handleErrorState(ctx, err.Error(), err)
 			}
-			if err := r.runUpdates(ctx); err != nil {
+			// Package transactions can run for a long time, make sure systemd
+			// does not kill the agent in the middle of one.
+			sdnotify.Status("Applying patches for task %q.", r.TaskID)
+			stop := sdnotify.KeepAlive(ctx, patchKeepAlive)
+			err := r.runUpdates(ctx)
+			stop()
+			if err != nil {
 				return r.handleErrorState(ctx, fmt.Sprintf("Failed to apply patches: %v", err), err)
 			}
 			if err := r.postPatchReboot(ctx); err != nil {
@@ -264,6 +387,7 @@ func (r *patchTask) run(ctx context.Context) (err error) {
 				return r.reportFailed(ctx, fmt.Sprintf("Error saving agent step: %v", err))
 			}
 		case postPatch:
+			r.restartServices(ctx)
 			isRebootRequired, err := systemRebootRequired(ctx)
 			if err != nil {
 				return r.reportFailed(ctx, fmt.Sprintf("Error checking if system reboot is required: %v", err))
@@ -297,3 +421,30 @@ func (c *Client) RunApplyPatches(ctx context.Context, task *agentendpointpb.Task
 
 	return r.run(ctx)
 }
+
+// RunLocalPatch runs task like RunApplyPatches runs an ApplyPatchesTask of
+// the service, for patches started on the agent itself, e.g. on the control
+// API. It gets the same checkpoints, retries, reboots, service restarts and
+// hooks, only its progress and outcome are not reported to the service. id
+// identifies the patch in the logs, hooks and checkpoints and must not be
+// reused across agent restarts, progress is called with the progress of the
+// package managers. It returns the results of the package manager runs and
+// the error the patch failed with.
+func RunLocalPatch(ctx context.Context, id string, task *agentendpointpb.ApplyPatchesTask, progress ospatch.ProgressFunc) ([]*ospatch.PatchResult, error) {
+	r := &patchTask{
+		state:    &taskState{},
+		TaskID:   id,
+		Local:    true,
+		Task:     &applyPatchesTask{task},
+		progress: progress,
+	}
+	r.setStep(prePatch)
+
+	if err := r.run(ctx); err != nil {
+		return r.results, err
+	}
+	if r.failure != "" {
+		return r.results, errors.New(r.failure)
+	}
+	return r.results, nil
+}
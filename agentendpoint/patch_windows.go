@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/ospatch"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -55,80 +56,42 @@ func (r *patchTask) classFilter() ([]string, error) {
 	return cf, nil
 }
 
-func (r *patchTask) installWUAUpdates(ctx context.Context, cf []string) (int32, error) {
-	clog.Infof(ctx, "Searching for available Windows updates.")
-	session, err := packages.NewUpdateSession()
-	if err != nil {
-		return 0, err
-	}
-	defer session.Close()
-
-	updts, err := ospatch.GetWUAUpdates(ctx, session, cf, r.Task.GetPatchConfig().GetWindowsUpdate().GetExcludes(), r.Task.GetPatchConfig().GetWindowsUpdate().GetExclusivePatches())
-	if err != nil {
-		return 0, err
-	}
-	defer updts.Release()
-
-	count, err := updts.Count()
-	if err != nil {
-		return 0, err
-	}
-
-	if count == 0 {
-		clog.Infof(ctx, "No Windows updates available to install")
-		return 0, nil
-	}
-
-	clog.Infof(ctx, "%d Windows updates to install", count)
-
-	if r.Task.GetDryRun() {
-		clog.Infof(ctx, "Running in dryrun mode, not updating.")
-		return 0, nil
-	}
-
-	for i := int32(0); i < count; i++ {
-		if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_APPLYING_PATCHES); err != nil {
-			return i, err
-		}
-		updt, err := updts.Item(int(i))
-		if err != nil {
-			return i, err
-		}
-		defer updt.Release()
-
-		if err := session.InstallWUAUpdate(ctx, updt); err != nil {
-			return i, fmt.Errorf(`installUpdate(updt): %v`, err)
-		}
-	}
-
-	return count, nil
-}
-
 func (r *patchTask) wuaUpdates(ctx context.Context) error {
 	cf, err := r.classFilter()
 	if err != nil {
 		return err
 	}
 
-	// We keep searching for and installing updates until the count == 0,
-	// we get a stop signal, or retries exceed 10.
-	retries := 10
-	for i := 1; i <= retries; i++ {
-		if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_APPLYING_PATCHES); err != nil {
-			return err
+	// Keep reporting progress while the updates install, the server can
+	// cancel the task in reply.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var reportErr error
+	progress := func(p ospatch.Progress) {
+		if r.progress != nil {
+			r.progress(p)
 		}
-		count, err := r.installWUAUpdates(ctx, cf)
-		if err != nil {
-			clog.Errorf(ctx, "Error installing Windows updates (attempt %d): %v", i, err)
-			time.Sleep(60 * time.Second)
-			continue
+		if reportErr != nil {
+			return
 		}
-		if count == 0 {
-			return nil
+		if reportErr = r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_APPLYING_PATCHES); reportErr != nil {
+			cancel()
 		}
 	}
 
-	return fmt.Errorf("failed to install all updates after trying %d times", retries)
+	opts := []ospatch.WUAUpdateOption{
+		ospatch.WUAClassifications(cf),
+		ospatch.WUAExcludes(r.Task.GetPatchConfig().GetWindowsUpdate().GetExcludes()),
+		ospatch.WUAExclusivePatches(r.Task.GetPatchConfig().GetWindowsUpdate().GetExclusivePatches()),
+		ospatch.WUADryRun(r.Task.GetDryRun()),
+		ospatch.WUAProgress(progress),
+	}
+	res, err := ospatch.RunWUAUpdate(ctx, opts...)
+	r.addResult(res)
+	if reportErr != nil {
+		return reportErr
+	}
+	return err
 }
 
 func (r *patchTask) runUpdates(ctx context.Context) error {
@@ -141,8 +104,18 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 		clog.Debugf(ctx, "Installing GooGet package updates.")
 		opts := []ospatch.GooGetUpdateOption{
 			ospatch.GooGetDryRun(r.Task.GetDryRun()),
+			ospatch.GooGetCheckpoint(r.checkpoint("googet")),
+			ospatch.GooGetProgress(r.progress),
+			ospatch.GooGetEnv(agentconfig.PatchEnv()),
 		}
-		if err := retryutil.RetryFunc(ctx, 3*time.Minute, "installing GooGet package updates", func() error { return ospatch.RunGooGetUpdate(ctx, opts...) }); err != nil {
+		var res *ospatch.PatchResult
+		err := retryutil.RetryFunc(ctx, 3*time.Minute, "installing GooGet package updates", func() error {
+			var err error
+			res, err = ospatch.RunGooGetUpdate(ctx, opts...)
+			return err
+		})
+		r.addResult(res)
+		if err != nil {
 			return err
 		}
 	}
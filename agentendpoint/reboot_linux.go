@@ -15,8 +15,14 @@
 package agentendpoint
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/util"
 )
@@ -43,3 +49,56 @@ func rebootSystem() error {
 	syscall.Sync()
 	return syscall.Reboot(syscall.LINUX_REBOOT_CMD_RESTART)
 }
+
+var (
+	bootIDFile = "/proc/sys/kernel/random/boot_id"
+	bootDir    = "/boot"
+)
+
+// bootID returns an identifier that changes on every boot.
+func bootID() (string, error) {
+	data, err := ioutil.ReadFile(bootIDFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// expectedKernel returns the release of the most recently installed kernel,
+// which is the kernel the system is expected to boot after patching.
+func expectedKernel() string {
+	images, err := filepath.Glob(filepath.Join(bootDir, "vmlinuz-*"))
+	if err != nil {
+		return ""
+	}
+	var newest string
+	var newestTime time.Time
+	for _, image := range images {
+		fi, err := os.Stat(image)
+		if err != nil || strings.Contains(image, "rescue") {
+			continue
+		}
+		if fi.ModTime().After(newestTime) {
+			newest, newestTime = image, fi.ModTime()
+		}
+	}
+	return strings.TrimPrefix(filepath.Base(newest), "vmlinuz-")
+}
+
+// failedUnits returns the systemd units in the failed state.
+func failedUnits(ctx context.Context) ([]string, error) {
+	if !util.Exists(systemctl) {
+		return nil, nil
+	}
+	out, err := exec.CommandContext(ctx, systemctl, "list-units", "--state=failed", "--no-legend", "--plain").Output()
+	if err != nil {
+		return nil, err
+	}
+	var units []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) > 0 {
+			units = append(units, f[0])
+		}
+	}
+	return units, nil
+}
@@ -0,0 +1,97 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+)
+
+var (
+	getBootID         = bootID
+	getExpectedKernel = expectedKernel
+	getFailedUnits    = failedUnits
+)
+
+// rebootMarker is persisted with the patch task before the agent reboots the
+// system, the checks in verifyReboot compare against it once the task
+// resumes.
+type rebootMarker struct {
+	BootID string `json:",omitempty"`
+	// ExpectedKernel is the kernel release the system should boot, empty if
+	// it is not known.
+	ExpectedKernel string `json:",omitempty"`
+	// FailedUnits are the units that already failed before the reboot, they
+	// are not held against the patch.
+	FailedUnits []string `json:",omitempty"`
+	RebootedAt  time.Time
+}
+
+func newRebootMarker(ctx context.Context) *rebootMarker {
+	m := &rebootMarker{ExpectedKernel: getExpectedKernel(), RebootedAt: time.Now()}
+	var err error
+	if m.BootID, err = getBootID(); err != nil {
+		clog.Debugf(ctx, "Error reading boot ID: %v", err)
+	}
+	if m.FailedUnits, err = getFailedUnits(ctx); err != nil {
+		clog.Debugf(ctx, "Error listing failed units: %v", err)
+	}
+	return m
+}
+
+// verifyReboot checks that the system came back healthy after the reboot
+// recorded in m, returning the problems found.
+func (r *patchTask) verifyReboot(ctx context.Context, m *rebootMarker) []string {
+	clog.Infof(ctx, "Verifying system after reboot at %s.", m.RebootedAt.Format(time.RFC3339))
+	var problems []string
+
+	if id, err := getBootID(); err != nil {
+		clog.Debugf(ctx, "Error reading boot ID: %v", err)
+	} else if m.BootID != "" && id == m.BootID {
+		problems = append(problems, "the system did not reboot")
+	}
+
+	if m.ExpectedKernel != "" {
+		if oi, err := osinfo.Get(ctx); err != nil {
+			clog.Debugf(ctx, "Error reading kernel release: %v", err)
+		} else if oi.KernelRelease != m.ExpectedKernel {
+			problems = append(problems, fmt.Sprintf("running kernel %q, expected %q", oi.KernelRelease, m.ExpectedKernel))
+		}
+	}
+
+	if units, err := getFailedUnits(ctx); err != nil {
+		clog.Debugf(ctx, "Error listing failed units: %v", err)
+	} else {
+		before := map[string]bool{}
+		for _, u := range m.FailedUnits {
+			before[u] = true
+		}
+		for _, u := range units {
+			if !before[u] {
+				problems = append(problems, fmt.Sprintf("unit %q failed", u))
+			}
+		}
+	}
+
+	if err := hooks.Run(ctx, hooks.AfterReboot, r.hookData()); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
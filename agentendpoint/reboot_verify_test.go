@@ -0,0 +1,67 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVerifyReboot(t *testing.T) {
+	defer func(b func() (string, error), u func(context.Context) ([]string, error)) {
+		getBootID, getFailedUnits = b, u
+	}(getBootID, getFailedUnits)
+	defer osinfo.SetProvider(osinfo.SetProvider(nil))
+
+	ctx := context.Background()
+	marker := &rebootMarker{BootID: "boot-1", ExpectedKernel: "6.1.0-18-amd64", FailedUnits: []string{"old.service"}}
+
+	tests := []struct {
+		name   string
+		bootID string
+		kernel string
+		units  []string
+		hook   error
+		want   []string
+	}{
+		{"Healthy", "boot-2", "6.1.0-18-amd64", []string{"old.service"}, nil, nil},
+		{"NotRebooted", "boot-1", "6.1.0-18-amd64", nil, nil, []string{"the system did not reboot"}},
+		{"WrongKernel", "boot-2", "6.1.0-17-amd64", nil, nil, []string{`running kernel "6.1.0-17-amd64", expected "6.1.0-18-amd64"`}},
+		{"FailedUnit", "boot-2", "6.1.0-18-amd64", []string{"old.service", "new.service"}, nil, []string{`unit "new.service" failed`}},
+		{"CanaryFailed", "boot-2", "6.1.0-18-amd64", nil, errors.New("canary down"), []string{`after-reboot hook "canary" failed: canary down`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getBootID = func() (string, error) { return tt.bootID, nil }
+			osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+				return &osinfo.OSInfo{KernelRelease: tt.kernel}, nil
+			}))
+			getFailedUnits = func(context.Context) ([]string, error) { return tt.units, nil }
+			hooks.Register(hooks.AfterReboot, "canary", time.Second, func(context.Context, *hooks.Event) error { return tt.hook })
+			defer hooks.Unregister(hooks.AfterReboot, "canary")
+
+			got := (&patchTask{TaskID: "task"}).verifyReboot(ctx, marker)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("verifyReboot() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -18,9 +18,14 @@
 package agentendpoint
 
 import (
+	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
+
+	"github.com/StackExchange/wmi"
 )
 
 func rebootSystem() error {
@@ -30,3 +35,26 @@ func rebootSystem() error {
 	}
 	return exec.Command(filepath.Join(root, `System32\shutdown.exe`), "/r", "/t", "00", "/f", "/d", "p:2:3").Run()
 }
+
+// bootID returns an identifier that changes on every boot.
+func bootID() (string, error) {
+	var dst []struct{ LastBootUpTime time.Time }
+	if err := wmi.Query("SELECT LastBootUpTime FROM Win32_OperatingSystem", &dst); err != nil {
+		return "", err
+	}
+	if len(dst) == 0 {
+		return "", errors.New("no Win32_OperatingSystem instance")
+	}
+	return dst[0].LastBootUpTime.UTC().Format(time.RFC3339), nil
+}
+
+// expectedKernel is not checked on Windows, the build number only changes
+// with feature updates.
+func expectedKernel() string {
+	return ""
+}
+
+// failedUnits is not checked on Windows.
+func failedUnits(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
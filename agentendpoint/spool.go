@@ -0,0 +1,127 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/spool"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
+)
+
+// Reports that can't be sent because the agent endpoint is unreachable are
+// spooled and replayed, in order, before the next inventory report and
+// after the next registration.
+
+const (
+	spoolKindInventory    = "inventory"
+	spoolKindTaskComplete = "task_complete"
+
+	maxSpooledReports = 50
+)
+
+var reportSpool = spool.New(filepath.Join(agentconfig.CacheDir(), "osconfig_report_spool"), maxSpooledReports)
+
+// unreachable reports whether err, returned by an agent endpoint RPC, means
+// the endpoint could not be reached rather than it rejecting the call. The
+// client retries unavailable calls until the deadline of the context.
+func unreachable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func spoolReport(ctx context.Context, kind, key string, m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := reportSpool.Put(ctx, &spool.Entry{Kind: kind, Key: key, Queued: time.Now(), Data: data}); err != nil {
+		return err
+	}
+	clog.Warningf(ctx, "Agent endpoint unreachable, spooled the %s report to send it later.", kind)
+	return nil
+}
+
+// spoolInventory spools a full inventory report, replacing the one already
+// spooled.
+func spoolInventory(ctx context.Context, inv *agentendpointpb.Inventory) error {
+	return spoolReport(ctx, spoolKindInventory, spoolKindInventory, inv)
+}
+
+// spoolTaskComplete spools a ReportTaskComplete request, without its ID
+// token which is only valid for a short time.
+func spoolTaskComplete(ctx context.Context, req *agentendpointpb.ReportTaskCompleteRequest) error {
+	req = proto.Clone(req).(*agentendpointpb.ReportTaskCompleteRequest)
+	req.InstanceIdToken = ""
+	return spoolReport(ctx, spoolKindTaskComplete, "task/"+req.GetTaskId(), req)
+}
+
+func (c *Client) sendSpooled(ctx context.Context, e *spool.Entry) error {
+	var err error
+	switch e.Kind {
+	case spoolKindInventory:
+		inv := &agentendpointpb.Inventory{}
+		if err := proto.Unmarshal(e.Data, inv); err != nil {
+			clog.Warningf(ctx, "Dropping unreadable spooled inventory report: %v", err)
+			return nil
+		}
+		_, err = c.reportInventory(ctx, inv, true)
+	case spoolKindTaskComplete:
+		req := &agentendpointpb.ReportTaskCompleteRequest{}
+		if err := proto.Unmarshal(e.Data, req); err != nil {
+			clog.Warningf(ctx, "Dropping unreadable spooled task report: %v", err)
+			return nil
+		}
+		if req.InstanceIdToken, err = agentconfig.IDToken(); err != nil {
+			return err
+		}
+		_, err = c.raw.ReportTaskComplete(ctx, req)
+	default:
+		clog.Warningf(ctx, "Dropping spooled report of unknown kind %q.", e.Kind)
+		return nil
+	}
+	if err != nil && !unreachable(err) {
+		clog.Warningf(ctx, "Dropping spooled %s report %q queued at %s, rejected by the agent endpoint: %v", e.Kind, e.Key, e.Queued.Format(time.RFC3339), err)
+		return nil
+	}
+	return err
+}
+
+// replaySpool sends the spooled reports, stopping at the first one the
+// agent endpoint is still unreachable for.
+func (c *Client) replaySpool(ctx context.Context) {
+	n, err := reportSpool.Replay(ctx, c.sendSpooled)
+	if n > 0 {
+		clog.Infof(ctx, "Replayed %d spooled reports.", n)
+	}
+	if err != nil {
+		clog.Debugf(ctx, "Not replaying the remaining spooled reports: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/spool"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
+)
+
+type agentEndpointServiceSpoolTestServer struct {
+	agentEndpointServiceInventoryTestServer
+	unreachable bool
+	inventories []*agentendpointpb.Inventory
+}
+
+func (s *agentEndpointServiceSpoolTestServer) ReportInventory(ctx context.Context, req *agentendpointpb.ReportInventoryRequest) (*agentendpointpb.ReportInventoryResponse, error) {
+	if s.unreachable {
+		return nil, status.Error(codes.Unavailable, "unreachable")
+	}
+	s.inventories = append(s.inventories, req.GetInventory())
+	return &agentendpointpb.ReportInventoryResponse{}, nil
+}
+
+func useTestSpool(t *testing.T) {
+	old := reportSpool
+	t.Cleanup(func() { reportSpool = old })
+	reportSpool = spool.New(t.TempDir(), maxSpooledReports)
+}
+
+func TestSpoolInventory(t *testing.T) {
+	useTestSpool(t)
+	packages.YumExists = true
+	srv := &agentEndpointServiceSpoolTestServer{unreachable: true}
+	tc, err := newTestClient(context.Background(), srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	// The retries of the report stop at the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	tc.client.report(ctx, generateInventoryState())
+	if n, err := reportSpool.Len(ctx); err != nil || n != 1 {
+		t.Fatalf("spooled reports = %d, %v, want 1", n, err)
+	}
+
+	// The spooled report is sent in full before the next one.
+	srv.unreachable = false
+	tc.client.report(context.Background(), generateInventoryState())
+	if len(srv.inventories) != 2 {
+		t.Fatalf("got %d inventory reports, want 2", len(srv.inventories))
+	}
+	if diff := cmp.Diff(generateInventory(), srv.inventories[0], protocmp.Transform()); diff != "" {
+		t.Errorf("replayed inventory mismatch (-want +got):\n%s", diff)
+	}
+	if srv.inventories[1] != nil {
+		t.Errorf("second report has an inventory, want only its checksum")
+	}
+	if n, err := reportSpool.Len(context.Background()); err != nil || n != 0 {
+		t.Errorf("spooled reports after replay = %d, %v, want 0", n, err)
+	}
+}
+
+func TestSpoolTaskCompleteRejected(t *testing.T) {
+	useTestSpool(t)
+	ctx := context.Background()
+	srv := &agentEndpointServiceSpoolTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	req := &agentendpointpb.ReportTaskCompleteRequest{TaskId: "task", InstanceIdToken: "token"}
+	if err := spoolTaskComplete(ctx, req); err != nil {
+		t.Fatalf("spoolTaskComplete() error: %v", err)
+	}
+	// Spooling the same task again replaces the spooled report.
+	if err := spoolTaskComplete(ctx, req); err != nil {
+		t.Fatalf("spoolTaskComplete() error: %v", err)
+	}
+	if n, err := reportSpool.Len(ctx); err != nil || n != 1 {
+		t.Fatalf("spooled reports = %d, %v, want 1", n, err)
+	}
+
+	// The test server rejects task reports, they can't ever be sent.
+	tc.client.replaySpool(ctx)
+	if n, err := reportSpool.Len(ctx); err != nil || n != 0 {
+		t.Errorf("spooled reports after replay = %d, %v, want 0", n, err)
+	}
+}
@@ -0,0 +1,217 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package agenthttp provides the HTTP handlers exposing the agent status,
+// metrics and control API, to be mounted on the mux of a process embedding
+// the agent.
+package agenthttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/heartbeat"
+	osmetrics "github.com/GoogleCloudPlatform/osconfig/metrics"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+)
+
+var (
+	pause       = agentconfig.Pause
+	resume      = agentconfig.Resume
+	pausedUntil = agentconfig.PausedUntil
+	lastRecord  = heartbeat.Last
+	taskStatus  = tasker.Status
+	now         = time.Now
+)
+
+// Register mounts the handlers on mux below prefix, e.g. "/osconfig":
+// prefix/metrics, prefix/status, prefix/healthz and prefix/control. A cycle
+// older than maxAge fails the health check, zero disables that check.
+func Register(mux *http.ServeMux, prefix string, maxAge time.Duration) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+"/metrics", MetricsHandler())
+	mux.Handle(prefix+"/status", StatusHandler())
+	mux.Handle(prefix+"/healthz", HealthzHandler(maxAge))
+	mux.Handle(prefix+"/control", ControlHandler())
+}
+
+// Pause is the pause state of a subsystem in the Status.
+type Pause struct {
+	Subsystem string `json:"subsystem"`
+	// Until is zero if the subsystem is paused until resumed.
+	Until time.Time `json:"until,omitempty"`
+}
+
+// Status is the response of the StatusHandler.
+type Status struct {
+	Version string `json:"version"`
+	// LastCycle is nil if no cycle has completed yet.
+	LastCycle *heartbeat.Record `json:"last_cycle,omitempty"`
+	Paused    []*Pause          `json:"paused,omitempty"`
+	// Tasks are the running and queued tasks, what the agent is doing.
+	Tasks *tasker.QueueStatus `json:"tasks"`
+}
+
+func status() *Status {
+	s := &Status{Version: agentconfig.Version(), LastCycle: lastRecord(), Tasks: taskStatus()}
+	for _, sub := range agentconfig.Subsystems {
+		if until, ok := pausedUntil(sub); ok {
+			s.Paused = append(s.Paused, &Pause{Subsystem: sub, Until: until})
+		}
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// StatusHandler serves the Status as JSON.
+func StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, status())
+	})
+}
+
+// HealthzHandler responds 200 once a cycle completed, within maxAge if it is
+// not zero, and 503 otherwise.
+func HealthzHandler(maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := lastRecord()
+		switch {
+		case rec == nil:
+			http.Error(w, "no agent cycle completed yet", http.StatusServiceUnavailable)
+		case maxAge > 0 && now().Sub(rec.Start) > maxAge:
+			http.Error(w, fmt.Sprintf("last agent cycle started at %s", rec.Start.Format(time.RFC3339)), http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+}
+
+func boolGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metrics formats the Status in the Prometheus text format.
+func metrics(s *Status) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# TYPE osconfig_agent_info gauge\nosconfig_agent_info{version=%q} 1\n", s.Version)
+
+	paused := map[string]bool{}
+	for _, p := range s.Paused {
+		paused[p.Subsystem] = true
+	}
+	subs := append([]string(nil), agentconfig.Subsystems...)
+	sort.Strings(subs)
+	b.WriteString("# TYPE osconfig_agent_paused gauge\n")
+	for _, sub := range subs {
+		fmt.Fprintf(&b, "osconfig_agent_paused{subsystem=%q} %d\n", sub, boolGauge(paused[sub]))
+	}
+
+	if s.Tasks != nil {
+		fmt.Fprintf(&b, "# TYPE osconfig_agent_tasks_running gauge\nosconfig_agent_tasks_running %d\n", len(s.Tasks.Running))
+		fmt.Fprintf(&b, "# TYPE osconfig_agent_tasks_pending gauge\nosconfig_agent_tasks_pending %d\n", len(s.Tasks.Pending))
+	}
+
+	rec := s.LastCycle
+	if rec == nil {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "# TYPE osconfig_agent_cycle gauge\nosconfig_agent_cycle %d\n", rec.Cycle)
+	fmt.Fprintf(&b, "# TYPE osconfig_agent_cycle_start_timestamp_seconds gauge\nosconfig_agent_cycle_start_timestamp_seconds %d\n", rec.Start.Unix())
+	for _, m := range []struct {
+		name  string
+		value func(*heartbeat.Subsystem) string
+	}{
+		{"osconfig_subsystem_ran", func(s *heartbeat.Subsystem) string { return fmt.Sprint(boolGauge(s.Ran)) }},
+		{"osconfig_subsystem_success", func(s *heartbeat.Subsystem) string { return fmt.Sprint(boolGauge(s.Success)) }},
+		{"osconfig_subsystem_items", func(s *heartbeat.Subsystem) string { return fmt.Sprint(s.Items) }},
+		{"osconfig_subsystem_duration_seconds", func(s *heartbeat.Subsystem) string {
+			return fmt.Sprint(float64(s.DurationMs) / 1000)
+		}},
+	} {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", m.name)
+		for _, sub := range rec.Subsystems {
+			fmt.Fprintf(&b, "%s{subsystem=%q} %s\n", m.name, sub.Name, m.value(sub))
+		}
+	}
+	return b.String()
+}
+
+// WriteMetrics writes the last cycle, pause state, task queue and the
+// counters and histograms of the metrics package in the Prometheus text
+// format, e.g. for a textfile collector.
+func WriteMetrics(w io.Writer) error {
+	if _, err := io.WriteString(w, metrics(status())); err != nil {
+		return err
+	}
+	return osmetrics.WriteText(w)
+}
+
+// MetricsHandler serves WriteMetrics.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteMetrics(w)
+	})
+}
+
+// ControlHandler pauses and resumes subsystems like the pause and resume
+// actions of the agent, it accepts POST requests with the form values
+// action ("pause" or "resume"), subsystem and, to pause for a limited time,
+// duration.
+func ControlHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		subsystem := r.FormValue("subsystem")
+		var err error
+		switch action := r.FormValue("action"); action {
+		case "pause":
+			var d time.Duration
+			if v := r.FormValue("duration"); v != "" {
+				if d, err = time.ParseDuration(v); err != nil {
+					http.Error(w, fmt.Sprintf("invalid pause duration %q: %v", v, err), http.StatusBadRequest)
+					return
+				}
+			}
+			err = pause(subsystem, d)
+		case "resume":
+			err = resume(subsystem)
+		default:
+			http.Error(w, fmt.Sprintf("unknown action %q, valid actions are \"pause\" and \"resume\"", action), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, status())
+	})
+}
@@ -0,0 +1,222 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agenthttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/heartbeat"
+	"github.com/GoogleCloudPlatform/osconfig/inventory"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+)
+
+func fakeState(t *testing.T, rec *heartbeat.Record, paused map[string]time.Time) {
+	oldLast, oldPausedUntil, oldPause, oldResume, oldTaskStatus := lastRecord, pausedUntil, pause, resume, taskStatus
+	t.Cleanup(func() {
+		lastRecord, pausedUntil, pause, resume, taskStatus = oldLast, oldPausedUntil, oldPause, oldResume, oldTaskStatus
+	})
+	lastRecord = func() *heartbeat.Record { return rec }
+	taskStatus = func() *tasker.QueueStatus {
+		return &tasker.QueueStatus{Running: []*tasker.TaskStatus{{Name: "PatchRun"}}, Pending: []*tasker.TaskStatus{}}
+	}
+	pausedUntil = func(s string) (time.Time, bool) {
+		until, ok := paused[s]
+		return until, ok
+	}
+	pause = func(s string, d time.Duration) error {
+		paused[s] = time.Time{}
+		return nil
+	}
+	resume = func(s string) error {
+		delete(paused, s)
+		return nil
+	}
+}
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestHealthz(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return start.Add(time.Hour) }
+
+	tests := []struct {
+		name   string
+		rec    *heartbeat.Record
+		maxAge time.Duration
+		want   int
+	}{
+		{"NoCycle", nil, 0, http.StatusServiceUnavailable},
+		{"Cycle", &heartbeat.Record{Start: start}, 0, http.StatusOK},
+		{"RecentCycle", &heartbeat.Record{Start: start}, 2 * time.Hour, http.StatusOK},
+		{"StaleCycle", &heartbeat.Record{Start: start}, time.Minute, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeState(t, tt.rec, map[string]time.Time{})
+			if got := serve(HealthzHandler(tt.maxAge), http.MethodGet, "/healthz").Code; got != tt.want {
+				t.Errorf("status code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	rec := &heartbeat.Record{
+		Cycle: 3,
+		Start: time.Unix(1700000000, 0),
+		Subsystems: []*heartbeat.Subsystem{
+			{Name: heartbeat.Inventory, Ran: true, Error: "report failed", Items: 200, DurationMs: 1500},
+			{Name: heartbeat.Policies, SkipReason: "paused"},
+		},
+	}
+	fakeState(t, rec, map[string]time.Time{agentconfig.SubsystemPolicy: {}})
+
+	got := serve(MetricsHandler(), http.MethodGet, "/metrics").Body.String()
+	for _, want := range []string{
+		`osconfig_agent_paused{subsystem="policy"} 1`,
+		`osconfig_agent_paused{subsystem="inventory"} 0`,
+		"osconfig_agent_cycle 3\n",
+		"osconfig_agent_cycle_start_timestamp_seconds 1700000000\n",
+		`osconfig_subsystem_ran{subsystem="inventory"} 1`,
+		`osconfig_subsystem_success{subsystem="inventory"} 0`,
+		`osconfig_subsystem_items{subsystem="inventory"} 200`,
+		`osconfig_subsystem_duration_seconds{subsystem="inventory"} 1.5`,
+		`osconfig_subsystem_ran{subsystem="policies"} 0`,
+		"osconfig_agent_tasks_running 1\n",
+		"osconfig_agent_tasks_pending 0\n",
+		"# TYPE osconfig_patch_runs_total counter\n",
+		"# TYPE osconfig_command_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics missing %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	paused := map[string]time.Time{}
+	fakeState(t, nil, paused)
+	h := ControlHandler()
+
+	if got := serve(h, http.MethodGet, "/control?action=pause&subsystem=inventory").Code; got != http.StatusMethodNotAllowed {
+		t.Errorf("GET status code = %d, want %d", got, http.StatusMethodNotAllowed)
+	}
+	for _, q := range []string{"action=stop&subsystem=inventory", "action=pause&subsystem=inventory&duration=soon"} {
+		if got := serve(h, http.MethodPost, "/control?"+q).Code; got != http.StatusBadRequest {
+			t.Errorf("POST %q status code = %d, want %d", q, got, http.StatusBadRequest)
+		}
+	}
+
+	w := serve(h, http.MethodPost, "/control?"+url.Values{"action": {"pause"}, "subsystem": {"inventory"}}.Encode())
+	if w.Code != http.StatusOK {
+		t.Fatalf("pause status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if _, ok := paused["inventory"]; !ok {
+		t.Error("inventory not paused")
+	}
+	if !strings.Contains(w.Body.String(), `"subsystem":"inventory"`) {
+		t.Errorf("pause response does not list inventory as paused: %s", w.Body)
+	}
+
+	if w := serve(h, http.MethodPost, "/control?action=resume&subsystem=inventory"); w.Code != http.StatusOK {
+		t.Fatalf("resume status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if _, ok := paused["inventory"]; ok {
+		t.Error("inventory still paused")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	fakeState(t, &heartbeat.Record{Cycle: 1}, map[string]time.Time{})
+	mux := http.NewServeMux()
+	Register(mux, "/osconfig/", 0)
+
+	for _, path := range []string{"/osconfig/metrics", "/osconfig/status", "/osconfig/healthz"} {
+		if got := serve(mux, http.MethodGet, path).Code; got != http.StatusOK {
+			t.Errorf("GET %s status code = %d, want %d", path, got, http.StatusOK)
+		}
+	}
+	if got := serve(mux, http.MethodGet, "/osconfig/control").Code; got != http.StatusMethodNotAllowed {
+		t.Errorf("GET /osconfig/control status code = %d, want %d", got, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	defer func(f func() *inventory.InstanceInventory) { latestInventory = f }(latestInventory)
+	var state *inventory.InstanceInventory
+	latestInventory = func() *inventory.InstanceInventory { return state }
+	h := InventoryHandler("/osconfig")
+
+	if got := serve(h, http.MethodGet, "/osconfig/inventory").Code; got != http.StatusServiceUnavailable {
+		t.Errorf("status code before the first inventory = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+
+	state = &inventory.InstanceInventory{
+		Hostname:          "host",
+		InstalledPackages: &packages.Packages{Apt: []*packages.PkgInfo{{Name: "bash", Version: "5.1"}}},
+		PackageUpdates:    &packages.Packages{Apt: []*packages.PkgInfo{{Name: "bash", Version: "5.2"}}},
+	}
+	tests := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/osconfig/inventory", http.StatusOK, `"Hostname":"host"`},
+		{"/osconfig/inventory/packages", http.StatusOK, `"Version":"5.1"`},
+		{"/osconfig/inventory/updates/", http.StatusOK, `"Version":"5.2"`},
+		{"/osconfig/inventory/other", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serve(h, http.MethodGet, tt.path)
+		if w.Code != tt.code {
+			t.Errorf("GET %s status code = %d, want %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET %s = %s, want it to contain %s", tt.path, w.Body, tt.want)
+		}
+	}
+	if got := serve(h, http.MethodPost, "/osconfig/inventory").Code; got != http.StatusMethodNotAllowed {
+		t.Errorf("POST status code = %d, want %d", got, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"localhost:9753": true,
+		"127.0.0.1:9753": true,
+		"[::1]:9753":     true,
+		"0.0.0.0:9753":   false,
+		":9753":          false,
+		"10.0.0.1:9753":  false,
+		"localhost":      false,
+	} {
+		if got := IsLoopback(addr); got != want {
+			t.Errorf("IsLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
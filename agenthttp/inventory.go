@@ -0,0 +1,70 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agenthttp
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory"
+)
+
+var latestInventory = inventory.Latest
+
+// InventoryHandler serves the last reported inventory as JSON below prefix:
+// prefix/inventory is the whole inventory, prefix/inventory/packages the
+// installed packages and prefix/inventory/updates the available updates. It
+// responds 503 until the first inventory is reported.
+func InventoryHandler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/") + "/inventory"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		state := latestInventory()
+		if state == nil {
+			http.Error(w, "no inventory reported yet", http.StatusServiceUnavailable)
+			return
+		}
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case prefix:
+			writeJSON(w, http.StatusOK, state)
+		case prefix + "/packages":
+			writeJSON(w, http.StatusOK, state.InstalledPackages)
+		case prefix + "/updates":
+			writeJSON(w, http.StatusOK, state.PackageUpdates)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// IsLoopback reports whether the host of addr, in the host:port form, is
+// localhost or a loopback IP. The inventory server only listens on such
+// addresses, the inventory is not meant to leave the host.
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
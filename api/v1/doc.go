@@ -0,0 +1,29 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package v1 is the stable Go API of the agent for tools built on top of
+// it. The packages, ospatch and inventory packages are internal to the
+// agent and change whenever the agent needs them to; v1 mirrors the parts
+// of them other tools rely on and converts from them.
+//
+// The types in v1 follow semantic versioning, tracked by Version:
+//   - exported types, fields, functions and their meaning are not removed
+//     or changed within v1, a breaking change gets a new v2 package;
+//   - fields, types and functions may be added in minor versions, so don't
+//     rely on positional struct literals or on the set of fields;
+//   - values the agent does not know are left empty rather than guessed.
+package v1
+
+// Version is the semantic version of this API.
+const Version = "1.3.0"
@@ -0,0 +1,173 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package v1
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// Package is an installed package or an available update.
+type Package struct {
+	Name    string `json:"name"`
+	Arch    string `json:"arch,omitempty"`
+	Version string `json:"version"`
+	// Epoch is the epoch of deb and rpm versions, also included in Version.
+	Epoch string `json:"epoch,omitempty"`
+	// SourceName and SourceVersion are the source package the package was
+	// built from, if known.
+	SourceName    string `json:"sourceName,omitempty"`
+	SourceVersion string `json:"sourceVersion,omitempty"`
+	// Repository and Size are only set for updates, when the package manager
+	// reports them.
+	Repository string `json:"repository,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// ZypperPatch is a zypper patch.
+type ZypperPatch struct {
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+}
+
+// WindowsUpdate is an update known to the Windows Update Agent.
+type WindowsUpdate struct {
+	UpdateID                 string    `json:"updateId"`
+	RevisionNumber           int32     `json:"revisionNumber"`
+	Title                    string    `json:"title"`
+	Description              string    `json:"description,omitempty"`
+	KBArticleIDs             []string  `json:"kbArticleIds,omitempty"`
+	Categories               []string  `json:"categories,omitempty"`
+	SupportURL               string    `json:"supportUrl,omitempty"`
+	LastDeploymentChangeTime time.Time `json:"lastDeploymentChangeTime"`
+}
+
+// QFE is an installed Windows Quick Fix Engineering update.
+type QFE struct {
+	HotFixID    string `json:"hotFixId"`
+	Caption     string `json:"caption,omitempty"`
+	Description string `json:"description,omitempty"`
+	InstalledOn string `json:"installedOn,omitempty"`
+}
+
+// MSIProduct is a product installed by Windows Installer.
+type MSIProduct struct {
+	ProductCode string `json:"productCode"`
+	ProductName string `json:"productName,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Publisher   string `json:"publisher,omitempty"`
+}
+
+// Packages are the packages of a system by package manager.
+type Packages struct {
+	Apt           []*Package       `json:"apt,omitempty"`
+	Deb           []*Package       `json:"deb,omitempty"`
+	Yum           []*Package       `json:"yum,omitempty"`
+	Rpm           []*Package       `json:"rpm,omitempty"`
+	Zypper        []*Package       `json:"zypper,omitempty"`
+	ZypperPatches []*ZypperPatch   `json:"zypperPatches,omitempty"`
+	COS           []*Package       `json:"cos,omitempty"`
+	Gem           []*Package       `json:"gem,omitempty"`
+	Pip           []*Package       `json:"pip,omitempty"`
+	Brew          []*Package       `json:"brew,omitempty"`
+	GooGet        []*Package       `json:"googet,omitempty"`
+	WindowsUpdate []*WindowsUpdate `json:"windowsUpdate,omitempty"`
+	QFE           []*QFE           `json:"qfe,omitempty"`
+	MSI           []*MSIProduct    `json:"msi,omitempty"`
+}
+
+// FromPkgInfo converts an agent package, nil converts to nil.
+func FromPkgInfo(p *packages.PkgInfo) *Package {
+	if p == nil {
+		return nil
+	}
+	return &Package{
+		Name:          p.Name,
+		Arch:          p.Arch,
+		Version:       p.Version,
+		Epoch:         p.Epoch,
+		SourceName:    p.Source.Name,
+		SourceVersion: p.Source.Version,
+		Repository:    p.Repository,
+		Size:          p.Size,
+	}
+}
+
+func fromPkgInfos(pkgs []*packages.PkgInfo) []*Package {
+	var out []*Package
+	for _, p := range pkgs {
+		out = append(out, FromPkgInfo(p))
+	}
+	return out
+}
+
+// FromZypperPatch converts an agent zypper patch, nil converts to nil.
+func FromZypperPatch(p *packages.ZypperPatch) *ZypperPatch {
+	if p == nil {
+		return nil
+	}
+	return &ZypperPatch{Name: p.Name, Category: p.Category, Severity: p.Severity, Summary: p.Summary}
+}
+
+func fromZypperPatches(patches []*packages.ZypperPatch) []*ZypperPatch {
+	var out []*ZypperPatch
+	for _, p := range patches {
+		out = append(out, FromZypperPatch(p))
+	}
+	return out
+}
+
+// FromPackages converts the packages reported by the agent, nil converts to
+// nil.
+func FromPackages(p *packages.Packages) *Packages {
+	if p == nil {
+		return nil
+	}
+	out := &Packages{
+		Apt:           fromPkgInfos(p.Apt),
+		Deb:           fromPkgInfos(p.Deb),
+		Yum:           fromPkgInfos(p.Yum),
+		Rpm:           fromPkgInfos(p.Rpm),
+		Zypper:        fromPkgInfos(p.Zypper),
+		ZypperPatches: fromZypperPatches(p.ZypperPatches),
+		COS:           fromPkgInfos(p.COS),
+		Gem:           fromPkgInfos(p.Gem),
+		Pip:           fromPkgInfos(p.Pip),
+		Brew:          fromPkgInfos(p.Brew),
+		GooGet:        fromPkgInfos(p.GooGet),
+	}
+	for _, w := range p.WUA {
+		out.WindowsUpdate = append(out.WindowsUpdate, &WindowsUpdate{
+			UpdateID:                 w.UpdateID,
+			RevisionNumber:           w.RevisionNumber,
+			Title:                    w.Title,
+			Description:              w.Description,
+			KBArticleIDs:             w.KBArticleIDs,
+			Categories:               w.Categories,
+			SupportURL:               w.SupportURL,
+			LastDeploymentChangeTime: w.LastDeploymentChangeTime,
+		})
+	}
+	for _, q := range p.QFE {
+		out.QFE = append(out.QFE, &QFE{HotFixID: q.HotFixID, Caption: q.Caption, Description: q.Description, InstalledOn: q.InstalledOn})
+	}
+	for _, m := range p.MSI {
+		out.MSI = append(out.MSI, &MSIProduct{ProductCode: m.ProductCode, ProductName: m.ProductName, Version: m.Version, Publisher: m.Publisher})
+	}
+	return out
+}
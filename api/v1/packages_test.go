@@ -0,0 +1,84 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFromPackages(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	in := &packages.Packages{
+		Deb:           []*packages.PkgInfo{{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1", Epoch: "1", Source: packages.Source{Name: "git-src", Version: "1:2.25.1-1"}}},
+		Yum:           []*packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "4.2.46-34.el7", Repository: "updates", Size: 1024}},
+		ZypperPatches: []*packages.ZypperPatch{{Name: "patch", Category: "security", Severity: "important", Summary: "fix"}},
+		WUA:           []*packages.WUAPackage{{Title: "update", UpdateID: "id", RevisionNumber: 2, KBArticleIDs: []string{"123"}, LastDeploymentChangeTime: date}},
+		QFE:           []*packages.QFEPackage{{HotFixID: "KB123", InstalledOn: "1/2/2024"}},
+		MSI:           []*packages.MSIProduct{{ProductCode: "{GUID}", Version: "1.0"}},
+	}
+	want := &Packages{
+		Deb:           []*Package{{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1", Epoch: "1", SourceName: "git-src", SourceVersion: "1:2.25.1-1"}},
+		Yum:           []*Package{{Name: "bash", Arch: "x86_64", Version: "4.2.46-34.el7", Repository: "updates", Size: 1024}},
+		ZypperPatches: []*ZypperPatch{{Name: "patch", Category: "security", Severity: "important", Summary: "fix"}},
+		WindowsUpdate: []*WindowsUpdate{{Title: "update", UpdateID: "id", RevisionNumber: 2, KBArticleIDs: []string{"123"}, LastDeploymentChangeTime: date}},
+		QFE:           []*QFE{{HotFixID: "KB123", InstalledOn: "1/2/2024"}},
+		MSI:           []*MSIProduct{{ProductCode: "{GUID}", Version: "1.0"}},
+	}
+	if diff := cmp.Diff(want, FromPackages(in)); diff != "" {
+		t.Errorf("FromPackages() mismatch (-want +got):\n%s", diff)
+	}
+	if FromPackages(nil) != nil {
+		t.Error("FromPackages(nil) != nil")
+	}
+}
+
+func TestFromPatchResult(t *testing.T) {
+	bash := &packages.PkgInfo{Name: "bash", Arch: "x86_64", Version: "5.1"}
+	in := &ospatch.PatchResult{
+		Attempted:     []*packages.PkgInfo{bash},
+		Failed:        []*ospatch.PackageFailure{{Package: bash, Error: "conflict"}},
+		Duration:      time.Minute,
+		RebootPending: true,
+		TransactionID: "12",
+	}
+	want := &PatchResult{
+		Attempted:     []*Package{{Name: "bash", Arch: "x86_64", Version: "5.1"}},
+		Failed:        []*PackageFailure{{Package: &Package{Name: "bash", Arch: "x86_64", Version: "5.1"}, Error: "conflict"}},
+		Duration:      time.Minute,
+		RebootPending: true,
+		TransactionID: "12",
+	}
+	if diff := cmp.Diff(want, FromPatchResult(in)); diff != "" {
+		t.Errorf("FromPatchResult() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPackageFormat(t *testing.T) {
+	// The JSON format is part of the v1 API and must not change.
+	data, err := json.Marshal(&Package{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1", Epoch: "1", SourceName: "git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"git","arch":"x86_64","version":"1:2.25.1-1","epoch":"1","sourceName":"git"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+}
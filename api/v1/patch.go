@@ -0,0 +1,106 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package v1
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+)
+
+// PatchPlan is what a patch run would install.
+type PatchPlan struct {
+	Packages []*Package     `json:"packages,omitempty"`
+	Patches  []*ZypperPatch `json:"patches,omitempty"`
+	// DownloadSize is the estimated download size in bytes, 0 if unknown.
+	DownloadSize int64 `json:"downloadSize,omitempty"`
+}
+
+// PackageFailure is a package update that failed to install.
+type PackageFailure struct {
+	Package *Package `json:"package"`
+	Error   string   `json:"error"`
+}
+
+// HealthCheckFailure is a post-patch health check that failed.
+type HealthCheckFailure struct {
+	Check string `json:"check"`
+	Error string `json:"error"`
+}
+
+// RepoRefreshFailure is a repository that failed to refresh before a patch
+// run.
+type RepoRefreshFailure struct {
+	Repo  string `json:"repo"`
+	Error string `json:"error"`
+}
+
+// PatchResult is the outcome of a patch run.
+type PatchResult struct {
+	Attempted     []*Package        `json:"attempted,omitempty"`
+	Succeeded     []*Package        `json:"succeeded,omitempty"`
+	Failed        []*PackageFailure `json:"failed,omitempty"`
+	Patches       []*ZypperPatch    `json:"patches,omitempty"`
+	Duration      time.Duration     `json:"duration"`
+	RebootPending bool              `json:"rebootPending"`
+	// HealthCheckFailures are set if the updates were installed but a
+	// post-patch health check failed, added in 1.1.0.
+	HealthCheckFailures []*HealthCheckFailure `json:"healthCheckFailures,omitempty"`
+	// RefreshFailures are the repositories that failed to refresh before
+	// the run, added in 1.2.0.
+	RefreshFailures []*RepoRefreshFailure `json:"refreshFailures,omitempty"`
+	// TransactionID is the yum or dnf history transaction of the run, added
+	// in 1.3.0.
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// FromPatchPlan converts a plan returned by the ospatch runners, nil
+// converts to nil.
+func FromPatchPlan(p *ospatch.PatchPlan) *PatchPlan {
+	if p == nil {
+		return nil
+	}
+	return &PatchPlan{
+		Packages:     fromPkgInfos(p.Packages),
+		Patches:      fromZypperPatches(p.Patches),
+		DownloadSize: p.DownloadSize,
+	}
+}
+
+// FromPatchResult converts a result returned by the ospatch runners, nil
+// converts to nil.
+func FromPatchResult(r *ospatch.PatchResult) *PatchResult {
+	if r == nil {
+		return nil
+	}
+	out := &PatchResult{
+		Attempted:     fromPkgInfos(r.Attempted),
+		Succeeded:     fromPkgInfos(r.Succeeded),
+		Patches:       fromZypperPatches(r.Patches),
+		Duration:      r.Duration,
+		RebootPending: r.RebootPending,
+		TransactionID: r.TransactionID,
+	}
+	for _, f := range r.Failed {
+		out.Failed = append(out.Failed, &PackageFailure{Package: FromPkgInfo(f.Package), Error: f.Error})
+	}
+	for _, f := range r.HealthCheckFailures {
+		out.HealthCheckFailures = append(out.HealthCheckFailures, &HealthCheckFailure{Check: f.Check, Error: f.Error})
+	}
+	for _, f := range r.RefreshFailures {
+		out.RefreshFailures = append(out.RefreshFailures, &RepoRefreshFailure{Repo: f.Repo, Error: f.Error})
+	}
+	return out
+}
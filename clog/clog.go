@@ -43,7 +43,9 @@ type log struct {
 func (l *log) log(structuredPayload any, msg string, sev logger.Severity) {
 	// Set CallDepth 3, one for logger.Log, one for this function, and one for
 	// the calling clog function.
-	logger.Log(logger.LogEntry{Message: msg, StructuredPayload: structuredPayload, Severity: sev, CallDepth: 3, Labels: l.labels})
+	e := logger.LogEntry{Message: msg, StructuredPayload: structuredPayload, Severity: sev, CallDepth: 3, Labels: l.labels}
+	logger.Log(e)
+	sendToSinks(e, 2)
 }
 
 // protoToJSON converts a proto message to a generic JSON object for the purpose
@@ -91,6 +93,12 @@ func DebugStructured(ctx context.Context, structuredPayload any, format string,
 	fromContext(ctx).log(structuredPayload, fmt.Sprintf(format, args...), logger.Debug)
 }
 
+// InfoStructured is like Infof but sends structuredPayload instead of the text message
+// to Cloud Logging.
+func InfoStructured(ctx context.Context, structuredPayload any, format string, args ...any) {
+	fromContext(ctx).log(structuredPayload, fmt.Sprintf(format, args...), logger.Info)
+}
+
 // Debugf simulates logger.Debugf and adds context labels.
 func Debugf(ctx context.Context, format string, args ...any) {
 	fromContext(ctx).log(nil, fmt.Sprintf(format, args...), logger.Debug)
@@ -18,7 +18,9 @@ import (
 	"context"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/google/go-cmp/cmp"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
 )
 
 func TestWithLabels(t *testing.T) {
@@ -44,3 +46,17 @@ func TestWithLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatJSON(t *testing.T) {
+	e := logger.LogEntry{
+		Message:        "Running task.\n",
+		Severity:       logger.Warning,
+		Labels:         map[string]string{"instance_name": "vm", "task_name": "Report OSInventory"},
+		Source:         &logpb.LogEntrySourceLocation{File: "tasker.go", Line: 42},
+		LocalTimestamp: "2024-01-02T03:04:05.0000Z",
+	}
+	want := `{"timestamp":"2024-01-02T03:04:05.0000Z","severity":"WARNING","task":"Report OSInventory","source":"tasker.go:42","message":"Running task.","labels":{"instance_name":"vm","task_name":"Report OSInventory"}}`
+	if got := FormatJSON(e); got != want {
+		t.Errorf("FormatJSON() = %s, want %s", got, want)
+	}
+}
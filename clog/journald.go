@@ -0,0 +1,127 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+)
+
+// journalSocket is the socket of the journald native protocol.
+var journalSocket = "/run/systemd/journal/socket"
+
+// JournaldSink is a Sink sending entries to journald with the native
+// protocol, with the source location in the CODE_FILE, CODE_LINE and
+// CODE_FUNC fields and each label in a field named after it, upper cased
+// and prefixed with OSCONFIG_, e.g. OSCONFIG_TASK_NAME.
+type JournaldSink struct {
+	identifier string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewJournaldSink connects to journald, entries are logged with identifier
+// as their SYSLOG_IDENTIFIER.
+func NewJournaldSink(identifier string) (*JournaldSink, error) {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to journald: %v", err)
+	}
+	return &JournaldSink{identifier: identifier, conn: conn}, nil
+}
+
+// Send writes e to journald.
+func (s *JournaldSink) Send(e logger.LogEntry) error {
+	msg := journalMessage(e, s.identifier)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return net.ErrClosed
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// Close closes the connection to journald.
+func (s *JournaldSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// journalMessage encodes e in the journald native protocol.
+func journalMessage(e logger.LogEntry, identifier string) []byte {
+	sev, ok := syslogSeverity[e.Severity]
+	if !ok {
+		sev = 5
+	}
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", strings.TrimSpace(e.Message))
+	writeJournalField(&b, "PRIORITY", fmt.Sprint(sev))
+	writeJournalField(&b, "SYSLOG_FACILITY", fmt.Sprint(syslogFacility))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", identifier)
+	if e.Source != nil {
+		writeJournalField(&b, "CODE_FILE", e.Source.File)
+		writeJournalField(&b, "CODE_LINE", fmt.Sprint(e.Source.Line))
+		writeJournalField(&b, "CODE_FUNC", e.Source.Function)
+	}
+	var keys []string
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeJournalField(&b, "OSCONFIG_"+journalFieldName(k), e.Labels[k])
+	}
+	return b.Bytes()
+}
+
+// writeJournalField writes a field as "NAME=value\n", or in the binary form
+// with the length of the value if it spans several lines.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteString("=" + value + "\n")
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalFieldName upper cases k and replaces the characters not allowed in
+// a journal field name.
+func journalFieldName(k string) string {
+	name := []byte(strings.ToUpper(k))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
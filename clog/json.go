@@ -0,0 +1,57 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+)
+
+// jsonEntry is a log entry as written by FormatJSON.
+type jsonEntry struct {
+	Timestamp string            `json:"timestamp"`
+	Severity  string            `json:"severity"`
+	Task      string            `json:"task,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// FormatJSON formats a log entry as a single line JSON object with the
+// timestamp, severity, task name, source location, message and labels, for
+// logger.LogOpts.FormatFunction. The task name is the task_name label set
+// by the tasker, or the task_type label of agent tasks.
+func FormatJSON(e logger.LogEntry) string {
+	je := jsonEntry{
+		Timestamp: e.LocalTimestamp,
+		Severity:  strings.ToUpper(e.Severity.String()),
+		Message:   strings.TrimSpace(e.Message),
+		Labels:    e.Labels,
+	}
+	if je.Task = e.Labels["task_name"]; je.Task == "" {
+		je.Task = e.Labels["task_type"]
+	}
+	if e.Source != nil {
+		je.Source = fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line)
+	}
+	b, err := json.Marshal(je)
+	if err != nil {
+		return fmt.Sprintf(`{"severity":"ERROR","message":%q}`, fmt.Sprintf("Error formatting log entry: %v", err))
+	}
+	return string(b)
+}
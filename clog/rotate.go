@@ -0,0 +1,213 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of RotateOptions.
+const (
+	defaultMaxLogSize    = 10 << 20
+	defaultMaxLogBackups = 5
+	backupTimeFormat     = "20060102-150405.000"
+	// rotateRetryInterval is how long a log file that could not be rotated
+	// keeps being appended to before the rotation is tried again.
+	rotateRetryInterval = time.Minute
+)
+
+// rename is replaced in tests.
+var rename = os.Rename
+
+// RotateOptions limit a RotatingFile.
+type RotateOptions struct {
+	// MaxSize is the size in bytes at which the file is rotated, 10 MiB if
+	// 0.
+	MaxSize int64
+	// MaxAge rotates the file once it has been written to for this long, 0
+	// only rotates by size.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, 5 if 0.
+	MaxBackups int
+	// Retention removes rotated files older than it, 0 keeps them up to
+	// MaxBackups.
+	Retention time.Duration
+}
+
+// RotatingFile is an io.Writer appending to a log file, which it rotates to
+// a backup named after the time of the rotation, e.g.
+// "osconfig.log.20240102-150405.000", according to its RotateOptions. It can
+// be used as one of the logger.LogOpts.Writers.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+	size   int64
+	opened time.Time
+	// retry is when a rotation that failed is tried again.
+	retry time.Time
+}
+
+// NewRotatingFile opens the log file at path, appending to it if it exists.
+func NewRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxLogSize
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = defaultMaxLogBackups
+	}
+	r := &RotatingFile{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, fi.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if p would take it
+// over MaxSize or it is older than MaxAge.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.f == nil {
+		// Opening the new log file failed at the last rotation.
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	due := (r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSize) || (r.opts.MaxAge > 0 && time.Since(r.opened) > r.opts.MaxAge)
+	if due && !time.Now().Before(r.retry) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the log file to a backup, opens a new one and removes the
+// backups over the limits, called with mu held. If the log file cannot be
+// moved, it is reopened and appended to until rotateRetryInterval has
+// passed.
+func (r *RotatingFile) rotate() error {
+	// Windows does not rename open files.
+	cerr := r.f.Close()
+	r.f = nil
+	backup := r.path + "." + time.Now().Format(backupTimeFormat)
+	if err := rename(r.path, backup); err != nil {
+		opened := r.opened
+		if err := r.open(); err != nil {
+			return fmt.Errorf("error reopening log file after failing to rotate it: %v", err)
+		}
+		r.opened, r.retry = opened, time.Now().Add(rotateRetryInterval)
+		return nil
+	}
+	r.retry = time.Time{}
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := r.prune(); err != nil {
+		return err
+	}
+	return cerr
+}
+
+// backups returns the rotated files of the log file.
+func (r *RotatingFile) backups() ([]string, error) {
+	dir, prefix := filepath.Dir(r.path), filepath.Base(r.path)+"."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, suffix); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, e.Name()))
+	}
+	return backups, nil
+}
+
+// prune removes the oldest backups over MaxBackups and those older than
+// Retention.
+func (r *RotatingFile) prune() error {
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+	// The timestamp suffixes sort by time.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, b := range backups {
+		remove := i >= r.opts.MaxBackups
+		if !remove && r.opts.Retention > 0 {
+			fi, err := os.Stat(b)
+			remove = err == nil && time.Since(fi.ModTime()) > r.opts.Retention
+		}
+		if remove {
+			if err := os.Remove(b); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the log file, later writes fail.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
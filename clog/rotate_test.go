@@ -0,0 +1,129 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "osconfig.log")
+	r, err := NewRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error: %v", err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) error: %v", line, err)
+		}
+		// Backups are named by the time of the rotation.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "line 4\n" {
+		t.Errorf("got log file %q, %v, want %q", data, err, "line 4\n")
+	}
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got backups %q, want 2", backups)
+	}
+	for i, want := range []string{"line 2\n", "line 3\n"} {
+		data, err := os.ReadFile(backups[i])
+		if err != nil || string(data) != want {
+			t.Errorf("got backup %s %q, %v, want %q", backups[i], data, err, want)
+		}
+	}
+
+	r.Close()
+	if _, err := r.Write([]byte("closed\n")); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("Write after Close got %v, want closed error", err)
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osconfig.log")
+	r, err := NewRotatingFile(path, RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error: %v", err)
+	}
+	defer r.Close()
+
+	renames := 0
+	rename = func(string, string) error {
+		renames++
+		return os.ErrPermission
+	}
+	defer func() { rename = os.Rename }()
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) error: %v", line, err)
+		}
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "line 1\nline 2\nline 3\n" {
+		t.Errorf("got log file %q, %v, want all the lines", data, err)
+	}
+	// The rotation is not tried again before rotateRetryInterval.
+	if renames != 1 {
+		t.Errorf("got %d renames, want 1", renames)
+	}
+
+	rename = os.Rename
+	r.retry = time.Now()
+	if _, err := r.Write([]byte("line 4\n")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "line 4\n" {
+		t.Errorf("got log file %q, %v, want %q", data, err, "line 4\n")
+	}
+}
+
+func TestRotatingFilePruneKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "osconfig.log")
+	other := filepath.Join(dir, "osconfig.log.lock")
+	if err := os.WriteFile(other, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error: %v", err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) error: %v", line, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("%s was removed: %v", other, err)
+	}
+	backups, err := r.backups()
+	if err != nil || len(backups) != 1 {
+		t.Errorf("got backups %q, %v, want 1", backups, err)
+	}
+}
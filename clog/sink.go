@@ -0,0 +1,73 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+)
+
+// Sink receives the entries logged through clog with their severity, source
+// location and labels, unlike the logger.LogOpts.Writers which only receive
+// the formatted text.
+type Sink interface {
+	Send(e logger.LogEntry) error
+	Close() error
+}
+
+var (
+	sinks   []Sink
+	sinksMx sync.RWMutex
+)
+
+// AddSink sends all further entries logged through clog to s as well.
+func AddSink(s Sink) {
+	sinksMx.Lock()
+	defer sinksMx.Unlock()
+	sinks = append(sinks, s)
+}
+
+// CloseSinks closes and removes the sinks added with AddSink.
+func CloseSinks() {
+	sinksMx.Lock()
+	defer sinksMx.Unlock()
+	for _, s := range sinks {
+		s.Close()
+	}
+	sinks = nil
+}
+
+// sendToSinks sends e to the sinks, with the caller depth frames up as the
+// source.
+func sendToSinks(e logger.LogEntry, depth int) {
+	sinksMx.RLock()
+	defer sinksMx.RUnlock()
+	if len(sinks) == 0 || (e.Severity == logger.Debug && !DebugEnabled) {
+		return
+	}
+	e.LocalTimestamp = time.Now().Format("2006-01-02T15:04:05.000000Z07:00")
+	if pc, file, line, ok := runtime.Caller(depth + 1); ok {
+		e.Source = &logpb.LogEntrySourceLocation{File: filepath.Base(file), Line: int64(line), Function: runtime.FuncForPC(pc).Name()}
+	}
+	for _, s := range sinks {
+		// Like logger.Log, there is nowhere to report a failed write.
+		s.Send(e)
+	}
+}
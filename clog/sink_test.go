@@ -0,0 +1,95 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+)
+
+func TestFormatRFC5424(t *testing.T) {
+	e := logger.LogEntry{
+		Message:        "Running task.\n",
+		Severity:       logger.Warning,
+		Labels:         map[string]string{"task_name": `Apply "config" [1]`, "bad key": "v"},
+		Source:         &logpb.LogEntrySourceLocation{File: "tasker.go", Line: 42},
+		LocalTimestamp: "2024-01-02T03:04:05.000000Z",
+	}
+	want := `<28>1 2024-01-02T03:04:05.000000Z vm google_osconfig_agent 123 - [osconfig@11129 bad_key="v" source="tasker.go:42" task_name="Apply \"config\" [1\]"] Running task.`
+	if got := formatRFC5424(e, "vm", "google_osconfig_agent", 123); got != want {
+		t.Errorf("formatRFC5424() = %s, want %s", got, want)
+	}
+
+	want = `<30>1 - vm google_osconfig_agent 123 - - Done.`
+	if got := formatRFC5424(logger.LogEntry{Message: "Done.", Severity: logger.Info}, "vm", "google_osconfig_agent", 123); got != want {
+		t.Errorf("formatRFC5424() = %s, want %s", got, want)
+	}
+}
+
+func TestJournalMessage(t *testing.T) {
+	e := logger.LogEntry{
+		Message:  "line 1\nline 2",
+		Severity: logger.Error,
+		Labels:   map[string]string{"task-name": "patch"},
+		Source:   &logpb.LogEntrySourceLocation{File: "tasker.go", Line: 42, Function: "tasker.run"},
+	}
+	want := "MESSAGE\n\x0d\x00\x00\x00\x00\x00\x00\x00line 1\nline 2\n" +
+		"PRIORITY=3\nSYSLOG_FACILITY=3\nSYSLOG_IDENTIFIER=google_osconfig_agent\n" +
+		"CODE_FILE=tasker.go\nCODE_LINE=42\nCODE_FUNC=tasker.run\n" +
+		"OSCONFIG_TASK_NAME=patch\n"
+	if got := string(journalMessage(e, "google_osconfig_agent")); got != want {
+		t.Errorf("journalMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := NewSyslogSink("udp://"+pc.LocalAddr().String(), "google_osconfig_agent")
+	if err != nil {
+		t.Fatalf("NewSyslogSink() error: %v", err)
+	}
+	AddSink(s)
+	defer CloseSinks()
+
+	Infof(WithLabels(context.Background(), map[string]string{"task_name": "patch"}), "Patching %s.", "vm")
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("error reading syslog message: %v", err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"<30>1 ", " google_osconfig_agent ", `source="sink_test.go:`, `task_name="patch"`, "] Patching vm."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("syslog message %q does not contain %q", got, want)
+		}
+	}
+
+	if _, err := NewSyslogSink("ftp://host:21", "google_osconfig_agent"); err == nil {
+		t.Error("NewSyslogSink with an unsupported network got nil error")
+	}
+}
@@ -0,0 +1,194 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package clog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+)
+
+const (
+	// syslogFacility is the daemon facility.
+	syslogFacility = 3
+	// syslogSDID is the structured data ID of the labels, with the Google
+	// private enterprise number.
+	syslogSDID = "osconfig@11129"
+)
+
+// localSyslogSockets are tried in order when no address is given.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSeverity maps the logger severities to syslog severities.
+var syslogSeverity = map[logger.Severity]int{
+	logger.Debug:    7,
+	logger.Info:     6,
+	logger.Warning:  4,
+	logger.Error:    3,
+	logger.Critical: 2,
+}
+
+// SyslogSink is a Sink sending RFC 5424 messages to a syslog server, with
+// the labels and source location as structured data.
+type SyslogSink struct {
+	network, addr string
+	appName       string
+	hostname      string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink connects to the syslog server at address, either
+// "udp://host:port", "tcp://host:port", "unix:///path" or empty for the
+// local syslog socket. Messages are tagged with appName.
+func NewSyslogSink(address, appName string) (*SyslogSink, error) {
+	s := &SyslogSink{appName: appName, hostname: "-"}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		s.hostname = h
+	}
+	if address != "" {
+		network, addr, ok := strings.Cut(address, "://")
+		if !ok {
+			return nil, fmt.Errorf("syslog address %q is not of the form network://address", address)
+		}
+		switch network {
+		case "udp", "tcp", "unix", "unixgram":
+		default:
+			return nil, fmt.Errorf("unsupported syslog network %q", network)
+		}
+		s.network, s.addr = network, addr
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SyslogSink) connect() error {
+	if s.network != "" {
+		conn, err := net.Dial(s.network, s.addr)
+		if err != nil {
+			return fmt.Errorf("error connecting to syslog at %s://%s: %v", s.network, s.addr, err)
+		}
+		s.conn = conn
+		return nil
+	}
+	for _, path := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				s.network, s.addr, s.conn = network, path, conn
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no local syslog socket found in %q", localSyslogSockets)
+}
+
+// Send writes e to the syslog server, reconnecting once if the write fails.
+func (s *SyslogSink) Send(e logger.LogEntry) error {
+	msg := formatRFC5424(e, s.hostname, s.appName, os.Getpid())
+	if s.network == "tcp" || s.network == "unix" {
+		// Octet counting framing of RFC 6587 for stream transports.
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+// Close closes the connection to the syslog server.
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// formatRFC5424 formats e as a RFC 5424 syslog message.
+func formatRFC5424(e logger.LogEntry, hostname, appName string, pid int) string {
+	sev, ok := syslogSeverity[e.Severity]
+	if !ok {
+		sev = 5
+	}
+	timestamp := e.LocalTimestamp
+	if timestamp == "" {
+		timestamp = "-"
+	}
+
+	params := map[string]string{}
+	for k, v := range e.Labels {
+		params[k] = v
+	}
+	if e.Source != nil {
+		params["source"] = fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line)
+	}
+	sd := "-"
+	if len(params) > 0 {
+		var keys []string
+		for k := range params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		b.WriteString("[" + syslogSDID)
+		for _, k := range keys {
+			fmt.Fprintf(&b, " %s=\"%s\"", syslogParamName(k), syslogParamEscaper.Replace(params[k]))
+		}
+		b.WriteString("]")
+		sd = b.String()
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", syslogFacility*8+sev, timestamp, hostname, appName, pid, sd, strings.TrimSpace(e.Message))
+}
+
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogParamName replaces the characters not allowed in a PARAM-NAME and
+// truncates it to 32 characters.
+func syslogParamName(k string) string {
+	name := []byte(k)
+	for i, c := range name {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return string(name)
+}
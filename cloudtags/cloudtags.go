@@ -0,0 +1,248 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package cloudtags reads the tags of the instance from the metadata server
+// of the cloud it runs on, so reports can be grouped by cloud-side
+// ownership metadata.
+package cloudtags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+// Provider is a cloud whose instance tags can be read.
+type Provider string
+
+// Supported providers.
+const (
+	// GCE reports the network tags of the instance, GCE labels are not
+	// available from the metadata server. Each tag is reported with the
+	// value "true".
+	GCE Provider = "gce"
+	// AWS reports the EC2 instance tags, which requires the instance
+	// metadata option "Allow tags in instance metadata".
+	AWS Provider = "aws"
+	// Azure reports the tags of the virtual machine.
+	Azure Provider = "azure"
+)
+
+var (
+	awsMetadataURL   = "http://169.254.169.254/latest"
+	azureMetadataURL = "http://169.254.169.254/metadata"
+	gceMetadataURL   = func() string { return "http://" + agentconfig.MetadataHost() + "/computeMetadata/v1" }
+
+	client = &http.Client{Timeout: 5 * time.Second}
+
+	current   map[string]string
+	currentMx sync.RWMutex
+)
+
+// ParseProviders parses a comma separated list of providers, e.g.
+// "gce,aws".
+func ParseProviders(s string) ([]Provider, error) {
+	var providers []Provider
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch Provider(p) {
+		case "":
+		case GCE, AWS, Azure:
+			providers = append(providers, Provider(p))
+		default:
+			return nil, fmt.Errorf("unknown cloud tag provider %q", p)
+		}
+	}
+	return providers, nil
+}
+
+func get(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	return do(ctx, http.MethodGet, url, header)
+}
+
+func do(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got http status %d from %s", resp.StatusCode, url)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func gceTags(ctx context.Context) (map[string]string, error) {
+	data, err := get(ctx, gceMetadataURL()+"/instance/tags", http.Header{"Metadata-Flavor": {"Google"}})
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("error parsing GCE tags: %v", err)
+	}
+	m := map[string]string{}
+	for _, t := range tags {
+		m[t] = "true"
+	}
+	return m, nil
+}
+
+func awsTags(ctx context.Context) (map[string]string, error) {
+	// IMDSv2 requires a session token.
+	token, err := do(ctx, http.MethodPut, awsMetadataURL+"/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return nil, fmt.Errorf("error getting IMDSv2 token: %v", err)
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	data, err := get(ctx, awsMetadataURL+"/meta-data/tags/instance", header)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	for _, key := range strings.Fields(string(data)) {
+		value, err := get(ctx, awsMetadataURL+"/meta-data/tags/instance/"+key, header)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = string(value)
+	}
+	return m, nil
+}
+
+func azureTags(ctx context.Context) (map[string]string, error) {
+	data, err := get(ctx, azureMetadataURL+"/instance/compute/tagsList?api-version=2021-02-01", http.Header{"Metadata": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	var tags []struct{ Name, Value string }
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("error parsing Azure tags: %v", err)
+	}
+	m := map[string]string{}
+	for _, t := range tags {
+		m[t.Name] = t.Value
+	}
+	return m, nil
+}
+
+// Fetch reads the tags of the instance from the given providers. The keys
+// are prefixed with the provider, e.g. "aws/Owner". Providers that fail
+// are skipped, their errors are returned together with the tags of the
+// others.
+func Fetch(ctx context.Context, providers []Provider) (map[string]string, error) {
+	tags := map[string]string{}
+	var errs []string
+	for _, p := range providers {
+		var m map[string]string
+		var err error
+		switch p {
+		case GCE:
+			m, err = gceTags(ctx)
+		case AWS:
+			m, err = awsTags(ctx)
+		case Azure:
+			m, err = azureTags(ctx)
+		default:
+			err = fmt.Errorf("unknown provider")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p, err))
+			continue
+		}
+		for k, v := range m {
+			tags[string(p)+"/"+k] = v
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return tags, fmt.Errorf("error reading cloud tags: %s", strings.Join(errs, "; "))
+	}
+	return tags, nil
+}
+
+// Refresh reads the tags from the providers in the comma separated list
+// providers and replaces the ones returned by Current. An empty list clears
+// them.
+func Refresh(ctx context.Context, providers string) {
+	ps, err := ParseProviders(providers)
+	if err != nil {
+		clog.Errorf(ctx, "Invalid cloud tag setting: %v", err)
+		return
+	}
+	tags, err := Fetch(ctx, ps)
+	if err != nil {
+		clog.Errorf(ctx, "%v", err)
+	}
+	currentMx.Lock()
+	defer currentMx.Unlock()
+	current = tags
+}
+
+// Watch calls Refresh every interval with the current providers setting
+// until ctx is done.
+func Watch(ctx context.Context, interval time.Duration, providers func() string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Refresh(ctx, providers())
+		}
+	}
+}
+
+// Current returns a copy of the tags read by the last Refresh.
+func Current() map[string]string {
+	currentMx.RLock()
+	defer currentMx.RUnlock()
+	if len(current) == 0 {
+		return nil
+	}
+	tags := make(map[string]string, len(current))
+	for k, v := range current {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Labels returns the current tags as log labels, keys prefixed with
+// "cloud_tag/".
+func Labels() map[string]string {
+	tags := Current()
+	if tags == nil {
+		return nil
+	}
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		labels["cloud_tag/"+k] = v
+	}
+	return labels
+}
@@ -0,0 +1,89 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package cloudtags
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseProviders(t *testing.T) {
+	got, err := ParseProviders(" GCE, aws ,,azure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]Provider{GCE, AWS, Azure}, got); diff != "" {
+		t.Errorf("ParseProviders() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := ParseProviders("gce,openstack"); err == nil {
+		t.Error("did not get expected error for unknown provider")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/tags" && r.Header.Get("Metadata-Flavor") == "Google":
+			w.Write([]byte(`["http-server","prod"]`))
+		case r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			w.Write([]byte("token"))
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != "token" && r.URL.Path != "/metadata/instance/compute/tagsList":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/tags/instance":
+			w.Write([]byte("Owner\nTeam"))
+		case r.URL.Path == "/latest/meta-data/tags/instance/Owner":
+			w.Write([]byte("alice"))
+		case r.URL.Path == "/latest/meta-data/tags/instance/Team":
+			w.Write([]byte("infra"))
+		case r.URL.Path == "/metadata/instance/compute/tagsList" && r.Header.Get("Metadata") == "true":
+			w.Write([]byte(`[{"name":"env","value":"dev"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	gceMetadataURL = func() string { return ts.URL + "/computeMetadata/v1" }
+	awsMetadataURL = ts.URL + "/latest"
+	azureMetadataURL = ts.URL + "/metadata"
+
+	got, err := Fetch(context.Background(), []Provider{GCE, AWS, Azure})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"gce/http-server": "true",
+		"gce/prod":        "true",
+		"aws/Owner":       "alice",
+		"aws/Team":        "infra",
+		"azure/env":       "dev",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Fetch() mismatch (-want +got):\n%s", diff)
+	}
+
+	// A failing provider doesn't drop the tags of the others.
+	azureMetadataURL = ts.URL + "/missing"
+	got, err = Fetch(context.Background(), []Provider{GCE, Azure})
+	if err == nil {
+		t.Error("did not get expected error")
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d tags, want the 2 GCE tags: %v", len(got), got)
+	}
+}
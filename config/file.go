@@ -20,7 +20,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 
 	"cloud.google.com/go/storage"
@@ -55,7 +54,7 @@ func downloadFile(ctx context.Context, path string, perms os.FileMode, file *age
 		}
 
 	case *agentendpointpb.OSPolicy_Resource_File_Remote_:
-		reader, err = external.FetchRemoteObjectHTTP(ctx, &http.Client{}, file.GetRemote().GetUri())
+		reader, err = external.FetchRemoteObjectHTTP(ctx, external.HTTPClient(ctx), file.GetRemote().GetUri())
 		if err != nil {
 			return "", err
 		}
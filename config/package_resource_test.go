@@ -243,8 +243,14 @@ func TestPackageResourceValidate(t *testing.T) {
 			[]byte("foo x86_64 1.2.3-4"),
 		},
 	}
+	defer func(f string) { packageInfoCacheFile, packageInfoCacheStore = f, nil }(packageInfoCacheFile)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// The cases share tmpFile, don't let one find the package info
+			// cached by another.
+			packageInfoCacheFile = filepath.Join(t.TempDir(), "package_info.cache")
+			packageInfoCacheStore = nil
+
 			pr := &OSPolicyResource{
 				OSPolicy_Resource: &agentendpointpb.OSPolicy_Resource{
 					ResourceType: &agentendpointpb.OSPolicy_Resource_Pkg{Pkg: tt.prpb},
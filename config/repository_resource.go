@@ -21,12 +21,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/external"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
 	"github.com/GoogleCloudPlatform/osconfig/util"
 	"golang.org/x/crypto/openpgp"
@@ -93,7 +93,7 @@ func aptRepoContents(repo *agentendpointpb.OSPolicy_Resource_RepositoryResource_
 	if !ok {
 		archiveType = "deb"
 	}
-	line := fmt.Sprintf("%s %s %s", archiveType, repo.GetUri(), repo.GetDistribution())
+	line := fmt.Sprintf("%s %s %s", archiveType, agentconfig.MirrorURL(repo.GetUri()), repo.GetDistribution())
 	for _, c := range repo.GetComponents() {
 		line = fmt.Sprintf("%s %s", line, c)
 	}
@@ -111,7 +111,7 @@ func googetRepoContents(repo *agentendpointpb.OSPolicy_Resource_RepositoryResour
 	var buf bytes.Buffer
 	buf.WriteString("# Repo file managed by Google OSConfig agent\n")
 	buf.WriteString(fmt.Sprintf("- name: %s\n", repo.Name))
-	buf.WriteString(fmt.Sprintf("  url: %s\n", repo.Url))
+	buf.WriteString(fmt.Sprintf("  url: %s\n", agentconfig.MirrorURL(repo.Url)))
 
 	return buf.Bytes()
 }
@@ -135,12 +135,12 @@ func yumRepoContents(repo *agentendpointpb.OSPolicy_Resource_RepositoryResource_
 	} else {
 		buf.WriteString(fmt.Sprintf("name=%s\n", repo.DisplayName))
 	}
-	buf.WriteString(fmt.Sprintf("baseurl=%s\n", repo.BaseUrl))
+	buf.WriteString(fmt.Sprintf("baseurl=%s\n", agentconfig.MirrorURL(repo.BaseUrl)))
 	buf.WriteString("enabled=1\ngpgcheck=1\n")
 	if len(repo.GpgKeys) > 0 {
-		buf.WriteString(fmt.Sprintf("gpgkey=%s\n", repo.GpgKeys[0]))
+		buf.WriteString(fmt.Sprintf("gpgkey=%s\n", agentconfig.MirrorURL(repo.GpgKeys[0])))
 		for _, k := range repo.GpgKeys[1:] {
-			buf.WriteString(fmt.Sprintf("       %s\n", k))
+			buf.WriteString(fmt.Sprintf("       %s\n", agentconfig.MirrorURL(k)))
 		}
 	}
 	return buf.Bytes()
@@ -164,12 +164,12 @@ func zypperRepoContents(repo *agentendpointpb.OSPolicy_Resource_RepositoryResour
 	} else {
 		buf.WriteString(fmt.Sprintf("name=%s\n", repo.DisplayName))
 	}
-	buf.WriteString(fmt.Sprintf("baseurl=%s\n", repo.BaseUrl))
+	buf.WriteString(fmt.Sprintf("baseurl=%s\n", agentconfig.MirrorURL(repo.BaseUrl)))
 	buf.WriteString("enabled=1\n")
 	if len(repo.GpgKeys) > 0 {
-		buf.WriteString(fmt.Sprintf("gpgkey=%s\n", repo.GpgKeys[0]))
+		buf.WriteString(fmt.Sprintf("gpgkey=%s\n", agentconfig.MirrorURL(repo.GpgKeys[0])))
 		for _, k := range repo.GpgKeys[1:] {
-			buf.WriteString(fmt.Sprintf("       %s\n", k))
+			buf.WriteString(fmt.Sprintf("       %s\n", agentconfig.MirrorURL(k)))
 		}
 	}
 	return buf.Bytes()
@@ -198,8 +198,8 @@ func isArmoredGPGKey(keyData []byte) bool {
 	return false
 }
 
-func fetchGPGKey(key string) (openpgp.EntityList, error) {
-	resp, err := http.Get(key)
+func fetchGPGKey(ctx context.Context, key string) (openpgp.EntityList, error) {
+	resp, err := external.HTTPClient(ctx).Get(key)
 	if err != nil {
 		return nil, err
 	}
@@ -233,7 +233,7 @@ func (r *repositoryResource) validate(ctx context.Context) (*ManagedResources, e
 		r.managedRepository.RepoFileContents = aptRepoContents(r.GetApt())
 		repoFormat = agentconfig.AptRepoFormat()
 		if gpgkey != "" {
-			entityList, err := fetchGPGKey(gpgkey)
+			entityList, err := fetchGPGKey(ctx, gpgkey)
 			if err != nil {
 				return nil, fmt.Errorf("error fetching apt gpg key %q: %v", gpgkey, err)
 			}
@@ -282,7 +282,7 @@ func TestRepositoryResourceEnforceState(t *testing.T) {
 func TestFetchGPGKey(t *testing.T) {
 	key := "https://packages.cloud.google.com/apt/doc/apt-key.gpg"
 
-	entityList, err := fetchGPGKey(key)
+	entityList, err := fetchGPGKey(context.Background(), key)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,103 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package control
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client calls the control API of an agent.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial connects to the control API served on the unix socket path.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	conn, err := grpc.DialContext(ctx, "unix://"+path,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp any) error {
+	return c.conn.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp)
+}
+
+// RefreshInventory queues an inventory report.
+func (c *Client) RefreshInventory(ctx context.Context, req *RefreshInventoryRequest) (*RefreshInventoryResponse, error) {
+	resp := &RefreshInventoryResponse{}
+	return resp, c.invoke(ctx, "RefreshInventory", req, resp)
+}
+
+// Patch queues a patch run.
+func (c *Client) Patch(ctx context.Context, req *PatchRequest) (*PatchResponse, error) {
+	resp := &PatchResponse{}
+	return resp, c.invoke(ctx, "Patch", req, resp)
+}
+
+// TaskStatus returns the task queue of the agent and the patch runs.
+func (c *Client) TaskStatus(ctx context.Context, req *TaskStatusRequest) (*TaskStatusResponse, error) {
+	resp := &TaskStatusResponse{}
+	return resp, c.invoke(ctx, "TaskStatus", req, resp)
+}
+
+// Pause pauses a subsystem of the agent.
+func (c *Client) Pause(ctx context.Context, req *PauseRequest) (*PauseResponse, error) {
+	resp := &PauseResponse{}
+	return resp, c.invoke(ctx, "Pause", req, resp)
+}
+
+// Resume resumes a paused subsystem of the agent.
+func (c *Client) Resume(ctx context.Context, req *ResumeRequest) (*ResumeResponse, error) {
+	resp := &ResumeResponse{}
+	return resp, c.invoke(ctx, "Resume", req, resp)
+}
+
+// StreamPatchProgress calls f with the events of a patch run until the run
+// is done.
+func (c *Client) StreamPatchProgress(ctx context.Context, req *StreamPatchProgressRequest, f func(*PatchEvent)) error {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+ServiceName+"/StreamPatchProgress")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		e := &PatchEvent{}
+		if err := stream.RecvMsg(e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		f(e)
+	}
+}
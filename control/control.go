@@ -0,0 +1,286 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package control serves the control API of the agent, a gRPC service on a
+// unix socket orchestration tools use to report the inventory, run patches
+// and follow their progress on demand instead of waiting for the schedule of
+// the agent, and to pause its subsystems.
+//
+// The messages are the JSON encoded types of this package rather than
+// protocol buffers, Dial returns a client using the same encoding.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+
+	apiv1 "github.com/GoogleCloudPlatform/osconfig/api/v1"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "osconfig.agent.control.v1.Control"
+
+// PatchState is the state of a patch run started with the Patch RPC.
+type PatchState string
+
+// The PatchStates, a run is done once it succeeded or failed.
+const (
+	PatchPending   PatchState = "pending"
+	PatchRunning   PatchState = "running"
+	PatchSucceeded PatchState = "succeeded"
+	PatchFailed    PatchState = "failed"
+)
+
+func (s PatchState) done() bool {
+	return s == PatchSucceeded || s == PatchFailed
+}
+
+// RefreshInventoryRequest is the request of the RefreshInventory RPC.
+type RefreshInventoryRequest struct{}
+
+// RefreshInventoryResponse is the response of the RefreshInventory RPC.
+type RefreshInventoryResponse struct {
+	// Task is the name of the queued inventory task.
+	Task string `json:"task"`
+}
+
+// PatchRequest is the request of the Patch RPC, the options of the run.
+type PatchRequest struct {
+	DryRun bool `json:"dryRun,omitempty"`
+	// Excludes are the packages not to update, see ospatch.ParseExclude for
+	// the format. On Windows they are KB IDs.
+	Excludes []string `json:"excludes,omitempty"`
+	// ExclusivePackages, if set, are the only packages updated. On Windows
+	// they are KB IDs, with zypper patch names.
+	ExclusivePackages []string `json:"exclusivePackages,omitempty"`
+	// Security only installs security updates with yum and dnf.
+	Security bool `json:"security,omitempty"`
+	// Minimal only installs the minimal versions fixing the advisories with
+	// yum and dnf.
+	Minimal bool `json:"minimal,omitempty"`
+	// Reboot is one of the Reboot constants, empty for RebootDefault.
+	Reboot string `json:"reboot,omitempty"`
+}
+
+// When a patch run reboots the system.
+const (
+	// RebootDefault reboots before and after patching if the system reports
+	// a reboot is required.
+	RebootDefault = "default"
+	// RebootAlways reboots after patching.
+	RebootAlways = "always"
+	// RebootNever does not reboot.
+	RebootNever = "never"
+)
+
+var rebootConfigs = map[string]agentendpointpb.PatchConfig_RebootConfig{
+	"":            agentendpointpb.PatchConfig_DEFAULT,
+	RebootDefault: agentendpointpb.PatchConfig_DEFAULT,
+	RebootAlways:  agentendpointpb.PatchConfig_ALWAYS,
+	RebootNever:   agentendpointpb.PatchConfig_NEVER,
+}
+
+// applyPatchesTask returns the patch task of the service with the options
+// of r, the package managers not supporting an option ignore it.
+func (r *PatchRequest) applyPatchesTask() *agentendpointpb.ApplyPatchesTask {
+	return &agentendpointpb.ApplyPatchesTask{
+		DryRun: r.DryRun,
+		PatchConfig: &agentendpointpb.PatchConfig{
+			RebootConfig: rebootConfigs[r.Reboot],
+			Apt: &agentendpointpb.AptSettings{
+				Excludes:          r.Excludes,
+				ExclusivePackages: r.ExclusivePackages,
+			},
+			Yum: &agentendpointpb.YumSettings{
+				Security:          r.Security,
+				Minimal:           r.Minimal,
+				Excludes:          r.Excludes,
+				ExclusivePackages: r.ExclusivePackages,
+			},
+			Zypper: &agentendpointpb.ZypperSettings{
+				Excludes:         r.Excludes,
+				ExclusivePatches: r.ExclusivePackages,
+			},
+			WindowsUpdate: &agentendpointpb.WindowsUpdateSettings{
+				Excludes:         r.Excludes,
+				ExclusivePatches: r.ExclusivePackages,
+			},
+		},
+	}
+}
+
+// PatchResponse is the response of the Patch RPC.
+type PatchResponse struct {
+	// ID identifies the run in TaskStatus and StreamPatchProgress.
+	ID string `json:"id"`
+}
+
+// TaskStatusRequest is the request of the TaskStatus RPC.
+type TaskStatusRequest struct{}
+
+// PatchRun is a patch run started with the Patch RPC.
+type PatchRun struct {
+	ID      string        `json:"id"`
+	Request *PatchRequest `json:"request"`
+	State   PatchState    `json:"state"`
+	Start   time.Time     `json:"start,omitempty"`
+	End     time.Time     `json:"end,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	// Results are the results of each package manager that ran.
+	Results []*apiv1.PatchResult `json:"results,omitempty"`
+}
+
+// TaskStatusResponse is the response of the TaskStatus RPC.
+type TaskStatusResponse struct {
+	// Tasks are the running and queued tasks of the agent.
+	Tasks *tasker.QueueStatus `json:"tasks"`
+	// Patches are the patch runs started with the Patch RPC, oldest first.
+	Patches []*PatchRun `json:"patches,omitempty"`
+}
+
+// StreamPatchProgressRequest is the request of the StreamPatchProgress RPC.
+type StreamPatchProgressRequest struct {
+	ID string `json:"id"`
+}
+
+// PatchEvent is streamed by the StreamPatchProgress RPC. Events with a
+// Phase report progress, see ospatch.Progress, the others a change of
+// State. The last event of a run has the final state and its Results.
+type PatchEvent struct {
+	ID      string               `json:"id"`
+	Time    time.Time            `json:"time"`
+	State   PatchState           `json:"state"`
+	Phase   string               `json:"phase,omitempty"`
+	Action  string               `json:"action,omitempty"`
+	Package string               `json:"package,omitempty"`
+	Current int                  `json:"current,omitempty"`
+	Total   int                  `json:"total,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Results []*apiv1.PatchResult `json:"results,omitempty"`
+}
+
+// PauseRequest is the request of the Pause RPC.
+type PauseRequest struct {
+	// Subsystem is one of agentconfig.Subsystems.
+	Subsystem string `json:"subsystem"`
+	// Duration is how long the subsystem stays paused, like "2h", until it
+	// is resumed if empty.
+	Duration string `json:"duration,omitempty"`
+}
+
+// PauseResponse is the response of the Pause RPC.
+type PauseResponse struct {
+	// Until is when the pause ends, zero if it lasts until resumed.
+	Until time.Time `json:"until,omitempty"`
+	// Message describes the pause.
+	Message string `json:"message"`
+}
+
+// ResumeRequest is the request of the Resume RPC.
+type ResumeRequest struct {
+	Subsystem string `json:"subsystem"`
+}
+
+// ResumeResponse is the response of the Resume RPC.
+type ResumeResponse struct{}
+
+// codec encodes the messages as JSON, the API has no protocol buffer
+// definitions.
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
+
+func unaryHandler[Req any](method string, call func(*Server, context.Context, *Req) (any, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			return call(srv.(*Server), ctx, req.(*Req))
+		}
+		if interceptor == nil {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}, handler)
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RefreshInventory",
+			Handler: unaryHandler("RefreshInventory", func(s *Server, ctx context.Context, req *RefreshInventoryRequest) (any, error) {
+				return s.RefreshInventory(ctx, req)
+			}),
+		},
+		{
+			MethodName: "Patch",
+			Handler: unaryHandler("Patch", func(s *Server, ctx context.Context, req *PatchRequest) (any, error) {
+				return s.Patch(ctx, req)
+			}),
+		},
+		{
+			MethodName: "TaskStatus",
+			Handler: unaryHandler("TaskStatus", func(s *Server, ctx context.Context, req *TaskStatusRequest) (any, error) {
+				return s.TaskStatus(ctx, req)
+			}),
+		},
+		{
+			MethodName: "Pause",
+			Handler: unaryHandler("Pause", func(s *Server, ctx context.Context, req *PauseRequest) (any, error) {
+				return s.Pause(ctx, req)
+			}),
+		},
+		{
+			MethodName: "Resume",
+			Handler: unaryHandler("Resume", func(s *Server, ctx context.Context, req *ResumeRequest) (any, error) {
+				return s.Resume(ctx, req)
+			}),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPatchProgress",
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				req := &StreamPatchProgressRequest{}
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*Server).StreamPatchProgress(stream.Context(), req, func(e *PatchEvent) error {
+					return stream.SendMsg(e)
+				})
+			},
+		},
+	},
+}
@@ -0,0 +1,387 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/agentendpoint"
+	apiv1 "github.com/GoogleCloudPlatform/osconfig/api/v1"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+)
+
+const (
+	// inventoryTask is the name of the inventory task of the agent, so a
+	// refresh coalesces with a scheduled report that is still queued.
+	inventoryTask = "Report OSInventory"
+	// InventoryKind and PatchKind are the kinds of the persistent tasks
+	// queued by the Server, see RegisterTasks.
+	InventoryKind = "inventory"
+	PatchKind     = "control-patch"
+	// maxPatchRuns is the number of patch runs kept for TaskStatus and
+	// StreamPatchProgress.
+	maxPatchRuns = 20
+)
+
+var (
+	paused       = agentconfig.Paused
+	pausedUntil  = agentconfig.PausedUntil
+	pauseMessage = agentconfig.PauseMessage
+	pause        = agentconfig.Pause
+	resume       = agentconfig.Resume
+	now          = time.Now
+
+	// runPatchTask runs a patch like a patch task of the service, returning
+	// the result of each package manager run.
+	runPatchTask = agentendpoint.RunLocalPatch
+)
+
+type patchRun struct {
+	run    PatchRun
+	events []*PatchEvent
+	// changed is closed and replaced when an event is added.
+	changed chan struct{}
+}
+
+// Server implements the control API, see Serve.
+type Server struct {
+	// ctx is the context the tasks started by the RPCs run with, the
+	// context of an RPC ends with the RPC.
+	ctx             context.Context
+	reportInventory func(context.Context)
+
+	mu      sync.Mutex
+	runs    []*patchRun
+	counter int
+}
+
+// NewServer returns a Server running the tasks it starts with ctx,
+// reportInventory reports the inventory like the inventory task of the
+// agent.
+func NewServer(ctx context.Context, reportInventory func(context.Context)) *Server {
+	return &Server{ctx: ctx, reportInventory: reportInventory}
+}
+
+func enqueueError(err error) error {
+	if err == tasker.ErrQueueFull {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// RefreshInventory queues an inventory report, it fails with
+// ResourceExhausted if the task queue is full.
+func (s *Server) RefreshInventory(ctx context.Context, req *RefreshInventoryRequest) (*RefreshInventoryResponse, error) {
+	if paused(agentconfig.SubsystemInventory) {
+		return nil, status.Error(codes.FailedPrecondition, pauseMessage(agentconfig.SubsystemInventory))
+	}
+	clog.Infof(ctx, "Inventory report requested on the control API.")
+	if err := tasker.TryEnqueue(s.ctx, inventoryTask, s.reportInventory, tasker.Coalesce(), tasker.Persistent(InventoryKind, nil)); err != nil {
+		return nil, enqueueError(err)
+	}
+	return &RefreshInventoryResponse{Task: inventoryTask}, nil
+}
+
+func validatePatch(req *PatchRequest) error {
+	if paused(agentconfig.SubsystemPatching) {
+		return status.Error(codes.FailedPrecondition, pauseMessage(agentconfig.SubsystemPatching))
+	}
+	for _, e := range req.Excludes {
+		if _, err := ospatch.ParseExclude(e); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if _, ok := rebootConfigs[req.Reboot]; !ok {
+		return status.Errorf(codes.InvalidArgument, "reboot must be %s, %s or %s, got %q", RebootDefault, RebootAlways, RebootNever, req.Reboot)
+	}
+	return nil
+}
+
+// newRun records a pending patch run of req.
+func (s *Server) newRun(req *PatchRequest) *patchRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter++
+	r := &patchRun{
+		run:     PatchRun{ID: fmt.Sprintf("patch-%d", s.counter), Request: req, State: PatchPending},
+		changed: make(chan struct{}),
+	}
+	s.runs = append(s.runs, r)
+	if len(s.runs) > maxPatchRuns {
+		s.runs = s.runs[len(s.runs)-maxPatchRuns:]
+	}
+	s.addEvent(r, &PatchEvent{})
+	return r
+}
+
+// Patch queues a patch run with the options of req, it fails with
+// ResourceExhausted if the task queue is full.
+func (s *Server) Patch(ctx context.Context, req *PatchRequest) (*PatchResponse, error) {
+	if err := validatePatch(req); err != nil {
+		return nil, err
+	}
+	r := s.newRun(req)
+	clog.Infof(ctx, "Patch run %s requested on the control API.", r.run.ID)
+	if err := tasker.TryEnqueue(s.ctx, agentendpoint.PatchTaskName, func(ctx context.Context) { s.runPatch(ctx, r) }, tasker.Persistent(PatchKind, req)); err != nil {
+		s.finish(r, nil, err)
+		return nil, enqueueError(err)
+	}
+	return &PatchResponse{ID: r.run.ID}, nil
+}
+
+// RegisterTasks registers the kinds of the persistent tasks queued by s, so
+// the inventory reports and patch runs queued when the agent stopped are
+// queued again by tasker.Restore. A restored patch run gets a new ID.
+func (s *Server) RegisterTasks() {
+	tasker.RegisterKind(InventoryKind, func(context.Context, json.RawMessage) (func(context.Context), error) {
+		return s.reportInventory, nil
+	})
+	tasker.RegisterKind(PatchKind, func(ctx context.Context, data json.RawMessage) (func(context.Context), error) {
+		req := &PatchRequest{}
+		if err := json.Unmarshal(data, req); err != nil {
+			return nil, err
+		}
+		if err := validatePatch(req); err != nil {
+			return nil, err
+		}
+		r := s.newRun(req)
+		return func(ctx context.Context) { s.runPatch(ctx, r) }, nil
+	})
+}
+
+// RunPatch runs a patch with the options of req in the calling task, which
+// must be a tasker task, and returns its outcome. The patch runs like a
+// patch task of the service, see agentendpoint.RunLocalPatch. The run is recorded like
+// the ones queued with Patch, so it can be followed on the control API.
+func (s *Server) RunPatch(ctx context.Context, req *PatchRequest) (*PatchRun, error) {
+	if err := validatePatch(req); err != nil {
+		return nil, err
+	}
+	r := s.newRun(req)
+	err := s.runPatch(ctx, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := r.run
+	return &run, err
+}
+
+// addEvent records e, setting its ID, Time and State from the run. s.mu
+// must be held.
+func (s *Server) addEvent(r *patchRun, e *PatchEvent) {
+	e.ID, e.Time, e.State = r.run.ID, now(), r.run.State
+	r.events = append(r.events, e)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (s *Server) runPatch(ctx context.Context, r *patchRun) error {
+	s.mu.Lock()
+	r.run.State, r.run.Start = PatchRunning, now()
+	s.addEvent(r, &PatchEvent{})
+	s.mu.Unlock()
+
+	// The ID of the run is reused once the agent restarts, the task ID must
+	// not be as it identifies the checkpoints.
+	taskID := fmt.Sprintf("control-%s-%d", r.run.ID, r.run.Start.UnixNano())
+	results, err := runPatchTask(ctx, taskID, r.run.Request.applyPatchesTask(), func(p ospatch.Progress) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.addEvent(r, &PatchEvent{Phase: string(p.Phase), Action: p.Action, Package: p.Package, Current: p.Current, Total: p.Total})
+	})
+	if err != nil {
+		clog.Errorf(ctx, "Patch run %s failed: %v", r.run.ID, err)
+	}
+	s.finish(r, results, err)
+	return err
+}
+
+func (s *Server) finish(r *patchRun, results []*ospatch.PatchResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.run.State, r.run.End = PatchSucceeded, now()
+	if err != nil {
+		r.run.State, r.run.Error = PatchFailed, err.Error()
+	}
+	for _, res := range results {
+		r.run.Results = append(r.run.Results, apiv1.FromPatchResult(res))
+	}
+	s.addEvent(r, &PatchEvent{Error: r.run.Error, Results: r.run.Results})
+}
+
+// TaskStatus returns the task queue of the agent and the patch runs.
+func (s *Server) TaskStatus(ctx context.Context, req *TaskStatusRequest) (*TaskStatusResponse, error) {
+	resp := &TaskStatusResponse{Tasks: tasker.Status()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		run := r.run
+		resp.Patches = append(resp.Patches, &run)
+	}
+	return resp, nil
+}
+
+func validSubsystem(subsystem string) error {
+	for _, s := range agentconfig.Subsystems {
+		if s == subsystem {
+			return nil
+		}
+	}
+	return status.Errorf(codes.InvalidArgument, "unknown subsystem %q, valid subsystems are %q", subsystem, agentconfig.Subsystems)
+}
+
+// Pause pauses a subsystem, the pause is persisted like one made with the
+// pause command of the agent.
+func (s *Server) Pause(ctx context.Context, req *PauseRequest) (*PauseResponse, error) {
+	if err := validSubsystem(req.Subsystem); err != nil {
+		return nil, err
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid pause duration %q", req.Duration)
+		}
+	}
+	if err := pause(req.Subsystem, d); err != nil {
+		if errors.Is(err, agentconfig.ErrNegativePause) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	msg := pauseMessage(req.Subsystem)
+	clog.Infof(ctx, "Paused on the control API: %s.", msg)
+	until, _ := pausedUntil(req.Subsystem)
+	return &PauseResponse{Until: until, Message: msg}, nil
+}
+
+// Resume resumes a paused subsystem, resuming one that is not paused is not
+// an error.
+func (s *Server) Resume(ctx context.Context, req *ResumeRequest) (*ResumeResponse, error) {
+	if err := validSubsystem(req.Subsystem); err != nil {
+		return nil, err
+	}
+	if err := resume(req.Subsystem); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	clog.Infof(ctx, "Resumed %s on the control API.", req.Subsystem)
+	return &ResumeResponse{}, nil
+}
+
+func (s *Server) patchRun(id string) *patchRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		if r.run.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// StreamPatchProgress calls send with the events of a patch run, starting
+// with the ones already recorded, until the run is done.
+func (s *Server) StreamPatchProgress(ctx context.Context, req *StreamPatchProgressRequest, send func(*PatchEvent) error) error {
+	r := s.patchRun(req.ID)
+	if r == nil {
+		return status.Errorf(codes.NotFound, "no patch run %q", req.ID)
+	}
+	for i := 0; ; {
+		s.mu.Lock()
+		events, done, changed := r.events[i:], r.run.State.done(), r.changed
+		s.mu.Unlock()
+
+		for _, e := range events {
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+		i += len(events)
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// listen listens on the unix socket path, only accessible to the user of
+// the agent. The socket is created in a new directory only the agent can
+// enter and then moved to path, so it is never open to others, not even
+// before its mode is set.
+func listen(path string) (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".control")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(path))
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// Serve removes the socket at path, not the one l was created at.
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve serves s on the unix socket path, only accessible to the user of
+// the agent, until ctx is done.
+func Serve(ctx context.Context, path string, s *Server) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing stale control socket: %v", err)
+	}
+	l, err := listen(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	srv := grpc.NewServer(grpc.ForceServerCodec(codec{}))
+	srv.RegisterService(&serviceDesc, s)
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+	if err := srv.Serve(l); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
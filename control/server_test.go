@@ -0,0 +1,380 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package control
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1"
+)
+
+func startServer(t *testing.T, reportInventory func(context.Context)) *Client {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	path := filepath.Join(t.TempDir(), "control.sock")
+	done := make(chan error)
+	go func() { done <- Serve(ctx, path, NewServer(ctx, reportInventory)) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	c, err := Dial(ctx, path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestListen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not restrict sockets on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "control.sock")
+	l, err := listen(path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %s, want a socket with mode 0600", fi.Mode())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory of the socket has %d entries, want only the socket", len(entries))
+	}
+}
+
+func fakePaused(t *testing.T, subsystems ...string) {
+	oldPaused := paused
+	t.Cleanup(func() { paused = oldPaused })
+	paused = func(s string) bool {
+		for _, sub := range subsystems {
+			if sub == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestRefreshInventory(t *testing.T) {
+	fakePaused(t)
+	reported := make(chan struct{})
+	c := startServer(t, func(context.Context) { close(reported) })
+	ctx := context.Background()
+
+	resp, err := c.RefreshInventory(ctx, &RefreshInventoryRequest{})
+	if err != nil {
+		t.Fatalf("RefreshInventory: %v", err)
+	}
+	if resp.Task != inventoryTask {
+		t.Errorf("task = %q, want %q", resp.Task, inventoryTask)
+	}
+	select {
+	case <-reported:
+	case <-time.After(10 * time.Second):
+		t.Fatal("inventory was not reported")
+	}
+
+	fakePaused(t, "inventory")
+	if _, err := c.RefreshInventory(ctx, &RefreshInventoryRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RefreshInventory while paused = %v, want code %s", err, codes.FailedPrecondition)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	fakePaused(t)
+	tasker.SetCapacity(1)
+	t.Cleanup(func() { tasker.SetCapacity(0) })
+	c := startServer(t, func(context.Context) {})
+	ctx := context.Background()
+
+	// One task running and one queued fill the queue.
+	block := make(chan struct{})
+	running := make(chan struct{})
+	tasker.Enqueue(ctx, "running", func(context.Context) { close(running); <-block })
+	<-running
+	tasker.Enqueue(ctx, "queued", func(context.Context) {})
+	defer close(block)
+
+	if _, err := c.RefreshInventory(ctx, &RefreshInventoryRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("RefreshInventory with a full queue = %v, want code %s", err, codes.ResourceExhausted)
+	}
+	if _, err := c.Patch(ctx, &PatchRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Patch with a full queue = %v, want code %s", err, codes.ResourceExhausted)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	fakePaused(t)
+	oldRunPatchTask := runPatchTask
+	t.Cleanup(func() { runPatchTask = oldRunPatchTask })
+	var got *agentendpointpb.ApplyPatchesTask
+	runPatchTask = func(ctx context.Context, id string, task *agentendpointpb.ApplyPatchesTask, progress ospatch.ProgressFunc) ([]*ospatch.PatchResult, error) {
+		got = task
+		progress(ospatch.Progress{Phase: ospatch.PhaseInstall, Action: "Upgrading", Package: "bash", Current: 1, Total: 1})
+		return []*ospatch.PatchResult{{Succeeded: []*packages.PkgInfo{{Name: "bash"}}}}, errors.New("reboot failed")
+	}
+	c := startServer(t, nil)
+	ctx := context.Background()
+
+	if _, err := c.Patch(ctx, &PatchRequest{Excludes: []string{"/["}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Patch with an invalid exclude = %v, want code %s", err, codes.InvalidArgument)
+	}
+	if _, err := c.Patch(ctx, &PatchRequest{Reboot: "sometimes"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Patch with an invalid reboot = %v, want code %s", err, codes.InvalidArgument)
+	}
+
+	resp, err := c.Patch(ctx, &PatchRequest{DryRun: true, Excludes: []string{"kernel*"}})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	var events []*PatchEvent
+	if err := c.StreamPatchProgress(ctx, &StreamPatchProgressRequest{ID: resp.ID}, func(e *PatchEvent) {
+		events = append(events, e)
+	}); err != nil {
+		t.Fatalf("StreamPatchProgress: %v", err)
+	}
+	if !got.GetDryRun() || len(got.GetPatchConfig().GetApt().GetExcludes()) != 1 || len(got.GetPatchConfig().GetYum().GetExcludes()) != 1 {
+		t.Errorf("runPatchTask called with %+v, want the request options", got)
+	}
+
+	var states []PatchState
+	var progress *PatchEvent
+	for _, e := range events {
+		if e.ID != resp.ID {
+			t.Errorf("event ID = %q, want %q", e.ID, resp.ID)
+		}
+		if e.Phase != "" {
+			progress = e
+			continue
+		}
+		states = append(states, e.State)
+	}
+	if want := []PatchState{PatchPending, PatchRunning, PatchFailed}; len(states) != len(want) || states[0] != want[0] || states[1] != want[1] || states[2] != want[2] {
+		t.Errorf("states = %q, want %q", states, want)
+	}
+	if progress == nil || progress.Package != "bash" || progress.State != PatchRunning {
+		t.Errorf("progress event = %+v, want the bash upgrade while running", progress)
+	}
+	last := events[len(events)-1]
+	if last.Error != "reboot failed" || len(last.Results) != 1 || last.Results[0].Succeeded[0].Name != "bash" {
+		t.Errorf("last event = %+v, want the error and results of the run", last)
+	}
+
+	st, err := c.TaskStatus(ctx, &TaskStatusRequest{})
+	if err != nil {
+		t.Fatalf("TaskStatus: %v", err)
+	}
+	if len(st.Patches) != 1 || st.Patches[0].ID != resp.ID || st.Patches[0].State != PatchFailed || st.Tasks == nil {
+		t.Errorf("TaskStatus = %+v, want the failed patch run", st)
+	}
+
+	if err := c.StreamPatchProgress(ctx, &StreamPatchProgressRequest{ID: "patch-0"}, func(*PatchEvent) {}); status.Code(err) != codes.NotFound {
+		t.Errorf("StreamPatchProgress of an unknown run = %v, want code %s", err, codes.NotFound)
+	}
+
+	fakePaused(t, "patching")
+	if _, err := c.Patch(ctx, &PatchRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Patch while paused = %v, want code %s", err, codes.FailedPrecondition)
+	}
+}
+
+func TestRunPatch(t *testing.T) {
+	fakePaused(t)
+	oldRunPatchTask := runPatchTask
+	t.Cleanup(func() { runPatchTask = oldRunPatchTask })
+	var ids []string
+	runPatchTask = func(ctx context.Context, id string, task *agentendpointpb.ApplyPatchesTask, progress ospatch.ProgressFunc) ([]*ospatch.PatchResult, error) {
+		ids = append(ids, id)
+		if !task.GetPatchConfig().GetYum().GetSecurity() {
+			t.Errorf("runPatchTask called with %+v, want a yum security patch", task)
+		}
+		return nil, nil
+	}
+	ctx := context.Background()
+	s := NewServer(ctx, nil)
+
+	run, err := s.RunPatch(ctx, &PatchRequest{Security: true})
+	if err != nil {
+		t.Fatalf("RunPatch: %v", err)
+	}
+	if run.State != PatchSucceeded || run.End.IsZero() {
+		t.Errorf("RunPatch = %+v, want a finished successful run", run)
+	}
+	if len(ids) != 1 || !strings.HasPrefix(ids[0], "control-"+run.ID+"-") {
+		t.Errorf("patch task IDs = %q, want one for run %s", ids, run.ID)
+	}
+	st, err := s.TaskStatus(ctx, &TaskStatusRequest{})
+	if err != nil {
+		t.Fatalf("TaskStatus: %v", err)
+	}
+	if len(st.Patches) != 1 || st.Patches[0].ID != run.ID {
+		t.Errorf("TaskStatus patches = %+v, want run %s", st.Patches, run.ID)
+	}
+
+	fakePaused(t, "patching")
+	if _, err := s.RunPatch(ctx, &PatchRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RunPatch while paused = %v, want code %s", err, codes.FailedPrecondition)
+	}
+}
+
+func TestRestorePatch(t *testing.T) {
+	fakePaused(t)
+	oldRunPatchTask := runPatchTask
+	t.Cleanup(func() { runPatchTask = oldRunPatchTask })
+	ran := make(chan *agentendpointpb.ApplyPatchesTask, 1)
+	runPatchTask = func(ctx context.Context, id string, task *agentendpointpb.ApplyPatchesTask, progress ospatch.ProgressFunc) ([]*ospatch.PatchResult, error) {
+		ran <- task
+		return nil, nil
+	}
+	journal := filepath.Join(t.TempDir(), "tasks.json")
+	// A patch run queued on the control API when the agent stopped.
+	data := `[{"Name":"PatchRun","Kind":"control-patch","Priority":1,"Data":{"security":true}}]`
+	if err := os.WriteFile(journal, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tasker.SetJournal(journal)
+	t.Cleanup(func() { tasker.SetJournal("") })
+	ctx := context.Background()
+	s := NewServer(ctx, nil)
+	s.RegisterTasks()
+
+	if err := tasker.Restore(ctx); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	select {
+	case task := <-ran:
+		if !task.GetPatchConfig().GetYum().GetSecurity() {
+			t.Errorf("restored patch ran with %+v, want a yum security patch", task)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("restored patch did not run within 10s")
+	}
+	st, err := s.TaskStatus(ctx, &TaskStatusRequest{})
+	if err != nil {
+		t.Fatalf("TaskStatus: %v", err)
+	}
+	if len(st.Patches) != 1 || !st.Patches[0].Request.Security {
+		t.Errorf("TaskStatus patches = %+v, want the restored run", st.Patches)
+	}
+}
+
+func TestApplyPatchesTask(t *testing.T) {
+	tests := []struct {
+		reboot string
+		want   agentendpointpb.PatchConfig_RebootConfig
+	}{
+		{"", agentendpointpb.PatchConfig_DEFAULT},
+		{RebootDefault, agentendpointpb.PatchConfig_DEFAULT},
+		{RebootAlways, agentendpointpb.PatchConfig_ALWAYS},
+		{RebootNever, agentendpointpb.PatchConfig_NEVER},
+	}
+	for _, tt := range tests {
+		req := &PatchRequest{Excludes: []string{"kernel*"}, ExclusivePackages: []string{"bash"}, Minimal: true, Reboot: tt.reboot}
+		cfg := req.applyPatchesTask().GetPatchConfig()
+		if got := cfg.GetRebootConfig(); got != tt.want {
+			t.Errorf("reboot %q: RebootConfig = %s, want %s", tt.reboot, got, tt.want)
+		}
+		if len(cfg.GetApt().GetExcludes()) != 1 || len(cfg.GetZypper().GetExclusivePatches()) != 1 || len(cfg.GetWindowsUpdate().GetExcludes()) != 1 || !cfg.GetYum().GetMinimal() {
+			t.Errorf("PatchConfig = %+v, want the request options for each package manager", cfg)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	oldPause, oldResume, oldPausedUntil, oldPauseMessage := pause, resume, pausedUntil, pauseMessage
+	t.Cleanup(func() {
+		pause, resume, pausedUntil, pauseMessage = oldPause, oldResume, oldPausedUntil, oldPauseMessage
+	})
+	state := map[string]time.Time{}
+	pause = func(s string, d time.Duration) error {
+		if d < 0 {
+			return agentconfig.ErrNegativePause
+		}
+		state[s] = time.Time{}
+		if d > 0 {
+			state[s] = time.Now().Add(d)
+		}
+		return nil
+	}
+	resume = func(s string) error {
+		delete(state, s)
+		return nil
+	}
+	pausedUntil = func(s string) (time.Time, bool) {
+		until, ok := state[s]
+		return until, ok
+	}
+	pauseMessage = func(s string) string { return s + " is paused" }
+	c := startServer(t, nil)
+	ctx := context.Background()
+
+	resp, err := c.Pause(ctx, &PauseRequest{Subsystem: "drift-watcher", Duration: "2h"})
+	if err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if resp.Until.Before(time.Now().Add(119*time.Minute)) || resp.Message != "drift-watcher is paused" {
+		t.Errorf("Pause = %+v, want a pause of about two hours", resp)
+	}
+	if resp, err := c.Pause(ctx, &PauseRequest{Subsystem: "patching"}); err != nil || !resp.Until.IsZero() {
+		t.Errorf("Pause without a duration = %+v, %v, want a pause until resumed", resp, err)
+	}
+
+	if _, err := c.Resume(ctx, &ResumeRequest{Subsystem: "patching"}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if _, ok := state["patching"]; ok {
+		t.Error("patching still paused after Resume")
+	}
+
+	for _, req := range []*PauseRequest{{Subsystem: "reboots"}, {Subsystem: "inventory", Duration: "soon"}, {Subsystem: "inventory", Duration: "-1h"}} {
+		if _, err := c.Pause(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Pause(%+v) = %v, want code %s", req, err, codes.InvalidArgument)
+		}
+	}
+	if _, err := c.Resume(ctx, &ResumeRequest{Subsystem: "reboots"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Resume of an unknown subsystem = %v, want code %s", err, codes.InvalidArgument)
+	}
+}
@@ -0,0 +1,223 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package doctor runs a read-only self test of the agent and its environment
+// to diagnose why it is not working, e.g. why the reported inventory is empty.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+// Check outcomes.
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+var (
+	// checkTimeout is how long a single check is allowed to run.
+	checkTimeout = 30 * time.Second
+	// dialTimeout is how long network reachability checks wait to connect.
+	dialTimeout = 5 * time.Second
+)
+
+// Check is the result of a single self test check.
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+	Elapsed string `json:"elapsed"`
+}
+
+// Diagnosis is the result of SelfTest.
+type Diagnosis struct {
+	Checks []*Check `json:"checks"`
+}
+
+// Healthy reports whether no check failed.
+func (d *Diagnosis) Healthy() bool {
+	for _, c := range d.Checks {
+		if c.Status == StatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the diagnosis as a table for the command line.
+func (d *Diagnosis) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tELAPSED\tMESSAGE")
+	for _, c := range d.Checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Name, c.Status, c.Elapsed, strings.ReplaceAll(c.Message, "\n", " "))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// check is a single self test, it returns the status and a message
+// describing it.
+type check struct {
+	name string
+	run  func(context.Context) (Status, string)
+}
+
+// runCheck runs c with checkTimeout. Not all package manager commands honor
+// context cancellation, so a check that does not return in time is reported
+// as failed and left to finish in the background.
+func runCheck(ctx context.Context, c check) *Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	type result struct {
+		status Status
+		msg    string
+	}
+	start := time.Now()
+	done := make(chan result, 1)
+	go func() {
+		status, msg := c.run(ctx)
+		done <- result{status, msg}
+	}()
+
+	res := &Check{Name: c.name}
+	select {
+	case r := <-done:
+		res.Status, res.Message = r.status, r.msg
+	case <-ctx.Done():
+		res.Status, res.Message = StatusFailed, fmt.Sprintf("did not finish within %s", checkTimeout)
+	}
+	res.Elapsed = time.Since(start).Round(time.Millisecond).String()
+	return res
+}
+
+// SelfTest runs every check read-only: it loads the agent configuration from
+// metadata, verifies the agent privileges and that its state directory is
+// writable, checks that the metadata server and the OS Config service are
+// reachable, and lists installed packages with every detected package
+// manager to validate the parsers on live output.
+func SelfTest(ctx context.Context) *Diagnosis {
+	checks := []check{
+		{"metadata", checkMetadata},
+		{"privileges", checkPrivileges},
+		{"state-dir", checkStateDir},
+		{"network:metadata", func(ctx context.Context) (Status, string) {
+			return checkReachable(ctx, net.JoinHostPort(agentconfig.MetadataHost(), "80"))
+		}},
+		{"network:osconfig", func(ctx context.Context) (Status, string) {
+			endpoint := agentconfig.SvcEndpoint()
+			if endpoint == "" {
+				return StatusSkipped, "service endpoint unknown, agent configuration was not loaded"
+			}
+			if _, _, err := net.SplitHostPort(endpoint); err != nil {
+				endpoint = net.JoinHostPort(endpoint, "443")
+			}
+			return checkReachable(ctx, endpoint)
+		}},
+	}
+	for _, p := range providers() {
+		checks = append(checks, p.check())
+	}
+
+	d := &Diagnosis{}
+	for _, c := range checks {
+		d.Checks = append(d.Checks, runCheck(ctx, c))
+	}
+	return d
+}
+
+func checkMetadata(ctx context.Context) (Status, string) {
+	// WatchConfig blocks waiting for metadata changes, it returns without
+	// error once ctx is done so give it a little less than the check timeout.
+	deadline, _ := ctx.Deadline()
+	wctx, cancel := context.WithDeadline(ctx, deadline.Add(-time.Second))
+	defer cancel()
+	if err := agentconfig.WatchConfig(wctx); err != nil {
+		return StatusFailed, err.Error()
+	}
+	if agentconfig.ProjectID() == "" {
+		return StatusFailed, "no agent configuration received from the metadata server"
+	}
+	return StatusOK, fmt.Sprintf("project %q, instance %q, endpoint %q", agentconfig.ProjectID(), agentconfig.Name(), agentconfig.SvcEndpoint())
+}
+
+func checkStateDir(_ context.Context) (Status, string) {
+	dir := agentconfig.CacheDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return StatusFailed, fmt.Sprintf("cannot create state directory %q: %v", dir, err)
+	}
+	f, err := ioutil.TempFile(dir, "osconfig_doctor")
+	if err != nil {
+		return StatusFailed, fmt.Sprintf("state directory %q is not writable: %v", dir, err)
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return StatusWarning, fmt.Sprintf("cannot remove test file %q: %v", f.Name(), err)
+	}
+	return StatusOK, fmt.Sprintf("%q is writable", dir)
+}
+
+func checkReachable(ctx context.Context, address string) (Status, string) {
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return StatusFailed, fmt.Sprintf("cannot connect to %s: %v", address, err)
+	}
+	conn.Close()
+	return StatusOK, fmt.Sprintf("connected to %s", address)
+}
+
+// provider is a package manager listing exercised by SelfTest.
+type provider struct {
+	name string
+	// detected reports whether the package manager is installed.
+	detected bool
+	// list runs the read-only listing, returning how many entries were parsed.
+	list func(context.Context) (int, error)
+	// expectEntries is set for providers that always have installed entries
+	// on a working system, so an empty listing points at a parser problem.
+	expectEntries bool
+}
+
+func (p provider) check() check {
+	return check{name: "provider:" + p.name, run: func(ctx context.Context) (Status, string) {
+		if !p.detected {
+			return StatusSkipped, "not detected"
+		}
+		n, err := p.list(ctx)
+		if err != nil {
+			return StatusFailed, err.Error()
+		}
+		if n == 0 && p.expectEntries {
+			return StatusWarning, "command succeeded but no entries were parsed from its output"
+		}
+		return StatusOK, fmt.Sprintf("%d entries", n)
+	}}
+}
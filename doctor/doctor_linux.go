@@ -0,0 +1,62 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package doctor
+
+import (
+	"context"
+	"os"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+func checkPrivileges(_ context.Context) (Status, string) {
+	if os.Geteuid() != 0 {
+		return StatusWarning, "not running as root, package manager commands and state files may not be accessible"
+	}
+	return StatusOK, "running as root"
+}
+
+func providers() []provider {
+	return []provider{
+		{name: "rpm", detected: packages.RPMQueryExists, expectEntries: true, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.InstalledRPMPackages(ctx)
+			return len(pkgs), err
+		}},
+		{name: "dpkg", detected: packages.DpkgQueryExists, expectEntries: true, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.InstalledDebPackages(ctx)
+			return len(pkgs), err
+		}},
+		{name: "zypper-patches", detected: packages.ZypperExists, list: func(ctx context.Context) (int, error) {
+			patches, err := packages.ZypperInstalledPatches(ctx)
+			return len(patches), err
+		}},
+		{name: "cos", detected: packages.COSPkgInfoExists, expectEntries: true, list: func(_ context.Context) (int, error) {
+			pkgs, err := packages.InstalledCOSPackages()
+			return len(pkgs), err
+		}},
+		{name: "gem", detected: packages.GemExists, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.InstalledGemPackages(ctx)
+			return len(pkgs), err
+		}},
+		{name: "pip", detected: packages.PipExists, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.InstalledPipPackages(ctx)
+			return len(pkgs), err
+		}},
+		{name: "brew", detected: packages.BrewExists, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.InstalledBrewPackages(ctx)
+			return len(pkgs), err
+		}},
+	}
+}
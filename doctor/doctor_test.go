@@ -0,0 +1,88 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package doctor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProviderCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		p    provider
+		want Status
+	}{
+		{"NotDetected", provider{detected: false}, StatusSkipped},
+		{"Error", provider{detected: true, list: func(context.Context) (int, error) { return 0, errors.New("boom") }}, StatusFailed},
+		{"Entries", provider{detected: true, list: func(context.Context) (int, error) { return 3, nil }}, StatusOK},
+		{"EmptyAllowed", provider{detected: true, list: func(context.Context) (int, error) { return 0, nil }}, StatusOK},
+		{"EmptyExpectedEntries", provider{detected: true, expectEntries: true, list: func(context.Context) (int, error) { return 0, nil }}, StatusWarning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runCheck(context.Background(), tt.p.check())
+			if got.Status != tt.want {
+				t.Errorf("status = %q, want %q (message: %q)", got.Status, tt.want, got.Message)
+			}
+		})
+	}
+}
+
+func TestRunCheckTimeout(t *testing.T) {
+	old := checkTimeout
+	checkTimeout = 10 * time.Millisecond
+	defer func() { checkTimeout = old }()
+
+	block := make(chan struct{})
+	defer close(block)
+	got := runCheck(context.Background(), check{name: "slow", run: func(context.Context) (Status, string) {
+		<-block
+		return StatusOK, ""
+	}})
+	if got.Status != StatusFailed {
+		t.Errorf("status = %q, want %q", got.Status, StatusFailed)
+	}
+}
+
+func TestCheckReachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	if got, msg := checkReachable(context.Background(), addr); got != StatusOK {
+		t.Errorf("checkReachable(%q) = %q, want %q (message: %q)", addr, got, StatusOK, msg)
+	}
+	l.Close()
+	if got, _ := checkReachable(context.Background(), addr); got != StatusFailed {
+		t.Errorf("checkReachable(%q) after close = %q, want %q", addr, got, StatusFailed)
+	}
+}
+
+func TestDiagnosisHealthy(t *testing.T) {
+	d := &Diagnosis{Checks: []*Check{{Status: StatusOK}, {Status: StatusWarning}, {Status: StatusSkipped}}}
+	if !d.Healthy() {
+		t.Error("Healthy() = false, want true")
+	}
+	d.Checks = append(d.Checks, &Check{Status: StatusFailed})
+	if d.Healthy() {
+		t.Error("Healthy() = true, want false")
+	}
+}
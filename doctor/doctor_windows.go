@@ -0,0 +1,54 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package doctor
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"golang.org/x/sys/windows"
+)
+
+func checkPrivileges(_ context.Context) (Status, string) {
+	if !windows.GetCurrentProcessToken().IsElevated() {
+		return StatusWarning, "not running elevated, package manager commands and state files may not be accessible"
+	}
+	return StatusOK, "running elevated"
+}
+
+func providers() []provider {
+	return []provider{
+		{name: "googet", detected: packages.GooGetExists, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.InstalledGooGetPackages(ctx)
+			return len(pkgs), err
+		}},
+		{name: "wua", detected: true, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.WUAUpdates(ctx, "IsInstalled=1")
+			return len(pkgs), err
+		}},
+		{name: "qfe", detected: true, expectEntries: true, list: func(ctx context.Context) (int, error) {
+			pkgs, err := packages.QuickFixEngineering(ctx)
+			return len(pkgs), err
+		}},
+		{name: "msi", detected: true, expectEntries: true, list: func(ctx context.Context) (int, error) {
+			products, err := packages.InstalledMSIProducts(ctx)
+			return len(products), err
+		}},
+		{name: "applications", detected: true, expectEntries: true, list: func(ctx context.Context) (int, error) {
+			apps, err := packages.GetWindowsApplications(ctx)
+			return len(apps), err
+		}},
+	}
+}
@@ -0,0 +1,155 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package exporter sends the inventory and patch results of the agent, or
+// any other hook event, to backends other than the OS Config service: cloud
+// storage buckets, Pub/Sub topics, or NDJSON on stdout or in a file.
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+)
+
+// Record is what exporters send, an event and the host it happened on.
+type Record struct {
+	Hostname string `json:"hostname"`
+	*hooks.Event
+}
+
+// Exporter sends records to a backend.
+type Exporter interface {
+	Export(ctx context.Context, r *Record) error
+	// Close releases the resources of the exporter, it must not be used
+	// afterwards.
+	Close() error
+}
+
+// DefaultEvents are the hook points exporters are registered for when none
+// are configured, the inventory and patch results.
+var DefaultEvents = []hooks.Point{hooks.AfterInventory, hooks.AfterPatch}
+
+// New returns the exporter for rawURL, one of:
+//
+//	stdout                           NDJSON on stdout
+//	file:///var/log/osconfig.ndjson  NDJSON appended to the file
+//	gs://bucket/prefix/              one object per record, see ObjectName
+//	s3://bucket/prefix/?region=eu-west-1&endpoint=https://minio:9000
+//	pubsub://projects/p/topics/t     one message per record
+//
+// The s3 exporter works with any store implementing the S3 API, its
+// credentials come from the credential chain of the agent, the access key
+// ID and secret access key as username and password, or the AWS_*
+// environment variables.
+func New(ctx context.Context, rawURL string) (Exporter, error) {
+	if rawURL == "stdout" {
+		return NewNDJSON(os.Stdout), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "stdout":
+		return NewNDJSON(os.Stdout), nil
+	case "file":
+		if !filepath.IsAbs(u.Path) {
+			return nil, fmt.Errorf("file exporter path %q is not absolute", u.Path)
+		}
+		return &fileExporter{path: u.Path}, nil
+	case "gs":
+		return newGCS(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+	case "s3":
+		return newS3(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), u.Query().Get("region"), u.Query().Get("endpoint"))
+	case "pubsub":
+		return newPubSub(ctx, u.Host+u.Path)
+	}
+	return nil, fmt.Errorf("unknown exporter %q, want stdout or a file, gs, s3 or pubsub URL", rawURL)
+}
+
+// Register registers a hook at point p exporting its events with e, see
+// hooks.Register.
+func Register(p hooks.Point, name string, timeout time.Duration, e Exporter) {
+	hostname, _ := os.Hostname()
+	hooks.Register(p, name, timeout, func(ctx context.Context, ev *hooks.Event) error {
+		return e.Export(ctx, &Record{Hostname: hostname, Event: ev})
+	})
+}
+
+// ObjectName returns the name of the object r is stored as under prefix,
+// "<prefix><hostname>/<point>/<time>.json", so that the records of a host
+// and point sort by time.
+func ObjectName(prefix string, r *Record) string {
+	return fmt.Sprintf("%s%s/%s/%s.json", prefix, r.Hostname, r.Point, r.Time.UTC().Format("20060102T150405.000000000Z"))
+}
+
+// NDJSON writes records as JSON, one per line.
+type NDJSON struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewNDJSON returns an NDJSON exporter writing to w.
+func NewNDJSON(w io.Writer) *NDJSON {
+	return &NDJSON{w: w}
+}
+
+// Export writes r to the writer of e.
+func (e *NDJSON) Export(_ context.Context, r *Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close does nothing, the writer belongs to the caller.
+func (e *NDJSON) Close() error {
+	return nil
+}
+
+// fileExporter appends records to a file, opening it for every record so
+// that it can be rotated.
+type fileExporter struct {
+	path string
+}
+
+func (e *fileExporter) Export(ctx context.Context, r *Record) error {
+	f, err := os.OpenFile(e.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := NewNDJSON(f).Export(ctx, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (e *fileExporter) Close() error {
+	return nil
+}
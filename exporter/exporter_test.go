@@ -0,0 +1,155 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"google.golang.org/api/option"
+)
+
+func testRecord() *Record {
+	return &Record{
+		Hostname: "web-1",
+		Event:    &hooks.Event{Point: hooks.AfterInventory, Time: time.Date(2024, 5, 1, 2, 3, 4, 0, time.UTC), Data: map[string]string{"os": "debian"}},
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewNDJSON(&buf)
+	for i := 0; i < 2; i++ {
+		if err := e.Export(context.Background(), testRecord()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `{"hostname":"web-1","point":"after-inventory","time":"2024-05-01T02:03:04Z","data":{"os":"debian"}}`
+	if got := buf.String(); got != want+"\n"+want+"\n" {
+		t.Errorf("NDJSON output = %q, want two lines of %q", got, want)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports.ndjson")
+	e, err := New(context.Background(), "file://"+filepath.ToSlash(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := e.Export(context.Background(), testRecord()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("file has %d lines, want 2:\n%s", n, data)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, u := range []string{
+		"ftp://host/path",
+		"file://relative",
+		"gs:///prefix",
+		"pubsub://projects/p",
+		"pubsub://projects/p/subscriptions/s",
+	} {
+		if _, err := New(context.Background(), u); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", u)
+		}
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	want := "osconfig/web-1/after-inventory/20240501T020304.000000000Z.json"
+	if got := ObjectName("osconfig/", testRecord()); got != want {
+		t.Errorf("ObjectName() = %q, want %q", got, want)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var buf bytes.Buffer
+	Register(hooks.AfterPatch, "test-exporter", 0, NewNDJSON(&buf))
+	defer hooks.Unregister(hooks.AfterPatch, "test-exporter")
+
+	if err := hooks.Run(context.Background(), hooks.AfterPatch, &hooks.PatchData{TaskID: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Hostname string
+		Point    hooks.Point
+		Data     hooks.PatchData
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("error decoding %q: %v", buf.String(), err)
+	}
+	if hostname, _ := os.Hostname(); got.Hostname != hostname || got.Point != hooks.AfterPatch || got.Data.TaskID != "t1" {
+		t.Errorf("exported %+v, want the after-patch event of task t1 on %s", got, hostname)
+	}
+}
+
+func TestPubSubExport(t *testing.T) {
+	var gotPath string
+	var got struct {
+		Messages []struct {
+			Data       string
+			Attributes map[string]string
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write([]byte(`{"messageIds":["1"]}`))
+	}))
+	defer ts.Close()
+
+	e, err := newPubSub(context.Background(), "projects/p/topics/reports", option.WithEndpoint(ts.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(context.Background(), testRecord()); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if want := "/v1/projects/p/topics/reports:publish"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if len(got.Messages) != 1 {
+		t.Fatalf("published %d messages, want 1", len(got.Messages))
+	}
+	m := got.Messages[0]
+	if m.Attributes["hostname"] != "web-1" || m.Attributes["point"] != "after-inventory" {
+		t.Errorf("attributes = %v", m.Attributes)
+	}
+	data, err := base64.StdEncoding.DecodeString(m.Data)
+	if err != nil || !strings.Contains(string(data), `"hostname":"web-1"`) {
+		t.Errorf("data = %q, %v, want the JSON record", data, err)
+	}
+}
@@ -0,0 +1,65 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// gcsExporter stores every record as an object in a Cloud Storage bucket.
+type gcsExporter struct {
+	client *storage.Client
+	bucket string
+	prefix string
+}
+
+func newGCS(ctx context.Context, bucket, prefix string, opts ...option.ClientOption) (*gcsExporter, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("gs exporter needs a bucket")
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gcs client: %v", err)
+	}
+	return &gcsExporter{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (e *gcsExporter) Export(ctx context.Context, r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	name := ObjectName(e.prefix, r)
+	w := e.client.Bucket(e.bucket).Object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing gs://%s/%s: %v", e.bucket, name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing gs://%s/%s: %v", e.bucket, name, err)
+	}
+	return nil
+}
+
+func (e *gcsExporter) Close() error {
+	return e.client.Close()
+}
@@ -0,0 +1,64 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+// pubSubExporter publishes every record as a message to a Pub/Sub topic,
+// with the hostname and hook point as attributes for subscription filters.
+type pubSubExporter struct {
+	svc   *pubsub.Service
+	topic string
+}
+
+func newPubSub(ctx context.Context, topic string, opts ...option.ClientOption) (*pubSubExporter, error) {
+	// projects/<project>/topics/<topic>
+	if parts := strings.Split(topic, "/"); len(parts) != 4 || parts[0] != "projects" || parts[2] != "topics" || parts[1] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("pubsub topic %q is not of the form projects/<project>/topics/<topic>", topic)
+	}
+	svc, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pubsub client: %v", err)
+	}
+	return &pubSubExporter{svc: svc, topic: topic}, nil
+}
+
+func (e *pubSubExporter) Export(ctx context.Context, r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	msg := &pubsub.PubsubMessage{
+		Data:       base64.StdEncoding.EncodeToString(data),
+		Attributes: map[string]string{"hostname": r.Hostname, "point": string(r.Point)},
+	}
+	if _, err := e.svc.Projects.Topics.Publish(e.topic, &pubsub.PublishRequest{Messages: []*pubsub.PubsubMessage{msg}}).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("error publishing to %s: %v", e.topic, err)
+	}
+	return nil
+}
+
+func (e *pubSubExporter) Close() error {
+	return nil
+}
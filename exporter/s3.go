@@ -0,0 +1,240 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/external"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+var (
+	s3Client = &http.Client{Transport: &http.Transport{Proxy: agentconfig.Proxy}}
+	s3Policy = retryutil.Exponential(time.Second, 30*time.Second).WithJitter(0.2)
+	s3Now    = time.Now
+	s3Chain  = external.DefaultCredentialChain
+)
+
+// s3Exporter stores every record as an object in an S3 bucket, or a bucket
+// of any store implementing the S3 API. Objects are addressed path-style,
+// "<endpoint>/<bucket>/<key>", which all S3 implementations support.
+//
+// The credentials are looked up for the object URLs with the credential
+// chain of the agent, see external.DefaultCredentialChain, the username
+// being the access key ID, the password the secret access key and the
+// token, if any, the session token of temporary credentials. Without a
+// credential from the chain they are read from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type s3Exporter struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	region   string
+}
+
+func newS3(ctx context.Context, bucket, prefix, region, endpoint string) (*s3Exporter, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 exporter needs a bucket")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("s3 exporter needs a region, set the region parameter or AWS_REGION")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint %q is not an http or https URL", endpoint)
+	}
+	if s3Chain(ctx) == nil && (os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "") {
+		return nil, fmt.Errorf("s3 exporter needs credentials, configure a credential provider or set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return &s3Exporter{endpoint: u, bucket: bucket, prefix: prefix, region: region}, nil
+}
+
+// credential returns the credential for the object at u, see s3Exporter.
+func (e *s3Exporter) credential(ctx context.Context, u *url.URL) (*external.Credential, error) {
+	cred, err := s3Chain(ctx).Credential(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		cred = &external.Credential{
+			Username: os.Getenv("AWS_ACCESS_KEY_ID"),
+			Password: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if cred.Username == "" || cred.Password == "" {
+		return nil, retryutil.Permanent(fmt.Errorf("no s3 credentials for %s", u.Redacted()))
+	}
+	return cred, nil
+}
+
+func (e *s3Exporter) Export(ctx context.Context, r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := ObjectName(e.prefix, r)
+	return retryutil.Do(ctx, s3Policy, fmt.Sprintf("uploading s3://%s/%s", e.bucket, key), func() error {
+		return e.put(ctx, key, data)
+	})
+}
+
+func (e *s3Exporter) put(ctx context.Context, key string, data []byte) error {
+	u := *e.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + e.bucket + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	cred, err := e.credential(ctx, &u)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return retryutil.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cred.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", cred.Token)
+	}
+	sum := sha256.Sum256(data)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, payloadHash, e.region, "s3", cred.Username, cred.Password, s3Now())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+
+	err = fmt.Errorf("s3 responded %s: %s", resp.Status, bytes.TrimSpace(body))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusServiceUnavailable:
+		// S3 answers 503 SlowDown when throttling.
+		return retryutil.Throttled(err)
+	case resp.StatusCode >= 500:
+		return err
+	case resp.StatusCode == http.StatusForbidden:
+		// Look the credentials up again on the next export, they may have
+		// expired.
+		s3Chain(ctx).Invalidate(&u)
+	}
+	return retryutil.Permanent(err)
+}
+
+// uriEncode encodes s the way AWS Signature Version 4 wants it, every byte
+// but the unreserved characters, and '/' unless encodeSlash, percent
+// encoded.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signV4 signs req with AWS Signature Version 4, signing the host and all
+// the headers set on req. payloadHash is the hex SHA256 of the body, S3
+// also wants it in the X-Amz-Content-Sha256 header.
+func signV4(req *http.Request, payloadHash, region, service, accessKey, secretKey string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	var query []string
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			query = append(query, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(query)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(query, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(crHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func (e *s3Exporter) Close() error {
+	return nil
+}
@@ -0,0 +1,214 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package external
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+var (
+	metadataGet = metadata.Get
+	// runCredentialCommand does not go through util.DefaultRunner, which
+	// logs the output.
+	runCredentialCommand = func(cmd *exec.Cmd) ([]byte, error) { return cmd.Output() }
+)
+
+func homeFile(path, name string) string {
+	if path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, name)
+}
+
+// NetrcProvider reads basic auth credentials from a netrc file, matching the
+// URL host against the machine entries.
+type NetrcProvider struct {
+	// Path is the netrc file, ~/.netrc if empty.
+	Path string
+}
+
+func parseNetrc(data []byte, host string) *Credential {
+	var cred, def *Credential
+	var current **Credential
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			current = nil
+			if i+1 < len(fields) && fields[i+1] == host && cred == nil {
+				cred = &Credential{}
+				current = &cred
+			}
+			i++
+		case "default":
+			current = nil
+			if def == nil {
+				def = &Credential{}
+				current = &def
+			}
+		case "login", "password":
+			if i+1 < len(fields) && current != nil {
+				if fields[i] == "login" {
+					(*current).Username = fields[i+1]
+				} else {
+					(*current).Password = fields[i+1]
+				}
+			}
+			i++
+		case "account":
+			i++
+		case "macdef":
+			// Macros run to the end of the file as far as we are concerned.
+			i = len(fields)
+		}
+	}
+	if cred != nil {
+		return cred
+	}
+	return def
+}
+
+// Credential implements CredentialProvider.
+func (p *NetrcProvider) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	data, err := ioutil.ReadFile(homeFile(p.Path, ".netrc"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(data, u.Hostname()), nil
+}
+
+// DockerConfigProvider reads basic auth credentials from the auths of a
+// docker config.json, matching the URL host against the registries.
+type DockerConfigProvider struct {
+	// Path is the docker config file, ~/.docker/config.json if empty.
+	Path string
+}
+
+func registryHost(registry string) string {
+	if u, err := url.Parse(registry); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return strings.SplitN(registry, "/", 2)[0]
+}
+
+func parseDockerConfig(data []byte, host string) (*Credential, error) {
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for registry, a := range config.Auths {
+		if registryHost(registry) != host || a.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth for %q: %v", registry, err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid auth for %q, expected username:password", registry)
+		}
+		return &Credential{Username: parts[0], Password: parts[1]}, nil
+	}
+	return nil, nil
+}
+
+// Credential implements CredentialProvider.
+func (p *DockerConfigProvider) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	data, err := ioutil.ReadFile(homeFile(p.Path, filepath.Join(".docker", "config.json")))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDockerConfig(data, u.Host)
+}
+
+// GCPMetadataProvider returns an access token of the instance service
+// account from the metadata server, use it for Google hosted sources like
+// Artifact Registry.
+type GCPMetadataProvider struct{}
+
+// Credential implements CredentialProvider.
+func (p *GCPMetadataProvider) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	data, err := metadataGet("instance/service-accounts/default/token")
+	if err != nil {
+		return nil, err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, fmt.Errorf("error parsing service account token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("metadata server returned no access token")
+	}
+	return &Credential{Token: token.AccessToken, Expiry: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)}, nil
+}
+
+// CommandProvider runs a command with the URL as its only argument. The
+// command prints a JSON object with "username" and "password" or "token",
+// and optionally "expiry" in RFC 3339 format, or nothing if it has no
+// credentials for the URL.
+type CommandProvider struct {
+	Path string
+}
+
+// Credential implements CredentialProvider.
+func (p *CommandProvider) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	stdout, err := runCredentialCommand(exec.CommandContext(ctx, p.Path, u.String()))
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v", p.Path, err)
+	}
+	if len(strings.TrimSpace(string(stdout))) == 0 {
+		return nil, nil
+	}
+	var out struct {
+		Username string    `json:"username"`
+		Password string    `json:"password"`
+		Token    string    `json:"token"`
+		Expiry   time.Time `json:"expiry"`
+	}
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		return nil, fmt.Errorf("error parsing output of %q: %v", p.Path, err)
+	}
+	return &Credential{Username: out.Username, Password: out.Password, Token: out.Token, Expiry: out.Expiry}, nil
+}
@@ -0,0 +1,367 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package external
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+const (
+	// credentialTTL is how long credentials without an expiry are cached.
+	credentialTTL = 10 * time.Minute
+	// credentialRefreshMargin is how long before their expiry credentials are
+	// refreshed.
+	credentialRefreshMargin = time.Minute
+)
+
+// Credential authenticates requests, either with a bearer token or with
+// basic auth. The S3 exporter signs its requests with the username and
+// password as the access key pair instead, see exporter.New.
+type Credential struct {
+	Username, Password string
+	Token              string
+	// Expiry is when the credential expires, zero if it does not.
+	Expiry time.Time
+}
+
+func (c *Credential) apply(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		return
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+}
+
+// CredentialProvider looks up credentials for URLs.
+type CredentialProvider interface {
+	// Credential returns the credential for u, or nil if the provider has
+	// none for it.
+	Credential(ctx context.Context, u *url.URL) (*Credential, error)
+}
+
+// CredentialRule applies Provider to URLs under Prefix, a URL with the same
+// scheme and host, port included, and a path starting with the path
+// segments of Prefix. An empty Prefix matches every URL.
+type CredentialRule struct {
+	Prefix   string
+	Provider CredentialProvider
+}
+
+type cachedCredential struct {
+	cred    *Credential
+	expires time.Time
+}
+
+// CredentialChain looks up credentials with the providers of the rules
+// matching a URL, longest prefix first, until one has a credential.
+// Credentials are cached per rule and host and refreshed shortly before they
+// expire.
+type CredentialChain struct {
+	rules []*CredentialRule
+
+	mx    sync.Mutex
+	cache map[string]*cachedCredential
+}
+
+// NewCredentialChain returns a CredentialChain with the given rules.
+func NewCredentialChain(rules ...*CredentialRule) *CredentialChain {
+	return &CredentialChain{rules: rules, cache: map[string]*cachedCredential{}}
+}
+
+func cacheKey(r *CredentialRule, u *url.URL) string {
+	return r.Prefix + "\x00" + u.Host
+}
+
+// parsePrefix parses the prefix of a CredentialRule, which needs a scheme
+// and a host.
+func parsePrefix(prefix string) (*url.URL, error) {
+	p, err := url.Parse(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if p.Scheme == "" || p.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", prefix)
+	}
+	return p, nil
+}
+
+// matches reports whether u is under the prefix of r. The scheme and host
+// are compared exactly, not as strings, so that a prefix of
+// https://repo.example.com does not match https://repo.example.com.evil/.
+func (r *CredentialRule) matches(u *url.URL) bool {
+	if r.Prefix == "" {
+		return true
+	}
+	p, err := parsePrefix(r.Prefix)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(p.Scheme, u.Scheme) || !strings.EqualFold(p.Host, u.Host) {
+		return false
+	}
+	dir := strings.TrimSuffix(p.Path, "/")
+	return dir == "" || u.Path == dir || strings.HasPrefix(u.Path, dir+"/")
+}
+
+func (c *CredentialChain) matching(u *url.URL) []*CredentialRule {
+	var rules []*CredentialRule
+	for _, r := range c.rules {
+		if r.matches(u) {
+			rules = append(rules, r)
+		}
+	}
+	// Longest prefix first, keeping the configured order otherwise.
+	for i := 1; i < len(rules); i++ {
+		for j := i; j > 0 && len(rules[j].Prefix) > len(rules[j-1].Prefix); j-- {
+			rules[j], rules[j-1] = rules[j-1], rules[j]
+		}
+	}
+	return rules
+}
+
+// Credential returns the credential for u, or nil if no provider has one.
+func (c *CredentialChain) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	if c == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	var errs []string
+	for _, r := range c.matching(u) {
+		key := cacheKey(r, u)
+		c.mx.Lock()
+		cached, ok := c.cache[key]
+		c.mx.Unlock()
+		if ok && now.Before(cached.expires) {
+			if cached.cred != nil {
+				return cached.cred, nil
+			}
+			continue
+		}
+
+		cred, err := r.Provider.Credential(ctx, u)
+		if err != nil {
+			msg := fmt.Sprintf("credential provider for %q: %v", r.Prefix, err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+			continue
+		}
+		expires := now.Add(credentialTTL)
+		if cred != nil && !cred.Expiry.IsZero() && cred.Expiry.Add(-credentialRefreshMargin).Before(expires) {
+			expires = cred.Expiry.Add(-credentialRefreshMargin)
+		}
+		c.mx.Lock()
+		c.cache[key] = &cachedCredential{cred: cred, expires: expires}
+		c.mx.Unlock()
+		if cred != nil {
+			return cred, nil
+		}
+	}
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("error looking up credentials for %s: %s", u.Redacted(), strings.Join(errs, "; "))
+	}
+	return nil, nil
+}
+
+// Invalidate drops the cached credentials for u, e.g. after they were
+// rejected.
+func (c *CredentialChain) Invalidate(u *url.URL) {
+	if c == nil {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, r := range c.matching(u) {
+		delete(c.cache, cacheKey(r, u))
+	}
+}
+
+// Transport is an http.RoundTripper adding the credentials of Chain to
+// requests. A request rejected with 401 Unauthorized is retried once with
+// freshly looked up credentials.
+type Transport struct {
+	Chain *CredentialChain
+	// Base is the underlying RoundTripper, http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// Mirror, if set, rewrites the request URLs before the credentials are
+	// looked up, e.g. agentconfig.MirrorURL.
+	Mirror func(string) string
+}
+
+// mirrored returns req with its URL rewritten by Mirror.
+func (t *Transport) mirrored(req *http.Request) (*http.Request, error) {
+	if t.Mirror == nil {
+		return req, nil
+	}
+	u := t.Mirror(req.URL.String())
+	if u == req.URL.String() {
+		return req, nil
+	}
+	mu, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror %q of %s: %v", u, req.URL.Redacted(), err)
+	}
+	clog.Debugf(req.Context(), "Fetching %s from mirror %s.", req.URL.Redacted(), mu.Redacted())
+	mreq := req.Clone(req.Context())
+	mreq.URL, mreq.Host = mu, ""
+	return mreq, nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) authorized(req *http.Request) (*http.Request, bool, error) {
+	cred, err := t.Chain.Credential(req.Context(), req.URL)
+	if err != nil || cred == nil {
+		return req, false, err
+	}
+	req = req.Clone(req.Context())
+	cred.apply(req)
+	return req, true, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, err := t.mirrored(req)
+	if err != nil {
+		return nil, err
+	}
+	areq, ok, err := t.authorized(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base().RoundTrip(areq)
+	if err != nil || !ok || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+
+	clog.Debugf(req.Context(), "Credentials for %s rejected, refreshing them.", req.URL.Redacted())
+	resp.Body.Close()
+	t.Chain.Invalidate(req.URL)
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if areq, _, err = t.authorized(retry); err != nil {
+		return nil, err
+	}
+	return t.base().RoundTrip(areq)
+}
+
+var (
+	defaultChainMx     sync.Mutex
+	defaultChain       *CredentialChain
+	defaultChainConfig string
+)
+
+// DefaultCredentialChain returns the CredentialChain configured with the
+// osconfig-credentials metadata setting, see ParseCredentialRules. It is nil
+// if no credentials are configured or the setting is invalid.
+func DefaultCredentialChain(ctx context.Context) *CredentialChain {
+	config := agentconfig.Credentials()
+
+	defaultChainMx.Lock()
+	defer defaultChainMx.Unlock()
+	if defaultChain != nil && config == defaultChainConfig {
+		return defaultChain
+	}
+	rules, err := ParseCredentialRules(config)
+	if err != nil {
+		clog.Errorf(ctx, "Invalid credentials setting, not using credentials: %v", err)
+		return nil
+	}
+	defaultChain, defaultChainConfig = nil, config
+	if len(rules) > 0 {
+		defaultChain = NewCredentialChain(rules...)
+	}
+	return defaultChain
+}
+
+// proxiedTransport is http.DefaultTransport with the proxy of the agent
+// config.
+var proxiedTransport = func() http.RoundTripper {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = agentconfig.Proxy
+	return tr
+}()
+
+// HTTPClient returns an http.Client that authenticates requests with the
+// DefaultCredentialChain, fetches them from their agentconfig.MirrorURL and
+// sends them through the agentconfig.Proxy.
+func HTTPClient(ctx context.Context) *http.Client {
+	return &http.Client{Transport: &Transport{Chain: DefaultCredentialChain(ctx), Base: proxiedTransport, Mirror: agentconfig.MirrorURL}}
+}
+
+// ParseCredentialRules parses a comma separated list of prefix=provider
+// pairs, e.g. "https://repo.example.com/=netrc,https://us-apt.pkg.dev/=gcp".
+// Providers are netrc[:path], docker[:path], gcp and command:path, see
+// NetrcProvider, DockerConfigProvider, GCPMetadataProvider and
+// CommandProvider.
+func ParseCredentialRules(s string) ([]*CredentialRule, error) {
+	var rules []*CredentialRule
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.LastIndex(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid credentials setting %q, expected prefix=provider", kv)
+		}
+		prefix, provider := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
+		if prefix != "" {
+			if _, err := parsePrefix(prefix); err != nil {
+				return nil, fmt.Errorf("invalid credentials prefix: %v", err)
+			}
+		}
+		name, arg := provider, ""
+		if j := strings.Index(provider, ":"); j >= 0 {
+			name, arg = provider[:j], provider[j+1:]
+		}
+
+		var p CredentialProvider
+		switch strings.ToLower(name) {
+		case "netrc":
+			p = &NetrcProvider{Path: arg}
+		case "docker":
+			p = &DockerConfigProvider{Path: arg}
+		case "gcp":
+			p = &GCPMetadataProvider{}
+		case "command":
+			if arg == "" {
+				return nil, fmt.Errorf("command credential provider for %q needs a path", prefix)
+			}
+			p = &CommandProvider{Path: arg}
+		default:
+			return nil, fmt.Errorf("unknown credential provider %q for %q", name, prefix)
+		}
+		rules = append(rules, &CredentialRule{Prefix: prefix, Provider: p})
+	}
+	return rules, nil
+}
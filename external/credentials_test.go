@@ -0,0 +1,264 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package external
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseNetrc(t *testing.T) {
+	data := []byte(`machine repo.example.com
+  login alice
+  password secret
+machine other.example.com login bob password hunter2
+default login anonymous password guest
+`)
+	tests := []struct {
+		host string
+		want *Credential
+	}{
+		{"repo.example.com", &Credential{Username: "alice", Password: "secret"}},
+		{"other.example.com", &Credential{Username: "bob", Password: "hunter2"}},
+		{"unknown.example.com", &Credential{Username: "anonymous", Password: "guest"}},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, parseNetrc(data, tt.host)); diff != "" {
+			t.Errorf("parseNetrc(%q) mismatch (-want +got):\n%s", tt.host, diff)
+		}
+	}
+	if got := parseNetrc([]byte("machine a login b password c"), "x"); got != nil {
+		t.Errorf("parseNetrc() without match = %+v, want nil", got)
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	// "user:pass" base64 encoded.
+	data := []byte(`{"auths": {"https://us-docker.pkg.dev/v1/": {"auth": "dXNlcjpwYXNz"}, "invalid.example.com": {"auth": "!"}}}`)
+	got, err := parseDockerConfig(data, "us-docker.pkg.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&Credential{Username: "user", Password: "pass"}, got); diff != "" {
+		t.Errorf("parseDockerConfig() mismatch (-want +got):\n%s", diff)
+	}
+	if got, err := parseDockerConfig(data, "unknown.example.com"); got != nil || err != nil {
+		t.Errorf("parseDockerConfig() without match = %+v, %v, want nil, nil", got, err)
+	}
+	if _, err := parseDockerConfig(data, "invalid.example.com"); err == nil {
+		t.Error("did not get expected error for invalid auth")
+	}
+}
+
+func TestParseCredentialRules(t *testing.T) {
+	rules, err := ParseCredentialRules("https://a.example.com/=netrc, https://b.example.com/=docker:/etc/docker.json,https://c.example.com/=gcp,=command:/usr/local/bin/creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*CredentialRule{
+		{Prefix: "https://a.example.com/", Provider: &NetrcProvider{}},
+		{Prefix: "https://b.example.com/", Provider: &DockerConfigProvider{Path: "/etc/docker.json"}},
+		{Prefix: "https://c.example.com/", Provider: &GCPMetadataProvider{}},
+		{Prefix: "", Provider: &CommandProvider{Path: "/usr/local/bin/creds"}},
+	}
+	if diff := cmp.Diff(want, rules); diff != "" {
+		t.Errorf("ParseCredentialRules() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []string{"netrc", "https://a/=unknown", "https://a/=command", "a.example.com/=netrc"} {
+		if _, err := ParseCredentialRules(s); err == nil {
+			t.Errorf("ParseCredentialRules(%q) did not return expected error", s)
+		}
+	}
+}
+
+type fakeProvider struct {
+	creds []*Credential
+	calls int
+}
+
+func (p *fakeProvider) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	c := p.creds[p.calls%len(p.creds)]
+	p.calls++
+	return c, nil
+}
+
+func TestCredentialChain(t *testing.T) {
+	none := &fakeProvider{creds: []*Credential{nil}}
+	specific := &fakeProvider{creds: []*Credential{{Token: "specific"}}}
+	general := &fakeProvider{creds: []*Credential{{Token: "general", Expiry: time.Now().Add(30 * time.Second)}}}
+	chain := NewCredentialChain(
+		&CredentialRule{Prefix: "https://repo.example.com/", Provider: general},
+		&CredentialRule{Prefix: "https://repo.example.com/private/", Provider: specific},
+		&CredentialRule{Prefix: "https://repo.example.com/public/", Provider: none},
+	)
+	ctx := context.Background()
+
+	get := func(s string) string {
+		u, _ := url.Parse(s)
+		c, err := chain.Credential(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c == nil {
+			return ""
+		}
+		return c.Token
+	}
+
+	if got := get("https://repo.example.com/private/pkg"); got != "specific" {
+		t.Errorf("longest prefix: got token %q, want %q", got, "specific")
+	}
+	get("https://repo.example.com/private/pkg")
+	if specific.calls != 1 {
+		t.Errorf("credential not cached, provider called %d times", specific.calls)
+	}
+	if got := get("https://repo.example.com/public/pkg"); got != "general" {
+		t.Errorf("fallback: got token %q, want %q", got, "general")
+	}
+	// The general token expires within the refresh margin and is not cached.
+	get("https://repo.example.com/other")
+	if general.calls != 2 {
+		t.Errorf("expiring credential cached, provider called %d times", general.calls)
+	}
+	if got := get("https://other.example.com/"); got != "" {
+		t.Errorf("no matching rule: got token %q", got)
+	}
+}
+
+func TestCredentialRuleMatches(t *testing.T) {
+	tests := []struct {
+		prefix, url string
+		want        bool
+	}{
+		{"", "https://any.example.com/", true},
+		{"https://repo.example.com", "https://repo.example.com/pkg", true},
+		{"https://repo.example.com", "https://REPO.example.com/pkg", true},
+		{"https://repo.example.com", "https://repo.example.com.evil/pkg", false},
+		{"https://repo.example.com", "https://repo.example.com:8443/pkg", false},
+		{"https://repo.example.com", "http://repo.example.com/pkg", false},
+		{"https://repo.example.com", "https://user@evil.example.com/?https://repo.example.com", false},
+		{"https://repo.example.com:8443/", "https://repo.example.com:8443/pkg", true},
+		{"https://repo.example.com/private", "https://repo.example.com/private/pkg", true},
+		{"https://repo.example.com/private", "https://repo.example.com/private", true},
+		{"https://repo.example.com/private", "https://repo.example.com/private-other/pkg", false},
+		{"https://repo.example.com/private/", "https://repo.example.com/private/pkg", true},
+		{"repo.example.com", "https://repo.example.com/pkg", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &CredentialRule{Prefix: tt.prefix}
+		if got := r.matches(u); got != tt.want {
+			t.Errorf("rule %q matches %q = %t, want %t", tt.prefix, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTransportRefreshesRejectedCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	p := &fakeProvider{creds: []*Credential{{Token: "stale"}, {Token: "fresh"}}}
+	client := &http.Client{Transport: &Transport{Chain: NewCredentialChain(&CredentialRule{Provider: p})}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if p.calls != 2 {
+		t.Errorf("provider called %d times, want 2", p.calls)
+	}
+}
+
+func TestTransportMirror(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	mirror := func(u string) string {
+		return strings.Replace(u, "https://upstream.example.com/", srv.URL+"/mirror/", 1)
+	}
+	client := &http.Client{Transport: &Transport{Mirror: mirror}}
+	resp, err := client.Get("https://upstream.example.com/repo/key.gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "/mirror/repo/key.gpg"; got != want {
+		t.Errorf("mirror got request for %q, want %q", got, want)
+	}
+}
+
+func TestGCPMetadataProvider(t *testing.T) {
+	defer func(f func(string) (string, error)) { metadataGet = f }(metadataGet)
+	metadataGet = func(string) (string, error) {
+		return `{"access_token":"token","expires_in":3599,"token_type":"Bearer"}`, nil
+	}
+	c, err := (&GCPMetadataProvider{}).Credential(context.Background(), &url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "token" || time.Until(c.Expiry) < 59*time.Minute {
+		t.Errorf("unexpected credential: %+v", c)
+	}
+}
+
+func TestCommandProvider(t *testing.T) {
+	defer func(f func(*exec.Cmd) ([]byte, error)) { runCredentialCommand = f }(runCredentialCommand)
+	var args []string
+	runCredentialCommand = func(cmd *exec.Cmd) ([]byte, error) {
+		args = cmd.Args
+		return []byte(`{"username":"user","password":"pass","expiry":"2030-01-02T03:04:05Z"}`), nil
+	}
+	u, _ := url.Parse("https://repo.example.com/pkg")
+	c, err := (&CommandProvider{Path: "/usr/local/bin/creds"}).Credential(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Credential{Username: "user", Password: "pass", Expiry: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if diff := cmp.Diff(want, c); diff != "" {
+		t.Errorf("Credential() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"/usr/local/bin/creds", u.String()}, args); diff != "" {
+		t.Errorf("command args mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
 )
 
 // FetchGCSObject fetches data from GCS bucket
@@ -36,17 +38,37 @@ func FetchGCSObject(ctx context.Context, client *storage.Client, bucket, object
 	return oh.NewReader(ctx)
 }
 
-// FetchRemoteObjectHTTP fetches data from remote location
+// fetchPolicy is the retry policy of FetchRemoteObjectHTTP.
+var fetchPolicy = retryutil.Exponential(time.Second, 30*time.Second).WithJitter(0.5).WithMaxElapsed(2 * time.Minute)
+
+// FetchRemoteObjectHTTP fetches data from remote location, retrying server
+// errors and rate limiting.
 func FetchRemoteObjectHTTP(ctx context.Context, client *http.Client, url string) (io.ReadCloser, error) {
 	clog.Debugf(ctx, "Fetching remote object: '%s'", url)
-	resp, err := client.Get(url)
+	var body io.ReadCloser
+	err := retryutil.Do(ctx, fetchPolicy, fmt.Sprintf("fetching %q", url), func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return retryutil.Permanent(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			body = resp.Body
+			return nil
+		}
+		resp.Body.Close()
+
+		err = fmt.Errorf("got http status %d when attempting to download artifact", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return err
+		}
+		return retryutil.Permanent(err)
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("got http status %d when attempting to download artifact", resp.StatusCode)
-	}
-
-	return resp.Body, nil
+	return body, nil
 }
@@ -0,0 +1,67 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package external
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+func TestFetchRemoteObjectHTTP(t *testing.T) {
+	fetchPolicy = retryutil.Policy{Initial: time.Millisecond, MaxAttempts: 3}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/flaky":
+			if requests == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("data"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	r, err := FetchRemoteObjectHTTP(ctx, ts.Client(), ts.URL+"/flaky")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "data" {
+		t.Errorf("got %q, %v, want %q", data, err, "data")
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+
+	requests = 0
+	if _, err := FetchRemoteObjectHTTP(ctx, ts.Client(), ts.URL+"/missing"); err == nil {
+		t.Error("did not get expected error")
+	}
+	if requests != 1 {
+		t.Errorf("404 was retried, got %d requests, want 1", requests)
+	}
+}
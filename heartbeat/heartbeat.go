@@ -0,0 +1,294 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package heartbeat collects the outcome of the subsystems run during one
+// agent cycle into a single summary record.
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+// SchemaVersion is the version of the Record schema, it is only increased
+// for changes that break consumers of the record.
+const SchemaVersion = 1
+
+// Subsystem names used in the Record.
+const (
+	Policies  = "policies"
+	Inventory = "inventory"
+)
+
+// Subsystem is the outcome of one subsystem in a cycle.
+type Subsystem struct {
+	Name string `json:"name"`
+	// Ran is false if the subsystem was disabled, paused or did not get to
+	// run before the agent stopped, SkipReason then says why.
+	Ran        bool      `json:"ran"`
+	SkipReason string    `json:"skip_reason,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Items      int       `json:"items"`
+	Start      time.Time `json:"start,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	// NextRun is when the subsystem is next scheduled, zero if unknown.
+	NextRun time.Time `json:"next_run,omitempty"`
+}
+
+// Record is the summary of one agent cycle.
+type Record struct {
+	SchemaVersion int          `json:"schema_version"`
+	Cycle         int64        `json:"cycle"`
+	Start         time.Time    `json:"start"`
+	DurationMs    int64        `json:"duration_ms"`
+	Subsystems    []*Subsystem `json:"subsystems"`
+}
+
+func (r *Record) String() string {
+	var parts []string
+	for _, s := range r.Subsystems {
+		switch {
+		case !s.Ran:
+			parts = append(parts, fmt.Sprintf("%s skipped (%s)", s.Name, s.SkipReason))
+		case s.Success:
+			parts = append(parts, fmt.Sprintf("%s succeeded in %dms with %d items", s.Name, s.DurationMs, s.Items))
+		default:
+			parts = append(parts, fmt.Sprintf("%s failed in %dms: %s", s.Name, s.DurationMs, s.Error))
+		}
+	}
+	return fmt.Sprintf("agent cycle %d: %s", r.Cycle, strings.Join(parts, ", "))
+}
+
+// last is the Record of the last emitted cycle.
+var last atomic.Pointer[Record]
+
+// Last returns the Record of the last emitted cycle, nil if no cycle has
+// completed yet.
+func Last() *Record {
+	return last.Load()
+}
+
+// Cycle collects the Subsystem outcomes of one agent cycle. Subsystems often
+// run asynchronously through the tasker, Emit waits for all tracked runs to
+// finish before writing the Record.
+type Cycle struct {
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	number     int64
+	start      time.Time
+	subsystems map[string]*Subsystem
+	now        func() time.Time
+}
+
+// NewCycle starts the cycle with the given number.
+func NewCycle(number int64) *Cycle {
+	return &Cycle{number: number, start: time.Now(), subsystems: map[string]*Subsystem{}, now: time.Now}
+}
+
+func (c *Cycle) subsystem(name string) *Subsystem {
+	s, ok := c.subsystems[name]
+	if !ok {
+		s = &Subsystem{Name: name}
+		c.subsystems[name] = s
+	}
+	return s
+}
+
+// Track registers a run of the named subsystem, call it before handing the
+// work to the tasker so Emit waits for it. A nil Cycle returns a nil Run, the
+// methods of which do nothing.
+func (c *Cycle) Track(name string) *Run {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.subsystem(name)
+	s.SkipReason = "did not run"
+	c.wg.Add(1)
+	return &Run{c: c, s: s}
+}
+
+// Skip records that the named subsystem did not run this cycle.
+func (c *Cycle) Skip(name, reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subsystem(name).SkipReason = reason
+}
+
+// Schedule records when the named subsystem runs next.
+func (c *Cycle) Schedule(name string, next time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subsystem(name).NextRun = next
+}
+
+// Record returns the summary of the cycle so far.
+func (c *Cycle) Record() *Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &Record{
+		SchemaVersion: SchemaVersion,
+		Cycle:         c.number,
+		Start:         c.start,
+		DurationMs:    c.now().Sub(c.start).Milliseconds(),
+	}
+	for _, s := range c.subsystems {
+		cp := *s
+		r.Subsystems = append(r.Subsystems, &cp)
+	}
+	sort.Slice(r.Subsystems, func(i, j int) bool { return r.Subsystems[i].Name < r.Subsystems[j].Name })
+	return r
+}
+
+// Emit waits for the tracked runs to finish, or ctx to be done, and logs the
+// Record as one structured log entry.
+func (c *Cycle) Emit(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	r := c.Record()
+	last.Store(r)
+	clog.InfoStructured(ctx, r, "Completed %s.", r)
+}
+
+// Run is one run of a subsystem tracked by a Cycle.
+type Run struct {
+	c       *Cycle
+	s       *Subsystem
+	started bool
+	done    bool
+}
+
+// Start marks the beginning of the run, the duration excludes any time spent
+// waiting in the tasker queue.
+func (r *Run) Start() {
+	if r == nil {
+		return
+	}
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	r.started = true
+	r.s.Ran = true
+	r.s.SkipReason = ""
+	r.s.Start = r.c.now()
+}
+
+// AddItems adds n to the number of items the run processed.
+func (r *Run) AddItems(n int) {
+	if r == nil {
+		return
+	}
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	r.s.Items += n
+}
+
+// Fail records err as the error of the run, the run is then not successful
+// no matter what Done is called with.
+func (r *Run) Fail(err error) {
+	if r == nil || err == nil {
+		return
+	}
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	r.fail(err)
+}
+
+func (r *Run) fail(err error) {
+	if r.s.Error != "" {
+		r.s.Error += "\n"
+	}
+	r.s.Error += err.Error()
+}
+
+// Skip records that the run did not do its work, e.g. because the
+// subsystem is paused. Done still has to be called.
+func (r *Run) Skip(reason string) {
+	if r == nil {
+		return
+	}
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	r.s.Ran = false
+	r.s.SkipReason = reason
+}
+
+// Done ends the run with err, which may be nil. Only the first call has an
+// effect.
+func (r *Run) Done(err error) {
+	if r == nil {
+		return
+	}
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	if err != nil {
+		r.fail(err)
+	}
+	if r.started {
+		r.s.DurationMs = r.c.now().Sub(r.s.Start).Milliseconds()
+	}
+	r.s.Success = r.s.Ran && r.s.Error == ""
+	r.c.wg.Done()
+}
+
+type cycleKey struct{}
+type runKey struct{}
+
+// WithCycle returns a copy of ctx carrying c.
+func WithCycle(ctx context.Context, c *Cycle) context.Context {
+	return context.WithValue(ctx, cycleKey{}, c)
+}
+
+// FromContext returns the Cycle of ctx, nil if there is none.
+func FromContext(ctx context.Context) *Cycle {
+	c, _ := ctx.Value(cycleKey{}).(*Cycle)
+	return c
+}
+
+// WithRun returns a copy of ctx carrying r, so code deeper down can add
+// items or failures to it.
+func WithRun(ctx context.Context, r *Run) context.Context {
+	return context.WithValue(ctx, runKey{}, r)
+}
+
+// RunFromContext returns the Run of ctx, nil if there is none.
+func RunFromContext(ctx context.Context) *Run {
+	r, _ := ctx.Value(runKey{}).(*Run)
+	return r
+}
@@ -0,0 +1,121 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCycleRecord(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	c := NewCycle(3)
+	c.start = start
+	c.now = func() time.Time { return now }
+	next := start.Add(10 * time.Minute)
+
+	ctx := WithCycle(context.Background(), c)
+	policies := FromContext(ctx).Track(Policies)
+	inventory := c.Track(Inventory)
+	c.Schedule(Policies, next)
+	c.Schedule(Inventory, next)
+
+	now = start.Add(time.Second)
+	policies.Start()
+	RunFromContext(WithRun(ctx, policies)).AddItems(4)
+	now = start.Add(3 * time.Second)
+	policies.Done(nil)
+
+	inventory.Start()
+	inventory.AddItems(200)
+	inventory.Fail(errors.New("report failed"))
+	now = start.Add(5 * time.Second)
+	inventory.Done(nil)
+	// Only the first Done counts.
+	inventory.Done(errors.New("ignored"))
+
+	c.Emit(context.Background())
+
+	want := &Record{
+		SchemaVersion: SchemaVersion,
+		Cycle:         3,
+		Start:         start,
+		DurationMs:    5000,
+		Subsystems: []*Subsystem{
+			{Name: Inventory, Ran: true, Error: "report failed", Items: 200, Start: start.Add(3 * time.Second), DurationMs: 2000, NextRun: next},
+			{Name: Policies, Ran: true, Success: true, Items: 4, Start: start.Add(time.Second), DurationMs: 2000, NextRun: next},
+		},
+	}
+	if diff := cmp.Diff(want, c.Record()); diff != "" {
+		t.Errorf("Record() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, Last()); diff != "" {
+		t.Errorf("Last() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCycleSkip(t *testing.T) {
+	c := NewCycle(1)
+	c.Skip(Policies, "disabled")
+	r := c.Track(Inventory)
+	r.Start()
+	r.Skip("paused")
+	r.Done(nil)
+
+	got := c.Record().Subsystems
+	want := []*Subsystem{
+		{Name: Inventory, SkipReason: "paused", Start: got[0].Start, DurationMs: got[0].DurationMs},
+		{Name: Policies, SkipReason: "disabled"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Record().Subsystems mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNilCycle(t *testing.T) {
+	ctx := context.Background()
+	// None of these should panic without a Cycle.
+	r := FromContext(ctx).Track(Policies)
+	r.Start()
+	r.AddItems(1)
+	r.Fail(errors.New("error"))
+	r.Done(nil)
+	RunFromContext(ctx).AddItems(1)
+	FromContext(ctx).Skip(Inventory, "disabled")
+}
+
+func TestRecordJSON(t *testing.T) {
+	r := &Record{
+		SchemaVersion: SchemaVersion,
+		Cycle:         1,
+		Start:         time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		DurationMs:    10,
+		Subsystems:    []*Subsystem{{Name: Policies, Ran: true, Success: true, Items: 2, DurationMs: 10}},
+	}
+	got, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"schema_version":1,"cycle":1,"start":"2024-05-01T10:00:00Z","duration_ms":10,"subsystems":[{"name":"policies","ran":true,"success":true,"items":2,"start":"0001-01-01T00:00:00Z","duration_ms":10,"next_run":"0001-01-01T00:00:00Z"}]}`
+	if string(got) != want {
+		t.Errorf("json.Marshal() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,220 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package hooks lets sites run their own code at well defined points of the
+// agent lifecycle, like updating a CMDB after an inventory report or
+// annotating a ticket after patching.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Point is a lifecycle point hooks can be registered for.
+type Point string
+
+// Hook points.
+const (
+	// BeforeInventory runs before the inventory is collected, the event has
+	// no data.
+	BeforeInventory Point = "before-inventory"
+	// AfterInventory runs after the inventory is reported, the event data is
+	// the reported inventory.
+	AfterInventory Point = "after-inventory"
+	// BeforePatch runs before patches are applied, the event data describes
+	// the patch task.
+	BeforePatch Point = "before-patch"
+	// AfterPatch runs once a patch task completed, succeeded or not, the
+	// event data describes the patch task and its outcome.
+	AfterPatch Point = "after-patch"
+	// AfterReboot runs when a patch task resumes after the agent rebooted the
+	// system, the event data describes the patch task. Unlike other points a
+	// failing AfterReboot hook fails the patch task, making these hooks
+	// usable as canary checks.
+	AfterReboot Point = "after-reboot"
+	// InventoryAnomaly runs when the inventory changed in an unusual way since
+	// the last report, like many packages being removed at once, the event
+	// data lists the anomalies. These are high priority events meant to be
+	// forwarded to alerting or SIEM systems.
+	InventoryAnomaly Point = "inventory-anomaly"
+	// PolicyDrift runs when an inventory shows packages out of the state the
+	// guest policies want, or back in it without the policies having been
+	// applied again, the event data is the drift report.
+	PolicyDrift Point = "policy-drift"
+	// InventoryChange runs when packages were installed, removed, upgraded
+	// or downgraded, or new updates became available, since the last
+	// inventory, the event data lists the changes.
+	InventoryChange Point = "inventory-change"
+)
+
+var points = []Point{BeforeInventory, AfterInventory, BeforePatch, AfterPatch, AfterReboot, InventoryAnomaly, PolicyDrift, InventoryChange}
+
+// ParsePoint returns the Point named s.
+func ParsePoint(s string) (Point, error) {
+	for _, p := range points {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hook point %q", s)
+}
+
+// DefaultTimeout is the timeout of hooks registered without one.
+const DefaultTimeout = time.Minute
+
+// Event is passed to hooks, command hooks get it as JSON on stdin.
+type Event struct {
+	Point Point     `json:"point"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data,omitempty"`
+}
+
+// PatchData is the event data of the BeforePatch and AfterPatch hooks.
+type PatchData struct {
+	TaskID string `json:"taskId"`
+	DryRun bool   `json:"dryRun"`
+	// PatchConfig is the patch configuration of the task as JSON.
+	PatchConfig json.RawMessage `json:"patchConfig,omitempty"`
+	// State and ErrorMessage are the outcome of the task, only set for
+	// AfterPatch.
+	State        string `json:"state,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// RestartedServices are the services the agent restarted after
+	// patching because they used replaced files, ServicesNeedingRestart
+	// the ones that still need a manual restart. Only set for AfterPatch.
+	RestartedServices      []string `json:"restartedServices,omitempty"`
+	ServicesNeedingRestart []string `json:"servicesNeedingRestart,omitempty"`
+}
+
+// Func is a Go hook. The context passed to it is canceled once the hook
+// timeout expires.
+type Func func(ctx context.Context, e *Event) error
+
+type hook struct {
+	name    string
+	timeout time.Duration
+	f       Func
+}
+
+var (
+	hooks   = map[Point][]hook{}
+	hooksMx sync.RWMutex
+
+	runner = util.CommandRunner(&util.DefaultRunner{})
+)
+
+// Register registers a Go hook to run at point p. Hooks run in the order they
+// are registered. A hook that does not return within timeout, or
+// DefaultTimeout if zero, is abandoned and reported as failed.
+func Register(p Point, name string, timeout time.Duration, f Func) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	hooksMx.Lock()
+	defer hooksMx.Unlock()
+	hooks[p] = append(hooks[p], hook{name: name, timeout: timeout, f: f})
+}
+
+// RegisterCommand registers an external command to run at point p, with the
+// Event passed as JSON on stdin. The command is killed if it does not exit
+// within timeout, or DefaultTimeout if zero, and a non zero exit code is
+// reported as a failure.
+func RegisterCommand(p Point, name string, timeout time.Duration, path string, args ...string) {
+	Register(p, name, timeout, func(ctx context.Context, e *Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Stdin = bytes.NewReader(data)
+		if _, stderr, err := runner.Run(ctx, cmd); err != nil {
+			return fmt.Errorf("error running %q: %v, stderr: %q", path, err, stderr)
+		}
+		return nil
+	})
+}
+
+// Unregister removes all hooks registered with name at point p.
+func Unregister(p Point, name string) {
+	hooksMx.Lock()
+	defer hooksMx.Unlock()
+	var keep []hook
+	for _, h := range hooks[p] {
+		if h.name != name {
+			keep = append(keep, h)
+		}
+	}
+	hooks[p] = keep
+}
+
+func runHook(ctx context.Context, h hook, e *Event) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("panic: %v", rec)
+			}
+		}()
+		done <- h.f(ctx, e)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("did not finish within %s", h.timeout)
+	}
+}
+
+// Run runs all hooks registered for point p with data as the event data.
+// All hooks run even if some fail, the returned error lists every failure.
+// Hooks are best effort, callers log the error and carry on.
+func Run(ctx context.Context, p Point, data any) error {
+	hooksMx.RLock()
+	hs := append([]hook(nil), hooks[p]...)
+	hooksMx.RUnlock()
+	if len(hs) == 0 {
+		return nil
+	}
+
+	e := &Event{Point: p, Time: time.Now().UTC(), Data: data}
+	var errs []string
+	for _, h := range hs {
+		clog.Debugf(ctx, "Running %s hook %q.", p, h.name)
+		if err := runHook(ctx, h, e); err != nil {
+			msg := fmt.Sprintf("%s hook %q failed: %v", p, h.name, err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
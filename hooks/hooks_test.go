@@ -0,0 +1,128 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reset() {
+	hooksMx.Lock()
+	defer hooksMx.Unlock()
+	hooks = map[Point][]hook{}
+}
+
+func TestRun(t *testing.T) {
+	defer reset()
+
+	var order []string
+	Register(BeforeInventory, "first", 0, func(_ context.Context, e *Event) error {
+		order = append(order, "first")
+		if e.Point != BeforeInventory {
+			t.Errorf("event point = %q, want %q", e.Point, BeforeInventory)
+		}
+		return nil
+	})
+	Register(BeforeInventory, "failing", 0, func(context.Context, *Event) error {
+		order = append(order, "failing")
+		return errors.New("boom")
+	})
+	Register(BeforeInventory, "last", 0, func(_ context.Context, e *Event) error {
+		order = append(order, "last")
+		if e.Data != "data" {
+			t.Errorf("event data = %v, want %q", e.Data, "data")
+		}
+		return nil
+	})
+	Register(AfterInventory, "other", 0, func(context.Context, *Event) error {
+		t.Error("hook for another point ran")
+		return nil
+	})
+
+	err := Run(context.Background(), BeforeInventory, "data")
+	if err == nil || !strings.Contains(err.Error(), `"failing" failed: boom`) {
+		t.Errorf("Run() error = %v, want failure of hook \"failing\"", err)
+	}
+	if got, want := strings.Join(order, ","), "first,failing,last"; got != want {
+		t.Errorf("hooks ran in order %q, want %q", got, want)
+	}
+
+	Unregister(BeforeInventory, "failing")
+	order = nil
+	if err := Run(context.Background(), BeforeInventory, "data"); err != nil {
+		t.Errorf("Run() after Unregister: unexpected error: %v", err)
+	}
+	if got, want := strings.Join(order, ","), "first,last"; got != want {
+		t.Errorf("hooks ran in order %q, want %q", got, want)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	defer reset()
+
+	block := make(chan struct{})
+	defer close(block)
+	Register(BeforePatch, "slow", 10*time.Millisecond, func(context.Context, *Event) error {
+		<-block
+		return nil
+	})
+	Register(BeforePatch, "panic", 0, func(context.Context, *Event) error {
+		panic("oops")
+	})
+
+	err := Run(context.Background(), BeforePatch, nil)
+	if err == nil || !strings.Contains(err.Error(), "did not finish within 10ms") || !strings.Contains(err.Error(), "panic: oops") {
+		t.Errorf("Run() error = %v, want timeout and panic failures", err)
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	defer reset()
+
+	out := filepath.Join(t.TempDir(), "event.json")
+	RegisterCommand(AfterPatch, "cat", 0, "/bin/sh", "-c", "cat > "+out)
+	RegisterCommand(AfterPatch, "fail", 0, "/bin/sh", "-c", "echo nope >&2; exit 3")
+
+	err := Run(context.Background(), AfterPatch, &PatchData{TaskID: "task", State: "SUCCEEDED"})
+	if err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Run() error = %v, want failure of hook \"fail\"", err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Point Point
+		Data  PatchData
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("hook stdin is not a JSON event: %v, %q", err, b)
+	}
+	if got.Point != AfterPatch || got.Data.TaskID != "task" || got.Data.State != "SUCCEEDED" {
+		t.Errorf("hook got event %+v", got)
+	}
+}
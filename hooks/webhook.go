@@ -0,0 +1,97 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the body of a webhook
+	// request, keyed with the webhook secret, as "sha256=<hex>".
+	SignatureHeader = "X-OSConfig-Signature"
+	// PointHeader carries the Point of the event of a webhook request.
+	PointHeader = "X-OSConfig-Event"
+)
+
+var (
+	webhookClient = &http.Client{Transport: &http.Transport{Proxy: agentconfig.Proxy}}
+	webhookPolicy = retryutil.Exponential(time.Second, 30*time.Second).WithJitter(0.2)
+)
+
+// Sign returns the value of the SignatureHeader of a webhook request with
+// body, receivers compare it to their own with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(ctx context.Context, url string, secret []byte, e *Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return retryutil.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(PointHeader, string(e.Point))
+	if len(secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	err = fmt.Errorf("webhook responded %s", resp.Status)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return retryutil.Throttled(err)
+	case resp.StatusCode >= 500:
+		return err
+	}
+	return retryutil.Permanent(err)
+}
+
+// RegisterWebhook registers a hook POSTing the Event as JSON to url at
+// point p. If secret is not empty the request is signed, see
+// SignatureHeader. Network errors and 429 and 5xx responses are retried
+// with backoff until timeout, or DefaultTimeout if zero, expires.
+func RegisterWebhook(p Point, name string, timeout time.Duration, url, secret string) {
+	Register(p, name, timeout, func(ctx context.Context, e *Event) error {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return retryutil.Do(ctx, webhookPolicy, "calling webhook "+name, func() error {
+			return postWebhook(ctx, url, []byte(secret), e, body)
+		})
+	})
+}
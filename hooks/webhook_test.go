@@ -0,0 +1,83 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+func TestRegisterWebhook(t *testing.T) {
+	defer reset()
+	defer func(old retryutil.Policy) { webhookPolicy = old }(webhookPolicy)
+	webhookPolicy = retryutil.Policy{Initial: time.Millisecond}
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), Sign([]byte("secret"), body); got != want {
+			t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+		}
+		if got := r.Header.Get(PointHeader); got != string(InventoryChange) {
+			t.Errorf("%s = %q, want %q", PointHeader, got, InventoryChange)
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil || e.Point != InventoryChange || e.Data != "data" {
+			t.Errorf("got event %s, error %v", body, err)
+		}
+		switch r.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/rejecting":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	RegisterWebhook(InventoryChange, "flaky", 0, srv.URL+"/flaky", "secret")
+	if err := Run(context.Background(), InventoryChange, "data"); err != nil {
+		t.Errorf("Run() error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("flaky webhook called %d times, want 3", calls)
+	}
+
+	reset()
+	RegisterWebhook(InventoryChange, "rejecting", 0, srv.URL+"/rejecting", "secret")
+	err := Run(context.Background(), InventoryChange, "data")
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request") {
+		t.Errorf("Run() error = %v, want the 400 response", err)
+	}
+}
+
+func TestParsePoint(t *testing.T) {
+	if p, err := ParsePoint("inventory-change"); err != nil || p != InventoryChange {
+		t.Errorf("ParsePoint(inventory-change) = %q, %v, want %q", p, err, InventoryChange)
+	}
+	if _, err := ParsePoint("before-lunch"); err == nil {
+		t.Error("ParsePoint(before-lunch) got nil error")
+	}
+}
@@ -0,0 +1,230 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+var lastPackagesFile = func() string { return filepath.Join(agentconfig.CacheDir(), "osconfig_inventory_packages.json") }
+
+// AnomalyType is the kind of an inventory Anomaly.
+type AnomalyType string
+
+// Anomaly types.
+const (
+	// AnomalyMassRemoval is many installed packages removed between two
+	// inventories.
+	AnomalyMassRemoval AnomalyType = "mass-removal"
+	// AnomalyCriticalDowngrade is a critical package downgraded to an older
+	// version.
+	AnomalyCriticalDowngrade AnomalyType = "critical-downgrade"
+	// AnomalyUnknownRepository is a new package or update from a repository
+	// that is not known.
+	AnomalyUnknownRepository AnomalyType = "unknown-repository"
+)
+
+// Anomaly is an unusual change between two inventories of the same instance.
+type Anomaly struct {
+	Type AnomalyType `json:"type"`
+	// Priority is always "high", anomalies warrant immediate attention.
+	Priority string              `json:"priority"`
+	Message  string              `json:"message"`
+	Packages []*packages.PkgInfo `json:"packages,omitempty"`
+}
+
+// AnomalyConfig configures which inventory changes are flagged as anomalies.
+type AnomalyConfig struct {
+	// Removals flags the removal of at least this many installed packages
+	// between two inventories, 0 disables the check.
+	Removals int
+	// Critical are the names of the packages whose downgrade is flagged.
+	Critical []string
+	// Repositories are the known repositories, new packages and updates from
+	// any other repository are flagged. Empty disables the check.
+	Repositories []string
+}
+
+// Enabled reports whether any anomaly check is configured.
+func (c AnomalyConfig) Enabled() bool {
+	return c.Removals > 0 || len(c.Critical) > 0 || len(c.Repositories) > 0
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ParseAnomalyConfig parses a comma separated list of key=value pairs, e.g.
+// "removals=20,critical=openssl;kernel,repositories=BaseOS;AppStream". Valid
+// keys are removals, a number, and critical and repositories, semicolon
+// separated lists.
+func ParseAnomalyConfig(s string) (AnomalyConfig, error) {
+	var c AnomalyConfig
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return AnomalyConfig{}, fmt.Errorf("invalid anomaly setting %q, expected key=value", kv)
+		}
+
+		switch k := strings.ToLower(strings.TrimSpace(parts[0])); k {
+		case "removals":
+			n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || n < 0 {
+				return AnomalyConfig{}, fmt.Errorf("invalid removals threshold %q", parts[1])
+			}
+			c.Removals = n
+		case "critical":
+			c.Critical = splitList(parts[1])
+		case "repositories":
+			c.Repositories = splitList(parts[1])
+		default:
+			return AnomalyConfig{}, fmt.Errorf("invalid anomaly setting key %q", parts[0])
+		}
+	}
+	return c, nil
+}
+
+type pkgList struct {
+	prev, cur []*packages.PkgInfo
+	// installed is false for lists of available updates.
+	installed bool
+	// compare compares versions, nil if downgrades can't be detected.
+	compare func(a, b string) int
+}
+
+func pkgLists(prev, cur *packages.Packages) []pkgList {
+	return []pkgList{
+		{prev.Rpm, cur.Rpm, true, packages.CompareRPMEVR},
+		{prev.Deb, cur.Deb, true, packages.CompareDebVersions},
+		{prev.COS, cur.COS, true, nil},
+		{prev.Gem, cur.Gem, true, nil},
+		{prev.Pip, cur.Pip, true, nil},
+		{prev.Brew, cur.Brew, true, nil},
+		{prev.GooGet, cur.GooGet, true, nil},
+		{prev.Yum, cur.Yum, false, nil},
+		{prev.Apt, cur.Apt, false, nil},
+		{prev.Zypper, cur.Zypper, false, nil},
+	}
+}
+
+func anomalyKey(p *packages.PkgInfo) string {
+	return p.Name + "." + p.Arch
+}
+
+// DetectAnomalies compares the packages of two consecutive inventories and
+// returns the changes that are anomalies according to c. prev is nil for
+// the first inventory, which has nothing to compare against.
+//
+// A list of installed packages that became empty is taken to be a
+// collection failure rather than every package having been removed.
+func DetectAnomalies(prev, cur *packages.Packages, c AnomalyConfig) []*Anomaly {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	critical := map[string]bool{}
+	for _, n := range c.Critical {
+		critical[n] = true
+	}
+	known := map[string]bool{}
+	for _, r := range c.Repositories {
+		known[r] = true
+	}
+
+	var removed, downgraded, unknown []*packages.PkgInfo
+	for _, l := range pkgLists(prev, cur) {
+		before := map[string]*packages.PkgInfo{}
+		for _, p := range l.prev {
+			before[anomalyKey(p)] = p
+		}
+		after := map[string]bool{}
+		for _, p := range l.cur {
+			after[anomalyKey(p)] = true
+			old, ok := before[anomalyKey(p)]
+			if !ok && len(known) > 0 && p.Repository != "" && !known[p.Repository] {
+				unknown = append(unknown, p)
+			}
+			if ok && l.compare != nil && critical[p.Name] && l.compare(p.Version, old.Version) < 0 {
+				downgraded = append(downgraded, p)
+			}
+		}
+		if l.installed && len(l.cur) > 0 {
+			for _, p := range l.prev {
+				if !after[anomalyKey(p)] {
+					removed = append(removed, p)
+				}
+			}
+		}
+	}
+
+	var anomalies []*Anomaly
+	if c.Removals > 0 && len(removed) >= c.Removals {
+		anomalies = append(anomalies, &Anomaly{Type: AnomalyMassRemoval, Priority: "high", Message: fmt.Sprintf("%d packages removed", len(removed)), Packages: removed})
+	}
+	if len(downgraded) > 0 {
+		anomalies = append(anomalies, &Anomaly{Type: AnomalyCriticalDowngrade, Priority: "high", Message: fmt.Sprintf("%d critical packages downgraded", len(downgraded)), Packages: downgraded})
+	}
+	if len(unknown) > 0 {
+		anomalies = append(anomalies, &Anomaly{Type: AnomalyUnknownRepository, Priority: "high", Message: fmt.Sprintf("%d new packages from unknown repositories", len(unknown)), Packages: unknown})
+	}
+	return anomalies
+}
+
+// LoadLastPackages loads the packages saved by SaveLastPackages, a missing
+// file returns nil.
+func LoadLastPackages() (*packages.Packages, error) {
+	data, err := ioutil.ReadFile(lastPackagesFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := packages.UnmarshalPackages(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing last inventory packages %q: %v", lastPackagesFile(), err)
+	}
+	return pkgs, nil
+}
+
+// SaveLastPackages persists pkgs for the next DetectAnomalies.
+func SaveLastPackages(pkgs *packages.Packages) error {
+	data, err := packages.MarshalPackages(pkgs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lastPackagesFile()), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(lastPackagesFile(), data, 0600)
+}
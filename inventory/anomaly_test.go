@@ -0,0 +1,108 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAnomalyConfig(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    AnomalyConfig
+		wantErr bool
+	}{
+		{"", AnomalyConfig{}, false},
+		{"removals=20, critical=openssl;kernel ,repositories=BaseOS", AnomalyConfig{Removals: 20, Critical: []string{"openssl", "kernel"}, Repositories: []string{"BaseOS"}}, false},
+		{"removals=-1", AnomalyConfig{}, true},
+		{"removals", AnomalyConfig{}, true},
+		{"unknown=1", AnomalyConfig{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAnomalyConfig(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAnomalyConfig(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ParseAnomalyConfig(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	prev := &packages.Packages{
+		Rpm: []*packages.PkgInfo{
+			{Name: "openssl", Arch: "x86_64", Version: "1:1.1.1k-9.el8"},
+			{Name: "a", Arch: "x86_64", Version: "1.0"},
+			{Name: "b", Arch: "x86_64", Version: "1.0"},
+		},
+		Deb: []*packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "5.1-2"}},
+		Yum: []*packages.PkgInfo{{Name: "a", Arch: "x86_64", Version: "2.0", Repository: "BaseOS"}},
+	}
+	cur := &packages.Packages{
+		Rpm: []*packages.PkgInfo{
+			{Name: "openssl", Arch: "x86_64", Version: "1:1.1.1k-7.el8"},
+		},
+		// Deb is empty, a collection failure and not a removal.
+		Yum: []*packages.PkgInfo{
+			{Name: "a", Arch: "x86_64", Version: "2.0", Repository: "BaseOS"},
+			{Name: "evil", Arch: "x86_64", Version: "1.0", Repository: "mirror.example.com"},
+		},
+	}
+	cfg := AnomalyConfig{Removals: 2, Critical: []string{"openssl"}, Repositories: []string{"BaseOS"}}
+
+	want := []*Anomaly{
+		{Type: AnomalyMassRemoval, Priority: "high", Message: "2 packages removed", Packages: prev.Rpm[1:]},
+		{Type: AnomalyCriticalDowngrade, Priority: "high", Message: "1 critical packages downgraded", Packages: cur.Rpm},
+		{Type: AnomalyUnknownRepository, Priority: "high", Message: "1 new packages from unknown repositories", Packages: cur.Yum[1:]},
+	}
+	if diff := cmp.Diff(want, DetectAnomalies(prev, cur, cfg)); diff != "" {
+		t.Errorf("DetectAnomalies() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := DetectAnomalies(nil, cur, cfg); got != nil {
+		t.Errorf("DetectAnomalies() without previous inventory = %+v, want nil", got)
+	}
+	if got := DetectAnomalies(prev, prev, cfg); got != nil {
+		t.Errorf("DetectAnomalies() without changes = %+v, want nil", got)
+	}
+}
+
+func TestLastPackages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "packages.json")
+	lastPackagesFile = func() string { return file }
+
+	got, err := LoadLastPackages()
+	if err != nil || got != nil {
+		t.Fatalf("LoadLastPackages() without file = %+v, %v, want nil, nil", got, err)
+	}
+
+	want := &packages.Packages{Rpm: []*packages.PkgInfo{{Name: "a", Arch: "x86_64", Version: "1.0"}}}
+	if err := SaveLastPackages(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadLastPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadLastPackages() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,169 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// AnonymizeMode is how a field is anonymized.
+type AnonymizeMode string
+
+const (
+	// AnonymizeNone leaves the field as is.
+	AnonymizeNone AnonymizeMode = ""
+	// AnonymizeHash replaces the value with a stable hash, see HashValue.
+	AnonymizeHash AnonymizeMode = "hash"
+	// AnonymizeStrip removes the value.
+	AnonymizeStrip AnonymizeMode = "strip"
+)
+
+// AnonymizeConfig configures which parts of an inventory are anonymized
+// before it is reported.
+type AnonymizeConfig struct {
+	// Hostname applies to InstanceInventory.Hostname.
+	Hostname AnonymizeMode
+	// Usernames applies to user names found in home directory paths, like
+	// /home/<user> or C:\Users\<user>, in any reported value.
+	Usernames AnonymizeMode
+	// Paths applies to any reported value that is an absolute file path.
+	Paths AnonymizeMode
+	// Key is used to key the hash, using the same key (e.g. the project
+	// number) on all hosts keeps hashed values comparable across hosts.
+	Key string
+}
+
+// Enabled reports whether any anonymization is configured.
+func (c AnonymizeConfig) Enabled() bool {
+	return c.Hostname != AnonymizeNone || c.Usernames != AnonymizeNone || c.Paths != AnonymizeNone
+}
+
+// ParseAnonymizeConfig parses a comma separated list of field=mode pairs,
+// e.g. "hostname=hash,usernames=strip". Valid fields are hostname, usernames
+// and paths, valid modes are hash, strip and none.
+func ParseAnonymizeConfig(s, key string) (AnonymizeConfig, error) {
+	c := AnonymizeConfig{Key: key}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return AnonymizeConfig{}, fmt.Errorf("invalid anonymization setting %q, expected field=mode", kv)
+		}
+
+		var mode AnonymizeMode
+		switch m := strings.ToLower(strings.TrimSpace(parts[1])); m {
+		case "none":
+			mode = AnonymizeNone
+		case string(AnonymizeHash), string(AnonymizeStrip):
+			mode = AnonymizeMode(m)
+		default:
+			return AnonymizeConfig{}, fmt.Errorf("invalid anonymization mode %q for %q", parts[1], parts[0])
+		}
+
+		switch f := strings.ToLower(strings.TrimSpace(parts[0])); f {
+		case "hostname":
+			c.Hostname = mode
+		case "usernames":
+			c.Usernames = mode
+		case "paths":
+			c.Paths = mode
+		default:
+			return AnonymizeConfig{}, fmt.Errorf("invalid anonymization field %q", parts[0])
+		}
+	}
+	return c, nil
+}
+
+// HashValue returns the stable hash used to pseudonymize values:
+// "anon-" followed by the first 16 bytes, hex encoded, of
+// HMAC-SHA256(key, value). The same key and value always produce the same
+// hash so reports can still be deduplicated centrally.
+func HashValue(key, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+var (
+	homeDirRe = regexp.MustCompile(`(?i)(/home/|/Users/|[a-z]:\\Users\\)([^/\\]+)`)
+	absPathRe = regexp.MustCompile(`(?i)^(/|[a-z]:\\|\\\\)`)
+)
+
+func (c AnonymizeConfig) apply(mode AnonymizeMode, value string) string {
+	switch {
+	case value == "":
+		return value
+	case mode == AnonymizeHash:
+		return HashValue(c.Key, value)
+	case mode == AnonymizeStrip:
+		return ""
+	}
+	return value
+}
+
+func (c AnonymizeConfig) anonymizeString(s string) string {
+	if c.Paths != AnonymizeNone && absPathRe.MatchString(s) {
+		return c.apply(c.Paths, s)
+	}
+	if c.Usernames != AnonymizeNone {
+		s = homeDirRe.ReplaceAllStringFunc(s, func(m string) string {
+			sub := homeDirRe.FindStringSubmatch(m)
+			return sub[1] + c.apply(c.Usernames, sub[2])
+		})
+	}
+	return s
+}
+
+func (c AnonymizeConfig) anonymizeValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			c.anonymizeValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				c.anonymizeValue(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.anonymizeValue(v.Index(i))
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(c.anonymizeString(v.String()))
+		}
+	}
+}
+
+// Anonymize applies the anonymization configured in c to the inventory,
+// modifying it in place.
+func Anonymize(state *InstanceInventory, c AnonymizeConfig) {
+	if state == nil || !c.Enabled() {
+		return
+	}
+	state.Hostname = c.apply(c.Hostname, state.Hostname)
+	c.anonymizeValue(reflect.ValueOf(state))
+}
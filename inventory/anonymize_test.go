@@ -0,0 +1,88 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+func TestParseAnonymizeConfig(t *testing.T) {
+	got, err := ParseAnonymizeConfig(" hostname=hash, usernames=STRIP,paths=none ", "123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := AnonymizeConfig{Hostname: AnonymizeHash, Usernames: AnonymizeStrip, Key: "123"}
+	if got != want {
+		t.Errorf("ParseAnonymizeConfig() = %+v, want %+v", got, want)
+	}
+
+	for _, s := range []string{"hostname", "hostname=foo", "foo=hash"} {
+		if _, err := ParseAnonymizeConfig(s, ""); err == nil {
+			t.Errorf("ParseAnonymizeConfig(%q): did not get expected error", s)
+		}
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	if HashValue("key", "host") != HashValue("key", "host") {
+		t.Errorf("HashValue is not stable")
+	}
+	if HashValue("key", "host") == HashValue("other", "host") {
+		t.Errorf("HashValue does not depend on the key")
+	}
+	if got := len(HashValue("key", "host")); got != len("anon-")+32 {
+		t.Errorf("len(HashValue()) = %d, want %d", got, len("anon-")+32)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	state := &InstanceInventory{
+		Hostname:  "build-host-1",
+		ShortName: "debian",
+		InstalledPackages: &packages.Packages{
+			Pip: []*packages.PkgInfo{{Name: "/home/alice/venv/foo", Version: "1.0"}},
+			WindowsApplication: []*packages.WindowsApplication{
+				{DisplayName: `Tool installed in C:\Users\bob\AppData`, HelpLink: "https://example.com"},
+			},
+		},
+	}
+
+	Anonymize(state, AnonymizeConfig{Hostname: AnonymizeHash, Usernames: AnonymizeHash, Key: "123"})
+
+	want := &InstanceInventory{
+		Hostname:  HashValue("123", "build-host-1"),
+		ShortName: "debian",
+		InstalledPackages: &packages.Packages{
+			Pip: []*packages.PkgInfo{{Name: "/home/" + HashValue("123", "alice") + "/venv/foo", Version: "1.0"}},
+			WindowsApplication: []*packages.WindowsApplication{
+				{DisplayName: `Tool installed in C:\Users\` + HashValue("123", "bob") + `\AppData`, HelpLink: "https://example.com"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("Anonymize() = %+v, want %+v", state, want)
+	}
+
+	Anonymize(state, AnonymizeConfig{Paths: AnonymizeStrip})
+	if got := state.InstalledPackages.Pip[0].Name; got != "" {
+		t.Errorf("path was not stripped, got %q", got)
+	}
+	if got := state.InstalledPackages.WindowsApplication[0].HelpLink; got != "https://example.com" {
+		t.Errorf("non path value was modified, got %q", got)
+	}
+}
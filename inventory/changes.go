@@ -0,0 +1,150 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+var lastInventoryFile = func() string { return filepath.Join(agentconfig.CacheDir(), "osconfig_inventory_last.json") }
+
+// ChangeType is the kind of a Change.
+type ChangeType string
+
+// The ChangeTypes.
+const (
+	PackageInstalled ChangeType = "package-installed"
+	PackageRemoved   ChangeType = "package-removed"
+	// PackageUpgraded is also used for version changes of packages whose
+	// versions can't be compared.
+	PackageUpgraded   ChangeType = "package-upgraded"
+	PackageDowngraded ChangeType = "package-downgraded"
+	// UpdateAvailable is a new update, or a newer version of an update that
+	// was already available.
+	UpdateAvailable ChangeType = "update-available"
+)
+
+// Change is a change between two consecutive inventories.
+type Change struct {
+	Event ChangeType `json:"event"`
+	PackageChange
+}
+
+var versionCompare = map[string]func(a, b string) int{
+	"deb": packages.CompareDebVersions,
+	"rpm": packages.CompareRPMEVR,
+}
+
+// Changes returns the changes from prev to cur, prev is nil for the first
+// inventory which has nothing to compare against.
+//
+// A list of installed packages that became empty is taken to be a
+// collection failure rather than every package having been removed.
+func Changes(prev, cur *InstanceInventory) []*Change {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	var changes []*Change
+	installed := DiffPackages(prev.InstalledPackages, cur.InstalledPackages)
+	for _, c := range installed.Added {
+		changes = append(changes, &Change{PackageInstalled, *c})
+	}
+	lists := diffLists(cur.InstalledPackages)
+	for _, c := range installed.Removed {
+		if len(lists[c.Type]) > 0 {
+			changes = append(changes, &Change{PackageRemoved, *c})
+		}
+	}
+	for _, c := range installed.Changed {
+		event := PackageUpgraded
+		if compare, ok := versionCompare[c.Type]; ok && compare(c.To, c.From) < 0 {
+			event = PackageDowngraded
+		}
+		changes = append(changes, &Change{event, *c})
+	}
+
+	updates := DiffPackages(prev.PackageUpdates, cur.PackageUpdates)
+	for _, c := range append(updates.Added, updates.Changed...) {
+		changes = append(changes, &Change{UpdateAvailable, *c})
+	}
+	return changes
+}
+
+// lastInventory is the part of the InstanceInventory Changes compares.
+type lastInventory struct {
+	Installed json.RawMessage `json:"installed,omitempty"`
+	Updates   json.RawMessage `json:"updates,omitempty"`
+}
+
+// LoadLastInventory loads the packages and updates saved by
+// SaveLastInventory, a missing file returns nil.
+func LoadLastInventory() (*InstanceInventory, error) {
+	data, err := os.ReadFile(lastInventoryFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var last lastInventory
+	if err := json.Unmarshal(data, &last); err != nil {
+		return nil, fmt.Errorf("error parsing last inventory %q: %v", lastInventoryFile(), err)
+	}
+	state := &InstanceInventory{}
+	for _, l := range []struct {
+		data json.RawMessage
+		dst  **packages.Packages
+	}{{last.Installed, &state.InstalledPackages}, {last.Updates, &state.PackageUpdates}} {
+		if len(l.data) == 0 {
+			continue
+		}
+		if *l.dst, err = packages.UnmarshalPackages(l.data); err != nil {
+			return nil, fmt.Errorf("error parsing last inventory %q: %v", lastInventoryFile(), err)
+		}
+	}
+	return state, nil
+}
+
+// SaveLastInventory persists the packages and updates of state for the next
+// Changes.
+func SaveLastInventory(state *InstanceInventory) error {
+	var last lastInventory
+	var err error
+	if state.InstalledPackages != nil {
+		if last.Installed, err = packages.MarshalPackages(state.InstalledPackages); err != nil {
+			return err
+		}
+	}
+	if state.PackageUpdates != nil {
+		if last.Updates, err = packages.MarshalPackages(state.PackageUpdates); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(last)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lastInventoryFile()), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(lastInventoryFile(), data, 0600)
+}
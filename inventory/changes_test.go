@@ -0,0 +1,89 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+func TestChanges(t *testing.T) {
+	prev := &InstanceInventory{
+		InstalledPackages: &packages.Packages{Deb: []*packages.PkgInfo{
+			{Name: "bash", Arch: "amd64", Version: "5.2-1"},
+			{Name: "openssl", Arch: "amd64", Version: "3.0.11-1"},
+			{Name: "vim", Arch: "amd64", Version: "2:9.0-1"},
+		}},
+		PackageUpdates: &packages.Packages{Apt: []*packages.PkgInfo{{Name: "bash", Arch: "amd64", Version: "5.2-2"}}},
+	}
+	cur := &InstanceInventory{
+		InstalledPackages: &packages.Packages{Deb: []*packages.PkgInfo{
+			{Name: "bash", Arch: "amd64", Version: "5.2-2"},
+			{Name: "curl", Arch: "amd64", Version: "7.88-1"},
+			{Name: "openssl", Arch: "amd64", Version: "3.0.9-1"},
+		}},
+		PackageUpdates: &packages.Packages{Apt: []*packages.PkgInfo{{Name: "openssl", Arch: "amd64", Version: "3.0.11-1"}}},
+	}
+	want := []*Change{
+		{PackageInstalled, PackageChange{Type: "deb", Name: "curl", Arch: "amd64", To: "7.88-1"}},
+		{PackageRemoved, PackageChange{Type: "deb", Name: "vim", Arch: "amd64", From: "2:9.0-1"}},
+		{PackageUpgraded, PackageChange{Type: "deb", Name: "bash", Arch: "amd64", From: "5.2-1", To: "5.2-2"}},
+		{PackageDowngraded, PackageChange{Type: "deb", Name: "openssl", Arch: "amd64", From: "3.0.11-1", To: "3.0.9-1"}},
+		{UpdateAvailable, PackageChange{Type: "apt", Name: "openssl", Arch: "amd64", To: "3.0.11-1"}},
+	}
+	if got := Changes(prev, cur); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("Changes() = %s, want %s", gotJSON, wantJSON)
+	}
+
+	if got := Changes(nil, cur); got != nil {
+		t.Errorf("Changes(nil, cur) = %v, want nil", got)
+	}
+	// A failed collection is not every package removed.
+	if got := Changes(prev, &InstanceInventory{InstalledPackages: &packages.Packages{}}); len(got) != 0 {
+		gotJSON, _ := json.Marshal(got)
+		t.Errorf("Changes() with no installed packages = %s, want none", gotJSON)
+	}
+}
+
+func TestLastInventory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "last.json")
+	defer func(old func() string) { lastInventoryFile = old }(lastInventoryFile)
+	lastInventoryFile = func() string { return file }
+
+	if got, err := LoadLastInventory(); err != nil || got != nil {
+		t.Fatalf("LoadLastInventory() without a file = %v, %v, want nil, nil", got, err)
+	}
+	state := &InstanceInventory{
+		Hostname:          "host",
+		InstalledPackages: &packages.Packages{Rpm: []*packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "5.1-1"}}},
+	}
+	if err := SaveLastInventory(state); err != nil {
+		t.Fatalf("SaveLastInventory() error: %v", err)
+	}
+	got, err := LoadLastInventory()
+	if err != nil {
+		t.Fatalf("LoadLastInventory() error: %v", err)
+	}
+	want := &InstanceInventory{InstalledPackages: state.InstalledPackages}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadLastInventory() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,284 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/sbom"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Exports are written for hosts that can't report the inventory, each
+// export is a set of files named after its time:
+//
+//	20240102T150405Z.inventory.json  the InstanceInventory, format json
+//	20240102T150405Z.diff.json       the PackageDiff to the previous
+//	                                 export, format json
+//	20240102T150405Z.spdx.json       the SPDX SBOM, format spdx
+
+const exportTimeFormat = "20060102T150405Z"
+
+var exportSuffixes = []string{".inventory.json", ".diff.json", ".spdx.json"}
+
+// ExportConfig configures Export.
+type ExportConfig struct {
+	Dir string
+	// Formats are "json", the inventory and the diff to the previous
+	// export, and "spdx".
+	Formats []string
+	// Keep is the number of exports kept, 0 keeps all of them.
+	Keep int
+	// MaxAge is the age at which exports are removed, 0 keeps them.
+	MaxAge time.Duration
+}
+
+// PackageChange is a package added, removed or changed between two
+// inventories.
+type PackageChange struct {
+	// Type is the JSON name of the list of the package in
+	// packages.Packages, e.g. "deb" or "wua".
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Arch string `json:"arch,omitempty"`
+	// From is the version before, empty for added packages.
+	From string `json:"from,omitempty"`
+	// To is the version after, empty for removed packages.
+	To string `json:"to,omitempty"`
+}
+
+// PackageDiff are the changes of the installed packages, or of the
+// available updates, between two inventories.
+type PackageDiff struct {
+	// Since is the LastUpdated of the previous inventory.
+	Since   string           `json:"since"`
+	Added   []*PackageChange `json:"added,omitempty"`
+	Removed []*PackageChange `json:"removed,omitempty"`
+	Changed []*PackageChange `json:"changed,omitempty"`
+}
+
+// diffEntry is a package of any type in a form DiffPackages can compare.
+type diffEntry struct {
+	key     string
+	name    string
+	arch    string
+	version string
+}
+
+func pkgInfoEntries(pkgs []*packages.PkgInfo) []diffEntry {
+	var entries []diffEntry
+	for _, p := range pkgs {
+		entries = append(entries, diffEntry{anomalyKey(p), p.Name, p.Arch, p.Version})
+	}
+	return entries
+}
+
+// diffLists returns the lists of packages of p by type, Windows
+// applications are not part of the JSON inventory and are left out.
+func diffLists(p *packages.Packages) map[string][]diffEntry {
+	if p == nil {
+		p = &packages.Packages{}
+	}
+	lists := map[string][]diffEntry{
+		"yum":    pkgInfoEntries(p.Yum),
+		"apt":    pkgInfoEntries(p.Apt),
+		"zypper": pkgInfoEntries(p.Zypper),
+		"rpm":    pkgInfoEntries(p.Rpm),
+		"deb":    pkgInfoEntries(p.Deb),
+		"cos":    pkgInfoEntries(p.COS),
+		"gem":    pkgInfoEntries(p.Gem),
+		"pip":    pkgInfoEntries(p.Pip),
+		"brew":   pkgInfoEntries(p.Brew),
+		"googet": pkgInfoEntries(p.GooGet),
+	}
+	for _, u := range p.WUA {
+		lists["wua"] = append(lists["wua"], diffEntry{u.UpdateID, u.Title, "", strconv.Itoa(int(u.RevisionNumber))})
+	}
+	for _, q := range p.QFE {
+		lists["qfe"] = append(lists["qfe"], diffEntry{q.HotFixID, q.HotFixID, "", ""})
+	}
+	for _, m := range p.MSI {
+		lists["msi"] = append(lists["msi"], diffEntry{m.ProductCode, m.ProductName, "", m.Version})
+	}
+	return lists
+}
+
+// DiffPackages returns the changes of the packages from prev to cur, sorted
+// by type and name.
+func DiffPackages(prev, cur *packages.Packages) *PackageDiff {
+	d := &PackageDiff{}
+	before, after := diffLists(prev), diffLists(cur)
+	var types []string
+	for typ := range after {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for _, typ := range types {
+		old := map[string]diffEntry{}
+		for _, e := range before[typ] {
+			old[e.key] = e
+		}
+		seen := map[string]bool{}
+		for _, e := range after[typ] {
+			seen[e.key] = true
+			o, ok := old[e.key]
+			switch {
+			case !ok:
+				d.Added = append(d.Added, &PackageChange{Type: typ, Name: e.name, Arch: e.arch, To: e.version})
+			case o.version != e.version:
+				d.Changed = append(d.Changed, &PackageChange{Type: typ, Name: e.name, Arch: e.arch, From: o.version, To: e.version})
+			}
+		}
+		for _, e := range before[typ] {
+			if !seen[e.key] {
+				d.Removed = append(d.Removed, &PackageChange{Type: typ, Name: e.name, Arch: e.arch, From: e.version})
+			}
+		}
+	}
+	for _, changes := range [][]*PackageChange{d.Added, d.Removed, d.Changed} {
+		sort.SliceStable(changes, func(i, j int) bool {
+			if changes[i].Type != changes[j].Type {
+				return changes[i].Type < changes[j].Type
+			}
+			return changes[i].Name < changes[j].Name
+		})
+	}
+	return d
+}
+
+// exportTimes returns the times of the exports in dir, newest first.
+func exportTimes(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var times []string
+	for _, e := range entries {
+		for _, suffix := range exportSuffixes {
+			ts := strings.TrimSuffix(e.Name(), suffix)
+			if ts == e.Name() {
+				continue
+			}
+			if _, err := time.Parse(exportTimeFormat, ts); err == nil && !seen[ts] {
+				seen[ts] = true
+				times = append(times, ts)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(times)))
+	return times, nil
+}
+
+// lastExport loads the newest inventory exported to dir, nil if there is
+// none.
+func lastExport(dir string) (*InstanceInventory, error) {
+	times, err := exportTimes(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range times {
+		data, err := os.ReadFile(filepath.Join(dir, ts+".inventory.json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var state InstanceInventory
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("error parsing exported inventory %s: %v", ts, err)
+		}
+		return &state, nil
+	}
+	return nil, nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.AtomicWrite(path, data, 0600)
+}
+
+// Export writes state to c.Dir in the configured formats, named after now,
+// and removes the exports that are beyond c.Keep or older than c.MaxAge.
+func Export(state *InstanceInventory, c ExportConfig, now time.Time) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	base := filepath.Join(c.Dir, now.UTC().Format(exportTimeFormat))
+	for _, format := range c.Formats {
+		switch format {
+		case "json":
+			prev, err := lastExport(c.Dir)
+			if err != nil {
+				return err
+			}
+			if err := writeJSON(base+".inventory.json", state); err != nil {
+				return err
+			}
+			if prev == nil {
+				continue
+			}
+			d := DiffPackages(prev.InstalledPackages, state.InstalledPackages)
+			d.Since = prev.LastUpdated
+			if err := writeJSON(base+".diff.json", d); err != nil {
+				return err
+			}
+		case "spdx":
+			doc := sbom.New(state.Hostname, state.InstalledPackages, sbom.Distro(state.ShortName), sbom.Created(now))
+			if err := writeJSON(base+".spdx.json", doc); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown inventory export format %q, want json or spdx", format)
+		}
+	}
+	return pruneExports(c, now)
+}
+
+func pruneExports(c ExportConfig, now time.Time) error {
+	times, err := exportTimes(c.Dir)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for i, ts := range times {
+		t, _ := time.Parse(exportTimeFormat, ts)
+		if (c.Keep <= 0 || i < c.Keep) && (c.MaxAge <= 0 || now.Sub(t) <= c.MaxAge) {
+			continue
+		}
+		for _, suffix := range exportSuffixes {
+			if err := os.Remove(filepath.Join(c.Dir, ts+suffix)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("error removing old inventory exports: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
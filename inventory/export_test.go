@@ -0,0 +1,112 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+func TestDiffPackages(t *testing.T) {
+	prev := &packages.Packages{
+		Deb: []*packages.PkgInfo{{Name: "bash", Arch: "amd64", Version: "5.1"}, {Name: "vim", Arch: "amd64", Version: "8.2"}},
+		QFE: []*packages.QFEPackage{{HotFixID: "KB1"}},
+	}
+	cur := &packages.Packages{
+		Deb: []*packages.PkgInfo{{Name: "bash", Arch: "amd64", Version: "5.2"}, {Name: "curl", Arch: "amd64", Version: "7.88"}},
+		QFE: []*packages.QFEPackage{{HotFixID: "KB1"}, {HotFixID: "KB2"}},
+	}
+	want := &PackageDiff{
+		Added:   []*PackageChange{{Type: "deb", Name: "curl", Arch: "amd64", To: "7.88"}, {Type: "qfe", Name: "KB2"}},
+		Removed: []*PackageChange{{Type: "deb", Name: "vim", Arch: "amd64", From: "8.2"}},
+		Changed: []*PackageChange{{Type: "deb", Name: "bash", Arch: "amd64", From: "5.1", To: "5.2"}},
+	}
+	if got := DiffPackages(prev, cur); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("DiffPackages() = %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestExport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "inventory")
+	c := ExportConfig{Dir: dir, Formats: []string{"json", "spdx"}, Keep: 2}
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	versions := []string{"5.0", "5.1", "5.2"}
+	for i, v := range versions {
+		state := &InstanceInventory{
+			Hostname:          "host",
+			LastUpdated:       v,
+			InstalledPackages: &packages.Packages{Deb: []*packages.PkgInfo{{Name: "bash", Arch: "amd64", Version: v}}},
+		}
+		if err := Export(state, c, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Export(%s) error: %v", v, err)
+		}
+	}
+
+	want := []string{
+		"20240102T160000Z.diff.json", "20240102T160000Z.inventory.json", "20240102T160000Z.spdx.json",
+		"20240102T170000Z.diff.json", "20240102T170000Z.inventory.json", "20240102T170000Z.spdx.json",
+	}
+	if got := listDir(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("exported files = %q, want %q", got, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "20240102T170000Z.diff.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d PackageDiff
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Since != "5.1" || len(d.Changed) != 1 || d.Changed[0].From != "5.1" || d.Changed[0].To != "5.2" {
+		t.Errorf("diff = %+v, want bash changed from 5.1 to 5.2 since 5.1", d)
+	}
+
+	// MaxAge removes the exports older than it, whatever Keep is.
+	c = ExportConfig{Dir: dir, Formats: []string{"spdx"}, MaxAge: 30 * time.Minute}
+	if err := Export(&InstanceInventory{}, c, start.Add(3*time.Hour)); err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	if got, want := listDir(t, dir), []string{"20240102T180000Z.spdx.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exported files = %q, want %q", got, want)
+	}
+
+	if err := Export(&InstanceInventory{}, ExportConfig{Dir: dir, Formats: []string{"xml"}}, start); err == nil {
+		t.Error("Export() with an unknown format got nil error")
+	}
+}
@@ -0,0 +1,155 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Windows hosts accumulate years of installed updates and applications, the
+// functions below keep the reported history to a manageable size.
+
+var historyAckFile = func() string { return filepath.Join(agentconfig.CacheDir(), "osconfig_inventory_history.json") }
+
+// HistoryAck records the Windows update and application history entries
+// already acknowledged by the service.
+type HistoryAck struct {
+	WUA          map[string]bool `json:"wua,omitempty"`
+	Applications map[string]bool `json:"applications,omitempty"`
+}
+
+func wuaKey(p *packages.WUAPackage) string {
+	return fmt.Sprintf("%s/%d", p.UpdateID, p.RevisionNumber)
+}
+
+func applicationKey(a *packages.WindowsApplication) string {
+	return a.DisplayName + "/" + a.DisplayVersion + "/" + a.Publisher
+}
+
+// LimitHistoryDepth drops installed WUA updates and Windows applications
+// last changed more than days before now. Entries without a date are kept,
+// days <= 0 keeps everything.
+func LimitHistoryDepth(state *InstanceInventory, days int, now time.Time) {
+	if days <= 0 || state.InstalledPackages == nil {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	pkgs := state.InstalledPackages
+
+	var wua []*packages.WUAPackage
+	for _, p := range pkgs.WUA {
+		if p.LastDeploymentChangeTime.IsZero() || !p.LastDeploymentChangeTime.Before(cutoff) {
+			wua = append(wua, p)
+		}
+	}
+	pkgs.WUA = wua
+
+	var apps []*packages.WindowsApplication
+	for _, a := range pkgs.WindowsApplication {
+		if a.InstallDate.IsZero() || !a.InstallDate.Before(cutoff) {
+			apps = append(apps, a)
+		}
+	}
+	pkgs.WindowsApplication = apps
+}
+
+// HistoryDelta returns a copy of state with only the installed WUA updates
+// and Windows applications that are not in ack. state is not modified.
+func HistoryDelta(state *InstanceInventory, ack *HistoryAck) *InstanceInventory {
+	if state.InstalledPackages == nil || ack == nil {
+		return state
+	}
+	delta := *state
+	pkgs := *state.InstalledPackages
+	delta.InstalledPackages = &pkgs
+
+	pkgs.WUA = nil
+	for _, p := range state.InstalledPackages.WUA {
+		if !ack.WUA[wuaKey(p)] {
+			pkgs.WUA = append(pkgs.WUA, p)
+		}
+	}
+	pkgs.WindowsApplication = nil
+	for _, a := range state.InstalledPackages.WindowsApplication {
+		if !ack.Applications[applicationKey(a)] {
+			pkgs.WindowsApplication = append(pkgs.WindowsApplication, a)
+		}
+	}
+	return &delta
+}
+
+// NewHistoryAck returns the HistoryAck of all history entries in state.
+// Entries no longer in state, e.g. because they fell out of the history
+// depth, are not carried over so the acknowledgement does not grow forever.
+func NewHistoryAck(state *InstanceInventory) *HistoryAck {
+	ack := &HistoryAck{WUA: map[string]bool{}, Applications: map[string]bool{}}
+	if state.InstalledPackages == nil {
+		return ack
+	}
+	for _, p := range state.InstalledPackages.WUA {
+		ack.WUA[wuaKey(p)] = true
+	}
+	for _, a := range state.InstalledPackages.WindowsApplication {
+		ack.Applications[applicationKey(a)] = true
+	}
+	return ack
+}
+
+// LoadHistoryAck loads the persisted HistoryAck, a missing file returns an
+// empty HistoryAck so the whole history is reported.
+func LoadHistoryAck() (*HistoryAck, error) {
+	ack := &HistoryAck{}
+	data, err := ioutil.ReadFile(historyAckFile())
+	if os.IsNotExist(err) {
+		return ack, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ack); err != nil {
+		return nil, fmt.Errorf("error parsing inventory history acknowledgement %q: %v", historyAckFile(), err)
+	}
+	return ack, nil
+}
+
+// SaveHistoryAck persists ack, call it once a report was accepted.
+func SaveHistoryAck(ack *HistoryAck) error {
+	data, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(historyAckFile()), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(historyAckFile(), data, 0600)
+}
+
+// ResetHistoryAck removes the persisted HistoryAck, the next report then
+// includes the whole history again.
+func ResetHistoryAck() error {
+	if err := os.Remove(historyAckFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func historyState(now time.Time) *InstanceInventory {
+	return &InstanceInventory{
+		InstalledPackages: &packages.Packages{
+			WUA: []*packages.WUAPackage{
+				{UpdateID: "old", RevisionNumber: 1, LastDeploymentChangeTime: now.AddDate(-2, 0, 0)},
+				{UpdateID: "new", RevisionNumber: 1, LastDeploymentChangeTime: now.AddDate(0, 0, -1)},
+				{UpdateID: "undated", RevisionNumber: 1},
+			},
+			WindowsApplication: []*packages.WindowsApplication{
+				{DisplayName: "old", InstallDate: now.AddDate(-1, 0, 0)},
+				{DisplayName: "new", InstallDate: now},
+			},
+			QFE: []*packages.QFEPackage{{HotFixID: "KB1"}},
+		},
+		PackageUpdates: &packages.Packages{
+			WUA: []*packages.WUAPackage{{UpdateID: "available", LastDeploymentChangeTime: now.AddDate(-3, 0, 0)}},
+		},
+	}
+}
+
+func TestLimitHistoryDepth(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	state := historyState(now)
+	LimitHistoryDepth(state, 30, now)
+
+	var wua []string
+	for _, p := range state.InstalledPackages.WUA {
+		wua = append(wua, p.UpdateID)
+	}
+	if diff := cmp.Diff([]string{"new", "undated"}, wua); diff != "" {
+		t.Errorf("WUA mismatch (-want +got):\n%s", diff)
+	}
+	if len(state.InstalledPackages.WindowsApplication) != 1 || state.InstalledPackages.WindowsApplication[0].DisplayName != "new" {
+		t.Errorf("unexpected WindowsApplication: %+v", state.InstalledPackages.WindowsApplication)
+	}
+	// Available updates are not history.
+	if len(state.PackageUpdates.WUA) != 1 {
+		t.Errorf("available WUA updates should not be limited, got %+v", state.PackageUpdates.WUA)
+	}
+
+	state = historyState(now)
+	LimitHistoryDepth(state, 0, now)
+	if len(state.InstalledPackages.WUA) != 3 || len(state.InstalledPackages.WindowsApplication) != 2 {
+		t.Errorf("depth 0 should keep everything, got %+v", state.InstalledPackages)
+	}
+}
+
+func TestHistoryDelta(t *testing.T) {
+	ackFile := filepath.Join(t.TempDir(), "ack.json")
+	historyAckFile = func() string { return ackFile }
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	state := historyState(now)
+
+	ack, err := LoadHistoryAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := HistoryDelta(state, ack); len(got.InstalledPackages.WUA) != 3 || len(got.InstalledPackages.WindowsApplication) != 2 {
+		t.Errorf("without acknowledgement the whole history should be reported, got %+v", got.InstalledPackages)
+	}
+
+	if err := SaveHistoryAck(NewHistoryAck(state)); err != nil {
+		t.Fatal(err)
+	}
+	ack, err = LoadHistoryAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := historyState(now)
+	next.InstalledPackages.WUA = append(next.InstalledPackages.WUA, &packages.WUAPackage{UpdateID: "newer", RevisionNumber: 1})
+	// A new revision of an acknowledged update is reported again.
+	next.InstalledPackages.WUA[1].RevisionNumber = 2
+	got := HistoryDelta(next, ack)
+
+	var wua []string
+	for _, p := range got.InstalledPackages.WUA {
+		wua = append(wua, p.UpdateID)
+	}
+	if diff := cmp.Diff([]string{"new", "newer"}, wua); diff != "" {
+		t.Errorf("WUA mismatch (-want +got):\n%s", diff)
+	}
+	if len(got.InstalledPackages.WindowsApplication) != 0 {
+		t.Errorf("unexpected WindowsApplication: %+v", got.InstalledPackages.WindowsApplication)
+	}
+	if len(got.InstalledPackages.QFE) != 1 || len(next.InstalledPackages.WUA) != 4 {
+		t.Errorf("HistoryDelta should only filter history and not modify its input")
+	}
+
+	if err := ResetHistoryAck(); err != nil {
+		t.Fatal(err)
+	}
+	if ack, err := LoadHistoryAck(); err != nil || len(ack.WUA) != 0 {
+		t.Errorf("LoadHistoryAck() after reset = %+v, %v", ack, err)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/cloudtags"
 	"github.com/GoogleCloudPlatform/osconfig/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
 )
@@ -39,6 +40,8 @@ type InstanceInventory struct {
 	InstalledPackages    *packages.Packages
 	PackageUpdates       *packages.Packages
 	LastUpdated          string
+	// Tags are the cloud tags of the instance, see cloudtags.Fetch.
+	Tags map[string]string `json:",omitempty"`
 }
 
 // Get generates inventory data.
@@ -55,7 +58,7 @@ func Get(ctx context.Context) *InstanceInventory {
 		clog.Errorf(ctx, "packages.GetPackageUpdates() error: %v", err)
 	}
 
-	oi, err := osinfo.Get()
+	oi, err := osinfo.Get(ctx)
 	if err != nil {
 		clog.Errorf(ctx, "osinfo.Get() error: %v", err)
 	}
@@ -72,5 +75,6 @@ func Get(ctx context.Context) *InstanceInventory {
 		InstalledPackages:    installedPackages,
 		PackageUpdates:       packageUpdates,
 		LastUpdated:          time.Now().UTC().Format(time.RFC3339),
+		Tags:                 cloudtags.Current(),
 	}
 }
@@ -0,0 +1,38 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import "sync"
+
+var (
+	latest   *InstanceInventory
+	latestMx sync.RWMutex
+)
+
+// SetLatest records state as the last reported inventory, see Latest.
+func SetLatest(state *InstanceInventory) {
+	latestMx.Lock()
+	defer latestMx.Unlock()
+	latest = state
+}
+
+// Latest returns the last reported inventory, nil if no inventory was
+// reported since the agent started. The returned inventory must not be
+// modified.
+func Latest() *InstanceInventory {
+	latestMx.RLock()
+	defer latestMx.RUnlock()
+	return latest
+}
@@ -16,7 +16,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -24,8 +27,10 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"syscall"
 	"time"
@@ -33,10 +38,27 @@ import (
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/agentendpoint"
+	"github.com/GoogleCloudPlatform/osconfig/agenthttp"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/cloudtags"
+	"github.com/GoogleCloudPlatform/osconfig/control"
+	"github.com/GoogleCloudPlatform/osconfig/doctor"
+	"github.com/GoogleCloudPlatform/osconfig/exporter"
+	"github.com/GoogleCloudPlatform/osconfig/heartbeat"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"github.com/GoogleCloudPlatform/osconfig/inventory"
+	"github.com/GoogleCloudPlatform/osconfig/maintenance"
+	"github.com/GoogleCloudPlatform/osconfig/metrics"
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
 	"github.com/GoogleCloudPlatform/osconfig/policies"
+	"github.com/GoogleCloudPlatform/osconfig/policy"
+	"github.com/GoogleCloudPlatform/osconfig/sbom"
+	"github.com/GoogleCloudPlatform/osconfig/sdnotify"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 	"github.com/GoogleCloudPlatform/osconfig/tasker"
 	"github.com/GoogleCloudPlatform/osconfig/util"
+	"github.com/GoogleCloudPlatform/osconfig/vulnreport"
 	"github.com/tarm/serial"
 
 	_ "net/http/pprof"
@@ -55,10 +77,16 @@ func init() {
 	}
 	// We do this here so the -X value doesn't need the full path.
 	agentconfig.SetVersion(version)
+	util.SetCommandObserver(observeCommand)
 
 	os.MkdirAll(filepath.Dir(agentconfig.RestartFile()), 0755)
 }
 
+// observeCommand records the duration of the commands the agent runs.
+func observeCommand(_ context.Context, cmd *exec.Cmd, d time.Duration, err error) {
+	metrics.CommandDuration.ObserveDuration(d, filepath.Base(cmd.Path), metrics.Result(err))
+}
+
 type serialPort struct {
 	port string
 }
@@ -76,6 +104,10 @@ func (s *serialPort) Write(b []byte) (int, error) {
 
 var deferredFuncs []func()
 
+// started is closed once the agent has finished starting up, the service
+// control handlers use it to report when the agent is running.
+var started = make(chan struct{})
+
 // RegisterAgent is a blocking call, the RPC itself has retry logic baked in
 // with jitter and backoff up to a total of 10 minutes.
 // If client creation or register agent (after retries) fail we then wait for
@@ -105,9 +137,37 @@ func run(ctx context.Context) {
 	if runtime.GOOS == "windows" {
 		opts.Writers = append(opts.Writers, &serialPort{"COM1"})
 	}
+	if path := agentconfig.LogFile(); path != "" {
+		f, err := clog.NewRotatingFile(path, clog.RotateOptions{
+			MaxSize:    agentconfig.LogFileMaxSize(),
+			MaxAge:     agentconfig.LogFileMaxAge(),
+			MaxBackups: agentconfig.LogFileMaxBackups(),
+			Retention:  agentconfig.LogFileRetention(),
+		})
+		if err != nil {
+			fmt.Printf("Error opening log file %q: %v\n", path, err)
+		} else {
+			opts.Writers = append(opts.Writers, f)
+			deferredFuncs = append(deferredFuncs, func() { f.Close() })
+		}
+	}
+	if agentconfig.LogFormat() == "json" {
+		opts.FormatFunction = clog.FormatJSON
+	}
+
+	if err := agentconfig.LoadConfigFile(); err != nil {
+		logger.Init(ctx, opts)
+		logger.Fatalf("Agent cannot start: %v", err)
+	}
 
 	// If this call to WatchConfig fails (like a metadata error) we can't continue.
-	if err := agentconfig.WatchConfig(ctx); err != nil {
+	// It retries the metadata server for up to a minute, keep extending the
+	// systemd start timeout so a slow metadata server doesn't fail the start.
+	sdnotify.Status("Reading agent configuration from metadata.")
+	stopKeepAlive := sdnotify.KeepAlive(ctx, time.Minute)
+	err := agentconfig.WatchConfig(ctx)
+	stopKeepAlive()
+	if err != nil {
 		logger.Init(ctx, opts)
 		logger.Fatalf("Error parsing metadata, agent cannot start: %v", err.Error())
 	}
@@ -120,6 +180,24 @@ func run(ctx context.Context) {
 		os.Exit(1)
 	}
 	ctx = clog.WithLabels(ctx, map[string]string{"instance_name": agentconfig.Name()})
+	for _, sink := range agentconfig.LogSinks() {
+		var s clog.Sink
+		var err error
+		switch sink {
+		case "syslog":
+			s, err = clog.NewSyslogSink(agentconfig.SyslogAddress(), opts.LoggerName)
+		case "journald":
+			s, err = clog.NewJournaldSink(opts.LoggerName)
+		default:
+			err = fmt.Errorf("unknown log sink %q", sink)
+		}
+		if err != nil {
+			clog.Errorf(ctx, "Error setting up log sink: %v", err)
+			continue
+		}
+		clog.AddSink(s)
+	}
+	deferredFuncs = append(deferredFuncs, clog.CloseSinks)
 
 	// Remove any existing restart file.
 	if err := os.Remove(agentconfig.RestartFile()); err != nil && !os.IsNotExist(err) {
@@ -141,14 +219,30 @@ func run(ctx context.Context) {
 		}
 	})
 
-	deferredFuncs = append(deferredFuncs, logger.Close, func() { clog.Infof(ctx, "OSConfig Agent (version %s) shutting down.", agentconfig.Version()) })
+	deferredFuncs = append(deferredFuncs, logger.Close, func() {
+		sdnotify.Stopping()
+		clog.Infof(ctx, "OSConfig Agent (version %s) shutting down.", agentconfig.Version())
+	})
 
 	obtainLock()
 
+	// Before the first task is queued.
+	tasker.SetWorkers(agentconfig.TaskWorkers())
+	tasker.SetCapacity(agentconfig.TaskQueueCapacity())
+
 	// obtainLock adds functions to clear the lock at close.
 	logger.DeferredFatalFuncs = append(logger.DeferredFatalFuncs, deferredFuncs...)
 
 	clog.Infof(ctx, "OSConfig Agent (version %s) started.", agentconfig.Version())
+	if err := sdnotify.Ready(); err != nil {
+		clog.Errorf(ctx, "Error notifying systemd of agent startup: %v", err)
+	}
+	close(started)
+
+	// Cloud tags are added to inventory and task logs, refresh them hourly
+	// so changes on the cloud side show up without an agent restart.
+	cloudtags.Refresh(ctx, agentconfig.CloudTags())
+	go cloudtags.Watch(ctx, time.Hour, agentconfig.CloudTags)
 
 	// Call RegisterAgent at least once every day, on start calling
 	// of RegisterAgent is handled in the service loop.
@@ -169,15 +263,24 @@ func run(ctx context.Context) {
 		if err != nil {
 			logger.Fatalf(err.Error())
 		}
-		tasker.Enqueue(ctx, "Report OSInventory", func() {
+		tasker.Enqueue(ctx, "Report OSInventory", func(ctx context.Context) {
 			client.ReportInventory(ctx)
 		})
-		tasker.Close()
+		tasker.Close(context.Background())
 		return
 	case "gp", "policies", "guestpolicies", "ospackage":
 		policies.Run(ctx)
-		tasker.Close()
+		tasker.Close(context.Background())
 		return
+	// provision blocks until the guest policies are applied or the deadline,
+	// 30m by default, passes and exits with a code reporting the outcome.
+	case "provision":
+		code := provision(ctx, flag.Arg(1))
+		tasker.Close(context.Background())
+		for _, f := range deferredFuncs {
+			f()
+		}
+		os.Exit(code)
 	case "w", "waitfortasknotification", "ospatch":
 		client, err := agentendpoint.NewClient(ctx)
 		if err != nil {
@@ -192,13 +295,94 @@ func run(ctx context.Context) {
 	}
 }
 
+// applyConfig applies the agent config to the subsystems reading it once.
+func applyConfig() {
+	logger.SetDebugLogging(agentconfig.Debug())
+	clog.DebugEnabled = agentconfig.Debug()
+	packages.SetProtectedPackages(agentconfig.ProtectedPackages())
+	packages.SetCommandAudit(agentconfig.CommandAudit(), agentconfig.CommandAuditRedact())
+	packages.SetCommandEnv(agentconfig.ProxyEnv())
+	packages.SetInventoryDBCache(agentconfig.FeatureEnabled(agentconfig.FeatureInventoryDBCache))
+	registerWebhooks()
+	registerExporters()
+}
+
+// webhookHooks are the hooks registered by registerWebhooks, removed again
+// when the config changes.
+var webhookHooks = map[hooks.Point][]string{}
+
+func registerWebhooks() {
+	for p, names := range webhookHooks {
+		for _, name := range names {
+			hooks.Unregister(p, name)
+		}
+	}
+	webhookHooks = map[hooks.Point][]string{}
+	for _, w := range agentconfig.Webhooks() {
+		name := "webhook:" + w.URL
+		for _, event := range w.Events {
+			p, err := hooks.ParsePoint(event)
+			if err != nil {
+				logger.Errorf("Not registering webhook %s for %q: %v", w.URL, event, err)
+				continue
+			}
+			hooks.RegisterWebhook(p, name, w.Timeout, w.URL, w.Secret)
+			webhookHooks[p] = append(webhookHooks[p], name)
+		}
+	}
+}
+
+// exporterHooks are the hooks registered by registerExporters and
+// exporters their exporters, removed and closed when the config changes.
+var (
+	exporterHooks = map[hooks.Point][]string{}
+	exporters     []exporter.Exporter
+)
+
+func registerExporters() {
+	for p, names := range exporterHooks {
+		for _, name := range names {
+			hooks.Unregister(p, name)
+		}
+	}
+	for _, e := range exporters {
+		e.Close()
+	}
+	exporterHooks, exporters = map[hooks.Point][]string{}, nil
+	for _, c := range agentconfig.Exporters() {
+		e, err := exporter.New(context.Background(), c.URL)
+		if err != nil {
+			logger.Errorf("Not registering exporter %s: %v", c.URL, err)
+			continue
+		}
+		exporters = append(exporters, e)
+		points := exporter.DefaultEvents
+		if len(c.Events) > 0 {
+			points = nil
+			for _, event := range c.Events {
+				p, err := hooks.ParsePoint(event)
+				if err != nil {
+					logger.Errorf("Not registering exporter %s for %q: %v", c.URL, event, err)
+					continue
+				}
+				points = append(points, p)
+			}
+		}
+		name := "exporter:" + c.URL
+		for _, p := range points {
+			exporter.Register(p, name, c.Timeout, e)
+			exporterHooks[p] = append(exporterHooks[p], name)
+		}
+	}
+}
+
 func runTaskLoop(ctx context.Context, c chan struct{}) {
 	var taskNotificationClient *agentendpoint.Client
 	var err error
+	// Apply config changes so that customers don't need to restart the agent.
+	applyConfig()
+	defer agentconfig.Subscribe(applyConfig)()
 	for {
-		// Set debug logging settings so that customers don't need to restart the agent.
-		logger.SetDebugLogging(agentconfig.Debug())
-		clog.DebugEnabled = agentconfig.Debug()
 		if agentconfig.TaskNotificationEnabled() && taskNotificationClient == nil {
 			// Call RegisterAgent now since we just either started running or were just enabled.
 			// This call is blocking until successful as we can't continue unless register agent has completed.
@@ -226,7 +410,7 @@ func runTaskLoop(ctx context.Context, c chan struct{}) {
 		default:
 		}
 
-		// Wait on any metadata config change.
+		// Wait on any metadata or config file change.
 		if err := agentconfig.WatchConfig(ctx); err != nil {
 			clog.Errorf(ctx, err.Error())
 		}
@@ -239,6 +423,194 @@ func runTaskLoop(ctx context.Context, c chan struct{}) {
 	}
 }
 
+// exportMetrics serves the metrics on -metrics_address and writes them to
+// -metrics_textfile every minute until ctx is done.
+func exportMetrics(ctx context.Context) {
+	if addr := agentconfig.MetricsAddress(); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", agenthttp.MetricsHandler())
+		srv := &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				clog.Errorf(ctx, "Error serving metrics on %s: %v", addr, err)
+			}
+		}()
+	}
+
+	path := agentconfig.MetricsTextfile()
+	if path == "" {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		var b bytes.Buffer
+		agenthttp.WriteMetrics(&b)
+		if err := util.AtomicWrite(path, b.Bytes(), 0644); err != nil {
+			clog.Errorf(ctx, "Error writing metrics to %s: %v", path, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serveInventory serves the last reported inventory on -inventory_address
+// until ctx is done.
+func serveInventory(ctx context.Context) {
+	addr := agentconfig.InventoryAddress()
+	if addr == "" {
+		return
+	}
+	if !agenthttp.IsLoopback(addr) {
+		clog.Errorf(ctx, "Not serving inventory on %s, -inventory_address must be a loopback address like localhost:9753.", addr)
+		return
+	}
+	h := agenthttp.InventoryHandler("")
+	mux := http.NewServeMux()
+	mux.Handle("/inventory", h)
+	mux.Handle("/inventory/", h)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		clog.Errorf(ctx, "Error serving inventory on %s: %v", addr, err)
+	}
+}
+
+// exportInventory exports the inventory to the directory of the
+// inventory.export setting on its interval until ctx is done, for hosts
+// that can't report it. When the setting changes the exports are
+// rescheduled, canceling a running one.
+func exportInventory(ctx context.Context) {
+	var interval time.Duration
+	var enabled bool
+	stop := func() {}
+	schedule := func() {
+		i, e := agentconfig.InventoryExportInterval(), agentconfig.InventoryExportDir() != ""
+		if i == interval && e == enabled {
+			return
+		}
+		stop()
+		stop = func() {}
+		interval, enabled = i, e
+		if !enabled {
+			return
+		}
+		var rctx context.Context
+		rctx, stop = context.WithCancel(ctx)
+		tasker.EnqueueRecurringWithPriority(rctx, "Export OSInventory", tasker.PriorityLow, i, 0, func(ctx context.Context) {
+			dir := agentconfig.InventoryExportDir()
+			if dir == "" {
+				return
+			}
+			c := inventory.ExportConfig{
+				Dir:     dir,
+				Formats: agentconfig.InventoryExportFormats(),
+				Keep:    agentconfig.InventoryExportKeep(),
+				MaxAge:  agentconfig.InventoryExportMaxAge(),
+			}
+			if err := inventory.Export(inventory.Get(ctx), c, time.Now()); err != nil {
+				clog.Errorf(ctx, "Error exporting inventory to %s: %v", dir, err)
+			}
+		}, tasker.Coalesce())
+	}
+	schedule()
+	defer agentconfig.Subscribe(schedule)()
+	<-ctx.Done()
+}
+
+func newControlServer(ctx context.Context) *control.Server {
+	return control.NewServer(ctx, func(ctx context.Context) {
+		client, err := agentendpoint.NewClient(ctx)
+		if err != nil {
+			clog.Errorf(ctx, err.Error())
+			return
+		}
+		defer client.Close()
+		client.ReportInventory(ctx)
+	})
+}
+
+// serveControl serves the control API on -control_socket until ctx is done.
+func serveControl(ctx context.Context, s *control.Server) {
+	path := agentconfig.ControlSocket()
+	if path == "" {
+		return
+	}
+	if err := control.Serve(ctx, path, s); err != nil {
+		clog.Errorf(ctx, "Error serving the control API on %s: %v", path, err)
+	}
+}
+
+// maintenanceWindows returns a function returning the maintenance windows
+// of the config, windows that can't be parsed are reported once and left
+// out.
+func maintenanceWindows(ctx context.Context) func() []*maintenance.Window {
+	var last []agentconfig.MaintenanceWindow
+	var windows []*maintenance.Window
+	return func() []*maintenance.Window {
+		cfg := agentconfig.MaintenanceWindows()
+		if reflect.DeepEqual(cfg, last) {
+			return windows
+		}
+		last, windows = cfg, nil
+		for _, c := range cfg {
+			schedule, err := maintenance.ParseCron(c.Schedule)
+			if err != nil {
+				clog.Errorf(ctx, "Ignoring maintenance window %q: %v", c.Name, err)
+				continue
+			}
+			loc, err := time.LoadLocation(c.TimeZone)
+			if err != nil {
+				clog.Errorf(ctx, "Ignoring maintenance window %q: %v", c.Name, err)
+				continue
+			}
+			windows = append(windows, &maintenance.Window{
+				Name:     c.Name,
+				Schedule: schedule,
+				Duration: c.Duration,
+				Location: loc,
+				Patch:    &control.PatchRequest{Excludes: c.Excludes, Security: c.Security, Minimal: c.Minimal, Reboot: c.Reboot},
+			})
+		}
+		return windows
+	}
+}
+
+// newMaintenanceScheduler returns the scheduler of the patches in the
+// maintenance windows of the config. They run like the patch tasks of the
+// service, reboots included, and show on the control API, see
+// control.Server.RunPatch.
+func newMaintenanceScheduler(s *control.Server) *maintenance.Scheduler {
+	history := maintenance.NewHistory(filepath.Join(agentconfig.CacheDir(), "osconfig_patch_durations.json"))
+	started := filepath.Join(agentconfig.CacheDir(), "osconfig_maintenance_started.json")
+	return maintenance.NewScheduler(history, started, func(ctx context.Context, req *control.PatchRequest) error {
+		_, err := s.RunPatch(ctx, req)
+		return err
+	})
+}
+
+// restoreTasks keeps the queued patch runs and inventory reports in a
+// journal from now on, and queues the ones that were queued when the agent
+// last stopped again. It has to run before any of them is queued.
+func restoreTasks(ctx context.Context, ctl *control.Server, scheduler *maintenance.Scheduler) {
+	tasker.SetJournal(filepath.Join(agentconfig.CacheDir(), "osconfig_task_journal.json"))
+	ctl.RegisterTasks()
+	scheduler.RegisterTasks()
+	if err := tasker.Restore(ctx); err != nil {
+		clog.Errorf(ctx, "Error restoring the queued tasks: %v", err)
+	}
+}
+
 // Runs internal functions that need to run on an interval.
 func runInternalPeriodics(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Minute)
@@ -246,7 +618,10 @@ func runInternalPeriodics(ctx context.Context) {
 	for {
 		if _, err := os.Stat(agentconfig.RestartFile()); err == nil {
 			clog.Infof(ctx, "Restart required marker file exists, beginning agent shutdown, waiting for tasks to complete.")
-			tasker.Close()
+			sdnotify.Stopping()
+			stop := sdnotify.KeepAlive(ctx, 5*time.Minute)
+			tasker.Close(context.Background())
+			stop()
 			clog.Infof(ctx, "All tasks completed, stopping agent.")
 			for _, f := range deferredFuncs {
 				f()
@@ -265,6 +640,15 @@ func runInternalPeriodics(ctx context.Context) {
 
 func runServiceLoop(ctx context.Context) {
 	go runInternalPeriodics(ctx)
+	go agentconfig.WatchConfigFile(ctx)
+	go exportMetrics(ctx)
+	go serveInventory(ctx)
+	ctl := newControlServer(ctx)
+	scheduler := newMaintenanceScheduler(ctl)
+	restoreTasks(ctx, ctl, scheduler)
+	go serveControl(ctx, ctl)
+	go scheduler.Run(ctx, maintenanceWindows(ctx))
+	go exportInventory(ctx)
 
 	// This is just to ensure WaitForTaskNotification runs before any other tasks.
 	c := make(chan struct{})
@@ -274,17 +658,37 @@ func runServiceLoop(ctx context.Context) {
 	<-c
 
 	// Runs functions that need to run on a set interval.
-	ticker := time.NewTicker(agentconfig.SvcPollInterval())
+	interval := agentconfig.SvcPollInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	defer agentconfig.Subscribe(func() {
+		if i := agentconfig.SvcPollInterval(); i > 0 && i != interval {
+			interval = i
+			ticker.Reset(i)
+		}
+	})()
 	// First inventory run will be somewhere between 3 and 5 min.
 	firstInventory := time.After(time.Duration(rand.Intn(120)+180) * time.Second)
 	ranFirstInventory := false
+	var cycleNumber int64
 	for {
+		// Each cycle is summarized in one heartbeat record once the
+		// subsystems it started are done.
+		cycleNumber++
+		cycle := heartbeat.NewCycle(cycleNumber)
+		cctx := heartbeat.WithCycle(ctx, cycle)
+		next := time.Now().Add(agentconfig.SvcPollInterval())
+
 		if agentconfig.GuestPoliciesEnabled() {
-			policies.Run(ctx)
+			policies.Run(cctx)
+			cycle.Schedule(heartbeat.Policies, next)
+		} else {
+			cycle.Skip(heartbeat.Policies, "disabled")
 		}
 
-		if agentconfig.OSInventoryEnabled() {
+		if !agentconfig.OSInventoryEnabled() {
+			cycle.Skip(heartbeat.Inventory, "disabled")
+		} else {
 			if !ranFirstInventory {
 				// Only run first inventory after the set waiting period or if the main poll ticker ticks.
 				// The default SvcPollInterval is 10min so under normal circumstances firstInventory will
@@ -299,15 +703,28 @@ func runServiceLoop(ctx context.Context) {
 			}
 
 			// This should always run after ospackage.SetConfig.
-			tasker.Enqueue(ctx, "Report OSInventory", func() {
+			r := cycle.Track(heartbeat.Inventory)
+			// Routine inventory reports must not hold up patch runs.
+			err := tasker.EnqueueWithPriority(ctx, "Report OSInventory", tasker.PriorityLow, func(ctx context.Context) {
+				r.Start()
+				defer r.Done(nil)
 				client, err := agentendpoint.NewClient(ctx)
 				if err != nil {
 					logger.Errorf(err.Error())
+					r.Fail(err)
+					return
 				}
-				client.ReportInventory(ctx)
+				client.ReportInventory(heartbeat.WithRun(ctx, r))
 				client.Close()
-			})
+			}, tasker.Persistent(control.InventoryKind, nil))
+			if err != nil {
+				// The task never runs, so it cannot end the run.
+				logger.Errorf("Error queueing the inventory report: %v", err)
+				r.Done(err)
+			}
+			cycle.Schedule(heartbeat.Inventory, time.Now().Add(agentconfig.SvcPollInterval()))
 		}
+		go cycle.Emit(ctx)
 
 		select {
 		case <-ticker.C:
@@ -318,6 +735,191 @@ func runServiceLoop(ctx context.Context) {
 	}
 }
 
+func pauseOrResume(action, subsystem, duration string) error {
+	if subsystem == "" {
+		return fmt.Errorf("usage: %s <subsystem> [duration], subsystems: %q", action, agentconfig.Subsystems)
+	}
+	if action == "resume" {
+		if err := agentconfig.Resume(subsystem); err != nil {
+			return err
+		}
+		fmt.Printf("Resumed %s.\n", subsystem)
+		return nil
+	}
+
+	var d time.Duration
+	if duration != "" {
+		var err error
+		if d, err = time.ParseDuration(duration); err != nil {
+			return fmt.Errorf("invalid pause duration %q: %v", duration, err)
+		}
+	}
+	if err := agentconfig.Pause(subsystem, d); err != nil {
+		return err
+	}
+	fmt.Println(agentconfig.PauseMessage(subsystem) + ".")
+	return nil
+}
+
+func runDoctor(ctx context.Context, format string) error {
+	d := doctor.SelfTest(ctx)
+	switch format {
+	case "":
+		fmt.Print(d)
+	case "json":
+		out, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	default:
+		return fmt.Errorf("unknown doctor output format %q, valid formats are \"json\" or none", format)
+	}
+	if !d.Healthy() {
+		return errors.New("self test found problems")
+	}
+	return nil
+}
+
+func runPolicy(ctx context.Context, action, path string) error {
+	if path == "" {
+		return errors.New("usage: policy check|plan|apply <path>")
+	}
+	d, err := policy.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rep *policy.Report
+	switch action {
+	case "check":
+		rep = policy.Evaluate(ctx, d)
+	case "plan":
+		rep = policy.Plan(ctx, d)
+	case "apply":
+		rep = policy.Converge(ctx, d)
+		policy.Record(ctx, d, rep, path)
+	default:
+		return fmt.Errorf("unknown policy action %q, valid actions are \"check\", \"plan\" or \"apply\"", action)
+	}
+	fmt.Print(rep)
+	if !rep.Compliant() {
+		return errors.New("the host is not compliant")
+	}
+	return nil
+}
+
+// runSBOM writes the SBOM of the installed packages in format, "spdx" or
+// "cyclonedx", to path, or to stdout if path is empty.
+func runSBOM(ctx context.Context, format, path string) error {
+	if format != "spdx" && format != "cyclonedx" {
+		return fmt.Errorf("unknown SBOM format %q, want spdx or cyclonedx", format)
+	}
+	oi, err := osinfo.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting OS info: %v", err)
+	}
+	pkgs, err := packages.GetInstalledPackages(ctx)
+	if err != nil {
+		// Report what could be listed, the SBOM is still useful.
+		fmt.Fprintf(os.Stderr, "Error listing some installed packages: %v\n", err)
+	}
+	opts := []sbom.Option{sbom.Distro(oi.ShortName)}
+	if g, err := packages.DependencyGraph(ctx); err == nil {
+		opts = append(opts, sbom.Dependencies(g))
+	}
+
+	var doc any
+	if format == "cyclonedx" {
+		if packages.RPMQueryExists {
+			if h, err := packages.RPMHeaderDigests(ctx); err == nil {
+				opts = append(opts, sbom.RPMHashes(h))
+			}
+		}
+		doc = sbom.NewCycloneDX(oi.Hostname, pkgs, opts...)
+	} else {
+		doc = sbom.New(oi.Hostname, pkgs, opts...)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(string(out))
+		return nil
+	}
+	return util.AtomicWrite(path, out, 0644)
+}
+
+// runVulnReport prints the vulnerability report of the host, as a table or
+// as JSON if format is "json". The advisories are the yum security
+// advisories and the OSV records in osvDir, if set.
+func runVulnReport(ctx context.Context, format, osvDir string) error {
+	if format != "" && format != "json" {
+		return fmt.Errorf("unknown vulnreport output format %q, valid formats are \"json\" or none", format)
+	}
+	oi, err := osinfo.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting OS info: %v", err)
+	}
+	var advisories []*vulnreport.Advisory
+	if packages.YumExists {
+		advs, err := packages.YumAdvisories(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing yum advisories: %v", err)
+		}
+		advisories = vulnreport.FromUpdateInfo(advs)
+	}
+	if osvDir != "" {
+		advs, err := vulnreport.LoadOSV(osvDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading some OSV records: %v\n", err)
+		}
+		advisories = append(advisories, advs...)
+	}
+	installed, err := packages.GetInstalledPackages(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing some installed packages: %v\n", err)
+	}
+	updates, err := packages.GetPackageUpdates(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing some package updates: %v\n", err)
+	}
+
+	rep := vulnreport.New(oi.Hostname, installed, updates, advisories, time.Now())
+	if format == "json" {
+		out, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	fmt.Print(rep)
+	return nil
+}
+
+// runState prints the changes the agent recorded, newest first, optionally
+// only those of kind and name.
+func runState(format, kind, name string) error {
+	if format != "" && format != "json" {
+		return fmt.Errorf("unknown state output format %q, valid formats are \"json\" or none", format)
+	}
+	changes, err := statedb.Default.Query(statedb.Query{Kind: kind, Name: name})
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		out, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	fmt.Print(statedb.Format(changes))
+	return nil
+}
+
 func main() {
 	flag.Parse()
 	ctx, cncl := context.WithCancel(context.Background())
@@ -347,6 +949,80 @@ func main() {
 			os.Exit(1)
 		}
 		os.Exit(0)
+	// pause and resume stop a subsystem of an already running agent from
+	// doing any work, the pause state is persisted so it survives restarts.
+	case "pause", "resume":
+		if err := pauseOrResume(action, flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	// schedule installs or removes a systemd timer or Windows Scheduled
+	// Task running a one-shot action, like inventory, on an interval.
+	case "schedule":
+		var args []string
+		if flag.NArg() > 2 {
+			args = flag.Args()[2:]
+		}
+		if err := runSchedule(flag.Arg(1), args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	// sbom [spdx|cyclonedx] [path] writes an SBOM of the installed packages
+	// to the given file or stdout, SPDX by default.
+	case "sbom":
+		format, path := "spdx", flag.Arg(1)
+		if path == "spdx" || path == "cyclonedx" {
+			format, path = path, flag.Arg(2)
+		}
+		if err := runSBOM(ctx, format, path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	// doctor runs a read-only self test and prints the diagnosis, as a
+	// table or as JSON with "doctor json".
+	case "doctor":
+		if err := runDoctor(ctx, flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	// policy check|plan|apply <path> evaluates, or converges the host to, the
+	// desired-state document at path and prints the compliance of each
+	// resource. plan also prints what apply would change.
+	case "policy":
+		if err := runPolicy(ctx, flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	// vulnreport [json] [osv dir] prints the packages affected by the yum
+	// security advisories and the OSV records in the directory, if given.
+	case "vulnreport":
+		format, dir := "", flag.Arg(1)
+		if dir == "json" {
+			format, dir = dir, flag.Arg(2)
+		}
+		if err := runVulnReport(ctx, format, dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	// state [json] [kind [name]] prints the changes the agent made, e.g.
+	// "state package nginx" for the changes to the nginx package.
+	case "state":
+		format, args := "", flag.Args()[1:]
+		if len(args) > 0 && args[0] == "json" {
+			format, args = args[0], args[1:]
+		}
+		args = append(args, "", "")
+		if err := runState(format, args[0], args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	case "", "run":
 		runService(ctx)
 	default:
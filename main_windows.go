@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
@@ -40,6 +41,11 @@ var (
 const (
 	serviceName = "google_osconfig_agent"
 
+	// How often StartPending and StopPending are re-reported with an
+	// incremented checkpoint, and how long the SCM should wait for the next one.
+	checkpointInterval = 10 * time.Second
+	checkpointWaitHint = 30 * time.Second
+
 	// https://docs.microsoft.com/en-us/windows/desktop/api/fileapi/nf-fileapi-lockfileex
 	LOCKFILE_EXCLUSIVE_LOCK   = 2
 	LOCKFILE_FAIL_IMMEDIATELY = 1
@@ -100,8 +106,10 @@ type service struct {
 	run func(context.Context)
 }
 
+// Execute implements svc.Handler. Pause and continue are not supported, on
+// stop or shutdown the agent context is canceled and StopPending is reported,
+// with checkpoints, until the agent has cleanly stopped.
 func (s *service) Execute(_ []string, r <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
-	status <- svc.Status{State: svc.StartPending}
 	ctx, cncl := context.WithCancel(s.ctx)
 	defer cncl()
 	done := make(chan struct{})
@@ -110,18 +118,42 @@ func (s *service) Execute(_ []string, r <-chan svc.ChangeRequest, status chan<-
 		s.run(ctx)
 		close(done)
 	}()
-	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
 
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	var checkpoint uint32
+	current := svc.Status{State: svc.StartPending, WaitHint: uint32(checkpointWaitHint / time.Millisecond)}
+	status <- current
+	ready := started
 	for {
 		select {
+		case <-ready:
+			ready = nil
+			current = svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+			status <- current
+		case <-ticker.C:
+			// Long running tasks, like patch runs, can delay start up and
+			// shut down, keep telling the SCM we are making progress.
+			if current.State == svc.StartPending || current.State == svc.StopPending {
+				checkpoint++
+				current.CheckPoint = checkpoint
+				status <- current
+			}
 		case <-done:
 			status <- svc.Status{State: svc.StopPending}
 			return false, 0
 		case c := <-r:
 			switch c.Cmd {
 			case svc.Interrogate:
-				status <- c.CurrentStatus
+				status <- current
 			case svc.Stop, svc.Shutdown:
+				if current.State == svc.StopPending {
+					continue
+				}
+				checkpoint++
+				current = svc.Status{State: svc.StopPending, CheckPoint: checkpoint, WaitHint: uint32(checkpointWaitHint / time.Millisecond)}
+				status <- current
 				cncl()
 			default:
 			}
@@ -0,0 +1,169 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package maintenance runs patches in maintenance windows, recurring
+// periods described by a cron expression, a duration and a time zone.
+package maintenance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression, see ParseCron.
+type Cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set if the day of month or week is "*", a day
+	// then only has to match the other field.
+	domAny, dowAny bool
+}
+
+var cronDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// ParseCron parses a standard five field cron expression, "minute hour
+// day-of-month month day-of-week". Fields are "*", numbers, ranges like
+// "1-5" and lists of those, each optionally with a step like "*/15".
+// Sunday is 0 or 7. The descriptors @hourly, @daily, @weekly, @monthly and
+// @yearly are also accepted.
+func ParseCron(expr string) (*Cron, error) {
+	s := strings.TrimSpace(expr)
+	if d, ok := cronDescriptors[s]; ok {
+		s = d
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+	c := &Cron{expr: expr, domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	for i, f := range []struct {
+		name     string
+		dst      *uint64
+		min, max int
+	}{
+		{"minute", &c.minute, 0, 59},
+		{"hour", &c.hour, 0, 23},
+		{"day of month", &c.dom, 1, 31},
+		{"month", &c.month, 1, 12},
+		{"day of week", &c.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %s: %v", expr, f.name, err)
+		}
+		*f.dst = bits
+	}
+	// 7 is Sunday too.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng = part[:i]
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				// "5/15" is every 15 from 5.
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is not within %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	// Like cron, a day matches if either field matches when both are
+	// restricted.
+	return dom || dow
+}
+
+// Next returns the first time after t matching c, in the location of t. It
+// returns the zero time if there is none within five years, e.g. for
+// "0 0 30 2 *".
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		// Around daylight saving time changes the wall clock time asked
+		// for may not exist, always move forward.
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+	return time.Time{}
+}
@@ -0,0 +1,59 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) got nil error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC), time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 2 * * 6", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), time.Date(2024, 5, 4, 2, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 12, 15, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// The day of month or week matches when both are restricted.
+		{"0 0 13 * 5", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"30 1-3 * * 0,7", time.Date(2024, 5, 5, 1, 30, 0, 0, time.UTC), time.Date(2024, 5, 5, 2, 30, 0, 0, time.UTC)},
+		// 02:30 does not exist on the day daylight saving time starts.
+		{"30 2 * * *", time.Date(2024, 3, 30, 12, 0, 0, 0, berlin), time.Date(2024, 4, 1, 2, 30, 0, 0, berlin)},
+		{"0 0 30 2 *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error: %v", tt.expr, err)
+		}
+		if got := c.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("ParseCron(%q).Next(%s) = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
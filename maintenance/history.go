@@ -0,0 +1,91 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package maintenance
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// historySize is the number of patch run durations kept.
+const historySize = 10
+
+// History keeps the durations of the last patch runs in a file, to
+// estimate how long the next one takes.
+type History struct {
+	path string
+
+	mu        sync.Mutex
+	loaded    bool
+	durations []time.Duration
+}
+
+// NewHistory returns a History kept in the file path.
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+// load reads the file once, a missing or corrupt file is an empty history.
+// h.mu must be held.
+func (h *History) load() {
+	if h.loaded {
+		return
+	}
+	h.loaded = true
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &h.durations)
+}
+
+// Add records the duration of a patch run.
+func (h *History) Add(d time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	h.durations = append(h.durations, d)
+	if len(h.durations) > historySize {
+		h.durations = h.durations[len(h.durations)-historySize:]
+	}
+	data, err := json.Marshal(h.durations)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(h.path, data, 0600)
+}
+
+// Estimate returns how long the next patch run is expected to take, the
+// longest of the last runs, or 0 if there were none.
+func (h *History) Estimate() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	var max time.Duration
+	for _, d := range h.durations {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
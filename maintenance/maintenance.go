@@ -0,0 +1,213 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentendpoint"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/control"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// PatchKind is the kind of the persistent patch run tasks of the
+// Scheduler, see RegisterTasks.
+const PatchKind = "maintenance-patch"
+
+var now = time.Now
+
+// Window is a maintenance window, patches run at its start if they are
+// expected to finish before it closes.
+type Window struct {
+	Name     string
+	Schedule *Cron
+	Duration time.Duration
+	// Location is the time zone of Schedule.
+	Location *time.Location
+	// Patch are the options of the patch runs of the window.
+	Patch *control.PatchRequest
+}
+
+// Open returns the start of the occurrence of w that is open at t, false if
+// w is closed at t.
+func (w *Window) Open(t time.Time) (time.Time, bool) {
+	start := w.Schedule.Next(t.In(w.Location).Add(-w.Duration - time.Minute))
+	for !start.IsZero() && !start.After(t) {
+		if t.Before(start.Add(w.Duration)) {
+			return start, true
+		}
+		start = w.Schedule.Next(start)
+	}
+	return time.Time{}, false
+}
+
+// Scheduler starts the patch runs of maintenance windows.
+type Scheduler struct {
+	history *History
+	// path is the file the started occurrences are kept in, so a patch run
+	// that reboots the instance is not run again in the same occurrence.
+	path  string
+	patch func(context.Context, *control.PatchRequest) error
+
+	mu     sync.Mutex
+	loaded bool
+	// started is the start of the last occurrence a run was queued for, by
+	// window name.
+	started map[string]time.Time
+}
+
+// NewScheduler returns a Scheduler running patches with patch, keeping
+// their durations in history and the occurrences they ran in in the file
+// path.
+func NewScheduler(history *History, path string, patch func(context.Context, *control.PatchRequest) error) *Scheduler {
+	return &Scheduler{history: history, path: path, patch: patch, started: map[string]time.Time{}}
+}
+
+// queuedRun is a queued patch run of a window as it is saved in the task
+// journal.
+type queuedRun struct {
+	Window string
+	End    time.Time
+	Patch  *control.PatchRequest
+}
+
+// RegisterTasks registers the kind of the patch runs queued by s, so the
+// runs queued when the agent stopped are queued again by tasker.Restore.
+// Their occurrences are already marked started and would be lost otherwise.
+func (s *Scheduler) RegisterTasks() {
+	tasker.RegisterKind(PatchKind, func(ctx context.Context, data json.RawMessage) (func(context.Context), error) {
+		var q queuedRun
+		if err := json.Unmarshal(data, &q); err != nil {
+			return nil, err
+		}
+		return s.task(&Window{Name: q.Window, Patch: q.Patch}, q.End), nil
+	})
+}
+
+// task returns the task running the patch of w, see run.
+func (s *Scheduler) task(w *Window, end time.Time) func(context.Context) {
+	return func(ctx context.Context) {
+		if err := s.run(ctx, w, end); err != nil {
+			clog.Errorf(ctx, "Maintenance window %q: %v", w.Name, err)
+		}
+	}
+}
+
+// load reads the started occurrences once, a missing or corrupt file is
+// none. s.mu must be held.
+func (s *Scheduler) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &s.started)
+}
+
+// markStarted records start as the occurrence of window name a run was
+// queued for. It reports false if one already was. s.mu must be held.
+func (s *Scheduler) markStarted(name string, start time.Time) (bool, error) {
+	s.load()
+	if s.started[name].Equal(start) {
+		return false, nil
+	}
+	started := make(map[string]time.Time, len(s.started)+1)
+	for k, v := range s.started {
+		started[k] = v
+	}
+	started[name] = start
+	data, err := json.Marshal(started)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return false, err
+	}
+	if err := util.AtomicWrite(s.path, data, 0600); err != nil {
+		return false, err
+	}
+	s.started = started
+	return true, nil
+}
+
+// Check queues a patch run for each of windows open at t that did not have
+// one in this occurrence yet.
+func (s *Scheduler) Check(ctx context.Context, windows []*Window, t time.Time) {
+	for _, w := range windows {
+		start, ok := w.Open(t)
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		queue, err := s.markStarted(w.Name, start)
+		s.mu.Unlock()
+		if err != nil {
+			// Without the record the run could repeat after a reboot, try
+			// again on the next check.
+			clog.Errorf(ctx, "Error recording the patch run of maintenance window %q: %v", w.Name, err)
+			continue
+		}
+		if !queue {
+			continue
+		}
+		w, end := w, start.Add(w.Duration)
+		clog.Infof(ctx, "Maintenance window %q is open until %s, queuing a patch run.", w.Name, end.Format(time.RFC3339))
+		q := &queuedRun{Window: w.Name, End: end, Patch: w.Patch}
+		if err := tasker.Enqueue(ctx, agentendpoint.PatchTaskName, s.task(w, end), tasker.Persistent(PatchKind, q)); err != nil {
+			clog.Errorf(ctx, "Error queuing the patch run of maintenance window %q: %v", w.Name, err)
+		}
+	}
+}
+
+// run runs the patch of w unless it is not expected to finish before end,
+// the run may have been queued behind other tasks.
+func (s *Scheduler) run(ctx context.Context, w *Window, end time.Time) error {
+	start := now()
+	if est := s.history.Estimate(); start.Add(est).After(end) {
+		return fmt.Errorf("not patching, the last runs took up to %s and the window closes at %s", est, end.Format(time.RFC3339))
+	}
+	if err := s.patch(ctx, w.Patch); err != nil {
+		return fmt.Errorf("patch run failed: %v", err)
+	}
+	d := now().Sub(start)
+	clog.Infof(ctx, "Maintenance window %q: patch run finished in %s.", w.Name, d)
+	return s.history.Add(d)
+}
+
+// Run calls Check with the windows returned by windows every minute until
+// ctx is done, windows is called each time so configuration changes apply.
+func (s *Scheduler) Run(ctx context.Context, windows func() []*Window) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		s.Check(ctx, windows(), now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,176 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package maintenance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/control"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+)
+
+func testWindow(t *testing.T, schedule string) *Window {
+	t.Helper()
+	c, err := ParseCron(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Window{Name: "nightly", Schedule: c, Duration: 2 * time.Hour, Location: time.UTC, Patch: &control.PatchRequest{Security: true}}
+}
+
+func TestWindowOpen(t *testing.T) {
+	w := testWindow(t, "0 2 * * *")
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		at   time.Duration
+		open bool
+	}{
+		{time.Hour, false},
+		{2 * time.Hour, true},
+		{3*time.Hour + 59*time.Minute, true},
+		{4 * time.Hour, false},
+	} {
+		start, ok := w.Open(day.Add(tt.at))
+		if ok != tt.open || (ok && !start.Equal(day.Add(2*time.Hour))) {
+			t.Errorf("Open(%s) = %s, %t, want open %t", day.Add(tt.at), start, ok, tt.open)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	// Always open, the runs check the real clock.
+	w := testWindow(t, "* * * * *")
+	dir := t.TempDir()
+	history := NewHistory(filepath.Join(dir, "durations.json"))
+	ran := make(chan *control.PatchRequest, 2)
+	s := NewScheduler(history, filepath.Join(dir, "started.json"), func(_ context.Context, req *control.PatchRequest) error {
+		ran <- req
+		return nil
+	})
+
+	at := time.Now()
+	s.Check(ctx, []*Window{w}, at)
+	// The run of this occurrence is already queued.
+	s.Check(ctx, []*Window{w}, at)
+	select {
+	case req := <-ran:
+		if !req.Security {
+			t.Errorf("patch ran with %+v, want the window options", req)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no patch run within 10s")
+	}
+	select {
+	case <-ran:
+		t.Error("patch ran twice in one window")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSchedulerRestartInWindow(t *testing.T) {
+	ctx := context.Background()
+	w := testWindow(t, "* * * * *")
+	dir := t.TempDir()
+	history := NewHistory(filepath.Join(dir, "durations.json"))
+	ran := make(chan struct{}, 2)
+	patch := func(context.Context, *control.PatchRequest) error {
+		ran <- struct{}{}
+		return nil
+	}
+
+	at := time.Now()
+	NewScheduler(history, filepath.Join(dir, "started.json"), patch).Check(ctx, []*Window{w}, at)
+	select {
+	case <-ran:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no patch run within 10s")
+	}
+
+	// An agent restarted in the same occurrence, like after a reboot of
+	// the patch run, does not run it again.
+	NewScheduler(history, filepath.Join(dir, "started.json"), patch).Check(ctx, []*Window{w}, at)
+	select {
+	case <-ran:
+		t.Error("patch ran again after a restart in the same window")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The next occurrence does.
+	NewScheduler(history, filepath.Join(dir, "started.json"), patch).Check(ctx, []*Window{w}, at.Add(time.Minute))
+	select {
+	case <-ran:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no patch run in the next window within 10s")
+	}
+}
+
+func TestSchedulerRestoresQueuedRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := filepath.Join(dir, "tasks.json")
+	// A run queued when the agent stopped, its window is still open.
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	data := `[{"Name":"PatchRun","Kind":"maintenance-patch","Priority":1,"Data":{"Window":"nightly","End":"` + end + `","Patch":{"security":true}}}]`
+	if err := os.WriteFile(journal, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tasker.SetJournal(journal)
+	defer tasker.SetJournal("")
+
+	ran := make(chan *control.PatchRequest, 1)
+	s := NewScheduler(NewHistory(filepath.Join(dir, "durations.json")), filepath.Join(dir, "started.json"), func(_ context.Context, req *control.PatchRequest) error {
+		ran <- req
+		return nil
+	})
+	s.RegisterTasks()
+	if err := tasker.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-ran:
+		if !req.Security {
+			t.Errorf("restored patch ran with %+v, want the saved options", req)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("restored patch did not run within 10s")
+	}
+}
+
+func TestSchedulerRefusesLongRuns(t *testing.T) {
+	defer func(old func() time.Time) { now = old }(now)
+	start := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+
+	history := NewHistory(filepath.Join(t.TempDir(), "durations.json"))
+	if err := history.Add(90 * time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// A new History reads the durations back from the file.
+	history = NewHistory(history.path)
+	s := NewScheduler(history, filepath.Join(t.TempDir(), "started.json"), func(context.Context, *control.PatchRequest) error {
+		t.Error("patch ran although it would not finish in the window")
+		return nil
+	})
+	err := s.run(context.Background(), testWindow(t, "0 2 * * *"), start.Add(time.Hour))
+	if err == nil || !strings.Contains(err.Error(), "took up to 1h30m0s") {
+		t.Errorf("run() error = %v, want the run refused", err)
+	}
+}
@@ -0,0 +1,219 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package metrics keeps the counters and histograms of the agent and
+// formats them in the Prometheus text format, see agenthttp for how they are
+// exposed.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the histogram buckets in seconds of durations from
+// milliseconds to an hour.
+var DurationBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// The metrics of the agent.
+var (
+	InventoryDuration = NewHistogram("osconfig_inventory_duration_seconds", "Duration of listing the packages of a package manager.", DurationBuckets, "manager", "result")
+	PatchRuns         = NewCounter("osconfig_patch_runs_total", "Patch runs by outcome.", "outcome")
+	CommandDuration   = NewHistogram("osconfig_command_duration_seconds", "Duration of the commands run by the agent.", DurationBuckets, "command", "result")
+)
+
+type metric interface {
+	name() string
+	write(b *strings.Builder)
+}
+
+var (
+	registry   []metric
+	registryMx sync.Mutex
+)
+
+func register(m metric) {
+	registryMx.Lock()
+	defer registryMx.Unlock()
+	registry = append(registry, m)
+	sort.Slice(registry, func(i, j int) bool { return registry[i].name() < registry[j].name() })
+}
+
+// WriteText writes all the metrics in the Prometheus text format.
+func WriteText(w io.Writer) error {
+	registryMx.Lock()
+	ms := append([]metric(nil), registry...)
+	registryMx.Unlock()
+
+	var b strings.Builder
+	for _, m := range ms {
+		m.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Result is the result label value of err, "success" or "error".
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats names and values as {a="1",b="2"}, with the extra
+// pairs appended.
+func formatLabels(names, values []string, extra ...string) string {
+	var pairs []string
+	for i, n := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", n, labelEscaper.Replace(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// series keys the values of a metric by their label values.
+type series struct {
+	labels []string
+	mu     sync.Mutex
+	keys   []string
+	values map[string][]string
+}
+
+// key returns the key of the label values, panicking if their number does
+// not match the labels of the metric, which is a programming error.
+func (s *series) key(metric string, values []string) string {
+	if len(values) != len(s.labels) {
+		panic(fmt.Sprintf("metric %s has labels %q, got values %q", metric, s.labels, values))
+	}
+	k := strings.Join(values, "\x00")
+	if _, ok := s.values[k]; !ok {
+		s.keys = append(s.keys, k)
+		sort.Strings(s.keys)
+		s.values[k] = append([]string(nil), values...)
+	}
+	return k
+}
+
+// Counter is a monotonically increasing value per label values.
+type Counter struct {
+	metricName, help string
+	series
+	counts map[string]float64
+}
+
+// NewCounter returns and registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{metricName: name, help: help, series: series{labels: labels, values: map[string][]string{}}, counts: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds 1 to the counter of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label
+// values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.key(c.metricName, labelValues)] += v
+}
+
+func (c *Counter) name() string { return c.metricName }
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.metricName, c.help, c.metricName)
+	for _, k := range c.keys {
+		fmt.Fprintf(b, "%s%s %v\n", c.metricName, formatLabels(c.labels, c.values[k]), c.counts[k])
+	}
+}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations in buckets per label values.
+type Histogram struct {
+	metricName, help string
+	buckets          []float64
+	series
+	hists map[string]*histogramValue
+}
+
+// NewHistogram returns and registers a histogram with the given upper
+// bounds of its buckets, sorted, and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{metricName: name, help: help, buckets: buckets, series: series{labels: labels, values: map[string][]string{}}, hists: map[string]*histogramValue{}}
+	register(h)
+	return h
+}
+
+// Observe adds v to the histogram of the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := h.key(h.metricName, labelValues)
+	hv, ok := h.hists[k]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.hists[k] = hv
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += v
+	hv.count++
+}
+
+// ObserveDuration adds d in seconds to the histogram of the label values.
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	for _, k := range h.keys {
+		hv, values := h.hists[k], h.values[k]
+		for i, le := range h.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, values, "le", fmt.Sprint(le)), hv.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, values, "le", "+Inf"), hv.count)
+		fmt.Fprintf(b, "%s_sum%s %v\n", h.metricName, formatLabels(h.labels, values), hv.sum)
+		fmt.Fprintf(b, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, values), hv.count)
+	}
+}
@@ -0,0 +1,76 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	c := NewCounter("test_runs_total", "Test runs.", "outcome")
+	c.Inc("succeeded")
+	c.Add(2, `fail"ed`)
+	h := NewHistogram("test_duration_seconds", "Test durations.", []float64{1, 10})
+	h.ObserveDuration(500 * time.Millisecond)
+	h.Observe(5)
+	h.Observe(50)
+
+	var b strings.Builder
+	if err := WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error: %v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"# HELP test_duration_seconds Test durations.\n# TYPE test_duration_seconds histogram\n" +
+			"test_duration_seconds_bucket{le=\"1\"} 1\n" +
+			"test_duration_seconds_bucket{le=\"10\"} 2\n" +
+			"test_duration_seconds_bucket{le=\"+Inf\"} 3\n" +
+			"test_duration_seconds_sum 55.5\n" +
+			"test_duration_seconds_count 3\n",
+		"# HELP test_runs_total Test runs.\n# TYPE test_runs_total counter\n" +
+			"test_runs_total{outcome=\"fail\\\"ed\"} 2\n" +
+			"test_runs_total{outcome=\"succeeded\"} 1\n",
+		"# TYPE osconfig_patch_runs_total counter\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteText() missing %q, got:\n%s", want, got)
+		}
+	}
+	// Metrics are sorted by name.
+	if strings.Index(got, "test_duration_seconds") > strings.Index(got, "test_runs_total") {
+		t.Errorf("WriteText() metrics not sorted, got:\n%s", got)
+	}
+}
+
+func TestLabelMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with the wrong number of label values did not panic")
+		}
+	}()
+	NewCounter("test_mismatch_total", "Mismatch.", "a", "b").Inc("a")
+}
+
+func TestResult(t *testing.T) {
+	if got := Result(nil); got != "success" {
+		t.Errorf("Result(nil) = %q, want success", got)
+	}
+	if got := Result(errors.New("x")); got != "error" {
+		t.Errorf("Result(err) = %q, want error", got)
+	}
+}
@@ -15,27 +15,250 @@ limitations under the License.
 // Linux.
 package osinfo
 
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
 const (
 	// Linux is the default shortname used for a Linux system.
 	Linux = "linux"
 	// Windows is the default shortname used for Windows system.
 	Windows = "windows"
+	// MacOS is the shortname used for macOS.
+	MacOS = "macos"
+)
+
+// Virtualization types reported in OSInfo.
+const (
+	VirtKVM        = "kvm"
+	VirtHyperV     = "hyperv"
+	VirtXen        = "xen"
+	VirtVMware     = "vmware"
+	VirtVirtualBox = "virtualbox"
+	// VirtOther is a hypervisor that is not recognized.
+	VirtOther = "other"
+	// VirtNone is bare metal.
+	VirtNone = "none"
+)
+
+// Cloud providers reported in OSInfo.
+const (
+	CloudGCE   = "gce"
+	CloudAWS   = "aws"
+	CloudAzure = "azure"
 )
 
 // OSInfo describes an operating system.
 type OSInfo struct {
 	Hostname, LongName, ShortName, Version, KernelVersion, KernelRelease, Architecture string
+	// IDLike are the short names of the distributions this one derives
+	// from, closest first, from ID_LIKE in os-release, e.g. "rhel", "centos"
+	// and "fedora" on Rocky Linux.
+	IDLike []string
+	// Codename is the release codename, e.g. "bookworm", VariantID the
+	// edition, e.g. "server", both from os-release.
+	Codename, VariantID string
+	// DisplayVersion is the Windows feature update, e.g. "23H2", and UBR
+	// the update build revision, the fourth part of the build number.
+	DisplayVersion string
+	UBR            int
+	// Edition is the Windows edition ID, e.g. "ServerDatacenter", and
+	// InstallationType one of "Client", "Server" or "Server Core".
+	Edition, InstallationType string
+	// Server reports whether Windows is a server SKU, including domain
+	// controllers.
+	Server bool
+	// Virtualization is the hypervisor the system runs on, one of the Virt
+	// constants, empty if it could not be told.
+	Virtualization string
+	// Cloud is the cloud provider the system runs on, one of the Cloud
+	// constants, empty if none.
+	Cloud string
+}
+
+// Like reports whether the distribution is id, the short name, or derives
+// from it, e.g. Pop!_OS is like "ubuntu" and "debian".
+func (oi *OSInfo) Like(id string) bool {
+	if oi.ShortName == id {
+		return true
+	}
+	for _, like := range oi.IDLike {
+		if like == id {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	archMu sync.RWMutex
+	// architectures maps the names package managers and Windows use for an
+	// architecture to the one reported. Names not listed are reported as is.
+	architectures = map[string]string{
+		"amd64":  "x86_64",
+		"x64":    "x86_64",
+		"64-bit": "x86_64",
+		"i386":   "x86_32",
+		"i486":   "x86_32",
+		"i586":   "x86_32",
+		"i686":   "x86_32",
+		"x86":    "x86_32",
+		"32-bit": "x86_32",
+		"noarch": "all",
+		// Debian names where RPM and the kernel differ, riscv64, s390x and
+		// the mips variants are named alike.
+		"ppc64el": "ppc64le",
+		"loong64": "loongarch64",
+	}
+)
+
+// RegisterArchitecture makes Architecture report name as arch, extending or
+// overriding the built-in table.
+func RegisterArchitecture(name, arch string) {
+	archMu.Lock()
+	defer archMu.Unlock()
+	architectures[name] = arch
 }
 
-// Architecture attempts to standardize architecture naming.
+// Architecture attempts to standardize architecture naming. Multiarch
+// names like "amd64:i386" are standardized part by part.
 func Architecture(arch string) string {
-	switch arch {
-	case "amd64", "64-bit":
-		arch = "x86_64"
-	case "i386", "i686", "32-bit":
-		arch = "x86_32"
-	case "noarch":
-		arch = "all"
+	if strings.Contains(arch, ":") {
+		parts := strings.Split(arch, ":")
+		for i, p := range parts {
+			parts[i] = Architecture(p)
+		}
+		return strings.Join(parts, ":")
+	}
+
+	archMu.RLock()
+	defer archMu.RUnlock()
+	if a, ok := architectures[arch]; ok {
+		return a
 	}
 	return arch
 }
+
+// virtualization tells the hypervisor from the system vendor and product
+// name in the SMBIOS tables. hypervisor reports whether the CPU says it runs
+// under one.
+func virtualization(vendor, product string, hypervisor bool) string {
+	switch {
+	case vendor == "Google", product == "Google Compute Engine",
+		vendor == "QEMU", strings.Contains(product, "KVM"),
+		vendor == "Amazon EC2" && !strings.Contains(product, "metal"):
+		return VirtKVM
+	case vendor == "Microsoft Corporation" && product == "Virtual Machine":
+		return VirtHyperV
+	case vendor == "Xen", strings.Contains(product, "HVM domU"):
+		return VirtXen
+	case strings.HasPrefix(vendor, "VMware"):
+		return VirtVMware
+	case vendor == "innotek GmbH", product == "VirtualBox":
+		return VirtVirtualBox
+	case hypervisor:
+		return VirtOther
+	}
+	return VirtNone
+}
+
+// cloudFromSMBIOS tells the cloud provider from the SMBIOS tables where they
+// are conclusive.
+func cloudFromSMBIOS(vendor, product string) string {
+	switch {
+	case vendor == "Google", product == "Google Compute Engine":
+		return CloudGCE
+	case vendor == "Amazon EC2":
+		return CloudAWS
+	}
+	return ""
+}
+
+var (
+	// metadataAddr is the address of the metadata servers of the clouds
+	// probed, overridden in tests.
+	metadataAddr = "http://169.254.169.254"
+	probeTimeout = 500 * time.Millisecond
+
+	cloudMu     sync.Mutex
+	cloudCached bool
+	cloud       string
+)
+
+func probe(ctx context.Context, method, path string, header map[string]string, ok func(*http.Response) bool) bool {
+	req, err := http.NewRequestWithContext(ctx, method, metadataAddr+path, nil)
+	if err != nil {
+		return false
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	// Not the proxy from the environment, the metadata servers are link
+	// local.
+	client := &http.Client{Transport: &http.Transport{}, Timeout: probeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK && ok(resp)
+}
+
+// probeCloud asks the metadata servers of the known clouds, at the same time,
+// which one the system runs on.
+func probeCloud(ctx context.Context) string {
+	probes := map[string]func() bool{
+		CloudGCE: func() bool {
+			return probe(ctx, http.MethodGet, "/computeMetadata/v1/", map[string]string{"Metadata-Flavor": "Google"}, func(r *http.Response) bool {
+				return r.Header.Get("Metadata-Flavor") == "Google"
+			})
+		},
+		CloudAWS: func() bool {
+			return probe(ctx, http.MethodPut, "/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"}, func(*http.Response) bool { return true })
+		},
+		CloudAzure: func() bool {
+			return probe(ctx, http.MethodGet, "/metadata/instance?api-version=2021-02-01", map[string]string{"Metadata": "true"}, func(*http.Response) bool { return true })
+		},
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var found string
+	for name, p := range probes {
+		wg.Add(1)
+		go func(name string, p func() bool) {
+			defer wg.Done()
+			if p() {
+				mu.Lock()
+				found = name
+				mu.Unlock()
+			}
+		}(name, p)
+	}
+	wg.Wait()
+	return found
+}
+
+// detectCloud returns the cloud provider, probing the metadata servers only
+// on virtual machines the SMBIOS tables do not tell. The result is cached
+// unless ctx ended before the probes finished.
+func detectCloud(ctx context.Context, vendor, product, virt string) string {
+	if c := cloudFromSMBIOS(vendor, product); c != "" || virt == VirtNone {
+		return c
+	}
+
+	cloudMu.Lock()
+	defer cloudMu.Unlock()
+	if cloudCached {
+		return cloud
+	}
+	c := probeCloud(ctx)
+	if ctx.Err() == nil {
+		cloud, cloudCached = c, true
+	}
+	return c
+}
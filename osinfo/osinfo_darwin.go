@@ -0,0 +1,71 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package osinfo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const swVers = "/usr/bin/sw_vers"
+
+func parseSwVers(out string) *OSInfo {
+	/*
+	   ProductName:		macOS
+	   ProductVersion:		14.4.1
+	   BuildVersion:		23E224
+	*/
+	oi := &OSInfo{ShortName: MacOS}
+	var name string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "ProductName":
+			name = strings.TrimSpace(value)
+		case "ProductVersion":
+			oi.Version = strings.TrimSpace(value)
+		}
+	}
+	oi.LongName = strings.TrimSpace(name + " " + oi.Version)
+	return oi
+}
+
+// get looks up OSInfo from sw_vers and uname.
+func get(ctx context.Context) (*OSInfo, error) {
+	oi := &OSInfo{ShortName: MacOS}
+	if out, err := exec.CommandContext(ctx, swVers).Output(); err == nil {
+		oi = parseSwVers(string(out))
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return oi, fmt.Errorf("unix.Uname error: %v", err)
+	}
+	oi.Hostname = string(bytes.TrimRight(uts.Nodename[:], "\x00"))
+	oi.Architecture = Architecture(string(bytes.TrimRight(uts.Machine[:], "\x00")))
+	oi.KernelVersion = string(bytes.TrimRight(uts.Version[:], "\x00"))
+	oi.KernelRelease = string(bytes.TrimRight(uts.Release[:], "\x00"))
+	return oi, nil
+}
@@ -0,0 +1,24 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package osinfo
+
+import "testing"
+
+func TestParseSwVers(t *testing.T) {
+	oi := parseSwVers("ProductName:\t\tmacOS\nProductVersion:\t\t14.4.1\nBuildVersion:\t\t23E224\n")
+	if oi.ShortName != MacOS || oi.LongName != "macOS 14.4.1" || oi.Version != "14.4.1" {
+		t.Errorf("parseSwVers() = %+v, want macOS 14.4.1", oi)
+	}
+}
@@ -16,6 +16,7 @@ package osinfo
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"regexp"
@@ -33,6 +34,9 @@ const (
 	osRelease = "/etc/os-release"
 	oRelease  = "/etc/oracle-release"
 	rhRelease = "/etc/redhat-release"
+
+	dmiDir  = "/sys/class/dmi/id"
+	cpuinfo = "/proc/cpuinfo"
 )
 
 func parseOsRelease(releaseDetails string) *OSInfo {
@@ -40,19 +44,24 @@ func parseOsRelease(releaseDetails string) *OSInfo {
 
 	scanner := bufio.NewScanner(bytes.NewReader([]byte(releaseDetails)))
 	for scanner.Scan() {
-		entry := strings.Split(scanner.Text(), "=")
-		switch entry[0] {
-		case "":
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
 			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
 		case "PRETTY_NAME":
-			oi.LongName = strings.Trim(entry[1], `"`)
+			oi.LongName = value
 		case "VERSION_ID":
-			oi.Version = strings.Trim(entry[1], `"`)
+			oi.Version = value
 		case "ID":
-			oi.ShortName = strings.Trim(entry[1], `"`)
-		}
-		if oi.LongName != "" && oi.Version != "" && oi.ShortName != "" {
-			break
+			oi.ShortName = value
+		case "ID_LIKE":
+			oi.IDLike = strings.Fields(value)
+		case "VERSION_CODENAME":
+			oi.Codename = value
+		case "VARIANT_ID":
+			oi.VariantID = value
 		}
 	}
 
@@ -83,8 +92,38 @@ func parseEnterpriseRelease(releaseDetails string) *OSInfo {
 	}
 }
 
-// Get reports OSInfo.
-func Get() (*OSInfo, error) {
+func readDMI(name string) string {
+	b, err := ioutil.ReadFile(dmiDir + "/" + name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// hypervisorFlag reports whether the CPU flags include "hypervisor", which
+// x86 CPUs set under a hypervisor.
+func hypervisorFlag() bool {
+	b, err := ioutil.ReadFile(cpuinfo)
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), ":"); ok && strings.TrimSpace(k) == "flags" {
+			for _, f := range strings.Fields(v) {
+				if f == "hypervisor" {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// get looks up OSInfo from the system. The cloud provider may be looked up
+// from the metadata servers, which ctx limits.
+func get(ctx context.Context) (*OSInfo, error) {
 	var oi *OSInfo
 	var parseReleaseFunc func(string) *OSInfo
 	var releaseFile string
@@ -118,5 +157,13 @@ func Get() (*OSInfo, error) {
 	oi.KernelVersion = string(bytes.TrimRight(uts.Version[:], "\x00"))
 	oi.KernelRelease = string(bytes.TrimRight(uts.Release[:], "\x00"))
 
+	vendor, product, hv := readDMI("sys_vendor"), readDMI("product_name"), hypervisorFlag()
+	// Without SMBIOS tables, like on most arm systems, bare metal can not be
+	// told from an unknown hypervisor.
+	if vendor != "" || product != "" || hv {
+		oi.Virtualization = virtualization(vendor, product, hv)
+	}
+	oi.Cloud = detectCloud(ctx, vendor, product, oi.Virtualization)
+
 	return oi, nil
 }
@@ -49,6 +49,49 @@ BUG_REPORT_URL="https://bugs.debian.org/"
 	}
 }
 
+// rocky system, a derivative with the distributions it is like and a
+// variant
+func TestGetDistributionInfoOSReleaseDerivative(t *testing.T) {
+	fcontent := `NAME="Rocky Linux"
+VERSION="9.3 (Blue Onyx)"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.3"
+PLATFORM_ID="platform:el9"
+PRETTY_NAME="Rocky Linux 9.3 (Blue Onyx)"
+VARIANT_ID=server
+VERSION_CODENAME=blue-onyx
+HOME_URL="https://rockylinux.org/"
+`
+	di := parseOsRelease(fcontent)
+	tests := []struct {
+		expect string
+		actual string
+		errMsg string
+	}{
+		{"Rocky Linux 9.3 (Blue Onyx)", di.LongName, "unexpected long name"},
+		{"rocky", di.ShortName, "unexpected short name"},
+		{"9.3", di.Version, "unexpected version id"},
+		{"server", di.VariantID, "unexpected variant id"},
+		{"blue-onyx", di.Codename, "unexpected codename"},
+	}
+
+	for _, v := range tests {
+		if v.actual != v.expect {
+			t.Errorf("%s! expected(%s); got(%s)", v.errMsg, v.expect, v.actual)
+		}
+	}
+
+	for _, id := range []string{"rocky", "rhel", "fedora"} {
+		if !di.Like(id) {
+			t.Errorf("expected Like(%q)", id)
+		}
+	}
+	if di.Like("debian") {
+		t.Error("unexpected Like(\"debian\")")
+	}
+}
+
 // debian system with empty os-release file
 // with empty file, the short name should default to Linux
 func TestGetDistributionInfoEmptyOSRelease(t *testing.T) {
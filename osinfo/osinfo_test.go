@@ -0,0 +1,104 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package osinfo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVirtualization(t *testing.T) {
+	tests := []struct {
+		vendor, product string
+		hypervisor      bool
+		want            string
+	}{
+		{"Google", "Google Compute Engine", true, VirtKVM},
+		{"QEMU", "Standard PC (Q35 + ICH9, 2009)", true, VirtKVM},
+		{"Amazon EC2", "m5.large", true, VirtKVM},
+		{"Amazon EC2", "m5.metal", false, VirtNone},
+		{"Xen", "HVM domU", true, VirtXen},
+		{"Microsoft Corporation", "Virtual Machine", true, VirtHyperV},
+		{"VMware, Inc.", "VMware Virtual Platform", true, VirtVMware},
+		{"innotek GmbH", "VirtualBox", true, VirtVirtualBox},
+		{"Acme", "Box", true, VirtOther},
+		{"Dell Inc.", "PowerEdge R640", false, VirtNone},
+	}
+	for _, tt := range tests {
+		if got := virtualization(tt.vendor, tt.product, tt.hypervisor); got != tt.want {
+			t.Errorf("virtualization(%q, %q, %v) = %q, want %q", tt.vendor, tt.product, tt.hypervisor, got, tt.want)
+		}
+	}
+}
+
+func TestDetectCloud(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata/instance" && r.Header.Get("Metadata") == "true" {
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	defer func(addr string) { metadataAddr = addr }(metadataAddr)
+	metadataAddr = ts.URL
+	reset := func() { cloudCached, cloud = false, "" }
+	defer reset()
+	ctx := context.Background()
+
+	reset()
+	if got := detectCloud(ctx, "Google", "Google Compute Engine", VirtKVM); got != CloudGCE {
+		t.Errorf("detectCloud on GCE = %q, want %q", got, CloudGCE)
+	}
+	if got := detectCloud(ctx, "Dell Inc.", "PowerEdge R640", VirtNone); got != "" {
+		t.Errorf("detectCloud on bare metal = %q, want none", got)
+	}
+	if got := detectCloud(ctx, "Microsoft Corporation", "Virtual Machine", VirtHyperV); got != CloudAzure {
+		t.Errorf("detectCloud on Hyper-V = %q, want %q", got, CloudAzure)
+	}
+
+	// The result of the probes is cached.
+	ts.Close()
+	if got := detectCloud(ctx, "Microsoft Corporation", "Virtual Machine", VirtHyperV); got != CloudAzure {
+		t.Errorf("cached detectCloud = %q, want %q", got, CloudAzure)
+	}
+}
+
+func TestArchitecture(t *testing.T) {
+	defer delete(architectures, "myarch")
+	RegisterArchitecture("myarch", "x86_64")
+
+	tests := map[string]string{
+		"amd64":       "x86_64",
+		"x86_64":      "x86_64",
+		"i586":        "x86_32",
+		"noarch":      "all",
+		"ppc64el":     "ppc64le",
+		"ppc64le":     "ppc64le",
+		"riscv64":     "riscv64",
+		"s390x":       "s390x",
+		"mips64el":    "mips64el",
+		"aarch64":     "aarch64",
+		"amd64:i386":  "x86_64:x86_32",
+		"myarch":      "x86_64",
+		"unknownarch": "unknownarch",
+	}
+	for arch, want := range tests {
+		if got := Architecture(arch); got != want {
+			t.Errorf("Architecture(%q) = %q, want %q", arch, got, want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ limitations under the License.
 package osinfo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/StackExchange/wmi"
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
 )
 
 var (
@@ -135,10 +137,61 @@ func getKernelInfo() (string, string, error) {
 
 type win32OperatingSystem struct {
 	Caption, Version string
+	// ProductType is 1 for workstations, 2 for domain controllers and 3 for
+	// servers.
+	ProductType uint32
 }
 
-// Get reports OSInfo.
-func Get() (*OSInfo, error) {
+const currentVersionKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+
+// readCurrentVersion fills in the build details Windows keeps in the
+// registry.
+func readCurrentVersion(oi *OSInfo) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, currentVersionKey, registry.QUERY_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	setCurrentVersion(oi, k)
+	return nil
+}
+
+// registryValues are the registry.Key methods setCurrentVersion uses.
+type registryValues interface {
+	GetStringValue(name string) (string, uint32, error)
+	GetIntegerValue(name string) (uint64, uint32, error)
+}
+
+// setCurrentVersion fills in oi from the values of the CurrentVersion key,
+// missing values are left empty.
+func setCurrentVersion(oi *OSInfo, k registryValues) {
+	var err error
+	// DisplayVersion replaced ReleaseId, which stopped at 2009, with 20H2.
+	if oi.DisplayVersion, _, err = k.GetStringValue("DisplayVersion"); err != nil {
+		oi.DisplayVersion, _, _ = k.GetStringValue("ReleaseId")
+	}
+	if ubr, _, err := k.GetIntegerValue("UBR"); err == nil {
+		oi.UBR = int(ubr)
+	}
+	oi.Edition, _, _ = k.GetStringValue("EditionID")
+	oi.InstallationType, _, _ = k.GetStringValue("InstallationType")
+}
+
+// setOperatingSystem fills in oi from the Win32_OperatingSystem instance.
+func setOperatingSystem(oi *OSInfo, op win32OperatingSystem) {
+	oi.LongName = op.Caption
+	oi.Version = op.Version
+	oi.Server = op.ProductType != 1
+}
+
+type win32ComputerSystem struct {
+	Manufacturer, Model string
+	HypervisorPresent   bool
+}
+
+// get looks up OSInfo from the system. The cloud provider may be looked up
+// from the metadata servers, which ctx limits.
+func get(ctx context.Context) (*OSInfo, error) {
 	oi := &OSInfo{ShortName: Windows, Architecture: Architecture(runtime.GOARCH)}
 
 	hn, err := os.Hostname()
@@ -155,15 +208,29 @@ func Get() (*OSInfo, error) {
 	oi.KernelRelease = kRelease
 
 	var ops []win32OperatingSystem
-	query := "SELECT Caption, Version FROM Win32_OperatingSystem"
+	query := "SELECT Caption, Version, ProductType FROM Win32_OperatingSystem"
 	if err := wmi.Query(query, &ops); err != nil {
 		return oi, fmt.Errorf("wmi.Query(%q) error: %v", query, err)
 	}
 	if len(ops) == 0 {
 		return oi, fmt.Errorf("wmi.Query(%q) nil output", query)
 	}
-	oi.LongName = ops[0].Caption
-	oi.Version = ops[0].Version
+	setOperatingSystem(oi, ops[0])
+
+	if err := readCurrentVersion(oi); err != nil {
+		return oi, fmt.Errorf("error reading %s: %v", currentVersionKey, err)
+	}
+
+	var cs []win32ComputerSystem
+	query = "SELECT Manufacturer, Model, HypervisorPresent FROM Win32_ComputerSystem"
+	if err := wmi.Query(query, &cs); err != nil {
+		return oi, fmt.Errorf("wmi.Query(%q) error: %v", query, err)
+	}
+	if len(cs) == 0 {
+		return oi, fmt.Errorf("wmi.Query(%q) nil output", query)
+	}
+	oi.Virtualization = virtualization(cs[0].Manufacturer, cs[0].Model, cs[0].HypervisorPresent)
+	oi.Cloud = detectCloud(ctx, cs[0].Manufacturer, cs[0].Model, oi.Virtualization)
 
 	return oi, nil
 }
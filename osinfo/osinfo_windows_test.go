@@ -0,0 +1,114 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package osinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// fakeKey is a registry key with the given string and integer values.
+type fakeKey struct {
+	strings  map[string]string
+	integers map[string]uint64
+}
+
+func (k *fakeKey) GetStringValue(name string) (string, uint32, error) {
+	v, ok := k.strings[name]
+	if !ok {
+		return "", 0, registry.ErrNotExist
+	}
+	return v, registry.SZ, nil
+}
+
+func (k *fakeKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	v, ok := k.integers[name]
+	if !ok {
+		return 0, 0, registry.ErrNotExist
+	}
+	return v, registry.DWORD, nil
+}
+
+func TestSetCurrentVersion(t *testing.T) {
+	tests := []struct {
+		desc string
+		key  *fakeKey
+		want *OSInfo
+	}{
+		{
+			"Windows 11 23H2",
+			&fakeKey{
+				strings:  map[string]string{"DisplayVersion": "23H2", "ReleaseId": "2009", "EditionID": "Professional", "InstallationType": "Client"},
+				integers: map[string]uint64{"UBR": 2861},
+			},
+			&OSInfo{DisplayVersion: "23H2", UBR: 2861, Edition: "Professional", InstallationType: "Client"},
+		},
+		{
+			"Server 2019 Core before DisplayVersion",
+			&fakeKey{
+				strings:  map[string]string{"ReleaseId": "1809", "EditionID": "ServerDatacenter", "InstallationType": "Server Core"},
+				integers: map[string]uint64{"UBR": 5458},
+			},
+			&OSInfo{DisplayVersion: "1809", UBR: 5458, Edition: "ServerDatacenter", InstallationType: "Server Core"},
+		},
+		{
+			"no values",
+			&fakeKey{},
+			&OSInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := &OSInfo{}
+			setCurrentVersion(got, tt.key)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setCurrentVersion() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetOperatingSystem(t *testing.T) {
+	tests := []struct {
+		productType uint32
+		want        bool
+	}{
+		{1, false},
+		{2, true},
+		{3, true},
+	}
+	for _, tt := range tests {
+		oi := &OSInfo{}
+		setOperatingSystem(oi, win32OperatingSystem{Caption: "Microsoft Windows Server 2022 Datacenter", Version: "10.0.20348", ProductType: tt.productType})
+		if oi.Server != tt.want {
+			t.Errorf("ProductType %d: Server = %t, want %t", tt.productType, oi.Server, tt.want)
+		}
+		if oi.LongName != "Microsoft Windows Server 2022 Datacenter" || oi.Version != "10.0.20348" {
+			t.Errorf("ProductType %d: LongName, Version = %q, %q", tt.productType, oi.LongName, oi.Version)
+		}
+	}
+}
+
+func TestReadCurrentVersion(t *testing.T) {
+	oi := &OSInfo{}
+	if err := readCurrentVersion(oi); err != nil {
+		t.Fatalf("readCurrentVersion: %v", err)
+	}
+	if oi.Edition == "" || oi.InstallationType == "" {
+		t.Errorf("readCurrentVersion() = %+v, want Edition and InstallationType set", oi)
+	}
+}
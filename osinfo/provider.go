@@ -0,0 +1,97 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package osinfo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTL is how long the default Provider keeps OSInfo, the details
+// rarely change while the agent runs.
+const defaultCacheTTL = 10 * time.Minute
+
+// Provider provides OSInfo.
+type Provider interface {
+	Get(ctx context.Context) (*OSInfo, error)
+}
+
+// ProviderFunc is a function implementing Provider.
+type ProviderFunc func(ctx context.Context) (*OSInfo, error)
+
+// Get calls f.
+func (f ProviderFunc) Get(ctx context.Context) (*OSInfo, error) {
+	return f(ctx)
+}
+
+// System is the Provider looking OSInfo up from the system on every call.
+var System Provider = ProviderFunc(get)
+
+// CachedProvider is a Provider keeping the OSInfo of another one for TTL.
+// Errors are not cached.
+type CachedProvider struct {
+	Provider Provider
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	oi      *OSInfo
+	fetched time.Time
+}
+
+// Get returns a copy of the cached OSInfo, getting it from p.Provider if it
+// is older than p.TTL.
+func (p *CachedProvider) Get(ctx context.Context) (*OSInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oi == nil || time.Since(p.fetched) > p.TTL {
+		oi, err := p.Provider.Get(ctx)
+		if err != nil {
+			return oi, err
+		}
+		p.oi, p.fetched = oi, time.Now()
+	}
+	return p.oi.copy(), nil
+}
+
+func (oi *OSInfo) copy() *OSInfo {
+	c := *oi
+	c.IDLike = append([]string(nil), oi.IDLike...)
+	return &c
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider = &CachedProvider{Provider: System, TTL: defaultCacheTTL}
+)
+
+// SetProvider makes Get use p and returns the Provider used so far, so tests
+// can inject OSInfo and restore the default afterwards.
+func SetProvider(p Provider) Provider {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	old := provider
+	provider = p
+	return old
+}
+
+// Get reports OSInfo, by default cached from System for 10 minutes, see
+// SetProvider.
+func Get(ctx context.Context) (*OSInfo, error) {
+	providerMu.RLock()
+	p := provider
+	providerMu.RUnlock()
+	return p.Get(ctx)
+}
@@ -0,0 +1,79 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// excludePackageNames drops the packages named in names, which are covered
+// by excluded advisories.
+func excludePackageNames(ctx context.Context, pkgs []*packages.PkgInfo, names map[string]bool) []*packages.PkgInfo {
+	var keep []*packages.PkgInfo
+	for _, p := range pkgs {
+		if names[p.Name] {
+			clog.Debugf(ctx, "Package %q is covered by an excluded advisory", p.Name)
+			continue
+		}
+		keep = append(keep, p)
+	}
+	return keep
+}
+
+// keepPackageNames keeps only the packages named in names, which are
+// covered by advisories of the minimum severity.
+func keepPackageNames(ctx context.Context, pkgs []*packages.PkgInfo, names map[string]bool) []*packages.PkgInfo {
+	var keep []*packages.PkgInfo
+	for _, p := range pkgs {
+		if !names[p.Name] {
+			clog.Debugf(ctx, "Package %q is not covered by an advisory of the minimum severity", p.Name)
+			continue
+		}
+		keep = append(keep, p)
+	}
+	return keep
+}
+
+// excludeZypperAdvisories drops the patches named in advisories and the
+// packages updated by them, pkgToPatchesMap maps package names to the
+// patches updating them.
+func excludeZypperAdvisories(ctx context.Context, patches []*packages.ZypperPatch, pkgs []*packages.PkgInfo, pkgToPatchesMap map[string][]string, advisories []string) ([]*packages.ZypperPatch, []*packages.PkgInfo) {
+	excluded := map[string]bool{}
+	for _, a := range advisories {
+		excluded[a] = true
+	}
+
+	var keepPatches []*packages.ZypperPatch
+	for _, p := range patches {
+		if excluded[p.Name] {
+			clog.Debugf(ctx, "Patch %q is an excluded advisory", p.Name)
+			continue
+		}
+		keepPatches = append(keepPatches, p)
+	}
+
+	names := map[string]bool{}
+	for name, patches := range pkgToPatchesMap {
+		for _, p := range patches {
+			if excluded[p] {
+				names[name] = true
+			}
+		}
+	}
+	return keepPatches, excludePackageNames(ctx, pkgs, names)
+}
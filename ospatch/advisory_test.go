@@ -0,0 +1,83 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExcludeZypperAdvisories(t *testing.T) {
+	patches := []*packages.ZypperPatch{{Name: "patch-1"}, {Name: "patch-2"}}
+	pkgs := []*packages.PkgInfo{{Name: "pkg1"}, {Name: "pkg2"}, {Name: "pkg3"}}
+	pkgToPatchesMap := map[string][]string{
+		"pkg1": {"patch-1"},
+		"pkg2": {"patch-1", "patch-2"},
+		"pkg3": {"patch-2"},
+	}
+
+	gotPatches, gotPkgs := excludeZypperAdvisories(context.Background(), patches, pkgs, pkgToPatchesMap, []string{"patch-1"})
+	if diff := cmp.Diff([]*packages.ZypperPatch{{Name: "patch-2"}}, gotPatches); diff != "" {
+		t.Errorf("patches mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]*packages.PkgInfo{{Name: "pkg3"}}, gotPkgs); diff != "" {
+		t.Errorf("packages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanYumUpdateMinSeverity(t *testing.T) {
+	if os.Getenv("EXIT100") == "1" {
+		os.Exit(100)
+	}
+	cmd := exec.CommandContext(context.Background(), os.Args[0], "-test.run=TestPlanYumUpdateMinSeverity")
+	cmd.Env = append(os.Environ(), "EXIT100=1")
+	exit100 := cmd.Run()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	packages.SetCommandRunner(mockCommandRunner)
+	packages.SetPtyCommandRunner(mockCommandRunner)
+
+	updates := "Upgrading:\n  kernel   x86_64   3.10.0-1160.108.1.el7   updates   50 M\n  tzdata   noarch   2024a-1.el7   updates   1 M\n  curl   x86_64   7.29.0-59.el7_9.2   updates   1 M\n"
+	updateinfo := `RHSA-2024:0001 Important/Sec. kernel-3.10.0-1160.108.1.el7.x86_64
+RHSA-2024:0002 Low/Sec.       curl-7.29.0-59.el7_9.2.x86_64
+RHBA-2024:0003 bugfix         tzdata-2024a-1.el7.noarch
+`
+	gomock.InOrder(
+		mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "check-update", "--assumeyes"))).Return(nil, nil, exit100).Times(1),
+		mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "update", "--assumeno", "--cacheonly", "--color=never"))).Return([]byte(updates), nil, nil).Times(1),
+		mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "updateinfo", "list", "updates"))).Return([]byte(updateinfo), nil, nil).Times(1),
+	)
+
+	plan, err := PlanYumUpdate(context.Background(), YumMinSeverity("Important"))
+	if err != nil {
+		t.Fatalf("PlanYumUpdate: unexpected error: %v", err)
+	}
+	var got []string
+	for _, p := range plan.Packages {
+		got = append(got, p.Name)
+	}
+	if diff := cmp.Diff([]string{"kernel"}, got); diff != "" {
+		t.Errorf("PlanYumUpdate: packages mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -16,7 +16,7 @@ package ospatch
 
 import (
 	"context"
-	"fmt"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -27,6 +27,16 @@ type aptGetUpgradeOpts struct {
 	excludes          []*Exclude
 	upgradeType       packages.AptUpgradeType
 	dryrun            bool
+	prePatchHooks     []*PatchHook
+	postPatchHooks    []*PatchHook
+	snapshot          *SnapshotConfig
+	healthChecks      []HealthCheck
+	stage             PatchStage
+	progress          ProgressFunc
+	refresh           *RepoRefresh
+	checkpoint        *CheckpointConfig
+	batch             *BatchConfig
+	env               []string
 }
 
 // AptGetUpgradeOption is an option for apt-get update.
@@ -60,8 +70,115 @@ func AptGetDryRun(dryrun bool) AptGetUpgradeOption {
 	}
 }
 
-// RunAptGetUpgrade runs apt-get upgrade.
-func RunAptGetUpgrade(ctx context.Context, opts ...AptGetUpgradeOption) error {
+// AptGetPrePatchHooks runs these hooks before installing updates, patching
+// is aborted if one fails.
+func AptGetPrePatchHooks(hooks []*PatchHook) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.prePatchHooks = hooks
+	}
+}
+
+// AptGetPostPatchHooks runs these hooks after installing updates.
+func AptGetPostPatchHooks(hooks []*PatchHook) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.postPatchHooks = hooks
+	}
+}
+
+// AptGetSnapshot takes a snapshot before installing updates and rolls back to
+// it if installing them or a post-patch hook fails.
+func AptGetSnapshot(snapshot *SnapshotConfig) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.snapshot = snapshot
+	}
+}
+
+// AptGetHealthChecks runs these checks after installing updates and the post-patch
+// hooks, see HealthCheck.
+func AptGetHealthChecks(checks []HealthCheck) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.healthChecks = checks
+	}
+}
+
+// AptGetStage selects the phase of a staged patch run, see PatchStage.
+func AptGetStage(stage PatchStage) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.stage = stage
+	}
+}
+
+// AptGetProgress reports the progress of the patch run to f.
+func AptGetProgress(f ProgressFunc) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.progress = f
+	}
+}
+
+// AptGetRefresh refreshes the repository metadata before patching, see
+// RepoRefresh.
+func AptGetRefresh(refresh *RepoRefresh) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.refresh = refresh
+	}
+}
+
+// AptGetCheckpoint checkpoints the run with cfg so it resumes where it left
+// off if interrupted, see CheckpointConfig.
+func AptGetCheckpoint(cfg *CheckpointConfig) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.checkpoint = cfg
+	}
+}
+
+// AptGetBatch installs the updates in the batches set by cfg, see
+// BatchConfig.
+func AptGetBatch(cfg *BatchConfig) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.batch = cfg
+	}
+}
+
+// AptGetEnv returns an AptGetUpgradeOption that adds env, a list of
+// "KEY=value" entries, to the environment of the apt-get commands, e.g. an
+// http_proxy for mirrors only reachable through a proxy. A DEBIAN_FRONTEND
+// entry overrides the noninteractive frontend the agent sets.
+func AptGetEnv(env []string) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.env = env
+	}
+}
+
+func aptGetUpgradePlan(ctx context.Context, aptOpts *aptGetUpgradeOpts) (*PatchPlan, error) {
+	pkgs, err := packages.AptUpdates(ctx, packages.AptGetUpgradeType(aptOpts.upgradeType), packages.AptGetUpgradeShowNew(true))
+	if err != nil {
+		return nil, err
+	}
+
+	fPkgs, err := filterPackages(pkgs, aptOpts.exclusivePackages, aptOpts.excludes, packages.CompareDebVersions)
+	if err != nil {
+		return nil, err
+	}
+	return newPatchPlan(fPkgs, nil), nil
+}
+
+// PlanAptGetUpgrade returns the updates RunAptGetUpgrade would install with
+// the same options, without installing anything.
+func PlanAptGetUpgrade(ctx context.Context, opts ...AptGetUpgradeOption) (*PatchPlan, error) {
+	aptOpts := &aptGetUpgradeOpts{upgradeType: packages.AptGetUpgrade}
+	for _, opt := range opts {
+		opt(aptOpts)
+	}
+	ctx = packages.WithCommandEnv(ctx, aptOpts.env)
+	return aptGetUpgradePlan(ctx, aptOpts)
+}
+
+// RunAptGetUpgrade runs apt-get upgrade and returns the PatchResult, which is set
+// even if installing the updates fails.
+func RunAptGetUpgrade(ctx context.Context, opts ...AptGetUpgradeOption) (*PatchResult, error) {
+	res := &PatchResult{}
+	defer res.timeSince(time.Now())
+
 	aptOpts := &aptGetUpgradeOpts{
 		upgradeType:       packages.AptGetUpgrade,
 		excludes:          nil,
@@ -72,19 +189,22 @@ func RunAptGetUpgrade(ctx context.Context, opts ...AptGetUpgradeOption) error {
 	for _, opt := range opts {
 		opt(aptOpts)
 	}
+	ctx = packages.WithCommandEnv(ctx, aptOpts.env)
 
-	pkgs, err := packages.AptUpdates(ctx, packages.AptGetUpgradeType(aptOpts.upgradeType), packages.AptGetUpgradeShowNew(true))
-	if err != nil {
-		return err
+	rctx := aptOpts.progress.watch(ctx, PhaseRefresh)
+	if err := res.refreshRepos(rctx, aptOpts.refresh, refreshAptRepos); err != nil {
+		return res, err
 	}
-
-	fPkgs, err := filterPackages(pkgs, aptOpts.exclusivePackages, aptOpts.excludes)
+	plan, err := planOrResume(rctx, aptOpts.checkpoint, packages.InstalledDebPackages, func() (*PatchPlan, error) {
+		return aptGetUpgradePlan(rctx, aptOpts)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	fPkgs := plan.Packages
 	if len(fPkgs) == 0 {
 		clog.Infof(ctx, "No packages to update.")
-		return nil
+		return res, nil
 	}
 
 	var pkgNames []string
@@ -92,23 +212,46 @@ func RunAptGetUpgrade(ctx context.Context, opts ...AptGetUpgradeOption) error {
 		pkgNames = append(pkgNames, pkg.Name)
 	}
 
-	msg := fmt.Sprintf("%d packages: %q", len(pkgNames), fPkgs)
 	if aptOpts.dryrun {
-		clog.Infof(ctx, "Running in dryrun mode, not updating %s", msg)
-		return nil
+		clog.Infof(ctx, "Running in dryrun mode, not updating %s", plan)
+		return res, nil
 	}
 
+	if aptOpts.stage == StageDownload {
+		clog.Infof(ctx, "Downloading %s, not installing.", plan)
+		err := packages.DownloadAptPackages(aptOpts.progress.watch(ctx, PhaseDownload), pkgNames)
+		if err == nil {
+			res.Downloaded = plan.Packages
+		}
+		return res, err
+	}
 	ops := opsToReport{
 		packages: fPkgs,
 	}
 	logOps(ctx, ops)
 
-	err = packages.InstallAptPackages(ctx, pkgNames)
+	install := packages.InstallAptPackages
+	if aptOpts.stage == StageInstallCached {
+		install = packages.InstallCachedAptPackages
+	}
+
+	err = installWithCheckpoint(ctx, aptOpts.checkpoint, plan, func() error {
+		return installWithSnapshot(ctx, aptOpts.snapshot, aptOpts.prePatchHooks, aptOpts.postPatchHooks, func() error {
+			ictx := aptOpts.progress.watch(ctx, PhaseInstall)
+			return preserveAutoMarks(ctx, fPkgs, packages.AptAutoInstalled, packages.AptMarkAuto, func() error {
+				return installBatches(ctx, aptOpts.batch, fPkgs, func(batch []*packages.PkgInfo) error {
+					return withInstallRetry(ictx, "installing apt packages", func() error {
+						return install(ictx, namesOf(batch))
+					})
+				})
+			})
+		}, aptOpts.progress.verify(res.healthCheck(ctx, aptOpts.healthChecks)))
+	})
 	if err == nil {
 		logSuccess(ctx, ops)
 	} else {
 		logFailure(ctx, ops, err)
 	}
-
-	return err
+	res.recordInstall(ctx, ops.packages, err, packages.InstalledDebPackages)
+	return res, err
 }
@@ -0,0 +1,48 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// preserveAutoMarks runs install, which installs the updates of pkgs by
+// name, and marks the ones that were automatically installed as such again
+// afterwards. Installing a package by name marks it as requested, which
+// would keep autoremove from ever removing it.
+func preserveAutoMarks(ctx context.Context, pkgs []*packages.PkgInfo, autoInstalled func(context.Context) (map[string]bool, error), markAuto func(context.Context, []string) error, install func() error) error {
+	auto, err := autoInstalled(ctx)
+	if err != nil {
+		clog.Debugf(ctx, "Error reading auto installed markers, not preserving them: %v", err)
+		return install()
+	}
+
+	err = install()
+	var remark []string
+	for _, p := range pkgs {
+		if auto[p.Name] {
+			remark = append(remark, p.Name)
+		}
+	}
+	if len(remark) > 0 {
+		if merr := markAuto(ctx, remark); merr != nil {
+			clog.Errorf(ctx, "Error restoring the auto installed markers of %q: %v", remark, merr)
+		}
+	}
+	return err
+}
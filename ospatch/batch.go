@@ -0,0 +1,124 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// BatchConfig splits the package updates of a patch run into batches that
+// are installed one after the other, instead of one large transaction.
+type BatchConfig struct {
+	// Size is the maximum number of packages per batch, 0 for no limit.
+	Size int
+	// ByRepository puts the updates from each repository in their own
+	// batches, in the order the repositories first appear in the plan.
+	ByRepository bool
+	// Delay is the pause between batches.
+	Delay time.Duration
+	// FailureBudget is the number of failed batches tolerated, the run stops
+	// once more batches failed. 0 stops at the first failed batch.
+	FailureBudget int
+}
+
+// splitBatches splits pkgs as set by cfg, a nil cfg returns a single batch.
+func splitBatches(pkgs []*packages.PkgInfo, cfg *BatchConfig) [][]*packages.PkgInfo {
+	if len(pkgs) == 0 {
+		return nil
+	}
+	if cfg == nil {
+		return [][]*packages.PkgInfo{pkgs}
+	}
+
+	groups := [][]*packages.PkgInfo{pkgs}
+	if cfg.ByRepository {
+		groups = nil
+		idx := map[string]int{}
+		for _, p := range pkgs {
+			i, ok := idx[p.Repository]
+			if !ok {
+				i = len(groups)
+				idx[p.Repository] = i
+				groups = append(groups, nil)
+			}
+			groups[i] = append(groups[i], p)
+		}
+	}
+	if cfg.Size <= 0 {
+		return groups
+	}
+
+	var batches [][]*packages.PkgInfo
+	for _, g := range groups {
+		for len(g) > cfg.Size {
+			batches = append(batches, g[:cfg.Size])
+			g = g[cfg.Size:]
+		}
+		batches = append(batches, g)
+	}
+	return batches
+}
+
+// installBatches installs pkgs in the batches set by cfg, waiting
+// cfg.Delay between them. It stops once more batches failed than the
+// failure budget allows, the returned error lists all failed batches.
+func installBatches(ctx context.Context, cfg *BatchConfig, pkgs []*packages.PkgInfo, install func([]*packages.PkgInfo) error) error {
+	if cfg == nil {
+		return install(pkgs)
+	}
+
+	batches := splitBatches(pkgs, cfg)
+	var errs []string
+	for i, b := range batches {
+		if i > 0 && cfg.Delay > 0 {
+			clog.Debugf(ctx, "Waiting %s before the next patch batch.", cfg.Delay)
+			select {
+			case <-time.After(cfg.Delay):
+			case <-ctx.Done():
+				errs = append(errs, ctx.Err().Error())
+				return errors.New(strings.Join(errs, "\n"))
+			}
+		}
+		clog.Infof(ctx, "Installing patch batch %d of %d: %q", i+1, len(batches), namesOf(b))
+		if err := install(b); err != nil {
+			errs = append(errs, fmt.Sprintf("batch %d of %d failed: %v", i+1, len(batches), err))
+			if len(errs) > cfg.FailureBudget {
+				if i+1 < len(batches) {
+					errs = append(errs, fmt.Sprintf("failure budget of %d exceeded, skipped the remaining %d batches", cfg.FailureBudget, len(batches)-i-1))
+				}
+				break
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+func namesOf(pkgs []*packages.PkgInfo) []string {
+	var names []string
+	for _, p := range pkgs {
+		names = append(names, p.Name)
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitBatches(t *testing.T) {
+	pkgs := []*packages.PkgInfo{
+		{Name: "a", Repository: "updates"},
+		{Name: "b", Repository: "base"},
+		{Name: "c", Repository: "updates"},
+		{Name: "d", Repository: "updates"},
+		{Name: "e", Repository: "base"},
+	}
+	tests := []struct {
+		name string
+		cfg  *BatchConfig
+		want [][]string
+	}{
+		{"NoConfig", nil, [][]string{{"a", "b", "c", "d", "e"}}},
+		{"Size", &BatchConfig{Size: 2}, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{"ByRepository", &BatchConfig{ByRepository: true}, [][]string{{"a", "c", "d"}, {"b", "e"}}},
+		{"ByRepositoryAndSize", &BatchConfig{ByRepository: true, Size: 2}, [][]string{{"a", "c"}, {"d"}, {"b", "e"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, b := range splitBatches(pkgs, tt.cfg) {
+				got = append(got, namesOf(b))
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("splitBatches() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInstallBatchesFailureBudget(t *testing.T) {
+	pkgs := []*packages.PkgInfo{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	tests := []struct {
+		name   string
+		budget int
+		want   [][]string
+	}{
+		{"StopAtFirstFailure", 0, [][]string{{"a"}, {"b"}}},
+		{"TolerateOne", 1, [][]string{{"a"}, {"b"}, {"c"}, {"d"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			err := installBatches(context.Background(), &BatchConfig{Size: 1, FailureBudget: tt.budget}, pkgs, func(batch []*packages.PkgInfo) error {
+				got = append(got, namesOf(batch))
+				if batch[0].Name == "b" || batch[0].Name == "d" {
+					return errors.New("install failed")
+				}
+				return nil
+			})
+			if err == nil {
+				t.Error("installBatches() did not return an error")
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("installBatches() batches mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInstallBatchesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pkgs := []*packages.PkgInfo{{Name: "a"}, {Name: "b"}}
+	var got []string
+	err := installBatches(ctx, &BatchConfig{Size: 1, Delay: time.Hour}, pkgs, func(batch []*packages.PkgInfo) error {
+		got = append(got, namesOf(batch)...)
+		cancel()
+		return nil
+	})
+	if !errors.Is(ctx.Err(), context.Canceled) || err == nil {
+		t.Errorf("installBatches() = %v, want an error after cancellation", err)
+	}
+	if diff := cmp.Diff([]string{"a"}, got); diff != "" {
+		t.Errorf("installBatches() installed mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,158 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// maxCheckpointAge is how long a checkpoint can be resumed from, older ones
+// are discarded and the run plans from scratch.
+const maxCheckpointAge = 24 * time.Hour
+
+// CheckpointConfig makes a patch run record what it is installing in a
+// state file before it starts, so a run interrupted by the agent stopping
+// resumes with the updates it had not installed yet rather than planning
+// again.
+type CheckpointConfig struct {
+	// Path is the state file, it is removed once the run completes.
+	Path string
+	// RunID identifies the patch run, the checkpoint of a different run is
+	// discarded.
+	RunID string
+}
+
+// checkpoint is the content of the state file.
+type checkpoint struct {
+	RunID    string
+	Created  time.Time
+	Packages []*packages.PkgInfo     `json:",omitempty"`
+	Patches  []*packages.ZypperPatch `json:",omitempty"`
+}
+
+func loadCheckpoint(cfg *CheckpointConfig) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(cfg.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("error parsing patch checkpoint %q: %v", cfg.Path, err)
+	}
+	if c.RunID != cfg.RunID || time.Since(c.Created) > maxCheckpointAge {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func saveCheckpoint(cfg *CheckpointConfig, plan *PatchPlan) error {
+	data, err := json.Marshal(&checkpoint{RunID: cfg.RunID, Created: time.Now(), Packages: plan.Packages, Patches: plan.Patches})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(cfg.Path, data, 0600)
+}
+
+func removeCheckpoint(ctx context.Context, cfg *CheckpointConfig) {
+	if err := os.Remove(cfg.Path); err != nil && !os.IsNotExist(err) {
+		clog.Errorf(ctx, "Error removing patch checkpoint %q: %v", cfg.Path, err)
+	}
+}
+
+// remaining returns the checkpointed package updates that are not installed
+// at their planned version yet.
+func (c *checkpoint) remaining(ctx context.Context, installed func(context.Context) ([]*packages.PkgInfo, error)) ([]*packages.PkgInfo, error) {
+	if len(c.Packages) == 0 {
+		return nil, nil
+	}
+	current, err := installed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string]string{}
+	for _, p := range current {
+		versions[pkgKey(p)] = p.Version
+	}
+	var pkgs []*packages.PkgInfo
+	for _, p := range c.Packages {
+		if versions[pkgKey(p)] != p.Version {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs, nil
+}
+
+// planOrResume returns the plan of the interrupted run checkpointed with
+// cfg, without the updates it already installed. Without a checkpoint to
+// resume from it returns plan().
+func planOrResume(ctx context.Context, cfg *CheckpointConfig, installed func(context.Context) ([]*packages.PkgInfo, error), plan func() (*PatchPlan, error)) (*PatchPlan, error) {
+	if cfg == nil {
+		return plan()
+	}
+	c, err := loadCheckpoint(cfg)
+	if err != nil {
+		clog.Warningf(ctx, "Error loading patch checkpoint, planning from scratch: %v", err)
+		return plan()
+	}
+	if c == nil {
+		return plan()
+	}
+	pkgs, err := c.remaining(ctx, installed)
+	if err != nil {
+		clog.Warningf(ctx, "Error listing installed packages to resume from patch checkpoint, planning from scratch: %v", err)
+		return plan()
+	}
+	clog.Infof(ctx, "Resuming interrupted patch run, %d of %d package updates and %d patches left.", len(pkgs), len(c.Packages), len(c.Patches))
+	p := newPatchPlan(pkgs, c.Patches)
+	if p.Empty() {
+		removeCheckpoint(ctx, cfg)
+	}
+	return p, nil
+}
+
+// installWithCheckpoint checkpoints plan with cfg and runs install. The
+// checkpoint is removed once install returns unless ctx was canceled, which
+// is how the agent stopping interrupts the run.
+func installWithCheckpoint(ctx context.Context, cfg *CheckpointConfig, plan *PatchPlan, install func() error) error {
+	if cfg == nil {
+		return install()
+	}
+	if err := saveCheckpoint(cfg, plan); err != nil {
+		clog.Warningf(ctx, "Error saving patch checkpoint, the run can not be resumed if interrupted: %v", err)
+	}
+	err := install()
+	if ctx.Err() != nil {
+		clog.Infof(ctx, "Patch run interrupted, keeping checkpoint %q to resume from.", cfg.Path)
+		return err
+	}
+	removeCheckpoint(ctx, cfg)
+	return err
+}
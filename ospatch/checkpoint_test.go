@@ -0,0 +1,72 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	ctx := context.Background()
+	cfg := &CheckpointConfig{Path: filepath.Join(t.TempDir(), "yum.checkpoint"), RunID: "task-1"}
+	foo := &packages.PkgInfo{Name: "foo", Arch: "x86_64", Version: "2.0.0-1"}
+	bar := &packages.PkgInfo{Name: "bar", Arch: "x86_64", Version: "3.0.0-1"}
+	planned := newPatchPlan([]*packages.PkgInfo{foo, bar}, nil)
+
+	// The agent stopping cancels ctx and interrupts the install.
+	cctx, cancel := context.WithCancel(ctx)
+	err := installWithCheckpoint(cctx, cfg, planned, func() error {
+		cancel()
+		return errors.New("signal: killed")
+	})
+	if err == nil {
+		t.Fatal("installWithCheckpoint: expected the install error")
+	}
+	if _, err := os.Stat(cfg.Path); err != nil {
+		t.Fatalf("interrupted run did not keep its checkpoint: %v", err)
+	}
+
+	installed := func(context.Context) ([]*packages.PkgInfo, error) {
+		return []*packages.PkgInfo{{Name: "foo", Arch: "x86_64", Version: "2.0.0-1"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0-1"}}, nil
+	}
+	replan := func() (*PatchPlan, error) { return nil, errors.New("planned from scratch") }
+
+	// A different run discards the checkpoint.
+	if _, err := planOrResume(ctx, &CheckpointConfig{Path: cfg.Path, RunID: "task-2"}, installed, replan); err == nil {
+		t.Error("planOrResume: resumed from the checkpoint of a different run")
+	}
+
+	plan, err := planOrResume(ctx, cfg, installed, replan)
+	if err != nil {
+		t.Fatalf("planOrResume: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]*packages.PkgInfo{bar}, plan.Packages); diff != "" {
+		t.Errorf("planOrResume: unexpected packages (-want +got):\n%s", diff)
+	}
+
+	if err := installWithCheckpoint(ctx, cfg, plan, func() error { return nil }); err != nil {
+		t.Fatalf("installWithCheckpoint: unexpected error: %v", err)
+	}
+	if _, err := os.Stat(cfg.Path); !os.IsNotExist(err) {
+		t.Errorf("completed run did not remove its checkpoint: %v", err)
+	}
+}
@@ -16,18 +16,39 @@ package ospatch
 
 import (
 	"fmt"
+	"path"
 	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
 )
 
+// constraintOps are the version constraint operators, two character ones
+// first so they are matched before their prefix.
+var constraintOps = []string{"<=", ">=", "!=", "==", "<", ">", "="}
+
 // Exclude represents package exclude entry by a user
 type Exclude struct {
 	isRegexp     bool
 	regex        *regexp.Regexp
 	strictString *string
+	// glob is a path.Match pattern for the name.
+	glob string
+	// op and version restrict the match to versions satisfying the
+	// constraint, e.g. "<" "3.0.14". The name is then matched by glob.
+	op, version string
 }
 
 func (exclude Exclude) String() string {
-	return fmt.Sprintf("{isRegexp: %t, regex: %+v, strictString: %s}", exclude.isRegexp, exclude.regex, *exclude.strictString)
+	switch {
+	case exclude.isRegexp:
+		return fmt.Sprintf("{regex: %s}", exclude.regex)
+	case exclude.op != "":
+		return fmt.Sprintf("{glob: %s, version: %s%s}", exclude.glob, exclude.op, exclude.version)
+	case exclude.glob != "":
+		return fmt.Sprintf("{glob: %s}", exclude.glob)
+	}
+	return fmt.Sprintf("{strictString: %s}", *exclude.strictString)
 }
 
 // CreateRegexExclude returns new Exclude struct that represents exclusion with regex
@@ -47,10 +68,112 @@ func CreateStringExclude(strictString *string) *Exclude {
 	}
 }
 
-// MatchesName returns if a package with a certain name matches Exclude struct and should be excluded
+// CreateGlobExclude returns new Exclude struct that represents exclusion
+// with a glob pattern like "kernel*", see path.Match for the syntax.
+func CreateGlobExclude(pattern string) (*Exclude, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+	}
+	return &Exclude{glob: pattern}, nil
+}
+
+// CreateVersionExclude returns new Exclude struct that represents exclusion
+// of the packages matching the glob pattern name with a version satisfying
+// op version, op being one of <, <=, >, >=, =, == or !=.
+func CreateVersionExclude(name, op, version string) (*Exclude, error) {
+	exclude, err := CreateGlobExclude(name)
+	if err != nil {
+		return nil, err
+	}
+	valid := false
+	for _, o := range constraintOps {
+		valid = valid || o == op
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid version constraint operator %q", op)
+	}
+	if version == "" {
+		return nil, fmt.Errorf("missing version in constraint for %q", name)
+	}
+	exclude.op, exclude.version = op, version
+	return exclude, nil
+}
+
+// ParseExclude parses an exclude entry: "/regex/", a version constraint
+// like "openssl<3.0.14", a glob pattern like "kernel*" or else a package
+// name.
+func ParseExclude(s string) (*Exclude, error) {
+	if len(s) >= 2 && s[0] == '/' && s[len(s)-1] == '/' {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		return CreateRegexExclude(re), nil
+	}
+	for _, op := range constraintOps {
+		if i := strings.Index(s, op); i > 0 {
+			return CreateVersionExclude(strings.TrimSpace(s[:i]), op, strings.TrimSpace(s[i+len(op):]))
+		}
+	}
+	if strings.ContainsAny(s, "*?[") {
+		return CreateGlobExclude(s)
+	}
+	return CreateStringExclude(&s), nil
+}
+
+// MatchesName returns if a package with a certain name matches Exclude
+// struct and should be excluded. A version constraint is not checked, see
+// MatchesPackage.
 func (exclude *Exclude) MatchesName(name *string) bool {
-	if exclude.isRegexp {
+	switch {
+	case exclude.isRegexp:
 		return exclude.regex.MatchString(*name)
+	case exclude.glob != "":
+		ok, _ := path.Match(exclude.glob, *name)
+		return ok
 	}
 	return *exclude.strictString == *name
 }
+
+// trimVersion drops the epoch and release of version if constraint has
+// none, so "openssl<=3.0.14" matches 1:3.0.14-1.el9 like rpm and dpkg
+// would.
+func trimVersion(version, constraint string) string {
+	if !strings.Contains(constraint, ":") {
+		if i := strings.Index(version, ":"); i >= 0 {
+			version = version[i+1:]
+		}
+	}
+	if !strings.Contains(constraint, "-") {
+		if i := strings.LastIndex(version, "-"); i >= 0 {
+			version = version[:i]
+		}
+	}
+	return version
+}
+
+// MatchesPackage returns if pkg matches the Exclude, including its version
+// constraint, compared with compare. A package without a version matches
+// any constraint, excluding too much is safer than too little.
+func (exclude *Exclude) MatchesPackage(pkg *packages.PkgInfo, compare func(a, b string) int) bool {
+	if !exclude.MatchesName(&pkg.Name) {
+		return false
+	}
+	if exclude.op == "" || pkg.Version == "" {
+		return true
+	}
+	c := compare(trimVersion(pkg.Version, exclude.version), exclude.version)
+	switch exclude.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "!=":
+		return c != 0
+	}
+	return c == 0
+}
@@ -16,7 +16,7 @@ package ospatch
 
 import (
 	"context"
-	"fmt"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -26,6 +26,13 @@ type googetUpdateOpts struct {
 	exclusivePackages []string
 	excludes          []*Exclude
 	dryrun            bool
+	prePatchHooks     []*PatchHook
+	postPatchHooks    []*PatchHook
+	healthChecks      []HealthCheck
+	progress          ProgressFunc
+	checkpoint        *CheckpointConfig
+	batch             *BatchConfig
+	env               []string
 }
 
 // GooGetUpdateOption is an option for apt-get update.
@@ -52,48 +59,134 @@ func GooGetDryRun(dryrun bool) GooGetUpdateOption {
 	}
 }
 
-// RunGooGetUpdate runs googet update.
-func RunGooGetUpdate(ctx context.Context, opts ...GooGetUpdateOption) error {
-	googetOpts := &googetUpdateOpts{}
+// GooGetPrePatchHooks runs these hooks before installing updates, patching
+// is aborted if one fails.
+func GooGetPrePatchHooks(hooks []*PatchHook) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.prePatchHooks = hooks
+	}
+}
 
-	for _, opt := range opts {
-		opt(googetOpts)
+// GooGetPostPatchHooks runs these hooks after installing updates.
+func GooGetPostPatchHooks(hooks []*PatchHook) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.postPatchHooks = hooks
+	}
+}
+
+// GooGetHealthChecks runs these checks after installing updates and the
+// post-patch hooks, see HealthCheck.
+func GooGetHealthChecks(checks []HealthCheck) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.healthChecks = checks
+	}
+}
+
+// GooGetProgress reports the progress of the patch run to f, googet only
+// reports phase transitions.
+func GooGetProgress(f ProgressFunc) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.progress = f
+	}
+}
+
+// GooGetCheckpoint checkpoints the run with cfg so it resumes where it left
+// off if interrupted, see CheckpointConfig.
+func GooGetCheckpoint(cfg *CheckpointConfig) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.checkpoint = cfg
+	}
+}
+
+// GooGetBatch installs the updates in the batches set by cfg, see
+// BatchConfig.
+func GooGetBatch(cfg *BatchConfig) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.batch = cfg
 	}
+}
 
+// GooGetEnv returns a GooGetUpdateOption that adds env, a list of
+// "KEY=value" entries, to the environment of the googet commands, e.g. an
+// http_proxy for mirrors only reachable through a proxy.
+func GooGetEnv(env []string) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.env = env
+	}
+}
+
+func googetUpdatePlan(ctx context.Context, googetOpts *googetUpdateOpts) (*PatchPlan, error) {
 	pkgs, err := packages.GooGetUpdates(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fPkgs, err := filterPackages(pkgs, googetOpts.exclusivePackages, googetOpts.excludes)
+	fPkgs, err := filterPackages(pkgs, googetOpts.exclusivePackages, googetOpts.excludes, packages.CompareRPMEVR)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(fPkgs) == 0 {
-		clog.Infof(ctx, "No packages to update.")
-		return nil
+	return newPatchPlan(fPkgs, nil), nil
+}
+
+// PlanGooGetUpdate returns the updates RunGooGetUpdate would install with the
+// same options, without installing anything.
+func PlanGooGetUpdate(ctx context.Context, opts ...GooGetUpdateOption) (*PatchPlan, error) {
+	googetOpts := &googetUpdateOpts{}
+	for _, opt := range opts {
+		opt(googetOpts)
 	}
+	ctx = packages.WithCommandEnv(ctx, googetOpts.env)
+	return googetUpdatePlan(ctx, googetOpts)
+}
 
-	var pkgNames []string
-	for _, pkg := range fPkgs {
-		pkgNames = append(pkgNames, pkg.Name)
+// RunGooGetUpdate runs googet update and returns the PatchResult, which is set
+// even if installing the updates fails.
+func RunGooGetUpdate(ctx context.Context, opts ...GooGetUpdateOption) (*PatchResult, error) {
+	res := &PatchResult{}
+	defer res.timeSince(time.Now())
+
+	googetOpts := &googetUpdateOpts{}
+
+	for _, opt := range opts {
+		opt(googetOpts)
+	}
+	ctx = packages.WithCommandEnv(ctx, googetOpts.env)
+
+	rctx := googetOpts.progress.watch(ctx, PhaseRefresh)
+	plan, err := planOrResume(rctx, googetOpts.checkpoint, packages.InstalledGooGetPackages, func() (*PatchPlan, error) {
+		return googetUpdatePlan(rctx, googetOpts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	fPkgs := plan.Packages
+	if len(fPkgs) == 0 {
+		clog.Infof(ctx, "No packages to update.")
+		return res, nil
 	}
 
-	msg := fmt.Sprintf("%d packages: %q", len(pkgNames), fPkgs)
 	if googetOpts.dryrun {
-		clog.Infof(ctx, "Running in dryrun mode, not updating %s", msg)
-		return nil
+		clog.Infof(ctx, "Running in dryrun mode, not updating %s", plan)
+		return res, nil
 	}
 	ops := opsToReport{
 		packages: fPkgs,
 	}
 	logOps(ctx, ops)
 
-	err = packages.InstallGooGetPackages(ctx, pkgNames)
+	err = installWithCheckpoint(ctx, googetOpts.checkpoint, plan, func() error {
+		return installWithSnapshot(ctx, nil, googetOpts.prePatchHooks, googetOpts.postPatchHooks, func() error {
+			ictx := googetOpts.progress.watch(ctx, PhaseInstall)
+			return installBatches(ctx, googetOpts.batch, fPkgs, func(batch []*packages.PkgInfo) error {
+				return packages.InstallGooGetPackages(ictx, namesOf(batch))
+			})
+		}, googetOpts.progress.verify(res.healthCheck(ctx, googetOpts.healthChecks)))
+	})
 	if err == nil {
 		logSuccess(ctx, ops)
 	} else {
 		logFailure(ctx, ops, err)
 	}
-	return err
+	res.recordInstall(ctx, ops.packages, err, packages.InstalledGooGetPackages)
+	return res, err
 }
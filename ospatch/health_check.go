@@ -0,0 +1,169 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+const (
+	systemctl = "/bin/systemctl"
+
+	// defaultHealthCheckTimeout is the timeout of health checks without one.
+	defaultHealthCheckTimeout = time.Minute
+)
+
+var (
+	healthCheckRunner = util.CommandRunner(&util.DefaultRunner{})
+	dialContext       = (&net.Dialer{}).DialContext
+)
+
+// HealthCheck validates the system after patches are installed. A failing
+// check is reported in PatchResult.HealthCheckFailures and makes the run
+// return a *HealthCheckError.
+type HealthCheck interface {
+	fmt.Stringer
+	Check(ctx context.Context) error
+}
+
+// SystemdUnitCheck checks that a systemd unit is active.
+type SystemdUnitCheck struct {
+	Unit string
+}
+
+func (c *SystemdUnitCheck) String() string {
+	return fmt.Sprintf("systemd unit %q", c.Unit)
+}
+
+// Check implements HealthCheck.
+func (c *SystemdUnitCheck) Check(ctx context.Context) error {
+	stdout, _, err := healthCheckRunner.Run(ctx, exec.CommandContext(ctx, systemctl, "is-active", c.Unit))
+	if err != nil {
+		return fmt.Errorf("unit is %s", strings.TrimSpace(string(stdout)))
+	}
+	return nil
+}
+
+// TCPCheck checks that a TCP connection can be made to Address, in
+// "host:port" form.
+type TCPCheck struct {
+	Address string
+	Timeout time.Duration
+}
+
+func (c *TCPCheck) String() string {
+	return fmt.Sprintf("TCP port %s", c.Address)
+}
+
+// Check implements HealthCheck.
+func (c *TCPCheck) Check(ctx context.Context) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// CommandCheck checks that a command exits with status 0.
+type CommandCheck struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+func (c *CommandCheck) String() string {
+	return fmt.Sprintf("command %q", append([]string{c.Path}, c.Args...))
+}
+
+// Check implements HealthCheck.
+func (c *CommandCheck) Check(ctx context.Context) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, stderr, err := healthCheckRunner.Run(ctx, exec.CommandContext(ctx, c.Path, c.Args...))
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("did not finish within %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%v, stderr: %q", err, stderr)
+	}
+	return nil
+}
+
+// HealthCheckFailure is a failed health check.
+type HealthCheckFailure struct {
+	Check string
+	Error string
+}
+
+// HealthCheckError is returned by the Run functions when the updates were
+// installed but a health check failed afterwards. Orchestration should
+// treat it as a reason to halt a rollout rather than an install failure.
+type HealthCheckError struct {
+	Failures []*HealthCheckFailure
+}
+
+func (e *HealthCheckError) Error() string {
+	var msgs []string
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Check, f.Error))
+	}
+	return fmt.Sprintf("post-patch health check failed: %s", strings.Join(msgs, "; "))
+}
+
+// runHealthChecks runs all checks, not stopping at the first failure, and
+// records the failures in r.
+func (r *PatchResult) runHealthChecks(ctx context.Context, checks []HealthCheck) error {
+	r.HealthCheckFailures = nil
+	for _, c := range checks {
+		clog.Infof(ctx, "Running post-patch health check %s.", c)
+		if err := c.Check(ctx); err != nil {
+			clog.Errorf(ctx, "Post-patch health check %s failed: %v", c, err)
+			r.HealthCheckFailures = append(r.HealthCheckFailures, &HealthCheckFailure{Check: c.String(), Error: err.Error()})
+		}
+	}
+	if len(r.HealthCheckFailures) > 0 {
+		return &HealthCheckError{Failures: r.HealthCheckFailures}
+	}
+	return nil
+}
+
+// healthCheck returns the check func for installWithSnapshot, nil if there
+// are no checks.
+func (r *PatchResult) healthCheck(ctx context.Context, checks []HealthCheck) func() error {
+	if len(checks) == 0 {
+		return nil
+	}
+	return func() error { return r.runHealthChecks(ctx, checks) }
+}
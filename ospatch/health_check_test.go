@@ -0,0 +1,110 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	healthCheckRunner = mockCommandRunner
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	// Closed right away so the second TCP check has nothing to connect to.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	defer l.Close()
+
+	mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command(systemctl, "is-active", "nginx.service"))).Return([]byte("active\n"), nil, nil).Times(1)
+	mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command(systemctl, "is-active", "db.service"))).Return([]byte("failed\n"), nil, errors.New("exit status 3")).Times(1)
+	mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/bin/check", "--quick"))).Return(nil, []byte("oops"), errors.New("exit status 1")).Times(1)
+
+	res := &PatchResult{}
+	err = res.runHealthChecks(ctx, []HealthCheck{
+		&SystemdUnitCheck{Unit: "nginx.service"},
+		&SystemdUnitCheck{Unit: "db.service"},
+		&TCPCheck{Address: addr},
+		&TCPCheck{Address: closedAddr},
+		&CommandCheck{Path: "/bin/check", Args: []string{"--quick"}},
+	})
+	var hcErr *HealthCheckError
+	if !errors.As(err, &hcErr) {
+		t.Fatalf("runHealthChecks() = %v, want a *HealthCheckError", err)
+	}
+	if len(res.HealthCheckFailures) != 3 {
+		t.Fatalf("got %d failures, want 3: %v", len(res.HealthCheckFailures), err)
+	}
+	var gotChecks []string
+	for _, f := range res.HealthCheckFailures {
+		gotChecks = append(gotChecks, f.Check)
+	}
+	want := []string{`systemd unit "db.service"`, "TCP port " + closedAddr, `command ["/bin/check" "--quick"]`}
+	if diff := cmp.Diff(want, gotChecks); diff != "" {
+		t.Errorf("failed checks mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := res.HealthCheckFailures[0].Error, "unit is failed"; got != want {
+		t.Errorf("failure error = %q, want %q", got, want)
+	}
+}
+
+func TestInstallWithSnapshotHealthCheck(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	snapshotRunner = mockCommandRunner
+	healthCheckRunner = mockCommandRunner
+	ctx := context.Background()
+
+	take := mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command(dnf, "--quiet", "history", "info", "last"))).Return(dnfHistoryInfo, nil, nil).Times(1)
+	check := mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command(systemctl, "is-active", "app.service"))).After(take).Return([]byte("inactive\n"), nil, errors.New("exit status 3")).Times(1)
+	mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command(dnf, "--assumeyes", "history", "rollback", "42"))).After(check).Return(nil, nil, nil).Times(1)
+
+	res := &PatchResult{}
+	installed := false
+	err := installWithSnapshot(ctx, &SnapshotConfig{Method: SnapshotDNFHistory}, nil, nil, func() error {
+		installed = true
+		return nil
+	}, res.healthCheck(ctx, []HealthCheck{&SystemdUnitCheck{Unit: "app.service"}}))
+	if !installed {
+		t.Error("install was not called")
+	}
+	var hcErr *HealthCheckError
+	if !errors.As(err, &hcErr) {
+		t.Fatalf("installWithSnapshot() = %v, want a *HealthCheckError", err)
+	}
+	if len(res.HealthCheckFailures) != 1 {
+		t.Errorf("got %d health check failures, want 1", len(res.HealthCheckFailures))
+	}
+}
@@ -0,0 +1,36 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+// installRetryPolicy retries package installs that failed with a transient
+// error, like a mirror timing out, or because another process held the
+// package manager lock.
+var installRetryPolicy = retryutil.Exponential(15*time.Second, 2*time.Minute).WithJitter(0.2).WithMaxAttempts(3).WithRetryOn(func(err error) bool {
+	return packages.IsTransient(err) || packages.IsLockContention(err)
+})
+
+// withInstallRetry calls install, retrying it as installRetryPolicy allows.
+// desc describes the install in the log messages.
+func withInstallRetry(ctx context.Context, desc string, install func() error) error {
+	return retryutil.Do(ctx, installRetryPolicy, desc, install)
+}
@@ -0,0 +1,57 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+func TestWithInstallRetry(t *testing.T) {
+	old := installRetryPolicy
+	defer func() { installRetryPolicy = old }()
+	installRetryPolicy.Initial = time.Millisecond
+	installRetryPolicy.Max = time.Millisecond
+
+	locked := &packages.CmdError{Cmd: "/usr/bin/apt-get", Class: packages.ErrorLockContention, Err: errors.New("exit status 100")}
+	notFound := &packages.CmdError{Cmd: "/usr/bin/apt-get", Class: packages.ErrorNotFound, Err: errors.New("exit status 100")}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"LockReleased", []error{locked, nil}, 2, false},
+		{"NotRetried", []error{notFound}, 1, true},
+		{"AttemptsExhausted", []error{locked, locked, locked, nil}, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			err := withInstallRetry(context.Background(), "installing", func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Errorf("withInstallRetry() made %d calls and returned %v, want %d calls and error: %t", calls, err, tt.wantCalls, tt.wantErr)
+			}
+		})
+	}
+}
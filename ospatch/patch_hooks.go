@@ -0,0 +1,91 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// defaultPatchHookTimeout is the timeout of PatchHooks without one.
+const defaultPatchHookTimeout = 10 * time.Minute
+
+var hookRunner = util.CommandRunner(&util.DefaultRunner{})
+
+// PatchHook is a command or script run before or after patches are
+// installed.
+type PatchHook struct {
+	Path string
+	Args []string
+	// Timeout is how long the hook may run before it is killed and reported
+	// as failed, defaults to 10 minutes.
+	Timeout time.Duration
+}
+
+func (h *PatchHook) String() string {
+	return fmt.Sprintf("%q", append([]string{h.Path}, h.Args...))
+}
+
+func runPatchHook(ctx context.Context, h *PatchHook) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultPatchHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout, stderr, err := hookRunner.Run(ctx, exec.CommandContext(ctx, h.Path, h.Args...))
+	// The hook output is part of the patch report.
+	clog.Infof(clog.WithLabels(ctx, repLabels), "Patch hook %s output: stdout: %q, stderr: %q", h, stdout, stderr)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("patch hook %s did not finish within %s", h, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("patch hook %s failed: %v, stderr: %q", h, err, stderr)
+	}
+	return nil
+}
+
+func runPatchHooks(ctx context.Context, hooks []*PatchHook) error {
+	for _, h := range hooks {
+		clog.Infof(ctx, "Running patch hook %s.", h)
+		if err := runPatchHook(ctx, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installWithHooks runs the pre hooks, install and then the post hooks. A
+// failing pre hook aborts the patch, install is not called. The post hooks
+// run even if install fails so they can undo what the pre hooks did.
+func installWithHooks(ctx context.Context, pre, post []*PatchHook, install func() error) error {
+	if err := runPatchHooks(ctx, pre); err != nil {
+		return fmt.Errorf("not patching, pre-patch hook failed: %v", err)
+	}
+	err := install()
+	if hookErr := runPatchHooks(ctx, post); hookErr != nil {
+		if err != nil {
+			return fmt.Errorf("%v; post-patch hook failed: %v", err, hookErr)
+		}
+		return fmt.Errorf("post-patch hook failed: %v", hookErr)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func TestInstallWithHooks(t *testing.T) {
+	ctx := context.Background()
+	pre := []*PatchHook{{Path: "/bin/pre", Args: []string{"a"}}}
+	post := []*PatchHook{{Path: "/bin/post"}}
+	preCmd := utilmocks.EqCmd(exec.Command("/bin/pre", "a"))
+	postCmd := utilmocks.EqCmd(exec.Command("/bin/post"))
+
+	tests := []struct {
+		name       string
+		preErr     error
+		installErr error
+		postErr    error
+		wantErr    string
+		// wantInstall is whether install and the post hooks run.
+		wantInstall bool
+	}{
+		{"Success", nil, nil, nil, "", true},
+		{"PreHookFails", errors.New("exit status 1"), nil, nil, "not patching, pre-patch hook failed", false},
+		{"InstallFails", nil, errors.New("install failed"), nil, "install failed", true},
+		{"PostHookFails", nil, nil, errors.New("exit status 2"), "post-patch hook failed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+			hookRunner = mockCommandRunner
+
+			preCall := mockCommandRunner.EXPECT().Run(gomock.Any(), preCmd).Return([]byte("stdout"), []byte("stderr"), tt.preErr).Times(1)
+			if tt.wantInstall {
+				mockCommandRunner.EXPECT().Run(gomock.Any(), postCmd).After(preCall).Return(nil, nil, tt.postErr).Times(1)
+			}
+
+			installed := false
+			err := installWithHooks(ctx, pre, post, func() error {
+				installed = true
+				return tt.installErr
+			})
+			if installed != tt.wantInstall {
+				t.Errorf("installed = %t, want %t", installed, tt.wantInstall)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
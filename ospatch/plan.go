@@ -0,0 +1,89 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// PatchPlan describes what a patch run would install, as returned by the
+// Plan functions of each runner.
+type PatchPlan struct {
+	// Packages are the package updates, with the version that would be
+	// installed and, where the package manager reports them, the repository
+	// and download size.
+	Packages []*packages.PkgInfo
+	// Patches are the zypper patches that would be installed.
+	Patches []*packages.ZypperPatch
+	// DownloadSize is the estimated download size in bytes, the sum of the
+	// package sizes that are known.
+	DownloadSize int64
+}
+
+func newPatchPlan(pkgs []*packages.PkgInfo, patches []*packages.ZypperPatch) *PatchPlan {
+	plan := &PatchPlan{Packages: pkgs, Patches: patches}
+	for _, p := range pkgs {
+		plan.DownloadSize += p.Size
+	}
+	return plan
+}
+
+// Empty reports whether the plan installs nothing.
+func (p *PatchPlan) Empty() bool {
+	return len(p.Packages) == 0 && len(p.Patches) == 0
+}
+
+// Repositories returns the repositories the package updates come from,
+// sorted.
+func (p *PatchPlan) Repositories() []string {
+	seen := map[string]bool{}
+	var repos []string
+	for _, pkg := range p.Packages {
+		if pkg.Repository != "" && !seen[pkg.Repository] {
+			seen[pkg.Repository] = true
+			repos = append(repos, pkg.Repository)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+func (p *PatchPlan) String() string {
+	var parts []string
+	if len(p.Packages) > 0 {
+		var pkgs []string
+		for _, pkg := range p.Packages {
+			pkgs = append(pkgs, fmt.Sprintf("%s.%s %s", pkg.Name, pkg.Arch, pkg.Version))
+		}
+		parts = append(parts, fmt.Sprintf("%d packages: %q", len(pkgs), pkgs))
+	}
+	if len(p.Patches) > 0 {
+		parts = append(parts, fmt.Sprintf("%d patches: %s", len(p.Patches), formatPatches(p.Patches)))
+	}
+	if repos := p.Repositories(); len(repos) > 0 {
+		parts = append(parts, fmt.Sprintf("from %q", repos))
+	}
+	if p.DownloadSize > 0 {
+		parts = append(parts, fmt.Sprintf("estimated download size %d bytes", p.DownloadSize))
+	}
+	if len(parts) == 0 {
+		return "nothing to install"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,92 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlanYumUpdate(t *testing.T) {
+	data := []byte(`
+	=================================================================================================================================================================================
+	Package                                      Arch                           Version                                              Repository                                Size
+	=================================================================================================================================================================================
+	Upgrading:
+	  foo                                       noarch                         2.0.0-1                                              BaseOS                                     1 M
+	  bar                                       x86_64                         1:2.0.0-1                                            AppStream                                512 k
+`)
+	ctx := context.Background()
+
+	// yum check-update exits with 100 when updates are available.
+	if os.Getenv("EXIT100") == "1" {
+		os.Exit(100)
+	}
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestPlanYumUpdate")
+	cmd.Env = append(os.Environ(), "EXIT100=1")
+	exit100 := cmd.Run()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	packages.SetCommandRunner(mockCommandRunner)
+	packages.SetPtyCommandRunner(mockCommandRunner)
+	// Nothing is installed, only the updates are listed.
+	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", []string{"check-update", "--assumeyes"}...))).Return([]byte("stdout"), []byte("stderr"), exit100).Times(1)
+	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", []string{"update", "--assumeno", "--cacheonly", "--color=never"}...))).Return(data, []byte("stderr"), nil).Times(1)
+
+	plan, err := PlanYumUpdate(ctx, YumExclusivePackages([]string{"foo", "bar"}))
+	if err != nil {
+		t.Fatalf("PlanYumUpdate: %v", err)
+	}
+
+	want := &PatchPlan{
+		Packages: []*packages.PkgInfo{
+			{Name: "foo", Arch: "all", Version: "2.0.0-1", Repository: "BaseOS", Size: 1 << 20},
+			{Name: "bar", Arch: "x86_64", Version: "1:2.0.0-1", Epoch: "1", Repository: "AppStream", Size: 512 << 10},
+		},
+		DownloadSize: 1<<20 + 512<<10,
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Errorf("PlanYumUpdate() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"AppStream", "BaseOS"}, plan.Repositories()); diff != "" {
+		t.Errorf("Repositories() mismatch (-want +got):\n%s", diff)
+	}
+	wantString := `2 packages: ["foo.all 2.0.0-1" "bar.x86_64 1:2.0.0-1"], from ["AppStream" "BaseOS"], estimated download size 1572864 bytes`
+	if got := plan.String(); got != wantString {
+		t.Errorf("String() = %q, want %q", got, wantString)
+	}
+}
+
+func TestPatchPlanEmpty(t *testing.T) {
+	plan := newPatchPlan(nil, nil)
+	if !plan.Empty() {
+		t.Error("plan without packages or patches should be empty")
+	}
+	if got := plan.String(); got != "nothing to install" {
+		t.Errorf("String() = %q", got)
+	}
+	if newPatchPlan(nil, []*packages.ZypperPatch{{Name: "patch"}}).Empty() {
+		t.Error("plan with a patch should not be empty")
+	}
+}
@@ -0,0 +1,132 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// PatchPhase is a phase of a patch run, see ProgressFunc.
+type PatchPhase string
+
+const (
+	// PhaseRefresh lists the available updates, refreshing the repository
+	// metadata if needed.
+	PhaseRefresh PatchPhase = "refresh"
+	// PhaseDownload downloads the updates of a StageDownload run.
+	PhaseDownload PatchPhase = "download"
+	// PhaseInstall downloads, unless already cached, and installs the updates.
+	PhaseInstall PatchPhase = "install"
+	// PhaseVerify runs the health checks.
+	PhaseVerify PatchPhase = "verify"
+)
+
+// Progress is reported to a ProgressFunc when a patch run enters a phase,
+// with only Phase set, and for each package step the package manager
+// reports within the phase.
+type Progress struct {
+	Phase PatchPhase
+	// Action is what the package manager does with Package, as it calls it,
+	// e.g. "Upgrading" or "Setting up".
+	Action  string
+	Package string
+	// Current and Total count the steps of the transaction, both are 0 if
+	// the package manager does not report them.
+	Current, Total int
+}
+
+// ProgressFunc is called with the progress of a patch run, it must not
+// block. Per-package progress is parsed from the output of yum, dnf,
+// zypper and apt.
+type ProgressFunc func(Progress)
+
+func (f ProgressFunc) phase(ph PatchPhase) {
+	if f != nil {
+		f(Progress{Phase: ph})
+	}
+}
+
+// watch reports the start of phase ph and returns ctx set up to report the
+// package steps of the package manager commands run with it.
+func (f ProgressFunc) watch(ctx context.Context, ph PatchPhase) context.Context {
+	if f == nil {
+		return ctx
+	}
+	f.phase(ph)
+	return packages.WithOutputLineFunc(ctx, func(ln string) {
+		if p, ok := parseProgressLine(ln); ok {
+			p.Phase = ph
+			f(p)
+		}
+	})
+}
+
+// verify wraps the health check func check to report PhaseVerify first.
+func (f ProgressFunc) verify(check func() error) func() error {
+	if f == nil || check == nil {
+		return check
+	}
+	return func() error {
+		f.phase(PhaseVerify)
+		return check()
+	}
+}
+
+var (
+	//   Upgrading        : openssl-libs-1:3.0.7-25.el9_3.x86_64     3/12
+	yumProgressRe = regexp.MustCompile(`^(Installing|Upgrading|Updating|Cleanup|Erasing|Verifying)\s*:\s*(\S+)\s+(\d+)/(\d+)$`)
+	// (3/12): openssl-libs-3.0.7-25.el9_3.x86_64.rpm     1.2 MB/s | 1.2 MB  00:01
+	dnfDownloadRe = regexp.MustCompile(`^\((\d+)/(\d+)\): (\S+?)(?:\.rpm)?\s`)
+	// (3/12) Installing: openssl-3.0.8-150500.5.20.1.x86_64 ...[done]
+	zypperProgressRe = regexp.MustCompile(`^\((\d+)/(\d+)\) (Installing|Removing): (\S+)`)
+	// Retrieving: openssl-3.0.8-150500.5.20.1.x86_64 (Update Repository) (3/12), 1.2 MiB
+	zypperRetrieveRe = regexp.MustCompile(`^Retrieving:? (?:package )?(\S+) .*\((\d+)/(\d+)\)`)
+	// Unpacking libssl3:amd64 (3.0.2-0ubuntu1.12) over (3.0.2-0ubuntu1.10) ...
+	// Setting up libssl3:amd64 (3.0.2-0ubuntu1.12) ...
+	aptProgressRe = regexp.MustCompile(`^(Unpacking|Setting up|Removing) (\S+) \(`)
+)
+
+func parseProgressLine(ln string) (Progress, bool) {
+	ln = strings.TrimSpace(ln)
+	atoi := func(s string) int {
+		i, _ := strconv.Atoi(s)
+		return i
+	}
+	if m := yumProgressRe.FindStringSubmatch(ln); m != nil {
+		return Progress{Action: m[1], Package: m[2], Current: atoi(m[3]), Total: atoi(m[4])}, true
+	}
+	if m := dnfDownloadRe.FindStringSubmatch(ln); m != nil {
+		return Progress{Action: "Downloading", Package: m[3], Current: atoi(m[1]), Total: atoi(m[2])}, true
+	}
+	if m := zypperProgressRe.FindStringSubmatch(ln); m != nil {
+		return Progress{Action: m[3], Package: m[4], Current: atoi(m[1]), Total: atoi(m[2])}, true
+	}
+	if m := zypperRetrieveRe.FindStringSubmatch(ln); m != nil {
+		return Progress{Action: "Retrieving", Package: m[1], Current: atoi(m[2]), Total: atoi(m[3])}, true
+	}
+	if m := aptProgressRe.FindStringSubmatch(ln); m != nil {
+		name := m[2]
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[:i]
+		}
+		return Progress{Action: m[1], Package: name}, true
+	}
+	return Progress{}, false
+}
@@ -0,0 +1,102 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Progress
+		ok   bool
+	}{
+		{"  Upgrading        : openssl-libs-1:3.0.7-25.el9_3.x86_64     3/12", Progress{Action: "Upgrading", Package: "openssl-libs-1:3.0.7-25.el9_3.x86_64", Current: 3, Total: 12}, true},
+		{"  Updating   : foo-2.0.0-1.noarch    1/2 ", Progress{Action: "Updating", Package: "foo-2.0.0-1.noarch", Current: 1, Total: 2}, true},
+		{"(3/12): openssl-libs-3.0.7-25.el9_3.x86_64.rpm     1.2 MB/s | 1.2 MB  00:01", Progress{Action: "Downloading", Package: "openssl-libs-3.0.7-25.el9_3.x86_64", Current: 3, Total: 12}, true},
+		{"(3/12) Installing: openssl-3.0.8-150500.5.20.1.x86_64 ...[done]", Progress{Action: "Installing", Package: "openssl-3.0.8-150500.5.20.1.x86_64", Current: 3, Total: 12}, true},
+		{"Retrieving: openssl-3.0.8-150500.5.20.1.x86_64 (Update Repository) (3/12), 1.2 MiB", Progress{Action: "Retrieving", Package: "openssl-3.0.8-150500.5.20.1.x86_64", Current: 3, Total: 12}, true},
+		{"Unpacking libssl3:amd64 (3.0.2-0ubuntu1.12) over (3.0.2-0ubuntu1.10) ...", Progress{Action: "Unpacking", Package: "libssl3"}, true},
+		{"Setting up tzdata (2024a-0ubuntu0.22.04) ...", Progress{Action: "Setting up", Package: "tzdata"}, true},
+		{"Transaction check succeeded.", Progress{}, false},
+		{"Reading package lists...", Progress{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseProgressLine(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseProgressLine(%q): ok = %v, want %v", tt.line, ok, tt.ok)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseProgressLine(%q): unexpected result (-want +got):\n%s", tt.line, diff)
+		}
+	}
+}
+
+func TestRunYumUpdateProgress(t *testing.T) {
+	if os.Getenv("EXIT100") == "1" {
+		os.Exit(100)
+	}
+	cmd := exec.CommandContext(context.Background(), os.Args[0], "-test.run=TestRunYumUpdateProgress")
+	cmd.Env = append(os.Environ(), "EXIT100=1")
+	exit100 := cmd.Run()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	packages.SetCommandRunner(mockCommandRunner)
+	packages.SetPtyCommandRunner(mockCommandRunner)
+
+	// Stands in for the runners, which write the output to a Stdout set by
+	// the caller as it is written.
+	output := func(out string) func(context.Context, *exec.Cmd) ([]byte, []byte, error) {
+		return func(_ context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+			if cmd.Stdout != nil {
+				cmd.Stdout.Write([]byte(out))
+			}
+			return []byte(out), nil, nil
+		}
+	}
+	update := "Upgrading:\n  foo   noarch   2.0.0-1   BaseOS   361 k\n"
+	gomock.InOrder(
+		mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "check-update", "--assumeyes"))).Return(nil, nil, exit100).Times(1),
+		mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "update", "--assumeno", "--cacheonly", "--color=never"))).DoAndReturn(output(update)).Times(1),
+		mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "install", "--assumeyes", "foo"))).DoAndReturn(output("  Upgrading  : foo-2.0.0-1.noarch   1/2\n  Cleanup    : foo-1.0.0-1.noarch   2/2\n")).Times(1),
+	)
+	expectYumHistory(mockCommandRunner, "4", "4")
+	expectYumAutoMarks(mockCommandRunner, "")
+
+	var got []Progress
+	if _, err := RunYumUpdate(context.Background(), YumProgress(func(p Progress) { got = append(got, p) })); err != nil {
+		t.Fatalf("RunYumUpdate: unexpected error: %v", err)
+	}
+	want := []Progress{
+		{Phase: PhaseRefresh},
+		{Phase: PhaseInstall},
+		{Phase: PhaseInstall, Action: "Upgrading", Package: "foo-2.0.0-1.noarch", Current: 1, Total: 2},
+		{Phase: PhaseInstall, Action: "Cleanup", Package: "foo-1.0.0-1.noarch", Current: 2, Total: 2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RunYumUpdate: unexpected progress (-want +got):\n%s", diff)
+	}
+}
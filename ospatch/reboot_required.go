@@ -0,0 +1,144 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+const (
+	rebootRequiredFile     = "/var/run/reboot-required"
+	rebootRequiredPkgsFile = "/var/run/reboot-required.pkgs"
+	needsRestarting        = "/usr/bin/needs-restarting"
+
+	// zypperNeedsRebootingExitCode is the exit code of zypper
+	// needs-rebooting when a reboot is required.
+	zypperNeedsRebootingExitCode = 102
+)
+
+var rebootCheckRunner = util.CommandRunner(&util.DefaultRunner{})
+
+func exitCode(err error) (int, bool) {
+	var eerr *exec.ExitError
+	if errors.As(err, &eerr) {
+		return eerr.ExitCode(), true
+	}
+	return 0, false
+}
+
+// debRebootReasons checks the reboot-required file update-notifier and
+// unattended-upgrades create on Debian and Ubuntu, listing the packages in
+// reboot-required.pkgs as the reasons.
+func debRebootReasons(file, pkgsFile string) ([]string, error) {
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	reasons := []string{fmt.Sprintf("%s exists", file)}
+	data, err := ioutil.ReadFile(pkgsFile)
+	if err != nil {
+		return reasons, nil
+	}
+	for _, pkg := range strings.Fields(string(data)) {
+		reasons = append(reasons, fmt.Sprintf("package %s requires a reboot", pkg))
+	}
+	return reasons, nil
+}
+
+// needsRestartingReasons runs needs-restarting -r from yum-utils or
+// dnf-utils, which exits with 1 when a reboot is required and lists the
+// updated core packages as " * <package>" lines.
+func needsRestartingReasons(ctx context.Context) ([]string, error) {
+	stdout, stderr, err := rebootCheckRunner.Run(ctx, exec.Command(needsRestarting, "-r"))
+	if err == nil {
+		return nil, nil
+	}
+	if code, ok := exitCode(err); !ok || code != 1 {
+		return nil, fmt.Errorf("error running %s -r: %v, stderr: %q", needsRestarting, err, stderr)
+	}
+
+	var reasons []string
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "* ") {
+			reasons = append(reasons, fmt.Sprintf("package %s updated since boot", strings.TrimPrefix(line, "* ")))
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = []string{"needs-restarting reports a reboot is required"}
+	}
+	return reasons, nil
+}
+
+func parseZypperPS(data []byte) []string {
+	/*
+		The following running processes use deleted files:
+
+		PID | PPID | UID | User | Command | Service
+		----+------+-----+------+---------+--------
+		1   | 0    | 0   | root | systemd |
+		812 | 1    | 0   | root | sshd    | sshd
+	*/
+	var reasons []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 5 {
+			continue
+		}
+		// Services can be restarted, only PID 1 using deleted files needs a
+		// reboot.
+		if strings.TrimSpace(fields[0]) == "1" {
+			reasons = append(reasons, fmt.Sprintf("process 1 (%s) uses deleted files", strings.TrimSpace(fields[4])))
+		}
+	}
+	return reasons
+}
+
+// zypperRebootReasons runs zypper needs-rebooting and zypper ps. ok is false
+// if this zypper is too old to support needs-rebooting.
+func zypperRebootReasons(ctx context.Context) (reasons []string, ok bool, err error) {
+	_, stderr, err := rebootCheckRunner.Run(ctx, exec.Command(zypper, "--non-interactive", "needs-rebooting"))
+	if err != nil {
+		code, exited := exitCode(err)
+		switch {
+		case exited && code == zypperNeedsRebootingExitCode:
+			reasons = append(reasons, "zypper needs-rebooting reports a reboot is required")
+		case exited:
+			// Unknown command, zypper older than 1.14.
+			return nil, false, nil
+		default:
+			return nil, false, fmt.Errorf("error running zypper needs-rebooting: %v, stderr: %q", err, stderr)
+		}
+	}
+
+	stdout, stderr, err := rebootCheckRunner.Run(ctx, exec.Command(zypper, "--non-interactive", "ps"))
+	if err != nil {
+		return reasons, true, fmt.Errorf("error running zypper ps: %v, stderr: %q", err, stderr)
+	}
+	return append(reasons, parseZypperPS(stdout)...), true, nil
+}
@@ -0,0 +1,129 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+// exitError returns an *exec.ExitError with the given exit code.
+func exitError(t *testing.T, code int) error {
+	err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+	if _, ok := exitCode(err); !ok {
+		t.Skipf("could not get exit error from sh: %v", err)
+	}
+	return err
+}
+
+func TestDebRebootReasons(t *testing.T) {
+	dir := t.TempDir()
+	file, pkgsFile := filepath.Join(dir, "reboot-required"), filepath.Join(dir, "reboot-required.pkgs")
+
+	reasons, err := debRebootReasons(file, pkgsFile)
+	if err != nil || reasons != nil {
+		t.Errorf("debRebootReasons() without file = %q, %v, want nil, nil", reasons, err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("*** System restart required ***\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pkgsFile, []byte("linux-base\nlibc6\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reasons, err = debRebootReasons(file, pkgsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{file + " exists", "package linux-base requires a reboot", "package libc6 requires a reboot"}
+	if diff := cmp.Diff(want, reasons); diff != "" {
+		t.Errorf("debRebootReasons() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNeedsRestartingReasons(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	rebootCheckRunner = mockCommandRunner
+	defer func() { rebootCheckRunner = &util.DefaultRunner{} }()
+	ctx := context.Background()
+	cmd := utilmocks.EqCmd(exec.Command(needsRestarting, "-r"))
+
+	mockCommandRunner.EXPECT().Run(ctx, cmd).Return([]byte("No core libraries or services have been updated since boot-up.\nReboot should not be necessary.\n"), nil, nil).Times(1)
+	if reasons, err := needsRestartingReasons(ctx); err != nil || reasons != nil {
+		t.Errorf("needsRestartingReasons() = %q, %v, want nil, nil", reasons, err)
+	}
+
+	out := []byte("Core libraries or services have been updated since boot-up:\n  * kernel\n  * systemd\n\nReboot is required to fully utilize these updates.\n")
+	mockCommandRunner.EXPECT().Run(ctx, cmd).Return(out, nil, exitError(t, 1)).Times(1)
+	reasons, err := needsRestartingReasons(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"package kernel updated since boot", "package systemd updated since boot"}
+	if diff := cmp.Diff(want, reasons); diff != "" {
+		t.Errorf("needsRestartingReasons() mismatch (-want +got):\n%s", diff)
+	}
+
+	mockCommandRunner.EXPECT().Run(ctx, cmd).Return(nil, []byte("error"), exitError(t, 2)).Times(1)
+	if _, err := needsRestartingReasons(ctx); err == nil {
+		t.Error("did not get expected error")
+	}
+}
+
+func TestZypperRebootReasons(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	rebootCheckRunner = mockCommandRunner
+	defer func() { rebootCheckRunner = &util.DefaultRunner{} }()
+	ctx := context.Background()
+	needsRebooting := utilmocks.EqCmd(exec.Command(zypper, "--non-interactive", "needs-rebooting"))
+	ps := utilmocks.EqCmd(exec.Command(zypper, "--non-interactive", "ps"))
+	psOut := []byte(`The following running processes use deleted files:
+
+PID | PPID | UID | User | Command | Service
+----+------+-----+------+---------+--------
+1   | 0    | 0   | root | systemd |
+812 | 1    | 0   | root | sshd    | sshd
+`)
+
+	mockCommandRunner.EXPECT().Run(ctx, needsRebooting).Return(nil, nil, exitError(t, zypperNeedsRebootingExitCode)).Times(1)
+	mockCommandRunner.EXPECT().Run(ctx, ps).Return(psOut, nil, nil).Times(1)
+	reasons, ok, err := zypperRebootReasons(ctx)
+	if err != nil || !ok {
+		t.Fatalf("zypperRebootReasons() = %v, %v", ok, err)
+	}
+	want := []string{"zypper needs-rebooting reports a reboot is required", "process 1 (systemd) uses deleted files"}
+	if diff := cmp.Diff(want, reasons); diff != "" {
+		t.Errorf("zypperRebootReasons() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Old zypper without needs-rebooting.
+	mockCommandRunner.EXPECT().Run(ctx, needsRebooting).Return(nil, []byte("Unknown command"), exitError(t, 1)).Times(1)
+	if _, ok, err := zypperRebootReasons(ctx); ok || err != nil {
+		t.Errorf("zypperRebootReasons() = %v, %v, want false, nil", ok, err)
+	}
+}
@@ -0,0 +1,86 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// RepoRefresh configures refreshing the repository metadata before a patch
+// run, each repository on its own so one failing does not hold up the
+// others.
+type RepoRefresh struct {
+	// Parallelism is how many repositories are refreshed at once, defaults
+	// to 4. apt and zypper lock their metadata so they always refresh one
+	// repository at a time.
+	Parallelism int
+	// AbortOnFailure aborts the patch run if a repository fails to refresh,
+	// by default the run goes on with the metadata of that repository as it
+	// was.
+	AbortOnFailure bool
+}
+
+// RepoRefreshFailure is a repository that failed to refresh, for apt it is
+// a sources file.
+type RepoRefreshFailure struct {
+	Repo  string
+	Error string
+}
+
+type refreshFunc func(ctx context.Context, parallelism int) ([]*packages.RepoRefreshResult, error)
+
+func refreshAptRepos(ctx context.Context, _ int) ([]*packages.RepoRefreshResult, error) {
+	return packages.RefreshAptRepos(ctx)
+}
+
+func refreshZypperRepos(ctx context.Context, _ int) ([]*packages.RepoRefreshResult, error) {
+	return packages.RefreshZypperRepos(ctx)
+}
+
+// refreshRepos refreshes the repositories with refresh if cfg is set and
+// records the failures. It only returns an error if the run should abort.
+func (r *PatchResult) refreshRepos(ctx context.Context, cfg *RepoRefresh, refresh refreshFunc) error {
+	if cfg == nil {
+		return nil
+	}
+	clog.Infof(ctx, "Refreshing repository metadata.")
+	results, err := refresh(ctx, cfg.Parallelism)
+	if err != nil {
+		if cfg.AbortOnFailure {
+			return fmt.Errorf("not patching, error listing repositories to refresh: %v", err)
+		}
+		clog.Warningf(ctx, "Error listing repositories to refresh, continuing: %v", err)
+		return nil
+	}
+
+	var failed []string
+	for _, res := range packages.FailedRefreshes(results) {
+		r.RefreshFailures = append(r.RefreshFailures, &RepoRefreshFailure{Repo: res.Repo, Error: res.Err.Error()})
+		failed = append(failed, fmt.Sprintf("%s: %v", res.Repo, res.Err))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if cfg.AbortOnFailure {
+		return fmt.Errorf("not patching, %d of %d repositories failed to refresh:\n%s", len(failed), len(results), strings.Join(failed, "\n"))
+	}
+	clog.Warningf(ctx, "%d of %d repositories failed to refresh, continuing:\n%s", len(failed), len(results), strings.Join(failed, "\n"))
+	return nil
+}
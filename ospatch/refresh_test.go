@@ -0,0 +1,63 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPatchResultRefreshRepos(t *testing.T) {
+	refresh := func(_ context.Context, _ int) ([]*packages.RepoRefreshResult, error) {
+		return []*packages.RepoRefreshResult{
+			{Manager: packages.ManagerYum, Repo: "baseos"},
+			{Manager: packages.ManagerYum, Repo: "epel", Err: errors.New("timeout")},
+		}, nil
+	}
+	listErr := func(_ context.Context, _ int) ([]*packages.RepoRefreshResult, error) {
+		return nil, errors.New("repolist failed")
+	}
+	wantFailures := []*RepoRefreshFailure{{Repo: "epel", Error: "timeout"}}
+
+	tests := []struct {
+		name         string
+		cfg          *RepoRefresh
+		refresh      refreshFunc
+		wantErr      bool
+		wantFailures []*RepoRefreshFailure
+	}{
+		{"disabled", nil, refresh, false, nil},
+		{"continue", &RepoRefresh{}, refresh, false, wantFailures},
+		{"abort", &RepoRefresh{AbortOnFailure: true}, refresh, true, wantFailures},
+		{"list error continue", &RepoRefresh{}, listErr, false, nil},
+		{"list error abort", &RepoRefresh{AbortOnFailure: true}, listErr, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &PatchResult{}
+			err := res.refreshRepos(context.Background(), tt.cfg, tt.refresh)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("refreshRepos: got error %v, want error: %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantFailures, res.RefreshFailures); diff != "" {
+				t.Errorf("refreshRepos: unexpected RefreshFailures (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/services"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// agentService is never restarted by RestartServices, it would kill the
+// patch task.
+const agentService = "google-osconfig-agent.service"
+
+var (
+	procRoot               = "/proc"
+	servicesNeedingRestart = ServicesNeedingRestart
+	restartService         = services.Restart
+)
+
+// unitName returns name as a systemd unit name, adding the .service suffix
+// if it has none.
+func unitName(name string) string {
+	switch filepath.Ext(name) {
+	case ".service", ".socket", ".target", ".timer", ".path", ".mount", ".scope", ".slice":
+		return name
+	}
+	return name + ".service"
+}
+
+// parseServiceList parses the one service per line output of
+// needs-restarting -s and zypper ps -sss.
+func parseServiceList(data []byte) []string {
+	var units []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.ContainsAny(line, " \t") {
+			units = append(units, unitName(line))
+		}
+	}
+	return units
+}
+
+// usesDeletedFiles reports whether the /proc/<pid>/maps content maps a
+// deleted file, like a shared library replaced by an update. Shared memory
+// is mapped from deleted files too and is ignored.
+func usesDeletedFiles(maps []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(maps))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 || fields[len(fields)-1] != "(deleted)" {
+			continue
+		}
+		path := fields[5]
+		if strings.HasPrefix(path, "/memfd:") || strings.HasPrefix(path, "/dev/") || strings.HasPrefix(path, "/SYSV") || strings.HasPrefix(path, "/tmp/") {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// cgroupService returns the system service of the /proc/<pid>/cgroup
+// content, e.g. "sshd.service" for "0::/system.slice/sshd.service", or ""
+// if the process is not part of one.
+func cgroupService(cgroup []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path, the systemd hierarchy
+		// is "name=systemd" with cgroup v1 and empty with v2.
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 || (parts[1] != "" && parts[1] != "name=systemd") {
+			continue
+		}
+		elems := strings.Split(parts[2], "/")
+		if len(elems) < 3 || elems[1] != "system.slice" {
+			continue
+		}
+		for i := len(elems) - 1; i >= 2; i-- {
+			if strings.HasSuffix(elems[i], ".service") {
+				return elems[i]
+			}
+		}
+	}
+	return ""
+}
+
+// procServicesNeedingRestart finds the services with processes using
+// deleted files by reading the maps of every process, the way lsof does,
+// so it works where neither needs-restarting nor zypper is installed.
+func procServicesNeedingRestart() ([]string, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var units []string
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		// Processes exit while we scan, skip the ones that are gone.
+		cgroup, err := os.ReadFile(filepath.Join(procRoot, e.Name(), "cgroup"))
+		if err != nil {
+			continue
+		}
+		unit := cgroupService(cgroup)
+		if unit == "" || seen[unit] {
+			continue
+		}
+		maps, err := os.ReadFile(filepath.Join(procRoot, e.Name(), "maps"))
+		if err != nil || !usesDeletedFiles(maps) {
+			continue
+		}
+		seen[unit] = true
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+// ServicesNeedingRestart lists the systemd services whose processes still
+// use deleted files, typically shared libraries an update replaced, so they
+// run the old code until restarted. It uses needs-restarting -s from
+// yum-utils or dnf-utils, zypper ps on zypper based systems and otherwise
+// reads the process maps in /proc.
+func ServicesNeedingRestart(ctx context.Context) ([]string, error) {
+	var units []string
+	switch {
+	case util.Exists(needsRestarting):
+		stdout, stderr, err := rebootCheckRunner.Run(ctx, exec.Command(needsRestarting, "-s"))
+		if err != nil {
+			return nil, fmt.Errorf("error running %s -s: %v, stderr: %q", needsRestarting, err, stderr)
+		}
+		units = parseServiceList(stdout)
+	case packages.ZypperExists:
+		stdout, stderr, err := rebootCheckRunner.Run(ctx, exec.Command(zypper, "--non-interactive", "ps", "-sss"))
+		if err != nil {
+			return nil, fmt.Errorf("error running zypper ps -sss: %v, stderr: %q", err, stderr)
+		}
+		units = parseServiceList(stdout)
+	default:
+		var err error
+		if units, err = procServicesNeedingRestart(); err != nil {
+			return nil, fmt.Errorf("error reading processes: %v", err)
+		}
+	}
+	sort.Strings(units)
+	return units, nil
+}
+
+// ServiceRestarts is the outcome of RestartServices.
+type ServiceRestarts struct {
+	// Restarted are the allowlisted services that were restarted.
+	Restarted []string `json:",omitempty"`
+	// Manual are the services that still need a restart, because they are
+	// not allowlisted or restarting them failed.
+	Manual []string `json:",omitempty"`
+}
+
+func allowed(unit string, allow []string) bool {
+	for _, pattern := range allow {
+		if ok, _ := filepath.Match(unitName(pattern), unit); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RestartServices restarts the services needing a restart, see
+// ServicesNeedingRestart, that match one of the allow patterns, e.g.
+// "nginx" or "php*-fpm.service". The agent itself is never restarted.
+func RestartServices(ctx context.Context, allow []string) (*ServiceRestarts, error) {
+	units, err := servicesNeedingRestart(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &ServiceRestarts{}
+	for _, unit := range units {
+		if unit == agentService || !allowed(unit, allow) {
+			res.Manual = append(res.Manual, unit)
+			continue
+		}
+		clog.Infof(ctx, "Restarting %s, it uses files replaced by the update.", unit)
+		if err := restartService(ctx, unit); err != nil {
+			clog.Errorf(ctx, "Error restarting %s: %v", unit, err)
+			res.Manual = append(res.Manual, unit)
+			continue
+		}
+		res.Restarted = append(res.Restarted, unit)
+	}
+	return res, nil
+}
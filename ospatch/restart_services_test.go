@@ -0,0 +1,126 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseServiceList(t *testing.T) {
+	out := []byte("sshd.service\nnginx\nphp8.2-fpm\n\nUpdated files found, restart:\n")
+	want := []string{"sshd.service", "nginx.service", "php8.2-fpm.service"}
+	if diff := cmp.Diff(want, parseServiceList(out)); diff != "" {
+		t.Errorf("parseServiceList() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCgroupService(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   string
+	}{
+		{"0::/system.slice/sshd.service\n", "sshd.service"},
+		{"12:cpu,cpuacct:/\n1:name=systemd:/system.slice/nginx.service\n", "nginx.service"},
+		{"0::/system.slice/docker-1234.scope\n", ""},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/vim.service\n", ""},
+		{"0::/init.scope\n", ""},
+	}
+	for _, tt := range tests {
+		if got := cgroupService([]byte(tt.cgroup)); got != tt.want {
+			t.Errorf("cgroupService(%q) = %q, want %q", tt.cgroup, got, tt.want)
+		}
+	}
+}
+
+const (
+	mapsCurrent = "55d0c1a00000-55d0c1a22000 r--p 00000000 08:01 1234 /usr/sbin/sshd\n" +
+		"7f1c2a000000-7f1c2a200000 r-xp 00000000 08:01 5678 /usr/lib/x86_64-linux-gnu/libssl.so.3\n"
+	mapsDeleted = mapsCurrent + "7f1c2b000000-7f1c2b200000 r-xp 00000000 08:01 9012 /usr/lib/x86_64-linux-gnu/libcrypto.so.3 (deleted)\n"
+	mapsShm     = mapsCurrent + "7f1c2c000000-7f1c2c001000 rw-s 00000000 00:01 3456 /memfd:pulseaudio (deleted)\n"
+)
+
+func writeProc(t *testing.T, root, pid, cgroup, maps string) {
+	t.Helper()
+	dir := filepath.Join(root, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "maps"), []byte(maps), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcServicesNeedingRestart(t *testing.T) {
+	root := t.TempDir()
+	defer func(old string) { procRoot = old }(procRoot)
+	procRoot = root
+
+	writeProc(t, root, "100", "0::/system.slice/sshd.service\n", mapsDeleted)
+	writeProc(t, root, "101", "0::/system.slice/sshd.service\n", mapsDeleted)
+	writeProc(t, root, "200", "0::/system.slice/nginx.service\n", mapsCurrent)
+	writeProc(t, root, "300", "0::/system.slice/pulseaudio.service\n", mapsShm)
+	writeProc(t, root, "400", "0::/user.slice/user-1000.slice/session-1.scope\n", mapsDeleted)
+	if err := os.MkdirAll(filepath.Join(root, "self"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := procServicesNeedingRestart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"sshd.service"}, got); diff != "" {
+		t.Errorf("procServicesNeedingRestart() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRestartServices(t *testing.T) {
+	defer func(old func(context.Context) ([]string, error)) { servicesNeedingRestart = old }(servicesNeedingRestart)
+	servicesNeedingRestart = func(context.Context) ([]string, error) {
+		return []string{agentService, "dbus.service", "nginx.service", "php8.2-fpm.service", "postgresql@15-main.service", "sshd.service"}, nil
+	}
+	defer func(old func(context.Context, string) error) { restartService = old }(restartService)
+	var restarted []string
+	restartService = func(_ context.Context, unit string) error {
+		if unit == "sshd.service" {
+			return errors.New("failed")
+		}
+		restarted = append(restarted, unit)
+		return nil
+	}
+
+	got, err := RestartServices(context.Background(), []string{"nginx", "php*-fpm", "postgresql@15-main", "sshd.service", "google-osconfig-agent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ServiceRestarts{
+		Restarted: []string{"nginx.service", "php8.2-fpm.service", "postgresql@15-main.service"},
+		Manual:    []string{agentService, "dbus.service", "sshd.service"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RestartServices() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.Restarted, restarted); diff != "" {
+		t.Errorf("restarted units mismatch (-want +got):\n%s", diff)
+	}
+}
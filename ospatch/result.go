@@ -0,0 +1,106 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+var rebootRequired = SystemRebootRequired
+
+// PatchResult is the outcome of a patch run, as returned by the Run functions
+// of each runner.
+type PatchResult struct {
+	// Attempted are the package updates the run tried to install, empty for
+	// dry runs.
+	Attempted []*packages.PkgInfo
+	// Succeeded are the attempted packages now installed at the planned
+	// version.
+	Succeeded []*packages.PkgInfo
+	// Failed are the attempted packages that were not installed.
+	Failed []*PackageFailure
+	// Downloaded are the package updates downloaded by a StageDownload
+	// run.
+	Downloaded []*packages.PkgInfo
+	// Patches are the zypper patches the run tried to install.
+	Patches []*packages.ZypperPatch
+	// Duration is the wall time of the run.
+	Duration time.Duration
+	// RebootPending reports whether the system requires a reboot after the
+	// run.
+	RebootPending bool
+	// HealthCheckFailures are the post-patch health checks that failed, the
+	// run then returns a *HealthCheckError.
+	HealthCheckFailures []*HealthCheckFailure
+	// RefreshFailures are the repositories that failed to refresh before
+	// the run, see RepoRefresh.
+	RefreshFailures []*RepoRefreshFailure
+	// TransactionID is the yum or dnf history transaction of the run, empty
+	// if the run made none. Pass it to packages.UndoYumTransaction to revert
+	// the run.
+	TransactionID string
+}
+
+// PackageFailure is a package update that failed to install.
+type PackageFailure struct {
+	Package *packages.PkgInfo
+	Error   string
+}
+
+func (r *PatchResult) timeSince(start time.Time) {
+	r.Duration = time.Since(start)
+}
+
+func pkgKey(p *packages.PkgInfo) string {
+	return p.Name + "." + p.Arch
+}
+
+// recordInstall records the outcome of installing pkgs. The package managers
+// install all updates in one transaction but may still have installed some
+// of them when it fails, installed is used to check which ones made it.
+func (r *PatchResult) recordInstall(ctx context.Context, pkgs []*packages.PkgInfo, installErr error, installed func(context.Context) ([]*packages.PkgInfo, error)) {
+	r.Attempted = pkgs
+	if installErr == nil {
+		r.Succeeded = pkgs
+	} else {
+		versions := map[string]string{}
+		if len(pkgs) > 0 {
+			current, err := installed(ctx)
+			if err != nil {
+				clog.Debugf(ctx, "Error listing installed packages: %v", err)
+			}
+			for _, p := range current {
+				versions[pkgKey(p)] = p.Version
+			}
+		}
+		for _, p := range pkgs {
+			if v, ok := versions[pkgKey(p)]; ok && v == p.Version {
+				r.Succeeded = append(r.Succeeded, p)
+				continue
+			}
+			r.Failed = append(r.Failed, &PackageFailure{Package: p, Error: installErr.Error()})
+		}
+	}
+
+	required, err := rebootRequired(ctx)
+	if err != nil {
+		clog.Debugf(ctx, "Error checking if a reboot is required: %v", err)
+	}
+	r.RebootPending = required
+}
@@ -0,0 +1,74 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordInstall(t *testing.T) {
+	defer func(f func(context.Context) (bool, error)) { rebootRequired = f }(rebootRequired)
+	rebootRequired = func(context.Context) (bool, error) { return true, nil }
+
+	foo := &packages.PkgInfo{Name: "foo", Arch: "x86_64", Version: "2.0.0-1"}
+	bar := &packages.PkgInfo{Name: "bar", Arch: "x86_64", Version: "2.0.0-1"}
+	installed := func(context.Context) ([]*packages.PkgInfo, error) {
+		return []*packages.PkgInfo{
+			{Name: "foo", Arch: "x86_64", Version: "2.0.0-1"},
+			{Name: "bar", Arch: "x86_64", Version: "1.0.0-1"},
+		}, nil
+	}
+	installErr := errors.New("transaction failed")
+
+	tests := []struct {
+		name       string
+		installErr error
+		installed  func(context.Context) ([]*packages.PkgInfo, error)
+		want       *PatchResult
+	}{
+		{
+			"Success",
+			nil,
+			nil,
+			&PatchResult{Attempted: []*packages.PkgInfo{foo, bar}, Succeeded: []*packages.PkgInfo{foo, bar}, RebootPending: true},
+		},
+		{
+			"PartialFailure",
+			installErr,
+			installed,
+			&PatchResult{Attempted: []*packages.PkgInfo{foo, bar}, Succeeded: []*packages.PkgInfo{foo}, Failed: []*PackageFailure{{Package: bar, Error: "transaction failed"}}, RebootPending: true},
+		},
+		{
+			"ListInstalledError",
+			installErr,
+			func(context.Context) ([]*packages.PkgInfo, error) { return nil, errors.New("error") },
+			&PatchResult{Attempted: []*packages.PkgInfo{foo, bar}, Failed: []*PackageFailure{{Package: foo, Error: "transaction failed"}, {Package: bar, Error: "transaction failed"}}, RebootPending: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &PatchResult{}
+			got.recordInstall(context.Background(), []*packages.PkgInfo{foo, bar}, tt.installErr, tt.installed)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("recordInstall() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
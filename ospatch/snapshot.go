@@ -0,0 +1,240 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+const (
+	lvcreate  = "/sbin/lvcreate"
+	lvconvert = "/sbin/lvconvert"
+	lvremove  = "/sbin/lvremove"
+	btrfs     = "/sbin/btrfs"
+	zfs       = "/sbin/zfs"
+	dnf       = "/usr/bin/dnf"
+
+	defaultLVMSnapshotSize = "1G"
+)
+
+var snapshotRunner = util.CommandRunner(&util.DefaultRunner{})
+
+// SnapshotMethod is how a pre-patch snapshot is taken.
+type SnapshotMethod string
+
+// Snapshot methods.
+const (
+	// SnapshotLVM takes an LVM snapshot of the logical volume Target, e.g.
+	// "vg0/root". Rolling back merges the snapshot into the volume, for a
+	// volume in use, like the root volume, the merge completes on the next
+	// reboot.
+	SnapshotLVM SnapshotMethod = "lvm"
+	// SnapshotBtrfs snapshots the btrfs subvolume Target, e.g. "/". Rolling
+	// back makes the snapshot the default subvolume, which takes effect on
+	// the next reboot.
+	SnapshotBtrfs SnapshotMethod = "btrfs"
+	// SnapshotZFS snapshots the ZFS dataset Target, e.g. "rpool/ROOT/ubuntu".
+	SnapshotZFS SnapshotMethod = "zfs"
+	// SnapshotDNFHistory records the last dnf transaction, rolling back
+	// undoes all later transactions. It needs no Target.
+	SnapshotDNFHistory SnapshotMethod = "dnf-history"
+)
+
+// SnapshotConfig configures the snapshot taken before patching.
+type SnapshotConfig struct {
+	Method SnapshotMethod
+	Target string
+	// Size is the size of LVM snapshots, 1G if empty.
+	Size string
+	// Keep keeps the snapshot after a successful patch run, by default it is
+	// deleted.
+	Keep bool
+}
+
+// Snapshot is a pre-patch snapshot, ID identifies it for Rollback and
+// DeleteSnapshot.
+type Snapshot struct {
+	ID      string
+	Created time.Time
+}
+
+func snapshotName(t time.Time) string {
+	return "osconfig-" + t.UTC().Format("20060102T150405Z")
+}
+
+func runSnapshotCmd(ctx context.Context, name string, args ...string) ([]byte, error) {
+	stdout, stderr, err := snapshotRunner.Run(ctx, exec.CommandContext(ctx, name, args...))
+	if err != nil {
+		return nil, fmt.Errorf("error running %s %q: %v, stderr: %q", name, args, err, stderr)
+	}
+	return stdout, nil
+}
+
+func parseDNFHistoryInfo(data []byte) (string, error) {
+	/*
+		Transaction ID : 42
+		Begin time     : Mon 01 Jan 2024 00:00:00 AM UTC
+	*/
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "Transaction ID" {
+			return strings.TrimSpace(parts[1]), nil
+		}
+	}
+	return "", fmt.Errorf("no transaction ID in dnf history info output: %q", data)
+}
+
+// TakeSnapshot takes a snapshot as configured in c.
+func TakeSnapshot(ctx context.Context, c *SnapshotConfig) (*Snapshot, error) {
+	now := time.Now()
+	name := snapshotName(now)
+	var ref string
+	switch c.Method {
+	case SnapshotLVM:
+		vg := strings.SplitN(c.Target, "/", 2)[0]
+		size := c.Size
+		if size == "" {
+			size = defaultLVMSnapshotSize
+		}
+		if _, err := runSnapshotCmd(ctx, lvcreate, "--snapshot", "--name", name, "--size", size, c.Target); err != nil {
+			return nil, err
+		}
+		ref = vg + "/" + name
+	case SnapshotBtrfs:
+		ref = filepath.Join(filepath.Dir(filepath.Clean(c.Target)), "."+name)
+		if _, err := runSnapshotCmd(ctx, btrfs, "subvolume", "snapshot", c.Target, ref); err != nil {
+			return nil, err
+		}
+	case SnapshotZFS:
+		ref = c.Target + "@" + name
+		if _, err := runSnapshotCmd(ctx, zfs, "snapshot", ref); err != nil {
+			return nil, err
+		}
+	case SnapshotDNFHistory:
+		out, err := runSnapshotCmd(ctx, dnf, "--quiet", "history", "info", "last")
+		if err != nil {
+			return nil, err
+		}
+		if ref, err = parseDNFHistoryInfo(out); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown snapshot method %q", c.Method)
+	}
+
+	s := &Snapshot{ID: string(c.Method) + ":" + ref, Created: now}
+	clog.Infof(ctx, "Took pre-patch snapshot %s.", s.ID)
+	return s, nil
+}
+
+func parseSnapshotID(id string) (SnapshotMethod, string, error) {
+	parts := strings.SplitN(id, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid snapshot ID %q, expected method:reference", id)
+	}
+	return SnapshotMethod(parts[0]), parts[1], nil
+}
+
+// Rollback reverts the system to the snapshot with the given ID, as returned
+// by TakeSnapshot. See the SnapshotMethod docs for when the rollback takes
+// effect.
+func Rollback(ctx context.Context, snapshotID string) error {
+	method, ref, err := parseSnapshotID(snapshotID)
+	if err != nil {
+		return err
+	}
+	clog.Infof(ctx, "Rolling back to snapshot %s.", snapshotID)
+	switch method {
+	case SnapshotLVM:
+		_, err = runSnapshotCmd(ctx, lvconvert, "--merge", ref)
+	case SnapshotBtrfs:
+		_, err = runSnapshotCmd(ctx, btrfs, "subvolume", "set-default", ref)
+	case SnapshotZFS:
+		_, err = runSnapshotCmd(ctx, zfs, "rollback", "-r", ref)
+	case SnapshotDNFHistory:
+		_, err = runSnapshotCmd(ctx, dnf, "--assumeyes", "history", "rollback", ref)
+	default:
+		return fmt.Errorf("unknown snapshot method %q", method)
+	}
+	return err
+}
+
+// DeleteSnapshot deletes the snapshot with the given ID.
+func DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	method, ref, err := parseSnapshotID(snapshotID)
+	if err != nil {
+		return err
+	}
+	switch method {
+	case SnapshotLVM:
+		_, err = runSnapshotCmd(ctx, lvremove, "--yes", ref)
+	case SnapshotBtrfs:
+		_, err = runSnapshotCmd(ctx, btrfs, "subvolume", "delete", ref)
+	case SnapshotZFS:
+		_, err = runSnapshotCmd(ctx, zfs, "destroy", ref)
+	case SnapshotDNFHistory:
+		// Nothing was created.
+	default:
+		return fmt.Errorf("unknown snapshot method %q", method)
+	}
+	return err
+}
+
+// installWithSnapshot is installWithHooks with a snapshot taken before
+// install, after the pre hooks, and check run after the post hooks. If
+// install, a post hook or check fails the system is rolled back to the
+// snapshot. snap nil takes no snapshot, check nil checks nothing.
+func installWithSnapshot(ctx context.Context, snap *SnapshotConfig, pre, post []*PatchHook, install, check func() error) error {
+	var s *Snapshot
+	err := installWithHooks(ctx, pre, post, func() error {
+		if snap != nil {
+			var err error
+			if s, err = TakeSnapshot(ctx, snap); err != nil {
+				return fmt.Errorf("not patching, error taking pre-patch snapshot: %v", err)
+			}
+		}
+		return install()
+	})
+	if err == nil && check != nil {
+		err = check()
+	}
+	if s == nil {
+		return err
+	}
+	if err == nil {
+		if !snap.Keep {
+			if err := DeleteSnapshot(ctx, s.ID); err != nil {
+				clog.Errorf(ctx, "Error deleting snapshot %s: %v", s.ID, err)
+			}
+		}
+		return nil
+	}
+
+	if rerr := Rollback(ctx, s.ID); rerr != nil {
+		return fmt.Errorf("%w; rollback to snapshot %s failed: %v", err, s.ID, rerr)
+	}
+	return fmt.Errorf("%w; rolled back to snapshot %s", err, s.ID)
+}
@@ -0,0 +1,142 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+var dnfHistoryInfo = []byte(`Transaction ID : 42
+Begin time     : Mon 01 Jan 2024 12:00:00 AM UTC
+Return-Code    : Success
+`)
+
+func TestTakeSnapshot(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	snapshotRunner = mockCommandRunner
+	ctx := context.Background()
+
+	var args []string
+	mockCommandRunner.EXPECT().Run(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+		args = cmd.Args
+		return nil, nil, nil
+	}).Times(1)
+	s, err := TakeSnapshot(ctx, &SnapshotConfig{Method: SnapshotZFS, Target: "rpool/ROOT/ubuntu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s.ID, "zfs:rpool/ROOT/ubuntu@osconfig-") {
+		t.Errorf("unexpected snapshot ID %q", s.ID)
+	}
+	if len(args) != 3 || args[0] != zfs || args[1] != "snapshot" || "zfs:"+args[2] != s.ID {
+		t.Errorf("unexpected command %q", args)
+	}
+
+	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command(dnf, "--quiet", "history", "info", "last"))).Return(dnfHistoryInfo, nil, nil).Times(1)
+	s, err = TakeSnapshot(ctx, &SnapshotConfig{Method: SnapshotDNFHistory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != "dnf-history:42" {
+		t.Errorf("snapshot ID = %q, want %q", s.ID, "dnf-history:42")
+	}
+
+	if _, err := TakeSnapshot(ctx, &SnapshotConfig{Method: "unknown"}); err == nil {
+		t.Error("did not get expected error for unknown method")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		id   string
+		want *exec.Cmd
+	}{
+		{"lvm:vg0/osconfig-20240101T000000Z", exec.Command(lvconvert, "--merge", "vg0/osconfig-20240101T000000Z")},
+		{"btrfs:/.osconfig-20240101T000000Z", exec.Command(btrfs, "subvolume", "set-default", "/.osconfig-20240101T000000Z")},
+		{"zfs:rpool/ROOT@osconfig-20240101T000000Z", exec.Command(zfs, "rollback", "-r", "rpool/ROOT@osconfig-20240101T000000Z")},
+		{"dnf-history:42", exec.Command(dnf, "--assumeyes", "history", "rollback", "42")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+			snapshotRunner = mockCommandRunner
+
+			mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(tt.want)).Return(nil, nil, nil).Times(1)
+			if err := Rollback(context.Background(), tt.id); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	for _, id := range []string{"", "zfs", "zfs:", "unknown:ref"} {
+		if err := Rollback(context.Background(), id); err == nil {
+			t.Errorf("Rollback(%q) did not return expected error", id)
+		}
+	}
+}
+
+func TestInstallWithSnapshot(t *testing.T) {
+	ctx := context.Background()
+	snap := &SnapshotConfig{Method: SnapshotDNFHistory}
+	post := []*PatchHook{{Path: "/bin/healthcheck"}}
+	takeCmd := utilmocks.EqCmd(exec.Command(dnf, "--quiet", "history", "info", "last"))
+	rollbackCmd := utilmocks.EqCmd(exec.Command(dnf, "--assumeyes", "history", "rollback", "42"))
+
+	tests := []struct {
+		name         string
+		installErr   error
+		healthErr    error
+		wantErr      string
+		wantRollback bool
+	}{
+		{"Success", nil, nil, "", false},
+		{"InstallFails", errors.New("install failed"), nil, "install failed; rolled back to snapshot dnf-history:42", true},
+		{"HealthCheckFails", nil, errors.New("exit status 1"), "rolled back to snapshot dnf-history:42", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+			snapshotRunner = mockCommandRunner
+			hookRunner = mockCommandRunner
+
+			take := mockCommandRunner.EXPECT().Run(gomock.Any(), takeCmd).Return(dnfHistoryInfo, nil, nil).Times(1)
+			health := mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/bin/healthcheck"))).After(take).Return(nil, nil, tt.healthErr).Times(1)
+			if tt.wantRollback {
+				mockCommandRunner.EXPECT().Run(gomock.Any(), rollbackCmd).After(health).Return(nil, nil, nil).Times(1)
+			}
+
+			err := installWithSnapshot(ctx, snap, nil, post, func() error { return tt.installErr }, nil)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+// PatchStage splits a patch run in a download and an install phase, so the
+// packages can be downloaded ahead of the maintenance window and only
+// installed during it.
+type PatchStage int
+
+const (
+	// StageAll downloads and installs the updates in one run, the default.
+	StageAll PatchStage = iota
+	// StageDownload only downloads the updates to the package manager
+	// cache. Hooks, snapshots and health checks don't run.
+	StageDownload
+	// StageInstallCached installs the updates from the package manager
+	// cache without downloading anything, run it with the same options as
+	// the StageDownload run. Updates missing from the cache fail to install.
+	StageInstallCached
+)
+
+func (s PatchStage) String() string {
+	switch s {
+	case StageAll:
+		return "all"
+	case StageDownload:
+		return "download"
+	case StageInstallCached:
+		return "install-cached"
+	}
+	return "unknown"
+}
@@ -25,35 +25,34 @@ import (
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/services"
 )
 
-const (
-	systemctl = "/bin/systemctl"
-)
+// disableService stops and disables the systemd unit, it reports whether
+// the unit was already stopped and disabled.
+func disableService(ctx context.Context, unit string) bool {
+	if s, err := services.Query(ctx, unit); err != nil {
+		clog.Errorf(ctx, "Error checking status of %s: %v", unit, err)
+	} else if !s.Active && !s.Enabled {
+		return true
+	}
+
+	clog.Debugf(ctx, "Disabling %s", unit)
+	if err := services.Stop(ctx, unit); err != nil {
+		clog.Errorf(ctx, "Error stopping %s: %v", unit, err)
+	}
+	if err := services.Disable(ctx, unit); err != nil {
+		clog.Errorf(ctx, "Error disabling %s: %v", unit, err)
+	}
+	return false
+}
 
 // DisableAutoUpdates disables system auto updates.
 func DisableAutoUpdates(ctx context.Context) {
 	// yum-cron on el systems
 	if _, err := os.Stat("/usr/lib/systemd/system/yum-cron.service"); err == nil {
-		out, err := exec.Command(systemctl, "is-enabled", "yum-cron.service").CombinedOutput()
-		if err != nil {
-			if eerr, ok := err.(*exec.ExitError); ok {
-				// Error code of 1 indicates disabled.
-				if eerr.ExitCode() == 1 {
-					return
-				}
-			}
-			clog.Errorf(ctx, "Error checking status of yum-cron, error: %v, out: %s", err, out)
-		}
-
-		clog.Debugf(ctx, "Disabling yum-cron")
-		out, err = exec.Command(systemctl, "stop", "yum-cron.service").CombinedOutput()
-		if err != nil {
-			clog.Errorf(ctx, "Error stopping yum-cron, error: %v, out: %s", err, out)
-		}
-		out, err = exec.Command(systemctl, "disable", "yum-cron.service").CombinedOutput()
-		if err != nil {
-			clog.Errorf(ctx, "Error disabling yum-cron, error: %v, out: %s", err, out)
+		if disableService(ctx, "yum-cron.service") {
+			return
 		}
 	} else if _, err := os.Stat("/usr/sbin/yum-cron"); err == nil {
 		out, err := exec.Command("/sbin/chkconfig", "yum-cron").CombinedOutput()
@@ -73,23 +72,9 @@ func DisableAutoUpdates(ctx context.Context) {
 
 	// dnf-automatic on el8 systems
 	if _, err := os.Stat("/usr/lib/systemd/system/dnf-automatic.timer"); err == nil {
-		out, err := exec.Command(systemctl, "list-timers", "dnf-automatic.timer").CombinedOutput()
-		if err != nil {
-			clog.Errorf(ctx, "Error checking status of dnf-automatic, error: %v, out: %s", err, out)
-		}
-		if bytes.Contains(out, []byte("0 timers listed")) {
+		if disableService(ctx, "dnf-automatic.timer") {
 			return
 		}
-
-		clog.Debugf(ctx, "Disabling dnf-automatic")
-		out, err = exec.Command(systemctl, "stop", "dnf-automatic.timer").CombinedOutput()
-		if err != nil {
-			clog.Errorf(ctx, "Error stopping dnf-automatic, error: %v, out: %s", err, out)
-		}
-		out, err = exec.Command(systemctl, "disable", "dnf-automatic.timer").CombinedOutput()
-		if err != nil {
-			clog.Errorf(ctx, "Error disabling dnf-automatic, error: %v, out: %s", err, out)
-		}
 	}
 
 	// apt unattended-upgrades
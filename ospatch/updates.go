@@ -120,6 +120,15 @@ func shouldPackageBeExcluded(excludes []*Exclude, packageName *string) bool {
 	return false
 }
 
+func matchesAnyPackage(excludes []*Exclude, pkg *packages.PkgInfo, compare func(a, b string) int) bool {
+	for _, exclude := range excludes {
+		if exclude.MatchesPackage(pkg, compare) {
+			return true
+		}
+	}
+	return false
+}
+
 func containsString(ss []string, c string) bool {
 	for _, s := range ss {
 		if s == c {
@@ -129,16 +138,26 @@ func containsString(ss []string, c string) bool {
 	return false
 }
 
-func filterPackages(pkgs []*packages.PkgInfo, exclusivePackages []string, excludes []*Exclude) ([]*packages.PkgInfo, error) {
+// filterPackages filters pkgs by the excludes or exclusivePackages, the
+// latter in the ParseExclude format, comparing versions with compare.
+func filterPackages(pkgs []*packages.PkgInfo, exclusivePackages []string, excludes []*Exclude, compare func(a, b string) int) ([]*packages.PkgInfo, error) {
 	if len(exclusivePackages) != 0 && len(excludes) != 0 {
 		return nil, errors.New("exclusivePackages and excludes can not both be non 0")
 	}
+	var exclusives []*Exclude
+	for _, s := range exclusivePackages {
+		e, err := ParseExclude(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusive package %q: %v", s, err)
+		}
+		exclusives = append(exclusives, e)
+	}
 	var fPkgs = []*packages.PkgInfo{}
 	for _, pkg := range pkgs {
-		if shouldPackageBeExcluded(excludes, &pkg.Name) {
+		if matchesAnyPackage(excludes, pkg, compare) {
 			continue
 		}
-		if exclusivePackages == nil || containsString(exclusivePackages, pkg.Name) {
+		if exclusivePackages == nil || matchesAnyPackage(exclusives, pkg, compare) {
 			fPkgs = append(fPkgs, pkg)
 		}
 	}
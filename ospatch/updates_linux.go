@@ -20,8 +20,6 @@ package ospatch
 import (
 	"context"
 	"errors"
-	"io/ioutil"
-	"os"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -30,25 +28,55 @@ import (
 
 // SystemRebootRequired checks whether a system reboot is required.
 func SystemRebootRequired(ctx context.Context) (bool, error) {
+	required, _, err := RebootRequired(ctx)
+	return required, err
+}
+
+// RebootRequired checks whether a system reboot is required and returns the
+// reasons. It checks /var/run/reboot-required on apt based systems,
+// needs-restarting -r where yum-utils or dnf-utils are installed, zypper
+// needs-rebooting and zypper ps on zypper based systems and otherwise the
+// install time of core rpm packages.
+func RebootRequired(ctx context.Context) (bool, []string, error) {
 	if packages.AptExists {
-		clog.Debugf(ctx, "Checking if reboot required by looking at /var/run/reboot-required.")
-		data, err := ioutil.ReadFile("/var/run/reboot-required")
-		if os.IsNotExist(err) {
-			clog.Debugf(ctx, "/var/run/reboot-required does not exist, indicating no reboot is required.")
-			return false, nil
+		clog.Debugf(ctx, "Checking if reboot required by looking at %s.", rebootRequiredFile)
+		reasons, err := debRebootReasons(rebootRequiredFile, rebootRequiredPkgsFile)
+		if err != nil {
+			return false, nil, err
 		}
+		clog.Debugf(ctx, "Reboot required reasons: %q", reasons)
+		return len(reasons) > 0, reasons, nil
+	}
+	if util.Exists(needsRestarting) {
+		clog.Debugf(ctx, "Checking if reboot required by running %s -r.", needsRestarting)
+		reasons, err := needsRestartingReasons(ctx)
 		if err != nil {
-			return false, err
+			return false, nil, err
+		}
+		clog.Debugf(ctx, "Reboot required reasons: %q", reasons)
+		return len(reasons) > 0, reasons, nil
+	}
+	if packages.ZypperExists {
+		clog.Debugf(ctx, "Checking if reboot required by running zypper needs-rebooting and zypper ps.")
+		reasons, ok, err := zypperRebootReasons(ctx)
+		if err != nil {
+			return false, nil, err
+		}
+		if ok {
+			clog.Debugf(ctx, "Reboot required reasons: %q", reasons)
+			return len(reasons) > 0, reasons, nil
 		}
-		clog.Debugf(ctx, "/var/run/reboot-required exists indicating a reboot is required, content:\n%s", string(data))
-		return true, nil
 	}
 	if ok := util.Exists(rpmquery); ok {
 		clog.Debugf(ctx, "Checking if reboot required by querying rpm database.")
-		return rpmReboot()
+		required, err := rpmReboot()
+		if err != nil || !required {
+			return false, nil, err
+		}
+		return true, []string{"core packages updated since boot"}, nil
 	}
 
-	return false, errors.New("no recognized package manager installed, can't determine if reboot is required")
+	return false, nil, errors.New("no recognized package manager installed, can't determine if reboot is required")
 }
 
 // InstallWUAUpdates is the linux stub for InstallWUAUpdates.
@@ -94,6 +94,9 @@ func TestFilterPackages(t *testing.T) {
 	strictString := "NameOfThePackage"
 	regex, _ := regexp.Compile("^NameO[e-g]ThePackage$")
 	missingRegex, _ := regexp.Compile("^NameO[e-g]ThePackag$")
+	kernel := packages.PkgInfo{Name: "kernel-default", Version: "5.14.21-150500.55.44.1"}
+	openssl1 := packages.PkgInfo{Name: "openssl", Version: "1:3.0.7-25.el9"}
+	openssl3 := packages.PkgInfo{Name: "openssl", Version: "1:3.0.14-1.el9"}
 	tests := []struct {
 		name    string
 		pkgs    []*packages.PkgInfo
@@ -103,11 +106,14 @@ func TestFilterPackages(t *testing.T) {
 		{name: "StrictStringFiltering", pkgs: []*packages.PkgInfo{&pkg}, exludes: []*Exclude{CreateStringExclude(&strictString)}, want: []*packages.PkgInfo{}},
 		{name: "RegexpFiltering", pkgs: []*packages.PkgInfo{&pkg}, exludes: []*Exclude{CreateRegexExclude(regex)}, want: []*packages.PkgInfo{}},
 		{name: "MissedFilter", pkgs: []*packages.PkgInfo{&pkg}, exludes: []*Exclude{CreateRegexExclude(missingRegex)}, want: []*packages.PkgInfo{&pkg}},
+		{name: "GlobFiltering", pkgs: []*packages.PkgInfo{&pkg, &kernel}, exludes: []*Exclude{mustParseExclude(t, "kernel*")}, want: []*packages.PkgInfo{&pkg}},
+		{name: "VersionFiltering", pkgs: []*packages.PkgInfo{&openssl1, &openssl3}, exludes: []*Exclude{mustParseExclude(t, "openssl<3.0.14")}, want: []*packages.PkgInfo{&openssl3}},
+		{name: "VersionNotMatching", pkgs: []*packages.PkgInfo{&openssl1, &openssl3}, exludes: []*Exclude{mustParseExclude(t, "openssl>=3.0.14")}, want: []*packages.PkgInfo{&openssl1}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := filterPackages(tt.pkgs, nil, tt.exludes)
+			got, err := filterPackages(tt.pkgs, nil, tt.exludes, packages.CompareRPMEVR)
 			if err != nil {
 				t.Errorf("err = %v, want %v", err, nil)
 			}
@@ -117,3 +123,26 @@ func TestFilterPackages(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterExclusivePackages(t *testing.T) {
+	kernel := &packages.PkgInfo{Name: "kernel-default", Version: "5.14.21"}
+	bash := &packages.PkgInfo{Name: "bash", Version: "4.4"}
+	got, err := filterPackages([]*packages.PkgInfo{kernel, bash}, []string{"kernel*"}, nil, packages.CompareRPMEVR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []*packages.PkgInfo{kernel}) {
+		t.Errorf("filterPackages() = %v, want %v", got, []*packages.PkgInfo{kernel})
+	}
+	if _, err := filterPackages(nil, []string{"kernel["}, nil, packages.CompareRPMEVR); err == nil {
+		t.Error("did not get expected error for invalid glob")
+	}
+}
+
+func mustParseExclude(t *testing.T, s string) *Exclude {
+	e, err := ParseExclude(s)
+	if err != nil {
+		t.Fatalf("ParseExclude(%q): %v", s, err)
+	}
+	return e
+}
@@ -29,6 +29,14 @@ import (
 
 // SystemRebootRequired checks whether a system reboot is required.
 func SystemRebootRequired(ctx context.Context) (bool, error) {
+	required, _, err := RebootRequired(ctx)
+	return required, err
+}
+
+// RebootRequired checks whether a system reboot is required and returns the
+// reasons, pending file rename operations or the Windows Update
+// RebootRequired registry key.
+func RebootRequired(ctx context.Context) (bool, []string, error) {
 	// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-movefileexw#remarks
 	clog.Debugf(ctx, "Checking for PendingFileRenameOperations")
 	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager`, registry.QUERY_VALUE)
@@ -39,13 +47,13 @@ func SystemRebootRequired(ctx context.Context) (bool, error) {
 
 			if len(val) > 0 {
 				clog.Infof(ctx, "PendingFileRenameOperations indicate a reboot is required: %q", val)
-				return true, nil
+				return true, []string{fmt.Sprintf("%d pending file rename operations", len(val))}, nil
 			}
 		} else if err != registry.ErrNotExist {
-			return false, err
+			return false, nil, err
 		}
 	} else if err != registry.ErrNotExist {
-		return false, err
+		return false, nil, err
 	}
 
 	regKeys := []string{
@@ -61,13 +69,13 @@ func SystemRebootRequired(ctx context.Context) (bool, error) {
 		if err == nil {
 			k.Close()
 			clog.Infof(ctx, "%s exists indicating a reboot is required.", key)
-			return true, nil
+			return true, []string{fmt.Sprintf("registry key %s exists", key)}, nil
 		} else if err != registry.ErrNotExist {
-			return false, err
+			return false, nil, err
 		}
 	}
 
-	return false, nil
+	return false, nil, nil
 }
 
 func checkFilters(ctx context.Context, updt *packages.IUpdate, kbExcludes, classFilter, exclusive_patches []string) (ok bool, err error) {
@@ -183,47 +191,101 @@ func checkFilters(ctx context.Context, updt *packages.IUpdate, kbExcludes, class
 // GetWUAUpdates gets WUA updates based on optional classFilter and kbExcludes.
 func GetWUAUpdates(ctx context.Context, session *packages.IUpdateSession, classFilter, kbExcludes, exclusivePatches []string) (*packages.IUpdateCollection, error) {
 	// Search for all not installed updates but filter out ones that will be installed after a reboot.
-	filter := "IsInstalled=0 AND RebootRequired=0"
-	clog.Debugf(ctx, "Searching for WUA updates with query %q", filter)
-	updts, err := session.GetWUAUpdateCollection(ctx, filter)
+	query := packages.NewWUAQuery(packages.WUAQueryInstalled(false), packages.WUAQueryRebootRequired(false))
+	updts, _, err := GetWUAUpdatesWithQuery(ctx, session, query, classFilter, kbExcludes, exclusivePatches)
+	return updts, err
+}
+
+// GetWUAUpdatesWithQuery gets WUA updates matching query, further filtered by
+// the optional classFilter, kbExcludes and exclusivePatches. It also returns
+// the search criteria string that was used.
+func GetWUAUpdatesWithQuery(ctx context.Context, session *packages.IUpdateSession, query *packages.WUAQuery, classFilter, kbExcludes, exclusivePatches []string) (*packages.IUpdateCollection, string, error) {
+	criteria := query.Criteria()
+	clog.Debugf(ctx, "Searching for WUA updates with query %q", query)
+	updts, err := session.GetWUAUpdateCollection(ctx, criteria)
 	if err != nil {
-		return nil, fmt.Errorf("GetWUAUpdateCollection error: %v", err)
+		return nil, criteria, fmt.Errorf("GetWUAUpdateCollection error: %v", err)
 	}
-	if len(classFilter) == 0 && len(kbExcludes) == 0 && len(exclusivePatches) == 0 {
-		return updts, nil
+	if len(classFilter) == 0 && len(kbExcludes) == 0 && len(exclusivePatches) == 0 && !query.PostFilter() {
+		return updts, criteria, nil
 	}
 	defer updts.Release()
 
 	count, err := updts.Count()
 	if err != nil {
-		return nil, err
+		return nil, criteria, err
 	}
 	clog.Debugf(ctx, "Found %d total updates avaiable (pre filter).", count)
 
 	newUpdts, err := packages.NewUpdateCollection()
 	if err != nil {
-		return nil, err
+		return nil, criteria, err
 	}
 
 	clog.Debugf(ctx, "Using filters: Excludes: %q, Classifications: %q, ExclusivePatches: %q", kbExcludes, classFilter, exclusivePatches)
 	for i := 0; i < int(count); i++ {
 		updt, err := updts.Item(i)
 		if err != nil {
-			return nil, err
+			return nil, criteria, err
 		}
 
-		ok, err := checkFilters(ctx, updt, kbExcludes, classFilter, exclusivePatches)
+		ok, err := checkSeverity(ctx, updt, query)
 		if err != nil {
-			return nil, err
+			return nil, criteria, err
+		}
+		if !ok {
+			continue
+		}
+
+		// KB exclusions of the query apply even to exclusive patches.
+		ok, err = checkKBExcludes(ctx, updt, query)
+		if err != nil {
+			return nil, criteria, err
+		}
+		if !ok {
+			continue
+		}
+
+		ok, err = checkFilters(ctx, updt, kbExcludes, classFilter, exclusivePatches)
+		if err != nil {
+			return nil, criteria, err
 		}
 		if !ok {
 			continue
 		}
 
 		if err := newUpdts.Add(updt); err != nil {
-			return nil, err
+			return nil, criteria, err
 		}
 	}
 
-	return newUpdts, nil
+	return newUpdts, criteria, nil
+}
+
+func checkSeverity(ctx context.Context, updt *packages.IUpdate, query *packages.WUAQuery) (bool, error) {
+	severityRaw, err := updt.GetProperty("MsrcSeverity")
+	if err != nil {
+		return false, fmt.Errorf(`updt.GetProperty("MsrcSeverity"): %v`, err)
+	}
+	defer severityRaw.Clear()
+
+	// MsrcSeverity is empty for updates without a security bulletin.
+	severity, _ := severityRaw.Value().(string)
+	if !query.MatchesSeverity(severity) {
+		clog.Debugf(ctx, "Update with MsrcSeverity %q does not match severity filter", severity)
+		return false, nil
+	}
+	return true, nil
+}
+
+func checkKBExcludes(ctx context.Context, updt *packages.IUpdate, query *packages.WUAQuery) (bool, error) {
+	kbs, err := updt.KBArticleIDs()
+	if err != nil {
+		return false, err
+	}
+	if query.ExcludesKB(kbs) {
+		clog.Debugf(ctx, "Update with KBArticleIDs %q matches excluded KBs", kbs)
+		return false, nil
+	}
+	return true, nil
 }
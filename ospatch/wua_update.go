@@ -0,0 +1,215 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+const (
+	defaultWUABatchSize = 10
+	// defaultWUAMaxCycles matches the number of search and install rounds
+	// the agent always did before stopping.
+	defaultWUAMaxCycles = 10
+)
+
+// wuaRetryPolicy retries transient Windows Update errors for up to half an
+// hour per batch.
+var wuaRetryPolicy = retryutil.Exponential(30*time.Second, 5*time.Minute).WithJitter(0.2).WithMaxElapsed(30 * time.Minute)
+
+// transientWUAErrors are the Windows Update error codes of the update
+// service or the network being unavailable for a while, worth retrying.
+// https://learn.microsoft.com/en-us/windows/deployment/update/windows-update-error-reference
+var transientWUAErrors = map[uint32]string{
+	0x80240016: "WU_E_INSTALL_NOT_ALLOWED",
+	0x8024001e: "WU_E_SERVICE_STOP",
+	0x80244010: "WU_E_PT_EXCEEDED_MAX_SERVER_TRIPS",
+	0x8024401c: "WU_E_PT_HTTP_STATUS_REQUEST_TIMEOUT",
+	0x8024401f: "WU_E_PT_HTTP_STATUS_SERVER_ERROR",
+	0x80244022: "WU_E_PT_HTTP_STATUS_SERVICE_UNAVAIL",
+	0x80244023: "WU_E_PT_HTTP_STATUS_GATEWAY_TIMEOUT",
+	0x8024402c: "WU_E_PT_WINHTTP_NAME_NOT_RESOLVED",
+	0x80072ee2: "ERROR_INTERNET_TIMEOUT",
+	0x80072efd: "ERROR_INTERNET_CANNOT_CONNECT",
+	0x80072efe: "ERROR_INTERNET_CONNECTION_ABORTED",
+}
+
+var wuaErrorCodeRe = regexp.MustCompile(`0x[0-9a-fA-F]{8}`)
+
+// wuaErrorCode returns the error code in an error of the WUA API, see
+// packages.GetScodeString.
+func wuaErrorCode(err error) (uint32, bool) {
+	m := wuaErrorCodeRe.FindString(err.Error())
+	if m == "" {
+		return 0, false
+	}
+	code, err := strconv.ParseUint(m[2:], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(code), true
+}
+
+func wuaErrorName(code uint32) string {
+	if name, ok := transientWUAErrors[code]; ok {
+		return fmt.Sprintf("0x%x (%s)", code, name)
+	}
+	return fmt.Sprintf("0x%x", code)
+}
+
+type wuaUpdateOpts struct {
+	classFilter      []string
+	kbExcludes       []string
+	exclusivePatches []string
+	minSeverity      string
+	batchSize        int
+	maxCycles        int
+	dryrun           bool
+	progress         ProgressFunc
+}
+
+// WUAUpdateOption is an option for RunWUAUpdate.
+type WUAUpdateOption func(*wuaUpdateOpts)
+
+// WUAClassifications only installs updates of these classification
+// category IDs.
+func WUAClassifications(classFilter []string) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.classFilter = classFilter
+	}
+}
+
+// WUAExcludes excludes the updates with these KB article IDs.
+func WUAExcludes(kbExcludes []string) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.kbExcludes = kbExcludes
+	}
+}
+
+// WUAExclusivePatches only installs the updates with these KB article IDs.
+func WUAExclusivePatches(exclusivePatches []string) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.exclusivePatches = exclusivePatches
+	}
+}
+
+// WUAMinSeverity only installs updates with an MSRC severity of at least
+// this, e.g. "Critical" or "Important". Updates without a security bulletin
+// have no severity and are not installed.
+func WUAMinSeverity(severity string) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.minSeverity = severity
+	}
+}
+
+// WUABatchSize installs this many updates at once, defaults to 10.
+func WUABatchSize(size int) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.batchSize = size
+	}
+}
+
+// WUAMaxCycles limits how many times the run searches for and installs the
+// updates that became available after installing the previous ones,
+// defaults to 10.
+func WUAMaxCycles(cycles int) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.maxCycles = cycles
+	}
+}
+
+// WUADryRun performs a dry run.
+func WUADryRun(dryrun bool) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.dryrun = dryrun
+	}
+}
+
+// WUAProgress reports the progress of the patch run to f, with a package
+// step for each batch.
+func WUAProgress(f ProgressFunc) WUAUpdateOption {
+	return func(args *wuaUpdateOpts) {
+		args.progress = f
+	}
+}
+
+// wuaQuery returns the search for the updates to install: those not yet
+// installed, leaving out the ones that finish installing after a reboot.
+func (o *wuaUpdateOpts) wuaQuery() *packages.WUAQuery {
+	opts := []packages.WUAQueryOption{packages.WUAQueryInstalled(false), packages.WUAQueryRebootRequired(false)}
+	if o.minSeverity != "" {
+		opts = append(opts, packages.WUAQueryMsrcSeverities(packages.SeveritiesAtLeast(o.minSeverity)...))
+	}
+	return packages.NewWUAQuery(opts...)
+}
+
+// wuaBatches splits n updates into batches of at most size, as indexes.
+func wuaBatches(n, size int) [][]int {
+	if size <= 0 {
+		size = defaultWUABatchSize
+	}
+	var batches [][]int
+	for start := 0; start < n; start += size {
+		var batch []int
+		for i := start; i < n && i < start+size; i++ {
+			batch = append(batch, i)
+		}
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// installWUABatch installs the updates at idx with install and retries the
+// ones that failed with a transient error with p. It returns the last result
+// of each update by index, and the error of the last attempt if updates
+// still failed with a transient error or install itself failed.
+func installWUABatch(ctx context.Context, p retryutil.Policy, idx []int, install func([]int) ([]*packages.WUAInstallResult, error)) (map[int]*packages.WUAInstallResult, error) {
+	results := map[int]*packages.WUAInstallResult{}
+	pending := idx
+	err := retryutil.Do(ctx, p, "installing Windows updates", func() error {
+		rs, err := install(pending)
+		if err != nil {
+			if code, ok := wuaErrorCode(err); ok && transientWUAErrors[code] != "" {
+				return err
+			}
+			return retryutil.Permanent(err)
+		}
+		var retry []int
+		var codes []string
+		for i, r := range rs {
+			if i >= len(pending) {
+				break
+			}
+			results[pending[i]] = r
+			if !r.Succeeded() && transientWUAErrors[r.HResult] != "" {
+				retry = append(retry, pending[i])
+				codes = append(codes, wuaErrorName(r.HResult))
+			}
+		}
+		pending = retry
+		if len(retry) > 0 {
+			return fmt.Errorf("%d updates failed with transient errors %q", len(retry), codes)
+		}
+		return nil
+	})
+	return results, err
+}
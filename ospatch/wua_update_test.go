@@ -0,0 +1,98 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWUAErrorCode(t *testing.T) {
+	code, ok := wuaErrorCode(errors.New("error calling method Download on IUpdateDownloader: Exception occurred. SCODE: 0x8024401c"))
+	if !ok || code != 0x8024401c {
+		t.Errorf("wuaErrorCode: got %x, %v, want 8024401c, true", code, ok)
+	}
+	if _, ok := wuaErrorCode(errors.New("no code")); ok {
+		t.Error("wuaErrorCode: found a code in an error without one")
+	}
+}
+
+func TestWUABatches(t *testing.T) {
+	want := [][]int{{0, 1}, {2, 3}, {4}}
+	if diff := cmp.Diff(want, wuaBatches(5, 2)); diff != "" {
+		t.Errorf("wuaBatches: unexpected result (-want +got):\n%s", diff)
+	}
+	if got := wuaBatches(0, 2); got != nil {
+		t.Errorf("wuaBatches(0, 2) = %v, want nil", got)
+	}
+}
+
+func TestInstallWUABatch(t *testing.T) {
+	p := retryutil.Policy{Initial: time.Nanosecond, MaxAttempts: 3}
+	succeeded := &packages.WUAInstallResult{ResultCode: 2}
+	timeout := &packages.WUAInstallResult{ResultCode: 4, HResult: 0x8024401c}
+	failed := &packages.WUAInstallResult{ResultCode: 4, HResult: 0x80070643}
+
+	var calls [][]int
+	results, err := installWUABatch(context.Background(), p, []int{0, 1, 2}, func(idx []int) ([]*packages.WUAInstallResult, error) {
+		calls = append(calls, idx)
+		if len(calls) == 1 {
+			return []*packages.WUAInstallResult{succeeded, timeout, failed}, nil
+		}
+		return []*packages.WUAInstallResult{succeeded}, nil
+	})
+	if err != nil {
+		t.Fatalf("installWUABatch: unexpected error: %v", err)
+	}
+	// Only the update that failed with a transient error is retried.
+	if diff := cmp.Diff([][]int{{0, 1, 2}, {1}}, calls); diff != "" {
+		t.Errorf("installWUABatch: unexpected install calls (-want +got):\n%s", diff)
+	}
+	want := map[int]*packages.WUAInstallResult{0: succeeded, 1: succeeded, 2: failed}
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Errorf("installWUABatch: unexpected results (-want +got):\n%s", diff)
+	}
+
+	calls = nil
+	if _, err := installWUABatch(context.Background(), p, []int{0}, func(idx []int) ([]*packages.WUAInstallResult, error) {
+		calls = append(calls, idx)
+		return nil, errors.New("error calling method Install on IUpdateInstaller: SCODE: 0x80070005")
+	}); err == nil || len(calls) != 1 {
+		t.Errorf("installWUABatch: got error %v after %d calls, want a permanent error after 1 call", err, len(calls))
+	}
+}
+
+func TestWUAQueryMinSeverity(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     string
+	}{
+		{"", "IsInstalled=0 AND RebootRequired=0"},
+		{"Critical", `IsInstalled=0 AND RebootRequired=0 (MsrcSeverity in ["critical"])`},
+		{"important", `IsInstalled=0 AND RebootRequired=0 (MsrcSeverity in ["critical" "important"])`},
+	}
+	for _, tt := range tests {
+		o := &wuaUpdateOpts{minSeverity: tt.severity}
+		if got := o.wuaQuery().String(); got != tt.want {
+			t.Errorf("wuaQuery(%q) = %q, want %q", tt.severity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !test
+// +build !test
+
+package ospatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// wuaPkgInfo describes updt as a PkgInfo for the PatchResult, named by its
+// KB article, or its title if it has none.
+func wuaPkgInfo(updt *packages.IUpdate) (*packages.PkgInfo, error) {
+	title, err := updt.GetProperty("Title")
+	if err != nil {
+		return nil, fmt.Errorf(`updt.GetProperty("Title"): %v`, err)
+	}
+	defer title.Clear()
+	kbs, err := updt.KBArticleIDs()
+	if err != nil {
+		return nil, err
+	}
+	pkg := &packages.PkgInfo{Name: title.ToString()}
+	if len(kbs) > 0 {
+		pkg.Name, pkg.Version = "KB"+kbs[0], title.ToString()
+	}
+	return pkg, nil
+}
+
+// RunWUAUpdate installs the available Windows updates in batches and
+// returns the PatchResult, which is set even if installing the updates
+// fails. Installing updates often makes further updates available, so it
+// searches again until none are left, a reboot is needed to continue or
+// the cycles set by WUAMaxCycles are used up. RebootPending tells the
+// caller to reboot and run it again.
+func RunWUAUpdate(ctx context.Context, opts ...WUAUpdateOption) (*PatchResult, error) {
+	res := &PatchResult{}
+	defer res.timeSince(time.Now())
+
+	wuaOpts := &wuaUpdateOpts{batchSize: defaultWUABatchSize, maxCycles: defaultWUAMaxCycles}
+	for _, opt := range opts {
+		opt(wuaOpts)
+	}
+
+	session, err := packages.NewUpdateSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var errs []string
+	for cycle := 1; cycle <= wuaOpts.maxCycles; cycle++ {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		wuaOpts.progress.phase(PhaseRefresh)
+		clog.Infof(ctx, "Searching for available Windows updates.")
+		updts, _, err := GetWUAUpdatesWithQuery(ctx, session, wuaOpts.wuaQuery(), wuaOpts.classFilter, wuaOpts.kbExcludes, wuaOpts.exclusivePatches)
+		if err != nil {
+			return res, err
+		}
+		done, err := runWUACycle(ctx, session, wuaOpts, updts, res)
+		updts.Release()
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if done {
+			break
+		}
+		if res.RebootPending, _, err = RebootRequired(ctx); err != nil {
+			clog.Debugf(ctx, "Error checking if a reboot is required: %v", err)
+		}
+		if res.RebootPending {
+			clog.Infof(ctx, "A reboot is required to continue installing Windows updates.")
+			break
+		}
+		if cycle == wuaOpts.maxCycles {
+			errs = append(errs, fmt.Sprintf("Windows updates still available after %d cycles", cycle))
+		}
+	}
+	if len(errs) > 0 {
+		return res, fmt.Errorf("error installing Windows updates: %s", strings.Join(errs, "\n"))
+	}
+	return res, nil
+}
+
+// runWUACycle installs updts in batches and records the outcome in res. It
+// returns true if the run should not search for more updates: there was
+// nothing to install, it was a dry run or updates failed.
+func runWUACycle(ctx context.Context, session *packages.IUpdateSession, wuaOpts *wuaUpdateOpts, updts *packages.IUpdateCollection, res *PatchResult) (bool, error) {
+	count, err := updts.Count()
+	if err != nil {
+		return true, err
+	}
+	if count == 0 {
+		clog.Infof(ctx, "No Windows updates available to install.")
+		return true, nil
+	}
+
+	var items []*packages.IUpdate
+	var pkgs []*packages.PkgInfo
+	for i := 0; i < int(count); i++ {
+		updt, err := updts.Item(i)
+		if err != nil {
+			return true, err
+		}
+		defer updt.Release()
+		pkg, err := wuaPkgInfo(updt)
+		if err != nil {
+			return true, err
+		}
+		items = append(items, updt)
+		pkgs = append(pkgs, pkg)
+	}
+
+	if wuaOpts.dryrun {
+		clog.Infof(ctx, "Running in dryrun mode, not installing %d Windows updates: %q", len(pkgs), namesOf(pkgs))
+		return true, nil
+	}
+	clog.Infof(ctx, "%d Windows updates to install: %q", len(pkgs), namesOf(pkgs))
+	wuaOpts.progress.phase(PhaseInstall)
+
+	var errs []string
+	var failed int
+	batches := wuaBatches(len(items), wuaOpts.batchSize)
+	for n, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		clog.Infof(ctx, "Installing batch %d of %d.", n+1, len(batches))
+		if wuaOpts.progress != nil {
+			for _, i := range batch {
+				wuaOpts.progress(Progress{Phase: PhaseInstall, Action: "Installing", Package: pkgs[i].Name, Current: i + 1, Total: len(pkgs)})
+			}
+		}
+		results, err := installWUABatch(ctx, wuaRetryPolicy, batch, func(idx []int) ([]*packages.WUAInstallResult, error) {
+			var b []*packages.IUpdate
+			for _, i := range idx {
+				b = append(b, items[i])
+			}
+			return session.InstallWUAUpdates(ctx, b)
+		})
+		for _, i := range batch {
+			res.Attempted = append(res.Attempted, pkgs[i])
+			r, ok := results[i]
+			switch {
+			case ok && r.Succeeded():
+				res.Succeeded = append(res.Succeeded, pkgs[i])
+			case ok:
+				failed++
+				res.Failed = append(res.Failed, &PackageFailure{Package: pkgs[i], Error: fmt.Sprintf("result code %d, error %s", r.ResultCode, wuaErrorName(r.HResult))})
+			default:
+				failed++
+				res.Failed = append(res.Failed, &PackageFailure{Package: pkgs[i], Error: err.Error()})
+			}
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if failed > 0 {
+		// Searching again would only find the failed updates again.
+		errs = append(errs, fmt.Sprintf("%d of %d Windows updates failed to install", failed, len(pkgs)))
+		return true, errors.New(strings.Join(errs, "\n"))
+	}
+	if len(errs) > 0 {
+		return false, errors.New(strings.Join(errs, "\n"))
+	}
+	return false, nil
+}
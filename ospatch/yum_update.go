@@ -17,6 +17,7 @@ package ospatch
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -35,6 +36,18 @@ type yumUpdateOpts struct {
 	security          bool
 	minimal           bool
 	dryrun            bool
+	excludeAdvisories []string
+	minSeverity       string
+	prePatchHooks     []*PatchHook
+	postPatchHooks    []*PatchHook
+	snapshot          *SnapshotConfig
+	healthChecks      []HealthCheck
+	stage             PatchStage
+	progress          ProgressFunc
+	refresh           *RepoRefresh
+	checkpoint        *CheckpointConfig
+	batch             *BatchConfig
+	env               []string
 }
 
 // YumUpdateOption is an option for yum update.
@@ -71,6 +84,23 @@ func YumExclusivePackages(exclusivePackages []string) YumUpdateOption {
 	}
 }
 
+// YumExcludeAdvisories excludes the package updates covered by these
+// advisories, e.g. "RHSA-2024:0001", as listed by yum updateinfo.
+func YumExcludeAdvisories(advisories []string) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.excludeAdvisories = advisories
+	}
+}
+
+// YumMinSeverity only installs the package updates covered by an advisory
+// of at least this severity, e.g. "Critical" or "Important", as listed by
+// yum updateinfo.
+func YumMinSeverity(severity string) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.minSeverity = severity
+	}
+}
+
 // YumDryRun performs a dry run.
 func YumDryRun(dryrun bool) YumUpdateOption {
 	return func(args *yumUpdateOpts) {
@@ -78,8 +108,128 @@ func YumDryRun(dryrun bool) YumUpdateOption {
 	}
 }
 
-// RunYumUpdate runs yum update.
-func RunYumUpdate(ctx context.Context, opts ...YumUpdateOption) error {
+// YumPrePatchHooks runs these hooks before installing updates, patching
+// is aborted if one fails.
+func YumPrePatchHooks(hooks []*PatchHook) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.prePatchHooks = hooks
+	}
+}
+
+// YumPostPatchHooks runs these hooks after installing updates.
+func YumPostPatchHooks(hooks []*PatchHook) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.postPatchHooks = hooks
+	}
+}
+
+// YumSnapshot takes a snapshot before installing updates and rolls back to
+// it if installing them or a post-patch hook fails.
+func YumSnapshot(snapshot *SnapshotConfig) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.snapshot = snapshot
+	}
+}
+
+// YumHealthChecks runs these checks after installing updates and the post-patch
+// hooks, see HealthCheck.
+func YumHealthChecks(checks []HealthCheck) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.healthChecks = checks
+	}
+}
+
+// YumStage selects the phase of a staged patch run, see PatchStage.
+func YumStage(stage PatchStage) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.stage = stage
+	}
+}
+
+// YumProgress reports the progress of the patch run to f.
+func YumProgress(f ProgressFunc) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.progress = f
+	}
+}
+
+// YumRefresh refreshes the repository metadata before patching, see
+// RepoRefresh.
+func YumRefresh(refresh *RepoRefresh) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.refresh = refresh
+	}
+}
+
+// YumCheckpoint checkpoints the run with cfg so it resumes where it left
+// off if interrupted, see CheckpointConfig.
+func YumCheckpoint(cfg *CheckpointConfig) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.checkpoint = cfg
+	}
+}
+
+// YumBatch installs the updates in the batches set by cfg, see BatchConfig.
+func YumBatch(cfg *BatchConfig) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.batch = cfg
+	}
+}
+
+// YumEnv returns a YumUpdateOption that adds env, a list of "KEY=value"
+// entries, to the environment of the yum commands, e.g. an http_proxy for
+// mirrors only reachable through a proxy or DNF_VAR_ variables used in the
+// repo files.
+func YumEnv(env []string) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.env = env
+	}
+}
+
+func yumUpdatePlan(ctx context.Context, yumOpts *yumUpdateOpts) (*PatchPlan, error) {
+	pkgs, err := packages.YumUpdates(ctx, packages.YumUpdateMinimal(yumOpts.minimal), packages.YumUpdateSecurity(yumOpts.security))
+	if err != nil {
+		return nil, err
+	}
+
+	// Yum excludes are already excluded while listing yumUpdates, so we send
+	// and empty list.
+	fPkgs, err := filterPackages(pkgs, yumOpts.exclusivePackages, yumOpts.excludes, packages.CompareRPMEVR)
+	if err != nil {
+		return nil, err
+	}
+	if (len(yumOpts.excludeAdvisories) > 0 || yumOpts.minSeverity != "") && len(fPkgs) > 0 {
+		advisories, err := packages.YumAdvisories(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing advisories: %v", err)
+		}
+		if len(yumOpts.excludeAdvisories) > 0 {
+			fPkgs = excludePackageNames(ctx, fPkgs, packages.AdvisoryPackages(advisories, yumOpts.excludeAdvisories))
+		}
+		if yumOpts.minSeverity != "" {
+			fPkgs = keepPackageNames(ctx, fPkgs, packages.SevereAdvisoryPackages(advisories, yumOpts.minSeverity))
+		}
+	}
+	return newPatchPlan(fPkgs, nil), nil
+}
+
+// PlanYumUpdate returns the updates RunYumUpdate would install with the same
+// options, without installing anything.
+func PlanYumUpdate(ctx context.Context, opts ...YumUpdateOption) (*PatchPlan, error) {
+	yumOpts := &yumUpdateOpts{}
+	for _, opt := range opts {
+		opt(yumOpts)
+	}
+	ctx = packages.WithCommandEnv(ctx, yumOpts.env)
+	return yumUpdatePlan(ctx, yumOpts)
+}
+
+// RunYumUpdate runs yum update and returns the PatchResult, which is set
+// even if installing the updates fails.
+func RunYumUpdate(ctx context.Context, opts ...YumUpdateOption) (*PatchResult, error) {
+	res := &PatchResult{}
+	defer res.timeSince(time.Now())
+
 	yumOpts := &yumUpdateOpts{
 		security: false,
 		minimal:  false,
@@ -89,21 +239,22 @@ func RunYumUpdate(ctx context.Context, opts ...YumUpdateOption) error {
 	for _, opt := range opts {
 		opt(yumOpts)
 	}
+	ctx = packages.WithCommandEnv(ctx, yumOpts.env)
 
-	pkgs, err := packages.YumUpdates(ctx, packages.YumUpdateMinimal(yumOpts.minimal), packages.YumUpdateSecurity(yumOpts.security))
-	if err != nil {
-		return err
+	rctx := yumOpts.progress.watch(ctx, PhaseRefresh)
+	if err := res.refreshRepos(rctx, yumOpts.refresh, packages.RefreshYumRepos); err != nil {
+		return res, err
 	}
-
-	// Yum excludes are already excluded while listing yumUpdates, so we send
-	// and empty list.
-	fPkgs, err := filterPackages(pkgs, yumOpts.exclusivePackages, yumOpts.excludes)
+	plan, err := planOrResume(rctx, yumOpts.checkpoint, packages.InstalledRPMPackages, func() (*PatchPlan, error) {
+		return yumUpdatePlan(rctx, yumOpts)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	fPkgs := plan.Packages
 	if len(fPkgs) == 0 {
 		clog.Infof(ctx, "No packages to update.")
-		return nil
+		return res, nil
 	}
 
 	var pkgNames []string
@@ -111,10 +262,17 @@ func RunYumUpdate(ctx context.Context, opts ...YumUpdateOption) error {
 		pkgNames = append(pkgNames, pkg.Name)
 	}
 
-	msg := fmt.Sprintf("%d packages: %q", len(pkgNames), fPkgs)
 	if yumOpts.dryrun {
-		clog.Infof(ctx, "Running in dryrun mode, not updating %s", msg)
-		return nil
+		clog.Infof(ctx, "Running in dryrun mode, not updating %s", plan)
+		return res, nil
+	}
+	if yumOpts.stage == StageDownload {
+		clog.Infof(ctx, "Downloading %s, not installing.", plan)
+		err := packages.DownloadYumPackages(yumOpts.progress.watch(ctx, PhaseDownload), pkgNames)
+		if err == nil {
+			res.Downloaded = plan.Packages
+		}
+		return res, err
 	}
 	ops := opsToReport{
 		packages: fPkgs,
@@ -122,11 +280,47 @@ func RunYumUpdate(ctx context.Context, opts ...YumUpdateOption) error {
 
 	logOps(ctx, ops)
 
-	err = packages.InstallYumPackages(ctx, pkgNames)
+	install := packages.InstallYumPackages
+	if yumOpts.stage == StageInstallCached {
+		install = packages.InstallCachedYumPackages
+	}
+
+	before := yumTransactionID(ctx)
+	err = installWithCheckpoint(ctx, yumOpts.checkpoint, plan, func() error {
+		return installWithSnapshot(ctx, yumOpts.snapshot, yumOpts.prePatchHooks, yumOpts.postPatchHooks, func() error {
+			ictx := yumOpts.progress.watch(ctx, PhaseInstall)
+			return preserveAutoMarks(ctx, fPkgs, packages.YumAutoInstalled, packages.YumMarkAuto, func() error {
+				return installBatches(ctx, yumOpts.batch, fPkgs, func(batch []*packages.PkgInfo) error {
+					return withInstallRetry(ictx, "installing yum packages", func() error {
+						return install(ictx, namesOf(batch))
+					})
+				})
+			})
+		}, yumOpts.progress.verify(res.healthCheck(ctx, yumOpts.healthChecks)))
+	})
+	if after := yumTransactionID(ctx); after != before {
+		clog.Infof(ctx, "Patch run made yum transaction %s.", after)
+		res.TransactionID = after
+	}
 	if err == nil {
 		logSuccess(ctx, ops)
 	} else {
 		logFailure(ctx, ops, err)
 	}
-	return err
+	res.recordInstall(ctx, ops.packages, err, packages.InstalledRPMPackages)
+	return res, err
+}
+
+// yumTransactionID returns the ID of the last yum or dnf transaction, empty
+// if there is none or it could not be read.
+func yumTransactionID(ctx context.Context) string {
+	tx, err := packages.YumLastTransaction(ctx)
+	if err != nil {
+		clog.Debugf(ctx, "Error reading yum history: %v", err)
+		return ""
+	}
+	if tx == nil {
+		return ""
+	}
+	return tx.ID
 }
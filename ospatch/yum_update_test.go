@@ -25,6 +25,30 @@ import (
 	"github.com/golang/mock/gomock"
 )
 
+// expectYumHistory expects the yum history lookups RunYumUpdate makes before
+// and after installing, returning the given last transaction IDs in order.
+func expectYumHistory(m *utilmocks.MockCommandRunner, ids ...string) {
+	cmd := exec.Command("/usr/bin/yum", "history", "info", "last")
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	var prev *gomock.Call
+	for _, id := range ids {
+		call := m.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(cmd)).Return([]byte("Transaction ID : "+id+"\n"), nil, nil).Times(1)
+		if prev != nil {
+			call.After(prev)
+		}
+		prev = call
+	}
+}
+
+// expectYumAutoMarks expects RunYumUpdate to read the dnf install reasons
+// before installing, and to mark auto as installed as a dependency again.
+func expectYumAutoMarks(m *utilmocks.MockCommandRunner, reasons string, auto ...string) {
+	query := m.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", "repoquery", "--installed", "--quiet", "--queryformat", "%{name} %{reason}"))).Return([]byte(reasons), nil, nil).Times(1)
+	if len(auto) > 0 {
+		m.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(exec.Command("/usr/bin/yum", append([]string{"mark", "remove"}, auto...)...))).After(query).Return(nil, nil, nil).Times(1)
+	}
+}
+
 func TestRunYumUpdateWithSecurity(t *testing.T) {
 	data := []byte(`
 	=================================================================================================================================================================================
@@ -56,10 +80,21 @@ func TestRunYumUpdateWithSecurity(t *testing.T) {
 	packages.SetPtyCommandRunner(mockCommandRunner)
 	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", []string{"update", "--assumeno", "--cacheonly", "--color=never", "--security"}...))).Return(data, []byte("stderr"), nil).Times(1)
 
-	err = RunYumUpdate(ctx, YumUpdateMinimal(false), YumUpdateSecurity(true))
+	expectYumHistory(mockCommandRunner, "4", "5")
+	// foo was installed as a dependency, installing its update by name must
+	// not turn it into a requested package.
+	expectYumAutoMarks(mockCommandRunner, "bash user\nfoo dependency\n", "foo")
+
+	res, err := RunYumUpdate(ctx, YumUpdateMinimal(false), YumUpdateSecurity(true))
 	if err != nil {
 		t.Errorf("did not expect error: %+v", err)
 	}
+	if len(res.Succeeded) != 1 || res.Succeeded[0].Name != "foo" {
+		t.Errorf("unexpected Succeeded packages: %q", res.Succeeded)
+	}
+	if res.TransactionID != "5" {
+		t.Errorf("TransactionID = %q, want %q", res.TransactionID, "5")
+	}
 }
 
 func TestRunYumUpdateWithSecurityWithExclusives(t *testing.T) {
@@ -98,8 +133,71 @@ func TestRunYumUpdateWithSecurityWithExclusives(t *testing.T) {
 	packages.SetPtyCommandRunner(mockCommandRunner)
 	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", []string{"update", "--assumeno", "--cacheonly", "--color=never", "--security"}...))).Return(data, []byte("stderr"), nil).Times(1)
 
-	err = RunYumUpdate(ctx, YumUpdateMinimal(false), YumUpdateSecurity(true), YumExclusivePackages(exclusivePackages))
+	expectYumHistory(mockCommandRunner, "4", "5")
+	expectYumAutoMarks(mockCommandRunner, "")
+
+	res, err := RunYumUpdate(ctx, YumUpdateMinimal(false), YumUpdateSecurity(true), YumExclusivePackages(exclusivePackages))
 	if err != nil {
 		t.Errorf("did not expect error: %+v", err)
 	}
+	if len(res.Attempted) != 2 || len(res.Failed) != 0 {
+		t.Errorf("unexpected result, Attempted: %q, Failed: %v", res.Attempted, res.Failed)
+	}
+}
+
+func TestRunYumUpdateStaged(t *testing.T) {
+	data := []byte(`
+	=================================================================================================================================================================================
+	Package                                      Arch                           Version                                              Repository                                Size
+    =================================================================================================================================================================================
+    Upgrading:
+      foo                                       noarch                         2.0.0-1                           BaseOS                                   361 k
+    blah
+`)
+	ctx := context.Background()
+
+	if os.Getenv("EXIT100") == "1" {
+		os.Exit(100)
+	}
+
+	cmd := exec.CommandContext(context.Background(), os.Args[0], "-test.run=TestRunYumUpdateStaged")
+	cmd.Env = append(os.Environ(), "EXIT100=1")
+	checkUpdateErr := cmd.Run()
+
+	tests := []struct {
+		stage   PatchStage
+		install []string
+	}{
+		{StageDownload, []string{"install", "--assumeyes", "--downloadonly", "foo"}},
+		{StageInstallCached, []string{"install", "--assumeyes", "--cacheonly", "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stage.String(), func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+			packages.SetCommandRunner(mockCommandRunner)
+			packages.SetPtyCommandRunner(mockCommandRunner)
+			checkUpdateCall := mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", []string{"check-update", "--assumeyes"}...))).Return([]byte("stdout"), []byte("stderr"), checkUpdateErr).Times(1)
+			mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", []string{"update", "--assumeno", "--cacheonly", "--color=never"}...))).Return(data, []byte("stderr"), nil).Times(1)
+			mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command("/usr/bin/yum", tt.install...))).After(checkUpdateCall).Return([]byte("stdout"), []byte("stderr"), nil).Times(1)
+			if tt.stage == StageInstallCached {
+				expectYumHistory(mockCommandRunner, "4", "5")
+				expectYumAutoMarks(mockCommandRunner, "")
+			}
+
+			res, err := RunYumUpdate(ctx, YumStage(tt.stage))
+			if err != nil {
+				t.Fatalf("did not expect error: %+v", err)
+			}
+			downloaded := tt.stage == StageDownload
+			if got := len(res.Downloaded) == 1; got != downloaded {
+				t.Errorf("unexpected Downloaded packages: %q", res.Downloaded)
+			}
+			if got := len(res.Succeeded) == 1; got == downloaded {
+				t.Errorf("unexpected Succeeded packages: %q", res.Succeeded)
+			}
+		})
+	}
 }
@@ -16,7 +16,9 @@ package ospatch
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -29,13 +31,26 @@ var (
 )
 
 type zypperPatchOpts struct {
-	categories       []string
-	severities       []string
-	excludes         []*Exclude
-	exclusivePatches []string
-	withOptional     bool
-	withUpdate       bool
-	dryrun           bool
+	categories        []string
+	severities        []string
+	minSeverity       string
+	excludes          []*Exclude
+	exclusivePatches  []string
+	exclusivePackages []string
+	withOptional      bool
+	withUpdate        bool
+	dryrun            bool
+	excludeAdvisories []string
+	prePatchHooks     []*PatchHook
+	postPatchHooks    []*PatchHook
+	snapshot          *SnapshotConfig
+	healthChecks      []HealthCheck
+	stage             PatchStage
+	progress          ProgressFunc
+	refresh           *RepoRefresh
+	checkpoint        *CheckpointConfig
+	batch             *BatchConfig
+	env               []string
 }
 
 // ZypperPatchOption is an option for zypper patch.
@@ -57,6 +72,15 @@ func ZypperPatchSeverities(severities []string) ZypperPatchOption {
 	}
 }
 
+// ZypperPatchMinSeverity only installs patches of at least this severity,
+// e.g. "critical" or "important". Package updates that are not part of a
+// patch have no severity and are not installed.
+func ZypperPatchMinSeverity(severity string) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.minSeverity = severity
+	}
+}
+
 // ZypperUpdateWithOptional returns a ZypperUpdateOption that specifies the
 // --with-optional flag should be used.
 func ZypperUpdateWithOptional(withOptional bool) ZypperPatchOption {
@@ -89,6 +113,24 @@ func ZypperUpdateWithExclusivePatches(exclusivePatches []string) ZypperPatchOpti
 	}
 }
 
+// ZypperUpdateWithExclusivePackages returns a ZypperUpdateOption that
+// updates only these packages, from zypper list-updates, and installs no
+// patches. It can't be combined with ZypperUpdateWithExclusivePatches.
+func ZypperUpdateWithExclusivePackages(exclusivePackages []string) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.exclusivePackages = exclusivePackages
+	}
+}
+
+// ZypperExcludeAdvisories excludes the patches with these names, e.g.
+// "SUSE-SLE-Module-Basesystem-15-SP5-2024-1", and with ZypperUpdateWithUpdate
+// also the package updates that belong to them.
+func ZypperExcludeAdvisories(advisories []string) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.excludeAdvisories = advisories
+	}
+}
+
 // ZypperUpdateDryrun returns a ZypperUpdateOption that specifies the runner.
 func ZypperUpdateDryrun(dryrun bool) ZypperPatchOption {
 	return func(args *zypperPatchOpts) {
@@ -96,31 +138,115 @@ func ZypperUpdateDryrun(dryrun bool) ZypperPatchOption {
 	}
 }
 
-// RunZypperPatch runs zypper patch.
-func RunZypperPatch(ctx context.Context, opts ...ZypperPatchOption) error {
-	zOpts := &zypperPatchOpts{
-		excludes:         nil,
-		exclusivePatches: nil,
-		categories:       nil,
-		severities:       nil,
-		withOptional:     false,
-		withUpdate:       false,
+// ZypperUpdatePrePatchHooks runs these hooks before installing updates, patching
+// is aborted if one fails.
+func ZypperUpdatePrePatchHooks(hooks []*PatchHook) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.prePatchHooks = hooks
 	}
+}
 
-	for _, opt := range opts {
-		opt(zOpts)
+// ZypperUpdatePostPatchHooks runs these hooks after installing updates.
+func ZypperUpdatePostPatchHooks(hooks []*PatchHook) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.postPatchHooks = hooks
+	}
+}
+
+// ZypperUpdateSnapshot takes a snapshot before installing updates and rolls back to
+// it if installing them or a post-patch hook fails.
+func ZypperUpdateSnapshot(snapshot *SnapshotConfig) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.snapshot = snapshot
+	}
+}
+
+// ZypperUpdateHealthChecks runs these checks after installing updates and the post-patch
+// hooks, see HealthCheck.
+func ZypperUpdateHealthChecks(checks []HealthCheck) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.healthChecks = checks
+	}
+}
+
+// ZypperUpdateStage selects the phase of a staged patch run, see PatchStage.
+func ZypperUpdateStage(stage PatchStage) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.stage = stage
+	}
+}
+
+// ZypperUpdateProgress reports the progress of the patch run to f.
+func ZypperUpdateProgress(f ProgressFunc) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.progress = f
+	}
+}
+
+// ZypperUpdateRefresh refreshes the repository metadata before patching, see
+// RepoRefresh.
+func ZypperUpdateRefresh(refresh *RepoRefresh) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.refresh = refresh
+	}
+}
+
+// ZypperUpdateCheckpoint checkpoints the run with cfg so it resumes where it
+// left off if interrupted, see CheckpointConfig.
+func ZypperUpdateCheckpoint(cfg *CheckpointConfig) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.checkpoint = cfg
+	}
+}
+
+// ZypperUpdateBatch installs the package updates in the batches set by cfg,
+// see BatchConfig. The patches are installed together before the first
+// batch, they are one batch as far as the failure budget is concerned.
+func ZypperUpdateBatch(cfg *BatchConfig) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.batch = cfg
+	}
+}
+
+// ZypperPatchEnv returns a ZypperPatchOption that adds env, a list of
+// "KEY=value" entries, to the environment of the zypper commands, e.g. an
+// http_proxy for mirrors only reachable through a proxy.
+func ZypperPatchEnv(env []string) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.env = env
+	}
+}
+
+func zypperPatchPlan(ctx context.Context, zOpts *zypperPatchOpts) (*PatchPlan, error) {
+	if len(zOpts.exclusivePackages) > 0 {
+		if len(zOpts.exclusivePatches) > 0 {
+			return nil, errors.New("exclusive patches and exclusive packages can not both be set")
+		}
+		pkgUpdates, err := packages.ZypperUpdates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		fpkgs, err := filterPackages(pkgUpdates, zOpts.exclusivePackages, nil, packages.CompareRPMEVR)
+		if err != nil {
+			return nil, err
+		}
+		return newPatchPlan(fpkgs, nil), nil
 	}
 
+	severities := zOpts.severities
+	if zOpts.minSeverity != "" {
+		severities = packages.SeveritiesAtLeast(zOpts.minSeverity)
+	}
 	zListOpts := []packages.ZypperListOption{
 		packages.ZypperListPatchCategories(zOpts.categories),
-		packages.ZypperListPatchSeverities(zOpts.severities),
+		packages.ZypperListPatchSeverities(severities),
 		packages.ZypperListPatchWithOptional(zOpts.withOptional),
 		// if there is no filter on category and severity,
 		// zypper fetches all available patch updates
 	}
 	patches, err := packages.ZypperPatches(ctx, zListOpts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// if user specifies, --with-update get the necessary patch/package
@@ -130,21 +256,82 @@ func RunZypperPatch(ctx context.Context, opts ...ZypperPatchOption) error {
 	if zOpts.withUpdate {
 		pkgUpdates, err = packages.ZypperUpdates(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		pkgToPatchesMap, err = packages.ZypperPackagesInPatch(ctx, patches)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	fPatches, fpkgs, err := runFilter(patches, zOpts.exclusivePatches, zOpts.excludes, pkgUpdates, pkgToPatchesMap, zOpts.withUpdate)
+	if err != nil {
+		return nil, err
+	}
+	if len(zOpts.excludeAdvisories) > 0 {
+		fPatches, fpkgs = excludeZypperAdvisories(ctx, fPatches, fpkgs, pkgToPatchesMap, zOpts.excludeAdvisories)
+	}
+	if zOpts.minSeverity != "" {
+		fpkgs = nil
+	}
+	return newPatchPlan(fpkgs, fPatches), nil
+}
 
-	if len(fPatches) == 0 && len(fpkgs) == 0 {
+// PlanZypperPatch returns the patches and updates RunZypperPatch would
+// install with the same options, without installing anything.
+func PlanZypperPatch(ctx context.Context, opts ...ZypperPatchOption) (*PatchPlan, error) {
+	zOpts := &zypperPatchOpts{}
+	for _, opt := range opts {
+		opt(zOpts)
+	}
+	ctx = packages.WithCommandEnv(ctx, zOpts.env)
+	return zypperPatchPlan(ctx, zOpts)
+}
+
+// RunZypperPatch runs zypper patch and returns the PatchResult, which is set
+// even if installing the updates fails.
+func RunZypperPatch(ctx context.Context, opts ...ZypperPatchOption) (*PatchResult, error) {
+	res := &PatchResult{}
+	defer res.timeSince(time.Now())
+
+	zOpts := &zypperPatchOpts{
+		excludes:         nil,
+		exclusivePatches: nil,
+		categories:       nil,
+		severities:       nil,
+		withOptional:     false,
+		withUpdate:       false,
+	}
+
+	for _, opt := range opts {
+		opt(zOpts)
+	}
+	ctx = packages.WithCommandEnv(ctx, zOpts.env)
+
+	rctx := zOpts.progress.watch(ctx, PhaseRefresh)
+	if err := res.refreshRepos(rctx, zOpts.refresh, refreshZypperRepos); err != nil {
+		return res, err
+	}
+	plan, err := planOrResume(rctx, zOpts.checkpoint, packages.InstalledRPMPackages, func() (*PatchPlan, error) {
+		return zypperPatchPlan(rctx, zOpts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	fPatches, fpkgs := plan.Patches, plan.Packages
+	if plan.Empty() {
 		clog.Infof(ctx, "No updates required.")
-		return nil
+		return res, nil
 	}
 
+	if zOpts.stage == StageDownload && !zOpts.dryrun {
+		clog.Infof(ctx, "Downloading %s, not installing.", plan)
+		err := packages.ZypperDownload(zOpts.progress.watch(ctx, PhaseDownload), fPatches, fpkgs)
+		if err == nil {
+			res.Downloaded = plan.Packages
+		}
+		return res, err
+	}
 	var ops opsToReport
 
 	if len(fPatches) == 0 {
@@ -171,15 +358,36 @@ func RunZypperPatch(ctx context.Context, opts ...ZypperPatchOption) error {
 	logOps(ctx, ops)
 
 	if zOpts.dryrun {
-		return nil
+		clog.Infof(ctx, "Running in dryrun mode, not installing %s", plan)
+		return res, nil
+	}
+	zypperInstall := packages.ZypperInstall
+	if zOpts.stage == StageInstallCached {
+		zypperInstall = packages.ZypperInstallCached
+	}
+	install := func(ctx context.Context, patches []*packages.ZypperPatch, pkgs []*packages.PkgInfo) error {
+		return withInstallRetry(ctx, "installing zypper patches and packages", func() error {
+			return zypperInstall(ctx, patches, pkgs)
+		})
 	}
-	err = packages.ZypperInstall(ctx, fPatches, fpkgs)
+
+	err = installWithCheckpoint(ctx, zOpts.checkpoint, plan, func() error {
+		return installWithSnapshot(ctx, zOpts.snapshot, zOpts.prePatchHooks, zOpts.postPatchHooks, func() error {
+			ictx := zOpts.progress.watch(ctx, PhaseInstall)
+			if zOpts.batch == nil {
+				return install(ictx, fPatches, fpkgs)
+			}
+			return installZypperBatches(ictx, zOpts.batch, fPatches, fpkgs, install)
+		}, zOpts.progress.verify(res.healthCheck(ctx, zOpts.healthChecks)))
+	})
 	if err == nil {
 		logSuccess(ctx, ops)
 	} else {
 		logFailure(ctx, ops, err)
 	}
-	return err
+	res.Patches = ops.patches
+	res.recordInstall(ctx, ops.packages, err, packages.InstalledRPMPackages)
+	return res, err
 }
 
 func runFilter(patches []*packages.ZypperPatch, exclusivePatches []string, excludes []*Exclude, pkgUpdates []*packages.PkgInfo, pkgToPatchesMap map[string][]string, withUpdate bool) ([]*packages.ZypperPatch, []*packages.PkgInfo, error) {
@@ -216,3 +424,30 @@ func runFilter(patches []*packages.ZypperPatch, exclusivePatches []string, exclu
 	}
 	return fPatches, fPkgs, nil
 }
+
+// installZypperBatches installs the patches and then the packages in
+// batches, the patches count as one batch against the failure budget.
+func installZypperBatches(ctx context.Context, cfg *BatchConfig, patches []*packages.ZypperPatch, pkgs []*packages.PkgInfo, install func(context.Context, []*packages.ZypperPatch, []*packages.PkgInfo) error) error {
+	var patchErr error
+	budget := *cfg
+	if len(patches) > 0 {
+		clog.Infof(ctx, "Installing %d patches before the package batches.", len(patches))
+		if patchErr = install(ctx, patches, nil); patchErr != nil {
+			if budget.FailureBudget == 0 {
+				return fmt.Errorf("patches failed: %v", patchErr)
+			}
+			budget.FailureBudget--
+		}
+	}
+	err := installBatches(ctx, &budget, pkgs, func(batch []*packages.PkgInfo) error {
+		return install(ctx, nil, batch)
+	})
+	switch {
+	case patchErr == nil:
+		return err
+	case err == nil:
+		return fmt.Errorf("patches failed: %v", patchErr)
+	default:
+		return fmt.Errorf("patches failed: %v\n%v", patchErr, err)
+	}
+}
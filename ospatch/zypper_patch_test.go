@@ -1,12 +1,40 @@
 package ospatch
 
 import (
+	"context"
+	"os/exec"
 	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/osconfig/packages"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
 )
 
+func TestPlanZypperPatchExclusivePackages(t *testing.T) {
+	ctx := context.Background()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	packages.SetCommandRunner(mockCommandRunner)
+
+	data := []byte("v | SLES12-SP3-Updates  | at                     | 3.1.14-7.3      | 3.1.14-8.3.1      | x86_64\n" +
+		"v | SLES12-SP3-Updates  | curl                   | 7.60.0-1.1      | 7.60.0-2.1        | x86_64")
+	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command(zypper, "--gpg-auto-import-keys", "-q", "list-updates"))).Return(data, nil, nil).Times(1)
+
+	plan, err := PlanZypperPatch(ctx, ZypperUpdateWithExclusivePackages([]string{"curl"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Patches) != 0 || len(plan.Packages) != 1 || plan.Packages[0].Name != "curl" {
+		t.Errorf("unexpected plan: %s", plan)
+	}
+
+	if _, err := PlanZypperPatch(ctx, ZypperUpdateWithExclusivePackages([]string{"curl"}), ZypperUpdateWithExclusivePatches([]string{"patch"})); err == nil {
+		t.Error("did not get expected error combining exclusive patches and packages")
+	}
+}
+
 func TestRunFilter(t *testing.T) {
 	patches, pkgUpdates, pkgToPatchesMap := prepareTestCase()
 	type input struct {
@@ -0,0 +1,128 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+)
+
+// yum and dnf both support listing the advisories of available updates
+// this way.
+var yumUpdateInfoArgs = []string{"updateinfo", "list", "updates"}
+
+// Advisory is an erratum, like a security advisory, and the package updates
+// it covers.
+type Advisory struct {
+	// ID is the advisory ID, e.g. "RHSA-2024:0001" or "FEDORA-2024-1a2b3c".
+	ID string
+	// Type is "security", "bugfix", "enhancement" or "newpackage".
+	Type string
+	// Severity is only set for security advisories, e.g. "Important".
+	Severity string `json:",omitempty"`
+	Packages []*PkgInfo
+}
+
+func parseYumUpdateInfoType(s string) (string, string) {
+	// "Important/Sec." for security advisories with a severity.
+	if i := strings.Index(s, "/"); i >= 0 {
+		typ, sev := s[i+1:], s[:i]
+		if strings.HasPrefix(typ, "Sec") {
+			typ = "security"
+		}
+		return typ, sev
+	}
+	return s, ""
+}
+
+func parseYumUpdateInfo(data []byte) []*Advisory {
+	/*
+		Loaded plugins: fastestmirror
+		RHSA-2024:0001 Important/Sec. kernel-3.10.0-1160.108.1.el7.x86_64
+		RHSA-2024:0001 Important/Sec. kernel-tools-3.10.0-1160.108.1.el7.x86_64
+		RHBA-2024:0002 bugfix         tzdata-2024a-1.el7.noarch
+		updateinfo list done
+	*/
+	var advisories []*Advisory
+	byID := map[string]*Advisory{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		pkg, ok := parseRPMNEVRA(fields[2])
+		if !ok {
+			continue
+		}
+		pkg.Epoch = epochOf(pkg.Version)
+
+		a, ok := byID[fields[0]]
+		if !ok {
+			a = &Advisory{ID: fields[0]}
+			a.Type, a.Severity = parseYumUpdateInfoType(fields[1])
+			byID[a.ID] = a
+			advisories = append(advisories, a)
+		}
+		a.Packages = append(a.Packages, pkg)
+	}
+	return advisories
+}
+
+// YumAdvisories lists the advisories covering the available yum or dnf
+// updates.
+func YumAdvisories(ctx context.Context) ([]*Advisory, error) {
+	out, err := run(ctx, yum, yumUpdateInfoArgs)
+	if err != nil {
+		return nil, err
+	}
+	return parseYumUpdateInfo(out), nil
+}
+
+// AdvisoryPackages returns the names of the packages covered by any of the
+// advisories with the given IDs.
+func AdvisoryPackages(advisories []*Advisory, ids []string) map[string]bool {
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	names := map[string]bool{}
+	for _, a := range advisories {
+		if !want[a.ID] {
+			continue
+		}
+		for _, p := range a.Packages {
+			names[p.Name] = true
+		}
+	}
+	return names
+}
+
+// SevereAdvisoryPackages returns the names of the packages covered by an
+// advisory with a severity of at least min, see SeverityAtLeast.
+func SevereAdvisoryPackages(advisories []*Advisory, min string) map[string]bool {
+	names := map[string]bool{}
+	for _, a := range advisories {
+		if !SeverityAtLeast(a.Severity, min) {
+			continue
+		}
+		for _, p := range a.Packages {
+			names[p.Name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,83 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+var yumUpdateInfo = []byte(`Loaded plugins: fastestmirror
+RHSA-2024:0001 Important/Sec. kernel-3.10.0-1160.108.1.el7.x86_64
+RHSA-2024:0001 Important/Sec. kernel-tools-3.10.0-1160.108.1.el7.x86_64
+RHBA-2024:0002 bugfix         tzdata-2024a-1.el7.noarch
+updateinfo list done
+`)
+
+func TestParseYumUpdateInfo(t *testing.T) {
+	want := []*Advisory{
+		{ID: "RHSA-2024:0001", Type: "security", Severity: "Important", Packages: []*PkgInfo{
+			{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1160.108.1.el7"},
+			{Name: "kernel-tools", Arch: "x86_64", Version: "3.10.0-1160.108.1.el7"},
+		}},
+		{ID: "RHBA-2024:0002", Type: "bugfix", Packages: []*PkgInfo{
+			{Name: "tzdata", Arch: "all", Version: "2024a-1.el7"},
+		}},
+	}
+	got := parseYumUpdateInfo(yumUpdateInfo)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseYumUpdateInfo() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := parseYumUpdateInfo(nil); got != nil {
+		t.Errorf("parseYumUpdateInfo(nil) = %v, want nil", got)
+	}
+}
+
+func TestAdvisoryPackages(t *testing.T) {
+	advisories := parseYumUpdateInfo(yumUpdateInfo)
+	want := map[string]bool{"kernel": true, "kernel-tools": true}
+	if diff := cmp.Diff(want, AdvisoryPackages(advisories, []string{"RHSA-2024:0001", "RHSA-2024:9999"})); diff != "" {
+		t.Errorf("AdvisoryPackages() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestYumAdvisories(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	expectedCmd := utilmocks.EqCmd(exec.Command(yum, yumUpdateInfoArgs...))
+
+	mockCommandRunner.EXPECT().Run(testCtx, expectedCmd).Return(yumUpdateInfo, []byte("stderr"), nil).Times(1)
+	got, err := YumAdvisories(testCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("YumAdvisories() returned %d advisories, want 2", len(got))
+	}
+
+	mockCommandRunner.EXPECT().Run(testCtx, expectedCmd).Return(nil, []byte("stderr"), errors.New("error")).Times(1)
+	if _, err := YumAdvisories(testCtx); err == nil {
+		t.Error("did not get expected error")
+	}
+}
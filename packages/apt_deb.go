@@ -19,10 +19,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"os/exec"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
@@ -35,6 +35,8 @@ var (
 	dpkgQuery string
 	dpkgDeb   string
 	aptGet    string
+	aptCache  string
+	aptMark   string
 
 	dpkgInstallArgs       = []string{"--install"}
 	dpkgInfoFieldsMapping = map[string]string{
@@ -50,8 +52,11 @@ var (
 	dpkgQueryArgs         = []string{"-W", "-f", dpkgPackageFormatJSON}
 	dpkgRepairArgs        = []string{"--configure", "-a"}
 	aptGetInstallArgs     = []string{"install", "-y"}
+	aptGetDownloadArgs    = []string{"install", "-y", "--download-only"}
+	aptGetCachedArgs      = []string{"install", "-y", "--no-download"}
 	aptGetRemoveArgs      = []string{"remove", "-y"}
 	aptGetUpdateArgs      = []string{"update"}
+	aptCachePolicyArgs    = []string{"policy"}
 
 	aptGetUpgradeCmd     = "upgrade"
 	aptGetFullUpgradeCmd = "full-upgrade"
@@ -68,6 +73,8 @@ func init() {
 		dpkgQuery = "/usr/bin/dpkg-query"
 		dpkgDeb = "/usr/bin/dpkg-deb"
 		aptGet = "/usr/bin/apt-get"
+		aptCache = "/usr/bin/apt-cache"
+		aptMark = "/usr/bin/apt-mark"
 	}
 	AptExists = util.Exists(aptGet)
 	DpkgExists = util.Exists(dpkg)
@@ -90,6 +97,7 @@ type aptGetUpgradeOpts struct {
 	upgradeType     AptUpgradeType
 	showNew         bool
 	allowDowngrades bool
+	candidatePolicy bool
 }
 
 // AptGetUpgradeOption is an option for apt-get upgrade.
@@ -134,6 +142,15 @@ func AptGetUpgradeAllowDowngrades(allowDowngrades bool) AptGetUpgradeOption {
 	}
 }
 
+// AptGetUpgradeCandidatePolicy returns a AptGetUpgradeOption that specifies
+// whether AptUpdates should look up the apt-cache policy of each update and
+// populate PkgInfo.AptCandidate.
+func AptGetUpgradeCandidatePolicy(candidatePolicy bool) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.candidatePolicy = candidatePolicy
+	}
+}
+
 func dpkgRepair(ctx context.Context, out []byte) bool {
 	// Error code 100 may occur for non repairable errors, just check the output.
 	if !bytes.Contains(out, dpkgErr) {
@@ -149,18 +166,21 @@ func dpkgRepair(ctx context.Context, out []byte) bool {
 type cmdModifier func(*exec.Cmd)
 
 func runAptGet(ctx context.Context, args []string, cmdModifiers []cmdModifier) ([]byte, []byte, error) {
-	cmd := exec.CommandContext(ctx, aptGet, args...)
+	cmd := commandContext(ctx, aptGet, args...)
 	for _, modifier := range cmdModifiers {
 		modifier(cmd)
 	}
 
-	return runner.Run(ctx, cmd)
+	return runnerFor(ManagerApt).Run(ctx, cmd)
 }
 
 func runAptGetWithDowngradeRetrial(ctx context.Context, args []string, cmdModifiers []cmdModifier) ([]byte, []byte, error) {
 	stdout, stderr, err := runAptGet(ctx, args, cmdModifiers)
 	if err != nil {
 		if strings.Contains(string(stderr), "E: Packages were downgraded and -y was used without --allow-downgrades.") {
+			if perr := checkProtected("downgrade", args); perr != nil {
+				return stdout, stderr, perr
+			}
 			cmdModifiers = append(cmdModifiers, func(cmd *exec.Cmd) {
 				cmd.Args = append(cmd.Args, allowDowngradesArg)
 			})
@@ -214,6 +234,7 @@ func parseDpkgDeb(data []byte) (*PkgInfo, error) {
 		}
 		if bytes.Contains(fields[0], []byte("Version:")) {
 			info.Version = string(fields[1])
+			info.Epoch = epochOf(info.Version)
 			continue
 		}
 		if bytes.Contains(fields[0], []byte("Architecture:")) {
@@ -239,30 +260,53 @@ func DebPkgInfo(ctx context.Context, path string) (*PkgInfo, error) {
 
 // InstallAptPackages installs apt packages.
 func InstallAptPackages(ctx context.Context, pkgs []string) error {
-	args := append(aptGetInstallArgs, pkgs...)
+	return installAptPackages(ctx, aptGetInstallArgs, pkgs)
+}
+
+// DownloadAptPackages downloads apt packages and their dependencies to the
+// apt cache without installing them, see InstallCachedAptPackages.
+func DownloadAptPackages(ctx context.Context, pkgs []string) error {
+	return installAptPackages(ctx, aptGetDownloadArgs, pkgs)
+}
+
+// InstallCachedAptPackages installs apt packages from the apt cache, as
+// downloaded by DownloadAptPackages, failing if a package is not cached.
+func InstallCachedAptPackages(ctx context.Context, pkgs []string) error {
+	return installAptPackages(ctx, aptGetCachedArgs, pkgs)
+}
+
+func installAptPackages(ctx context.Context, installArgs, pkgs []string) error {
+	args := append(append([]string{}, installArgs...), pkgs...)
 	cmdModifiers := []cmdModifier{
 		func(cmd *exec.Cmd) {
-			cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+			cmd.Env = commandEnvWith(ctx, "DEBIAN_FRONTEND=noninteractive")
 		},
 	}
 	stdout, stderr, err := runAptGetWithDowngradeRetrial(ctx, args, cmdModifiers)
+	if _, ok := err.(*ProtectedPackageError); ok {
+		return err
+	}
 	if err != nil {
 		if dpkgRepair(ctx, stderr) {
 			stdout, stderr, err = runAptGetWithDowngradeRetrial(ctx, args, cmdModifiers)
 		}
 	}
 	if err != nil {
-		err = fmt.Errorf("error running %s with args %q: %v, stdout: %q, stderr: %q", aptGet, args, err, stdout, stderr)
+		return newCmdError(aptGet, args, stdout, stderr, err)
 	}
-	return err
+	return nil
 }
 
-// RemoveAptPackages removes apt packages.
+// RemoveAptPackages removes apt packages, protected packages are refused
+// with a *ProtectedPackageError.
 func RemoveAptPackages(ctx context.Context, pkgs []string) error {
+	if err := checkProtected("remove", pkgs); err != nil {
+		return err
+	}
 	args := append(aptGetRemoveArgs, pkgs...)
 	cmdModifiers := []cmdModifier{
 		func(cmd *exec.Cmd) {
-			cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+			cmd.Env = commandEnvWith(ctx, "DEBIAN_FRONTEND=noninteractive")
 		},
 	}
 	stdout, stderr, err := runAptGet(ctx, args, cmdModifiers)
@@ -272,9 +316,9 @@ func RemoveAptPackages(ctx context.Context, pkgs []string) error {
 		}
 	}
 	if err != nil {
-		err = fmt.Errorf("error running %s with args %q: %v, stdout: %q, stderr: %q", aptGet, args, err, stdout, stderr)
+		return newCmdError(aptGet, args, stdout, stderr, err)
 	}
-	return err
+	return nil
 }
 
 func parseAptUpdates(ctx context.Context, data []byte, showNew bool) []*PkgInfo {
@@ -315,7 +359,12 @@ func parseAptUpdates(ctx context.Context, data []byte, showNew bool) []*PkgInfo
 		}
 		ver := bytes.Trim(pkg[1], "(")             // (246.0.0-0 => 246.0.0-0
 		arch := bytes.Trim(pkg[len(pkg)-1], "[])") // [all]) => all
-		pkgs = append(pkgs, &PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(arch)), Version: string(ver)})
+		// Ubuntu:18.04/bionic-updates, Ubuntu:18.04/bionic-security => Ubuntu:18.04/bionic-updates
+		var repo string
+		if len(pkg) > 3 {
+			repo = string(bytes.TrimSuffix(pkg[2], []byte(",")))
+		}
+		pkgs = append(pkgs, &PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(arch)), Version: string(ver), Epoch: epochOf(string(ver)), Repository: repo})
 	}
 	return pkgs
 }
@@ -351,21 +400,106 @@ func AptUpdates(ctx context.Context, opts ...AptGetUpgradeOption) ([]*PkgInfo, e
 
 	out, _, err := runAptGetWithDowngradeRetrial(ctx, args, []cmdModifier{
 		func(cmd *exec.Cmd) {
-			cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+			cmd.Env = commandEnvWith(ctx, "DEBIAN_FRONTEND=noninteractive")
 		},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return parseAptUpdates(ctx, out, aptOpts.showNew), nil
+	pkgs := parseAptUpdates(ctx, out, aptOpts.showNew)
+	if aptOpts.candidatePolicy && len(pkgs) > 0 {
+		// The policy only adds details to the updates, don't fail if we can't get it.
+		if err := addAptCandidatePolicy(ctx, pkgs); err != nil {
+			clog.Warningf(ctx, "Error getting apt-cache policy for updates: %v", err)
+		}
+	}
+	return pkgs, nil
+}
+
+func addAptCandidatePolicy(ctx context.Context, pkgs []*PkgInfo) error {
+	args := append([]string{}, aptCachePolicyArgs...)
+	for _, pkg := range pkgs {
+		args = append(args, pkg.Name)
+	}
+	out, err := run(ctx, aptCache, args)
+	if err != nil {
+		return err
+	}
+
+	policies := parseAptCachePolicy(out)
+	for _, pkg := range pkgs {
+		if c, ok := policies[pkg.Name]; ok && c.version == pkg.Version {
+			pkg.AptCandidate = c.AptCandidate
+		}
+	}
+	return nil
+}
+
+type aptCachePolicy struct {
+	version string
+	*AptCandidate
+}
+
+func parseAptCachePolicy(data []byte) map[string]aptCachePolicy {
+	/*
+		libldap-common:
+		  Installed: 2.4.45+dfsg-1ubuntu1.2
+		  Candidate: 2.4.45+dfsg-1ubuntu1.3
+		  Version table:
+		     2.4.45+dfsg-1ubuntu1.3 500 (phased 10%)
+		        500 http://archive.ubuntu.com/ubuntu bionic-updates/main amd64 Packages
+		        500 http://security.ubuntu.com/ubuntu bionic-security/main amd64 Packages
+		 *** 2.4.45+dfsg-1ubuntu1.2 100
+		        100 /var/lib/dpkg/status
+	*/
+	policies := map[string]aptCachePolicy{}
+
+	var name, candidate string
+	var current *AptCandidate
+	for _, ln := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(ln)
+		if len(fields) == 0 {
+			continue
+		}
+		indent := len(ln) - len(strings.TrimLeft(ln, " "))
+
+		switch {
+		case indent == 0 && strings.HasSuffix(ln, ":"):
+			name, candidate, current = strings.TrimSuffix(ln, ":"), "", nil
+		case name == "":
+			continue
+		case fields[0] == "Candidate:" && len(fields) == 2:
+			candidate = fields[1]
+		case fields[0] == "***" || (indent > 2 && indent < 8):
+			// A version line, only the candidate version is of interest.
+			current = nil
+			if fields[0] == "***" {
+				fields = fields[1:]
+			}
+			if len(fields) < 2 || fields[0] != candidate {
+				continue
+			}
+			current = &AptCandidate{}
+			current.Priority, _ = strconv.Atoi(fields[1])
+			if len(fields) >= 4 && fields[2] == "(phased" {
+				current.Phased = true
+				current.PhasedPercentage, _ = strconv.Atoi(strings.TrimSuffix(fields[3], "%)"))
+			}
+			policies[name] = aptCachePolicy{version: candidate, AptCandidate: current}
+		case current != nil && indent >= 8 && len(fields) >= 3:
+			// A source line: priority, URI and suite/component.
+			current.Origins = append(current.Origins, fields[1]+" "+fields[2])
+		}
+	}
+	return policies
 }
 
 // AptUpdate runs apt-get update.
 func AptUpdate(ctx context.Context) ([]byte, error) {
 	stdout, _, err := runAptGet(ctx, aptGetUpdateArgs, []cmdModifier{
 		func(cmd *exec.Cmd) {
-			cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+			cmd.Env = commandEnvWith(ctx, "DEBIAN_FRONTEND=noninteractive")
 		},
 	})
 	return stdout, err
@@ -421,6 +555,7 @@ func pkgInfoFromDpkgInfo(dpkg dpkgInfo) *PkgInfo {
 		Name:    dpkg.Package,
 		Arch:    osinfo.Architecture(dpkg.Architecture),
 		Version: dpkg.Version,
+		Epoch:   epochOf(dpkg.Version),
 		Source: Source{
 			Name:    dpkg.SourceName,
 			Version: dpkg.SourceVersion,
@@ -120,9 +120,14 @@ func TestInstallAptPackages(t *testing.T) {
 					err:    errors.New("unexpected error"),
 				},
 			},
-			expectedError: errors.New("error running /usr/bin/apt-get with args" +
-				" [\"install\" \"-y\" \"pkg1\" \"pkg2\"]:" +
-				" unexpected error, stdout: \"stdout\", stderr: \"stderr\""),
+			expectedError: &CmdError{
+				Cmd:      aptGet,
+				Args:     []string{"install", "-y", "pkg1", "pkg2"},
+				ExitCode: -1,
+				Stdout:   []byte("stdout"),
+				Stderr:   []byte("stderr"),
+				Err:      errors.New("unexpected error"),
+			},
 		},
 		{
 			name: "throw an error if any at the end",
@@ -151,9 +156,14 @@ func TestInstallAptPackages(t *testing.T) {
 					err:    errors.New("unexpected error"),
 				},
 			},
-			expectedError: errors.New("error running /usr/bin/apt-get with args" +
-				" [\"install\" \"-y\" \"pkg1\" \"pkg2\"]:" +
-				" unexpected error, stdout: \"stdout\", stderr: \"stderr\""),
+			expectedError: &CmdError{
+				Cmd:      aptGet,
+				Args:     []string{"install", "-y", "pkg1", "pkg2"},
+				ExitCode: -1,
+				Stdout:   []byte("stdout"),
+				Stderr:   []byte("stderr"),
+				Err:      errors.New("unexpected error"),
+			},
 		},
 	}
 
@@ -246,7 +256,7 @@ func TestAptUpdates(t *testing.T) {
 					err:    nil,
 				},
 			},
-			expectedResult: []*PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}},
+			expectedResult: []*PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"}},
 			expectedError:  nil,
 		},
 		{
@@ -268,7 +278,7 @@ func TestAptUpdates(t *testing.T) {
 					err:    nil,
 				},
 			},
-			expectedResult: []*PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}},
+			expectedResult: []*PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"}},
 			expectedError:  nil,
 		},
 		{
@@ -290,7 +300,7 @@ func TestAptUpdates(t *testing.T) {
 					err:    nil,
 				},
 			},
-			expectedResult: []*PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}},
+			expectedResult: []*PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"}},
 			expectedError:  nil,
 		},
 		{
@@ -315,8 +325,8 @@ func TestAptUpdates(t *testing.T) {
 				},
 			},
 			expectedResult: []*PkgInfo{
-				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"},
-				{Name: "firmware-linux-free", Arch: "all", Version: "3.4"},
+				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"},
+				{Name: "firmware-linux-free", Arch: "all", Version: "3.4", Repository: "Debian:9.9/stable"},
 			},
 			expectedError: nil,
 		},
@@ -342,7 +352,7 @@ func TestAptUpdates(t *testing.T) {
 				},
 			},
 			expectedResult: []*PkgInfo{
-				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"},
+				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"},
 			},
 			expectedError: nil,
 		},
@@ -373,7 +383,45 @@ func TestAptUpdates(t *testing.T) {
 				},
 			},
 			expectedResult: []*PkgInfo{
-				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"},
+				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Candidate policy",
+			args: []AptGetUpgradeOption{AptGetUpgradeCandidatePolicy(true)},
+			expectedCommandsChain: []expectedCommand{
+				{
+					cmd:    exec.Command(aptGet, aptGetUpdateArgs...),
+					envs:   []string{"DEBIAN_FRONTEND=noninteractive"},
+					stdout: []byte("stdout"),
+					stderr: []byte(""),
+					err:    nil,
+				},
+				{
+					cmd:    exec.Command(aptGet, append(slices.Clone(aptGetUpgradableArgs), aptGetUpgradeCmd)...),
+					envs:   []string{"DEBIAN_FRONTEND=noninteractive"},
+					stdout: []byte("Inst libldap-common [2.4.45+dfsg-1ubuntu1.2] (2.4.45+dfsg-1ubuntu1.3 Ubuntu:18.04/bionic-updates, Ubuntu:18.04/bionic-security [all])"),
+					stderr: []byte(""),
+					err:    nil,
+				},
+				{
+					cmd:    exec.Command(aptCache, append(slices.Clone(aptCachePolicyArgs), "libldap-common")...),
+					stdout: []byte(testAptCachePolicy),
+					stderr: []byte(""),
+					err:    nil,
+				},
+			},
+			expectedResult: []*PkgInfo{
+				{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3", Repository: "Ubuntu:18.04/bionic-updates", AptCandidate: &AptCandidate{
+					Origins: []string{
+						"http://archive.ubuntu.com/ubuntu bionic-updates/main",
+						"http://security.ubuntu.com/ubuntu bionic-security/main",
+					},
+					Priority:         500,
+					Phased:           true,
+					PhasedPercentage: 10,
+				}},
 			},
 			expectedError: nil,
 		},
@@ -463,9 +511,14 @@ func TestRemoveAptPackages(t *testing.T) {
 					err:    errors.New("unexpected error"),
 				},
 			},
-			expectedError: errors.New("error running /usr/bin/apt-get with args" +
-				" [\"remove\" \"-y\" \"pkg1\" \"pkg2\"]:" +
-				" unexpected error, stdout: \"stdout\", stderr: \"stderr\""),
+			expectedError: &CmdError{
+				Cmd:      aptGet,
+				Args:     []string{"remove", "-y", "pkg1", "pkg2"},
+				ExitCode: -1,
+				Stdout:   []byte("stdout"),
+				Stderr:   []byte("stderr"),
+				Err:      errors.New("unexpected error"),
+			},
 		},
 		{
 			name: "throw an error if any at the end",
@@ -494,9 +547,14 @@ func TestRemoveAptPackages(t *testing.T) {
 					err:    errors.New("unexpected error"),
 				},
 			},
-			expectedError: errors.New("error running /usr/bin/apt-get with args" +
-				" [\"remove\" \"-y\" \"pkg1\" \"pkg2\"]:" +
-				" unexpected error, stdout: \"stdout\", stderr: \"stderr\""),
+			expectedError: &CmdError{
+				Cmd:      aptGet,
+				Args:     []string{"remove", "-y", "pkg1", "pkg2"},
+				ExitCode: -1,
+				Stdout:   []byte("stdout"),
+				Stderr:   []byte("stderr"),
+				Err:      errors.New("unexpected error"),
+			},
 		},
 	}
 	for _, tt := range tests {
@@ -535,7 +593,7 @@ func TestInstalledDebPackages(t *testing.T) {
 		t.Errorf("InstalledDebPackages(): got unexpected error: %v", err)
 	}
 
-	want := []*PkgInfo{{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1ubuntu3.12", Source: Source{Name: "git", Version: "1:2.25.1-1ubuntu3.12"}}}
+	want := []*PkgInfo{{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1ubuntu3.12", Epoch: "1", Source: Source{Name: "git", Version: "1:2.25.1-1ubuntu3.12"}}}
 	if !reflect.DeepEqual(result, want) {
 		t.Errorf("InstalledDebPackages() = %v, want %v", result, want)
 	}
@@ -590,6 +648,49 @@ func TestParseInstalledDebpackages(t *testing.T) {
 	}
 }
 
+const testAptCachePolicy = `libldap-common:
+  Installed: 2.4.45+dfsg-1ubuntu1.2
+  Candidate: 2.4.45+dfsg-1ubuntu1.3
+  Version table:
+     2.4.45+dfsg-1ubuntu1.3 500 (phased 10%)
+        500 http://archive.ubuntu.com/ubuntu bionic-updates/main amd64 Packages
+        500 http://security.ubuntu.com/ubuntu bionic-security/main amd64 Packages
+ *** 2.4.45+dfsg-1ubuntu1.2 100
+        100 /var/lib/dpkg/status
+google-cloud-sdk:
+  Installed: 245.0.0-0
+  Candidate: 246.0.0-0
+  Version table:
+     246.0.0-0 990
+        990 http://packages.cloud.google.com/apt cloud-sdk-stretch/main amd64 Packages
+ *** 245.0.0-0 100
+        100 /var/lib/dpkg/status
+`
+
+func TestParseAptCachePolicy(t *testing.T) {
+	want := map[string]aptCachePolicy{
+		"libldap-common": {version: "2.4.45+dfsg-1ubuntu1.3", AptCandidate: &AptCandidate{
+			Origins: []string{
+				"http://archive.ubuntu.com/ubuntu bionic-updates/main",
+				"http://security.ubuntu.com/ubuntu bionic-security/main",
+			},
+			Priority:         500,
+			Phased:           true,
+			PhasedPercentage: 10,
+		}},
+		"google-cloud-sdk": {version: "246.0.0-0", AptCandidate: &AptCandidate{
+			Origins:  []string{"http://packages.cloud.google.com/apt cloud-sdk-stretch/main"},
+			Priority: 990,
+		}},
+	}
+	if got := parseAptCachePolicy([]byte(testAptCachePolicy)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAptCachePolicy() = %+v, want %+v", got, want)
+	}
+	if got := parseAptCachePolicy(nil); len(got) != 0 {
+		t.Errorf("parseAptCachePolicy(nil) = %+v, want empty", got)
+	}
+}
+
 func TestParseAptUpdates(t *testing.T) {
 	normalCase := `
 Inst libldap-common [2.4.45+dfsg-1ubuntu1.2] (2.4.45+dfsg-1ubuntu1.3 Ubuntu:18.04/bionic-updates, Ubuntu:18.04/bionic-security [all])
@@ -609,8 +710,8 @@ Conf firmware-linux-free (3.4 Debian:9.9/stable [all])
 			input:   []byte(normalCase),
 			showNew: false,
 			want: []*PkgInfo{
-				{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3"},
-				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"},
+				{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3", Repository: "Ubuntu:18.04/bionic-updates"},
+				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"},
 			},
 		},
 		{
@@ -618,9 +719,9 @@ Conf firmware-linux-free (3.4 Debian:9.9/stable [all])
 			input:   []byte(normalCase),
 			showNew: true,
 			want: []*PkgInfo{
-				{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3"},
-				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"},
-				{Name: "firmware-linux-free", Arch: "all", Version: "3.4"},
+				{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3", Repository: "Ubuntu:18.04/bionic-updates"},
+				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"},
+				{Name: "firmware-linux-free", Arch: "all", Version: "3.4", Repository: "Debian:9.9/stable"},
 			},
 		},
 		{
@@ -640,7 +741,7 @@ Conf firmware-linux-free (3.4 Debian:9.9/stable [all])
 			input:   []byte("Inst something [we dont understand\n Inst google-cloud-sdk [245.0.0-0] (246.0.0-0 cloud-sdk-stretch:cloud-sdk-stretch [amd64])"),
 			showNew: false,
 			want: []*PkgInfo{
-				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"},
+				{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0", Repository: "cloud-sdk-stretch:cloud-sdk-stretch"},
 			},
 		},
 	}
@@ -687,7 +788,7 @@ func TestDebPkgInfo(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := &PkgInfo{Name: "google-guest-agent", Arch: "x86_64", Version: "1:1dummy-g1"}
+	want := &PkgInfo{Name: "google-guest-agent", Arch: "x86_64", Version: "1:1dummy-g1", Epoch: "1"}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("DebPkgInfo() = %+v, want %+v", ret, want)
 	}
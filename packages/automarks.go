@@ -0,0 +1,153 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+var (
+	aptMarkShowAutoArgs = []string{"showauto"}
+	aptMarkAutoArgs     = []string{"auto"}
+	// dnf records why a package was installed, yum 3 has no repoquery
+	// subcommand so this fails there.
+	yumReasonArgs   = []string{"repoquery", "--installed", "--quiet", "--queryformat", "%{name} %{reason}"}
+	yumMarkAutoArgs = []string{"mark", "remove"}
+)
+
+// AptAutoInstalled returns the names of the deb packages apt marked as
+// automatically installed.
+func AptAutoInstalled(ctx context.Context) (map[string]bool, error) {
+	out, err := run(ctx, aptMark, aptMarkShowAutoArgs)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, name := range strings.Fields(string(out)) {
+		// Packages of a foreign architecture are listed as name:arch.
+		names[strings.SplitN(name, ":", 2)[0]] = true
+	}
+	return names, nil
+}
+
+// AptMarkAuto marks deb packages as automatically installed.
+func AptMarkAuto(ctx context.Context, pkgs []string) error {
+	_, err := run(ctx, aptMark, append(append([]string{}, aptMarkAutoArgs...), pkgs...))
+	return err
+}
+
+func parseYumReasons(data []byte) map[string]bool {
+	/*
+		bash user
+		glibc dependency
+		libgomp weak-dependency
+		kernel unknown
+	*/
+	names := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[1] == "dependency" || fields[1] == "weak-dependency" {
+			names[fields[0]] = true
+		}
+	}
+	return names
+}
+
+// YumAutoInstalled returns the names of the rpm packages dnf installed as a
+// dependency. It fails on yum 3, which does not record the reason the same
+// way.
+func YumAutoInstalled(ctx context.Context) (map[string]bool, error) {
+	out, err := run(ctx, yum, yumReasonArgs)
+	if err != nil {
+		return nil, err
+	}
+	return parseYumReasons(out), nil
+}
+
+// YumMarkAuto marks rpm packages as installed as a dependency.
+func YumMarkAuto(ctx context.Context, pkgs []string) error {
+	_, err := run(ctx, yum, append(append([]string{}, yumMarkAutoArgs...), pkgs...))
+	return err
+}
+
+func setAutoInstalled(pkgs []*PkgInfo, auto map[string]bool) {
+	for _, p := range pkgs {
+		p.AutoInstalled = auto[p.Name]
+	}
+}
+
+// markAutoInstalled sets AutoInstalled on the deb and rpm packages. The
+// markers are best effort, failing to read them is only logged.
+func markAutoInstalled(ctx context.Context, pkgs *Packages) {
+	if len(pkgs.Deb) > 0 && AptExists {
+		if auto, err := AptAutoInstalled(ctx); err != nil {
+			clog.Debugf(ctx, "Error reading apt auto installed markers: %v", err)
+		} else {
+			setAutoInstalled(pkgs.Deb, auto)
+		}
+	}
+	if len(pkgs.Rpm) > 0 && YumExists {
+		if auto, err := YumAutoInstalled(ctx); err != nil {
+			clog.Debugf(ctx, "Error reading dnf install reasons: %v", err)
+		} else {
+			setAutoInstalled(pkgs.Rpm, auto)
+		}
+	}
+}
+
+// UnusedPackages returns the names of the automatically installed packages
+// that no package installed by request depends on, directly or through
+// other packages, sorted. These are what autoremove would remove, so it
+// relies on the AutoInstalled markers being accurate.
+func UnusedPackages(g *DepGraph, installed []*PkgInfo) []string {
+	auto := map[string]bool{}
+	var roots []string
+	for _, p := range installed {
+		if p.AutoInstalled {
+			auto[p.Name] = true
+		} else {
+			roots = append(roots, p.Name)
+		}
+	}
+
+	used := map[string]bool{}
+	for len(roots) > 0 {
+		name := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+		for _, dep := range g.Dependencies(name) {
+			if !used[dep] {
+				used[dep] = true
+				roots = append(roots, dep)
+			}
+		}
+	}
+
+	unused := map[string]bool{}
+	for name := range auto {
+		if !used[name] {
+			unused[name] = true
+		}
+	}
+	return sortedKeys(unused)
+}
@@ -0,0 +1,72 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAptAutoInstalled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(exec.Command(aptMark, "showauto"))).Return([]byte("libc6\nlibssl3:i386\n"), nil, nil).Times(1)
+
+	got, err := AptAutoInstalled(testCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]bool{"libc6": true, "libssl3": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AptAutoInstalled() = %v, want %v", got, want)
+	}
+}
+
+func TestParseYumReasons(t *testing.T) {
+	data := []byte("bash user\nglibc dependency\nlibgomp weak-dependency\nkernel unknown\ngarbage\n")
+	want := map[string]bool{"glibc": true, "libgomp": true}
+	if got := parseYumReasons(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYumReasons() = %v, want %v", got, want)
+	}
+}
+
+func TestUnusedPackages(t *testing.T) {
+	g := newDepGraph()
+	g.addDependency("nginx", "libssl")
+	g.addDependency("libssl", "libc")
+	g.addDependency("oldtool", "libold")
+	g.addPackage("leftover")
+
+	installed := []*PkgInfo{
+		{Name: "nginx"},
+		{Name: "libssl", AutoInstalled: true},
+		{Name: "libc", AutoInstalled: true},
+		{Name: "libold", AutoInstalled: true},
+		{Name: "oldtool", AutoInstalled: true},
+		{Name: "leftover", AutoInstalled: true},
+	}
+	// libold is only used by oldtool, which is unused itself.
+	want := []string{"leftover", "libold", "oldtool"}
+	if got := UnusedPackages(g, installed); !reflect.DeepEqual(got, want) {
+		t.Errorf("UnusedPackages() = %q, want %q", got, want)
+	}
+}
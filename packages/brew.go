@@ -0,0 +1,190 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+var (
+	brew string
+
+	// brewPaths are the default install locations of brew, in order of
+	// preference: Apple silicon, Intel macOS and Linuxbrew.
+	brewPaths = []string{"/opt/homebrew/bin/brew", "/usr/local/bin/brew", "/home/linuxbrew/.linuxbrew/bin/brew"}
+
+	brewListArgs        = []string{"list", "--versions"}
+	brewOutdatedArgs    = []string{"outdated", "--json=v2"}
+	brewListTimeout     = 30 * time.Second
+	brewOutdatedTimeout = 30 * time.Second
+
+	geteuid   = os.Geteuid
+	brewOwner = fileOwner
+
+	// errBrewRoot is returned when brew would have to run as root, which it
+	// refuses to.
+	errBrewRoot = errors.New("brew is installed as root and refuses to run as root")
+)
+
+func init() {
+	if runtime.GOOS != "windows" {
+		for _, p := range brewPaths {
+			if util.Exists(p) {
+				brew = p
+				break
+			}
+		}
+	}
+	BrewExists = util.Exists(brew)
+}
+
+// brewCommand returns the command running brew with args. brew refuses to
+// run as root, so an agent running as root runs it as the owner of the
+// brew installation, errBrewRoot if that is root too. brew does not update
+// itself over the network first.
+func brewCommand(ctx context.Context, args []string) (*exec.Cmd, error) {
+	cmd := commandContext(ctx, brew, args...)
+	env := []string{"HOMEBREW_NO_AUTO_UPDATE=1"}
+	if geteuid() == 0 {
+		u, err := brewOwner(brew)
+		if err != nil {
+			return nil, err
+		}
+		if u.Uid == "0" {
+			return nil, errBrewRoot
+		}
+		if err := runAs(cmd, u); err != nil {
+			return nil, err
+		}
+		env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+	cmd.Env = commandEnvWith(ctx, env...)
+	return cmd, nil
+}
+
+// runBrew runs brew with args, see brewCommand. It returns errBrewRoot
+// without running it if brew can only run as root.
+func runBrew(ctx context.Context, timeout time.Duration, args []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd, err := brewCommand(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, err := runnerFor(ManagerBrew).Run(ctx, cmd)
+	if err != nil {
+		return nil, newCmdError(brew, args, stdout, stderr, err)
+	}
+	return stdout, nil
+}
+
+// InstalledBrewPackages queries for all installed Homebrew formulae and
+// casks. It returns none if brew could only run as root.
+func InstalledBrewPackages(ctx context.Context) ([]*PkgInfo, error) {
+	stdout, err := runBrew(ctx, brewListTimeout, brewListArgs)
+	if err == errBrewRoot {
+		clog.Debugf(ctx, "Not listing brew packages: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseInstalledBrewPackages(ctx, stdout), nil
+}
+
+func parseInstalledBrewPackages(ctx context.Context, data []byte) []*PkgInfo {
+	/*
+	   foo 1.2.3
+	   bar 2.0 2.1_1
+	   ...
+	*/
+	var pkgs []*PkgInfo
+	for _, ln := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		pkg := strings.Fields(ln)
+		if len(pkg) < 2 {
+			clog.Debugf(ctx, "%q does not represent a brew package", ln)
+			continue
+		}
+		// Multiple versions of a formula can be installed side by side.
+		for _, ver := range pkg[1:] {
+			pkgs = append(pkgs, &PkgInfo{Name: pkg[0], Arch: noarch, Version: ver})
+		}
+	}
+	return pkgs
+}
+
+type brewOutdatedEntry struct {
+	Name              string   `json:"name"`
+	InstalledVersions []string `json:"installed_versions"`
+	CurrentVersion    string   `json:"current_version"`
+	Pinned            bool     `json:"pinned"`
+}
+
+type brewOutdated struct {
+	Formulae []brewOutdatedEntry `json:"formulae"`
+	Casks    []brewOutdatedEntry `json:"casks"`
+}
+
+// BrewUpdates queries for all available Homebrew formula and cask updates,
+// as of the last brew update. Pinned formulae are not reported as they are
+// not upgraded by brew upgrade. It returns none if brew could only run as
+// root.
+func BrewUpdates(ctx context.Context) ([]*PkgInfo, error) {
+	stdout, err := runBrew(ctx, brewOutdatedTimeout, brewOutdatedArgs)
+	if err == errBrewRoot {
+		clog.Debugf(ctx, "Not listing brew updates: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseBrewUpdates(stdout)
+}
+
+func parseBrewUpdates(data []byte) ([]*PkgInfo, error) {
+	/*
+	   {
+	     "formulae": [
+	       {"name": "foo", "installed_versions": ["1.2.3"], "current_version": "1.2.4", "pinned": false, "pinned_version": null}
+	     ],
+	     "casks": [
+	       {"name": "bar", "installed_versions": ["2.0"], "current_version": "2.1"}
+	     ]
+	   }
+	*/
+	var outdated brewOutdated
+	if err := json.Unmarshal(data, &outdated); err != nil {
+		return nil, err
+	}
+
+	var pkgs []*PkgInfo
+	for _, e := range append(outdated.Formulae, outdated.Casks...) {
+		if e.Pinned {
+			continue
+		}
+		pkgs = append(pkgs, &PkgInfo{Name: e.Name, Arch: noarch, Version: e.CurrentVersion})
+	}
+	return pkgs, nil
+}
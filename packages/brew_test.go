@@ -0,0 +1,97 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func TestParseInstalledBrewPackages(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []*PkgInfo
+	}{
+		{"NormalCase", []byte("foo 1.2.3\nbar 2.0 2.1_1\n"), []*PkgInfo{{Name: "foo", Arch: "all", Version: "1.2.3"}, {Name: "bar", Arch: "all", Version: "2.0"}, {Name: "bar", Arch: "all", Version: "2.1_1"}}},
+		{"NoVersion", []byte("foo\nbar 1.0"), []*PkgInfo{{Name: "bar", Arch: "all", Version: "1.0"}}},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseInstalledBrewPackages(testCtx, tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInstalledBrewPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBrewUpdates(t *testing.T) {
+	data := []byte(`{
+  "formulae": [
+    {"name": "foo", "installed_versions": ["1.2.3"], "current_version": "1.2.4", "pinned": false, "pinned_version": null},
+    {"name": "pinned", "installed_versions": ["1.0"], "current_version": "2.0", "pinned": true, "pinned_version": "1.0"}
+  ],
+  "casks": [
+    {"name": "bar", "installed_versions": ["2.0"], "current_version": "2.1"}
+  ]
+}`)
+	want := []*PkgInfo{{Name: "foo", Arch: "all", Version: "1.2.4"}, {Name: "bar", Arch: "all", Version: "2.1"}}
+	got, err := parseBrewUpdates(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBrewUpdates() = %v, want %v", got, want)
+	}
+
+	if _, err := parseBrewUpdates([]byte("Error: not json")); err == nil {
+		t.Error("did not get expected error for invalid output")
+	}
+}
+
+func TestInstalledBrewPackages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	defer func() { geteuid = os.Geteuid }()
+	geteuid = func() int { return 501 }
+	cmd := exec.Command(brew, brewListArgs...)
+	cmd.Env = commandEnvWith(testCtx, "HOMEBREW_NO_AUTO_UPDATE=1")
+	expectedCmd := utilmocks.EqCmd(cmd)
+
+	mockCommandRunner.EXPECT().Run(gomock.Any(), expectedCmd).Return([]byte("foo 1.2.3"), []byte("stderr"), nil).Times(1)
+	ret, err := InstalledBrewPackages(testCtx)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := []*PkgInfo{{Name: "foo", Arch: "all", Version: "1.2.3"}}
+	if !reflect.DeepEqual(ret, want) {
+		t.Errorf("InstalledBrewPackages() = %v, want %v", ret, want)
+	}
+
+	mockCommandRunner.EXPECT().Run(gomock.Any(), expectedCmd).Return([]byte("stdout"), []byte("stderr"), errors.New("bad error")).Times(1)
+	if _, err := InstalledBrewPackages(testCtx); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
@@ -0,0 +1,66 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package packages
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"reflect"
+	"syscall"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func TestBrewAsRoot(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	defer func() { geteuid, brewOwner = os.Geteuid, fileOwner }()
+	geteuid = func() int { return 0 }
+	owner := &user.User{Uid: "501", Gid: "20", Username: "dev", HomeDir: "/Users/dev"}
+	brewOwner = func(string) (*user.User, error) { return owner, nil }
+
+	// Run as the owner of the installation.
+	var got *exec.Cmd
+	mockCommandRunner.EXPECT().Run(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, cmd *exec.Cmd) ([]byte, []byte, error) {
+		got = cmd
+		return []byte(`{"formulae": [], "casks": []}`), nil, nil
+	}).Times(1)
+	if _, err := BrewUpdates(testCtx); err != nil {
+		t.Fatalf("BrewUpdates: %v", err)
+	}
+	if got.SysProcAttr == nil || !reflect.DeepEqual(got.SysProcAttr.Credential, &syscall.Credential{Uid: 501, Gid: 20}) {
+		t.Errorf("brew ran with %+v, want the credential of the owner", got.SysProcAttr)
+	}
+	want := commandEnvWith(testCtx, "HOMEBREW_NO_AUTO_UPDATE=1", "HOME=/Users/dev", "USER=dev", "LOGNAME=dev")
+	if !reflect.DeepEqual(got.Env, want) {
+		t.Errorf("brew ran with env %q, want %q", got.Env, want)
+	}
+
+	// brew refuses to run as root, an installation owned by root is skipped.
+	owner = &user.User{Uid: "0", Gid: "0", Username: "root", HomeDir: "/root"}
+	pkgs, err := InstalledBrewPackages(testCtx)
+	if err != nil || pkgs != nil {
+		t.Errorf("InstalledBrewPackages() = %v, %v, want nothing", pkgs, err)
+	}
+}
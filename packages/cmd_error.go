@@ -0,0 +1,211 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrorClass classifies why a package manager command failed.
+type ErrorClass int
+
+const (
+	// ErrorUnknown is a failure that could not be classified.
+	ErrorUnknown ErrorClass = iota
+	// ErrorTransient is a failure that is likely to succeed on retry, like a
+	// network error or a timeout.
+	ErrorTransient
+	// ErrorLockContention is a failure caused by another process holding the
+	// package manager lock.
+	ErrorLockContention
+	// ErrorNotFound is a failure caused by a missing package or binary.
+	ErrorNotFound
+	// ErrorPermission is a failure caused by missing privileges.
+	ErrorPermission
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorTransient:
+		return "transient"
+	case ErrorLockContention:
+		return "lock-contention"
+	case ErrorNotFound:
+		return "not-found"
+	case ErrorPermission:
+		return "permission"
+	}
+	return "unknown"
+}
+
+// Output snippets, matched case insensitively against stderr and stdout, used
+// to classify command failures.
+var (
+	lockContentionOutput = []string{
+		"could not get lock",                            // apt
+		"unable to acquire the dpkg frontend lock",      // apt
+		"dpkg status database is locked",                // dpkg
+		"existing lock /var/run/yum.pid",                // yum
+		"waiting for process with pid",                  // dnf
+		"system management is locked",                   // zypper
+		"can't create transaction lock",                 // rpm
+		"another instance of googet is already running", // googet
+	}
+	notFoundOutput = []string{
+		"unable to locate package",      // apt
+		"has no installation candidate", // apt
+		"no package ",                   // yum
+		"no match for argument",         // dnf
+		"not found in package names",    // zypper
+		"is not installed",              // rpm, dpkg
+		"no packages found matching",    // dpkg-query
+		"unable to find package",        // googet
+	}
+	permissionOutput = []string{
+		"permission denied",
+		"are you root?",
+		"you need to be root",
+		"root privileges",
+		"access is denied",
+	}
+	transientOutput = []string{
+		"temporary failure resolving",
+		"could not resolve",
+		"failed to fetch",
+		"connection timed out",
+		"connection refused",
+		"cannot retrieve repository metadata",
+		"curl error",
+		"download failed",
+		"i/o timeout",
+	}
+)
+
+// CmdError is returned when a package manager command fails.
+type CmdError struct {
+	// Cmd and Args are the command that was run.
+	Cmd  string
+	Args []string
+	// ExitCode is the exit code of the command, -1 if it did not exit.
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+	// Class is the classification of the failure.
+	Class ErrorClass
+	// Err is the error returned by the command runner.
+	Err error
+}
+
+func (e *CmdError) Error() string {
+	return fmt.Sprintf("error running %s with args %q: %v, stdout: %q, stderr: %q", e.Cmd, e.Args, e.Err, e.Stdout, e.Stderr)
+}
+
+func (e *CmdError) Unwrap() error {
+	return e.Err
+}
+
+// newCmdError creates a classified CmdError for a failed command.
+func newCmdError(cmd string, args []string, stdout, stderr []byte, err error) *CmdError {
+	e := &CmdError{Cmd: cmd, Args: args, ExitCode: -1, Stdout: stdout, Stderr: stderr, Err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+	e.Class = classify(e)
+	return e
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func classify(e *CmdError) ErrorClass {
+	switch {
+	case errors.Is(e.Err, context.DeadlineExceeded):
+		return ErrorTransient
+	case errors.Is(e.Err, exec.ErrNotFound), errors.Is(e.Err, os.ErrNotExist):
+		return ErrorNotFound
+	case errors.Is(e.Err, os.ErrPermission):
+		return ErrorPermission
+	}
+
+	out := strings.ToLower(string(e.Stderr) + "\n" + string(e.Stdout))
+	switch {
+	// Lock contention is checked first as the messages often also mention
+	// permissions, e.g. "Could not get lock ... (13: Permission denied)" is
+	// reported when not running as root, while "(11: Resource temporarily
+	// unavailable)" means another process holds the lock.
+	case containsAny(out, lockContentionOutput) && !strings.Contains(out, "permission denied"):
+		return ErrorLockContention
+	case containsAny(out, permissionOutput):
+		return ErrorPermission
+	case containsAny(out, notFoundOutput):
+		return ErrorNotFound
+	case containsAny(out, transientOutput):
+		return ErrorTransient
+	}
+
+	switch e.ExitCode {
+	case 126:
+		return ErrorPermission
+	case 127:
+		return ErrorNotFound
+	}
+	return ErrorUnknown
+}
+
+// ErrorClassOf returns the classification of a package command error, or
+// ErrorUnknown if err is not, and does not wrap, a CmdError.
+func ErrorClassOf(err error) ErrorClass {
+	var e *CmdError
+	if errors.As(err, &e) {
+		return e.Class
+	}
+	return ErrorUnknown
+}
+
+// IsTransient reports whether err is a package command failure that is
+// likely to succeed on retry.
+func IsTransient(err error) bool {
+	return ErrorClassOf(err) == ErrorTransient
+}
+
+// IsLockContention reports whether err is a package command failure caused by
+// another process holding the package manager lock.
+func IsLockContention(err error) bool {
+	return ErrorClassOf(err) == ErrorLockContention
+}
+
+// IsNotFound reports whether err is a package command failure caused by a
+// missing package or binary.
+func IsNotFound(err error) bool {
+	return ErrorClassOf(err) == ErrorNotFound
+}
+
+// IsPermission reports whether err is a package command failure caused by
+// missing privileges.
+func IsPermission(err error) bool {
+	return ErrorClassOf(err) == ErrorPermission
+}
@@ -0,0 +1,80 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+func TestCmdErrorClassification(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		err    error
+		want   ErrorClass
+	}{
+		{"AptLock", "E: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 1234 (apt-get)", errors.New("exit status 100"), ErrorLockContention},
+		{"AptLockNotRoot", "E: Could not open lock file /var/lib/dpkg/lock-frontend - open (13: Permission denied)\nE: Unable to acquire the dpkg frontend lock, are you root?", errors.New("exit status 100"), ErrorPermission},
+		{"ZypperLock", "System management is locked by the application with pid 1234 (zypper).", errors.New("exit status 7"), ErrorLockContention},
+		{"AptNotFound", "E: Unable to locate package foo", errors.New("exit status 100"), ErrorNotFound},
+		{"DnfNotFound", "Error: Unable to find a match: foo\nNo match for argument: foo", errors.New("exit status 1"), ErrorNotFound},
+		{"AptFetch", "E: Failed to fetch http://deb.debian.org/debian/pool/main/f/foo.deb  Temporary failure resolving 'deb.debian.org'", errors.New("exit status 100"), ErrorTransient},
+		{"Deadline", "", context.DeadlineExceeded, ErrorTransient},
+		{"BinaryMissing", "", &exec.Error{Name: "yum", Err: exec.ErrNotFound}, ErrorNotFound},
+		{"Unknown", "something else went wrong", errors.New("exit status 1"), ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newCmdError("cmd", []string{"arg"}, nil, []byte(tt.stderr), tt.err)
+			if err.Class != tt.want {
+				t.Errorf("Class = %s, want %s", err.Class, tt.want)
+			}
+			// Classification must survive wrapping.
+			if got := ErrorClassOf(fmt.Errorf("wrapped: %w", err)); got != tt.want {
+				t.Errorf("ErrorClassOf(wrapped) = %s, want %s", got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is(err, %v) = false, want true", tt.err)
+			}
+		})
+	}
+
+	if ErrorClassOf(errors.New("foo")) != ErrorUnknown {
+		t.Errorf("ErrorClassOf of a non CmdError should be ErrorUnknown")
+	}
+}
+
+func TestRunReturnsCmdError(t *testing.T) {
+	defer func(r util.CommandRunner) { runner = r }(runner)
+	runner = &util.DefaultRunner{}
+
+	_, err := run(testCtx, "/does/not/exist", []string{"foo"})
+	var cmdErr *CmdError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("run() error %v is not a *CmdError", err)
+	}
+	if !IsNotFound(err) {
+		t.Errorf("IsNotFound(%v) = false, want true", err)
+	}
+	if cmdErr.ExitCode != -1 {
+		t.Errorf("ExitCode = %d, want -1", cmdErr.ExitCode)
+	}
+}
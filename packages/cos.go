@@ -14,13 +14,14 @@
 
 // Only build for linux but not on unsupported architectures.
 
-//go:build linux && (386 || amd64 || arm64)
+//go:build linux && (386 || amd64 || arm || arm64)
 // +build linux
-// +build 386 amd64 arm64
+// +build 386 amd64 arm arm64
 
 package packages
 
 import (
+	"context"
 	"fmt"
 
 	"cos.googlesource.com/cos/tools.git/src/pkg/cos"
@@ -31,12 +32,32 @@ func init() {
 	COSPkgInfoExists = cos.PackageInfoExists()
 }
 
-var readMachineArch = func() (string, error) {
-	oi, err := osinfo.Get()
+func readMachineArch() (string, error) {
+	oi, err := osinfo.Get(context.Background())
 	if err != nil {
 		return "", fmt.Errorf("error getting osinfo: %v", err)
 	}
-	return oi.Architecture, nil
+	return cosArchitecture(oi.Architecture), nil
+}
+
+// cosArchitectures maps the kernel reported machine architectures to the
+// naming used by cos-tools, which reports arm64 rather than aarch64 and arm
+// for all 32-bit ARM variants. Architectures not listed are used as is.
+var cosArchitectures = map[string]string{
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv6l":  "arm",
+	"armv7l":  "arm",
+	"armv8l":  "arm",
+	"armhf":   "arm",
+	"arm":     "arm",
+}
+
+func cosArchitecture(arch string) string {
+	if a, ok := cosArchitectures[arch]; ok {
+		return a
+	}
+	return arch
 }
 
 func parseInstalledCOSPackages(cosPkgInfo *cos.PackageInfo) ([]*PkgInfo, error) {
@@ -47,9 +68,13 @@ func parseInstalledCOSPackages(cosPkgInfo *cos.PackageInfo) ([]*PkgInfo, error)
 
 	var pkgs = make([]*PkgInfo, len(cosPkgInfo.InstalledPackages))
 	for i, pkg := range cosPkgInfo.InstalledPackages {
-		name := pkg.Category + "/" + pkg.Name
-		version := pkg.Version
-		pkgs[i] = &PkgInfo{Name: name, Arch: arch, Version: version}
+		pkgs[i] = &PkgInfo{
+			Name:          pkg.Category + "/" + pkg.Name,
+			Arch:          arch,
+			Version:       pkg.Version,
+			Category:      pkg.Category,
+			EbuildVersion: pkg.EbuildVersion,
+		}
 	}
 	return pkgs, nil
 }
@@ -12,13 +12,14 @@
 //  See the License for the specific language governing permissions and
 //  limitations under the License.
 
-//go:build linux && (386 || amd64)
+//go:build linux && (386 || amd64 || arm || arm64)
 // +build linux
-// +build 386 amd64
+// +build 386 amd64 arm arm64
 
 package packages
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -26,24 +27,26 @@ import (
 	"testing"
 
 	"cos.googlesource.com/cos/tools.git/src/pkg/cos"
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
 )
 
 func TestParseInstalledCOSPackages(t *testing.T) {
-	readMachineArch = func() (string, error) {
-		return "", errors.New("failed to obtain machine architecture")
-	}
+	defer osinfo.SetProvider(osinfo.SetProvider(nil))
+	osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+		return nil, errors.New("failed to obtain machine architecture")
+	}))
 	if _, err := parseInstalledCOSPackages(&cos.PackageInfo{}); err == nil {
 		t.Errorf("did not get expected error")
 	}
 
-	readMachineArch = func() (string, error) {
-		return "x86_64", nil
-	}
+	osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+		return &osinfo.OSInfo{Architecture: "x86_64"}, nil
+	}))
 
 	pkg0 := cos.Package{Category: "dev-util", Name: "foo-x", Version: "1.2.3", EbuildVersion: "someversion"}
-	expect0 := &PkgInfo{Name: "dev-util/foo-x", Arch: "x86_64", Version: "1.2.3"}
+	expect0 := &PkgInfo{Name: "dev-util/foo-x", Arch: "x86_64", Version: "1.2.3", Category: "dev-util", EbuildVersion: "someversion"}
 	pkg1 := cos.Package{Category: "app-admin", Name: "bar", Version: "0.1"}
-	expect1 := &PkgInfo{Name: "app-admin/bar", Arch: "x86_64", Version: "0.1"}
+	expect1 := &PkgInfo{Name: "app-admin/bar", Arch: "x86_64", Version: "0.1", Category: "app-admin"}
 
 	pkgInfo := &cos.PackageInfo{InstalledPackages: []cos.Package{pkg0, pkg1}}
 	parsed, err := parseInstalledCOSPackages(pkgInfo)
@@ -58,7 +61,26 @@ func TestParseInstalledCOSPackages(t *testing.T) {
 	}
 }
 
+func TestCOSArchitecture(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"x86_64", "x86_64"},
+		{"aarch64", "arm64"},
+		{"arm64", "arm64"},
+		{"armv7l", "arm"},
+		{"armv6l", "arm"},
+		{"i686", "i686"},
+	}
+	for _, tt := range tests {
+		if got := cosArchitecture(tt.in); got != tt.want {
+			t.Errorf("cosArchitecture(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
 func TestInstalledCOSPackages(t *testing.T) {
+	defer osinfo.SetProvider(osinfo.SetProvider(nil))
 	testDataJSON := `{
     "installedPackages": [
         {
@@ -145,24 +167,24 @@ func TestInstalledCOSPackages(t *testing.T) {
 	}
 
 	expected := []*PkgInfo{
-		{Name: "app-arch/gzip", Arch: "x86_64", Version: "1.9"},
-		{Name: "dev-libs/popt", Arch: "x86_64", Version: "1.16"},
-		{Name: "app-emulation/docker-credential-helpers", Arch: "x86_64", Version: "0.6.3"},
-		{Name: "_not.real-category1+/_not-real_package1", Arch: "x86_64", Version: "12.34.56.78"},
-		{Name: "_not.real-category1+/_not-real_package2", Arch: "x86_64", Version: "12.34.56.78"},
-		{Name: "_not.real-category1+/_not-real_package3", Arch: "x86_64", Version: "12.34.56.78_rc3"},
-		{Name: "_not.real-category1+/_not-real_package4", Arch: "x86_64", Version: "12.34.56.78_rc3"},
-		{Name: "_not.real-category1+/_not-real_package5", Arch: "x86_64", Version: "12.34.56.78_pre2_rc3"},
-		{Name: "_not.real-category2+/_not-real_package1", Arch: "x86_64", Version: "12.34.56.78q"},
-		{Name: "_not.real-category2+/_not-real_package2", Arch: "x86_64", Version: "12.34.56.78q"},
-		{Name: "_not.real-category2+/_not-real_package3", Arch: "x86_64", Version: "12.34.56.78q_rc3"},
-		{Name: "_not.real-category2+/_not-real_package4", Arch: "x86_64", Version: "12.34.56.78q_rc3"},
-		{Name: "_not.real-category2+/_not-real_package5", Arch: "x86_64", Version: "12.34.56.78q_pre2_rc3"},
-	}
-
-	readMachineArch = func() (string, error) {
-		return "", errors.New("failed to obtain machine architecture")
+		{Name: "app-arch/gzip", Arch: "x86_64", Version: "1.9", Category: "app-arch"},
+		{Name: "dev-libs/popt", Arch: "x86_64", Version: "1.16", Category: "dev-libs"},
+		{Name: "app-emulation/docker-credential-helpers", Arch: "x86_64", Version: "0.6.3", Category: "app-emulation"},
+		{Name: "_not.real-category1+/_not-real_package1", Arch: "x86_64", Version: "12.34.56.78", Category: "_not.real-category1+"},
+		{Name: "_not.real-category1+/_not-real_package2", Arch: "x86_64", Version: "12.34.56.78", Category: "_not.real-category1+"},
+		{Name: "_not.real-category1+/_not-real_package3", Arch: "x86_64", Version: "12.34.56.78_rc3", Category: "_not.real-category1+"},
+		{Name: "_not.real-category1+/_not-real_package4", Arch: "x86_64", Version: "12.34.56.78_rc3", Category: "_not.real-category1+"},
+		{Name: "_not.real-category1+/_not-real_package5", Arch: "x86_64", Version: "12.34.56.78_pre2_rc3", Category: "_not.real-category1+"},
+		{Name: "_not.real-category2+/_not-real_package1", Arch: "x86_64", Version: "12.34.56.78q", Category: "_not.real-category2+"},
+		{Name: "_not.real-category2+/_not-real_package2", Arch: "x86_64", Version: "12.34.56.78q", Category: "_not.real-category2+"},
+		{Name: "_not.real-category2+/_not-real_package3", Arch: "x86_64", Version: "12.34.56.78q_rc3", Category: "_not.real-category2+"},
+		{Name: "_not.real-category2+/_not-real_package4", Arch: "x86_64", Version: "12.34.56.78q_rc3", Category: "_not.real-category2+"},
+		{Name: "_not.real-category2+/_not-real_package5", Arch: "x86_64", Version: "12.34.56.78q_pre2_rc3", Category: "_not.real-category2+"},
 	}
+
+	osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+		return nil, errors.New("failed to obtain machine architecture")
+	}))
 	readCOSPackageInfo = func() (*cos.PackageInfo, error) {
 		info, err := cos.GetPackageInfoFromFile(testFile.Name())
 		return &info, err
@@ -171,9 +193,9 @@ func TestInstalledCOSPackages(t *testing.T) {
 		t.Errorf("did not get expected error from readMachineArch")
 	}
 
-	readMachineArch = func() (string, error) {
-		return "x86_64", nil
-	}
+	osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+		return &osinfo.OSInfo{Architecture: "x86_64"}, nil
+	}))
 	readCOSPackageInfo = func() (*cos.PackageInfo, error) {
 		info, err := cos.GetPackageInfoFromFile("_" + testFile.Name())
 		return &info, err
@@ -182,9 +204,9 @@ func TestInstalledCOSPackages(t *testing.T) {
 		t.Errorf("did not get expected error fro readCOSPackageInfo")
 	}
 
-	readMachineArch = func() (string, error) {
-		return "x86_64", nil
-	}
+	osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+		return &osinfo.OSInfo{Architecture: "x86_64"}, nil
+	}))
 	readCOSPackageInfo = func() (*cos.PackageInfo, error) {
 		info, err := cos.GetPackageInfoFromFile(testFile.Name())
 		return &info, err
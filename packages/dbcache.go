@@ -0,0 +1,143 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// dbCache is the last listing of the installed packages of one package
+// manager together with the state of its database at the time.
+type dbCache struct {
+	mu    sync.Mutex
+	stamp string
+	pkgs  []*PkgInfo
+}
+
+var (
+	debCache dbCache
+	rpmCache dbCache
+
+	dbCacheDisabled atomic.Bool
+)
+
+// SetInventoryDBCache turns the caching of the installed deb and rpm
+// packages on or off, it is on by default.
+func SetInventoryDBCache(enabled bool) {
+	dbCacheDisabled.Store(!enabled)
+}
+
+// dbStamp describes the modification times and sizes of paths, any change
+// to the files changes the stamp. It is empty if none of them exist.
+func dbStamp(paths []string) string {
+	var parts []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", p, fi.ModTime().UnixNano(), fi.Size()))
+	}
+	return strings.Join(parts, ",")
+}
+
+func debDBPaths() []string {
+	return []string{
+		filepath.Join(dpkgDBDir, "status"),
+		filepath.Join(dpkgDBDir, "status.d"),
+	}
+}
+
+func rpmDBPaths() []string {
+	var paths []string
+	for _, dir := range rpmDBDirs {
+		paths = append(paths, dir)
+		for _, f := range rpmDBFiles {
+			// The sqlite database is only written to the WAL file until it is
+			// checkpointed.
+			paths = append(paths, filepath.Join(dir, f), filepath.Join(dir, f+"-wal"))
+		}
+	}
+	return paths
+}
+
+func copyPkgInfos(pkgs []*PkgInfo) []*PkgInfo {
+	if pkgs == nil {
+		return nil
+	}
+	cp := make([]*PkgInfo, len(pkgs))
+	for i, p := range pkgs {
+		c := *p
+		cp[i] = &c
+	}
+	return cp
+}
+
+// get returns the cached packages if the database is unchanged since they
+// were listed, otherwise it lists them again with list. Errors are not
+// cached.
+func (c *dbCache) get(paths []string, list func() ([]*PkgInfo, error)) ([]*PkgInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if dbCacheDisabled.Load() {
+		c.stamp, c.pkgs = "", nil
+		return list()
+	}
+
+	// Take the stamp before listing so a change made meanwhile is picked up
+	// next time.
+	stamp := dbStamp(paths)
+	if stamp != "" && stamp == c.stamp {
+		return copyPkgInfos(c.pkgs), nil
+	}
+	pkgs, err := list()
+	if err != nil {
+		c.stamp, c.pkgs = "", nil
+		return nil, err
+	}
+	c.stamp, c.pkgs = stamp, pkgs
+	return copyPkgInfos(pkgs), nil
+}
+
+// cachedInstalledDebPackages is InstalledDebPackages, or
+// installedDebPackagesFromDB without dpkg-query, re-listing the packages
+// only when the dpkg database changed since the last call.
+func cachedInstalledDebPackages(ctx context.Context) ([]*PkgInfo, error) {
+	return debCache.get(debDBPaths(), func() ([]*PkgInfo, error) {
+		if DpkgQueryExists {
+			return InstalledDebPackages(ctx)
+		}
+		pkgs, err := installedDebPackagesFromDB(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %q: %v", dpkgDBDir, err)
+		}
+		return pkgs, nil
+	})
+}
+
+// cachedInstalledRPMPackages is InstalledRPMPackages, re-listing the
+// packages only when the rpm database changed since the last call.
+func cachedInstalledRPMPackages(ctx context.Context) ([]*PkgInfo, error) {
+	return rpmCache.get(rpmDBPaths(), func() ([]*PkgInfo, error) {
+		return InstalledRPMPackages(ctx)
+	})
+}
@@ -0,0 +1,85 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDBCache(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "status")
+	if err := os.WriteFile(db, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{db, filepath.Join(filepath.Dir(db), "missing")}
+
+	var c dbCache
+	var calls int
+	var listErr error
+	list := func() ([]*PkgInfo, error) {
+		calls++
+		return []*PkgInfo{{Name: "foo"}}, listErr
+	}
+	get := func() []*PkgInfo {
+		t.Helper()
+		pkgs, err := c.get(paths, list)
+		if err != nil {
+			return nil
+		}
+		return pkgs
+	}
+
+	pkgs := get()
+	// Callers may modify what they get without affecting the cache.
+	pkgs[0].Name = "changed"
+	if got := get(); calls != 1 || got[0].Name != "foo" {
+		t.Errorf("after second get: calls = %d, pkgs[0] = %+v, want 1 call and the cached package", calls, got[0])
+	}
+
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(db, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if calls != 2 {
+		t.Errorf("after database change: calls = %d, want 2", calls)
+	}
+
+	// Errors are not cached.
+	if err := os.WriteFile(db, []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listErr = errors.New("error")
+	get()
+	listErr = nil
+	get()
+	if calls != 4 {
+		t.Errorf("after error: calls = %d, want 4", calls)
+	}
+
+	// Nothing is cached without a database to check.
+	if err := os.Remove(db); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	get()
+	if calls != 6 {
+		t.Errorf("without database: calls = %d, want 6", calls)
+	}
+}
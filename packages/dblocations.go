@@ -0,0 +1,132 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	// dpkgDBDir is the dpkg database, read directly when dpkg-query is not
+	// installed, like on distroless images which only ship status.d.
+	dpkgDBDir = "/var/lib/dpkg"
+	// rpmDBDirs are the rpm database locations tried when rpmquery finds no
+	// packages in its configured one, minimal images built with a different
+	// rpm than they run may have the database in either.
+	rpmDBDirs = []string{"/usr/lib/sysimage/rpm", "/var/lib/rpm"}
+
+	zstd = "/usr/bin/zstd"
+
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// readDBFile reads a package database file, decompressing it if it is gzip,
+// xz or zstd compressed.
+func readDBFile(ctx context.Context, path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	case bytes.HasPrefix(data, xzMagic):
+		r, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	case bytes.HasPrefix(data, zstdMagic):
+		out, err := run(ctx, zstd, []string{"-d", "-c", path})
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing zstd compressed file: %v", err)
+		}
+		return out, nil
+	}
+	return data, nil
+}
+
+// dpkgDBExists reports whether dpkgDBDir has a status file or status.d
+// directory.
+func dpkgDBExists() bool {
+	for _, f := range []string{"status", "status.d"} {
+		if _, err := os.Stat(filepath.Join(dpkgDBDir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// installedDebPackagesFromDB reads the installed deb packages from the dpkg
+// database without dpkg-query.
+func installedDebPackagesFromDB(ctx context.Context) ([]*PkgInfo, error) {
+	deb, _, err := extractFromPath(ctx, dpkgDBDir)
+	return deb, err
+}
+
+// installedRPMPackagesFromAlternateDBs reads the installed rpm packages from
+// the first of rpmDBDirs that has a database with packages in it.
+func installedRPMPackagesFromAlternateDBs(ctx context.Context) ([]*PkgInfo, error) {
+	var errs []string
+	seen := map[string]bool{}
+	for _, dir := range rpmDBDirs {
+		// /var/lib/rpm is often a link to /usr/lib/sysimage/rpm.
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+		var found bool
+		for _, f := range rpmDBFiles {
+			if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		pkgs, err := readRPMDB(ctx, dir)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("error reading rpm database in %q: %v", dir, err))
+			continue
+		}
+		if len(pkgs) > 0 {
+			clog.Debugf(ctx, "Read %d rpm packages from the database in %q.", len(pkgs), dir)
+			return pkgs, nil
+		}
+	}
+	if len(errs) != 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	return nil, nil
+}
@@ -0,0 +1,128 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/ulikunitz/xz"
+)
+
+func TestReadDBFileCompressed(t *testing.T) {
+	want := []byte("Package: base-files\nVersion: 11.1+deb11u5\n")
+	var gz, x bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(want)
+	gw.Close()
+	xw, err := xz.NewWriter(&x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xw.Write(want)
+	xw.Close()
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"plain": want, "gzip": gz.Bytes(), "xz": x.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readDBFile(testCtx, path)
+		if err != nil {
+			t.Errorf("readDBFile(%s): unexpected error: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("readDBFile(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestReadDBFileZstd(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	path := filepath.Join(t.TempDir(), "base-files")
+	if err := ioutil.WriteFile(path, append(append([]byte{}, zstdMagic...), "compressed"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("Package: base-files\n")
+	mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(exec.Command(zstd, "-d", "-c", path))).Return(want, nil, nil).Times(1)
+
+	got, err := readDBFile(testCtx, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("readDBFile = %q, want %q", got, want)
+	}
+}
+
+func TestInstalledDebPackagesFromDB(t *testing.T) {
+	defer func(d string) { dpkgDBDir = d }(dpkgDBDir)
+
+	dpkgDBDir = filepath.Join("testdata", "dpkg", "status.d")
+	if dpkgDBExists() {
+		t.Errorf("dpkgDBExists() = true for %q", dpkgDBDir)
+	}
+
+	dpkgDBDir = filepath.Join("testdata", "dpkg")
+	if !dpkgDBExists() {
+		t.Fatalf("dpkgDBExists() = false for %q", dpkgDBDir)
+	}
+	got, err := installedDebPackagesFromDB(testCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("installedDebPackagesFromDB() returned %d packages, want 4: %v", len(got), got)
+	}
+}
+
+func TestInstalledRPMPackagesAlternateDB(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	defer func(d []string) { rpmDBDirs = d }(rpmDBDirs)
+	empty, sysimage := t.TempDir(), t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(sysimage, "rpmdb.sqlite"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rpmDBDirs = []string{filepath.Join(empty, "missing"), empty, sysimage}
+
+	first := mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(exec.Command(rpmquery, rpmqueryInstalledArgs...))).Return(nil, nil, nil).Times(1)
+	mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(exec.Command(rpmquery, append([]string{"--dbpath", sysimage}, rpmqueryInstalledArgs...)...))).After(first).Return([]byte("foo x86_64 1.2.3-4"), nil, nil).Times(1)
+
+	got, err := InstalledRPMPackages(testCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3-4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InstalledRPMPackages() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,290 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// %{=NAME} repeats the package name for each element of the array tags.
+	rpmqueryDepsArgs  = []string{"--queryformat", "[%{=NAME}\tprovides\t%{PROVIDES}\n][%{=NAME}\trequires\t%{REQUIRENAME}\n]", "-a"}
+	dpkgQueryDepsArgs = []string{"-W", "-f", "${db:Status-Abbrev}\t${Package}\t${Provides}\t${Pre-Depends}, ${Depends}\n"}
+)
+
+// DepGraph is the dependency graph of the installed packages, nodes are
+// package names.
+type DepGraph struct {
+	deps  map[string]map[string]bool
+	rdeps map[string]map[string]bool
+}
+
+func newDepGraph() *DepGraph {
+	return &DepGraph{deps: map[string]map[string]bool{}, rdeps: map[string]map[string]bool{}}
+}
+
+func (g *DepGraph) addPackage(name string) {
+	if _, ok := g.deps[name]; !ok {
+		g.deps[name] = map[string]bool{}
+		g.rdeps[name] = map[string]bool{}
+	}
+}
+
+func (g *DepGraph) addDependency(from, to string) {
+	if from == to {
+		return
+	}
+	g.addPackage(from)
+	g.addPackage(to)
+	g.deps[from][to] = true
+	g.rdeps[to][from] = true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Packages returns the names of all packages in the graph, sorted.
+func (g *DepGraph) Packages() []string {
+	names := make([]string, 0, len(g.deps))
+	for name := range g.deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dependencies returns the packages name directly depends on, sorted.
+func (g *DepGraph) Dependencies(name string) []string {
+	return sortedKeys(g.deps[name])
+}
+
+// ReverseDependencies returns the packages directly depending on name,
+// sorted.
+func (g *DepGraph) ReverseDependencies(name string) []string {
+	return sortedKeys(g.rdeps[name])
+}
+
+// TransitiveReverseDependencies returns the packages depending on name
+// directly or indirectly, sorted. These are the packages affected when name
+// is removed or upgraded.
+func (g *DepGraph) TransitiveReverseDependencies(name string) []string {
+	seen := map[string]bool{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for r := range g.rdeps[n] {
+			if r != name && !seen[r] {
+				seen[r] = true
+				queue = append(queue, r)
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// DOT returns the graph in the Graphviz DOT language.
+func (g *DepGraph) DOT() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph packages {\n")
+	for _, name := range g.Packages() {
+		deps := g.Dependencies(name)
+		if len(deps) == 0 {
+			fmt.Fprintf(&buf, "  %q;\n", name)
+			continue
+		}
+		for _, d := range deps {
+			fmt.Fprintf(&buf, "  %q -> %q;\n", name, d)
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// MarshalJSON encodes the graph as an object mapping each package to the
+// sorted list of its dependencies.
+func (g *DepGraph) MarshalJSON() ([]byte, error) {
+	m := make(map[string][]string, len(g.deps))
+	for name, deps := range g.deps {
+		m[name] = sortedKeys(deps)
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes a graph encoded by MarshalJSON.
+func (g *DepGraph) UnmarshalJSON(data []byte) error {
+	var m map[string][]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*g = *newDepGraph()
+	for name, deps := range m {
+		g.addPackage(name)
+		for _, d := range deps {
+			g.addDependency(name, d)
+		}
+	}
+	return nil
+}
+
+// resolve adds the edges from requires, capabilities mapped to their
+// providers. Requirements nothing installed provides, like file
+// dependencies or rpmlib() features, are dropped.
+func (g *DepGraph) resolve(requires map[string][]string, providers map[string][]string) {
+	for name, reqs := range requires {
+		for _, req := range reqs {
+			for _, p := range providers[req] {
+				g.addDependency(name, p)
+			}
+		}
+	}
+}
+
+func parseRPMDeps(data []byte) *DepGraph {
+	/*
+		bash	provides	/bin/sh
+		bash	provides	bash
+		bash	provides	bash(x86-64)
+		bash	requires	/bin/sh
+		bash	requires	libc.so.6()(64bit)
+		bash	requires	rpmlib(CompressedFileNames)
+		glibc	provides	libc.so.6()(64bit)
+	*/
+	g := newDepGraph()
+	providers := map[string][]string{}
+	requires := map[string][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 || fields[0] == "" || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		name, capability := fields[0], fields[2]
+		g.addPackage(name)
+		switch fields[1] {
+		case "provides":
+			providers[capability] = append(providers[capability], name)
+		case "requires":
+			requires[name] = append(requires[name], capability)
+		}
+	}
+	for name := range g.deps {
+		providers[name] = append(providers[name], name)
+	}
+	g.resolve(requires, providers)
+	return g
+}
+
+// parseDebRelations parses a dpkg relationship field like
+// "libc6 (>= 2.34), debconf (>= 0.5) | debconf-2.0" into the names of the
+// packages referred to, alternatives included.
+func parseDebRelations(field string) []string {
+	var names []string
+	for _, rel := range strings.Split(field, ",") {
+		for _, alt := range strings.Split(rel, "|") {
+			alt = strings.TrimSpace(alt)
+			if i := strings.IndexAny(alt, " ("); i >= 0 {
+				alt = alt[:i]
+			}
+			// Multi-arch qualifiers like "python3:any".
+			if i := strings.Index(alt, ":"); i >= 0 {
+				alt = alt[:i]
+			}
+			if alt != "" {
+				names = append(names, alt)
+			}
+		}
+	}
+	return names
+}
+
+func parseDpkgDeps(data []byte) *DepGraph {
+	/*
+		ii 	bash		base-files (>= 2.1.12), debianutils (>= 2.15), libc6 (>= 2.34)
+		ii 	exim4	mail-transport-agent	, debconf (>= 0.5) | debconf-2.0, exim4-base (>= 4.95)
+		rc 	removed			, libc6
+	*/
+	g := newDepGraph()
+	providers := map[string][]string{}
+	requires := map[string][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 || fields[1] == "" {
+			continue
+		}
+		// Only packages that are installed, "ii" or "hi" if on hold.
+		if status := strings.TrimSpace(fields[0]); len(status) < 2 || status[1] != 'i' {
+			continue
+		}
+		name := fields[1]
+		g.addPackage(name)
+		for _, p := range parseDebRelations(fields[2]) {
+			providers[p] = append(providers[p], name)
+		}
+		requires[name] = append(requires[name], parseDebRelations(fields[3])...)
+	}
+	for name := range g.deps {
+		providers[name] = append(providers[name], name)
+	}
+	g.resolve(requires, providers)
+	return g
+}
+
+// RPMDependencyGraph builds the dependency graph of the installed rpm
+// packages from their requires and provides.
+func RPMDependencyGraph(ctx context.Context) (*DepGraph, error) {
+	out, err := run(ctx, rpmquery, rpmqueryDepsArgs)
+	if err != nil {
+		return nil, err
+	}
+	return parseRPMDeps(out), nil
+}
+
+// DebDependencyGraph builds the dependency graph of the installed deb
+// packages from their Depends and Pre-Depends. All installed alternatives
+// of a dependency are included.
+func DebDependencyGraph(ctx context.Context) (*DepGraph, error) {
+	out, err := run(ctx, dpkgQuery, dpkgQueryDepsArgs)
+	if err != nil {
+		return nil, err
+	}
+	return parseDpkgDeps(out), nil
+}
+
+// DependencyGraph builds the dependency graph of the installed packages of
+// the system package manager.
+func DependencyGraph(ctx context.Context) (*DepGraph, error) {
+	switch {
+	case DpkgQueryExists:
+		return DebDependencyGraph(ctx)
+	case RPMQueryExists:
+		return RPMDependencyGraph(ctx)
+	}
+	return nil, errors.New("no supported package manager to build a dependency graph with")
+}
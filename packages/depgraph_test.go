@@ -0,0 +1,97 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRPMDeps(t *testing.T) {
+	data := []byte("bash\tprovides\t/bin/sh\n" +
+		"bash\tprovides\tbash(x86-64)\n" +
+		"bash\trequires\tlibc.so.6()(64bit)\n" +
+		"bash\trequires\trpmlib(CompressedFileNames)\n" +
+		"glibc\tprovides\tlibc.so.6()(64bit)\n" +
+		"glibc\trequires\tglibc-common\n" +
+		"glibc-common\tprovides\tglibc-common\n" +
+		"sudo\trequires\t/bin/sh\n" +
+		"gpg-pubkey\tprovides\tgpg(key)\n")
+	g := parseRPMDeps(data)
+
+	if diff := cmp.Diff([]string{"bash", "glibc", "glibc-common", "sudo"}, g.Packages()); diff != "" {
+		t.Errorf("Packages: unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"glibc"}, g.Dependencies("bash")); diff != "" {
+		t.Errorf("Dependencies(bash): unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"bash"}, g.ReverseDependencies("glibc")); diff != "" {
+		t.Errorf("ReverseDependencies(glibc): unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"bash", "glibc", "sudo"}, g.TransitiveReverseDependencies("glibc-common")); diff != "" {
+		t.Errorf("TransitiveReverseDependencies(glibc-common): unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseDpkgDeps(t *testing.T) {
+	data := []byte("ii \tbash\t\t, base-files (>= 2.1.12), libc6 (>= 2.34)\n" +
+		"ii \texim4\tmail-transport-agent\t, debconf (>= 0.5) | debconf-2.0, libc6:any\n" +
+		"ii \tdebconf\t\t, \n" +
+		"ii \tlibc6\t\t, \n" +
+		"ii \tmailutils\t\t, default-mta | mail-transport-agent\n" +
+		"rc \tremoved\t\t, libc6\n")
+	g := parseDpkgDeps(data)
+
+	if diff := cmp.Diff([]string{"bash", "debconf", "exim4", "libc6", "mailutils"}, g.Packages()); diff != "" {
+		t.Errorf("Packages: unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"debconf", "libc6"}, g.Dependencies("exim4")); diff != "" {
+		t.Errorf("Dependencies(exim4): unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"bash", "exim4"}, g.ReverseDependencies("libc6")); diff != "" {
+		t.Errorf("ReverseDependencies(libc6): unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"bash", "exim4", "mailutils"}, g.TransitiveReverseDependencies("libc6")); diff != "" {
+		t.Errorf("TransitiveReverseDependencies(libc6): unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestDepGraphExport(t *testing.T) {
+	g := newDepGraph()
+	g.addDependency("bash", "libc6")
+	g.addPackage("tzdata")
+
+	wantDOT := "digraph packages {\n  \"bash\" -> \"libc6\";\n  \"libc6\";\n  \"tzdata\";\n}\n"
+	if diff := cmp.Diff(wantDOT, g.DOT()); diff != "" {
+		t.Errorf("DOT: unexpected result (-want +got):\n%s", diff)
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("json.Marshal: unexpected error: %v", err)
+	}
+	if want := `{"bash":["libc6"],"libc6":[],"tzdata":[]}`; string(data) != want {
+		t.Errorf("json.Marshal: got %s, want %s", data, want)
+	}
+	var got DepGraph
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(g.DOT(), got.DOT()); diff != "" {
+		t.Errorf("json round trip: unexpected result (-want +got):\n%s", diff)
+	}
+}
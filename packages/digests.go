@@ -0,0 +1,54 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+)
+
+// SHA256HEADER is the SHA-256 digest of the package header as installed,
+// rpm versions before 4.14 report it as "(none)".
+var rpmqueryDigestArgs = []string{"--queryformat", "%{NAME} %{ARCH} %{SHA256HEADER}\n", "-a"}
+
+func parseRPMDigests(data []byte) map[string]string {
+	/*
+	   foo x86_64 3b4c...e1
+	   gpg-pubkey (none) (none)
+	*/
+	digests := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[2] == "(none)" {
+			continue
+		}
+		digests[fields[0]+"."+fields[1]] = fields[2]
+	}
+	return digests
+}
+
+// RPMHeaderDigests returns the SHA-256 header digests of the installed rpm
+// packages keyed by "name.arch". Packages the installed rpm version has no
+// digest for are left out.
+func RPMHeaderDigests(ctx context.Context) (map[string]string, error) {
+	out, err := run(ctx, rpmquery, rpmqueryDigestArgs)
+	if err != nil {
+		return nil, err
+	}
+	return parseRPMDigests(out), nil
+}
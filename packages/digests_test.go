@@ -0,0 +1,35 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRPMDigests(t *testing.T) {
+	data := []byte("" +
+		"foo x86_64 3b4cd1e1\n" +
+		"bar noarch 9f00aa12\n" +
+		"gpg-pubkey (none) (none)\n" +
+		"old x86_64 (none)\n" +
+		"something we dont understand\n")
+
+	want := map[string]string{"foo.x86_64": "3b4cd1e1", "bar.noarch": "9f00aa12"}
+	if diff := cmp.Diff(want, parseRPMDigests(data)); diff != "" {
+		t.Errorf("parseRPMDigests() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,66 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+type commandEnvKey struct{}
+
+// WithCommandEnv returns a copy of ctx that makes the package manager
+// commands run with it inherit the agent environment plus env, a list of
+// "KEY=value" entries such as "http_proxy=http://proxy:3128" or
+// "DEBIAN_FRONTEND=readline". env takes precedence over variables the agent
+// sets on the commands itself.
+func WithCommandEnv(ctx context.Context, env []string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, commandEnvKey{}, env)
+}
+
+var (
+	baseCommandEnv   []string
+	baseCommandEnvMx sync.RWMutex
+)
+
+// SetCommandEnv sets "KEY=value" entries added to the environment of all
+// package manager commands, e.g. the agentconfig.ProxyEnv, so they don't
+// depend on the environment the agent inherited. WithCommandEnv entries take
+// precedence over them.
+func SetCommandEnv(env []string) {
+	baseCommandEnvMx.Lock()
+	defer baseCommandEnvMx.Unlock()
+	baseCommandEnv = append([]string(nil), env...)
+}
+
+func commandEnv(ctx context.Context) []string {
+	baseCommandEnvMx.RLock()
+	env := append([]string(nil), baseCommandEnv...)
+	baseCommandEnvMx.RUnlock()
+	ctxEnv, _ := ctx.Value(commandEnvKey{}).([]string)
+	return append(env, ctxEnv...)
+}
+
+// commandEnvWith returns the environment of a command that needs the
+// variables in defaults, followed by the WithCommandEnv variables of ctx so
+// those win.
+func commandEnvWith(ctx context.Context, defaults ...string) []string {
+	env := append(os.Environ(), defaults...)
+	return append(env, commandEnv(ctx)...)
+}
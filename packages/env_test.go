@@ -0,0 +1,67 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCommandContextEnv(t *testing.T) {
+	if cmd := commandContext(context.Background(), "/bin/true"); cmd.Env != nil {
+		t.Errorf("commandContext without a command env set Env to %q", cmd.Env)
+	}
+
+	env := []string{"http_proxy=http://proxy:3128"}
+	cmd := commandContext(WithCommandEnv(context.Background(), env), "/bin/true")
+	if diff := cmp.Diff(append(os.Environ(), env...), cmd.Env); diff != "" {
+		t.Errorf("commandContext Env mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetCommandEnv(t *testing.T) {
+	SetCommandEnv([]string{"http_proxy=http://agent:3128", "no_proxy=.internal"})
+	defer SetCommandEnv(nil)
+
+	cmd := commandContext(WithCommandEnv(context.Background(), []string{"http_proxy=http://patch:3128"}), "/bin/true")
+	want := append(os.Environ(), "http_proxy=http://agent:3128", "no_proxy=.internal", "http_proxy=http://patch:3128")
+	if diff := cmp.Diff(want, cmd.Env); diff != "" {
+		t.Errorf("commandContext Env mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestInstallAptPackagesCommandEnv(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	// The command env comes after DEBIAN_FRONTEND=noninteractive so it can
+	// override it.
+	env := []string{"http_proxy=http://proxy:3128", "DEBIAN_FRONTEND=readline"}
+	cmd := exec.Command(aptGet, append(aptGetInstallArgs, "pkg1")...)
+	cmd.Env = append(append(os.Environ(), "DEBIAN_FRONTEND=noninteractive"), env...)
+	mockCommandRunner.EXPECT().Run(gomock.Any(), utilmocks.EqCmd(cmd)).Return([]byte("stdout"), []byte("stderr"), nil).Times(1)
+
+	if err := InstallAptPackages(WithCommandEnv(testCtx, env), []string{"pkg1"}); err != nil {
+		t.Errorf("InstallAptPackages: unexpected error: %v", err)
+	}
+}
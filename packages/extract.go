@@ -0,0 +1,239 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+var rpmDBFiles = []string{"Packages", "Packages.db", "rpmdb.sqlite"}
+
+// ExtractFrom reads installed packages only from the given package manager
+// database files or directories instead of querying the running system.
+// Supported inputs are a dpkg status file, a dpkg status.d directory or
+// a directory containing one of them (e.g. a copied /var/lib/dpkg), and an
+// rpm database directory (e.g. a copied /var/lib/rpm). dpkg status files may
+// be gzip, xz or zstd compressed, the latter requires zstd to be installed.
+// Reading rpm databases requires rpmquery to be installed.
+func ExtractFrom(ctx context.Context, paths ...string) (*Packages, error) {
+	pkgs := &Packages{}
+	var errs []string
+	for _, path := range paths {
+		deb, rpm, err := extractFromPath(ctx, path)
+		if err != nil {
+			msg := fmt.Sprintf("error extracting packages from %q: %v", path, err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+			continue
+		}
+		pkgs.Deb = append(pkgs.Deb, deb...)
+		pkgs.Rpm = append(pkgs.Rpm, rpm...)
+	}
+
+	var err error
+	if len(errs) != 0 {
+		err = errors.New(strings.Join(errs, "\n"))
+	}
+	return pkgs, err
+}
+
+func extractFromPath(ctx context.Context, path string) (deb, rpm []*PkgInfo, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !fi.IsDir() {
+		switch {
+		case filepath.Base(path) == "status" || filepath.Base(filepath.Dir(path)) == "status.d":
+			deb, err = readDpkgStatusFile(ctx, path)
+			return deb, nil, err
+		case isRPMDBFile(filepath.Base(path)):
+			rpm, err = readRPMDB(ctx, filepath.Dir(path))
+			return nil, rpm, err
+		}
+		return nil, nil, errors.New("unrecognized package database file")
+	}
+
+	if filepath.Base(path) == "status.d" {
+		deb, err = readDpkgStatusDir(ctx, path)
+		return deb, nil, err
+	}
+
+	var found bool
+	if fi, err := os.Stat(filepath.Join(path, "status")); err == nil && !fi.IsDir() {
+		found = true
+		pkgs, err := readDpkgStatusFile(ctx, filepath.Join(path, "status"))
+		if err != nil {
+			return nil, nil, err
+		}
+		deb = append(deb, pkgs...)
+	}
+	if fi, err := os.Stat(filepath.Join(path, "status.d")); err == nil && fi.IsDir() {
+		found = true
+		pkgs, err := readDpkgStatusDir(ctx, filepath.Join(path, "status.d"))
+		if err != nil {
+			return nil, nil, err
+		}
+		deb = append(deb, pkgs...)
+	}
+	for _, f := range rpmDBFiles {
+		if _, err := os.Stat(filepath.Join(path, f)); err == nil {
+			found = true
+			if rpm, err = readRPMDB(ctx, path); err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+	}
+	if !found {
+		return nil, nil, errors.New("no package database found in directory")
+	}
+	return deb, rpm, nil
+}
+
+func isRPMDBFile(name string) bool {
+	for _, f := range rpmDBFiles {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readRPMDB(ctx context.Context, dbPath string) ([]*PkgInfo, error) {
+	if rpmquery == "" {
+		return nil, errors.New("rpmquery is not available on this system")
+	}
+	out, err := run(ctx, rpmquery, append([]string{"--dbpath", dbPath}, rpmqueryInstalledArgs...))
+	if err != nil {
+		return nil, err
+	}
+	return parseInstalledRPMPackages(ctx, out), nil
+}
+
+func readDpkgStatusDir(ctx context.Context, dir string) ([]*PkgInfo, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []*PkgInfo
+	for _, f := range files {
+		// Distroless images also store md5sums files in status.d, compressed
+		// ones on some images.
+		if f.IsDir() || strings.Contains(f.Name(), ".md5sums") {
+			continue
+		}
+		p, err := readDpkgStatusFile(ctx, filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p...)
+	}
+	return pkgs, nil
+}
+
+func readDpkgStatusFile(ctx context.Context, path string) ([]*PkgInfo, error) {
+	data, err := readDBFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := parseDpkgStatus(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dpkg status file %q: %v", path, err)
+	}
+	return pkgs, nil
+}
+
+func parseDpkgStatus(data []byte) ([]*PkgInfo, error) {
+	/*
+		Package: adduser
+		Status: install ok installed
+		Architecture: all
+		Version: 3.118ubuntu2
+
+		Package: libc6
+		Status: install ok installed
+		Architecture: amd64
+		Source: glibc (2.31-0ubuntu9.9)
+		Version: 2.31-0ubuntu9.7
+		Description: GNU C Library: Shared libraries
+		 Contains the standard libraries that are used by nearly all programs on
+		...
+	*/
+	var pkgs []*PkgInfo
+	stanza := map[string]string{}
+	flush := func() {
+		defer func() { stanza = map[string]string{} }()
+		if stanza["Package"] == "" {
+			return
+		}
+		// Distroless status.d entries omit Status, treat those as installed.
+		if status, ok := stanza["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			return
+		}
+
+		info := dpkgInfo{
+			Package:       stanza["Package"],
+			Architecture:  stanza["Architecture"],
+			Version:       stanza["Version"],
+			SourceName:    stanza["Package"],
+			SourceVersion: stanza["Version"],
+		}
+		// Source may be "name" or "name (version)".
+		if src := strings.Fields(stanza["Source"]); len(src) > 0 {
+			info.SourceName = src[0]
+			if len(src) > 1 {
+				info.SourceVersion = strings.Trim(src[1], "()")
+			}
+		}
+		pkgs = append(pkgs, pkgInfoFromDpkgInfo(info))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		// Continuation lines belong to multi-line fields we don't need.
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		stanza[kv[0]] = strings.TrimSpace(kv[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return pkgs, nil
+}
@@ -0,0 +1,104 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func TestExtractFromDpkg(t *testing.T) {
+	status := []*PkgInfo{
+		{Name: "adduser", Arch: "all", Version: "3.118ubuntu2", Source: Source{Name: "adduser", Version: "3.118ubuntu2"}},
+		{Name: "libc6", Arch: "x86_64", Version: "2.31-0ubuntu9.7", Source: Source{Name: "glibc", Version: "2.31-0ubuntu9.9"}},
+		{Name: "libssl1.1", Arch: "x86_64", Version: "1.1.1f-1ubuntu2.16", Source: Source{Name: "openssl", Version: "1.1.1f-1ubuntu2.16"}},
+	}
+	statusD := []*PkgInfo{
+		{Name: "base-files", Arch: "x86_64", Version: "11.1+deb11u5", Source: Source{Name: "base-files", Version: "11.1+deb11u5"}},
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []*PkgInfo
+	}{
+		{"StatusFile", filepath.Join("testdata", "dpkg", "status"), status},
+		{"StatusDir", filepath.Join("testdata", "dpkg", "status.d"), statusD},
+		{"StatusDirEntry", filepath.Join("testdata", "dpkg", "status.d", "base-files"), statusD},
+		{"DpkgDir", filepath.Join("testdata", "dpkg"), append(append([]*PkgInfo{}, status...), statusD...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractFrom(testCtx, tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Deb, tt.want) {
+				t.Errorf("ExtractFrom(%q).Deb = %v, want %v", tt.path, got.Deb, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractFromErrors(t *testing.T) {
+	if _, err := ExtractFrom(testCtx, filepath.Join("testdata", "does-not-exist")); err == nil {
+		t.Errorf("did not get expected error for missing path")
+	}
+	if _, err := ExtractFrom(testCtx, "testdata"); err == nil {
+		t.Errorf("did not get expected error for directory without a package database")
+	}
+
+	// A line over the scanner limit must not cut the package list short.
+	long := "Package: adduser\nStatus: install ok installed\nDescription: " + strings.Repeat("x", 2*1024*1024) + "\n\nPackage: libc6\n"
+	if _, err := parseDpkgStatus([]byte(long)); err == nil {
+		t.Errorf("did not get expected error for a status file with a line over the limit")
+	}
+}
+
+func TestExtractFromRPM(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dir, err := ioutil.TempDir("", "rpmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "rpmdb.sqlite"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	expectedCmd := utilmocks.EqCmd(exec.Command(rpmquery, append([]string{"--dbpath", dir}, rpmqueryInstalledArgs...)...))
+	mockCommandRunner.EXPECT().Run(testCtx, expectedCmd).Return([]byte("foo x86_64 1.2.3-4"), []byte("stderr"), nil).Times(1)
+
+	got, err := ExtractFrom(testCtx, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3-4"}}
+	if !reflect.DeepEqual(got.Rpm, want) {
+		t.Errorf("ExtractFrom(%q).Rpm = %v, want %v", dir, got.Rpm, want)
+	}
+}
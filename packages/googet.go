@@ -17,6 +17,7 @@ package packages
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,8 +32,29 @@ var (
 	googetInstalledQueryArgs = []string{"installed"}
 	googetInstallArgs        = []string{"-noconfirm", "install"}
 	googetRemoveArgs         = []string{"-noconfirm", "remove"}
+	googetUpdateArgs         = []string{"-noconfirm", "update"}
 )
 
+// GooGetError is returned when a googet install, remove or update
+// operation fails.
+type GooGetError struct {
+	// Op is the googet operation that failed: install, remove or update.
+	Op string
+	// Packages are the packages the operation was run against, empty for a
+	// full update.
+	Packages       []string
+	Stdout, Stderr []byte
+	Err            error
+}
+
+func (e *GooGetError) Error() string {
+	return fmt.Sprintf("error running googet %s for packages %q: %v, stdout: %q, stderr: %q", e.Op, e.Packages, e.Err, e.Stdout, e.Stderr)
+}
+
+func (e *GooGetError) Unwrap() error {
+	return e.Err
+}
+
 func init() {
 	googet = filepath.Join(os.Getenv("GooGetRoot"), "googet.exe")
 	GooGetExists = util.Exists(googet)
@@ -58,7 +80,11 @@ func parseGooGetUpdates(data []byte) []*PkgInfo {
 		if len(p) != 2 {
 			continue
 		}
-		pkgs = append(pkgs, &PkgInfo{Name: p[0], Arch: strings.Trim(p[1], ","), Version: pkg[3]})
+		info := &PkgInfo{Name: p[0], Arch: strings.Trim(p[1], ","), Version: pkg[3]}
+		if len(pkg) >= 6 && pkg[4] == "from" {
+			info.Repository = pkg[5]
+		}
+		pkgs = append(pkgs, info)
 	}
 	return pkgs
 }
@@ -73,16 +99,39 @@ func GooGetUpdates(ctx context.Context) ([]*PkgInfo, error) {
 	return parseGooGetUpdates(out), nil
 }
 
-// InstallGooGetPackages installs GooGet packages.
+func runGooGet(ctx context.Context, op string, args, pkgs []string) error {
+	stdout, stderr, err := runnerFor(ManagerGooGet).Run(ctx, commandContext(ctx, googet, append(args, pkgs...)...))
+	if err != nil {
+		return &GooGetError{Op: op, Packages: pkgs, Stdout: stdout, Stderr: stderr, Err: err}
+	}
+	return nil
+}
+
+// InstallGooGetPackages installs GooGet packages, errors are of type
+// *GooGetError.
 func InstallGooGetPackages(ctx context.Context, pkgs []string) error {
-	_, err := run(ctx, googet, append(googetInstallArgs, pkgs...))
-	return err
+	return runGooGet(ctx, "install", googetInstallArgs, pkgs)
 }
 
-// RemoveGooGetPackages installs GooGet packages.
+// RemoveGooGetPackages removes GooGet packages, errors are of type
+// *GooGetError or *ProtectedPackageError for protected packages.
 func RemoveGooGetPackages(ctx context.Context, pkgs []string) error {
-	_, err := run(ctx, googet, append(googetRemoveArgs, pkgs...))
-	return err
+	if err := checkProtected("remove", pkgs); err != nil {
+		return err
+	}
+	return runGooGet(ctx, "remove", googetRemoveArgs, pkgs)
+}
+
+// UpdateGooGetPackages updates the given GooGet packages to their latest
+// available version, if no packages are specified all installed packages are
+// updated. Errors are of type *GooGetError.
+func UpdateGooGetPackages(ctx context.Context, pkgs []string) error {
+	if len(pkgs) == 0 {
+		return runGooGet(ctx, "update", googetUpdateArgs, nil)
+	}
+	// googet install upgrades already installed packages to the latest
+	// version available in the configured repos.
+	return runGooGet(ctx, "update", googetInstallArgs, pkgs)
 }
 
 func parseInstalledGooGetPackages(data []byte) []*PkgInfo {
@@ -62,6 +62,31 @@ func TestRemoveGooGet(t *testing.T) {
 	}
 }
 
+func TestUpdateGooGetPackages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	updateAllCmd := utilmocks.EqCmd(exec.Command(googet, googetUpdateArgs...))
+	mockCommandRunner.EXPECT().Run(testCtx, updateAllCmd).Return([]byte("stdout"), []byte("stderr"), nil).Times(1)
+	if err := UpdateGooGetPackages(testCtx, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	updatePkgsCmd := utilmocks.EqCmd(exec.Command(googet, append(googetInstallArgs, pkgs...)...))
+	mockCommandRunner.EXPECT().Run(testCtx, updatePkgsCmd).Return([]byte("stdout"), []byte("stderr"), errors.New("Could not update package")).Times(1)
+	err := UpdateGooGetPackages(testCtx, pkgs)
+	var gErr *GooGetError
+	if !errors.As(err, &gErr) {
+		t.Fatalf("UpdateGooGetPackages() error = %v, want *GooGetError", err)
+	}
+	if gErr.Op != "update" || !reflect.DeepEqual(gErr.Packages, pkgs) || string(gErr.Stderr) != "stderr" {
+		t.Errorf("unexpected GooGetError: %+v", gErr)
+	}
+}
+
 func TestParseInstalledGooGetPackages(t *testing.T) {
 	tests := []struct {
 		name string
@@ -113,10 +138,10 @@ func TestParseGooGetUpdates(t *testing.T) {
 		data []byte
 		want []*PkgInfo
 	}{
-		{"NormalCase", []byte("Searching for available updates...\nfoo.noarch, 3.5.4@1 --> 3.6.7@1 from repo\nbar.x86_64, 1.0.0@1 --> 2.0.0@1 from repo\nPerform update? (y/N):"), []*PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0@1"}}},
+		{"NormalCase", []byte("Searching for available updates...\nfoo.noarch, 3.5.4@1 --> 3.6.7@1 from repo\nbar.x86_64, 1.0.0@1 --> 2.0.0@1 from repo\nPerform update? (y/N):"), []*PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1", Repository: "repo"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0@1", Repository: "repo"}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
-		{"UnrecognizedPackage", []byte("Inst something we dont understand\n foo.noarch, 3.5.4@1 --> 3.6.7@1 from repo"), []*PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1"}}},
+		{"UnrecognizedPackage", []byte("Inst something we dont understand\n foo.noarch, 3.5.4@1 --> 3.6.7@1 from repo"), []*PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1", Repository: "repo"}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -141,7 +166,7 @@ func TestGooGetUpdates(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []*PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1"}}
+	want := []*PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1", Repository: "repo"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("GooGetUpdates() = %v, want %v", ret, want)
 	}
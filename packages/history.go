@@ -0,0 +1,442 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+)
+
+var (
+	// aptHistoryLog is the apt history log, rotated logs are named
+	// history.log.1, history.log.2.gz and so on.
+	aptHistoryLog = "/var/log/apt/history.log"
+
+	yumHistoryListArgs = []string{"history", "list"}
+	// yum 3 only lists the last 20 transactions unless asked for all of
+	// them, dnf takes "all" for a package name.
+	yumHistoryListAllArgs = []string{"history", "list", "all"}
+	// A transaction range given to history info is shown as a single merged
+	// transaction, so the IDs are given one by one.
+	yumHistoryInfoArgs = []string{"history", "info"}
+	yumHistoryLastArgs = []string{"history", "info", "last"}
+	yumHistoryUndoArgs = []string{"history", "undo", "-y"}
+
+	aptHistoryPackageRe = regexp.MustCompile(`([^\s,]+) \(([^)]*)\)`)
+
+	// yumHistoryTimeLayouts are the layouts of the begin and end times in
+	// yum history info output when run with LC_ALL=C.
+	yumHistoryTimeLayouts = []string{"Mon Jan _2 15:04:05 2006", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+)
+
+// HistoryTransaction is a package transaction recorded by a package manager,
+// made by the agent or by anyone else using the package manager directly.
+type HistoryTransaction struct {
+	Manager Manager
+	// ID is the transaction ID for yum and dnf, apt does not number
+	// transactions.
+	ID         string `json:",omitempty"`
+	Start, End time.Time
+	// User is the login of the user that ran the transaction, empty if the
+	// package manager did not record it, like apt run by root without sudo.
+	User        string `json:",omitempty"`
+	CommandLine string `json:",omitempty"`
+	Changes     []*HistoryChange
+}
+
+// HistoryChange is a single package change of a HistoryTransaction.
+type HistoryChange struct {
+	// Action is the change as named by the package manager, like "Install",
+	// "Upgrade" or "Remove".
+	Action              string
+	Name, Arch, Version string
+	// PreviousVersion is the version before an upgrade or downgrade, when
+	// the package manager records it on the same change.
+	PreviousVersion string `json:",omitempty"`
+}
+
+// PackageHistory reads the transaction history of apt and yum/dnf, returning
+// the transactions started at or after since, oldest first. A zero since
+// returns the whole history.
+func PackageHistory(ctx context.Context, since time.Time) ([]*HistoryTransaction, error) {
+	var txs []*HistoryTransaction
+	var errs []string
+	if DpkgExists {
+		apt, err := aptHistory()
+		if err != nil {
+			msg := fmt.Sprintf("error reading apt history: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+		}
+		txs = append(txs, apt...)
+	}
+	if YumExists {
+		yum, err := yumHistory(ctx)
+		if err != nil {
+			msg := fmt.Sprintf("error reading yum history: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+		}
+		txs = append(txs, yum...)
+	}
+
+	var filtered []*HistoryTransaction
+	for _, tx := range txs {
+		if !tx.Start.Before(since) {
+			filtered = append(filtered, tx)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Start.Before(filtered[j].Start) })
+
+	var err error
+	if len(errs) != 0 {
+		err = errors.New(strings.Join(errs, "\n"))
+	}
+	return filtered, err
+}
+
+func aptHistory() ([]*HistoryTransaction, error) {
+	logs, err := filepath.Glob(aptHistoryLog + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*HistoryTransaction
+	for _, l := range logs {
+		data, err := ioutil.ReadFile(l)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(l, ".gz") {
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("error reading %q: %v", l, err)
+			}
+			if data, err = ioutil.ReadAll(r); err != nil {
+				return nil, fmt.Errorf("error reading %q: %v", l, err)
+			}
+		}
+		txs = append(txs, parseAptHistory(data)...)
+	}
+	return txs, nil
+}
+
+func parseAptHistoryTime(s string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02 15:04:05", strings.Join(strings.Fields(s), " "), time.Local)
+	return t
+}
+
+func parseAptHistoryPackages(action, list string) []*HistoryChange {
+	var changes []*HistoryChange
+	for _, m := range aptHistoryPackageRe.FindAllStringSubmatch(list, -1) {
+		c := &HistoryChange{Action: action, Name: m[1]}
+		if i := strings.LastIndex(m[1], ":"); i > 0 {
+			c.Name, c.Arch = m[1][:i], osinfo.Architecture(m[1][i+1:])
+		}
+		// Versions are either "version", "version, automatic" or, for
+		// upgrades and downgrades, "previous, version".
+		versions := strings.Split(m[2], ", ")
+		c.Version = versions[0]
+		if len(versions) > 1 && versions[1] != "automatic" {
+			c.PreviousVersion, c.Version = versions[0], versions[1]
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func parseAptHistory(data []byte) []*HistoryTransaction {
+	/*
+	   Start-Date: 2024-01-02  10:11:12
+	   Commandline: apt-get install nmap
+	   Requested-By: alice (1000)
+	   Install: nmap:amd64 (7.80+dfsg1-2build1), liblinear4:amd64 (2.3.0+dfsg-3build1, automatic)
+	   Upgrade: bash:amd64 (5.0-6ubuntu1, 5.0-6ubuntu1.1)
+	   End-Date: 2024-01-02  10:11:15
+	*/
+	var txs []*HistoryTransaction
+	var tx *HistoryTransaction
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 10*1024*1024)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ": ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := kv[0], strings.TrimSpace(kv[1])
+		if key == "Start-Date" {
+			tx = &HistoryTransaction{Manager: ManagerApt, Start: parseAptHistoryTime(value)}
+			txs = append(txs, tx)
+			continue
+		}
+		if tx == nil {
+			continue
+		}
+		switch key {
+		case "End-Date":
+			tx.End = parseAptHistoryTime(value)
+		case "Commandline":
+			tx.CommandLine = value
+		case "Requested-By":
+			// "login (uid)"
+			if f := strings.Fields(value); len(f) > 0 {
+				tx.User = f[0]
+			}
+		case "Install", "Reinstall", "Upgrade", "Downgrade", "Remove", "Purge":
+			tx.Changes = append(tx.Changes, parseAptHistoryPackages(key, value)...)
+		}
+	}
+	return txs
+}
+
+func yumHistory(ctx context.Context) ([]*HistoryTransaction, error) {
+	out, err := runYumHistory(ctx, yumHistoryListArgs)
+	if err != nil {
+		return nil, err
+	}
+	ids, yum3 := parseYumHistoryList(out)
+	if yum3 {
+		out, err := runYumHistory(ctx, yumHistoryListAllArgs)
+		if err != nil {
+			return nil, err
+		}
+		all, _ := parseYumHistoryList(out)
+		ids = append(ids, all...)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	sort.Ints(ids)
+	args := append([]string{}, yumHistoryInfoArgs...)
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		args = append(args, strconv.Itoa(id))
+	}
+	return yumHistoryInfo(ctx, args)
+}
+
+func runYumHistory(ctx context.Context, args []string) ([]byte, error) {
+	cmd := commandContext(ctx, yum, args...)
+	// Times are printed in the locale format.
+	cmd.Env = commandEnvWith(ctx, "LC_ALL=C")
+	stdout, stderr, err := runnerFor(ManagerYum).Run(ctx, cmd)
+	if err != nil {
+		return nil, newCmdError(yum, args, stdout, stderr, err)
+	}
+	return stdout, nil
+}
+
+func yumHistoryInfo(ctx context.Context, args []string) ([]*HistoryTransaction, error) {
+	out, err := runYumHistory(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseYumHistory(out), nil
+}
+
+// YumLastTransaction returns the most recent yum or dnf transaction, nil if
+// the history is empty.
+func YumLastTransaction(ctx context.Context) (*HistoryTransaction, error) {
+	txs, err := yumHistoryInfo(ctx, yumHistoryLastArgs)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	return txs[len(txs)-1], nil
+}
+
+// UndoYumTransaction reverts the yum or dnf transaction with the given ID,
+// like the TransactionID recorded in a patch result.
+func UndoYumTransaction(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("no transaction ID to undo")
+	}
+	_, err := run(ctx, yum, append(yumHistoryUndoArgs, id))
+	return err
+}
+
+// UndoLastTransaction reverts the most recent yum or dnf transaction and
+// returns it, so the caller can check it was the one they meant to revert.
+// Prefer UndoYumTransaction with a recorded ID where there is one, other
+// transactions may have happened since.
+func UndoLastTransaction(ctx context.Context) (*HistoryTransaction, error) {
+	tx, err := YumLastTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, errors.New("yum history is empty, nothing to undo")
+	}
+	if err := UndoYumTransaction(ctx, tx.ID); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func parseYumHistoryTime(s string) time.Time {
+	// End times can be followed by the duration, like "(8 seconds)".
+	if i := strings.Index(s, " ("); i > 0 {
+		s = s[:i]
+	}
+	for _, layout := range yumHistoryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseYumHistoryList returns the transaction IDs of history list output,
+// and whether it looks like yum 3's, which has a "Login user" column.
+func parseYumHistoryList(data []byte) ([]int, bool) {
+	/*
+	   ID     | Command line             | Date and time    | Action(s)      | Altered
+	   -------------------------------------------------------------------------------
+	        5 | install nmap             | 2024-01-02 10:11 | Install        |    1
+	        4 |                          | 2024-01-01 09:00 | Install        |  350 EE
+	*/
+	var ids []int
+	var yum3 bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "ID" {
+			yum3 = strings.Contains(line, "Login user")
+			continue
+		}
+		if id, err := strconv.Atoi(fields[0]); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, yum3
+}
+
+func parseYumHistory(data []byte) []*HistoryTransaction {
+	/*
+	   Transaction ID : 5
+	   Begin time     : Tue Jan  2 10:11:12 2024
+	   Begin rpmdb    : 123:0123456789abcdef
+	   End time       : Tue Jan  2 10:11:20 2024 (8 seconds)
+	   User           : Alice <alice>
+	   Return-Code    : Success
+	   Command Line   : install nmap
+	   Packages Altered:
+	       Install  nmap-2:7.70-6.el8.x86_64     @appstream
+	       Upgrade  bash-4.4.20-2.el8.x86_64     @baseos
+	       Upgraded bash-4.4.19-1.el8.x86_64     @@System
+	*/
+	var txs []*HistoryTransaction
+	var tx *HistoryTransaction
+	var altered bool
+	// begin is the begin time as printed, nameCol the column of the package
+	// names of the last change.
+	var begin string
+	var nameCol int
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if altered && strings.HasPrefix(line, " ") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && fields[0] == "**" {
+				// Marks problems with the rpmdb, not part of the change.
+				fields = fields[1:]
+			}
+			if len(fields) < 2 {
+				continue
+			}
+			nevra, col := fields[1], strings.Index(line, " "+fields[1])+1
+			// yum 3 blanks out the name of the package on the line following
+			// the one it was updated or downgraded from, like
+			//     Updated     bash-4.2.46-34.el7.x86_64    @anaconda
+			//     Update           4.2.46-35.el7_9.x86_64  @updates
+			if n := len(tx.Changes); n > 0 && col == nameCol+len(tx.Changes[n-1].Name)+1 {
+				nevra = tx.Changes[n-1].Name + "-" + nevra
+			} else {
+				nameCol = col
+			}
+			if pkg, ok := parseRPMNEVRA(nevra); ok {
+				tx.Changes = append(tx.Changes, &HistoryChange{Action: fields[0], Name: pkg.Name, Arch: pkg.Arch, Version: pkg.Version})
+			}
+			continue
+		}
+		altered = false
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if key == "Transaction ID" {
+			tx = &HistoryTransaction{Manager: ManagerYum, ID: value}
+			txs = append(txs, tx)
+			continue
+		}
+		if tx == nil {
+			continue
+		}
+		switch key {
+		case "Begin time":
+			begin = value
+			tx.Start = parseYumHistoryTime(value)
+		case "End time":
+			// yum 3 leaves out what the end time has in common with the begin
+			// time, like "           10:11:20 2024 (8 seconds)".
+			if i := strings.Index(value, " ("); i > 0 {
+				value = value[:i]
+			}
+			if len(value) < len(begin) {
+				value = begin[:len(begin)-len(value)] + value
+			}
+			tx.End = parseYumHistoryTime(value)
+		case "User":
+			// "Full Name <login>", with "<unset>" for the system user.
+			if i, j := strings.LastIndex(value, "<"), strings.LastIndex(value, ">"); i >= 0 && j > i {
+				value = value[i+1 : j]
+			}
+			if value != "unset" {
+				tx.User = value
+			}
+		case "Command Line":
+			tx.CommandLine = value
+		case "Packages Altered":
+			altered = true
+		}
+	}
+	return txs
+}
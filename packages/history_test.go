@@ -0,0 +1,269 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAptHistory(t *testing.T) {
+	data := []byte(`
+Start-Date: 2024-01-02  10:11:12
+Commandline: apt-get install nmap
+Requested-By: alice (1000)
+Install: nmap:amd64 (7.80+dfsg1-2build1), liblinear4:amd64 (2.3.0+dfsg-3build1, automatic)
+Upgrade: bash:amd64 (5.0-6ubuntu1, 5.0-6ubuntu1.1)
+End-Date: 2024-01-02  10:11:15
+
+Start-Date: 2024-01-03  08:00:00
+Commandline: /usr/bin/unattended-upgrade
+Remove: nmap:amd64 (7.80+dfsg1-2build1)
+End-Date: 2024-01-03  08:00:01
+`)
+	want := []*HistoryTransaction{
+		{
+			Manager:     ManagerApt,
+			Start:       time.Date(2024, 1, 2, 10, 11, 12, 0, time.Local),
+			End:         time.Date(2024, 1, 2, 10, 11, 15, 0, time.Local),
+			User:        "alice",
+			CommandLine: "apt-get install nmap",
+			Changes: []*HistoryChange{
+				{Action: "Install", Name: "nmap", Arch: "x86_64", Version: "7.80+dfsg1-2build1"},
+				{Action: "Install", Name: "liblinear4", Arch: "x86_64", Version: "2.3.0+dfsg-3build1"},
+				{Action: "Upgrade", Name: "bash", Arch: "x86_64", Version: "5.0-6ubuntu1.1", PreviousVersion: "5.0-6ubuntu1"},
+			},
+		},
+		{
+			Manager:     ManagerApt,
+			Start:       time.Date(2024, 1, 3, 8, 0, 0, 0, time.Local),
+			End:         time.Date(2024, 1, 3, 8, 0, 1, 0, time.Local),
+			CommandLine: "/usr/bin/unattended-upgrade",
+			Changes: []*HistoryChange{
+				{Action: "Remove", Name: "nmap", Arch: "x86_64", Version: "7.80+dfsg1-2build1"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, parseAptHistory(data)); diff != "" {
+		t.Errorf("parseAptHistory() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseYumHistory(t *testing.T) {
+	data := []byte(`Transaction ID : 5
+Begin time     : Tue Jan  2 10:11:12 2024
+Begin rpmdb    : 123:0123456789abcdef
+End time       : Tue Jan  2 10:11:20 2024 (8 seconds)
+User           : Alice <alice>
+Return-Code    : Success
+Command Line   : install nmap
+Packages Altered:
+    Install  nmap-2:7.70-6.el8.x86_64     @appstream
+    Upgrade  bash-4.4.20-2.el8.x86_64     @baseos
+    Upgraded bash-4.4.19-1.el8.x86_64     @@System
+Scriptlet output:
+   1 some output
+Transaction ID : 4
+Begin time     : Mon Jan  1 09:00:00 2024
+User           : System <unset>
+Command Line   :
+Packages Altered:
+ ** Install  foo-1.0-1.noarch @base
+`)
+	want := []*HistoryTransaction{
+		{
+			Manager:     ManagerYum,
+			ID:          "5",
+			Start:       time.Date(2024, 1, 2, 10, 11, 12, 0, time.Local),
+			End:         time.Date(2024, 1, 2, 10, 11, 20, 0, time.Local),
+			User:        "alice",
+			CommandLine: "install nmap",
+			Changes: []*HistoryChange{
+				{Action: "Install", Name: "nmap", Arch: "x86_64", Version: "2:7.70-6.el8"},
+				{Action: "Upgrade", Name: "bash", Arch: "x86_64", Version: "4.4.20-2.el8"},
+				{Action: "Upgraded", Name: "bash", Arch: "x86_64", Version: "4.4.19-1.el8"},
+			},
+		},
+		{
+			Manager: ManagerYum,
+			ID:      "4",
+			Start:   time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local),
+			Changes: []*HistoryChange{
+				{Action: "Install", Name: "foo", Arch: "all", Version: "1.0-1"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, parseYumHistory(data)); diff != "" {
+		t.Errorf("parseYumHistory() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func readHistoryFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "history", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestYumHistory(t *testing.T) {
+	changes := func(tx *HistoryTransaction) []string {
+		var s []string
+		for _, c := range tx.Changes {
+			s = append(s, c.Action+" "+c.Name+" "+c.Version+" "+c.Arch)
+		}
+		return s
+	}
+	type want struct {
+		id, user, cmd string
+		start, end    time.Time
+		changes       []string
+	}
+	tests := []struct {
+		desc     string
+		commands []expectedCommand
+		want     []want
+	}{
+		{
+			desc: "dnf",
+			commands: []expectedCommand{
+				{cmd: exec.Command(yum, yumHistoryListArgs...), envs: []string{"LC_ALL=C"}, stdout: readHistoryFixture(t, "dnf_list.txt")},
+				{cmd: exec.Command(yum, "history", "info", "3", "4", "5"), envs: []string{"LC_ALL=C"}, stdout: readHistoryFixture(t, "dnf_info.txt")},
+			},
+			want: []want{
+				{"3", "", "", time.Date(2023, 12, 1, 8, 0, 12, 0, time.Local), time.Date(2023, 12, 1, 8, 3, 40, 0, time.Local), []string{
+					"Install basesystem 11-5.el8 all",
+				}},
+				{"4", "root", "upgrade bash", time.Date(2024, 1, 1, 9, 30, 2, 0, time.Local), time.Date(2024, 1, 1, 9, 30, 9, 0, time.Local), []string{
+					"Upgrade bash 4.4.20-2.el8 x86_64",
+					"Upgraded bash 4.4.19-1.el8 x86_64",
+				}},
+				{"5", "alice", "install nmap", time.Date(2024, 1, 2, 10, 11, 12, 0, time.Local), time.Date(2024, 1, 2, 10, 11, 20, 0, time.Local), []string{
+					"Install nmap 2:7.70-6.el8 x86_64",
+				}},
+			},
+		},
+		{
+			desc: "yum 3",
+			commands: []expectedCommand{
+				{cmd: exec.Command(yum, yumHistoryListArgs...), envs: []string{"LC_ALL=C"}, stdout: readHistoryFixture(t, "yum_list.txt")},
+				{cmd: exec.Command(yum, yumHistoryListAllArgs...), envs: []string{"LC_ALL=C"}, stdout: readHistoryFixture(t, "yum_list.txt")},
+				{cmd: exec.Command(yum, "history", "info", "1", "2", "3"), envs: []string{"LC_ALL=C"}, stdout: readHistoryFixture(t, "yum_info.txt")},
+			},
+			want: []want{
+				{"1", "", "", time.Date(2023, 12, 1, 8, 0, 12, 0, time.Local), time.Date(2023, 12, 1, 8, 4, 51, 0, time.Local), []string{
+					"Install basesystem 10.0-7.el7.centos all",
+				}},
+				{"2", "root", "update bash", time.Date(2024, 1, 1, 9, 30, 2, 0, time.Local), time.Date(2024, 1, 1, 9, 30, 9, 0, time.Local), []string{
+					"Updated bash 4.2.46-34.el7 x86_64",
+					"Update bash 4.2.46-35.el7_9 x86_64",
+					"Dep-Install libpcap 14:1.5.3-13.el7_9 x86_64",
+				}},
+				{"3", "alice", "install nmap", time.Date(2024, 1, 2, 10, 11, 12, 0, time.Local), time.Date(2024, 1, 2, 10, 11, 20, 0, time.Local), []string{
+					"Install nmap 2:6.40-19.el7 x86_64",
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+			runner = mockCommandRunner
+			setExpectations(mockCommandRunner, tt.commands)
+
+			txs, err := yumHistory(testCtx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []want
+			for _, tx := range txs {
+				got = append(got, want{tx.ID, tx.User, tx.CommandLine, tx.Start, tx.End, changes(tx)})
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("yumHistory() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestYumHistoryEmpty(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	listCmd := exec.Command(yum, yumHistoryListArgs...)
+	listCmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(listCmd)).Return([]byte("No transactions\n"), nil, nil).Times(1)
+	got, err := yumHistory(testCtx)
+	if err != nil || len(got) != 0 {
+		t.Errorf("yumHistory() = %v, %v, want no transactions", got, err)
+	}
+}
+
+func TestUndoLastTransaction(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	lastCmd := exec.Command(yum, yumHistoryLastArgs...)
+	lastCmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	setExpectations(mockCommandRunner, []expectedCommand{
+		{
+			cmd:    lastCmd,
+			stdout: []byte("Transaction ID : 7\nCommand Line   : update -y\n"),
+		},
+		{
+			cmd:    exec.Command(yum, "history", "undo", "-y", "7"),
+			stdout: []byte("Complete!"),
+		},
+	})
+	got, err := UndoLastTransaction(testCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != "7" || got.CommandLine != "update -y" {
+		t.Errorf("UndoLastTransaction() = %+v, want transaction 7", got)
+	}
+}
+
+func TestUndoLastTransactionEmptyHistory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	lastCmd := exec.Command(yum, yumHistoryLastArgs...)
+	lastCmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(lastCmd)).Return([]byte("No transactions\n"), nil, nil).Times(1)
+	if _, err := UndoLastTransaction(testCtx); err == nil {
+		t.Error("UndoLastTransaction() did not return an error for an empty history")
+	}
+}
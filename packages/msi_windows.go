@@ -37,6 +37,15 @@ var (
 	procMsiCloseHandle         = msi.NewProc("MsiCloseHandle")
 	procMsiInstallProductW     = msi.NewProc("MsiInstallProductW")
 	procMsiSetInternalUI       = msi.NewProc("MsiSetInternalUI")
+	procMsiEnumProductsW       = msi.NewProc("MsiEnumProductsW")
+	procMsiGetProductInfoW     = msi.NewProc("MsiGetProductInfoW")
+	procMsiConfigureProductW   = msi.NewProc("MsiConfigureProductW")
+
+	// The Windows Installer calls used to list and remove products, replaced
+	// in tests.
+	msiEnumProducts     = msiEnumProductsW
+	msiGetProductInfo   = msiGetProductInfoW
+	msiConfigureProduct = msiConfigureProductW
 
 	once sync.Once
 )
@@ -187,6 +196,108 @@ func msiInstallProductW(szPackagePath string, szCommandLine []string) error {
 	return nil
 }
 
+const (
+	errorMoreData              = 234
+	errorNoMoreItems           = 259
+	errorUnknownProperty       = 1608
+	errorSuccessRebootRequired = 3010
+	msiProductCodeLength       = 38
+	installLevelDefault        = 0
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/msi/nf-msi-msienumproductsw
+func msiEnumProductsW(iProductIndex uint32) (string, bool, error) {
+	/*
+		UINT MsiEnumProductsW(
+		  DWORD  iProductIndex,
+		  LPWSTR lpProductBuf
+		);
+	*/
+	lpProductBuf := make([]uint16, msiProductCodeLength+1)
+
+	ret, _, _ := procMsiEnumProductsW.Call(
+		uintptr(iProductIndex),
+		uintptr(unsafe.Pointer(&lpProductBuf[0])),
+	)
+	if ret == errorNoMoreItems {
+		return "", false, nil
+	}
+	if ret != 0 {
+		return "", false, fmt.Errorf("MsiEnumProductsW error: %s", syscall.Errno(ret))
+	}
+	return syscall.UTF16ToString(lpProductBuf), true, nil
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/msi/nf-msi-msigetproductinfow
+func msiGetProductInfoW(szProduct, szAttribute string) (string, error) {
+	/*
+		UINT MsiGetProductInfoW(
+		  LPCWSTR szProduct,
+		  LPCWSTR szAttribute,
+		  LPWSTR  lpValueBuf,
+		  LPDWORD pcchValueBuf
+		);
+	*/
+
+	szProductPtr, err := syscall.UTF16PtrFromString(szProduct)
+	if err != nil {
+		return "", fmt.Errorf("error encoding szProduct to UTF16: %v", err)
+	}
+	szAttributePtr, err := syscall.UTF16PtrFromString(szAttribute)
+	if err != nil {
+		return "", fmt.Errorf("error encoding szAttribute to UTF16: %v", err)
+	}
+
+	size := uint32(128)
+	for {
+		lpValueBuf := make([]uint16, size)
+		ret, _, _ := procMsiGetProductInfoW.Call(
+			uintptr(unsafe.Pointer(szProductPtr)),
+			uintptr(unsafe.Pointer(szAttributePtr)),
+			uintptr(unsafe.Pointer(&lpValueBuf[0])),
+			uintptr(unsafe.Pointer(&size)),
+		)
+		switch ret {
+		case 0:
+			return syscall.UTF16ToString(lpValueBuf), nil
+		case errorMoreData:
+			// size is set to the length of the value without the terminating null.
+			size++
+		case errorUnknownProperty:
+			// The property is not set for this product.
+			return "", nil
+		default:
+			return "", fmt.Errorf("MsiGetProductInfoW error: %s", syscall.Errno(ret))
+		}
+	}
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/msi/nf-msi-msiconfigureproductw
+func msiConfigureProductW(szProduct string, iInstallLevel int32, eInstallState msiInstallState) error {
+	/*
+		UINT MsiConfigureProductW(
+		  LPCWSTR      szProduct,
+		  int          iInstallLevel,
+		  INSTALLSTATE eInstallState
+		);
+	*/
+
+	szProductPtr, err := syscall.UTF16PtrFromString(szProduct)
+	if err != nil {
+		return fmt.Errorf("error encoding szProduct to UTF16: %v", err)
+	}
+
+	ret, _, _ := procMsiConfigureProductW.Call(
+		uintptr(unsafe.Pointer(szProductPtr)),
+		uintptr(iInstallLevel),
+		uintptr(eInstallState),
+	)
+	if ret != 0 && ret != errorSuccessRebootRequired {
+		return fmt.Errorf("MsiConfigureProductW error: %s", syscall.Errno(ret))
+	}
+	return nil
+}
+
 // MSIInfo returns the ProductName and ProductCode for an MSI.
 func MSIInfo(path string) (string, string, error) {
 	setUIMode()
@@ -245,3 +356,53 @@ func InstallMSIPackage(ctx context.Context, path string, args []string) error {
 
 	return nil
 }
+
+// InstalledMSIProducts returns all products installed by Windows Installer.
+func InstalledMSIProducts(ctx context.Context) ([]*MSIProduct, error) {
+	setUIMode()
+
+	if err := coInitializeEx(); err != nil {
+		return nil, err
+	}
+	defer ole.CoUninitialize()
+
+	var products []*MSIProduct
+	for i := uint32(0); ; i++ {
+		productCode, ok, err := msiEnumProducts(i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return products, nil
+		}
+
+		product := &MSIProduct{ProductCode: productCode}
+		for attr, dst := range map[string]*string{
+			"InstalledProductName": &product.ProductName,
+			"VersionString":        &product.Version,
+			"Publisher":            &product.Publisher,
+		} {
+			if *dst, err = msiGetProductInfo(productCode, attr); err != nil {
+				clog.Debugf(ctx, "Error getting %s for MSI product %q: %v", attr, productCode, err)
+			}
+		}
+		products = append(products, product)
+	}
+}
+
+// RemoveMSIProduct uninstalls the msi product with the given ProductCode.
+func RemoveMSIProduct(ctx context.Context, productCode string) error {
+	setUIMode()
+
+	if err := coInitializeEx(); err != nil {
+		return err
+	}
+	defer ole.CoUninitialize()
+
+	clog.Infof(ctx, "Removing msi product %q.", productCode)
+	if err := msiConfigureProduct(productCode, installLevelDefault, INSTALLSTATE_ABSENT); err != nil {
+		return fmt.Errorf("error removing MSI product %q: %v", productCode, err)
+	}
+
+	return nil
+}
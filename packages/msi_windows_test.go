@@ -0,0 +1,92 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fakeMSI(t *testing.T, codes []string, info map[string]map[string]string) {
+	oldEnum, oldInfo := msiEnumProducts, msiGetProductInfo
+	t.Cleanup(func() { msiEnumProducts, msiGetProductInfo = oldEnum, oldInfo })
+	msiEnumProducts = func(i uint32) (string, bool, error) {
+		if int(i) >= len(codes) {
+			return "", false, nil
+		}
+		return codes[i], true, nil
+	}
+	msiGetProductInfo = func(code, attr string) (string, error) {
+		if attr == "Publisher" && code == "{B}" {
+			return "", errors.New("access denied")
+		}
+		return info[code][attr], nil
+	}
+}
+
+func TestInstalledMSIProducts(t *testing.T) {
+	fakeMSI(t, []string{"{A}", "{B}"}, map[string]map[string]string{
+		"{A}": {"InstalledProductName": "Product A", "VersionString": "1.2.3", "Publisher": "Example"},
+		"{B}": {"InstalledProductName": "Product B", "VersionString": "4.5"},
+	})
+
+	got, err := InstalledMSIProducts(context.Background())
+	if err != nil {
+		t.Fatalf("InstalledMSIProducts() error: %v", err)
+	}
+	// An attribute that can't be read is left empty.
+	want := []*MSIProduct{
+		{ProductCode: "{A}", ProductName: "Product A", Version: "1.2.3", Publisher: "Example"},
+		{ProductCode: "{B}", ProductName: "Product B", Version: "4.5"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InstalledMSIProducts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestInstalledMSIProductsEnumError(t *testing.T) {
+	fakeMSI(t, nil, nil)
+	msiEnumProducts = func(uint32) (string, bool, error) { return "", false, errors.New("MsiEnumProductsW error") }
+
+	if _, err := InstalledMSIProducts(context.Background()); err == nil {
+		t.Error("InstalledMSIProducts() succeeded, want the enumeration error")
+	}
+}
+
+func TestRemoveMSIProduct(t *testing.T) {
+	old := msiConfigureProduct
+	defer func() { msiConfigureProduct = old }()
+
+	var gotCode string
+	var gotState msiInstallState
+	msiConfigureProduct = func(code string, _ int32, state msiInstallState) error {
+		gotCode, gotState = code, state
+		return nil
+	}
+	if err := RemoveMSIProduct(context.Background(), "{A}"); err != nil {
+		t.Fatalf("RemoveMSIProduct() error: %v", err)
+	}
+	if gotCode != "{A}" || gotState != INSTALLSTATE_ABSENT {
+		t.Errorf("configured %q to state %d, want {A} to %d", gotCode, gotState, INSTALLSTATE_ABSENT)
+	}
+
+	msiConfigureProduct = func(string, int32, msiInstallState) error { return errors.New("MsiConfigureProductW error: 1605") }
+	if err := RemoveMSIProduct(context.Background(), "{A}"); err == nil || !strings.Contains(err.Error(), `removing MSI product "{A}"`) {
+		t.Errorf("RemoveMSIProduct() error = %v, want it to name the product", err)
+	}
+}
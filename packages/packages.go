@@ -19,10 +19,13 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/metrics"
 	"github.com/GoogleCloudPlatform/osconfig/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/util"
 )
@@ -48,6 +51,8 @@ var (
 	GemExists bool
 	// PipExists indicates whether pip is installed.
 	PipExists bool
+	// BrewExists indicates whether Homebrew is installed.
+	BrewExists bool
 	// GooGetExists indicates whether googet is installed.
 	GooGetExists bool
 	// MSIExists indicates whether MSIs can be installed.
@@ -58,6 +63,29 @@ var (
 	runner = util.CommandRunner(&util.DefaultRunner{})
 
 	ptyrunner = util.CommandRunner(&ptyRunner{})
+
+	managerRunners   = map[Manager]util.CommandRunner{}
+	managerRunnersMx sync.RWMutex
+	// auditRedact is the extra redaction list of the command audit, nil if
+	// commands are not audited.
+	auditRedact []string
+)
+
+// Manager identifies a package manager whose commands can be run by a
+// dedicated CommandRunner, see SetManagerCommandRunner.
+type Manager string
+
+// Package managers that can have their own CommandRunner.
+const (
+	ManagerApt    Manager = "apt"
+	ManagerDpkg   Manager = "dpkg"
+	ManagerYum    Manager = "yum"
+	ManagerRPM    Manager = "rpm"
+	ManagerZypper Manager = "zypper"
+	ManagerGooGet Manager = "googet"
+	ManagerGem    Manager = "gem"
+	ManagerPip    Manager = "pip"
+	ManagerBrew   Manager = "brew"
 )
 
 // Packages is a selection of packages based on their manager.
@@ -71,9 +99,11 @@ type Packages struct {
 	COS                []*PkgInfo            `json:"cos,omitempty"`
 	Gem                []*PkgInfo            `json:"gem,omitempty"`
 	Pip                []*PkgInfo            `json:"pip,omitempty"`
+	Brew               []*PkgInfo            `json:"brew,omitempty"`
 	GooGet             []*PkgInfo            `json:"googet,omitempty"`
 	WUA                []*WUAPackage         `json:"wua,omitempty"`
 	QFE                []*QFEPackage         `json:"qfe,omitempty"`
+	MSI                []*MSIProduct         `json:"msi,omitempty"`
 	WindowsApplication []*WindowsApplication `json:"-"`
 }
 
@@ -81,7 +111,46 @@ type Packages struct {
 type PkgInfo struct {
 	Name, Arch, Version string
 
+	// Epoch is the epoch of deb and rpm package versions, which is also
+	// included in Version, or empty if the version has none. Use
+	// CompareDebVersions or CompareRPMEVR to compare versions.
+	Epoch string `json:",omitempty"`
+
 	Source Source
+
+	// Category and EbuildVersion are only populated for COS packages, where
+	// Name is reported as "category/name".
+	Category      string `json:",omitempty"`
+	EbuildVersion string `json:",omitempty"`
+
+	// AptCandidate is only populated for apt updates when requested.
+	AptCandidate *AptCandidate `json:",omitempty"`
+
+	// Repository and Size are only populated for updates, with the
+	// repository providing the update and its download size in bytes, when
+	// the package manager reports them.
+	Repository string `json:",omitempty"`
+	Size       int64  `json:",omitempty"`
+
+	// AutoInstalled is set for installed deb and rpm packages the package
+	// manager installed as a dependency rather than by request, the ones
+	// autoremove may remove once nothing depends on them.
+	AutoInstalled bool `json:",omitempty"`
+}
+
+// AptCandidate describes where an apt update candidate comes from, as
+// reported by apt-cache policy.
+type AptCandidate struct {
+	// Origins are the repositories that provide the candidate, formatted as
+	// "URI suite/component", e.g.
+	// "http://security.ubuntu.com/ubuntu bionic-security/main".
+	Origins []string
+	// Priority is the pin priority of the candidate version.
+	Priority int
+	// Phased is set if the candidate is subject to a phased update, with
+	// PhasedPercentage being the percentage of machines it is rolled out to.
+	Phased           bool
+	PhasedPercentage int
 }
 
 // Source represents source package from which binary package was built.
@@ -98,6 +167,24 @@ type ZypperPatch struct {
 	Name, Category, Severity, Summary string
 }
 
+// WUAInstallResult is the outcome of installing a single update with
+// InstallWUAUpdates.
+type WUAInstallResult struct {
+	// ResultCode is the OperationResultCode of the update: 2 succeeded, 3
+	// succeeded with errors, 4 failed and 5 aborted.
+	ResultCode int32
+	// HResult is the error code if the update failed, e.g. 0x8024401c.
+	HResult uint32
+	// RebootRequired reports whether the update needs a reboot to finish
+	// installing.
+	RebootRequired bool
+}
+
+// Succeeded reports whether the update was installed.
+func (r *WUAInstallResult) Succeeded() bool {
+	return r.ResultCode == 2 || r.ResultCode == 3
+}
+
 // WUAPackage describes a Windows Update Agent package.
 type WUAPackage struct {
 	LastDeploymentChangeTime time.Time
@@ -117,6 +204,11 @@ type QFEPackage struct {
 	Caption, Description, HotFixID, InstalledOn string
 }
 
+// MSIProduct describes a product installed by Windows Installer.
+type MSIProduct struct {
+	ProductCode, ProductName, Version, Publisher string
+}
+
 // WindowsApplication describes a Windows Application.
 type WindowsApplication struct {
 	DisplayName    string
@@ -126,10 +218,65 @@ type WindowsApplication struct {
 	HelpLink       string
 }
 
+// managerOf returns the Manager a package manager binary belongs to.
+func managerOf(cmd string) Manager {
+	switch cmd {
+	case aptGet, aptCache, aptMark:
+		return ManagerApt
+	case dpkg, dpkgQuery, dpkgDeb:
+		return ManagerDpkg
+	case yum:
+		return ManagerYum
+	case rpm, rpmquery:
+		return ManagerRPM
+	case zypper:
+		return ManagerZypper
+	case googet:
+		return ManagerGooGet
+	case gem:
+		return ManagerGem
+	case pip:
+		return ManagerPip
+	case brew:
+		return ManagerBrew
+	}
+	return ""
+}
+
+// audited wraps r in a util.AuditRunner if commands are audited, called with
+// managerRunnersMx held.
+func audited(r util.CommandRunner) util.CommandRunner {
+	if auditRedact == nil {
+		return r
+	}
+	return util.ChainRunners(r, util.Audit(auditRedact))
+}
+
+// runnerFor returns the CommandRunner for commands of the given manager.
+func runnerFor(m Manager) util.CommandRunner {
+	managerRunnersMx.RLock()
+	defer managerRunnersMx.RUnlock()
+	if r, ok := managerRunners[m]; ok {
+		return audited(r)
+	}
+	return audited(runner)
+}
+
+// ptyRunnerFor returns the CommandRunner for commands of the given manager
+// that need to run in a pty.
+func ptyRunnerFor(m Manager) util.CommandRunner {
+	managerRunnersMx.RLock()
+	defer managerRunnersMx.RUnlock()
+	if r, ok := managerRunners[m]; ok {
+		return audited(r)
+	}
+	return audited(ptyrunner)
+}
+
 func run(ctx context.Context, cmd string, args []string) ([]byte, error) {
-	stdout, stderr, err := runner.Run(ctx, exec.CommandContext(ctx, cmd, args...))
+	stdout, stderr, err := runnerFor(managerOf(cmd)).Run(ctx, commandContext(ctx, cmd, args...))
 	if err != nil {
-		return nil, fmt.Errorf("error running %s with args %q: %v, stdout: %q, stderr: %q", cmd, args, err, stdout, stderr)
+		return nil, newCmdError(cmd, args, stdout, stderr, err)
 	}
 	return stdout, nil
 }
@@ -140,11 +287,19 @@ func runWithDeadline(ctx context.Context, timeout time.Duration, cmd string, arg
 	return run(ctxWithTimeout, cmd, args)
 }
 
+// observeInventory records the duration of listing the installed packages
+// of manager since start.
+func observeInventory(manager string, start time.Time, err error) {
+	metrics.InventoryDuration.ObserveDuration(time.Since(start), manager, metrics.Result(err))
+}
+
 type ptyRunner struct{}
 
 func (p *ptyRunner) Run(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
 	clog.Debugf(ctx, "Running %q with args %q\n", cmd.Path, cmd.Args[1:])
+	start := time.Now()
 	stdout, stderr, err := runWithPty(cmd)
+	metrics.CommandDuration.ObserveDuration(time.Since(start), filepath.Base(cmd.Path), metrics.Result(err))
 	clog.Debugf(ctx, "%s %q output:\n%s", cmd.Path, cmd.Args[1:], strings.ReplaceAll(string(stdout), "\n", "\n "))
 	return stdout, stderr, err
 }
@@ -154,6 +309,32 @@ func SetCommandRunner(commandRunner util.CommandRunner) {
 	runner = commandRunner
 }
 
+// SetManagerCommandRunner sets the commandRunner used for all commands of a
+// single package manager, including the ones that would otherwise run in a pty.
+// Other managers keep using the runners set by SetCommandRunner and
+// SetPtyCommandRunner. Setting a nil commandRunner removes the override.
+func SetManagerCommandRunner(m Manager, commandRunner util.CommandRunner) {
+	managerRunnersMx.Lock()
+	defer managerRunnersMx.Unlock()
+	if commandRunner == nil {
+		delete(managerRunners, m)
+		return
+	}
+	managerRunners[m] = commandRunner
+}
+
+// SetCommandAudit turns the command audit of all package manager commands on
+// or off, see util.AuditRunner. redact are words marking arguments as
+// sensitive in addition to util.DefaultAuditRedact.
+func SetCommandAudit(enabled bool, redact []string) {
+	managerRunnersMx.Lock()
+	defer managerRunnersMx.Unlock()
+	auditRedact = nil
+	if enabled {
+		auditRedact = append([]string{}, redact...)
+	}
+}
+
 // SetPtyCommandRunner allows external clients to set a custom
 // custom commandRunner.
 func SetPtyCommandRunner(commandRunner util.CommandRunner) {
@@ -0,0 +1,115 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+// GetPackageUpdates gets all available package updates from any known
+// installed package manager. brew is the package manager of macOS, only
+// its errors are returned.
+func GetPackageUpdates(ctx context.Context) (*Packages, error) {
+	pkgs := Packages{}
+	var errs []string
+	if BrewExists {
+		brew, err := BrewUpdates(ctx)
+		if err != nil {
+			msg := fmt.Sprintf("error getting brew updates: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+		} else {
+			pkgs.Brew = brew
+		}
+	}
+	if GemExists {
+		gem, err := GemUpdates(ctx)
+		if err != nil {
+			msg := fmt.Sprintf("error getting gem updates: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+		} else {
+			pkgs.Gem = gem
+		}
+	}
+	if PipExists {
+		pip, err := PipUpdates(ctx)
+		if err != nil {
+			msg := fmt.Sprintf("error getting pip updates: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+		} else {
+			pkgs.Pip = pip
+		}
+	}
+
+	var err error
+	if len(errs) != 0 {
+		err = errors.New(strings.Join(errs, "\n"))
+	}
+	return &pkgs, err
+}
+
+// GetInstalledPackages gets all installed packages from any known installed
+// package manager. brew is the package manager of macOS, only its errors
+// are returned.
+func GetInstalledPackages(ctx context.Context) (*Packages, error) {
+	pkgs := &Packages{}
+	var errs []string
+	if BrewExists {
+		start := time.Now()
+		brew, err := InstalledBrewPackages(ctx)
+		observeInventory("brew", start, err)
+		if err != nil {
+			msg := fmt.Sprintf("error listing installed brew packages: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+			errs = append(errs, msg)
+		} else {
+			pkgs.Brew = brew
+		}
+	}
+	if GemExists {
+		start := time.Now()
+		gem, err := InstalledGemPackages(ctx)
+		observeInventory("gem", start, err)
+		if err != nil {
+			msg := fmt.Sprintf("error listing installed gem packages: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+		} else {
+			pkgs.Gem = gem
+		}
+	}
+	if PipExists {
+		start := time.Now()
+		pip, err := InstalledPipPackages(ctx)
+		observeInventory("pip", start, err)
+		if err != nil {
+			msg := fmt.Sprintf("error listing installed pip packages: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+		} else {
+			pkgs.Pip = pip
+		}
+	}
+
+	var err error
+	if len(errs) != 0 {
+		err = errors.New(strings.Join(errs, "\n"))
+	}
+	return pkgs, err
+}
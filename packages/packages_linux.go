@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 )
@@ -83,6 +84,15 @@ func GetPackageUpdates(ctx context.Context) (*Packages, error) {
 			pkgs.Pip = pip
 		}
 	}
+	if BrewExists {
+		brew, err := BrewUpdates(ctx)
+		if err != nil {
+			msg := fmt.Sprintf("error getting brew updates: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+		} else {
+			pkgs.Brew = brew
+		}
+	}
 
 	var err error
 	if len(errs) != 0 {
@@ -92,12 +102,15 @@ func GetPackageUpdates(ctx context.Context) (*Packages, error) {
 }
 
 // GetInstalledPackages gets all installed packages from any known installed
-// package manager.
+// package manager. The deb and rpm packages are only listed again if their
+// database changed since the last call.
 func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 	pkgs := &Packages{}
 	var errs []string
 	if RPMQueryExists {
-		rpm, err := InstalledRPMPackages(ctx)
+		start := time.Now()
+		rpm, err := cachedInstalledRPMPackages(ctx)
+		observeInventory("rpm", start, err)
 		if err != nil {
 			msg := fmt.Sprintf("error listing installed rpm packages: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
@@ -107,7 +120,9 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 		}
 	}
 	if ZypperExists {
+		start := time.Now()
 		zypperPatches, err := ZypperInstalledPatches(ctx)
+		observeInventory("zypper_patches", start, err)
 		if err != nil {
 			msg := fmt.Sprintf("error getting zypper installed patches: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
@@ -116,8 +131,10 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 			pkgs.ZypperPatches = zypperPatches
 		}
 	}
-	if DpkgQueryExists {
-		deb, err := InstalledDebPackages(ctx)
+	if DpkgQueryExists || dpkgDBExists() {
+		start := time.Now()
+		deb, err := cachedInstalledDebPackages(ctx)
+		observeInventory("deb", start, err)
 		if err != nil {
 			msg := fmt.Sprintf("error listing installed deb packages: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
@@ -126,8 +143,11 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 			pkgs.Deb = deb
 		}
 	}
+	markAutoInstalled(ctx, pkgs)
 	if COSPkgInfoExists {
+		start := time.Now()
 		cos, err := InstalledCOSPackages()
+		observeInventory("cos", start, err)
 		if err != nil {
 			msg := fmt.Sprintf("error listing installed COS packages: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
@@ -137,7 +157,9 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 		}
 	}
 	if GemExists {
+		start := time.Now()
 		gem, err := InstalledGemPackages(ctx)
+		observeInventory("gem", start, err)
 		if err != nil {
 			msg := fmt.Sprintf("error listing installed gem packages: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
@@ -146,7 +168,9 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 		}
 	}
 	if PipExists {
+		start := time.Now()
 		pip, err := InstalledPipPackages(ctx)
+		observeInventory("pip", start, err)
 		if err != nil {
 			msg := fmt.Sprintf("error listing installed pip packages: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
@@ -154,6 +178,17 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 			pkgs.Pip = pip
 		}
 	}
+	if BrewExists {
+		start := time.Now()
+		brew, err := InstalledBrewPackages(ctx)
+		observeInventory("brew", start, err)
+		if err != nil {
+			msg := fmt.Sprintf("error listing installed brew packages: %v", err)
+			clog.Debugf(ctx, "Error: %s", msg)
+		} else {
+			pkgs.Brew = brew
+		}
+	}
 
 	var err error
 	if len(errs) != 0 {
@@ -19,6 +19,11 @@ import (
 	"io/ioutil"
 	"os/exec"
 	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
 )
 
 var pkgs = []string{"pkg1", "pkg2"}
@@ -39,3 +44,76 @@ func helperLoadBytes(name string) ([]byte, error) {
 	}
 	return bytes, nil
 }
+
+func TestSetManagerCommandRunner(t *testing.T) {
+	if yum == "" || rpmquery == "" {
+		t.Skip("yum and rpmquery are not set on this platform")
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defaultRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	yumRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = defaultRunner
+	SetManagerCommandRunner(ManagerYum, yumRunner)
+	defer SetManagerCommandRunner(ManagerYum, nil)
+
+	yumCmd := exec.Command(yum, yumInstallArgs...)
+	rpmCmd := exec.Command(rpmquery, rpmqueryInstalledArgs...)
+	yumRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(yumCmd)).Return([]byte("stdout"), nil, nil).Times(1)
+	defaultRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(rpmCmd)).Return([]byte("stdout"), nil, nil).Times(2)
+
+	if _, err := run(testCtx, yum, yumInstallArgs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := run(testCtx, rpmquery, rpmqueryInstalledArgs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Removing the override falls back to the default runner.
+	SetManagerCommandRunner(ManagerYum, nil)
+	if got := runnerFor(ManagerYum); got != defaultRunner {
+		t.Errorf("runnerFor(ManagerYum) = %v, want default runner", got)
+	}
+	if _, err := run(testCtx, rpmquery, rpmqueryInstalledArgs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSetCommandAudit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockRunner
+	SetCommandAudit(true, []string{"mytoken"})
+	defer SetCommandAudit(false, nil)
+
+	var records []*util.AuditRecord
+	r, ok := runnerFor(ManagerYum).(*util.AuditRunner)
+	if !ok {
+		t.Fatalf("runnerFor(ManagerYum) = %T, want *util.AuditRunner", runnerFor(ManagerYum))
+	}
+	r.Sink = func(_ context.Context, r *util.AuditRecord) { records = append(records, r) }
+
+	cmd := exec.Command("yum", "install", "--setopt=mytoken=abcd", "pkg1")
+	mockRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(cmd)).Return([]byte("used abcd"), nil, nil).Times(1)
+	if _, _, err := r.Run(testCtx, cmd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d audit records, want 1", len(records))
+	}
+	want := []string{"install", "--setopt=mytoken=<redacted>", "pkg1"}
+	if got := records[0].Args; len(got) != len(want) || got[1] != want[1] {
+		t.Errorf("got args %q, want %q", got, want)
+	}
+	if got := records[0].Stdout; got != "used <redacted>" {
+		t.Errorf("got stdout %q, want %q", got, "used <redacted>")
+	}
+
+	SetCommandAudit(false, nil)
+	if got := runnerFor(ManagerYum); got != mockRunner {
+		t.Errorf("runnerFor(ManagerYum) = %v, want the unaudited runner", got)
+	}
+}
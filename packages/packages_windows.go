@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/util"
@@ -48,7 +49,7 @@ func wuaUpdates(ctx context.Context, query string) ([]*WUAPackage, error) {
 	}
 
 	var wua []*WUAPackage
-	stdout, stderr, err := runner.Run(ctx, exec.Command(exe, "wuaupdates", query))
+	stdout, stderr, err := runnerFor(managerOf(exe)).Run(ctx, exec.Command(exe, "wuaupdates", query))
 	if err != nil {
 		return nil, fmt.Errorf("error running agent to query for WUA updates, err: %v, stderr: %q ", err, stderr)
 	}
@@ -99,7 +100,10 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 	var errs []string
 
 	if util.Exists(googet) {
-		if googet, err := InstalledGooGetPackages(ctx); err != nil {
+		start := time.Now()
+		googet, err := InstalledGooGetPackages(ctx)
+		observeInventory("googet", start, err)
+		if err != nil {
 			msg := fmt.Sprintf("error listing installed googet packages: %v", err)
 			clog.Debugf(ctx, "Error: %s", msg)
 			errs = append(errs, msg)
@@ -110,7 +114,10 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 
 	clog.Debugf(ctx, "Searching for installed WUA updates.")
 
-	if wua, err := wuaUpdates(ctx, "IsInstalled=1"); err != nil {
+	start := time.Now()
+	wua, err := wuaUpdates(ctx, "IsInstalled=1")
+	observeInventory("wua", start, err)
+	if err != nil {
 		msg := fmt.Sprintf("error listing installed Windows updates: %v", err)
 		clog.Debugf(ctx, "Error: %s", msg)
 		errs = append(errs, msg)
@@ -118,7 +125,10 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 		pkgs.WUA = wua
 	}
 
-	if qfe, err := QuickFixEngineering(ctx); err != nil {
+	start = time.Now()
+	qfe, err := QuickFixEngineering(ctx)
+	observeInventory("qfe", start, err)
+	if err != nil {
 		msg := fmt.Sprintf("error listing installed QuickFixEngineering updates: %v", err)
 		clog.Debugf(ctx, "Error: %s", msg)
 		errs = append(errs, msg)
@@ -126,8 +136,23 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 		pkgs.QFE = qfe
 	}
 
+	clog.Debugf(ctx, "Listing installed MSI products.")
+	start = time.Now()
+	msi, err := InstalledMSIProducts(ctx)
+	observeInventory("msi", start, err)
+	if err != nil {
+		msg := fmt.Sprintf("error listing installed MSI products: %v", err)
+		clog.Debugf(ctx, "Error: %s", msg)
+		errs = append(errs, msg)
+	} else {
+		pkgs.MSI = msi
+	}
+
 	clog.Debugf(ctx, "Listing Windows Applications.")
-	if windowsApplications, err := GetWindowsApplications(ctx); err != nil {
+	start = time.Now()
+	windowsApplications, err := GetWindowsApplications(ctx)
+	observeInventory("windows_application", start, err)
+	if err != nil {
 		msg := fmt.Sprintf("error listing installed Windows Applications: %v", err)
 		clog.Debugf(ctx, "Error: %s", msg)
 		errs = append(errs, msg)
@@ -135,9 +160,8 @@ func GetInstalledPackages(ctx context.Context) (*Packages, error) {
 		pkgs.WindowsApplication = windowsApplications
 	}
 
-	var err error
 	if len(errs) != 0 {
-		err = errors.New(strings.Join(errs, "\n"))
+		return &pkgs, errors.New(strings.Join(errs, "\n"))
 	}
-	return &pkgs, err
+	return &pkgs, nil
 }
@@ -0,0 +1,77 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// OutputLineFunc is called with each line a package manager writes to stdout
+// while it runs, see WithOutputLineFunc.
+type OutputLineFunc func(line string)
+
+type outputLineKey struct{}
+
+// WithOutputLineFunc returns a copy of ctx that makes the package manager
+// commands run with it call f with each line of their output as it is
+// written, in addition to the output being returned as usual. f must not
+// block, it runs on the goroutine copying the output.
+func WithOutputLineFunc(ctx context.Context, f OutputLineFunc) context.Context {
+	return context.WithValue(ctx, outputLineKey{}, f)
+}
+
+// commandContext is exec.CommandContext with the OutputLineFunc of ctx, if
+// any, set as the stdout of the command. The CommandRunners write to it in
+// addition to capturing the output. The WithCommandEnv variables of ctx are
+// added to the environment of the command.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if env := commandEnv(ctx); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if f, ok := ctx.Value(outputLineKey{}).(OutputLineFunc); ok && f != nil {
+		cmd.Stdout = &lineWriter{f: f}
+	}
+	return cmd
+}
+
+// lineWriter calls f with each complete line written to it. Carriage returns
+// also end a line since progress bars redraw the line with them.
+type lineWriter struct {
+	mu  sync.Mutex
+	f   OutputLineFunc
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if ln := bytes.TrimSpace(w.buf[:i]); len(ln) > 0 {
+			w.f(string(ln))
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,39 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCommandContextOutputLines(t *testing.T) {
+	if cmd := commandContext(context.Background(), "/bin/true"); cmd.Stdout != nil {
+		t.Errorf("commandContext without an OutputLineFunc set Stdout to %v", cmd.Stdout)
+	}
+
+	var got []string
+	ctx := WithOutputLineFunc(context.Background(), func(ln string) { got = append(got, ln) })
+	cmd := commandContext(ctx, "/bin/true")
+	for _, s := range []string{"Reading pack", "age lists...\n", "Progress: 10%\rProgress: 20%\r", "\nDone\n", "partial"} {
+		cmd.Stdout.Write([]byte(s))
+	}
+	want := []string{"Reading package lists...", "Progress: 10%", "Progress: 20%", "Done"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected output lines (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,112 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+)
+
+// DefaultProtectedPackages are never removed or downgraded by the agent:
+// the agent itself, the other Google guest agents and the SSH server that
+// is needed to repair an instance.
+var DefaultProtectedPackages = []string{
+	"google-osconfig-agent",
+	"google-guest-agent",
+	"google-compute-engine",
+	"google-compute-engine-windows",
+	"google-cloud-ops-agent",
+	"openssh-server",
+	"openssh",
+}
+
+var (
+	protectedMu    sync.RWMutex
+	protectedExtra []string
+)
+
+// ProtectedPackageError is returned when an operation would remove or
+// downgrade protected packages, nothing is run in that case.
+type ProtectedPackageError struct {
+	// Op is the refused operation: remove or downgrade.
+	Op       string
+	Packages []string
+}
+
+func (e *ProtectedPackageError) Error() string {
+	return fmt.Sprintf("refusing to %s protected packages %q", e.Op, e.Packages)
+}
+
+// SetProtectedPackages sets the packages protected in addition to
+// DefaultProtectedPackages and the packages of the running kernel.
+func SetProtectedPackages(names []string) {
+	protectedMu.Lock()
+	defer protectedMu.Unlock()
+	protectedExtra = append([]string{}, names...)
+}
+
+// ProtectedPackages returns the names of all protected packages.
+func ProtectedPackages() []string {
+	protectedMu.RLock()
+	names := append(append([]string{}, DefaultProtectedPackages...), protectedExtra...)
+	protectedMu.RUnlock()
+
+	if oi, err := osinfo.Get(context.Background()); err == nil && oi.KernelRelease != "" {
+		// Debian and RPM based distributions name the package of a kernel
+		// after its release.
+		release := oi.KernelRelease
+		names = append(names, "linux-image-"+release, "kernel-"+release, "kernel-core-"+release)
+	}
+	return names
+}
+
+// packageArgName strips what the package managers accept around a package
+// name: zypper's "package:" prefix, apt's "=version" and "/release"
+// suffixes.
+func packageArgName(arg string) string {
+	arg = strings.TrimPrefix(arg, "package:")
+	if i := strings.IndexAny(arg, "=/"); i > 0 {
+		arg = arg[:i]
+	}
+	return arg
+}
+
+// checkProtected returns a *ProtectedPackageError if any of pkgs is
+// protected. Package names may carry an architecture suffix, like
+// "openssh-server.x86_64" for yum or "openssh-server:amd64" for apt.
+func checkProtected(op string, pkgs []string) error {
+	protected := map[string]bool{}
+	for _, name := range ProtectedPackages() {
+		protected[name] = true
+	}
+	var found []string
+	for _, arg := range pkgs {
+		name := packageArgName(arg)
+		if i := strings.LastIndexAny(name, ".:"); i > 0 && !protected[name] {
+			name = name[:i]
+		}
+		if protected[name] {
+			found = append(found, arg)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	return &ProtectedPackageError{Op: op, Packages: found}
+}
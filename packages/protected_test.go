@@ -0,0 +1,104 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckProtected(t *testing.T) {
+	defer osinfo.SetProvider(osinfo.SetProvider(osinfo.ProviderFunc(func(context.Context) (*osinfo.OSInfo, error) {
+		return &osinfo.OSInfo{KernelRelease: "5.10.0-28-cloud-amd64"}, nil
+	})))
+	SetProtectedPackages([]string{"my-agent"})
+	defer SetProtectedPackages(nil)
+
+	tests := []struct {
+		name string
+		pkgs []string
+		want []string
+	}{
+		{"NotProtected", []string{"vim", "nano.x86_64"}, nil},
+		{"Default", []string{"vim", "google-osconfig-agent"}, []string{"google-osconfig-agent"}},
+		{"Extra", []string{"my-agent"}, []string{"my-agent"}},
+		{"Arch", []string{"openssh-server.x86_64", "openssh-server:amd64"}, []string{"openssh-server.x86_64", "openssh-server:amd64"}},
+		{"Version", []string{"google-guest-agent=1:20240101.00-g1", "package:openssh"}, []string{"google-guest-agent=1:20240101.00-g1", "package:openssh"}},
+		{"RunningKernel", []string{"linux-image-5.10.0-28-cloud-amd64", "linux-image-5.10.0-27-cloud-amd64"}, []string{"linux-image-5.10.0-28-cloud-amd64"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProtected("remove", tt.pkgs)
+			var got []string
+			var perr *ProtectedPackageError
+			if errors.As(err, &perr) {
+				got = perr.Packages
+			} else if err != nil {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("checkProtected() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemoveProtectedPackages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	// No command may run.
+	runner = utilmocks.NewMockCommandRunner(mockCtrl)
+
+	pkgs := []string{"vim", "google-guest-agent"}
+	for name, remove := range map[string]func() error{
+		"apt":    func() error { return RemoveAptPackages(testCtx, pkgs) },
+		"yum":    func() error { return RemoveYumPackages(testCtx, pkgs) },
+		"zypper": func() error { return RemoveZypperPackages(testCtx, pkgs) },
+		"googet": func() error { return RemoveGooGetPackages(testCtx, pkgs) },
+	} {
+		var perr *ProtectedPackageError
+		if err := remove(); !errors.As(err, &perr) {
+			t.Errorf("%s: got error %v, want a *ProtectedPackageError", name, err)
+		}
+	}
+}
+
+func TestInstallAptPackagesProtectedDowngrade(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	setExpectations(mockCommandRunner, []expectedCommand{
+		{
+			cmd:    exec.Command(aptGet, append(aptGetInstallArgs, "google-guest-agent=1:20230101.00-g1")...),
+			envs:   []string{"DEBIAN_FRONTEND=noninteractive"},
+			stderr: []byte("E: Packages were downgraded and -y was used without --allow-downgrades."),
+			err:    errors.New("exit status 100"),
+		},
+	})
+	err := InstallAptPackages(testCtx, []string{"google-guest-agent=1:20230101.00-g1"})
+	var perr *ProtectedPackageError
+	if !errors.As(err, &perr) || perr.Op != "downgrade" {
+		t.Errorf("InstallAptPackages() = %v, want a *ProtectedPackageError for the downgrade", err)
+	}
+}
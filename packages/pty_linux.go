@@ -77,6 +77,8 @@ func runWithPty(cmd *exec.Cmd) ([]byte, []byte, error) {
 		return nil, nil, fmt.Errorf("error from IoctlSetWinsize: %v", err)
 	}
 
+	// A Stdout set by the caller still gets the output as it is read.
+	progress := cmd.Stdout
 	var stderr bytes.Buffer
 	cmd.Stdin = tty
 	cmd.Stdout = tty
@@ -110,6 +112,9 @@ func runWithPty(cmd *exec.Cmd) ([]byte, []byte, error) {
 				retErr = err
 				return
 			}
+			if progress != nil {
+				progress.Write(b)
+			}
 		}
 	}()
 
@@ -0,0 +1,47 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// runWithPty has no architecture specific code, this runs on every
+// architecture the tests are built for.
+func TestRunWithPty(t *testing.T) {
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skipf("no pty support: %v", err)
+	}
+	var progress bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "echo line1; echo line2 >&2; exit 1")
+	cmd.Stdout = &progress
+
+	stdout, stderr, err := runWithPty(cmd)
+	if err != nil {
+		t.Fatalf("runWithPty() error: %v", err)
+	}
+	if want := "line1\r\n"; string(stdout) != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if want := "line2\n"; string(stderr) != want {
+		t.Errorf("stderr = %q, want %q", stderr, want)
+	}
+	if progress.String() != string(stdout) {
+		t.Errorf("progress output = %q, want %q", progress.String(), stdout)
+	}
+}
@@ -0,0 +1,68 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+var (
+	powershell = "C:\\Windows\\System32\\WindowsPowerShell\\v1.0\\PowerShell.exe"
+
+	// InstalledOn is read from the raw CIM property, PowerShell otherwise
+	// converts it to a DateTime which serializes differently across
+	// versions. @() makes ConvertTo-Json produce an array even for a single
+	// update.
+	qfeCIMArgs = []string{
+		"-NoProfile",
+		"-NonInteractive",
+		"-Command",
+		"ConvertTo-Json -Compress -InputObject @(Get-CimInstance -ClassName Win32_QuickFixEngineering | " +
+			"Select-Object Caption, Description, HotFixID, @{Name='InstalledOn'; Expression={[string]$_.CimInstanceProperties['InstalledOn'].Value}})",
+	}
+)
+
+// parseQFEJSON parses the JSON output of qfeCIMArgs.
+func parseQFEJSON(data []byte) ([]*QFEPackage, error) {
+	var updts []struct {
+		Caption, Description, HotFixID, InstalledOn string
+	}
+	if err := json.Unmarshal(data, &updts); err != nil {
+		return nil, fmt.Errorf("error parsing Get-CimInstance output: %v", err)
+	}
+	qfe := make([]*QFEPackage, len(updts))
+	for i, update := range updts {
+		qfe[i] = &QFEPackage{
+			Caption:     update.Caption,
+			Description: update.Description,
+			HotFixID:    update.HotFixID,
+			InstalledOn: update.InstalledOn,
+		}
+	}
+	return qfe, nil
+}
+
+// quickFixEngineeringCIM lists installed updates with PowerShell
+// Get-CimInstance, used when querying WMI directly fails.
+func quickFixEngineeringCIM(ctx context.Context) ([]*QFEPackage, error) {
+	stdout, stderr, err := runnerFor(managerOf(powershell)).Run(ctx, exec.CommandContext(ctx, powershell, qfeCIMArgs...))
+	if err != nil {
+		return nil, fmt.Errorf("error running Get-CimInstance Win32_QuickFixEngineering: %v, stderr: %q", err, stderr)
+	}
+	return parseQFEJSON(stdout)
+}
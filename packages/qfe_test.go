@@ -0,0 +1,66 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseQFEJSON(t *testing.T) {
+	data := []byte(`[{"Caption":"http://support.microsoft.com/?kbid=5034439","Description":"Security Update","HotFixID":"KB5034439","InstalledOn":"1/10/2024"},{"Caption":"","Description":"Update","HotFixID":"KB5011048","InstalledOn":""}]`)
+	want := []*QFEPackage{
+		{Caption: "http://support.microsoft.com/?kbid=5034439", Description: "Security Update", HotFixID: "KB5034439", InstalledOn: "1/10/2024"},
+		{Description: "Update", HotFixID: "KB5011048"},
+	}
+	got, err := parseQFEJSON(data)
+	if err != nil {
+		t.Fatalf("parseQFEJSON: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseQFEJSON() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseQFEJSON([]byte("Get-CimInstance : Access denied")); err == nil {
+		t.Error("expected error for invalid output")
+	}
+}
+
+func TestQuickFixEngineeringCIM(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	expectedCmd := utilmocks.EqCmd(exec.Command(powershell, qfeCIMArgs...))
+	mockCommandRunner.EXPECT().Run(testCtx, expectedCmd).Return([]byte(`[{"HotFixID":"KB1"}]`), []byte(""), nil).Times(1)
+	got, err := quickFixEngineeringCIM(testCtx)
+	if err != nil {
+		t.Fatalf("quickFixEngineeringCIM: %v", err)
+	}
+	if diff := cmp.Diff([]*QFEPackage{{HotFixID: "KB1"}}, got); diff != "" {
+		t.Errorf("quickFixEngineeringCIM() mismatch (-want +got):\n%s", diff)
+	}
+
+	mockCommandRunner.EXPECT().Run(testCtx, expectedCmd).Return(nil, []byte("error"), errors.New("exit status 1")).Times(1)
+	if _, err := quickFixEngineeringCIM(testCtx); err == nil {
+		t.Error("expected error")
+	}
+}
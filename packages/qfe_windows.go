@@ -26,7 +26,22 @@ type win32QuickFixEngineering struct {
 }
 
 // QuickFixEngineering queries the wmi object win32_QuickFixEngineering for a list of installed updates.
+// If the WMI query fails, as it does on some hardened images, the updates are
+// queried with PowerShell Get-CimInstance instead.
 func QuickFixEngineering(ctx context.Context) ([]*QFEPackage, error) {
+	qfe, err := quickFixEngineeringWMI(ctx)
+	if err == nil {
+		return qfe, nil
+	}
+	clog.Debugf(ctx, "Error querying WMI for QuickFixEngineering updates, falling back to Get-CimInstance: %v", err)
+	qfe, cimErr := quickFixEngineeringCIM(ctx)
+	if cimErr != nil {
+		return nil, fmt.Errorf("%v; fallback: %v", err, cimErr)
+	}
+	return qfe, nil
+}
+
+func quickFixEngineeringWMI(ctx context.Context) ([]*QFEPackage, error) {
 	var updts []win32QuickFixEngineering
 	query := "SELECT Caption, Description, HotFixID, InstalledOn FROM Win32_QuickFixEngineering"
 	clog.Debugf(ctx, "Querying WMI for installed QuickFixEngineering updates, query=%q.", query)
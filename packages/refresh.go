@@ -0,0 +1,217 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultRefreshParallelism is the number of repositories refreshed at once
+// if RefreshYumRepos is called with parallelism <= 0.
+const defaultRefreshParallelism = 4
+
+var (
+	aptSourcesList = "/etc/apt/sources.list"
+	aptSourcesDir  = "/etc/apt/sources.list.d"
+
+	yumRepolistArgs   = []string{"repolist", "enabled", "--quiet"}
+	zypperReposArgs   = []string{"--xmlout", "--non-interactive", "repos"}
+	zypperRefreshArgs = []string{"--gpg-auto-import-keys", "--non-interactive", "refresh", "--repo"}
+)
+
+// aptGetUpdateSourceArgs only updates the lists of the sources in file and
+// keeps the lists of all other sources.
+func aptGetUpdateSourceArgs(file string) []string {
+	return []string{"update", "-o", "Dir::Etc::sourcelist=" + file, "-o", "Dir::Etc::sourceparts=-", "-o", "APT::Get::List-Cleanup=0"}
+}
+
+func yumMakecacheRepoArgs(repo string) []string {
+	return []string{"makecache", "--quiet", "--disablerepo=*", "--enablerepo=" + repo}
+}
+
+// RepoRefreshResult is the outcome of refreshing the metadata of a single
+// repository, for apt it is a sources file.
+type RepoRefreshResult struct {
+	Manager Manager
+	Repo    string
+	Err     error
+}
+
+// aptSourceFiles lists the apt sources files, the main sources.list first.
+func aptSourceFiles() ([]string, error) {
+	var files []string
+	if _, err := os.Stat(aptSourcesList); err == nil {
+		files = append(files, aptSourcesList)
+	}
+	for _, pattern := range []string{"*.list", "*.sources"} {
+		matches, err := filepath.Glob(filepath.Join(aptSourcesDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func parseYumRepolist(data []byte) []string {
+	/*
+		repo id                            repo name
+		appstream                          Rocky Linux 9 - AppStream
+		baseos                             Rocky Linux 9 - BaseOS
+	*/
+	var repos []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || (fields[0] == "repo" && len(fields) > 1 && fields[1] == "id") || strings.HasPrefix(fields[0], "repolist:") {
+			continue
+		}
+		// yum marks repos with expired metadata with a '!' and appends the
+		// release and arch to the id, e.g. "!base/7/x86_64".
+		id := strings.TrimPrefix(fields[0], "!")
+		if i := strings.Index(id, "/"); i >= 0 {
+			id = id[:i]
+		}
+		repos = append(repos, id)
+	}
+	return repos
+}
+
+type zypperReposXML struct {
+	Repos []struct {
+		Alias   string `xml:"alias,attr"`
+		Enabled string `xml:"enabled,attr"`
+	} `xml:"repo-list>repo"`
+}
+
+func parseZypperRepos(data []byte) ([]string, error) {
+	/*
+		<stream>
+		<repo-list>
+		<repo alias="repo-oss" name="Main Repository" type="rpm-md" priority="99" enabled="1" autorefresh="1" gpgcheck="1" repo_gpgcheck="1" pkg_gpgcheck="0">
+		<url>http://download.opensuse.org/distribution/leap/15.5/repo/oss/</url>
+		</repo>
+		</repo-list>
+		</stream>
+	*/
+	var r zypperReposXML
+	if err := xml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("error parsing zypper repos output: %v", err)
+	}
+	var repos []string
+	for _, repo := range r.Repos {
+		if repo.Enabled == "1" {
+			repos = append(repos, repo.Alias)
+		}
+	}
+	return repos, nil
+}
+
+// refreshRepos runs refresh for each repo with at most parallelism at once,
+// the results are in the order of repos.
+func refreshRepos(ctx context.Context, m Manager, repos []string, parallelism int, refresh func(context.Context, string) error) []*RepoRefreshResult {
+	if parallelism <= 0 {
+		parallelism = defaultRefreshParallelism
+	}
+	results := make([]*RepoRefreshResult, len(repos))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		go func(i int, repo string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = &RepoRefreshResult{Manager: m, Repo: repo, Err: refresh(ctx, repo)}
+		}(i, repo)
+	}
+	wg.Wait()
+	return results
+}
+
+// RefreshAptRepos runs apt-get update for each sources file. apt-get holds
+// a lock on the package lists while it updates them, so the files are
+// updated one at a time.
+func RefreshAptRepos(ctx context.Context) ([]*RepoRefreshResult, error) {
+	files, err := aptSourceFiles()
+	if err != nil {
+		return nil, err
+	}
+	return refreshRepos(ctx, ManagerApt, files, 1, func(ctx context.Context, file string) error {
+		args := aptGetUpdateSourceArgs(file)
+		stdout, stderr, err := runAptGet(ctx, args, []cmdModifier{
+			func(cmd *exec.Cmd) {
+				cmd.Env = commandEnvWith(ctx, "DEBIAN_FRONTEND=noninteractive")
+			},
+		})
+		if err != nil {
+			return newCmdError(aptGet, args, stdout, stderr, err)
+		}
+		return nil
+	}), nil
+}
+
+// RefreshYumRepos runs yum makecache for each enabled repository, at most
+// parallelism at once.
+func RefreshYumRepos(ctx context.Context, parallelism int) ([]*RepoRefreshResult, error) {
+	out, err := run(ctx, yum, yumRepolistArgs)
+	if err != nil {
+		return nil, err
+	}
+	return refreshRepos(ctx, ManagerYum, parseYumRepolist(out), parallelism, func(ctx context.Context, repo string) error {
+		_, err := run(ctx, yum, yumMakecacheRepoArgs(repo))
+		return err
+	}), nil
+}
+
+// RefreshZypperRepos runs zypper refresh for each enabled repository.
+// zypper holds a system wide lock while it runs, so the repositories are
+// refreshed one at a time.
+func RefreshZypperRepos(ctx context.Context) ([]*RepoRefreshResult, error) {
+	out, err := run(ctx, zypper, zypperReposArgs)
+	if err != nil {
+		return nil, err
+	}
+	repos, err := parseZypperRepos(out)
+	if err != nil {
+		return nil, err
+	}
+	return refreshRepos(ctx, ManagerZypper, repos, 1, func(ctx context.Context, repo string) error {
+		_, err := run(ctx, zypper, append(append([]string{}, zypperRefreshArgs...), repo))
+		return err
+	}), nil
+}
+
+// FailedRefreshes returns the results with an error.
+func FailedRefreshes(results []*RepoRefreshResult) []*RepoRefreshResult {
+	var failed []*RepoRefreshResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,112 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseYumRepolist(t *testing.T) {
+	data := []byte(`repo id                            repo name
+appstream                          Rocky Linux 9 - AppStream
+!base/7/x86_64                     CentOS-7 - Base
+repolist: 2
+`)
+	if diff := cmp.Diff([]string{"appstream", "base"}, parseYumRepolist(data)); diff != "" {
+		t.Errorf("parseYumRepolist: unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseZypperRepos(t *testing.T) {
+	data := []byte(`<?xml version='1.0'?>
+<stream>
+<repo-list>
+<repo alias="repo-oss" name="Main Repository" enabled="1" autorefresh="1"><url>http://download.opensuse.org/distribution/leap/15.5/repo/oss/</url></repo>
+<repo alias="repo-debug" name="Debug Repository" enabled="0" autorefresh="1"><url>http://download.opensuse.org/debug/distribution/leap/15.5/repo/oss/</url></repo>
+</repo-list>
+</stream>`)
+	got, err := parseZypperRepos(data)
+	if err != nil {
+		t.Fatalf("parseZypperRepos: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"repo-oss"}, got); diff != "" {
+		t.Errorf("parseZypperRepos: unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestAptSourceFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldList, oldDir := aptSourcesList, aptSourcesDir
+	defer func() { aptSourcesList, aptSourcesDir = oldList, oldDir }()
+	aptSourcesList = filepath.Join(dir, "sources.list")
+	aptSourcesDir = filepath.Join(dir, "sources.list.d")
+	if err := os.Mkdir(aptSourcesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{aptSourcesList, filepath.Join(aptSourcesDir, "b.list"), filepath.Join(aptSourcesDir, "a.sources"), filepath.Join(aptSourcesDir, "a.list.save")} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := aptSourceFiles()
+	if err != nil {
+		t.Fatalf("aptSourceFiles: unexpected error: %v", err)
+	}
+	want := []string{aptSourcesList, filepath.Join(aptSourcesDir, "b.list"), filepath.Join(aptSourcesDir, "a.sources")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("aptSourceFiles: unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestRefreshRepos(t *testing.T) {
+	var running, maxRunning int32
+	results := refreshRepos(context.Background(), ManagerYum, []string{"a", "b", "c", "d", "e"}, 2, func(_ context.Context, repo string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		if repo == "c" {
+			return errors.New("404")
+		}
+		return nil
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("refreshRepos ran %d refreshes at once, want at most 2", maxRunning)
+	}
+	var repos []string
+	for _, r := range results {
+		repos = append(repos, r.Repo)
+	}
+	if diff := cmp.Diff([]string{"a", "b", "c", "d", "e"}, repos); diff != "" {
+		t.Errorf("refreshRepos: unexpected result order (-want +got):\n%s", diff)
+	}
+	failed := FailedRefreshes(results)
+	if len(failed) != 1 || failed[0].Repo != "c" {
+		t.Errorf("FailedRefreshes: got %v, want only repo c", failed)
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"strings"
 
+	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/util"
 )
@@ -30,9 +32,10 @@ var (
 
 	rpmInstallArgs = []string{"--upgrade", "--replacepkgs", "-v"}
 	// %|EPOCH?{%{EPOCH}:}:{}| == if EPOCH then prepend "%{EPOCH}:" to version.
-	rpmqueryArgs          = []string{"--queryformat", "%{NAME} %{ARCH} %|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n"}
-	rpmqueryInstalledArgs = append(rpmqueryArgs, "-a")
-	rpmqueryRPMArgs       = append(rpmqueryArgs, "-p")
+	rpmqueryArgs    = []string{"--queryformat", "%{NAME} %{ARCH} %|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n"}
+	rpmqueryRPMArgs = append(rpmqueryArgs, "-p")
+	// Installed packages also include the source rpm they were built from.
+	rpmqueryInstalledArgs = []string{"--queryformat", "%{NAME} %{ARCH} %|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE} %{SOURCERPM}\n", "-a"}
 )
 
 func init() {
@@ -44,10 +47,11 @@ func init() {
 	RPMExists = util.Exists(rpm)
 }
 
-func parseInstalledRPMPackages(data []byte) []*PkgInfo {
+func parseInstalledRPMPackages(ctx context.Context, data []byte) []*PkgInfo {
 	/*
-	   foo x86_64 1.2.3-4
-	   bar noarch 2:1.2.3-4
+	   foo x86_64 1.2.3-4 foo-1.2.3-4.src.rpm
+	   bar noarch 2:1.2.3-4 bar-libs-1.2.3-4.src.rpm
+	   gpg-pubkey (none) 1234abcd-5678ef90 (none)
 	   ...
 	*/
 	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
@@ -55,15 +59,63 @@ func parseInstalledRPMPackages(data []byte) []*PkgInfo {
 	var pkgs []*PkgInfo
 	for _, ln := range lines {
 		pkg := bytes.Fields(ln)
-		if len(pkg) != 3 {
+		if len(pkg) != 3 && len(pkg) != 4 {
 			continue
 		}
 
-		pkgs = append(pkgs, &PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(pkg[1])), Version: string(pkg[2])})
+		info := &PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(pkg[1])), Version: string(pkg[2]), Epoch: epochOf(string(pkg[2]))}
+		if len(pkg) == 4 {
+			// The queried version is always VERSION-RELEASE, anything else
+			// is not a package.
+			if !bytes.Contains(pkg[2], []byte("-")) {
+				continue
+			}
+			source, ok := parseSourceRPM(string(pkg[3]), info.Version)
+			if !ok {
+				// The package is still installed, only its source is unknown.
+				clog.Debugf(ctx, "Unrecognized source rpm %q of package %q", pkg[3], info.Name)
+			}
+			info.Source = source
+		}
+		pkgs = append(pkgs, info)
 	}
 	return pkgs
 }
 
+// parseSourceRPM parses the source rpm file name of a package, like
+// "foo-1.2.3-4.src.rpm". Source rpm names do not include the epoch, so the
+// epoch of the binary package version is used. Packages without a source rpm,
+// like gpg-pubkey, report "(none)" and get an empty Source.
+func parseSourceRPM(sourceRPM, version string) (Source, bool) {
+	if sourceRPM == "(none)" {
+		return Source{}, true
+	}
+	var nvr string
+	switch {
+	case strings.HasSuffix(sourceRPM, ".src.rpm"):
+		nvr = strings.TrimSuffix(sourceRPM, ".src.rpm")
+	case strings.HasSuffix(sourceRPM, ".nosrc.rpm"):
+		nvr = strings.TrimSuffix(sourceRPM, ".nosrc.rpm")
+	default:
+		return Source{}, false
+	}
+
+	rel := strings.LastIndex(nvr, "-")
+	if rel <= 0 {
+		return Source{}, false
+	}
+	ver := strings.LastIndex(nvr[:rel], "-")
+	if ver <= 0 {
+		return Source{}, false
+	}
+
+	var epoch string
+	if e := epochOf(version); e != "" {
+		epoch = e + ":"
+	}
+	return Source{Name: nvr[:ver], Version: epoch + nvr[ver+1:]}, true
+}
+
 // InstalledRPMPackages queries for all installed rpm packages.
 func InstalledRPMPackages(ctx context.Context) ([]*PkgInfo, error) {
 	out, err := run(ctx, rpmquery, rpmqueryInstalledArgs)
@@ -71,7 +123,12 @@ func InstalledRPMPackages(ctx context.Context) ([]*PkgInfo, error) {
 		return nil, err
 	}
 
-	return parseInstalledRPMPackages(out), nil
+	pkgs := parseInstalledRPMPackages(ctx, out)
+	if len(pkgs) == 0 {
+		// The database may not be where this rpm expects it.
+		return installedRPMPackagesFromAlternateDBs(ctx)
+	}
+	return pkgs, nil
 }
 
 // RPMInstall installs an rpm packages.
@@ -87,7 +144,7 @@ func RPMPkgInfo(ctx context.Context, path string) (*PkgInfo, error) {
 		return nil, err
 	}
 
-	pkgs := parseInstalledRPMPackages(out)
+	pkgs := parseInstalledRPMPackages(ctx, out)
 	if len(pkgs) != 1 {
 		return nil, fmt.Errorf("unexpected number of parsed rpm packages %d: %q", len(pkgs), out)
 	}
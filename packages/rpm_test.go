@@ -34,10 +34,19 @@ func TestParseInstalledRPMPackages(t *testing.T) {
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
 		{"UnrecognizedPackage", []byte("foo.x86_64 1.2.3-4\nsomething we dont understand\n bar noarch 1.2.3-4 "), []*PkgInfo{{Name: "bar", Arch: "all", Version: "1.2.3-4"}}},
+		{"SourceRPM", []byte("foo x86_64 1.2.3-4 foo-1.2.3-4.src.rpm\nbar-libs noarch 2:1.0-1.el8 bar-1.0-1.el8.src.rpm\ngpg-pubkey (none) abcd-1234 (none)"), []*PkgInfo{
+			{Name: "foo", Arch: "x86_64", Version: "1.2.3-4", Source: Source{Name: "foo", Version: "1.2.3-4"}},
+			{Name: "bar-libs", Arch: "all", Version: "2:1.0-1.el8", Epoch: "2", Source: Source{Name: "bar", Version: "2:1.0-1.el8"}},
+			{Name: "gpg-pubkey", Arch: "(none)", Version: "abcd-1234"},
+		}},
+		{"InvalidSourceRPM", []byte("foo x86_64 1.2.3-4 foo.src.rpm\nbar noarch 1.0-1 bar-1.0-1.src.rpm"), []*PkgInfo{
+			{Name: "foo", Arch: "x86_64", Version: "1.2.3-4"},
+			{Name: "bar", Arch: "all", Version: "1.0-1", Source: Source{Name: "bar", Version: "1.0-1"}},
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := parseInstalledRPMPackages(tt.data)
+			got := parseInstalledRPMPackages(testCtx, tt.data)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("installedRPMPackages() = %v, want %v", got, tt.want)
 			}
@@ -0,0 +1,216 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+var (
+	procDir     = "/proc"
+	dpkgInfoDir = "/var/lib/dpkg/info"
+
+	rpmqueryOwnerArgs = []string{"--queryformat", "%{NAME}\n", "-f"}
+)
+
+// deletedSuffix is appended by the kernel to the exe link of a process whose
+// executable was deleted or replaced after it started.
+const deletedSuffix = " (deleted)"
+
+// RunningPackage is an installed package with executables that are
+// currently running.
+type RunningPackage struct {
+	Package     *PkgInfo
+	Executables []string
+	PIDs        []int
+	// Stale is set if a process runs an executable that was replaced or
+	// deleted after it started, usually by an upgrade that only takes effect
+	// once the process is restarted.
+	Stale bool
+}
+
+// runningExecutables returns the executables of all running processes,
+// mapped to the PIDs running them.
+func runningExecutables() (map[string][]int, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	exes := map[string][]int{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// Kernel threads have no executable and processes of other users
+		// can't be read without privileges, both are skipped.
+		exe, err := os.Readlink(filepath.Join(procDir, e.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		exes[exe] = append(exes[exe], pid)
+	}
+	return exes, nil
+}
+
+// ownerCandidates returns the paths a package may have recorded for path.
+// On merged /usr systems the kernel reports /usr/bin/foo while the package
+// may list /bin/foo, and the other way around.
+func ownerCandidates(path string) []string {
+	if strings.HasPrefix(path, "/usr/") {
+		return []string{path, strings.TrimPrefix(path, "/usr")}
+	}
+	return []string{path, "/usr" + path}
+}
+
+// dpkgOwners returns the deb package owning each of paths, read from the dpkg
+// file lists.
+func dpkgOwners(paths map[string]bool) (map[string]string, error) {
+	lists, err := filepath.Glob(filepath.Join(dpkgInfoDir, "*.list"))
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string]string{}
+	for _, l := range lists {
+		data, err := ioutil.ReadFile(l)
+		if err != nil {
+			return nil, err
+		}
+		// Multiarch packages are named "name:arch.list".
+		name := strings.SplitN(strings.TrimSuffix(filepath.Base(l), ".list"), ":", 2)[0]
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			if p := scanner.Text(); paths[p] {
+				owners[p] = name
+			}
+		}
+	}
+	return owners, nil
+}
+
+// rpmOwner returns the rpm package owning path, or an empty string if no
+// package owns it.
+func rpmOwner(ctx context.Context, path string) string {
+	out, err := run(ctx, rpmquery, append(rpmqueryOwnerArgs, path))
+	if err != nil {
+		// rpmquery exits non zero for files not owned by any package.
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+}
+
+func containsString(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func findPackage(pkgs []*PkgInfo, name string) *PkgInfo {
+	for _, pkg := range pkgs {
+		if pkg.Name == name {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// RunningPackages maps the executables of running processes to the installed
+// deb and rpm packages owning them, producing the packages that are actually
+// in use. The installed packages, as returned by GetInstalledPackages, provide
+// the package details. Processes running executables not owned by any
+// installed package are ignored.
+//
+// This is a heuristic: interpreters are reported instead of the scripts they
+// run, and processes of other users are only visible with privileges.
+func RunningPackages(ctx context.Context, installed *Packages) ([]*RunningPackage, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("listing running packages is only supported on Linux")
+	}
+	exes, err := runningExecutables()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	for exe := range exes {
+		for _, p := range ownerCandidates(strings.TrimSuffix(exe, deletedSuffix)) {
+			paths[p] = true
+		}
+	}
+
+	var debOwners map[string]string
+	if len(installed.Deb) > 0 {
+		if debOwners, err = dpkgOwners(paths); err != nil {
+			clog.Debugf(ctx, "Error reading dpkg file lists: %v", err)
+		}
+	}
+
+	running := map[*PkgInfo]*RunningPackage{}
+	for exe, pids := range exes {
+		path := strings.TrimSuffix(exe, deletedSuffix)
+		var pkg *PkgInfo
+		for _, p := range ownerCandidates(path) {
+			if name, ok := debOwners[p]; ok {
+				pkg = findPackage(installed.Deb, name)
+				break
+			}
+		}
+		if pkg == nil && len(installed.Rpm) > 0 && RPMQueryExists {
+			if name := rpmOwner(ctx, path); name != "" {
+				pkg = findPackage(installed.Rpm, name)
+			}
+		}
+		if pkg == nil {
+			continue
+		}
+
+		rp, ok := running[pkg]
+		if !ok {
+			rp = &RunningPackage{Package: pkg}
+			running[pkg] = rp
+		}
+		if !containsString(rp.Executables, path) {
+			rp.Executables = append(rp.Executables, path)
+		}
+		rp.PIDs = append(rp.PIDs, pids...)
+		if path != exe {
+			rp.Stale = true
+		}
+	}
+
+	var result []*RunningPackage
+	for _, rp := range running {
+		sort.Strings(rp.Executables)
+		sort.Ints(rp.PIDs)
+		result = append(result, rp)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Package.Name < result[j].Package.Name })
+	return result, nil
+}
@@ -0,0 +1,80 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunningPackages(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only supported on Linux")
+	}
+	oldProc, oldInfo := procDir, dpkgInfoDir
+	defer func() { procDir, dpkgInfoDir = oldProc, oldInfo }()
+	procDir, dpkgInfoDir = t.TempDir(), t.TempDir()
+
+	for pid, exe := range map[string]string{
+		"1":   "/usr/bin/foo",
+		"20":  "/usr/bin/foo (deleted)",
+		"3":   "/usr/sbin/bar",
+		"4":   "/opt/unowned",
+		"abc": "/usr/bin/foo",
+	} {
+		if err := os.MkdirAll(filepath.Join(procDir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(exe, filepath.Join(procDir, pid, "exe")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A kernel thread, without an exe link.
+	if err := os.MkdirAll(filepath.Join(procDir, "2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for list, content := range map[string]string{
+		// Packages list /bin paths on merged /usr systems.
+		"foo.list":       "/.\n/bin\n/bin/foo\n",
+		"bar:amd64.list": "/usr/sbin/bar\n/usr/share/doc/bar\n",
+		"baz.list":       "/usr/bin/baz\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dpkgInfoDir, list), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	foo := &PkgInfo{Name: "foo", Arch: "x86_64", Version: "1.0"}
+	bar := &PkgInfo{Name: "bar", Arch: "x86_64", Version: "2.0"}
+	baz := &PkgInfo{Name: "baz", Arch: "x86_64", Version: "3.0"}
+	got, err := RunningPackages(testCtx, &Packages{Deb: []*PkgInfo{foo, bar, baz}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []*RunningPackage{
+		{Package: bar, Executables: []string{"/usr/sbin/bar"}, PIDs: []int{3}},
+		{Package: foo, Executables: []string{"/usr/bin/foo"}, PIDs: []int{1, 20}, Stale: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RunningPackages() mismatch (-want +got):\n%s", diff)
+	}
+}
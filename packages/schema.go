@@ -0,0 +1,277 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the format written by MarshalPackages. It
+// is increased whenever a field is renamed, removed or changes meaning,
+// adding a field does not change it.
+const SchemaVersion = 1
+
+// The v1 types below are the serialized form of Packages. They are kept
+// separate from the Go types so that changes to those don't change the
+// stored format, any change here needs a new SchemaVersion.
+
+type packagesV1 struct {
+	SchemaVersion int              `json:"schema_version"`
+	Yum           []*pkgInfoV1     `json:"yum,omitempty"`
+	Rpm           []*pkgInfoV1     `json:"rpm,omitempty"`
+	Apt           []*pkgInfoV1     `json:"apt,omitempty"`
+	Deb           []*pkgInfoV1     `json:"deb,omitempty"`
+	Zypper        []*pkgInfoV1     `json:"zypper,omitempty"`
+	ZypperPatches []*zypperPatchV1 `json:"zypper_patches,omitempty"`
+	COS           []*pkgInfoV1     `json:"cos,omitempty"`
+	Gem           []*pkgInfoV1     `json:"gem,omitempty"`
+	Pip           []*pkgInfoV1     `json:"pip,omitempty"`
+	Brew          []*pkgInfoV1     `json:"brew,omitempty"`
+	GooGet        []*pkgInfoV1     `json:"googet,omitempty"`
+	WUA           []*wuaPackageV1  `json:"wua,omitempty"`
+	QFE           []*qfePackageV1  `json:"qfe,omitempty"`
+	MSI           []*msiProductV1  `json:"msi,omitempty"`
+	Applications  []*windowsAppV1  `json:"windows_applications,omitempty"`
+}
+
+type pkgInfoV1 struct {
+	Name          string          `json:"name"`
+	Arch          string          `json:"arch,omitempty"`
+	Version       string          `json:"version"`
+	Epoch         string          `json:"epoch,omitempty"`
+	SourceName    string          `json:"source_name,omitempty"`
+	SourceVersion string          `json:"source_version,omitempty"`
+	Category      string          `json:"category,omitempty"`
+	EbuildVersion string          `json:"ebuild_version,omitempty"`
+	AptCandidate  *aptCandidateV1 `json:"apt_candidate,omitempty"`
+	Repository    string          `json:"repository,omitempty"`
+	Size          int64           `json:"size,omitempty"`
+}
+
+type aptCandidateV1 struct {
+	Origins          []string `json:"origins,omitempty"`
+	Priority         int      `json:"priority"`
+	Phased           bool     `json:"phased,omitempty"`
+	PhasedPercentage int      `json:"phased_percentage,omitempty"`
+}
+
+type zypperPatchV1 struct {
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+}
+
+type wuaPackageV1 struct {
+	Title                    string    `json:"title"`
+	Description              string    `json:"description,omitempty"`
+	Categories               []string  `json:"categories,omitempty"`
+	CategoryIDs              []string  `json:"category_ids,omitempty"`
+	KBArticleIDs             []string  `json:"kb_article_ids,omitempty"`
+	MoreInfoURLs             []string  `json:"more_info_urls,omitempty"`
+	SupportURL               string    `json:"support_url,omitempty"`
+	UpdateID                 string    `json:"update_id"`
+	RevisionNumber           int32     `json:"revision_number"`
+	LastDeploymentChangeTime time.Time `json:"last_deployment_change_time"`
+}
+
+type qfePackageV1 struct {
+	Caption     string `json:"caption,omitempty"`
+	Description string `json:"description,omitempty"`
+	HotFixID    string `json:"hot_fix_id"`
+	InstalledOn string `json:"installed_on,omitempty"`
+}
+
+type msiProductV1 struct {
+	ProductCode string `json:"product_code"`
+	ProductName string `json:"product_name,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Publisher   string `json:"publisher,omitempty"`
+}
+
+type windowsAppV1 struct {
+	DisplayName    string    `json:"display_name"`
+	DisplayVersion string    `json:"display_version,omitempty"`
+	InstallDate    time.Time `json:"install_date"`
+	Publisher      string    `json:"publisher,omitempty"`
+	HelpLink       string    `json:"help_link,omitempty"`
+}
+
+func pkgInfosToV1(pkgs []*PkgInfo) []*pkgInfoV1 {
+	var v1 []*pkgInfoV1
+	for _, p := range pkgs {
+		e := &pkgInfoV1{
+			Name:          p.Name,
+			Arch:          p.Arch,
+			Version:       p.Version,
+			Epoch:         p.Epoch,
+			SourceName:    p.Source.Name,
+			SourceVersion: p.Source.Version,
+			Category:      p.Category,
+			EbuildVersion: p.EbuildVersion,
+			Repository:    p.Repository,
+			Size:          p.Size,
+		}
+		if c := p.AptCandidate; c != nil {
+			e.AptCandidate = &aptCandidateV1{Origins: c.Origins, Priority: c.Priority, Phased: c.Phased, PhasedPercentage: c.PhasedPercentage}
+		}
+		v1 = append(v1, e)
+	}
+	return v1
+}
+
+func pkgInfosFromV1(v1 []*pkgInfoV1) []*PkgInfo {
+	var pkgs []*PkgInfo
+	for _, e := range v1 {
+		p := &PkgInfo{
+			Name:          e.Name,
+			Arch:          e.Arch,
+			Version:       e.Version,
+			Epoch:         e.Epoch,
+			Source:        Source{Name: e.SourceName, Version: e.SourceVersion},
+			Category:      e.Category,
+			EbuildVersion: e.EbuildVersion,
+			Repository:    e.Repository,
+			Size:          e.Size,
+		}
+		if c := e.AptCandidate; c != nil {
+			p.AptCandidate = &AptCandidate{Origins: c.Origins, Priority: c.Priority, Phased: c.Phased, PhasedPercentage: c.PhasedPercentage}
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+func packagesToV1(p *Packages) *packagesV1 {
+	v1 := &packagesV1{
+		SchemaVersion: SchemaVersion,
+		Yum:           pkgInfosToV1(p.Yum),
+		Rpm:           pkgInfosToV1(p.Rpm),
+		Apt:           pkgInfosToV1(p.Apt),
+		Deb:           pkgInfosToV1(p.Deb),
+		Zypper:        pkgInfosToV1(p.Zypper),
+		COS:           pkgInfosToV1(p.COS),
+		Gem:           pkgInfosToV1(p.Gem),
+		Pip:           pkgInfosToV1(p.Pip),
+		Brew:          pkgInfosToV1(p.Brew),
+		GooGet:        pkgInfosToV1(p.GooGet),
+	}
+	for _, z := range p.ZypperPatches {
+		v1.ZypperPatches = append(v1.ZypperPatches, &zypperPatchV1{Name: z.Name, Category: z.Category, Severity: z.Severity, Summary: z.Summary})
+	}
+	for _, w := range p.WUA {
+		v1.WUA = append(v1.WUA, &wuaPackageV1{
+			Title:                    w.Title,
+			Description:              w.Description,
+			Categories:               w.Categories,
+			CategoryIDs:              w.CategoryIDs,
+			KBArticleIDs:             w.KBArticleIDs,
+			MoreInfoURLs:             w.MoreInfoURLs,
+			SupportURL:               w.SupportURL,
+			UpdateID:                 w.UpdateID,
+			RevisionNumber:           w.RevisionNumber,
+			LastDeploymentChangeTime: w.LastDeploymentChangeTime,
+		})
+	}
+	for _, q := range p.QFE {
+		v1.QFE = append(v1.QFE, &qfePackageV1{Caption: q.Caption, Description: q.Description, HotFixID: q.HotFixID, InstalledOn: q.InstalledOn})
+	}
+	for _, m := range p.MSI {
+		v1.MSI = append(v1.MSI, &msiProductV1{ProductCode: m.ProductCode, ProductName: m.ProductName, Version: m.Version, Publisher: m.Publisher})
+	}
+	for _, a := range p.WindowsApplication {
+		v1.Applications = append(v1.Applications, &windowsAppV1{DisplayName: a.DisplayName, DisplayVersion: a.DisplayVersion, InstallDate: a.InstallDate, Publisher: a.Publisher, HelpLink: a.HelpLink})
+	}
+	return v1
+}
+
+func packagesFromV1(v1 *packagesV1) *Packages {
+	p := &Packages{
+		Yum:    pkgInfosFromV1(v1.Yum),
+		Rpm:    pkgInfosFromV1(v1.Rpm),
+		Apt:    pkgInfosFromV1(v1.Apt),
+		Deb:    pkgInfosFromV1(v1.Deb),
+		Zypper: pkgInfosFromV1(v1.Zypper),
+		COS:    pkgInfosFromV1(v1.COS),
+		Gem:    pkgInfosFromV1(v1.Gem),
+		Pip:    pkgInfosFromV1(v1.Pip),
+		Brew:   pkgInfosFromV1(v1.Brew),
+		GooGet: pkgInfosFromV1(v1.GooGet),
+	}
+	for _, z := range v1.ZypperPatches {
+		p.ZypperPatches = append(p.ZypperPatches, &ZypperPatch{Name: z.Name, Category: z.Category, Severity: z.Severity, Summary: z.Summary})
+	}
+	for _, w := range v1.WUA {
+		p.WUA = append(p.WUA, &WUAPackage{
+			Title:                    w.Title,
+			Description:              w.Description,
+			Categories:               w.Categories,
+			CategoryIDs:              w.CategoryIDs,
+			KBArticleIDs:             w.KBArticleIDs,
+			MoreInfoURLs:             w.MoreInfoURLs,
+			SupportURL:               w.SupportURL,
+			UpdateID:                 w.UpdateID,
+			RevisionNumber:           w.RevisionNumber,
+			LastDeploymentChangeTime: w.LastDeploymentChangeTime,
+		})
+	}
+	for _, q := range v1.QFE {
+		p.QFE = append(p.QFE, &QFEPackage{Caption: q.Caption, Description: q.Description, HotFixID: q.HotFixID, InstalledOn: q.InstalledOn})
+	}
+	for _, m := range v1.MSI {
+		p.MSI = append(p.MSI, &MSIProduct{ProductCode: m.ProductCode, ProductName: m.ProductName, Version: m.Version, Publisher: m.Publisher})
+	}
+	for _, a := range v1.Applications {
+		p.WindowsApplication = append(p.WindowsApplication, &WindowsApplication{DisplayName: a.DisplayName, DisplayVersion: a.DisplayVersion, InstallDate: a.InstallDate, Publisher: a.Publisher, HelpLink: a.HelpLink})
+	}
+	return p
+}
+
+// MarshalPackages serializes p as JSON in the current SchemaVersion, for
+// storing inventory snapshots. Use UnmarshalPackages to read it back.
+func MarshalPackages(p *Packages) ([]byte, error) {
+	return json.Marshal(packagesToV1(p))
+}
+
+// UnmarshalPackages reads Packages serialized by MarshalPackages with the
+// current or any earlier SchemaVersion. JSON without a schema_version is read
+// as the plain encoding/json form of Packages, as written by older versions
+// of the agent.
+func UnmarshalPackages(data []byte) (*Packages, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch header.SchemaVersion {
+	case 0:
+		var p Packages
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	case 1:
+		var v1 packagesV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		return packagesFromV1(&v1), nil
+	}
+	return nil, fmt.Errorf("unsupported packages schema version %d, the latest supported version is %d", header.SchemaVersion, SchemaVersion)
+}
@@ -0,0 +1,85 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshalPackagesRoundTrip(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	pkgs := &Packages{
+		Apt:                []*PkgInfo{{Name: "bash", Arch: "x86_64", Version: "5.1", AptCandidate: &AptCandidate{Origins: []string{"http://deb.debian.org/debian bookworm/main"}, Priority: 500, Phased: true, PhasedPercentage: 10}}},
+		Deb:                []*PkgInfo{{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1", Epoch: "1", Source: Source{Name: "git", Version: "1:2.25.1-1"}}},
+		Rpm:                []*PkgInfo{{Name: "bash", Arch: "x86_64", Version: "4.2.46-34.el7"}},
+		COS:                []*PkgInfo{{Name: "dev-util/foo", Version: "1.0", Category: "dev-util", EbuildVersion: "1.0-r1"}},
+		ZypperPatches:      []*ZypperPatch{{Name: "patch", Category: "security", Severity: "important", Summary: "fix"}},
+		WUA:                []*WUAPackage{{Title: "update", UpdateID: "id", RevisionNumber: 2, KBArticleIDs: []string{"123"}, LastDeploymentChangeTime: date}},
+		QFE:                []*QFEPackage{{Caption: "c", HotFixID: "KB123", InstalledOn: "1/2/2024"}},
+		MSI:                []*MSIProduct{{ProductCode: "{GUID}", ProductName: "product", Version: "1.0", Publisher: "Google"}},
+		WindowsApplication: []*WindowsApplication{{DisplayName: "app", DisplayVersion: "1.0", InstallDate: date}},
+	}
+
+	data, err := MarshalPackages(pkgs)
+	if err != nil {
+		t.Fatalf("MarshalPackages: %v", err)
+	}
+	got, err := UnmarshalPackages(data)
+	if err != nil {
+		t.Fatalf("UnmarshalPackages: %v", err)
+	}
+	if diff := cmp.Diff(pkgs, got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarshalPackagesFormat(t *testing.T) {
+	// The serialized format must only change with a new SchemaVersion.
+	data, err := MarshalPackages(&Packages{Deb: []*PkgInfo{{Name: "git", Arch: "x86_64", Version: "1:2.25.1-1", Epoch: "1", Source: Source{Name: "git", Version: "1:2.25.1-1"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"schema_version":1,"deb":[{"name":"git","arch":"x86_64","version":"1:2.25.1-1","epoch":"1","source_name":"git","source_version":"1:2.25.1-1"}]}`
+	if string(data) != want {
+		t.Errorf("MarshalPackages() = %s, want %s", data, want)
+	}
+}
+
+func TestUnmarshalPackagesLegacy(t *testing.T) {
+	legacy := &Packages{Deb: []*PkgInfo{{Name: "git", Arch: "x86_64", Version: "2.25.1"}}}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalPackages(data)
+	if err != nil {
+		t.Fatalf("UnmarshalPackages: %v", err)
+	}
+	if diff := cmp.Diff(legacy, got); diff != "" {
+		t.Errorf("UnmarshalPackages() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnmarshalPackagesErrors(t *testing.T) {
+	for _, data := range []string{`{"schema_version":99}`, `not json`, `{"schema_version":1,"deb":"nope"}`} {
+		if _, err := UnmarshalPackages([]byte(data)); err == nil {
+			t.Errorf("UnmarshalPackages(%s): expected error", data)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	aptCacheSearchArgs   = []string{"search"}
+	yumSearchArgs        = []string{"search", "--all", "--quiet", "--color=never"}
+	yumListAllArgs       = []string{"list", "all", "--quiet", "--color=never"}
+	zypperSearchArgs     = []string{"--xmlout", "--non-interactive", "search", "--type", "package"}
+	zypperSearchInfoArgs = []string{"--xmlout", "--non-interactive", "search", "--details", "--type", "package"}
+	googetAvailableArgs  = []string{"available", "-filter"}
+)
+
+// SearchResult is a package available from the repositories configured on
+// the host.
+type SearchResult struct {
+	Manager Manager
+	Name    string
+	Arch    string `json:",omitempty"`
+	Summary string `json:",omitempty"`
+	// Version is the candidate version, the one an install would pick, and
+	// Repository the repository it comes from. Both are empty if the
+	// package manager does not report them.
+	Version    string `json:",omitempty"`
+	Repository string `json:",omitempty"`
+}
+
+func parseAptCacheSearch(data []byte) []*SearchResult {
+	/*
+		vim - Vi IMproved - enhanced vi editor
+		vim-tiny - Vi IMproved - enhanced vi editor - compact version
+	*/
+	var results []*SearchResult
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " - ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		results = append(results, &SearchResult{Manager: ManagerApt, Name: strings.TrimSpace(parts[0]), Summary: strings.TrimSpace(parts[1])})
+	}
+	return results
+}
+
+// AptSearch searches the apt package names and descriptions for pattern, a
+// regular expression, with the candidate version from apt-cache policy.
+func AptSearch(ctx context.Context, pattern string) ([]*SearchResult, error) {
+	out, err := run(ctx, aptCache, append(append([]string{}, aptCacheSearchArgs...), pattern))
+	if err != nil {
+		return nil, err
+	}
+	results := parseAptCacheSearch(out)
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{}, aptCachePolicyArgs...)
+	for _, r := range results {
+		args = append(args, r.Name)
+	}
+	out, err = run(ctx, aptCache, args)
+	if err != nil {
+		return nil, err
+	}
+	policies := parseAptCachePolicy(out)
+	for _, r := range results {
+		if p, ok := policies[r.Name]; ok {
+			r.Version = p.version
+			if len(p.Origins) > 0 {
+				r.Repository = p.Origins[0]
+			}
+		}
+	}
+	return results, nil
+}
+
+func parseYumSearch(data []byte) []*SearchResult {
+	/*
+		======================== Name & Summary Matched: vim ========================
+		vim-enhanced.x86_64 : A version of the VIM editor which includes recent enhancements
+		vim-minimal.x86_64 : A minimal version of the VIM editor
+		============================ Summary Matched: vim ===========================
+		neovim.x86_64 : Vim-fork focused on extensibility and agility
+	*/
+	var results []*SearchResult
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " : ", 2)
+		if len(parts) != 2 || strings.HasPrefix(parts[0], "=") {
+			continue
+		}
+		nameArch := strings.TrimSpace(parts[0])
+		if seen[nameArch] {
+			continue
+		}
+		seen[nameArch] = true
+		r := &SearchResult{Manager: ManagerYum, Name: nameArch, Summary: strings.TrimSpace(parts[1])}
+		if i := strings.LastIndex(nameArch, "."); i > 0 {
+			r.Name, r.Arch = nameArch[:i], nameArch[i+1:]
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+type yumListEntry struct {
+	version, repo string
+}
+
+func parseYumListAll(data []byte) map[string]yumListEntry {
+	/*
+		Installed Packages
+		vim-minimal.x86_64        2:8.2.2637-20.el9_1        @anaconda
+		Available Packages
+		vim-enhanced.x86_64       2:8.2.2637-20.el9_1        appstream
+	*/
+	entries := map[string]yumListEntry{}
+	available := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		ln := scanner.Text()
+		switch strings.TrimSpace(ln) {
+		case "Installed Packages":
+			available = false
+			continue
+		case "Available Packages":
+			available = true
+			continue
+		}
+		fields := strings.Fields(ln)
+		if len(fields) != 3 {
+			continue
+		}
+		// An available version takes precedence over the installed one.
+		if _, ok := entries[fields[0]]; ok && !available {
+			continue
+		}
+		entries[fields[0]] = yumListEntry{version: fields[1], repo: strings.TrimPrefix(fields[2], "@")}
+	}
+	return entries
+}
+
+// YumSearch searches the yum or dnf package names, summaries and
+// descriptions for pattern, with the candidate version from yum list.
+func YumSearch(ctx context.Context, pattern string) ([]*SearchResult, error) {
+	out, err := run(ctx, yum, append(append([]string{}, yumSearchArgs...), pattern))
+	if err != nil {
+		var cmdErr *CmdError
+		// yum and dnf exit with 1 if nothing matched.
+		if errors.As(err, &cmdErr) && cmdErr.ExitCode == 1 && len(parseYumSearch(cmdErr.Stdout)) == 0 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	results := parseYumSearch(out)
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{}, yumListAllArgs...)
+	for _, r := range results {
+		args = append(args, r.Name+"."+r.Arch)
+	}
+	out, err = run(ctx, yum, args)
+	if err != nil {
+		return nil, err
+	}
+	entries := parseYumListAll(out)
+	for _, r := range results {
+		if e, ok := entries[r.Name+"."+r.Arch]; ok {
+			r.Version, r.Repository = e.version, e.repo
+		}
+	}
+	return results, nil
+}
+
+type zypperSearchXML struct {
+	Solvables []struct {
+		Name       string `xml:"name,attr"`
+		Summary    string `xml:"summary,attr"`
+		Edition    string `xml:"edition,attr"`
+		Arch       string `xml:"arch,attr"`
+		Repository string `xml:"repository,attr"`
+	} `xml:"search-result>solvable-list>solvable"`
+}
+
+func parseZypperSearch(summaries, details []byte) ([]*SearchResult, error) {
+	/*
+		<stream>
+		<search-result version="0.0">
+		<solvable-list>
+		<solvable status="not-installed" name="vim" summary="Vi IMproved" kind="package"/>
+		</solvable-list>
+		</search-result>
+		</stream>
+
+		With --details each version and repository is listed, the candidate
+		first:
+		<solvable status="not-installed" name="vim" kind="package" edition="9.0.1572-1.1" arch="x86_64" repository="Main Repository"/>
+	*/
+	var s, d zypperSearchXML
+	if err := xml.Unmarshal(summaries, &s); err != nil {
+		return nil, fmt.Errorf("error parsing zypper search output: %v", err)
+	}
+	if err := xml.Unmarshal(details, &d); err != nil {
+		return nil, fmt.Errorf("error parsing zypper search output: %v", err)
+	}
+	var results []*SearchResult
+	byName := map[string]*SearchResult{}
+	for _, e := range s.Solvables {
+		r := &SearchResult{Manager: ManagerZypper, Name: e.Name, Summary: e.Summary}
+		byName[e.Name] = r
+		results = append(results, r)
+	}
+	for _, e := range d.Solvables {
+		if r, ok := byName[e.Name]; ok && r.Version == "" {
+			r.Version, r.Arch, r.Repository = e.Edition, e.Arch, e.Repository
+		}
+	}
+	return results, nil
+}
+
+// ZypperSearch searches the zypper package names and summaries for pattern,
+// which may contain * and ? wildcards.
+func ZypperSearch(ctx context.Context, pattern string) ([]*SearchResult, error) {
+	summaries, err := runZypperSearch(ctx, zypperSearchArgs, pattern)
+	if err != nil {
+		return nil, err
+	}
+	details, err := runZypperSearch(ctx, zypperSearchInfoArgs, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return parseZypperSearch(summaries, details)
+}
+
+func runZypperSearch(ctx context.Context, args []string, pattern string) ([]byte, error) {
+	out, err := run(ctx, zypper, append(append([]string{}, args...), pattern))
+	var cmdErr *CmdError
+	// zypper exits with 104 if nothing matched, the XML output is still
+	// valid then.
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode == 104 {
+		return cmdErr.Stdout, nil
+	}
+	return out, err
+}
+
+func parseGooGetAvailable(data []byte) []*SearchResult {
+	/*
+		Searching for packages in:
+		 https://packages.cloud.google.com/yuck/repos/google-compute-engine-stable
+		Available packages:
+		 googet.x86_64 2.18.3@0
+		 google-compute-engine-windows.x86_64 20240109.00.0@1
+	*/
+	var results []*SearchResult
+	var repo string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		ln := scanner.Text()
+		fields := strings.Fields(ln)
+		switch {
+		case len(fields) == 1 && strings.Contains(fields[0], "://"):
+			repo = fields[0]
+		case len(fields) == 2 && strings.HasPrefix(ln, " "):
+			r := &SearchResult{Manager: ManagerGooGet, Name: fields[0], Version: fields[1], Repository: repo}
+			if i := strings.LastIndex(fields[0], "."); i > 0 {
+				r.Name, r.Arch = fields[0][:i], fields[0][i+1:]
+			}
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// GooGetSearch lists the googet packages available with names containing
+// pattern.
+func GooGetSearch(ctx context.Context, pattern string) ([]*SearchResult, error) {
+	out, err := run(ctx, googet, append(append([]string{}, googetAvailableArgs...), pattern))
+	if err != nil {
+		return nil, err
+	}
+	return parseGooGetAvailable(out), nil
+}
+
+// SearchAvailable searches the repositories of all package managers on the
+// host for pattern, it is passed to the package managers as is so its
+// syntax differs between them. Errors of one package manager don't prevent
+// the results of the others from being returned.
+func SearchAvailable(ctx context.Context, pattern string) ([]*SearchResult, error) {
+	var results []*SearchResult
+	var errs []string
+	for _, s := range []struct {
+		exists bool
+		name   string
+		search func(context.Context, string) ([]*SearchResult, error)
+	}{
+		{AptExists, "apt", AptSearch},
+		{YumExists, "yum", YumSearch},
+		{ZypperExists, "zypper", ZypperSearch},
+		{GooGetExists, "googet", GooGetSearch},
+	} {
+		if !s.exists {
+			continue
+		}
+		r, err := s.search(ctx, pattern)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("error searching %s packages: %v", s.name, err))
+			continue
+		}
+		results = append(results, r...)
+	}
+	if len(errs) > 0 {
+		return results, errors.New(strings.Join(errs, "\n"))
+	}
+	return results, nil
+}
@@ -0,0 +1,139 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"os/exec"
+	"slices"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAptSearch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	setExpectations(mockCommandRunner, []expectedCommand{
+		{
+			cmd:    exec.Command(aptCache, append(slices.Clone(aptCacheSearchArgs), "ldap-common")...),
+			stdout: []byte("libldap-common - OpenLDAP common files for libraries\n"),
+		},
+		{
+			cmd:    exec.Command(aptCache, append(slices.Clone(aptCachePolicyArgs), "libldap-common")...),
+			stdout: []byte(testAptCachePolicy),
+		},
+	})
+
+	got, err := AptSearch(testCtx, "ldap-common")
+	if err != nil {
+		t.Fatalf("AptSearch: unexpected error: %v", err)
+	}
+	want := []*SearchResult{{
+		Manager:    ManagerApt,
+		Name:       "libldap-common",
+		Summary:    "OpenLDAP common files for libraries",
+		Version:    "2.4.45+dfsg-1ubuntu1.3",
+		Repository: "http://archive.ubuntu.com/ubuntu bionic-updates/main",
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AptSearch: unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseYumSearch(t *testing.T) {
+	search := []byte(`======================== Name & Summary Matched: vim ========================
+vim-enhanced.x86_64 : A version of the VIM editor which includes recent enhancements
+vim-minimal.x86_64 : A minimal version of the VIM editor
+============================ Summary Matched: vim ===========================
+vim-minimal.x86_64 : A minimal version of the VIM editor
+neovim.x86_64 : Vim-fork focused on extensibility and agility
+`)
+	want := []*SearchResult{
+		{Manager: ManagerYum, Name: "vim-enhanced", Arch: "x86_64", Summary: "A version of the VIM editor which includes recent enhancements"},
+		{Manager: ManagerYum, Name: "vim-minimal", Arch: "x86_64", Summary: "A minimal version of the VIM editor"},
+		{Manager: ManagerYum, Name: "neovim", Arch: "x86_64", Summary: "Vim-fork focused on extensibility and agility"},
+	}
+	if diff := cmp.Diff(want, parseYumSearch(search)); diff != "" {
+		t.Errorf("parseYumSearch: unexpected result (-want +got):\n%s", diff)
+	}
+
+	list := []byte(`Installed Packages
+vim-minimal.x86_64        2:8.2.2637-16.el9        @anaconda
+Available Packages
+vim-enhanced.x86_64       2:8.2.2637-20.el9_1      appstream
+vim-minimal.x86_64        2:8.2.2637-20.el9_1      baseos
+`)
+	wantList := map[string]yumListEntry{
+		"vim-minimal.x86_64":  {version: "2:8.2.2637-20.el9_1", repo: "baseos"},
+		"vim-enhanced.x86_64": {version: "2:8.2.2637-20.el9_1", repo: "appstream"},
+	}
+	if diff := cmp.Diff(wantList, parseYumListAll(list), cmp.AllowUnexported(yumListEntry{})); diff != "" {
+		t.Errorf("parseYumListAll: unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseZypperSearch(t *testing.T) {
+	summaries := []byte(`<?xml version='1.0'?>
+<stream>
+<search-result version="0.0">
+<solvable-list>
+<solvable status="not-installed" name="vim" summary="Vi IMproved" kind="package"/>
+</solvable-list>
+</search-result>
+</stream>`)
+	details := []byte(`<?xml version='1.0'?>
+<stream>
+<search-result version="0.0">
+<solvable-list>
+<solvable status="not-installed" name="vim" kind="package" edition="9.0.1572-1.1" arch="x86_64" repository="Update Repository"/>
+<solvable status="not-installed" name="vim" kind="package" edition="9.0.1443-1.1" arch="x86_64" repository="Main Repository"/>
+</solvable-list>
+</search-result>
+</stream>`)
+	got, err := parseZypperSearch(summaries, details)
+	if err != nil {
+		t.Fatalf("parseZypperSearch: unexpected error: %v", err)
+	}
+	want := []*SearchResult{{Manager: ManagerZypper, Name: "vim", Arch: "x86_64", Summary: "Vi IMproved", Version: "9.0.1572-1.1", Repository: "Update Repository"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseZypperSearch: unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseZypperSearch([]byte("not xml"), details); err == nil {
+		t.Error("parseZypperSearch: expected an error for invalid XML")
+	}
+}
+
+func TestParseGooGetAvailable(t *testing.T) {
+	data := []byte(`Searching for packages in:
+ https://packages.cloud.google.com/yuck/repos/google-compute-engine-stable
+Available packages:
+ googet.x86_64 2.18.3@0
+ google-compute-engine-windows.x86_64 20240109.00.0@1
+`)
+	repo := "https://packages.cloud.google.com/yuck/repos/google-compute-engine-stable"
+	want := []*SearchResult{
+		{Manager: ManagerGooGet, Name: "googet", Arch: "x86_64", Version: "2.18.3@0", Repository: repo},
+		{Manager: ManagerGooGet, Name: "google-compute-engine-windows", Arch: "x86_64", Version: "20240109.00.0@1", Repository: repo},
+	}
+	if diff := cmp.Diff(want, parseGooGetAvailable(data)); diff != "" {
+		t.Errorf("parseGooGetAvailable: unexpected result (-want +got):\n%s", diff)
+	}
+}
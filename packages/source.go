@@ -0,0 +1,57 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+// sourceOf returns the source package a binary package was built from. A
+// package without a recorded source is its own source, which matches how
+// dpkg handles packages without a Source field.
+func sourceOf(pkg *PkgInfo) Source {
+	if pkg.Source.Name == "" {
+		return Source{Name: pkg.Name, Version: pkg.Version}
+	}
+	if pkg.Source.Version == "" {
+		return Source{Name: pkg.Source.Name, Version: pkg.Version}
+	}
+	return pkg.Source
+}
+
+// PackagesBySource indexes the installed deb and rpm packages by the source
+// package, name and version, they were built from. Security advisories are
+// usually published per source package, the index gives the binary packages
+// on this system an advisory applies to.
+func (p *Packages) PackagesBySource() map[Source][]*PkgInfo {
+	index := map[Source][]*PkgInfo{}
+	for _, pkgs := range [][]*PkgInfo{p.Deb, p.Rpm} {
+		for _, pkg := range pkgs {
+			s := sourceOf(pkg)
+			index[s] = append(index[s], pkg)
+		}
+	}
+	return index
+}
+
+// BinaryPackages returns the installed deb and rpm packages built from any
+// version of the named source package.
+func (p *Packages) BinaryPackages(sourceName string) []*PkgInfo {
+	var pkgs []*PkgInfo
+	for _, list := range [][]*PkgInfo{p.Deb, p.Rpm} {
+		for _, pkg := range list {
+			if sourceOf(pkg).Name == sourceName {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	return pkgs
+}
@@ -0,0 +1,51 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackagesBySource(t *testing.T) {
+	aptUtils := &PkgInfo{Name: "apt-utils", Arch: "x86_64", Version: "2.0.10", Source: Source{Name: "apt", Version: "2.0.10"}}
+	apt := &PkgInfo{Name: "apt", Arch: "x86_64", Version: "2.0.10", Source: Source{Name: "apt", Version: "2.0.10"}}
+	adduser := &PkgInfo{Name: "adduser", Arch: "all", Version: "3.118"}
+	libfoo := &PkgInfo{Name: "libfoo", Arch: "x86_64", Version: "1:1.0-1", Source: Source{Name: "foo"}}
+	bash := &PkgInfo{Name: "bash", Arch: "x86_64", Version: "4.2.46-34.el7", Source: Source{Name: "bash", Version: "4.2.46-34.el7"}}
+	pkgs := &Packages{
+		Deb: []*PkgInfo{aptUtils, apt, adduser, libfoo},
+		Rpm: []*PkgInfo{bash},
+		// Only deb and rpm packages are indexed.
+		Pip: []*PkgInfo{{Name: "requests", Version: "2.0"}},
+	}
+
+	want := map[Source][]*PkgInfo{
+		{Name: "apt", Version: "2.0.10"}:         {aptUtils, apt},
+		{Name: "adduser", Version: "3.118"}:      {adduser},
+		{Name: "foo", Version: "1:1.0-1"}:        {libfoo},
+		{Name: "bash", Version: "4.2.46-34.el7"}: {bash},
+	}
+	if got := pkgs.PackagesBySource(); !reflect.DeepEqual(got, want) {
+		t.Errorf("PackagesBySource() = %v, want %v", got, want)
+	}
+
+	if got, want := pkgs.BinaryPackages("apt"), []*PkgInfo{aptUtils, apt}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BinaryPackages(%q) = %v, want %v", "apt", got, want)
+	}
+	if got := pkgs.BinaryPackages("missing"); got != nil {
+		t.Errorf("BinaryPackages(%q) = %v, want nil", "missing", got)
+	}
+}
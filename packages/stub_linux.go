@@ -33,3 +33,13 @@ func MSIInfo(_ string) (string, string, error) {
 func MSIInstalled(_ string) (bool, error) {
 	return false, nil
 }
+
+// InstalledMSIProducts is a linux stub function.
+func InstalledMSIProducts(_ context.Context) ([]*MSIProduct, error) {
+	return nil, nil
+}
+
+// RemoveMSIProduct is a linux stub function.
+func RemoveMSIProduct(_ context.Context, _ string) error {
+	return nil
+}
@@ -18,9 +18,21 @@
 package packages
 
 import (
+	"errors"
 	"os/exec"
+	"os/user"
 )
 
 func runWithPty(cmd *exec.Cmd) ([]byte, []byte, error) {
 	return nil, nil, nil
 }
+
+// fileOwner is a windows stub function, brew is not looked for on Windows.
+func fileOwner(path string) (*user.User, error) {
+	return nil, errors.New("file owners are not supported on Windows")
+}
+
+// runAs is a windows stub function, brew is not looked for on Windows.
+func runAs(cmd *exec.Cmd, u *user.User) error {
+	return errors.New("running as another user is not supported on Windows")
+}
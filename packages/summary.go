@@ -0,0 +1,131 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import "strings"
+
+// Normalized update severities, from most to least severe.
+const (
+	SeverityCritical  = "critical"
+	SeverityImportant = "important"
+	SeverityModerate  = "moderate"
+	SeverityLow       = "low"
+	SeverityUnknown   = "unknown"
+)
+
+var severityRank = map[string]int{
+	SeverityCritical:  4,
+	SeverityImportant: 3,
+	SeverityModerate:  2,
+	SeverityLow:       1,
+	SeverityUnknown:   0,
+}
+
+// NormalizeSeverity maps the severities reported by yum, dnf, zypper and
+// Windows Update to one of the Severity constants.
+func NormalizeSeverity(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "critical":
+		return SeverityCritical
+	case "important", "high":
+		return SeverityImportant
+	case "moderate", "medium":
+		return SeverityModerate
+	case "low":
+		return SeverityLow
+	}
+	return SeverityUnknown
+}
+
+// SeverityAtLeast reports whether sev, normalized with NormalizeSeverity, is
+// at least as severe as min. Unknown severities are never at least min.
+func SeverityAtLeast(sev, min string) bool {
+	sev = NormalizeSeverity(sev)
+	return sev != SeverityUnknown && severityRank[sev] >= severityRank[NormalizeSeverity(min)]
+}
+
+// SeveritiesAtLeast returns the severities at least as severe as min, most
+// severe first, in the lowercase form zypper and Windows Update accept.
+func SeveritiesAtLeast(min string) []string {
+	var sevs []string
+	for _, sev := range []string{SeverityCritical, SeverityImportant, SeverityModerate, SeverityLow} {
+		if SeverityAtLeast(sev, min) {
+			sevs = append(sevs, sev)
+		}
+	}
+	return sevs
+}
+
+// UpdateSummary counts available updates, as returned by GetPackageUpdates,
+// by manager and by severity.
+type UpdateSummary struct {
+	Total int
+	// ByManager is keyed by the JSON name of the Packages field, e.g. "yum"
+	// or "zypperPatches".
+	ByManager map[string]int
+	// BySeverity is keyed by the Severity constants, all of which are
+	// present.
+	BySeverity map[string]int
+}
+
+// SummarizeUpdates summarizes pkgs. Zypper patches carry their own severity,
+// package updates get the highest severity of the advisories covering them,
+// as returned by YumAdvisories, and are unknown otherwise.
+func SummarizeUpdates(pkgs *Packages, advisories []*Advisory) *UpdateSummary {
+	s := &UpdateSummary{ByManager: map[string]int{}, BySeverity: map[string]int{}}
+	for sev := range severityRank {
+		s.BySeverity[sev] = 0
+	}
+	if pkgs == nil {
+		return s
+	}
+
+	bySeverity := map[string]string{}
+	for _, a := range advisories {
+		sev := NormalizeSeverity(a.Severity)
+		for _, p := range a.Packages {
+			if cur, ok := bySeverity[p.Name]; !ok || severityRank[sev] > severityRank[cur] {
+				bySeverity[p.Name] = sev
+			}
+		}
+	}
+	add := func(manager, severity string) {
+		s.Total++
+		s.ByManager[manager]++
+		s.BySeverity[severity]++
+	}
+	addPkgs := func(manager string, list []*PkgInfo) {
+		for _, p := range list {
+			sev, ok := bySeverity[p.Name]
+			if !ok {
+				sev = SeverityUnknown
+			}
+			add(manager, sev)
+		}
+	}
+
+	addPkgs("yum", pkgs.Yum)
+	addPkgs("apt", pkgs.Apt)
+	addPkgs("zypper", pkgs.Zypper)
+	addPkgs("googet", pkgs.GooGet)
+	for _, p := range pkgs.ZypperPatches {
+		add("zypperPatches", NormalizeSeverity(p.Severity))
+	}
+	for range pkgs.WUA {
+		// The inventory does not keep the MSRC severity of updates.
+		add("wua", SeverityUnknown)
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummarizeUpdates(t *testing.T) {
+	pkgs := &Packages{
+		Yum: []*PkgInfo{
+			{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1160.108.1.el7"},
+			{Name: "tzdata", Arch: "noarch", Version: "2024a-1.el7"},
+			{Name: "bash", Arch: "x86_64", Version: "4.2.46-35.el7"},
+		},
+		ZypperPatches: []*ZypperPatch{
+			{Name: "SUSE-2024-1", Category: "security", Severity: "critical"},
+			{Name: "SUSE-2024-2", Category: "recommended", Severity: "unspecified"},
+		},
+		GooGet: []*PkgInfo{{Name: "googet", Arch: "x86_64", Version: "2.18.3@1"}},
+	}
+	advisories := []*Advisory{
+		{ID: "RHSA-2024:0001", Type: "security", Severity: "Moderate", Packages: []*PkgInfo{{Name: "kernel"}}},
+		{ID: "RHSA-2024:0002", Type: "security", Severity: "Important", Packages: []*PkgInfo{{Name: "kernel"}}},
+		{ID: "RHBA-2024:0003", Type: "bugfix", Packages: []*PkgInfo{{Name: "tzdata"}}},
+	}
+
+	want := &UpdateSummary{
+		Total:     6,
+		ByManager: map[string]int{"yum": 3, "zypperPatches": 2, "googet": 1},
+		BySeverity: map[string]int{
+			SeverityCritical:  1,
+			SeverityImportant: 1,
+			SeverityModerate:  0,
+			SeverityLow:       0,
+			SeverityUnknown:   4,
+		},
+	}
+	if diff := cmp.Diff(want, SummarizeUpdates(pkgs, advisories)); diff != "" {
+		t.Errorf("SummarizeUpdates() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNormalizeSeverity(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Critical", SeverityCritical},
+		{"important", SeverityImportant},
+		{"Moderate", SeverityModerate},
+		{"low", SeverityLow},
+		{"unspecified", SeverityUnknown},
+		{"", SeverityUnknown},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSeverity(tt.in); got != tt.want {
+			t.Errorf("NormalizeSeverity(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSeveritiesAtLeast(t *testing.T) {
+	tests := []struct {
+		min  string
+		want []string
+	}{
+		{"Critical", []string{SeverityCritical}},
+		{"important", []string{SeverityCritical, SeverityImportant}},
+		{"Low", []string{SeverityCritical, SeverityImportant, SeverityModerate, SeverityLow}},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, SeveritiesAtLeast(tt.min)); diff != "" {
+			t.Errorf("SeveritiesAtLeast(%q) mismatch (-want +got):\n%s", tt.min, diff)
+		}
+	}
+	if SeverityAtLeast("", SeverityLow) {
+		t.Error("SeverityAtLeast(\"\", low) = true, want false")
+	}
+}
@@ -0,0 +1,228 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/osinfo"
+	"github.com/ulikunitz/xz"
+)
+
+// supportBundleFile is a file inside a support bundle that contains a
+// package listing.
+type supportBundleFile struct {
+	suffix string
+	parse  func([]byte, *Packages)
+}
+
+var supportBundleFiles = []supportBundleFile{
+	// sosreport: rpm -qa output sorted by name, followed by the install date.
+	{suffix: "/installed-rpms", parse: func(b []byte, p *Packages) { p.Rpm = append(p.Rpm, parseInstalledRPMsListing(b)...) }},
+	// sosreport: dpkg -l output.
+	{suffix: "/sos_commands/dpkg/dpkg_-l", parse: func(b []byte, p *Packages) { p.Deb = append(p.Deb, parseDpkgListing(b)...) }},
+	// supportconfig: rpm -qa output formatted as "NAME DISTRIBUTION VERSION-RELEASE".
+	{suffix: "/rpm.txt", parse: func(b []byte, p *Packages) { p.Rpm = append(p.Rpm, parseSupportconfigRPMListing(b)...) }},
+}
+
+// ReadSupportBundle reads the installed packages recorded in a sosreport or
+// supportconfig bundle. The path can either be an extracted bundle directory
+// or a .tar, .tar.gz, .tgz or .tar.xz archive.
+func ReadSupportBundle(path string) (*Packages, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := &Packages{}
+	var found bool
+	visit := func(name string, content func() ([]byte, error)) error {
+		name = "/" + filepath.ToSlash(name)
+		for _, f := range supportBundleFiles {
+			if !strings.HasSuffix(name, f.suffix) {
+				continue
+			}
+			b, err := content()
+			if err != nil {
+				return fmt.Errorf("error reading %q: %v", name, err)
+			}
+			found = true
+			f.parse(b, pkgs)
+		}
+		return nil
+	}
+
+	if fi.IsDir() {
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			return visit(p, func() ([]byte, error) { return ioutil.ReadFile(p) })
+		})
+	} else {
+		err = walkTarArchive(path, visit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no package listings found in support bundle %q", path)
+	}
+	return pkgs, nil
+}
+
+func walkTarArchive(path string, visit func(string, func() ([]byte, error)) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		if r, err = gzip.NewReader(f); err != nil {
+			return err
+		}
+	case strings.HasSuffix(path, ".tar.xz"), strings.HasSuffix(path, ".txz"):
+		if r, err = xz.NewReader(f); err != nil {
+			return err
+		}
+	case strings.HasSuffix(path, ".tar"):
+		r = f
+	default:
+		return errors.New("unsupported support bundle archive type")
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(header.Name, func() ([]byte, error) { return ioutil.ReadAll(tr) }); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRPMNEVRA splits a name-version-release.arch string as printed by
+// rpm -qa into a PkgInfo.
+func parseRPMNEVRA(nevra string) (*PkgInfo, bool) {
+	dot := strings.LastIndex(nevra, ".")
+	if dot <= 0 {
+		return nil, false
+	}
+	nvr, arch := nevra[:dot], nevra[dot+1:]
+	rel := strings.LastIndex(nvr, "-")
+	if rel <= 0 {
+		return nil, false
+	}
+	ver := strings.LastIndex(nvr[:rel], "-")
+	if ver <= 0 {
+		return nil, false
+	}
+	return &PkgInfo{Name: nvr[:ver], Arch: osinfo.Architecture(arch), Version: nvr[ver+1:]}, true
+}
+
+func parseInstalledRPMsListing(data []byte) []*PkgInfo {
+	/*
+		NetworkManager-1.18.8-1.el7.x86_64                          Tue Jun 30 10:00:01 2020
+		bash-4.2.46-34.el7.x86_64                                   Tue Jun 30 09:58:44 2020
+		gpg-pubkey-f4a80eb5-53a7ff4b                                Tue Jun 30 10:01:12 2020
+	*/
+	var pkgs []*PkgInfo
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if pkg, ok := parseRPMNEVRA(fields[0]); ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs
+}
+
+func parseSupportconfigRPMListing(data []byte) []*PkgInfo {
+	/*
+		#==[ Command ]======================================#
+		# /bin/rpm -qa --queryformat "%-35{NAME} %-35{DISTRIBUTION} %{VERSION}-%{RELEASE}\n"
+		NAME                                DISTRIBUTION                        VERSION
+		aaa_base                            SUSE Linux Enterprise 15            84.87+git20180409.04c9dae-3.39.1
+		bash                                SUSE Linux Enterprise 15            4.4-19.6.1
+	*/
+	var pkgs []*PkgInfo
+	var inListing bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#==[") {
+			inListing = false
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "NAME" && fields[len(fields)-1] == "VERSION" {
+			inListing = true
+			continue
+		}
+		if !inListing || len(fields) < 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pkgs = append(pkgs, &PkgInfo{Name: fields[0], Version: fields[len(fields)-1]})
+	}
+	return pkgs
+}
+
+func parseDpkgListing(data []byte) []*PkgInfo {
+	/*
+		Desired=Unknown/Install/Remove/Purge/Hold
+		| Status=Not/Inst/Conf-files/Unpacked/halF-conf/Half-inst/trig-aWait/Trig-pend
+		|/ Err?=(none)/Reinst-required (Status,Err: uppercase=bad)
+		||/ Name           Version      Architecture Description
+		+++-==============-============-============-=================================
+		ii  adduser        3.118        all          add and remove users and groups
+		ii  libc6:amd64    2.31-0ubuntu9 amd64       GNU C Library: Shared libraries
+		rc  removed        1.0          amd64        package with only config files left
+	*/
+	var pkgs []*PkgInfo
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "ii" {
+			continue
+		}
+		name := strings.SplitN(fields[1], ":", 2)[0]
+		pkgs = append(pkgs, &PkgInfo{Name: name, Arch: osinfo.Architecture(fields[3]), Version: fields[2], Epoch: epochOf(fields[2])})
+	}
+	return pkgs
+}
@@ -0,0 +1,142 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testInstalledRPMs = `NetworkManager-1.18.8-1.el7.x86_64                          Tue Jun 30 10:00:01 2020
+gpg-pubkey-f4a80eb5-53a7ff4b                                Tue Jun 30 10:01:12 2020
+not-an-rpm
+`
+	testDpkgListing = `Desired=Unknown/Install/Remove/Purge/Hold
+| Status=Not/Inst/Conf-files/Unpacked/halF-conf/Half-inst/trig-aWait/Trig-pend
+|/ Err?=(none)/Reinst-required (Status,Err: uppercase=bad)
+||/ Name           Version       Architecture Description
++++-==============-=============-============-=================================
+ii  adduser        3.118         all          add and remove users and groups
+ii  libc6:amd64    2.31-0ubuntu9 amd64        GNU C Library: Shared libraries
+rc  removed        1.0           amd64        package with only config files left
+`
+	testSupportconfigRPMs = `#==[ Command ]======================================#
+# /bin/rpm -qa --queryformat "%-35{NAME} %-35{DISTRIBUTION} %{VERSION}-%{RELEASE}\n"
+NAME                                DISTRIBUTION                        VERSION
+aaa_base                            SUSE Linux Enterprise 15            84.87-3.39.1
+bash                                SUSE Linux Enterprise 15            4.4-19.6.1
+
+#==[ Command ]======================================#
+# /bin/rpm -qa --last
+bash-4.4-19.6.1.x86_64                        Tue Jun 30 10:00:01 2020
+`
+)
+
+func TestParseInstalledRPMsListing(t *testing.T) {
+	// gpg-pubkey entries have no arch and are skipped.
+	want := []*PkgInfo{{Name: "NetworkManager", Arch: "x86_64", Version: "1.18.8-1.el7"}}
+	got := parseInstalledRPMsListing([]byte(testInstalledRPMs))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseInstalledRPMsListing() = %v, want %v", got, want)
+	}
+}
+
+func TestParseDpkgListing(t *testing.T) {
+	want := []*PkgInfo{
+		{Name: "adduser", Arch: "all", Version: "3.118"},
+		{Name: "libc6", Arch: "x86_64", Version: "2.31-0ubuntu9"},
+	}
+	if got := parseDpkgListing([]byte(testDpkgListing)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDpkgListing() = %v, want %v", got, want)
+	}
+}
+
+func TestParseSupportconfigRPMListing(t *testing.T) {
+	want := []*PkgInfo{
+		{Name: "aaa_base", Version: "84.87-3.39.1"},
+		{Name: "bash", Version: "4.4-19.6.1"},
+	}
+	if got := parseSupportconfigRPMListing([]byte(testSupportconfigRPMs)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSupportconfigRPMListing() = %v, want %v", got, want)
+	}
+}
+
+func TestReadSupportBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sosreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"sosreport-host-2020/installed-rpms":            testInstalledRPMs,
+		"sosreport-host-2020/sos_commands/dpkg/dpkg_-l": testDpkgListing,
+		"sosreport-host-2020/etc/hostname":              "host\n",
+	}
+
+	archive := filepath.Join(dir, "sosreport-host-2020.tar.gz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	f.Close()
+
+	extracted := filepath.Join(dir, "extracted")
+	for name, content := range files {
+		p := filepath.Join(extracted, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := &Packages{
+		Rpm: []*PkgInfo{{Name: "NetworkManager", Arch: "x86_64", Version: "1.18.8-1.el7"}},
+		Deb: []*PkgInfo{{Name: "adduser", Arch: "all", Version: "3.118"}, {Name: "libc6", Arch: "x86_64", Version: "2.31-0ubuntu9"}},
+	}
+	for _, path := range []string{archive, extracted} {
+		got, err := ReadSupportBundle(path)
+		if err != nil {
+			t.Fatalf("ReadSupportBundle(%q): unexpected error: %v", path, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadSupportBundle(%q) = %+v, want %+v", path, got, want)
+		}
+	}
+
+	if _, err := ReadSupportBundle(filepath.Join(extracted, "sosreport-host-2020", "etc")); err == nil {
+		t.Errorf("did not get expected error for bundle without package listings")
+	}
+}
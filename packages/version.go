@@ -0,0 +1,282 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitEpoch splits a "[epoch:]version" string, the epoch is empty if the
+// version does not have one.
+func splitEpoch(version string) (string, string) {
+	i := strings.Index(version, ":")
+	if i <= 0 {
+		return "", version
+	}
+	for _, c := range version[:i] {
+		if !isDigit(c) {
+			return "", version
+		}
+	}
+	return version[:i], version[i+1:]
+}
+
+// epochOf returns the epoch of a deb or rpm version, or an empty string if it
+// does not have one.
+func epochOf(version string) string {
+	epoch, _ := splitEpoch(version)
+	return epoch
+}
+
+func compareEpochs(a, b string) int {
+	// A missing epoch is epoch 0.
+	ai, _ := strconv.Atoi(a)
+	bi, _ := strconv.Atoi(b)
+	switch {
+	case ai < bi:
+		return -1
+	case ai > bi:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+// CompareDebVersions compares two Debian package versions, of the form
+// [epoch:]upstream_version[-debian_revision], the way dpkg does. It returns
+// -1 if a is older than b, 0 if they are equal and 1 if a is newer than b.
+func CompareDebVersions(a, b string) int {
+	aEpoch, a := splitEpoch(a)
+	bEpoch, b := splitEpoch(b)
+	if c := compareEpochs(aEpoch, bEpoch); c != 0 {
+		return c
+	}
+
+	aUpstream, aRevision := a, ""
+	if i := strings.LastIndex(a, "-"); i >= 0 {
+		aUpstream, aRevision = a[:i], a[i+1:]
+	}
+	bUpstream, bRevision := b, ""
+	if i := strings.LastIndex(b, "-"); i >= 0 {
+		bUpstream, bRevision = b[:i], b[i+1:]
+	}
+	if c := debVerRevCmp(aUpstream, bUpstream); c != 0 {
+		return c
+	}
+	return debVerRevCmp(aRevision, bRevision)
+}
+
+// debOrder is the sort weight of a non digit character in a Debian version:
+// '~' sorts before everything, even the end of the string, and letters sort
+// before all other characters.
+func debOrder(c rune) int {
+	switch {
+	case c == 0 || isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+// debVerRevCmp is dpkg's verrevcmp, comparing alternating non digit and digit
+// parts of two upstream versions or revisions.
+func debVerRevCmp(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	at := func(r []rune, i int) rune {
+		if i < len(r) {
+			return r[i]
+		}
+		return 0
+	}
+
+	i, j := 0, 0
+	for i < len(ar) || j < len(br) {
+		firstDiff := 0
+		for (i < len(ar) && !isDigit(ar[i])) || (j < len(br) && !isDigit(br[j])) {
+			ac, bc := debOrder(at(ar, i)), debOrder(at(br, j))
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(ar) && ar[i] == '0' {
+			i++
+		}
+		for j < len(br) && br[j] == '0' {
+			j++
+		}
+		for i < len(ar) && j < len(br) && isDigit(ar[i]) && isDigit(br[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(ar[i]) - int(br[j])
+			}
+			i++
+			j++
+		}
+		if i < len(ar) && isDigit(ar[i]) {
+			return 1
+		}
+		if j < len(br) && isDigit(br[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// CompareRPMEVR compares two RPM versions, of the form
+// [epoch:]version[-release], the way rpm does. The releases are only
+// compared if both versions have one, so "1.2" matches any release of 1.2.
+// It returns -1 if a is older than b, 0 if they are equal and 1 if a is newer
+// than b.
+func CompareRPMEVR(a, b string) int {
+	aEpoch, a := splitEpoch(a)
+	bEpoch, b := splitEpoch(b)
+	if c := compareEpochs(aEpoch, bEpoch); c != 0 {
+		return c
+	}
+
+	aVersion, aRelease := a, ""
+	if i := strings.LastIndex(a, "-"); i >= 0 {
+		aVersion, aRelease = a[:i], a[i+1:]
+	}
+	bVersion, bRelease := b, ""
+	if i := strings.LastIndex(b, "-"); i >= 0 {
+		bVersion, bRelease = b[:i], b[i+1:]
+	}
+	if c := rpmVerCmp(aVersion, bVersion); c != 0 || aRelease == "" || bRelease == "" {
+		return c
+	}
+	return rpmVerCmp(aRelease, bRelease)
+}
+
+// rpmVerCmp is rpm's rpmvercmp, comparing alternating alphabetic and numeric
+// segments of two versions or releases.
+func rpmVerCmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSep := func(c rune) bool { return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^' }
+	one, two := []rune(a), []rune(b)
+
+	for len(one) > 0 || len(two) > 0 {
+		for len(one) > 0 && isSep(one[0]) {
+			one = one[1:]
+		}
+		for len(two) > 0 && isSep(two[0]) {
+			two = two[1:]
+		}
+
+		// '~' sorts before everything, even the end of the version.
+		if (len(one) > 0 && one[0] == '~') || (len(two) > 0 && two[0] == '~') {
+			if len(one) == 0 || one[0] != '~' {
+				return 1
+			}
+			if len(two) == 0 || two[0] != '~' {
+				return -1
+			}
+			one, two = one[1:], two[1:]
+			continue
+		}
+
+		// '^' sorts after the end of the version but before everything else.
+		if (len(one) > 0 && one[0] == '^') || (len(two) > 0 && two[0] == '^') {
+			if len(one) == 0 {
+				return -1
+			}
+			if len(two) == 0 {
+				return 1
+			}
+			if one[0] != '^' {
+				return 1
+			}
+			if two[0] != '^' {
+				return -1
+			}
+			one, two = one[1:], two[1:]
+			continue
+		}
+
+		if len(one) == 0 || len(two) == 0 {
+			break
+		}
+
+		isNum := isDigit(one[0])
+		match := isAlpha
+		if isNum {
+			match = isDigit
+		}
+		i := 0
+		for i < len(one) && match(one[i]) {
+			i++
+		}
+		j := 0
+		for j < len(two) && match(two[j]) {
+			j++
+		}
+		seg1, seg2 := string(one[:i]), string(two[:j])
+		one, two = one[i:], two[j:]
+
+		// Segments of different types, numeric segments are newer.
+		if seg2 == "" {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		if isNum {
+			seg1 = strings.TrimLeft(seg1, "0")
+			seg2 = strings.TrimLeft(seg2, "0")
+			if len(seg1) != len(seg2) {
+				return sign(len(seg1) - len(seg2))
+			}
+		}
+		if c := strings.Compare(seg1, seg2); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(one) == 0 && len(two) == 0:
+		return 0
+	case len(one) > 0:
+		return 1
+	}
+	return -1
+}
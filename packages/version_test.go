@@ -0,0 +1,107 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import "testing"
+
+func TestCompareDebVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-1", 0},
+		{"1.0", "1.0-0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1:1.0", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1:1.0", "2:0.1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0+", -1},
+		{"1.0.1", "1.0a", 1},
+		{"2.25.1-1ubuntu3.12", "2.25.1-1ubuntu3.2", 1},
+		{"1.001", "1.1", 0},
+		{"7.4.052-1ubuntu3", "7.4.052-1ubuntu3.1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareDebVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareDebVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareDebVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareDebVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareRPMEVR(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"1.0aa", "1.0a", 1},
+		{"2.0", "2_0", 0},
+		{"1.0010", "1.9", 1},
+		{"1b.fc17", "1.fc17", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-1.el8", "1.0-1.el7", 1},
+		{"1.0-10", "1.0", 0},
+		{"1:1.0-1", "2.0-1", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"4.2.46-34.el7", "4.2.46-35.el7", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareRPMEVR(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareRPMEVR(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareRPMEVR(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareRPMEVR(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestEpochOf(t *testing.T) {
+	tests := []struct {
+		version, want string
+	}{
+		{"1.0", ""},
+		{"1:1.0", "1"},
+		{"12:1.0-1:2", "12"},
+		{"a:1.0", ""},
+		{":1.0", ""},
+	}
+	for _, tt := range tests {
+		if got := epochOf(tt.version); got != tt.want {
+			t.Errorf("epochOf(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
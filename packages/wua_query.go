@@ -0,0 +1,194 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WUAQuery is a Windows Update Agent search, built with NewWUAQuery.
+//
+// Criteria that IUpdateSearcher.Search supports are turned into the search
+// criteria string returned by Criteria. MSRC severity is not a supported
+// search criterion and neither are KB exclusions, updates have to be checked
+// with MatchesSeverity and ExcludesKB after the search.
+type WUAQuery struct {
+	installed      *bool
+	rebootRequired *bool
+	hidden         *bool
+	categoryIDs    []string
+	severities     []string
+	excludeKBs     []string
+}
+
+// WUAQueryOption is an option for NewWUAQuery.
+type WUAQueryOption func(*WUAQuery)
+
+// WUAQueryInstalled returns a WUAQueryOption that filters on whether updates
+// are installed (IsInstalled).
+func WUAQueryInstalled(installed bool) WUAQueryOption {
+	return func(q *WUAQuery) {
+		q.installed = &installed
+	}
+}
+
+// WUAQueryRebootRequired returns a WUAQueryOption that filters on whether
+// updates require a reboot to finish installing (RebootRequired).
+func WUAQueryRebootRequired(rebootRequired bool) WUAQueryOption {
+	return func(q *WUAQuery) {
+		q.rebootRequired = &rebootRequired
+	}
+}
+
+// WUAQueryHidden returns a WUAQueryOption that filters on whether updates are
+// hidden (IsHidden).
+func WUAQueryHidden(hidden bool) WUAQueryOption {
+	return func(q *WUAQuery) {
+		q.hidden = &hidden
+	}
+}
+
+// WUAQueryCategories returns a WUAQueryOption that only matches updates in
+// any of the given category or classification GUIDs (CategoryIDs).
+func WUAQueryCategories(categoryIDs ...string) WUAQueryOption {
+	return func(q *WUAQuery) {
+		q.categoryIDs = append(q.categoryIDs, categoryIDs...)
+	}
+}
+
+// WUAQueryMsrcSeverities returns a WUAQueryOption that only matches updates
+// with any of the given MSRC severities, e.g. "Critical" or "Important".
+func WUAQueryMsrcSeverities(severities ...string) WUAQueryOption {
+	return func(q *WUAQuery) {
+		q.severities = append(q.severities, severities...)
+	}
+}
+
+// WUAQueryExcludeKBs returns a WUAQueryOption that excludes updates with any
+// of the given KB article IDs, with or without the "KB" prefix.
+func WUAQueryExcludeKBs(kbs ...string) WUAQueryOption {
+	return func(q *WUAQuery) {
+		for _, kb := range kbs {
+			q.excludeKBs = append(q.excludeKBs, trimKB(kb))
+		}
+	}
+}
+
+func trimKB(kb string) string {
+	if strings.HasPrefix(strings.ToUpper(kb), "KB") {
+		return kb[2:]
+	}
+	return kb
+}
+
+// NewWUAQuery returns a WUAQuery with the given options.
+func NewWUAQuery(opts ...WUAQueryOption) *WUAQuery {
+	q := &WUAQuery{}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+func boolCriterion(name string, b *bool) string {
+	if *b {
+		return name + "=1"
+	}
+	return name + "=0"
+}
+
+// Criteria returns the search criteria string to pass to
+// IUpdateSearcher.Search, e.g. "IsInstalled=0 AND RebootRequired=0".
+func (q *WUAQuery) Criteria() string {
+	var and []string
+	if q.installed != nil {
+		and = append(and, boolCriterion("IsInstalled", q.installed))
+	}
+	if q.rebootRequired != nil {
+		and = append(and, boolCriterion("RebootRequired", q.rebootRequired))
+	}
+	if q.hidden != nil {
+		and = append(and, boolCriterion("IsHidden", q.hidden))
+	}
+
+	if len(q.categoryIDs) == 0 {
+		if len(and) == 0 {
+			// An empty criteria is not valid, match all updates that are
+			// either installed or not.
+			return "IsInstalled=0 OR IsInstalled=1"
+		}
+		return strings.Join(and, " AND ")
+	}
+
+	// OR is only allowed at the top level of the criteria, so each category
+	// gets a copy of the other criteria.
+	var or []string
+	for _, id := range q.categoryIDs {
+		c := append(append([]string{}, and...), fmt.Sprintf("CategoryIDs contains '%s'", id))
+		s := strings.Join(c, " AND ")
+		if len(q.categoryIDs) > 1 {
+			s = "(" + s + ")"
+		}
+		or = append(or, s)
+	}
+	return strings.Join(or, " OR ")
+}
+
+// String returns the search criteria, followed by the severity filter and
+// KB exclusions if any, for logging.
+func (q *WUAQuery) String() string {
+	s := q.Criteria()
+	if len(q.severities) != 0 {
+		s += fmt.Sprintf(" (MsrcSeverity in %q)", q.severities)
+	}
+	if len(q.excludeKBs) != 0 {
+		s += fmt.Sprintf(" (KBArticleIDs not in %q)", q.excludeKBs)
+	}
+	return s
+}
+
+// PostFilter reports whether search results have to be checked with
+// MatchesSeverity and ExcludesKB.
+func (q *WUAQuery) PostFilter() bool {
+	return len(q.severities) != 0 || len(q.excludeKBs) != 0
+}
+
+// ExcludesKB reports whether an update with the given KBArticleIDs is
+// excluded by the query.
+func (q *WUAQuery) ExcludesKB(kbArticleIDs []string) bool {
+	for _, id := range kbArticleIDs {
+		for _, e := range q.excludeKBs {
+			if trimKB(id) == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchesSeverity reports whether an update with the given MsrcSeverity
+// matches the query.
+func (q *WUAQuery) MatchesSeverity(severity string) bool {
+	if len(q.severities) == 0 {
+		return true
+	}
+	for _, s := range q.severities {
+		if strings.EqualFold(s, severity) {
+			return true
+		}
+	}
+	return false
+}
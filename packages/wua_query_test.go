@@ -0,0 +1,104 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import "testing"
+
+func TestWUAQueryCriteria(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []WUAQueryOption
+		want string
+	}{
+		{"Empty", nil, "IsInstalled=0 OR IsInstalled=1"},
+		{"NotInstalled", []WUAQueryOption{WUAQueryInstalled(false), WUAQueryRebootRequired(false)}, "IsInstalled=0 AND RebootRequired=0"},
+		{"Hidden", []WUAQueryOption{WUAQueryInstalled(true), WUAQueryHidden(true)}, "IsInstalled=1 AND IsHidden=1"},
+		{"OneCategory", []WUAQueryOption{WUAQueryInstalled(false), WUAQueryCategories("abc")}, "IsInstalled=0 AND CategoryIDs contains 'abc'"},
+		{"CategoryOnly", []WUAQueryOption{WUAQueryCategories("abc")}, "CategoryIDs contains 'abc'"},
+		{"TwoCategories", []WUAQueryOption{WUAQueryInstalled(false), WUAQueryCategories("abc", "def")}, "(IsInstalled=0 AND CategoryIDs contains 'abc') OR (IsInstalled=0 AND CategoryIDs contains 'def')"},
+		{"SeverityNotInCriteria", []WUAQueryOption{WUAQueryInstalled(false), WUAQueryMsrcSeverities("Critical")}, "IsInstalled=0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewWUAQuery(tt.opts...).Criteria(); got != tt.want {
+				t.Errorf("Criteria() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWUAQueryString(t *testing.T) {
+	q := NewWUAQuery(WUAQueryInstalled(false), WUAQueryMsrcSeverities("Critical", "Important"))
+	want := `IsInstalled=0 (MsrcSeverity in ["Critical" "Important"])`
+	if got := q.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestWUAQueryMatchesSeverity(t *testing.T) {
+	tests := []struct {
+		name       string
+		severities []string
+		severity   string
+		want       bool
+	}{
+		{"NoFilter", nil, "", true},
+		{"NoFilterAnySeverity", nil, "Low", true},
+		{"Match", []string{"Critical", "Important"}, "Important", true},
+		{"MatchCaseInsensitive", []string{"critical"}, "Critical", true},
+		{"NoMatch", []string{"Critical"}, "Moderate", false},
+		{"NoSeverity", []string{"Critical"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewWUAQuery(WUAQueryMsrcSeverities(tt.severities...))
+			if got := q.MatchesSeverity(tt.severity); got != tt.want {
+				t.Errorf("MatchesSeverity(%q) = %v, want %v", tt.severity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWUAQueryExcludesKB(t *testing.T) {
+	q := NewWUAQuery(WUAQueryExcludeKBs("KB5034441", "5001716"))
+	tests := []struct {
+		name string
+		kbs  []string
+		want bool
+	}{
+		{"NoKBs", nil, false},
+		{"Match", []string{"5034441"}, true},
+		{"MatchWithPrefix", []string{"KB5001716"}, true},
+		{"NoMatch", []string{"5034442"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := q.ExcludesKB(tt.kbs); got != tt.want {
+				t.Errorf("ExcludesKB(%q) = %v, want %v", tt.kbs, got, tt.want)
+			}
+		})
+	}
+
+	if !q.PostFilter() {
+		t.Error("PostFilter() = false, want true")
+	}
+	if NewWUAQuery(WUAQueryInstalled(false)).PostFilter() {
+		t.Error("PostFilter() = true for a query without severities or KB exclusions, want false")
+	}
+	want := `IsInstalled=0 OR IsInstalled=1 (KBArticleIDs not in ["5034441" "5001716"])`
+	if got := q.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
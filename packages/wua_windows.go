@@ -68,19 +68,13 @@ func (s *IUpdateSession) Close() {
 	wuaSession.Unlock()
 }
 
-// InstallWUAUpdate install a WIndows update.
-func (s *IUpdateSession) InstallWUAUpdate(ctx context.Context, updt *IUpdate) error {
+// acceptEula accepts the EULA of updt if needed.
+func acceptEula(ctx context.Context, updt *IUpdate) error {
 	title, err := updt.GetProperty("Title")
 	if err != nil {
 		return fmt.Errorf(`updt.GetProperty("Title"): %v`, err)
 	}
 
-	updts, err := NewUpdateCollection()
-	if err != nil {
-		return err
-	}
-	defer updts.Release()
-
 	eula, err := updt.GetProperty("EulaAccepted")
 	if err != nil {
 		return fmt.Errorf(`updt.GetProperty("EulaAccepted"): %v`, err)
@@ -94,7 +88,25 @@ func (s *IUpdateSession) InstallWUAUpdate(ctx context.Context, updt *IUpdate) er
 	} else {
 		clog.Debugf(ctx, "%s - EulaAccepted: %v", title.Value(), eula.Value())
 	}
+	return nil
+}
+
+// InstallWUAUpdate install a WIndows update.
+func (s *IUpdateSession) InstallWUAUpdate(ctx context.Context, updt *IUpdate) error {
+	title, err := updt.GetProperty("Title")
+	if err != nil {
+		return fmt.Errorf(`updt.GetProperty("Title"): %v`, err)
+	}
+
+	updts, err := NewUpdateCollection()
+	if err != nil {
+		return err
+	}
+	defer updts.Release()
 
+	if err := acceptEula(ctx, updt); err != nil {
+		return err
+	}
 	if err := updts.Add(updt); err != nil {
 		return err
 	}
@@ -172,6 +184,12 @@ func GetCount(dis *ole.IDispatch) (int32, error) {
 	return count, nil
 }
 
+// KBArticleIDs returns the KB article IDs of the update, without the "KB"
+// prefix.
+func (u *IUpdate) KBArticleIDs() ([]string, error) {
+	return u.kbaIDs()
+}
+
 func (u *IUpdate) kbaIDs() ([]string, error) {
 	kbArticleIDsRaw, err := u.GetProperty("KBArticleIDs")
 	if err != nil {
@@ -426,6 +444,75 @@ func (s *IUpdateSession) InstallWUAUpdateCollection(ctx context.Context, updates
 	return nil
 }
 
+// InstallWUAUpdates downloads and installs updts in a single batch,
+// accepting their EULAs, and returns the result of each.
+func (s *IUpdateSession) InstallWUAUpdates(ctx context.Context, updts []*IUpdate) ([]*WUAInstallResult, error) {
+	coll, err := NewUpdateCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Release()
+
+	for _, updt := range updts {
+		if err := acceptEula(ctx, updt); err != nil {
+			return nil, err
+		}
+		if err := coll.Add(updt); err != nil {
+			return nil, err
+		}
+	}
+
+	clog.Debugf(ctx, "Downloading %d updates", len(updts))
+	if err := s.DownloadWUAUpdateCollection(ctx, coll); err != nil {
+		return nil, fmt.Errorf("DownloadWUAUpdateCollection error: %v", err)
+	}
+
+	installerRaw, err := s.CallMethod("CreateUpdateInstaller")
+	if err != nil {
+		return nil, fmt.Errorf("error calling method CreateUpdateInstaller on IUpdateSession: %v"+GetScodeString(ctx, err), err)
+	}
+	installer := installerRaw.ToIDispatch()
+	defer installer.Release()
+
+	if _, err := installer.PutProperty("Updates", coll.IDispatch); err != nil {
+		return nil, fmt.Errorf("error calling PutProperty Updates on IUpdateInstaller: %v"+GetScodeString(ctx, err), err)
+	}
+
+	clog.Debugf(ctx, "Installing %d updates", len(updts))
+	// returns IInstallationResult
+	// https://learn.microsoft.com/en-us/windows/win32/api/wuapi/nn-wuapi-iinstallationresult
+	resultRaw, err := installer.CallMethod("Install")
+	if err != nil {
+		return nil, fmt.Errorf("error calling method Install on IUpdateInstaller: %v"+GetScodeString(ctx, err), err)
+	}
+	result := resultRaw.ToIDispatch()
+	defer result.Release()
+
+	var results []*WUAInstallResult
+	for i := range updts {
+		// returns IUpdateInstallationResult
+		updtResultRaw, err := result.CallMethod("GetUpdateResult", i)
+		if err != nil {
+			return nil, fmt.Errorf("error calling method GetUpdateResult on IInstallationResult: %v"+GetScodeString(ctx, err), err)
+		}
+		updtResult := updtResultRaw.ToIDispatch()
+		r := &WUAInstallResult{}
+		if v, err := updtResult.GetProperty("ResultCode"); err == nil {
+			r.ResultCode, _ = v.Value().(int32)
+		}
+		if v, err := updtResult.GetProperty("HResult"); err == nil {
+			hr, _ := v.Value().(int32)
+			r.HResult = uint32(hr)
+		}
+		if v, err := updtResult.GetProperty("RebootRequired"); err == nil {
+			r.RebootRequired, _ = v.Value().(bool)
+		}
+		updtResult.Release()
+		results = append(results, r)
+	}
+	return results, nil
+}
+
 // GetWUAUpdateCollection queries the Windows Update Agent API searcher with the provided query
 // and returns a IUpdateCollection.
 func (s *IUpdateSession) GetWUAUpdateCollection(ctx context.Context, query string) (*IUpdateCollection, error) {
@@ -22,6 +22,7 @@ import (
 	"os/exec"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
@@ -33,6 +34,8 @@ var (
 	yum string
 
 	yumInstallArgs           = []string{"install", "--assumeyes"}
+	yumDownloadArgs          = []string{"install", "--assumeyes", "--downloadonly"}
+	yumCachedArgs            = []string{"install", "--assumeyes", "--cacheonly"}
 	yumRemoveArgs            = []string{"remove", "--assumeyes"}
 	yumCheckUpdateArgs       = []string{"check-update", "--assumeyes"}
 	yumListUpdatesArgs       = []string{"update", "--assumeno", "--cacheonly", "--color=never"}
@@ -76,8 +79,26 @@ func InstallYumPackages(ctx context.Context, pkgs []string) error {
 	return err
 }
 
-// RemoveYumPackages removes yum packages.
+// DownloadYumPackages downloads yum packages and their dependencies to the
+// yum cache without installing them, see InstallCachedYumPackages.
+func DownloadYumPackages(ctx context.Context, pkgs []string) error {
+	_, err := run(ctx, yum, append(append([]string{}, yumDownloadArgs...), pkgs...))
+	return err
+}
+
+// InstallCachedYumPackages installs yum packages from the yum cache, as
+// downloaded by DownloadYumPackages, without refreshing the metadata.
+func InstallCachedYumPackages(ctx context.Context, pkgs []string) error {
+	_, err := run(ctx, yum, append(append([]string{}, yumCachedArgs...), pkgs...))
+	return err
+}
+
+// RemoveYumPackages removes yum packages, protected packages are refused
+// with a *ProtectedPackageError.
 func RemoveYumPackages(ctx context.Context, pkgs []string) error {
+	if err := checkProtected("remove", pkgs); err != nil {
+		return err
+	}
 	_, err := run(ctx, yum, append(yumRemoveArgs, pkgs...))
 	return err
 }
@@ -131,11 +152,38 @@ func parseYumUpdates(data []byte) []*PkgInfo {
 			}
 			break
 		}
-		pkgs = append(pkgs, &PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(pkg[1])), Version: string(pkg[2])})
+		pkgs = append(pkgs, &PkgInfo{
+			Name:       string(pkg[0]),
+			Arch:       osinfo.Architecture(string(pkg[1])),
+			Version:    string(pkg[2]),
+			Epoch:      epochOf(string(pkg[2])),
+			Repository: string(pkg[3]),
+			Size:       parseYumSize(string(pkg[4]), string(pkg[5])),
+		})
 	}
 	return pkgs
 }
 
+// parseYumSize parses a yum package size like "18 k" or "1.2 M" to bytes,
+// returning 0 if it can't be parsed.
+func parseYumSize(size, unit string) int64 {
+	f, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "k":
+		f *= 1 << 10
+	case "M":
+		f *= 1 << 20
+	case "G":
+		f *= 1 << 30
+	default:
+		return 0
+	}
+	return int64(f)
+}
+
 func getYumTXFile(data []byte) string {
 	/* The last lines of a non-complete yum update where the transaction
 	   is saved look like:
@@ -159,7 +207,7 @@ func getYumTXFile(data []byte) string {
 func YumUpdates(ctx context.Context, opts ...YumUpdateOption) ([]*PkgInfo, error) {
 	// We just use check-update to ensure all repo keys are synced as we run
 	// update with --assumeno.
-	stdout, stderr, err := runner.Run(ctx, exec.CommandContext(ctx, yum, yumCheckUpdateArgs...))
+	stdout, stderr, err := runnerFor(ManagerYum).Run(ctx, commandContext(ctx, yum, yumCheckUpdateArgs...))
 	// Exit code 0 means no updates, 100 means there are updates.
 	if err == nil {
 		return nil, nil
@@ -172,7 +220,7 @@ func YumUpdates(ctx context.Context, opts ...YumUpdateOption) ([]*PkgInfo, error
 
 	// Since we don't get good error codes from 'yum update' exit now if there is an issue.
 	if err != nil {
-		return nil, fmt.Errorf("error running %s with args %q: %v, stdout: %q, stderr: %q", yum, yumCheckUpdateArgs, err, stdout, stderr)
+		return nil, newCmdError(yum, yumCheckUpdateArgs, stdout, stderr, err)
 	}
 
 	return listAndParseYumPackages(ctx, opts...)
@@ -196,9 +244,9 @@ func listAndParseYumPackages(ctx context.Context, opts ...YumUpdateOption) ([]*P
 		args = append(args, "--security")
 	}
 
-	stdout, stderr, err := ptyrunner.Run(ctx, exec.CommandContext(ctx, yum, args...))
+	stdout, stderr, err := ptyRunnerFor(ManagerYum).Run(ctx, commandContext(ctx, yum, args...))
 	if err != nil {
-		return nil, fmt.Errorf("error running %s with args %q: %v, stdout: %q, stderr: %q", yum, args, err, stdout, stderr)
+		return nil, newCmdError(yum, args, stdout, stderr, err)
 	}
 	if stdout == nil {
 		return nil, nil
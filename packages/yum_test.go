@@ -45,6 +45,23 @@ func TestInstallYumPackages(t *testing.T) {
 	}
 }
 
+func TestStagedYumPackages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+
+	download := mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(exec.Command(yum, append([]string{"install", "--assumeyes", "--downloadonly"}, pkgs...)...))).Return([]byte("stdout"), []byte("stderr"), nil).Times(1)
+	mockCommandRunner.EXPECT().Run(testCtx, utilmocks.EqCmd(exec.Command(yum, append([]string{"install", "--assumeyes", "--cacheonly"}, pkgs...)...))).After(download).Return([]byte("stdout"), []byte("stderr"), nil).Times(1)
+	if err := DownloadYumPackages(testCtx, pkgs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := InstallCachedYumPackages(testCtx, pkgs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestRemoveYum(t *testing.T) {
 	ctx := context.Background()
 	mockCtrl := gomock.NewController(t)
@@ -207,7 +224,7 @@ func TestParseYumUpdates(t *testing.T) {
 		data []byte
 		want []*PkgInfo
 	}{
-		{"NormalCase", data, []*PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "2.6.32-754.24.3.el6"}, {Name: "foo", Arch: "all", Version: "2.0.0-1"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0-1"}}},
+		{"NormalCase", data, []*PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "2.6.32-754.24.3.el6", Repository: "updates", Size: 32 << 20}, {Name: "foo", Arch: "all", Version: "2.0.0-1", Repository: "BaseOS", Size: 361 << 10}, {Name: "bar", Arch: "x86_64", Version: "2.0.0-1", Repository: "repo", Size: 10 << 20}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
 	}
@@ -237,7 +254,7 @@ func TestParseYumUpdatesWithInstallingDependenciesKeywords(t *testing.T) {
 		data []byte
 		want []*PkgInfo
 	}{
-		{"NormalCase", data, []*PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "2.6.32-754.24.3.el6"}, {Name: "foo", Arch: "all", Version: "2.0.0-1"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0-1"}}},
+		{"NormalCase", data, []*PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "2.6.32-754.24.3.el6", Repository: "updates", Size: 32 << 20}, {Name: "foo", Arch: "all", Version: "2.0.0-1", Repository: "BaseOS", Size: 361 << 10}, {Name: "bar", Arch: "x86_64", Version: "2.0.0-1", Repository: "repo", Size: 10 << 20}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
 	}
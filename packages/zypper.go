@@ -34,6 +34,8 @@ var (
 
 	// zypperInstallArgs is zypper command to install patches, packages
 	zypperInstallArgs     = []string{"--gpg-auto-import-keys", "--non-interactive", "install", "--auto-agree-with-licenses"}
+	zypperDownloadArgs    = []string{"--gpg-auto-import-keys", "--non-interactive", "install", "--auto-agree-with-licenses", "--download-only"}
+	zypperCachedArgs      = []string{"--non-interactive", "--no-refresh", "install", "--auto-agree-with-licenses"}
 	zypperRemoveArgs      = []string{"--non-interactive", "remove"}
 	zypperListUpdatesArgs = []string{"--gpg-auto-import-keys", "-q", "list-updates"}
 	zypperListPatchesArgs = []string{"--gpg-auto-import-keys", "-q", "list-patches"}
@@ -93,7 +95,24 @@ func InstallZypperPackages(ctx context.Context, pkgs []string) error {
 
 // ZypperInstall installs zypper patches and packages
 func ZypperInstall(ctx context.Context, patches []*ZypperPatch, pkgs []*PkgInfo) error {
-	args := zypperInstallArgs
+	return zypperInstall(ctx, zypperInstallArgs, patches, pkgs)
+}
+
+// ZypperDownload downloads zypper patches and packages to the zypper cache
+// without installing them, see ZypperInstallCached.
+func ZypperDownload(ctx context.Context, patches []*ZypperPatch, pkgs []*PkgInfo) error {
+	return zypperInstall(ctx, zypperDownloadArgs, patches, pkgs)
+}
+
+// ZypperInstallCached installs zypper patches and packages without
+// refreshing the repositories, using the packages downloaded by
+// ZypperDownload.
+func ZypperInstallCached(ctx context.Context, patches []*ZypperPatch, pkgs []*PkgInfo) error {
+	return zypperInstall(ctx, zypperCachedArgs, patches, pkgs)
+}
+
+func zypperInstall(ctx context.Context, installArgs []string, patches []*ZypperPatch, pkgs []*PkgInfo) error {
+	args := append([]string{}, installArgs...)
 
 	// https://www.mankier.com/8/zypper#Concepts-Package_Types use patch install
 	// for single patch and package installs
@@ -104,24 +123,26 @@ func ZypperInstall(ctx context.Context, patches []*ZypperPatch, pkgs []*PkgInfo)
 		args = append(args, "package:"+pkg.Name)
 	}
 
-	stdout, stderr, err := runner.Run(ctx, exec.CommandContext(ctx, zypper, args...))
+	stdout, stderr, err := runnerFor(ManagerZypper).Run(ctx, commandContext(ctx, zypper, args...))
 	// https://en.opensuse.org/SDB:Zypper_manual#EXIT_CODES
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			// ZYPPER_EXIT_INF_REBOOT_NEEDED
-			if exitErr.ExitCode() == 102 {
-				err = nil
-			}
-		} else {
-			err = fmt.Errorf("error running %s with args %q: %v, stdout: %q, stderr: %q", zypper, args, err, stdout, stderr)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// ZYPPER_EXIT_INF_REBOOT_NEEDED
+		if exitErr.ExitCode() == 102 {
+			return nil
 		}
 	}
-
-	return err
+	if err != nil {
+		return newCmdError(zypper, args, stdout, stderr, err)
+	}
+	return nil
 }
 
-// RemoveZypperPackages installed Zypper packages.
+// RemoveZypperPackages installed Zypper packages, protected packages are
+// refused with a *ProtectedPackageError.
 func RemoveZypperPackages(ctx context.Context, pkgs []string) error {
+	if err := checkProtected("remove", pkgs); err != nil {
+		return err
+	}
 	_, err := run(ctx, zypper, append(zypperRemoveArgs, pkgs...))
 	return err
 }
@@ -146,7 +167,8 @@ func parseZypperUpdates(data []byte) []*PkgInfo {
 		name := string(bytes.TrimSpace(pkg[2]))
 		arch := string(bytes.TrimSpace(pkg[5]))
 		ver := string(bytes.TrimSpace(pkg[4]))
-		pkgs = append(pkgs, &PkgInfo{Name: name, Arch: osinfo.Architecture(arch), Version: ver})
+		repo := string(bytes.TrimSpace(pkg[1]))
+		pkgs = append(pkgs, &PkgInfo{Name: name, Arch: osinfo.Architecture(arch), Version: ver, Epoch: epochOf(ver), Repository: repo})
 	}
 	return pkgs
 }
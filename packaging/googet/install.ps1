@@ -15,8 +15,10 @@
 $ErrorActionPreference = 'Stop'
 
 function Set-ServiceConfig {
-  # Restart service after 1s, then 2s. Reset error counter after 60s.
-  sc.exe failure google_osconfig_agent reset= 60 actions= restart/1000/restart/2000
+  # Restart service after 1s, then 2s, then every 5s. Reset error counter after 60s.
+  sc.exe failure google_osconfig_agent reset= 60 actions= restart/1000/restart/2000/restart/5000
+  # Also run the recovery actions when the service stops with a non-zero exit code.
+  sc.exe failureflag google_osconfig_agent 1
   # Set dependency and delayed start
   sc.exe config google_osconfig_agent depend= "rpcss" start= delayed-auto
   # Create trigger to start the service on first IP address
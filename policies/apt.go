@@ -20,12 +20,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/external"
 	"github.com/GoogleCloudPlatform/osconfig/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
 	"golang.org/x/crypto/openpgp"
@@ -54,8 +54,8 @@ func isArmoredGPGKey(keyData []byte) bool {
 	return false
 }
 
-func getAptGPGKey(key string) (openpgp.EntityList, error) {
-	resp, err := http.Get(key)
+func getAptGPGKey(ctx context.Context, key string) (openpgp.EntityList, error) {
+	resp, err := external.HTTPClient(ctx).Get(key)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +86,7 @@ func containsEntity(es []*openpgp.Entity, e *openpgp.Entity) bool {
 }
 
 func readInstanceOsInfo() (string, float64, error) {
-	oi, err := osinfo.Get()
+	oi, err := osinfo.Get(context.Background())
 	if err != nil {
 		return "", 0, fmt.Errorf("error getting osinfo: %v", err)
 	}
@@ -144,7 +144,7 @@ func aptRepositories(ctx context.Context, repos []*agentendpointpb.AptRepository
 
 	sort.Strings(keys)
 	for _, key := range keys {
-		entityList, err := getAptGPGKey(key)
+		entityList, err := getAptGPGKey(ctx, key)
 		if err != nil {
 			clog.Errorf(ctx, "Error fetching gpg key %q: %v", key, err)
 			continue
@@ -275,6 +275,7 @@ func aptChanges(ctx context.Context, aptInstalled, aptRemoved, aptUpdated []*age
 	}
 
 	if errs == nil {
+		changes.record(ctx)
 		return nil
 	}
 	return errors.New(strings.Join(errs, ",\n"))
@@ -85,7 +85,7 @@ func TestAptRepositories(t *testing.T) {
 func TestGetAptGPGKey(t *testing.T) {
 	key := "https://packages.cloud.google.com/apt/doc/apt-key.gpg"
 
-	entityList, err := getAptGPGKey(key)
+	entityList, err := getAptGPGKey(context.Background(), key)
 	if err != nil {
 		t.Fatal(err)
 	}
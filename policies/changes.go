@@ -15,7 +15,10 @@
 package policies
 
 import (
+	"context"
+
 	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
@@ -73,3 +76,19 @@ func getNecessaryChanges(installedPkgs []*packages.PkgInfo, upgradablePkgs []*pa
 		packagesToRemove:  pkgsToRemove,
 	}
 }
+
+// record adds the changes to the state journal once they were all made.
+func (c changes) record(ctx context.Context) {
+	for _, a := range []struct {
+		action string
+		pkgs   []string
+	}{
+		{"installed", c.packagesToInstall},
+		{"updated", c.packagesToUpgrade},
+		{"removed", c.packagesToRemove},
+	} {
+		for _, p := range a.pkgs {
+			statedb.Record(ctx, &statedb.Change{Kind: statedb.KindPackage, Name: p, Action: a.action, Origin: statedb.OriginGuestPolicies})
+		}
+	}
+}
@@ -15,14 +15,33 @@
 package policies
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
+func TestMain(m *testing.M) {
+	// Don't record the changes of the tests in the state journal of the agent.
+	dir, err := os.MkdirTemp("", "osconfig_state")
+	if err != nil {
+		fmt.Printf("Error creating state directory: %v", err)
+		os.Exit(1)
+	}
+	statedb.Default = statedb.New(filepath.Join(dir, "state.jsonl"), 0)
+
+	out := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(out)
+}
+
 func TestGetNecessaryChanges(t *testing.T) {
 	tests := [...]struct {
 		name           string
@@ -134,3 +153,30 @@ func createPackages(names ...string) []*agentendpointpb.Package {
 	}
 	return res
 }
+
+func TestChangesRecord(t *testing.T) {
+	db := statedb.New(filepath.Join(t.TempDir(), "state.jsonl"), 0)
+	defer func(old *statedb.DB) { statedb.Default = old }(statedb.Default)
+	statedb.Default = db
+
+	changes{
+		packagesToInstall: []string{"foo"},
+		packagesToUpgrade: []string{"bar"},
+		packagesToRemove:  []string{"baz"},
+	}.record(context.Background())
+
+	got, err := db.Query(statedb.Query{Kind: statedb.KindPackage})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var actions []string
+	for _, c := range got {
+		if c.Origin != statedb.OriginGuestPolicies {
+			t.Errorf("change %q has origin %q, want %q", c.Name, c.Origin, statedb.OriginGuestPolicies)
+		}
+		actions = append(actions, c.Name+" "+c.Action)
+	}
+	if want := []string{"baz removed", "bar updated", "foo installed"}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("recorded %q, want %q", actions, want)
+	}
+}
@@ -0,0 +1,205 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policies
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"github.com/GoogleCloudPlatform/osconfig/inventory"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+// PackageDrift is a guest policy package and how the inventory differs
+// from its desired state.
+type PackageDrift struct {
+	Name string `json:"name"`
+	// Manager and DesiredState are the names of the policy enum values, e.g.
+	// "APT" and "INSTALLED".
+	Manager      string `json:"manager"`
+	DesiredState string `json:"desiredState"`
+	// Reason says why the package is not in its desired state, empty for
+	// converged packages.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (d *PackageDrift) key() string {
+	return d.Name + "/" + d.Manager + "/" + d.DesiredState
+}
+
+// DriftReport is the result of comparing an inventory with the desired
+// package state of the guest policies.
+type DriftReport struct {
+	// Drifted are the packages not in their desired state.
+	Drifted []*PackageDrift `json:"drifted,omitempty"`
+	// ConvergedElsewhere are packages that drifted in the previous check and
+	// are now in their desired state without the policies having been
+	// applied in between, i.e. something else fixed them.
+	ConvergedElsewhere []*PackageDrift `json:"convergedElsewhere,omitempty"`
+}
+
+// Empty reports whether the report has nothing to signal.
+func (r *DriftReport) Empty() bool {
+	return len(r.Drifted) == 0 && len(r.ConvergedElsewhere) == 0
+}
+
+func (r *DriftReport) String() string {
+	names := func(ds []*PackageDrift) []string {
+		var s []string
+		for _, d := range ds {
+			s = append(s, d.Name)
+		}
+		return s
+	}
+	return fmt.Sprintf("%d packages drifted %q, %d converged elsewhere %q", len(r.Drifted), names(r.Drifted), len(r.ConvergedElsewhere), names(r.ConvergedElsewhere))
+}
+
+// installedByManager returns the installed packages the policy manager
+// applies to, ANY covers every manager.
+func installedByManager(pkgs *packages.Packages, m agentendpointpb.Package_Manager) []*packages.PkgInfo {
+	if pkgs == nil {
+		return nil
+	}
+	switch m {
+	case agentendpointpb.Package_APT:
+		return pkgs.Deb
+	case agentendpointpb.Package_YUM, agentendpointpb.Package_ZYPPER:
+		return pkgs.Rpm
+	case agentendpointpb.Package_GOO:
+		return pkgs.GooGet
+	}
+	var all []*packages.PkgInfo
+	all = append(all, pkgs.Deb...)
+	all = append(all, pkgs.Rpm...)
+	return append(all, pkgs.GooGet...)
+}
+
+func hasPackage(pkgs []*packages.PkgInfo, name string) bool {
+	for _, p := range pkgs {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDrift compares the installed packages and available updates of an
+// inventory with the desired state of the policy packages. It only looks at
+// the inventory, no package manager is run, so it is cheap enough to do
+// after every inventory. The report has no ConvergedElsewhere packages,
+// those need the previous check, see the PolicyDrift hook.
+func CheckDrift(desired []*agentendpointpb.Package, installed, updates *packages.Packages) *DriftReport {
+	report := &DriftReport{}
+	for _, pkg := range desired {
+		d := &PackageDrift{Name: pkg.GetName(), Manager: pkg.GetManager().String(), DesiredState: pkg.GetDesiredState().String()}
+		isInstalled := hasPackage(installedByManager(installed, pkg.GetManager()), pkg.GetName())
+		switch pkg.GetDesiredState() {
+		case agentendpointpb.DesiredState_INSTALLED, agentendpointpb.DesiredState_DESIRED_STATE_UNSPECIFIED:
+			if !isInstalled {
+				d.Reason = "not installed"
+			}
+		case agentendpointpb.DesiredState_REMOVED:
+			if isInstalled {
+				d.Reason = "installed"
+			}
+		case agentendpointpb.DesiredState_UPDATED:
+			switch {
+			case !isInstalled:
+				d.Reason = "not installed"
+			case hasPackage(installedByManager(updates, pkg.GetManager()), pkg.GetName()):
+				d.Reason = "update available"
+			}
+		}
+		if d.Reason != "" {
+			report.Drifted = append(report.Drifted, d)
+		}
+	}
+	sort.Slice(report.Drifted, func(i, j int) bool { return report.Drifted[i].key() < report.Drifted[j].key() })
+	return report
+}
+
+// driftChecker keeps the desired package state of the last policy run and
+// the drift of the last check for the PolicyDrift hook.
+type driftChecker struct {
+	mu      sync.Mutex
+	desired []*agentendpointpb.Package
+	// drifted is nil until the first check after a policy run.
+	drifted map[string]*PackageDrift
+}
+
+var (
+	drift         = &driftChecker{}
+	registerDrift sync.Once
+	paused        = agentconfig.Paused
+)
+
+// setDesired records the desired package state of a policy run, the
+// policies have just been applied so no earlier drift carries over.
+func (c *driftChecker) setDesired(desired []*agentendpointpb.Package) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.desired = desired
+	c.drifted = nil
+}
+
+func (c *driftChecker) check(installed, updates *packages.Packages) *DriftReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := CheckDrift(c.desired, installed, updates)
+	now := map[string]*PackageDrift{}
+	for _, d := range report.Drifted {
+		now[d.key()] = d
+	}
+	for k, d := range c.drifted {
+		if _, ok := now[k]; !ok {
+			report.ConvergedElsewhere = append(report.ConvergedElsewhere, &PackageDrift{Name: d.Name, Manager: d.Manager, DesiredState: d.DesiredState})
+		}
+	}
+	sort.Slice(report.ConvergedElsewhere, func(i, j int) bool {
+		return report.ConvergedElsewhere[i].key() < report.ConvergedElsewhere[j].key()
+	})
+	c.drifted = now
+	return report
+}
+
+// checkDriftHook is the AfterInventory hook comparing the reported
+// inventory with the desired state of the last policy run.
+func checkDriftHook(ctx context.Context, e *hooks.Event) error {
+	if paused(agentconfig.SubsystemDriftWatcher) {
+		clog.Debugf(ctx, "Skipping guest policy drift check: %s.", agentconfig.PauseMessage(agentconfig.SubsystemDriftWatcher))
+		return nil
+	}
+	state, ok := e.Data.(*inventory.InstanceInventory)
+	if !ok || state == nil {
+		return nil
+	}
+	report := drift.check(state.InstalledPackages, state.PackageUpdates)
+	if report.Empty() {
+		return nil
+	}
+	clog.InfoStructured(ctx, report, "Guest policy drift: %s.", report)
+	if err := hooks.Run(ctx, hooks.PolicyDrift, report); err != nil {
+		return fmt.Errorf("error running %s hooks: %v", hooks.PolicyDrift, strings.TrimSpace(err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policies
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
+	"github.com/GoogleCloudPlatform/osconfig/inventory"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestCheckDrift(t *testing.T) {
+	desired := []*agentendpointpb.Package{
+		{Name: "nginx", Manager: agentendpointpb.Package_APT, DesiredState: agentendpointpb.DesiredState_INSTALLED},
+		{Name: "telnet", DesiredState: agentendpointpb.DesiredState_REMOVED},
+		{Name: "openssl", Manager: agentendpointpb.Package_ANY, DesiredState: agentendpointpb.DesiredState_UPDATED},
+		{Name: "curl", Manager: agentendpointpb.Package_APT, DesiredState: agentendpointpb.DesiredState_UPDATED},
+		{Name: "vim", Manager: agentendpointpb.Package_YUM, DesiredState: agentendpointpb.DesiredState_INSTALLED},
+	}
+	installed := &packages.Packages{Deb: createPkgInfos("telnet", "openssl", "curl", "vim")}
+	updates := &packages.Packages{Deb: createPkgInfos("openssl")}
+
+	want := &DriftReport{Drifted: []*PackageDrift{
+		{Name: "nginx", Manager: "APT", DesiredState: "INSTALLED", Reason: "not installed"},
+		{Name: "openssl", Manager: "ANY", DesiredState: "UPDATED", Reason: "update available"},
+		{Name: "telnet", Manager: "MANAGER_UNSPECIFIED", DesiredState: "REMOVED", Reason: "installed"},
+		{Name: "vim", Manager: "YUM", DesiredState: "INSTALLED", Reason: "not installed"},
+	}}
+	if diff := cmp.Diff(want, CheckDrift(desired, installed, updates)); diff != "" {
+		t.Errorf("CheckDrift() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDriftHookConvergedElsewhere(t *testing.T) {
+	defer func(d *driftChecker) { drift = d }(drift)
+	drift = &driftChecker{}
+	drift.setDesired([]*agentendpointpb.Package{
+		{Name: "nginx", Manager: agentendpointpb.Package_APT},
+		{Name: "telnet", Manager: agentendpointpb.Package_APT, DesiredState: agentendpointpb.DesiredState_REMOVED},
+	})
+
+	var got []*DriftReport
+	hooks.Register(hooks.PolicyDrift, "test", 0, func(ctx context.Context, e *hooks.Event) error {
+		got = append(got, e.Data.(*DriftReport))
+		return nil
+	})
+	defer hooks.Unregister(hooks.PolicyDrift, "test")
+
+	for _, installed := range [][]string{{"telnet"}, {"nginx"}, {"nginx"}} {
+		e := &hooks.Event{Point: hooks.AfterInventory, Data: &inventory.InstanceInventory{InstalledPackages: &packages.Packages{Deb: createPkgInfos(installed...)}}}
+		if err := checkDriftHook(context.Background(), e); err != nil {
+			t.Fatalf("checkDriftHook: unexpected error: %v", err)
+		}
+	}
+
+	// The third inventory has no drift and nothing converged since the
+	// second, so the hook did not run for it.
+	want := []*DriftReport{
+		{Drifted: []*PackageDrift{
+			{Name: "nginx", Manager: "APT", DesiredState: "DESIRED_STATE_UNSPECIFIED", Reason: "not installed"},
+			{Name: "telnet", Manager: "APT", DesiredState: "REMOVED", Reason: "installed"},
+		}},
+		{ConvergedElsewhere: []*PackageDrift{
+			{Name: "nginx", Manager: "APT", DesiredState: "DESIRED_STATE_UNSPECIFIED"},
+			{Name: "telnet", Manager: "APT", DesiredState: "REMOVED"},
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PolicyDrift reports mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDriftHookPaused(t *testing.T) {
+	defer func(d *driftChecker) { drift = d }(drift)
+	drift = &driftChecker{}
+	drift.setDesired([]*agentendpointpb.Package{{Name: "nginx", Manager: agentendpointpb.Package_APT}})
+	defer func(f func(string) bool) { paused = f }(paused)
+	paused = func(s string) bool { return s == agentconfig.SubsystemDriftWatcher }
+
+	ran := false
+	hooks.Register(hooks.PolicyDrift, "test", 0, func(ctx context.Context, e *hooks.Event) error {
+		ran = true
+		return nil
+	})
+	defer hooks.Unregister(hooks.PolicyDrift, "test")
+
+	e := &hooks.Event{Point: hooks.AfterInventory, Data: &inventory.InstanceInventory{InstalledPackages: &packages.Packages{}}}
+	if err := checkDriftHook(context.Background(), e); err != nil {
+		t.Fatalf("checkDriftHook: unexpected error: %v", err)
+	}
+	if ran {
+		t.Error("PolicyDrift hook ran while the drift watcher was paused")
+	}
+}
@@ -77,7 +77,7 @@ func googetChanges(ctx context.Context, gooInstalled, gooRemoved, gooUpdated []*
 
 	if changes.packagesToUpgrade != nil {
 		clog.Infof(ctx, "Upgrading packages %s", changes.packagesToUpgrade)
-		if err := packages.InstallGooGetPackages(ctx, changes.packagesToUpgrade); err != nil {
+		if err := packages.UpdateGooGetPackages(ctx, changes.packagesToUpgrade); err != nil {
 			errs = append(errs, fmt.Sprintf("error upgrading googet packages: %v", err))
 		}
 	}
@@ -90,6 +90,7 @@ func googetChanges(ctx context.Context, gooInstalled, gooRemoved, gooUpdated []*
 	}
 
 	if errs == nil {
+		changes.record(ctx)
 		return nil
 	}
 	return errors.New(strings.Join(errs, ",\n"))
@@ -19,66 +19,126 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
+	"fmt"
 	"hash"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/agentendpoint"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/heartbeat"
+	"github.com/GoogleCloudPlatform/osconfig/hooks"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
 	"github.com/GoogleCloudPlatform/osconfig/policies/recipes"
 	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 	"github.com/GoogleCloudPlatform/osconfig/tasker"
 	"github.com/GoogleCloudPlatform/osconfig/util"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
-func run(ctx context.Context) {
+// run applies the effective guest policies, it returns an error if they
+// could not be looked up or applied. All errors are also logged.
+func run(ctx context.Context) error {
+	if agentconfig.Paused(agentconfig.SubsystemPolicy) {
+		clog.Infof(ctx, "Skipping GuestPolicies: %s.", agentconfig.PauseMessage(agentconfig.SubsystemPolicy))
+		heartbeat.RunFromContext(ctx).Skip(agentconfig.PauseMessage(agentconfig.SubsystemPolicy))
+		return fmt.Errorf("guest policies not applied: %s", agentconfig.PauseMessage(agentconfig.SubsystemPolicy))
+	}
+	var errs []string
 	var resp *agentendpointpb.EffectiveGuestPolicy
 
 	client, err := agentendpoint.NewBetaClient(ctx)
 	if err != nil {
 		clog.Errorf(ctx, "agentendpoint.NewBetaClient Error: %v", err)
+		errs = append(errs, fmt.Sprintf("error creating client: %v", err))
 	} else {
 		defer client.Close()
 		resp, err = client.LookupEffectiveGuestPolicies(ctx)
 		if err != nil {
 			clog.Errorf(ctx, "Error running LookupEffectiveGuestPolicies: %v", err)
+			errs = append(errs, fmt.Sprintf("error looking up guest policies: %v", err))
 		}
 	}
 
 	local, err := readLocalConfig(ctx)
 	if err != nil {
 		clog.Errorf(ctx, "Error reading local software config: %v", err)
+		errs = append(errs, fmt.Sprintf("error reading local software config: %v", err))
 	}
 
 	effective := mergeConfigs(local, resp)
+	var desired []*agentendpointpb.Package
+	for _, pkg := range effective.GetPackages() {
+		desired = append(desired, pkg.GetPackage())
+	}
+	drift.setDesired(desired)
+	heartbeat.RunFromContext(ctx).AddItems(len(effective.GetPackages()) + len(effective.GetPackageRepositories()) + len(effective.GetSoftwareRecipes()))
+
+	if err := setConfig(ctx, effective); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := installRecipes(ctx, effective); err != nil {
+		errs = append(errs, err.Error())
+	}
 
-	// We don't check the error from setConfig or installRecipes as all errors are already logged.
-	setConfig(ctx, effective)
-	installRecipes(ctx, effective)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
 }
 
 // Run looks up osconfigs and applies them using tasker.Enqueue.
 func Run(ctx context.Context) {
-	tasker.Enqueue(ctx, "Run GuestPolicies", func() { run(ctx) })
+	// Check the policy packages against every inventory, not only on policy
+	// runs.
+	registerDrift.Do(func() { hooks.Register(hooks.AfterInventory, "policy-drift", 0, checkDriftHook) })
+	// Errors are already logged by run.
+	r := heartbeat.FromContext(ctx).Track(heartbeat.Policies)
+	tasker.Enqueue(ctx, "Run GuestPolicies", func(ctx context.Context) {
+		r.Start()
+		r.Done(run(heartbeat.WithRun(ctx, r)))
+	})
+}
+
+// Converge looks up osconfigs and applies them using tasker.Enqueue like
+// Run, but waits for them to be applied and returns any errors.
+func Converge(ctx context.Context) error {
+	done := make(chan error, 1)
+	if err := tasker.Enqueue(ctx, "Converge GuestPolicies", func(ctx context.Context) { done <- run(ctx) }); err != nil {
+		return fmt.Errorf("error queueing guest policies: %v", err)
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func installRecipes(ctx context.Context, egp *agentendpointpb.EffectiveGuestPolicy) error {
+	var errs []string
 	for _, recipe := range egp.GetSoftwareRecipes() {
 		if r := recipe.GetSoftwareRecipe(); r != nil {
 			if err := recipes.InstallRecipe(ctx, r); err != nil {
 				clog.Errorf(ctx, "Error installing recipe: %v", err)
+				errs = append(errs, fmt.Sprintf("error installing recipe %q: %v", r.GetName(), err))
 			}
 		}
 	}
-	return nil
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
 }
 
-func setConfig(ctx context.Context, egp *agentendpointpb.EffectiveGuestPolicy) {
+func setConfig(ctx context.Context, egp *agentendpointpb.EffectiveGuestPolicy) error {
+	var errs []string
 	var aptRepos []*agentendpointpb.AptRepository
 	var yumRepos []*agentendpointpb.YumRepository
 	var zypperRepos []*agentendpointpb.ZypperRepository
@@ -169,46 +229,58 @@ func setConfig(ctx context.Context, egp *agentendpointpb.EffectiveGuestPolicy) {
 	if packages.GooGetExists {
 		if err := googetRepositories(ctx, gooRepos, agentconfig.GooGetRepoFilePath()); err != nil {
 			clog.Errorf(ctx, "Error writing googet repo file: %v", err)
+			errs = append(errs, fmt.Sprintf("error writing googet repo file: %v", err))
 		}
 		if err := retryutil.RetryFunc(ctx, 1*time.Minute, "Applying googet changes", func() error {
 			return googetChanges(ctx, gooInstallPkgs, gooRemovePkgs, gooUpdatePkgs)
 		}); err != nil {
 			clog.Errorf(ctx, "Error performing googet changes: %v", err)
+			errs = append(errs, fmt.Sprintf("error performing googet changes: %v", err))
 		}
 	}
 
 	if packages.AptExists {
 		if err := aptRepositories(ctx, aptRepos, agentconfig.AptRepoFilePath()); err != nil {
 			clog.Errorf(ctx, "Error writing apt repo file: %v", err)
+			errs = append(errs, fmt.Sprintf("error writing apt repo file: %v", err))
 		}
 		if err := retryutil.RetryFunc(ctx, 1*time.Minute, "Applying apt changes", func() error {
 			return aptChanges(ctx, aptInstallPkgs, aptRemovePkgs, aptUpdatePkgs)
 		}); err != nil {
 			clog.Errorf(ctx, "Error performing apt changes: %v", err)
+			errs = append(errs, fmt.Sprintf("error performing apt changes: %v", err))
 		}
 	}
 
 	if packages.YumExists {
 		if err := yumRepositories(ctx, yumRepos, agentconfig.YumRepoFilePath()); err != nil {
 			clog.Errorf(ctx, "Error writing yum repo file: %v", err)
+			errs = append(errs, fmt.Sprintf("error writing yum repo file: %v", err))
 		}
 		if err := retryutil.RetryFunc(ctx, 1*time.Minute, "Applying yum changes", func() error {
 			return yumChanges(ctx, yumInstallPkgs, yumRemovePkgs, yumUpdatePkgs)
 		}); err != nil {
 			clog.Errorf(ctx, "Error performing yum changes: %v", err)
+			errs = append(errs, fmt.Sprintf("error performing yum changes: %v", err))
 		}
 	}
 
 	if packages.ZypperExists {
 		if err := zypperRepositories(ctx, zypperRepos, agentconfig.ZypperRepoFilePath()); err != nil {
 			clog.Errorf(ctx, "Error writing zypper repo file: %v", err)
+			errs = append(errs, fmt.Sprintf("error writing zypper repo file: %v", err))
 		}
 		if err := retryutil.RetryFunc(ctx, 1*time.Minute, "Applying zypper changes.", func() error {
 			return zypperChanges(ctx, zypperInstallPkgs, zypperRemovePkgs, zypperUpdatePkgs)
 		}); err != nil {
 			clog.Errorf(ctx, "Error performing zypper changes: %v", err)
+			errs = append(errs, fmt.Sprintf("error performing zypper changes: %v", err))
 		}
 	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
 }
 
 func checksum(r io.Reader) hash.Hash {
@@ -233,5 +305,9 @@ func writeIfChanged(ctx context.Context, content []byte, path string) error {
 	}
 
 	clog.Infof(ctx, "Writing repo file %s with updated contents", path)
-	return util.AtomicWrite(path, content, 0644)
+	if err := util.AtomicWrite(path, content, 0644); err != nil {
+		return err
+	}
+	statedb.Record(ctx, &statedb.Change{Kind: statedb.KindRepository, Name: path, Action: "updated", Origin: statedb.OriginGuestPolicies})
+	return nil
 }
@@ -27,6 +27,7 @@ import (
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/external"
 	"github.com/GoogleCloudPlatform/osconfig/util"
+	"github.com/GoogleCloudPlatform/osconfig/util/fetcher"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
@@ -74,8 +75,16 @@ func fetchArtifact(ctx context.Context, artifact *agentendpointpb.SoftwareRecipe
 		}
 		extension = path.Ext(uri.Path)
 		checksum = remote.Checksum
-		cl := &http.Client{}
-		reader, err = getHTTPArtifact(ctx, cl, *uri)
+		if checksum != "" && isSupportedURL(*uri) {
+			// The fetcher resumes interrupted downloads and only puts the
+			// artifact in place once its checksum is verified.
+			localPath := getStoragePath(directory, artifact.Id, extension)
+			if err := fetcher.Fetch(ctx, uri.String(), localPath, checksum, fetcher.Mode(0600)); err != nil {
+				return "", fmt.Errorf("error fetching artifact %q: %v", artifact.Id, err)
+			}
+			return localPath, nil
+		}
+		reader, err = getHTTPArtifact(ctx, external.HTTPClient(ctx), *uri)
 		if err != nil {
 			return "", fmt.Errorf("error fetching artifact %q: %v", artifact.Id, err)
 		}
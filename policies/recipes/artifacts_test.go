@@ -16,9 +16,17 @@ package recipes
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
 func TestFetchArtifacts_http_InvalidURL(t *testing.T) {
@@ -45,3 +53,33 @@ func TestRecipesgetStoragePathWitouthExtension(t *testing.T) {
 		t.Errorf("Expected(%s); got(%s)", expect, localpath)
 	}
 }
+
+func TestFetchArtifactChecksum(t *testing.T) {
+	content := []byte("artifact content")
+	sum := sha256.Sum256(content)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(content) }))
+	defer ts.Close()
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	a := &agentendpointpb.SoftwareRecipe_Artifact{Id: "pkg", Artifact: &agentendpointpb.SoftwareRecipe_Artifact_Remote_{Remote: &agentendpointpb.SoftwareRecipe_Artifact_Remote{Uri: ts.URL + "/pkg.deb", Checksum: hex.EncodeToString(sum[:])}}}
+	path, err := fetchArtifact(ctx, a, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "pkg.deb"); path != want {
+		t.Errorf("fetchArtifact() = %q, want %q", path, want)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != string(content) {
+		t.Errorf("artifact content = %q, %v, want %q", got, err, content)
+	}
+
+	a.GetRemote().Checksum = strings.Repeat("0", 64)
+	a.Id = "bad"
+	if _, err := fetchArtifact(ctx, a, dir); err == nil {
+		t.Error("fetchArtifact() with a wrong checksum succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.deb")); !os.IsNotExist(err) {
+		t.Errorf("artifact with a wrong checksum was kept: %v", err)
+	}
+}
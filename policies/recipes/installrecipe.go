@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
@@ -116,6 +117,11 @@ func InstallRecipe(ctx context.Context, recipe *agentendpointpb.SoftwareRecipe)
 	}
 
 	clog.Infof(ctx, "All steps completed successfully, marking recipe %s as installed.", recipe.Name)
+	action := "installed"
+	if ok {
+		action = "updated"
+	}
+	statedb.Record(ctx, &statedb.Change{Kind: statedb.KindRecipe, Name: recipe.Name, Action: action, Version: recipe.Version, Origin: statedb.OriginGuestPolicies})
 	return recipeDB.addRecipe(recipe.Name, recipe.Version, true)
 }
 
@@ -29,7 +29,6 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"github.com/GoogleCloudPlatform/osconfig/packages"
@@ -114,7 +113,7 @@ func stepExtractArchive(ctx context.Context, step *agentendpointpb.SoftwareRecip
 		agentendpointpb.SoftwareRecipe_Step_ExtractArchive_TAR_LZMA,
 		agentendpointpb.SoftwareRecipe_Step_ExtractArchive_TAR_XZ,
 		agentendpointpb.SoftwareRecipe_Step_ExtractArchive_TAR:
-		return extractTar(ctx, filename, step.Destination, typ)
+		return extractTar(filename, step.Destination, typ)
 	default:
 		return fmt.Errorf("Unrecognized archive type %q", typ)
 	}
@@ -154,59 +153,7 @@ func extractZip(zipPath string, dst string) error {
 		return fmt.Errorf("file exists: %s", filen)
 	}
 
-	// Create files.
-	for _, f := range zr.File {
-		filen, err := util.NormPath(filepath.Join(dst, f.Name))
-		if err != nil {
-			return err
-		}
-		if zipIsDir(f.Name) {
-			mode := f.Mode()
-			if mode == 0 {
-				mode = 0755
-			}
-			if err := os.MkdirAll(filen, mode); err != nil {
-				return err
-			}
-			// Setting to correct permissions in case the directory has already been created
-			if err := os.Chmod(filen, mode); err != nil {
-				return err
-			}
-			continue
-		}
-		filedir := filepath.Dir(filen)
-		if err = os.MkdirAll(filedir, 0755); err != nil {
-			return err
-		}
-		reader, err := f.Open()
-		if err != nil {
-			return err
-		}
-
-		mode := f.Mode()
-		if mode == 0 {
-			mode = 0755
-		}
-
-		dst, err := os.OpenFile(filen, os.O_RDWR|os.O_CREATE, mode)
-		if err != nil {
-			return err
-		}
-		if _, err = io.Copy(dst, reader); err != nil {
-			dst.Close()
-			return err
-		}
-
-		reader.Close()
-		if err := dst.Close(); err != nil {
-			return err
-		}
-
-		if err := os.Chtimes(filen, time.Now(), f.ModTime()); err != nil {
-			return err
-		}
-	}
-	return nil
+	return util.ExtractArchive(zipPath, dst, &util.ExtractOptions{Format: util.ArchiveZip, AnyLinkTarget: true, FileMode: 0755})
 }
 
 func decompress(reader io.Reader, archiveType agentendpointpb.SoftwareRecipe_Step_ExtractArchive_ArchiveType) (io.Reader, error) {
@@ -256,7 +203,7 @@ func checkForConflicts(tr *tar.Reader, dst string) error {
 	return nil
 }
 
-func extractTar(ctx context.Context, tarName string, dst string, archiveType agentendpointpb.SoftwareRecipe_Step_ExtractArchive_ArchiveType) error {
+func extractTar(tarName string, dst string, archiveType agentendpointpb.SoftwareRecipe_Step_ExtractArchive_ArchiveType) error {
 	file, err := os.Open(tarName)
 	if err != nil {
 		return err
@@ -278,96 +225,7 @@ func extractTar(ctx context.Context, tarName string, dst string, archiveType age
 	if err != nil {
 		return err
 	}
-	tr = tar.NewReader(decompressed)
-
-	for {
-		var err error
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		filen, err := util.NormPath(filepath.Join(dst, header.Name))
-		if err != nil {
-			return err
-		}
-		filedir := filepath.Dir(filen)
-
-		if err := os.MkdirAll(filedir, 0700); err != nil {
-			return err
-		}
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(filen, os.FileMode(header.Mode)); err != nil {
-				return err
-			}
-			// Setting to correct permissions in case the directory has already been created
-			if err := os.Chmod(filen, os.FileMode(header.Mode)); err != nil {
-				return err
-			}
-			if err := chown(filen, header.Uid, header.Gid); err != nil {
-				return err
-			}
-		case tar.TypeReg, tar.TypeRegA:
-			dst, err := os.OpenFile(filen, os.O_RDWR|os.O_CREATE, os.FileMode(header.Mode))
-			if err != nil {
-				return err
-			}
-
-			if _, err := io.Copy(dst, tr); err != nil {
-				dst.Close()
-				return err
-			}
-			if err := dst.Close(); err != nil {
-				return err
-			}
-		case tar.TypeLink:
-			if err := os.Link(header.Linkname, filen); err != nil {
-				return err
-			}
-			continue
-		case tar.TypeSymlink:
-			if err := os.Symlink(header.Linkname, filen); err != nil {
-				return err
-			}
-			continue
-		case tar.TypeChar:
-			if err := mkCharDevice(filen, uint32(header.Devmajor), uint32(header.Devminor)); err != nil {
-				return err
-			}
-			if runtime.GOOS != "windows" {
-				if err := os.Chmod(filen, os.FileMode(header.Mode)); err != nil {
-					return err
-				}
-			}
-		case tar.TypeBlock:
-			if err := mkBlockDevice(filen, uint32(header.Devmajor), uint32(header.Devminor)); err != nil {
-				return err
-			}
-			if runtime.GOOS != "windows" {
-				if err := os.Chmod(filen, os.FileMode(header.Mode)); err != nil {
-					return err
-				}
-			}
-		case tar.TypeFifo:
-			if err := mkFifo(filen, uint32(header.Mode)); err != nil {
-				return err
-			}
-		default:
-			clog.Infof(ctx, "Unknown file type for tar entry %s\n", filen)
-			continue
-		}
-		if err := chown(filen, header.Uid, header.Gid); err != nil {
-			return err
-		}
-		if err := os.Chtimes(filen, header.AccessTime, header.ModTime); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return util.ExtractTar(decompressed, dst, &util.ExtractOptions{PreserveOwner: true, SpecialFiles: true, AnyLinkTarget: true})
 }
 
 func stepInstallMsi(ctx context.Context, step *agentendpointpb.SoftwareRecipe_Step_InstallMsi, artifacts map[string]string, runEnvs []string, stepDir string) error {
@@ -505,11 +363,3 @@ func executeCommand(ctx context.Context, cmd string, args []string, workDir stri
 	}
 	return err
 }
-
-func chown(file string, uid, gid int) error {
-	// os.Chown unsupported on windows
-	if runtime.GOOS == "windows" {
-		return nil
-	}
-	return os.Chown(file, uid, gid)
-}
@@ -0,0 +1,120 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package recipes
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func writeTar(t *testing.T, headers []*tar.Header) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, h := range headers {
+		h.Uid, h.Gid = os.Getuid(), os.Getgid()
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractTarSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	src := writeTar(t, []*tar.Header{
+		{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "/opt/app/releases/1"},
+		{Name: "etc/config", Typeflag: tar.TypeSymlink, Linkname: "../../shared/config"},
+	})
+	dst := t.TempDir()
+	if err := extractTar(src, dst, agentendpointpb.SoftwareRecipe_Step_ExtractArchive_TAR); err != nil {
+		t.Fatalf("extractTar: %v", err)
+	}
+	for name, want := range map[string]string{
+		"current":    "/opt/app/releases/1",
+		"etc/config": "../../shared/config",
+	} {
+		got, err := os.Readlink(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("Readlink(%q): %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q points to %q, want %q", name, got, want)
+		}
+	}
+
+	// Entries are still not written through a symlink.
+	outside := t.TempDir()
+	src = writeTar(t, []*tar.Header{
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside},
+		{Name: "link/file", Typeflag: tar.TypeReg, Mode: 0644},
+	})
+	if err := extractTar(src, t.TempDir(), agentendpointpb.SoftwareRecipe_Step_ExtractArchive_TAR); err == nil {
+		t.Error("extractTar: expected error writing through a symlink")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "file")); !os.IsNotExist(err) {
+		t.Errorf("entry was written through the symlink, Lstat: %v", err)
+	}
+}
+
+func TestExtractZipDefaultMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not kept on Windows")
+	}
+	src := filepath.Join(t.TempDir(), "archive.zip")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	// A unix entry without permission bits, as some archivers write them.
+	h := &zip.FileHeader{Name: "bin/tool", Method: zip.Deflate, CreatorVersion: 3 << 8}
+	if _, err := zw.CreateHeader(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dst := t.TempDir()
+	if err := extractZip(src, dst); err != nil {
+		t.Fatalf("extractZip: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "bin", "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0755 {
+		t.Errorf("mode = %v, want %v", got, os.FileMode(0755))
+	}
+}
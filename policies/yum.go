@@ -109,6 +109,7 @@ func yumChanges(ctx context.Context, yumInstalled, yumRemoved, yumUpdated []*age
 	}
 
 	if errs == nil {
+		changes.record(ctx)
 		return nil
 	}
 	return errors.New(strings.Join(errs, ",\n"))
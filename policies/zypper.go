@@ -109,6 +109,7 @@ func zypperChanges(ctx context.Context, zypperInstalled, zypperRemoved, zypperUp
 	}
 
 	if errs == nil {
+		changes.record(ctx)
 		return nil
 	}
 	return errors.New(strings.Join(errs, ",\n"))
@@ -0,0 +1,210 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+const (
+	// defaultExecTimeout is the timeout of each script of an Exec without
+	// one.
+	defaultExecTimeout = 10 * time.Minute
+	// maxExecOutput is how much of the end of the output of a run is kept
+	// in its result.
+	maxExecOutput = 64 * 1024
+)
+
+var (
+	goos       = runtime.GOOS
+	execRunner = util.CommandRunner(&util.DefaultRunner{})
+)
+
+// Script is a command, or an inline script run with an interpreter.
+type Script struct {
+	// Command is the executable and its arguments.
+	Command []string `yaml:"command"`
+	// Script is run with Interpreter, "sh" by default or "cmd" on Windows.
+	// Interpreter can also be "powershell" or the path of an executable
+	// taking the script file as its argument, like "/usr/bin/python3".
+	Script      string `yaml:"script"`
+	Interpreter string `yaml:"interpreter"`
+}
+
+// Exec runs a script only when its check reports that the host is not
+// compliant, for configuration not expressible as packages or files.
+type Exec struct {
+	ID string `yaml:"id"`
+	// Check exits with 0 if the host is compliant and 1 if it is not, any
+	// other exit code is an error.
+	Check *Script `yaml:"check"`
+	// Run makes the host compliant, it must exit with one of ExitCodes, 0
+	// by default.
+	Run       *Script `yaml:"run"`
+	ExitCodes []int   `yaml:"exit_codes"`
+	// Timeout limits each run of Check and Run, e.g. "5m", defaults to 10
+	// minutes.
+	Timeout string `yaml:"timeout"`
+}
+
+func (s *Script) validate(name string) []string {
+	switch {
+	case s == nil:
+		return []string{name + " is required"}
+	case (len(s.Command) == 0) == (s.Script == ""):
+		return []string{name + ": exactly one of command and script must be set"}
+	case s.Interpreter != "" && s.Script == "":
+		return []string{name + ": interpreter is only valid with script"}
+	case s.Interpreter == "powershell" && goos != "windows":
+		return []string{name + ": powershell can only be used on Windows"}
+	}
+	return nil
+}
+
+func (e *Exec) validate() []string {
+	var errs []string
+	if e.ID == "" {
+		errs = append(errs, "id is required")
+	}
+	errs = append(errs, e.Check.validate("check")...)
+	errs = append(errs, e.Run.validate("run")...)
+	if e.Timeout != "" {
+		if d, err := time.ParseDuration(e.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Sprintf("invalid timeout %q", e.Timeout))
+		}
+	}
+	return errs
+}
+
+func (e *Exec) timeout() time.Duration {
+	if d, err := time.ParseDuration(e.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultExecTimeout
+}
+
+// command returns the command running s, writing an inline script to dir.
+func (s *Script) command(ctx context.Context, dir string) (*exec.Cmd, error) {
+	if len(s.Command) > 0 {
+		return exec.CommandContext(ctx, s.Command[0], s.Command[1:]...), nil
+	}
+	// File extensions are important on Windows.
+	name := "script"
+	switch {
+	case s.Interpreter == "powershell":
+		name += ".ps1"
+	case s.Interpreter == "" && goos == "windows":
+		name += ".cmd"
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(s.Script), 0700); err != nil {
+		return nil, err
+	}
+	switch s.Interpreter {
+	case "":
+		if goos == "windows" {
+			return exec.CommandContext(ctx, "cmd.exe", "/c", path), nil
+		}
+		return exec.CommandContext(ctx, "/bin/sh", path), nil
+	case "powershell":
+		return exec.CommandContext(ctx, `C:\Windows\System32\WindowsPowerShell\v1.0\PowerShell.exe`, "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", path), nil
+	default:
+		return exec.CommandContext(ctx, s.Interpreter, path), nil
+	}
+}
+
+// run runs s with the timeout of e and returns its exit code and combined
+// output. The code is -1 if s did not start or was killed.
+func (e *Exec) run(ctx context.Context, s *Script) (int, string, error) {
+	dir, err := os.MkdirTemp("", "osconfig_policy_exec_")
+	if err != nil {
+		return -1, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout())
+	defer cancel()
+	cmd, err := s.command(ctx, dir)
+	if err != nil {
+		return -1, "", err
+	}
+	stdout, stderr, err := execRunner.Run(ctx, cmd)
+	out := string(stdout) + string(stderr)
+	if len(out) > maxExecOutput {
+		out = out[len(out)-maxExecOutput:]
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, out, fmt.Errorf("did not finish within %s", e.timeout())
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0, out, nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode(), out, nil
+	default:
+		return -1, out, err
+	}
+}
+
+// evaluate runs the check of e.
+func (e *Exec) evaluate(ctx context.Context) *Result {
+	res := &Result{ID: e.ID}
+	code, out, err := e.run(ctx, e.Check)
+	switch {
+	case err != nil:
+		res.Status, res.Message = StatusError, fmt.Sprintf("check failed: %v", err)
+	case code == 0:
+		res.Status, res.Message = StatusCompliant, "check passed"
+	case code == 1:
+		res.Status, res.Message = StatusNonCompliant, "check failed"
+	default:
+		res.Status, res.Message = StatusError, fmt.Sprintf("check exited with unexpected code %d", code)
+	}
+	if res.Status == StatusError {
+		res.Output = out
+	}
+	return res
+}
+
+// converge runs e and returns its output, the caller checks the host
+// again.
+func (e *Exec) converge(ctx context.Context) (string, error) {
+	clog.Infof(ctx, "Policy: running %s.", e.ID)
+	code, out, err := e.run(ctx, e.Run)
+	if err != nil {
+		return out, fmt.Errorf("run failed: %v", err)
+	}
+	codes := e.ExitCodes
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	for _, c := range codes {
+		if code == c {
+			return out, nil
+		}
+	}
+	return out, fmt.Errorf("run exited with code %d, want one of %v", code, codes)
+}
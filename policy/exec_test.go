@@ -0,0 +1,94 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConvergeExecs(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	doc := fmt.Sprintf(`
+execs:
+- id: create-marker
+  check:
+    command: [test, -e, %[1]s]
+  run:
+    script: echo creating; touch %[1]s
+- id: broken-check
+  check:
+    script: exit 3
+  run:
+    command: ["true"]
+- id: failing-run
+  check:
+    command: ["false"]
+  run:
+    script: echo oops >&2; exit 2
+  exit_codes: [0, 1]
+- id: slow-check
+  check:
+    command: [sleep, "5"]
+  run:
+    command: ["true"]
+  timeout: 50ms
+`, marker)
+	d, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	want := &Report{Results: []*Result{
+		{ID: "create-marker", Status: StatusCompliant, Message: "check passed", Changed: true, Changes: []string{"ran"}, Output: "creating\n"},
+		{ID: "broken-check", Status: StatusError, Message: "check exited with unexpected code 3"},
+		{ID: "failing-run", Status: StatusError, Message: "run exited with code 2, want one of [0 1]", Output: "oops\n"},
+		{ID: "slow-check", Status: StatusError, Message: "check failed: did not finish within 50ms"},
+	}}
+	if diff := cmp.Diff(want, Converge(ctx, d)); diff != "" {
+		t.Errorf("Converge() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The check now passes, so the script does not run again.
+	res := Converge(ctx, d).Results[0]
+	if res.Changed || res.Status != StatusCompliant {
+		t.Errorf("second Converge() = %+v, want compliant and unchanged", res)
+	}
+}
+
+func TestParseExecs(t *testing.T) {
+	tests := []struct {
+		name, data, wantErr string
+	}{
+		{"NoID", "execs:\n- check: {command: [\"true\"]}\n  run: {command: [\"true\"]}\n", "id is required"},
+		{"NoCheck", "execs:\n- id: a\n  run: {command: [\"true\"]}\n", "check is required"},
+		{"CommandAndScript", "execs:\n- id: a\n  check: {command: [\"true\"], script: \"true\"}\n  run: {command: [\"true\"]}\n", "check: exactly one of command and script"},
+		{"InterpreterWithCommand", "execs:\n- id: a\n  check: {command: [\"true\"]}\n  run: {command: [\"true\"], interpreter: /usr/bin/python3}\n", "run: interpreter is only valid with script"},
+		{"BadTimeout", "execs:\n- id: a\n  check: {command: [\"true\"]}\n  run: {command: [\"true\"]}\n  timeout: soon\n", `invalid timeout "soon"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/external"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Desired file states.
+const (
+	StatePresent State = "present"
+	StateAbsent  State = "absent"
+)
+
+// defaultFileMode is the mode of created files without a Mode.
+const defaultFileMode = 0644
+
+// File is the desired state of a file. Its content is given by one of
+// Content, Source or Template, a file without any only has its mode and
+// ownership managed.
+type File struct {
+	// ID identifies the resource in the results, defaults to "file:path".
+	ID   string `yaml:"id"`
+	Path string `yaml:"path"`
+	// State is present, the default, or absent.
+	State State `yaml:"state"`
+	// Content is the inline content of the file.
+	Content string `yaml:"content"`
+	// Source is the URL the content is downloaded from, SHA256 is its
+	// checksum.
+	Source string `yaml:"source"`
+	SHA256 string `yaml:"sha256"`
+	// Template is a text/template rendering the content, with the host name
+	// as .Hostname and Vars as .Vars.
+	Template string            `yaml:"template"`
+	Vars     map[string]string `yaml:"vars"`
+	// Mode is the octal permissions, e.g. "0640". Like Owner and Group it
+	// is not supported on Windows.
+	Mode string `yaml:"mode"`
+	// Owner and Group are names or numeric IDs.
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+}
+
+func (f *File) validate() []string {
+	var errs []string
+	if f.Path == "" || !filepath.IsAbs(f.Path) {
+		errs = append(errs, fmt.Sprintf("path %q is not absolute", f.Path))
+	}
+	var sources int
+	for _, s := range []string{f.Content, f.Source, f.Template} {
+		if s != "" {
+			sources++
+		}
+	}
+	switch f.State {
+	case StatePresent:
+	case StateAbsent:
+		if sources > 0 || f.Mode != "" || f.Owner != "" || f.Group != "" {
+			errs = append(errs, "absent files can't have content, mode or ownership")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("unknown state %q, want present or absent", f.State))
+	}
+	if sources > 1 {
+		errs = append(errs, "only one of content, source and template can be set")
+	}
+	if (f.Source == "") != (f.SHA256 == "") {
+		errs = append(errs, "source and sha256 must be set together")
+	}
+	if f.Template != "" {
+		if _, err := f.parseTemplate(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if f.Mode != "" {
+		if _, err := parseMode(f.Mode); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if (f.Mode != "" || f.Owner != "" || f.Group != "") && !permissionsSupported {
+		errs = append(errs, "file mode and ownership are not supported on this OS")
+	}
+	return errs
+}
+
+func parseMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid mode %q, want octal permissions like \"0644\"", s)
+	}
+	return os.FileMode(m), nil
+}
+
+func (f *File) parseTemplate() (*template.Template, error) {
+	t, err := template.New(f.Path).Option("missingkey=error").Parse(f.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return t, nil
+}
+
+func (f *File) managesContent() bool {
+	return f.Content != "" || f.Source != "" || f.Template != ""
+}
+
+// content returns the content of the file if it is inline or a template.
+func (f *File) content() ([]byte, error) {
+	if f.Template == "" {
+		return []byte(f.Content), nil
+	}
+	t, err := f.parseTemplate()
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, struct {
+		Hostname string
+		Vars     map[string]string
+	}{hostname, f.Vars}); err != nil {
+		return nil, fmt.Errorf("error rendering template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *File) mode() os.FileMode {
+	if m, err := parseMode(f.Mode); err == nil && f.Mode != "" {
+		return m
+	}
+	return defaultFileMode
+}
+
+// fileDrift is how a file differs from its desired state.
+type fileDrift struct {
+	missing, present, content, mode, owner bool
+	// wantUID and wantGID are -1 if they are not managed.
+	wantUID, wantGID int
+	msgs             []string
+}
+
+func (d *fileDrift) drifted() bool {
+	return d.missing || d.present || d.content || d.mode || d.owner
+}
+
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// check compares the file with its desired state, it does not download
+// Source, comparing its checksum instead.
+func (f *File) check() (*fileDrift, error) {
+	d := &fileDrift{wantUID: -1, wantGID: -1}
+	fi, err := os.Lstat(f.Path)
+	if os.IsNotExist(err) {
+		if f.State != StateAbsent {
+			d.missing = true
+			d.msgs = append(d.msgs, "does not exist")
+		}
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.State == StateAbsent {
+		d.present = true
+		d.msgs = append(d.msgs, "exists")
+		return d, nil
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", f.Path)
+	}
+
+	if f.managesContent() {
+		want := strings.ToLower(f.SHA256)
+		if want == "" {
+			content, err := f.content()
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(content)
+			want = hex.EncodeToString(sum[:])
+		}
+		got, err := sha256File(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			d.content = true
+			d.msgs = append(d.msgs, "content differs")
+		}
+	}
+	if f.Mode != "" && fi.Mode().Perm() != f.mode() {
+		d.mode = true
+		d.msgs = append(d.msgs, fmt.Sprintf("mode %04o, want %04o", fi.Mode().Perm(), f.mode()))
+	}
+	if f.Owner != "" || f.Group != "" {
+		if d.wantUID, d.wantGID, err = lookupOwner(f.Owner, f.Group); err != nil {
+			return nil, err
+		}
+		uid, gid := fileOwner(fi)
+		if d.wantUID >= 0 && uid != d.wantUID {
+			d.owner = true
+			d.msgs = append(d.msgs, fmt.Sprintf("owner %d, want %d", uid, d.wantUID))
+		}
+		if d.wantGID >= 0 && gid != d.wantGID {
+			d.owner = true
+			d.msgs = append(d.msgs, fmt.Sprintf("group %d, want %d", gid, d.wantGID))
+		}
+	}
+	return d, nil
+}
+
+// evaluate returns the compliance of the file.
+func (f *File) evaluate() *Result {
+	res := &Result{ID: f.ID}
+	d, err := f.check()
+	switch {
+	case err != nil:
+		res.Status, res.Message = StatusError, err.Error()
+	case d.drifted():
+		res.Status, res.Message = StatusNonCompliant, strings.Join(d.msgs, ", ")
+	case f.State == StateAbsent:
+		res.Status, res.Message = StatusCompliant, "does not exist"
+	default:
+		res.Status, res.Message = StatusCompliant, "up to date"
+	}
+	return res
+}
+
+// write writes the content of the file with its mode.
+func (f *File) write(ctx context.Context) error {
+	if f.Source != "" {
+		r, err := external.FetchRemoteObjectHTTP(ctx, external.HTTPClient(ctx), f.Source)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = util.AtomicWriteFileStream(r, strings.ToLower(f.SHA256), f.Path, f.mode())
+		return err
+	}
+	if !f.managesContent() {
+		return fmt.Errorf("%s does not exist and has no content to create it with", f.Path)
+	}
+	content, err := f.content()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(f.Path, content, f.mode())
+}
+
+// converge brings the file to its desired state and returns the changes
+// made.
+func (f *File) converge(ctx context.Context) ([]string, error) {
+	d, err := f.check()
+	if err != nil || !d.drifted() {
+		return nil, err
+	}
+	clog.Infof(ctx, "Policy: converging file %s: %s.", f.Path, strings.Join(d.msgs, ", "))
+	if d.present {
+		if err := os.Remove(f.Path); err != nil {
+			return nil, err
+		}
+		return []string{"removed"}, nil
+	}
+
+	var changes []string
+	if d.missing || d.content {
+		if err := f.write(ctx); err != nil {
+			return nil, err
+		}
+		changes = append(changes, "wrote content")
+		// Check the mode and ownership of the written file.
+		if d, err = f.check(); err != nil {
+			return changes, err
+		}
+	}
+	if d.mode {
+		if err := os.Chmod(f.Path, f.mode()); err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("set mode %04o", f.mode()))
+	}
+	if d.owner {
+		if err := os.Lchown(f.Path, d.wantUID, d.wantGID); err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("set owner %d:%d", d.wantUID, d.wantGID))
+	}
+	return changes, nil
+}
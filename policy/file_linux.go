@@ -0,0 +1,61 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+const permissionsSupported = true
+
+func fileOwner(fi os.FileInfo) (int, int) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	return int(st.Uid), int(st.Gid)
+}
+
+// lookupOwner resolves the owner and group names or IDs, an empty one is -1.
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		id := owner
+		if _, err := strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown owner %q: %v", owner, err)
+			}
+			id = u.Uid
+		}
+		uid, _ = strconv.Atoi(id)
+	}
+	if group != "" {
+		id := group
+		if _, err := strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown group %q: %v", group, err)
+			}
+			id = g.Gid
+		}
+		gid, _ = strconv.Atoi(id)
+	}
+	return uid, gid, nil
+}
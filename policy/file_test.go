@@ -0,0 +1,147 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConvergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	remote := []byte("remote content\n")
+	sum := sha256.Sum256(remote)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(remote) }))
+	defer ts.Close()
+
+	inline := filepath.Join(dir, "inline.conf")
+	templated := filepath.Join(dir, "conf.d", "templated.conf")
+	downloaded := filepath.Join(dir, "downloaded")
+	stale := filepath.Join(dir, "stale")
+	for path, content := range map[string]string{inline: "old\n", stale: "x"} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	doc := fmt.Sprintf(`
+files:
+- path: %s
+  content: "new\n"
+  mode: "0644"
+  owner: "%d"
+- path: %s
+  template: "port={{.Vars.port}}\n"
+  vars:
+    port: "8080"
+- path: %s
+  source: %s
+  sha256: %s
+- path: %s
+  state: absent
+`, inline, os.Getuid(), templated, downloaded, ts.URL, hex.EncodeToString(sum[:]), stale)
+	d, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	want := &Report{Results: []*Result{
+		{ID: "file:" + inline, Status: StatusNonCompliant, Message: "content differs, mode 0600, want 0644"},
+		{ID: "file:" + templated, Status: StatusNonCompliant, Message: "does not exist"},
+		{ID: "file:" + downloaded, Status: StatusNonCompliant, Message: "does not exist"},
+		{ID: "file:" + stale, Status: StatusNonCompliant, Message: "exists"},
+	}}
+	if diff := cmp.Diff(want, Evaluate(ctx, d)); diff != "" {
+		t.Errorf("Evaluate() mismatch (-want +got):\n%s", diff)
+	}
+
+	want = &Report{Results: []*Result{
+		{ID: "file:" + inline, Status: StatusCompliant, Message: "up to date", Changed: true, Changes: []string{"wrote content"}},
+		{ID: "file:" + templated, Status: StatusCompliant, Message: "up to date", Changed: true, Changes: []string{"wrote content"}},
+		{ID: "file:" + downloaded, Status: StatusCompliant, Message: "up to date", Changed: true, Changes: []string{"wrote content"}},
+		{ID: "file:" + stale, Status: StatusCompliant, Message: "does not exist", Changed: true, Changes: []string{"removed"}},
+	}}
+	if diff := cmp.Diff(want, Converge(ctx, d)); diff != "" {
+		t.Errorf("Converge() mismatch (-want +got):\n%s", diff)
+	}
+	for path, content := range map[string]string{inline: "new\n", templated: "port=8080\n", downloaded: string(remote)} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, want %q", path, got, err, content)
+		}
+	}
+
+	// Converging again changes nothing, until the file drifts.
+	for _, res := range Converge(ctx, d).Results {
+		if res.Changed {
+			t.Errorf("second Converge() changed %q: %q", res.ID, res.Changes)
+		}
+	}
+	if err := os.Chmod(inline, 0600); err != nil {
+		t.Fatal(err)
+	}
+	rep := Converge(ctx, d)
+	if diff := cmp.Diff([]string{"set mode 0644"}, rep.Results[0].Changes); diff != "" {
+		t.Errorf("Converge() after chmod changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestConvergeFileChecksumMismatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("tampered")) }))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "file")
+	d, err := Parse([]byte(fmt.Sprintf("files:\n- path: %s\n  source: %s\n  sha256: %064d\n", path, ts.URL, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := Converge(context.Background(), d).Results[0]
+	if res.Status != StatusError || res.Changed {
+		t.Errorf("Converge() = %+v, want an unchanged error", res)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file with a wrong checksum was written: %v", err)
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	tests := []struct {
+		name, data, wantErr string
+	}{
+		{"Relative", "files:\n- path: etc/motd\n  content: hi\n", "is not absolute"},
+		{"TwoSources", "files:\n- path: /etc/motd\n  content: hi\n  template: hi\n", "only one of content, source and template"},
+		{"NoChecksum", "files:\n- path: /etc/motd\n  source: https://example.com/motd\n", "source and sha256 must be set together"},
+		{"BadMode", "files:\n- path: /etc/motd\n  mode: \"0999\"\n", `invalid mode "0999"`},
+		{"BadTemplate", "files:\n- path: /etc/motd\n  template: \"{{.Vars\"\n", "invalid template"},
+		{"AbsentWithContent", "files:\n- path: /etc/motd\n  state: absent\n  content: hi\n", "absent files can't have content"},
+		{"Duplicate", "files:\n- path: /etc/motd\n- path: /etc/motd\n", `duplicate id "file:/etc/motd"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"errors"
+	"os"
+)
+
+// File permissions are not managed on Windows, which uses ACLs.
+const permissionsSupported = false
+
+func fileOwner(fi os.FileInfo) (int, int) {
+	return -1, -1
+}
+
+func lookupOwner(owner, group string) (int, int, error) {
+	return -1, -1, errors.New("file ownership is not supported on Windows")
+}
@@ -0,0 +1,141 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+)
+
+// actions returns what Converge does to a non-compliant package.
+func (r *Resource) actions() []string {
+	switch r.State {
+	case StateRemoved:
+		return []string{fmt.Sprintf("remove %s package %s", r.Manager, r.Name)}
+	case StatePinned:
+		return []string{fmt.Sprintf("install %s package %s version %s", r.Manager, r.Name, r.Version)}
+	}
+	return []string{fmt.Sprintf("install %s package %s", r.Manager, r.Name)}
+}
+
+// actions returns what converge does to the file.
+func (f *File) actions() ([]string, error) {
+	d, err := f.check()
+	if err != nil || !d.drifted() {
+		return nil, err
+	}
+	if d.present {
+		return []string{"remove " + f.Path}, nil
+	}
+	var actions []string
+	switch {
+	case (d.missing || d.content) && f.Source != "":
+		actions = append(actions, fmt.Sprintf("download %s to %s", f.Source, f.Path))
+	case d.missing:
+		actions = append(actions, "create "+f.Path)
+	case d.content:
+		actions = append(actions, "write the content of "+f.Path)
+	}
+	if d.mode {
+		actions = append(actions, fmt.Sprintf("set mode %04o", f.mode()))
+	}
+	if d.owner {
+		actions = append(actions, fmt.Sprintf("set owner %d:%d", d.wantUID, d.wantGID))
+	}
+	return actions, nil
+}
+
+// actions returns what converge does to the service.
+func (s *Service) actions(ctx context.Context) ([]string, error) {
+	st, err := queryService(ctx, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	var actions []string
+	w := s.want()
+	if w.Active != nil && *w.Active != st.Active {
+		if *w.Active {
+			actions = append(actions, "start "+s.Name)
+		} else {
+			actions = append(actions, "stop "+s.Name)
+		}
+	}
+	if w.Enabled != nil && *w.Enabled != st.Enabled {
+		if *w.Enabled {
+			actions = append(actions, "enable "+s.Name)
+		} else {
+			actions = append(actions, "disable "+s.Name)
+		}
+	}
+	return actions, nil
+}
+
+// actions returns what converge does for the exec.
+func (e *Exec) actions() []string {
+	if len(e.Run.Command) > 0 {
+		return []string{fmt.Sprintf("run %q", e.Run.Command)}
+	}
+	return []string{"run the script of " + e.ID}
+}
+
+// Plan returns the compliance of the host with d like Evaluate, with the
+// Actions Converge would take for each non-compliant resource, so a document
+// can be validated before it is rolled out. Like Evaluate it changes
+// nothing, only the checks of the execs are run.
+func Plan(ctx context.Context, d *Document) *Report {
+	rep := Evaluate(ctx, d)
+	results := rep.Results
+	next := func() *Result {
+		res := results[0]
+		results = results[1:]
+		if res.Status != StatusNonCompliant {
+			return nil
+		}
+		return res
+	}
+	// plan sets the actions of res, or its error if the resource could not
+	// be checked again.
+	plan := func(res *Result, actions []string, err error) {
+		if err != nil {
+			res.Status, res.Message = StatusError, err.Error()
+			return
+		}
+		res.Actions = actions
+	}
+
+	for _, r := range d.Resources {
+		if res := next(); res != nil {
+			res.Actions = r.actions()
+		}
+	}
+	for _, f := range d.Files {
+		if res := next(); res != nil {
+			actions, err := f.actions()
+			plan(res, actions, err)
+		}
+	}
+	for _, sv := range d.Services {
+		if res := next(); res != nil {
+			actions, err := sv.actions(ctx)
+			plan(res, actions, err)
+		}
+	}
+	for _, e := range d.Execs {
+		if res := next(); res != nil {
+			res.Actions = e.actions()
+		}
+	}
+	return rep
+}
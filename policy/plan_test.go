@@ -0,0 +1,85 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/services"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlan(t *testing.T) {
+	apt := &fakeManager{installed: map[string]string{"telnet": "0.17", "openssl": "1:3.0.9-1"}}
+	googet := &manager{exists: func() bool { return false }}
+	setManagers(t, map[string]*manager{"apt": apt.manager(), "googet": googet})
+	oldQuery := queryService
+	defer func() { queryService = oldQuery }()
+	queryService = func(_ context.Context, name string) (*services.Status, error) {
+		return &services.Status{Name: name, Enabled: true, State: "inactive"}, nil
+	}
+
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.conf")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Parse([]byte(testDocument + fmt.Sprintf(`
+files:
+- path: %s
+  content: new
+  mode: "0600"
+- path: %s
+  content: new
+services:
+- name: nginx.service
+  state: running
+  enabled: false
+`, stale, filepath.Join(dir, "missing.conf"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep := Plan(context.Background(), d)
+	var got [][]string
+	for _, res := range rep.Results {
+		got = append(got, res.Actions)
+	}
+	want := [][]string{
+		{"install apt package nginx"},
+		{"remove apt package telnet"},
+		{"install apt package openssl version 3.0.11-1"},
+		nil,
+		{"write the content of " + stale, "set mode 0600"},
+		{"create " + filepath.Join(dir, "missing.conf")},
+		{"start nginx.service", "disable nginx.service"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Plan() actions mismatch (-want +got):\n%s", diff)
+	}
+	if len(apt.calls) != 0 {
+		t.Errorf("Plan() changed packages: %q", apt.calls)
+	}
+	if data, err := os.ReadFile(stale); err != nil || string(data) != "old" {
+		t.Errorf("Plan() changed %s: %q, %v", stale, data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.conf")); !os.IsNotExist(err) {
+		t.Errorf("Plan() created missing.conf: %v", err)
+	}
+}
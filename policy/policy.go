@@ -0,0 +1,565 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package policy converges the packages of the host to a desired-state
+// document and reports the compliance of each of its resources.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
+	"gopkg.in/yaml.v3"
+)
+
+// State is the desired state of a package.
+type State string
+
+// Desired package states.
+const (
+	StateInstalled State = "installed"
+	StateRemoved   State = "removed"
+	// StatePinned is installed at exactly the version of the resource.
+	StatePinned State = "pinned"
+)
+
+// Status is the compliance of a resource.
+type Status string
+
+// Resource compliance.
+const (
+	StatusCompliant    Status = "compliant"
+	StatusNonCompliant Status = "non-compliant"
+	// StatusNotApplicable is the status of the resources of a package
+	// manager that is not on the host.
+	StatusNotApplicable Status = "not-applicable"
+	// StatusError is the status of the resources whose state could not be
+	// read or changed.
+	StatusError Status = "error"
+)
+
+// Resource is the desired state of one package of one package manager.
+type Resource struct {
+	// ID identifies the resource in the results, defaults to
+	// "manager:name".
+	ID string `yaml:"id"`
+	// Manager is "apt", "yum", "zypper" or "googet".
+	Manager string `yaml:"manager"`
+	Name    string `yaml:"name"`
+	// State defaults to installed.
+	State State `yaml:"state"`
+	// Version is the version of pinned packages, e.g. "2.4.57-2" or with
+	// its epoch "1:2.4.57-2".
+	Version string `yaml:"version"`
+}
+
+// Document is a desired-state document:
+//
+//	resources:
+//	- manager: apt
+//	  name: nginx
+//	- manager: apt
+//	  name: telnet
+//	  state: removed
+//	- id: pinned-openssl
+//	  manager: yum
+//	  name: openssl
+//	  state: pinned
+//	  version: 1:3.0.7-25.el9
+//	files:
+//	- path: /etc/nginx/conf.d/status.conf
+//	  template: "server { listen {{.Vars.port}}; server_name {{.Hostname}}; }"
+//	  vars:
+//	    port: "8080"
+//	  mode: "0640"
+//	  owner: root
+//	  group: www-data
+//	services:
+//	- name: nginx.service
+//	  state: running
+//	  enabled: true
+//	execs:
+//	- id: sysctl-forwarding
+//	  check:
+//	    script: test "$(sysctl -n net.ipv4.ip_forward)" = 1
+//	  run:
+//	    command: [sysctl, -w, net.ipv4.ip_forward=1]
+//
+// Files are converged after the packages, so they can configure them, then
+// the services and execs last.
+type Document struct {
+	Resources []*Resource `yaml:"resources"`
+	Files     []*File     `yaml:"files"`
+	Services  []*Service  `yaml:"services"`
+	Execs     []*Exec     `yaml:"execs"`
+}
+
+// manager is the package manager primitives the resources are converged
+// with.
+type manager struct {
+	exists    func() bool
+	installed func(context.Context) ([]*packages.PkgInfo, error)
+	install   func(context.Context, []string) error
+	remove    func(context.Context, []string) error
+	// pin returns the install argument of version of name, it is nil if the
+	// manager can't install a given version.
+	pin func(name, version string) string
+}
+
+var managers = map[string]*manager{
+	"apt": {
+		exists:    func() bool { return packages.AptExists },
+		installed: packages.InstalledDebPackages,
+		install:   packages.InstallAptPackages,
+		remove:    packages.RemoveAptPackages,
+		pin:       func(name, version string) string { return name + "=" + version },
+	},
+	"yum": {
+		exists:    func() bool { return packages.YumExists },
+		installed: packages.InstalledRPMPackages,
+		install:   packages.InstallYumPackages,
+		remove:    packages.RemoveYumPackages,
+		pin:       func(name, version string) string { return name + "-" + version },
+	},
+	"zypper": {
+		exists:    func() bool { return packages.ZypperExists },
+		installed: packages.InstalledRPMPackages,
+		install:   packages.InstallZypperPackages,
+		remove:    packages.RemoveZypperPackages,
+		pin:       func(name, version string) string { return name + "=" + version },
+	},
+	"googet": {
+		exists:    func() bool { return packages.GooGetExists },
+		installed: packages.InstalledGooGetPackages,
+		install:   packages.InstallGooGetPackages,
+		remove:    packages.RemoveGooGetPackages,
+	},
+}
+
+func (d *Document) validate() error {
+	var errs []string
+	ids := map[string]bool{}
+	pkgs := map[string]bool{}
+	for i, r := range d.Resources {
+		if r.State == "" {
+			r.State = StateInstalled
+		}
+		if r.ID == "" {
+			r.ID = r.Manager + ":" + r.Name
+		}
+		prefix := fmt.Sprintf("resources[%d]", i)
+		m, ok := managers[r.Manager]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%s: unknown manager %q", prefix, r.Manager))
+		case r.Name == "" || strings.ContainsAny(r.Name, " \t="):
+			errs = append(errs, fmt.Sprintf("%s: invalid package name %q", prefix, r.Name))
+		case ids[r.ID]:
+			errs = append(errs, fmt.Sprintf("%s: duplicate id %q", prefix, r.ID))
+		case pkgs[r.Manager+":"+r.Name]:
+			errs = append(errs, fmt.Sprintf("%s: %s package %q is already in the document", prefix, r.Manager, r.Name))
+		}
+		ids[r.ID] = true
+		pkgs[r.Manager+":"+r.Name] = true
+
+		switch r.State {
+		case StateInstalled, StateRemoved:
+			if r.Version != "" {
+				errs = append(errs, fmt.Sprintf("%s: version is only valid for pinned packages", prefix))
+			}
+		case StatePinned:
+			if r.Version == "" {
+				errs = append(errs, fmt.Sprintf("%s: pinned packages need a version", prefix))
+			}
+			if ok && m.pin == nil {
+				errs = append(errs, fmt.Sprintf("%s: %s packages can't be pinned", prefix, r.Manager))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("%s: unknown state %q, want installed, removed or pinned", prefix, r.State))
+		}
+	}
+	for i, f := range d.Files {
+		if f.State == "" {
+			f.State = StatePresent
+		}
+		if f.ID == "" {
+			f.ID = "file:" + f.Path
+		}
+		prefix := fmt.Sprintf("files[%d]", i)
+		if ids[f.ID] {
+			errs = append(errs, fmt.Sprintf("%s: duplicate id %q", prefix, f.ID))
+		}
+		ids[f.ID] = true
+		for _, err := range f.validate() {
+			errs = append(errs, fmt.Sprintf("%s: %s", prefix, err))
+		}
+	}
+	for i, sv := range d.Services {
+		if sv.ID == "" {
+			sv.ID = "service:" + sv.Name
+		}
+		prefix := fmt.Sprintf("services[%d]", i)
+		if ids[sv.ID] {
+			errs = append(errs, fmt.Sprintf("%s: duplicate id %q", prefix, sv.ID))
+		}
+		ids[sv.ID] = true
+		for _, err := range sv.validate() {
+			errs = append(errs, fmt.Sprintf("%s: %s", prefix, err))
+		}
+	}
+	for i, e := range d.Execs {
+		prefix := fmt.Sprintf("execs[%d]", i)
+		if e.ID != "" && ids[e.ID] {
+			errs = append(errs, fmt.Sprintf("%s: duplicate id %q", prefix, e.ID))
+		}
+		ids[e.ID] = true
+		for _, err := range e.validate() {
+			errs = append(errs, fmt.Sprintf("%s: %s", prefix, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+// Parse parses and validates a desired-state document, YAML or JSON.
+func Parse(data []byte) (*Document, error) {
+	var d Document
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&d); err != nil {
+		return nil, fmt.Errorf("error parsing desired-state document: %v", err)
+	}
+	if err := d.validate(); err != nil {
+		return nil, fmt.Errorf("invalid desired-state document: %v", err)
+	}
+	return &d, nil
+}
+
+// ReadFile reads and parses the desired-state document at path.
+func ReadFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Result is the compliance of a resource.
+type Result struct {
+	ID      string `json:"id"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Changed is set if Converge changed the resource, Changes describes
+	// what it did.
+	Changed bool     `json:"changed,omitempty"`
+	Changes []string `json:"changes,omitempty"`
+	// Actions are the changes Converge would make, they are only set by
+	// Plan.
+	Actions []string `json:"actions,omitempty"`
+	// Output is the output of an exec that ran, or whose check failed.
+	Output string `json:"output,omitempty"`
+}
+
+// Report is the compliance of every resource of a document, in document
+// order.
+type Report struct {
+	Results []*Result `json:"results"`
+}
+
+// Compliant reports whether no resource is non-compliant or in error.
+func (r *Report) Compliant() bool {
+	for _, res := range r.Results {
+		if res.Status == StatusNonCompliant || res.Status == StatusError {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the report as a table for the command line.
+func (r *Report) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tSTATUS\tCHANGES\tMESSAGE")
+	for _, res := range r.Results {
+		changes := "-"
+		if len(res.Changes) > 0 {
+			changes = strings.Join(res.Changes, ", ")
+		} else if len(res.Actions) > 0 {
+			changes = "would " + strings.Join(res.Actions, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.ID, res.Status, changes, strings.ReplaceAll(res.Message, "\n", " "))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// hostState is the installed versions of the packages of each package
+// manager of a document.
+type hostState struct {
+	versions map[string]map[string][]string
+	errs     map[string]error
+}
+
+// readState lists the installed packages of each package manager used by
+// d once.
+func readState(ctx context.Context, d *Document) *hostState {
+	s := &hostState{versions: map[string]map[string][]string{}, errs: map[string]error{}}
+	for _, r := range d.Resources {
+		m := managers[r.Manager]
+		if _, ok := s.versions[r.Manager]; ok || s.errs[r.Manager] != nil || !m.exists() {
+			continue
+		}
+		pkgs, err := m.installed(ctx)
+		if err != nil {
+			s.errs[r.Manager] = err
+			continue
+		}
+		versions := map[string][]string{}
+		for _, p := range pkgs {
+			versions[p.Name] = append(versions[p.Name], p.Version)
+		}
+		s.versions[r.Manager] = versions
+	}
+	return s
+}
+
+// versionMatches reports whether the installed version is the pinned one,
+// which may leave out the epoch.
+func versionMatches(installed, pinned string) bool {
+	if installed == pinned {
+		return true
+	}
+	i := strings.Index(installed, ":")
+	return i > 0 && installed[i+1:] == pinned
+}
+
+// evaluate returns the compliance of r with the host in s.
+func (s *hostState) evaluate(r *Resource) *Result {
+	res := &Result{ID: r.ID}
+	if err := s.errs[r.Manager]; err != nil {
+		res.Status, res.Message = StatusError, fmt.Sprintf("error listing %s packages: %v", r.Manager, err)
+		return res
+	}
+	versions, ok := s.versions[r.Manager]
+	if !ok {
+		res.Status, res.Message = StatusNotApplicable, fmt.Sprintf("%s is not available", r.Manager)
+		return res
+	}
+
+	installed := versions[r.Name]
+	res.Status = StatusNonCompliant
+	switch {
+	case r.State == StateRemoved && len(installed) == 0:
+		res.Status, res.Message = StatusCompliant, "not installed"
+	case r.State == StateRemoved:
+		res.Message = fmt.Sprintf("installed version %s", strings.Join(installed, ", "))
+	case len(installed) == 0:
+		res.Message = "not installed"
+	case r.State == StateInstalled:
+		res.Status, res.Message = StatusCompliant, fmt.Sprintf("installed version %s", strings.Join(installed, ", "))
+	default:
+		res.Message = fmt.Sprintf("installed version %s, want %s", strings.Join(installed, ", "), r.Version)
+		for _, v := range installed {
+			if versionMatches(v, r.Version) {
+				res.Status, res.Message = StatusCompliant, fmt.Sprintf("installed version %s", v)
+			}
+		}
+	}
+	return res
+}
+
+func (s *hostState) report(ctx context.Context, d *Document) *Report {
+	rep := &Report{}
+	for _, r := range d.Resources {
+		rep.Results = append(rep.Results, s.evaluate(r))
+	}
+	for _, f := range d.Files {
+		rep.Results = append(rep.Results, f.evaluate())
+	}
+	for _, sv := range d.Services {
+		rep.Results = append(rep.Results, sv.evaluate(ctx))
+	}
+	for _, e := range d.Execs {
+		rep.Results = append(rep.Results, e.evaluate(ctx))
+	}
+	return rep
+}
+
+// Evaluate returns the compliance of the host with d without changing
+// anything, files that drifted from their desired state are non-compliant.
+// The checks of the execs are run, they should not change the host either.
+func Evaluate(ctx context.Context, d *Document) *Report {
+	return readState(ctx, d).report(ctx, d)
+}
+
+// Converge removes and installs the packages of the non-compliant resources
+// of d, in one batch per package manager, then corrects the files that
+// drifted, starts or stops the services and runs the execs whose check
+// failed. It returns the compliance of the host afterwards with the changes
+// made. It changes nothing if the host is already compliant so it can be
+// run repeatedly.
+func Converge(ctx context.Context, d *Document) *Report {
+	rep := Evaluate(ctx, d)
+
+	// change is a package to install or remove and its description in the
+	// report.
+	type change struct {
+		id, arg, desc string
+	}
+	type batch struct {
+		install, remove []change
+	}
+	batches := map[string]*batch{}
+	for i, r := range d.Resources {
+		if rep.Results[i].Status != StatusNonCompliant {
+			continue
+		}
+		b, ok := batches[r.Manager]
+		if !ok {
+			b = &batch{}
+			batches[r.Manager] = b
+		}
+		switch r.State {
+		case StateRemoved:
+			b.remove = append(b.remove, change{r.ID, r.Name, "removed"})
+		case StatePinned:
+			b.install = append(b.install, change{r.ID, managers[r.Manager].pin(r.Name, r.Version), "installed version " + r.Version})
+		default:
+			b.install = append(b.install, change{r.ID, r.Name, "installed"})
+		}
+	}
+
+	changes := map[string][]string{}
+	failed := map[string]error{}
+	apply := func(cs []change, op string, f func(context.Context, []string) error) {
+		if len(cs) == 0 {
+			return
+		}
+		var pkgs []string
+		for _, c := range cs {
+			pkgs = append(pkgs, c.arg)
+		}
+		clog.Infof(ctx, "Policy: %s packages %q.", op, pkgs)
+		err := f(ctx, pkgs)
+		for _, c := range cs {
+			if err != nil {
+				failed[c.id] = err
+			} else {
+				changes[c.id] = append(changes[c.id], c.desc)
+			}
+		}
+	}
+	var names []string
+	for name := range batches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b, m := batches[name], managers[name]
+		// Remove first so that a package replacing a removed one can be
+		// installed.
+		apply(b.remove, "removing", m.remove)
+		apply(b.install, "installing", m.install)
+	}
+
+	for i, f := range d.Files {
+		if rep.Results[len(d.Resources)+i].Status != StatusNonCompliant {
+			continue
+		}
+		cs, err := f.converge(ctx)
+		changes[f.ID] = cs
+		if err != nil {
+			failed[f.ID] = err
+		}
+	}
+
+	for i, sv := range d.Services {
+		if rep.Results[len(d.Resources)+len(d.Files)+i].Status != StatusNonCompliant {
+			continue
+		}
+		cs, err := sv.converge(ctx)
+		changes[sv.ID] = cs
+		if err != nil {
+			failed[sv.ID] = err
+		}
+	}
+
+	outputs := map[string]string{}
+	for i, e := range d.Execs {
+		if rep.Results[len(d.Resources)+len(d.Files)+len(d.Services)+i].Status != StatusNonCompliant {
+			continue
+		}
+		out, err := e.converge(ctx)
+		outputs[e.ID] = out
+		if err != nil {
+			failed[e.ID] = err
+		} else {
+			changes[e.ID] = []string{"ran"}
+		}
+	}
+
+	if len(changes) == 0 && len(failed) == 0 {
+		return rep
+	}
+	rep = Evaluate(ctx, d)
+	for _, res := range rep.Results {
+		res.Changes = changes[res.ID]
+		res.Changed = len(res.Changes) > 0
+		if out, ok := outputs[res.ID]; ok {
+			res.Output = out
+		}
+		if err := failed[res.ID]; err != nil && res.Status != StatusCompliant {
+			res.Status, res.Message = StatusError, err.Error()
+		}
+	}
+	return rep
+}
+
+// Record adds the changes Converge made to the resources of d, as reported
+// in rep, to the state journal with origin, e.g. the path of d.
+func Record(ctx context.Context, d *Document, rep *Report, origin string) {
+	changes := map[string]*statedb.Change{}
+	for _, r := range d.Resources {
+		changes[r.ID] = &statedb.Change{Kind: statedb.KindPackage, Name: r.Name, Version: r.Version}
+	}
+	for _, f := range d.Files {
+		changes[f.ID] = &statedb.Change{Kind: statedb.KindFile, Name: f.Path}
+	}
+	for _, sv := range d.Services {
+		changes[sv.ID] = &statedb.Change{Kind: statedb.KindService, Name: sv.Name}
+	}
+	for _, e := range d.Execs {
+		changes[e.ID] = &statedb.Change{Kind: statedb.KindExec, Name: e.ID}
+	}
+	for _, res := range rep.Results {
+		c, ok := changes[res.ID]
+		if !ok || !res.Changed {
+			continue
+		}
+		c.Action, c.Origin = strings.Join(res.Changes, ", "), origin
+		statedb.Record(ctx, c)
+	}
+}
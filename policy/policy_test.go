@@ -0,0 +1,231 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/GoogleCloudPlatform/osconfig/statedb"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeManager keeps the installed versions by package name and records the
+// calls made.
+type fakeManager struct {
+	installed map[string]string
+	calls     []string
+	err       error
+}
+
+func (f *fakeManager) manager() *manager {
+	return &manager{
+		exists: func() bool { return true },
+		installed: func(context.Context) ([]*packages.PkgInfo, error) {
+			var pkgs []*packages.PkgInfo
+			for name, version := range f.installed {
+				pkgs = append(pkgs, &packages.PkgInfo{Name: name, Version: version})
+			}
+			return pkgs, nil
+		},
+		install: func(_ context.Context, pkgs []string) error {
+			f.calls = append(f.calls, "install "+strings.Join(pkgs, " "))
+			if f.err != nil {
+				return f.err
+			}
+			for _, p := range pkgs {
+				name, version, ok := strings.Cut(p, "=")
+				if !ok {
+					version = "1.0"
+				}
+				f.installed[name] = version
+			}
+			return nil
+		},
+		remove: func(_ context.Context, pkgs []string) error {
+			f.calls = append(f.calls, "remove "+strings.Join(pkgs, " "))
+			for _, p := range pkgs {
+				delete(f.installed, p)
+			}
+			return nil
+		},
+		pin: func(name, version string) string { return name + "=" + version },
+	}
+}
+
+func setManagers(t *testing.T, m map[string]*manager) {
+	old := managers
+	t.Cleanup(func() { managers = old })
+	managers = m
+}
+
+const testDocument = `
+resources:
+- manager: apt
+  name: nginx
+- manager: apt
+  name: telnet
+  state: removed
+- id: pinned-openssl
+  manager: apt
+  name: openssl
+  state: pinned
+  version: 3.0.11-1
+- manager: googet
+  name: foo
+`
+
+func TestConverge(t *testing.T) {
+	apt := &fakeManager{installed: map[string]string{"telnet": "0.17", "openssl": "1:3.0.9-1"}}
+	googet := &manager{exists: func() bool { return false }}
+	setManagers(t, map[string]*manager{"apt": apt.manager(), "googet": googet})
+
+	d, err := Parse([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	rep := Evaluate(ctx, d)
+	want := &Report{Results: []*Result{
+		{ID: "apt:nginx", Status: StatusNonCompliant, Message: "not installed"},
+		{ID: "apt:telnet", Status: StatusNonCompliant, Message: "installed version 0.17"},
+		{ID: "pinned-openssl", Status: StatusNonCompliant, Message: "installed version 1:3.0.9-1, want 3.0.11-1"},
+		{ID: "googet:foo", Status: StatusNotApplicable, Message: "googet is not available"},
+	}}
+	if diff := cmp.Diff(want, rep); diff != "" {
+		t.Errorf("Evaluate() mismatch (-want +got):\n%s", diff)
+	}
+	if len(apt.calls) != 0 {
+		t.Errorf("Evaluate() changed packages: %q", apt.calls)
+	}
+
+	rep = Converge(ctx, d)
+	want = &Report{Results: []*Result{
+		{ID: "apt:nginx", Status: StatusCompliant, Message: "installed version 1.0", Changed: true, Changes: []string{"installed"}},
+		{ID: "apt:telnet", Status: StatusCompliant, Message: "not installed", Changed: true, Changes: []string{"removed"}},
+		{ID: "pinned-openssl", Status: StatusCompliant, Message: "installed version 3.0.11-1", Changed: true, Changes: []string{"installed version 3.0.11-1"}},
+		{ID: "googet:foo", Status: StatusNotApplicable, Message: "googet is not available"},
+	}}
+	if diff := cmp.Diff(want, rep); diff != "" {
+		t.Errorf("Converge() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"remove telnet", "install nginx openssl=3.0.11-1"}, apt.calls); diff != "" {
+		t.Errorf("Converge() calls mismatch (-want +got):\n%s", diff)
+	}
+	if !rep.Compliant() {
+		t.Errorf("Converge() report is not compliant:\n%s", rep)
+	}
+
+	// Converging again changes nothing.
+	apt.calls = nil
+	rep = Converge(ctx, d)
+	if len(apt.calls) != 0 {
+		t.Errorf("second Converge() changed packages: %q", apt.calls)
+	}
+	for _, res := range rep.Results {
+		if res.Changed {
+			t.Errorf("second Converge() reported %q as changed", res.ID)
+		}
+	}
+}
+
+func TestConvergeError(t *testing.T) {
+	apt := &fakeManager{installed: map[string]string{}, err: errors.New("no space left")}
+	setManagers(t, map[string]*manager{"apt": apt.manager()})
+
+	d, err := Parse([]byte("resources:\n- manager: apt\n  name: nginx\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := Converge(context.Background(), d)
+	want := &Report{Results: []*Result{{ID: "apt:nginx", Status: StatusError, Message: "no space left"}}}
+	if diff := cmp.Diff(want, rep); diff != "" {
+		t.Errorf("Converge() mismatch (-want +got):\n%s", diff)
+	}
+	if rep.Compliant() {
+		t.Error("Compliant() = true for a failed resource")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	db := statedb.New(filepath.Join(t.TempDir(), "state.jsonl"), 0)
+	old := statedb.Default
+	t.Cleanup(func() { statedb.Default = old })
+	statedb.Default = db
+
+	d, err := Parse([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := &Report{Results: []*Result{
+		{ID: "apt:nginx", Status: StatusCompliant, Changed: true, Changes: []string{"installed"}},
+		{ID: "apt:telnet", Status: StatusCompliant},
+		{ID: "pinned-openssl", Status: StatusCompliant, Changed: true, Changes: []string{"installed version 3.0.11-1"}},
+	}}
+	Record(context.Background(), d, rep, "/etc/policy.yaml")
+
+	got, err := db.Query(statedb.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range got {
+		c.Seq, c.Time = 0, time.Time{}
+	}
+	want := []*statedb.Change{
+		{Kind: statedb.KindPackage, Name: "openssl", Action: "installed version 3.0.11-1", Version: "3.0.11-1", Origin: "/etc/policy.yaml"},
+		{Kind: statedb.KindPackage, Name: "nginx", Action: "installed", Origin: "/etc/policy.yaml"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("recorded changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"UnknownField", "resources:\n- manager: apt\n  package: nginx\n", "field package not found"},
+		{"UnknownManager", "resources:\n- manager: brew\n  name: nginx\n", `unknown manager "brew"`},
+		{"NoName", "resources:\n- manager: apt\n", `invalid package name ""`},
+		{"Duplicate", "resources:\n- manager: apt\n  name: nginx\n- manager: apt\n  name: nginx\n  state: removed\n", `duplicate id "apt:nginx"`},
+		{"UnknownState", "resources:\n- manager: apt\n  name: nginx\n  state: latest\n", `unknown state "latest"`},
+		{"PinnedWithoutVersion", "resources:\n- manager: apt\n  name: nginx\n  state: pinned\n", "pinned packages need a version"},
+		{"VersionNotPinned", "resources:\n- manager: apt\n  name: nginx\n  version: \"1\"\n", "version is only valid for pinned packages"},
+		{"GooGetPinned", "resources:\n- manager: googet\n  name: foo\n  state: pinned\n  version: \"1\"\n", "googet packages can't be pinned"},
+		{"JSON", `{"resources": [{"manager": "yum", "name": "httpd", "state": "removed"}]}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/services"
+)
+
+// Desired service states.
+const (
+	StateRunning State = "running"
+	StateStopped State = "stopped"
+)
+
+var (
+	queryService  = services.Query
+	ensureService = services.Ensure
+)
+
+// Service is the desired state of a systemd unit or Windows service.
+type Service struct {
+	// ID identifies the resource in the results, defaults to "service:name".
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// State is running or stopped, it is not managed if empty.
+	State State `yaml:"state"`
+	// Enabled starts the service at boot, it is not managed if unset.
+	Enabled *bool `yaml:"enabled"`
+}
+
+func (s *Service) validate() []string {
+	var errs []string
+	if s.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	switch s.State {
+	case "", StateRunning, StateStopped:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown state %q, want running or stopped", s.State))
+	}
+	if s.State == "" && s.Enabled == nil {
+		errs = append(errs, "one of state and enabled must be set")
+	}
+	return errs
+}
+
+func (s *Service) want() services.Want {
+	w := services.Want{Enabled: s.Enabled}
+	if s.State != "" {
+		active := s.State == StateRunning
+		w.Active = &active
+	}
+	return w
+}
+
+// evaluate returns the compliance of the service.
+func (s *Service) evaluate(ctx context.Context) *Result {
+	res := &Result{ID: s.ID}
+	st, err := queryService(ctx, s.Name)
+	if err != nil {
+		res.Status, res.Message = StatusError, err.Error()
+		return res
+	}
+	if diffs := s.want().Diff(st); len(diffs) > 0 {
+		res.Status, res.Message = StatusNonCompliant, strings.Join(diffs, ", ")
+		return res
+	}
+	res.Status, res.Message = StatusCompliant, fmt.Sprintf("service is %s", st.State)
+	return res
+}
+
+// converge starts or stops and enables or disables the service as needed
+// and returns the changes made.
+func (s *Service) converge(ctx context.Context) ([]string, error) {
+	return ensureService(ctx, s.Name, s.want())
+}
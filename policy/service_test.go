@@ -0,0 +1,102 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/services"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConvergeServices(t *testing.T) {
+	units := map[string]*services.Status{
+		"nginx.service":  {Name: "nginx.service", State: "inactive"},
+		"telnet.service": {Name: "telnet.service", Active: true, Enabled: true, State: "active"},
+	}
+	oldQuery, oldEnsure := queryService, ensureService
+	defer func() { queryService, ensureService = oldQuery, oldEnsure }()
+	queryService = func(_ context.Context, name string) (*services.Status, error) {
+		s, ok := units[name]
+		if !ok {
+			return nil, services.ErrNotFound
+		}
+		cp := *s
+		return &cp, nil
+	}
+	ensureService = func(_ context.Context, name string, want services.Want) ([]string, error) {
+		s := units[name]
+		var changes []string
+		if want.Enabled != nil && *want.Enabled != s.Enabled {
+			s.Enabled = *want.Enabled
+			changes = append(changes, "enabled")
+		}
+		if want.Active != nil && *want.Active != s.Active {
+			s.Active = *want.Active
+			s.State = map[bool]string{true: "active", false: "inactive"}[s.Active]
+			changes = append(changes, "started")
+		}
+		return changes, nil
+	}
+
+	d, err := Parse([]byte(`
+services:
+- name: nginx.service
+  state: running
+  enabled: true
+- name: telnet.service
+  enabled: true
+- name: missing.service
+  state: stopped
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	want := &Report{Results: []*Result{
+		{ID: "service:nginx.service", Status: StatusNonCompliant, Message: "service is inactive, service is not enabled"},
+		{ID: "service:telnet.service", Status: StatusCompliant, Message: "service is active"},
+		{ID: "service:missing.service", Status: StatusError, Message: "service not found"},
+	}}
+	if diff := cmp.Diff(want, Evaluate(ctx, d)); diff != "" {
+		t.Errorf("Evaluate() mismatch (-want +got):\n%s", diff)
+	}
+
+	rep := Converge(ctx, d)
+	want.Results[0] = &Result{ID: "service:nginx.service", Status: StatusCompliant, Message: "service is active", Changed: true, Changes: []string{"enabled", "started"}}
+	if diff := cmp.Diff(want, rep); diff != "" {
+		t.Errorf("Converge() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	tests := []struct {
+		name, data, wantErr string
+	}{
+		{"NoName", "services:\n- state: running\n", "name is required"},
+		{"BadState", "services:\n- name: a\n  state: restarted\n", `unknown state "restarted"`},
+		{"Unmanaged", "services:\n- name: a\n", "one of state and enabled must be set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
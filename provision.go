@@ -0,0 +1,146 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/policies"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Exit codes of the provision action, 1 is used for usage and startup
+// errors like for every other action.
+const (
+	provisionExitFailed  = 3
+	provisionExitTimeout = 4
+)
+
+const defaultProvisionDeadline = 30 * time.Minute
+
+var (
+	// converge applies the guest policies once, replaced in tests.
+	converge            = policies.Converge
+	provisionPaused     = agentconfig.Paused
+	provisionMarkerFile = agentconfig.ProvisionMarkerFile
+)
+
+// provisionResult is written to agentconfig.ProvisionMarkerFile once the
+// provision action completes so instance bootstrap can check the outcome.
+type provisionResult struct {
+	// Status is "converged", "failed" or "timeout".
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+func (r *provisionResult) exitCode() int {
+	switch r.Status {
+	case "converged":
+		return 0
+	case "timeout":
+		return provisionExitTimeout
+	default:
+		return provisionExitFailed
+	}
+}
+
+func writeProvisionResult(r *provisionResult) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := provisionMarkerFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return util.AtomicWrite(path, data, 0644)
+}
+
+// provision blocks until the guest policies are applied, retrying failed
+// attempts until the deadline, writes the result marker and returns the exit
+// code. It is meant to be run from cloud-init or other instance bootstrap
+// scripts that depend on the instance being configured.
+func provision(ctx context.Context, deadline string) int {
+	d := defaultProvisionDeadline
+	if deadline != "" {
+		var err error
+		if d, err = time.ParseDuration(deadline); err != nil {
+			logger.Fatalf("Invalid provision deadline %q: %v", deadline, err)
+		}
+	}
+
+	// Don't leave the result of an earlier run behind for bootstrap scripts
+	// to find while this one is in progress.
+	if err := os.Remove(provisionMarkerFile()); err != nil && !os.IsNotExist(err) {
+		clog.Errorf(ctx, "Error removing provision marker file: %v", err)
+	}
+
+	res := &provisionResult{StartTime: time.Now()}
+	clog.Infof(ctx, "Provisioning, waiting up to %s for guest policies to be applied.", d)
+	if provisionPaused(agentconfig.SubsystemPolicy) {
+		// Retrying can't succeed until the policy subsystem is resumed.
+		res.Status = "failed"
+		res.Errors = []string{agentconfig.PauseMessage(agentconfig.SubsystemPolicy)}
+	} else {
+		dctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		for res.Status == "" {
+			res.Attempts++
+			err := converge(dctx)
+			if err == nil {
+				res.Status = "converged"
+				res.Errors = nil
+				break
+			}
+			res.Errors = strings.Split(err.Error(), "\n")
+			if dctx.Err() != nil {
+				// The deadline hit in the middle of an attempt.
+				res.Status = "timeout"
+				break
+			}
+
+			ns := retryutil.RetrySleep(res.Attempts, 0)
+			clog.Errorf(ctx, "Provisioning attempt %d failed, retrying in %s: %v", res.Attempts, ns, err)
+			select {
+			case <-time.After(ns):
+			case <-dctx.Done():
+				res.Status = "failed"
+			}
+		}
+	}
+	res.EndTime = time.Now()
+
+	if err := writeProvisionResult(res); err != nil {
+		clog.Errorf(ctx, "Error writing provision marker file: %v", err)
+	}
+	if res.Status == "converged" {
+		clog.Infof(ctx, "Provisioning completed after %d attempts.", res.Attempts)
+	} else {
+		clog.Errorf(ctx, "Provisioning %s after %d attempts: %q", res.Status, res.Attempts, res.Errors)
+	}
+	return res.exitCode()
+}
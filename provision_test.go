@@ -0,0 +1,115 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fakeProvision(t *testing.T, isPaused bool, f func(context.Context) error) string {
+	oldConverge, oldPaused, oldMarker := converge, provisionPaused, provisionMarkerFile
+	t.Cleanup(func() { converge, provisionPaused, provisionMarkerFile = oldConverge, oldPaused, oldMarker })
+	marker := filepath.Join(t.TempDir(), "provisioned.json")
+	converge = f
+	provisionPaused = func(string) bool { return isPaused }
+	provisionMarkerFile = func() string { return marker }
+	return marker
+}
+
+func readProvisionResult(t *testing.T, marker string) *provisionResult {
+	t.Helper()
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		t.Fatalf("error reading provision marker: %v", err)
+	}
+	res := &provisionResult{}
+	if err := json.Unmarshal(data, res); err != nil {
+		t.Fatalf("error parsing provision marker: %v", err)
+	}
+	return res
+}
+
+func TestProvision(t *testing.T) {
+	tests := []struct {
+		name         string
+		paused       bool
+		converge     func(context.Context) error
+		wantCode     int
+		wantStatus   string
+		wantAttempts int
+		wantErrors   int
+	}{
+		{
+			name:         "Converged",
+			converge:     func(context.Context) error { return nil },
+			wantStatus:   "converged",
+			wantAttempts: 1,
+		},
+		{
+			name:       "Paused",
+			paused:     true,
+			converge:   func(context.Context) error { t.Error("converge called while paused"); return nil },
+			wantCode:   provisionExitFailed,
+			wantStatus: "failed",
+			wantErrors: 1,
+		},
+		{
+			// The deadline passes while waiting to retry a failed attempt.
+			name:         "Failed",
+			converge:     func(context.Context) error { return errors.New("error installing recipe\nerror installing package") },
+			wantCode:     provisionExitFailed,
+			wantStatus:   "failed",
+			wantAttempts: 1,
+			wantErrors:   2,
+		},
+		{
+			// The deadline passes in the middle of an attempt.
+			name: "Timeout",
+			converge: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			wantCode:     provisionExitTimeout,
+			wantStatus:   "timeout",
+			wantAttempts: 1,
+			wantErrors:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marker := fakeProvision(t, tt.paused, tt.converge)
+			// A marker of an earlier run is replaced.
+			if err := os.WriteFile(marker, []byte(`{"status":"converged"}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if code := provision(context.Background(), "100ms"); code != tt.wantCode {
+				t.Errorf("provision() = %d, want %d", code, tt.wantCode)
+			}
+			res := readProvisionResult(t, marker)
+			if res.Status != tt.wantStatus || res.Attempts != tt.wantAttempts || len(res.Errors) != tt.wantErrors {
+				t.Errorf("provision result = %+v, want status %q after %d attempts with %d errors", res, tt.wantStatus, tt.wantAttempts, tt.wantErrors)
+			}
+			if res.EndTime.Before(res.StartTime) {
+				t.Errorf("provision result ends at %s before its start at %s", res.EndTime, res.StartTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package repos
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+)
+
+var (
+	aptSourcesDir = "/etc/apt/sources.list.d"
+	aptKeyringDir = "/etc/apt/keyrings"
+)
+
+// AptRepository is an apt source, written to
+// /etc/apt/sources.list.d/<Name>.list with its key in
+// /etc/apt/keyrings/<Name>.gpg.
+type AptRepository struct {
+	Name string
+	// ArchiveType is "deb" or "deb-src", defaults to "deb".
+	ArchiveType  string
+	URI          string
+	Distribution string
+	Components   []string
+	// GPGKey is the URL of the key the repository is signed with, only that
+	// key is trusted for the repository through signed-by.
+	GPGKey string
+	// Fingerprints, if set, are the fingerprints the key must have.
+	Fingerprints []string
+}
+
+func (r *AptRepository) validate() error {
+	if err := checkName("apt repository name", r.Name); err != nil {
+		return err
+	}
+	if r.ArchiveType != "" && r.ArchiveType != "deb" && r.ArchiveType != "deb-src" {
+		return fmt.Errorf("invalid archive type %q, want deb or deb-src", r.ArchiveType)
+	}
+	if r.URI == "" || r.Distribution == "" {
+		return fmt.Errorf("apt repository %q needs a URI and a distribution", r.Name)
+	}
+	return nil
+}
+
+func (r *AptRepository) listPath() string {
+	return filepath.Join(aptSourcesDir, r.Name+".list")
+}
+
+func (r *AptRepository) keyringPath() string {
+	return filepath.Join(aptKeyringDir, r.Name+".gpg")
+}
+
+func (r *AptRepository) contents() []byte {
+	/*
+		# Repo file managed by Google OSConfig agent
+		deb [signed-by=/etc/apt/keyrings/repo.gpg] http://repo-url/ dist main
+	*/
+	archiveType := r.ArchiveType
+	if archiveType == "" {
+		archiveType = "deb"
+	}
+	fields := []string{archiveType}
+	if r.GPGKey != "" {
+		fields = append(fields, fmt.Sprintf("[signed-by=%s]", r.keyringPath()))
+	}
+	fields = append(fields, agentconfig.MirrorURL(r.URI), r.Distribution)
+	fields = append(fields, r.Components...)
+	return []byte("# Repo file managed by Google OSConfig agent\n" + strings.Join(fields, " ") + "\n")
+}
+
+func (r *AptRepository) writeKeyring(ctx context.Context) (bool, error) {
+	keys, err := fetchKeys(ctx, []string{r.GPGKey}, r.Fingerprints)
+	if err != nil {
+		return false, err
+	}
+	keyring, err := serializeKeys(keys)
+	if err != nil {
+		return false, err
+	}
+	return writeIfChanged(ctx, r.keyringPath(), keyring)
+}
+
+// SetAptRepository creates or updates the apt repository r, fetching and
+// validating its key first. It reports whether any file changed.
+func SetAptRepository(ctx context.Context, r *AptRepository) (bool, error) {
+	if err := r.validate(); err != nil {
+		return false, err
+	}
+	var changed bool
+	var err error
+	if r.GPGKey == "" {
+		// The key of an earlier definition is no longer trusted.
+		changed, err = removeFiles(ctx, r.keyringPath())
+	} else {
+		// Write the key before the source referencing it.
+		changed, err = r.writeKeyring(ctx)
+	}
+	if err != nil {
+		return changed, err
+	}
+	written, err := writeIfChanged(ctx, r.listPath(), r.contents())
+	return changed || written, err
+}
+
+// RemoveAptRepository removes the apt repository name and its key. It
+// reports whether anything was removed.
+func RemoveAptRepository(ctx context.Context, name string) (bool, error) {
+	if err := checkName("apt repository name", name); err != nil {
+		return false, err
+	}
+	r := &AptRepository{Name: name}
+	return removeFiles(ctx, r.listPath(), r.keyringPath())
+}
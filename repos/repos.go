@@ -0,0 +1,198 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package repos declaratively creates, updates and removes the repository
+// definitions of apt, yum and zypper, together with the GPG keys they are
+// signed with.
+package repos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/external"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// maxKeySize is the largest GPG key that is fetched.
+const maxKeySize = 1024 * 1024
+
+// validName matches names that are safe to use in file names and repo
+// file sections.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func checkName(kind, name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid %s %q, it may only contain letters, digits, '.', '_' and '-'", kind, name)
+	}
+	return nil
+}
+
+// writeIfChanged writes content to path with util.AtomicWrite unless the
+// file already has it, it reports whether the file was written.
+func writeIfChanged(ctx context.Context, path string, content []byte) (bool, error) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, content) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	clog.Infof(ctx, "Writing repository file %s.", path)
+	if err := util.AtomicWrite(path, content, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeFiles removes paths, ignoring the ones that don't exist, it reports
+// whether any was removed.
+func removeFiles(ctx context.Context, paths ...string) (bool, error) {
+	var removed bool
+	var errs []string
+	for _, p := range paths {
+		err := os.Remove(p)
+		switch {
+		case err == nil:
+			clog.Infof(ctx, "Removed repository file %s.", p)
+			removed = true
+		case !os.IsNotExist(err):
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return removed, nil
+	}
+	return removed, errors.New(strings.Join(errs, "\n"))
+}
+
+// fetchKey fetches the armored or binary GPG key at url, the HTTP client
+// already redirects it to a configured mirror.
+func fetchKey(ctx context.Context, url string) (openpgp.EntityList, error) {
+	resp, err := external.HTTPClient(ctx).Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("error fetching gpg key %q: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading gpg key %q: %v", url, err)
+	}
+	if len(data) > maxKeySize {
+		return nil, fmt.Errorf("gpg key %q is larger than %d bytes", url, maxKeySize)
+	}
+	return parseKey(data)
+}
+
+func parseKey(data []byte) (openpgp.EntityList, error) {
+	if block, err := armor.Decode(bytes.NewReader(data)); err == nil && block != nil {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// fingerprint formats the fingerprint of e as upper case hex.
+func fingerprint(e *openpgp.Entity) string {
+	return fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+}
+
+// validateKey checks that the keys in el are usable: there is at least one,
+// none is revoked or expired and, if fingerprints is set, each key has one
+// of them.
+func validateKey(el openpgp.EntityList, fingerprints []string) error {
+	if len(el) == 0 {
+		return errors.New("no keys found")
+	}
+	want := map[string]bool{}
+	for _, f := range fingerprints {
+		want[strings.ToUpper(strings.ReplaceAll(f, " ", ""))] = true
+	}
+	now := time.Now()
+	for _, e := range el {
+		fp := fingerprint(e)
+		if len(want) > 0 && !want[fp] {
+			return fmt.Errorf("key %s does not have an expected fingerprint", fp)
+		}
+		if len(e.Revocations) > 0 {
+			return fmt.Errorf("key %s is revoked", fp)
+		}
+		for _, id := range e.Identities {
+			if id.SelfSignature != nil && id.SelfSignature.KeyExpired(now) {
+				return fmt.Errorf("key %s expired", fp)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchKeys fetches and validates the keys at urls.
+func fetchKeys(ctx context.Context, urls, fingerprints []string) (openpgp.EntityList, error) {
+	var keys openpgp.EntityList
+	for _, url := range urls {
+		el, err := fetchKey(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateKey(el, fingerprints); err != nil {
+			return nil, fmt.Errorf("invalid gpg key %q: %v", url, err)
+		}
+		keys = append(keys, el...)
+	}
+	return keys, nil
+}
+
+// serializeKeys returns the public keys of el as a binary keyring.
+func serializeKeys(el openpgp.EntityList) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, e := range el {
+		if err := e.Serialize(&buf); err != nil {
+			return nil, fmt.Errorf("error serializing gpg key: %v", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// armorKeys returns the public keys of el armored.
+func armorKeys(el openpgp.EntityList) ([]byte, error) {
+	keys, err := serializeKeys(el)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(keys); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
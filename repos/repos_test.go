@@ -0,0 +1,159 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package repos
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func testKey(t *testing.T) (*openpgp.Entity, []byte) {
+	t.Helper()
+	e, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Self-sign the identities so the key is complete.
+	var buf bytes.Buffer
+	if err := e.SerializePrivate(&bytes.Buffer{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return e, buf.Bytes()
+}
+
+func setDirs(t *testing.T) string {
+	dir := t.TempDir()
+	oldApt, oldKeyring, oldYum, oldYumKey, oldZypper := aptSourcesDir, aptKeyringDir, yumReposDir, yumKeyDir, zypperServicesDir
+	t.Cleanup(func() {
+		aptSourcesDir, aptKeyringDir, yumReposDir, yumKeyDir, zypperServicesDir = oldApt, oldKeyring, oldYum, oldYumKey, oldZypper
+	})
+	aptSourcesDir = filepath.Join(dir, "sources.list.d")
+	aptKeyringDir = filepath.Join(dir, "keyrings")
+	yumReposDir = filepath.Join(dir, "yum.repos.d")
+	yumKeyDir = filepath.Join(dir, "rpm-gpg")
+	zypperServicesDir = filepath.Join(dir, "services.d")
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAptRepository(t *testing.T) {
+	setDirs(t)
+	e, key := testKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(key) }))
+	defer ts.Close()
+	ctx := context.Background()
+
+	r := &AptRepository{Name: "example", URI: "https://repo.example.com/", Distribution: "stable", Components: []string{"main"}, GPGKey: ts.URL, Fingerprints: []string{fingerprint(e)}}
+	changed, err := SetAptRepository(ctx, r)
+	if err != nil || !changed {
+		t.Fatalf("SetAptRepository() = %t, %v, want true, nil", changed, err)
+	}
+	want := "# Repo file managed by Google OSConfig agent\ndeb [signed-by=" + r.keyringPath() + "] https://repo.example.com/ stable main\n"
+	if got := readFile(t, r.listPath()); got != want {
+		t.Errorf("sources list = %q, want %q", got, want)
+	}
+	if got := readFile(t, r.keyringPath()); got != string(key) {
+		t.Error("keyring does not contain the key")
+	}
+
+	if changed, err := SetAptRepository(ctx, r); err != nil || changed {
+		t.Errorf("second SetAptRepository() = %t, %v, want false, nil", changed, err)
+	}
+
+	r.Fingerprints = []string{"0000"}
+	if _, err := SetAptRepository(ctx, r); err == nil || !strings.Contains(err.Error(), "does not have an expected fingerprint") {
+		t.Errorf("SetAptRepository() with a wrong fingerprint error = %v", err)
+	}
+
+	if removed, err := RemoveAptRepository(ctx, "example"); err != nil || !removed {
+		t.Fatalf("RemoveAptRepository() = %t, %v, want true, nil", removed, err)
+	}
+	for _, p := range []string{r.listPath(), r.keyringPath()} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed: %v", p, err)
+		}
+	}
+	if removed, err := RemoveAptRepository(ctx, "example"); err != nil || removed {
+		t.Errorf("second RemoveAptRepository() = %t, %v, want false, nil", removed, err)
+	}
+}
+
+func TestYumRepository(t *testing.T) {
+	setDirs(t)
+	_, key := testKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(key) }))
+	defer ts.Close()
+
+	r := &YumRepository{ID: "example", BaseURL: "https://repo.example.com/el9", GPGKeys: []string{ts.URL}}
+	if _, err := SetYumRepository(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Repo file managed by Google OSConfig agent\n[example]\nname=example\nbaseurl=https://repo.example.com/el9\nenabled=1\ngpgcheck=1\ngpgkey=file://" + filepath.ToSlash(r.keyPath()) + "\n"
+	if got := readFile(t, r.repoPath()); got != want {
+		t.Errorf("repo file = %q, want %q", got, want)
+	}
+	if got := readFile(t, r.keyPath()); !strings.HasPrefix(got, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		t.Errorf("key file is not armored: %q", got)
+	}
+	if el, err := parseKey([]byte(readFile(t, r.keyPath()))); err != nil || len(el) != 1 {
+		t.Errorf("parseKey(key file) = %d keys, %v", len(el), err)
+	}
+}
+
+func TestZypperService(t *testing.T) {
+	setDirs(t)
+	s := &ZypperService{Alias: "example", URL: "https://smt.example.com/", AutoRefresh: true}
+	if _, err := SetZypperService(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Repo file managed by Google OSConfig agent\n[example]\nname=example\nurl=https://smt.example.com/\ntype=ris\nenabled=1\nautorefresh=1\n"
+	if got := readFile(t, s.servicePath()); got != want {
+		t.Errorf("service file = %q, want %q", got, want)
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	setDirs(t)
+	ctx := context.Background()
+	if _, err := SetAptRepository(ctx, &AptRepository{Name: "../evil", URI: "u", Distribution: "d"}); err == nil {
+		t.Error("SetAptRepository() with a path in the name succeeded")
+	}
+	if _, err := RemoveYumRepository(ctx, "a/b"); err == nil {
+		t.Error("RemoveYumRepository() with a path in the ID succeeded")
+	}
+	if _, err := SetZypperService(ctx, &ZypperService{Alias: "ok"}); err == nil {
+		t.Error("SetZypperService() without a URL succeeded")
+	}
+}
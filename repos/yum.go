@@ -0,0 +1,131 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package repos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+)
+
+var (
+	yumReposDir = "/etc/yum.repos.d"
+	yumKeyDir   = "/etc/pki/rpm-gpg"
+)
+
+// YumRepository is a yum repository, written to
+// /etc/yum.repos.d/<ID>.repo with its keys in
+// /etc/pki/rpm-gpg/RPM-GPG-KEY-<ID>.
+type YumRepository struct {
+	ID          string
+	DisplayName string
+	BaseURL     string
+	// GPGKeys are the URLs of the keys the packages are signed with, they
+	// are fetched and installed locally so yum does not fetch them itself.
+	GPGKeys []string
+	// Fingerprints, if set, are the fingerprints the keys must have.
+	Fingerprints []string
+}
+
+func (r *YumRepository) validate() error {
+	if err := checkName("yum repository ID", r.ID); err != nil {
+		return err
+	}
+	if r.BaseURL == "" {
+		return fmt.Errorf("yum repository %q needs a base URL", r.ID)
+	}
+	return nil
+}
+
+func (r *YumRepository) repoPath() string {
+	return filepath.Join(yumReposDir, r.ID+".repo")
+}
+
+func (r *YumRepository) keyPath() string {
+	return filepath.Join(yumKeyDir, "RPM-GPG-KEY-"+r.ID)
+}
+
+func (r *YumRepository) contents() []byte {
+	/*
+		# Repo file managed by Google OSConfig agent
+		[id]
+		name=display-name
+		baseurl=https://repo-url
+		enabled=1
+		gpgcheck=1
+		gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-id
+	*/
+	var buf bytes.Buffer
+	buf.WriteString("# Repo file managed by Google OSConfig agent\n")
+	fmt.Fprintf(&buf, "[%s]\n", r.ID)
+	name := r.DisplayName
+	if name == "" {
+		name = r.ID
+	}
+	fmt.Fprintf(&buf, "name=%s\n", name)
+	fmt.Fprintf(&buf, "baseurl=%s\n", agentconfig.MirrorURL(r.BaseURL))
+	buf.WriteString("enabled=1\ngpgcheck=1\n")
+	if len(r.GPGKeys) > 0 {
+		fmt.Fprintf(&buf, "gpgkey=file://%s\n", filepath.ToSlash(r.keyPath()))
+	}
+	return buf.Bytes()
+}
+
+func (r *YumRepository) writeKeys(ctx context.Context) (bool, error) {
+	keys, err := fetchKeys(ctx, r.GPGKeys, r.Fingerprints)
+	if err != nil {
+		return false, err
+	}
+	// rpm only imports armored keys.
+	armored, err := armorKeys(keys)
+	if err != nil {
+		return false, err
+	}
+	return writeIfChanged(ctx, r.keyPath(), armored)
+}
+
+// SetYumRepository creates or updates the yum repository r, fetching and
+// validating its keys first. It reports whether any file changed.
+func SetYumRepository(ctx context.Context, r *YumRepository) (bool, error) {
+	if err := r.validate(); err != nil {
+		return false, err
+	}
+	var changed bool
+	var err error
+	if len(r.GPGKeys) == 0 {
+		// The keys of an earlier definition are no longer trusted.
+		changed, err = removeFiles(ctx, r.keyPath())
+	} else {
+		changed, err = r.writeKeys(ctx)
+	}
+	if err != nil {
+		return changed, err
+	}
+	written, err := writeIfChanged(ctx, r.repoPath(), r.contents())
+	return changed || written, err
+}
+
+// RemoveYumRepository removes the yum repository id and its keys. It
+// reports whether anything was removed.
+func RemoveYumRepository(ctx context.Context, id string) (bool, error) {
+	if err := checkName("yum repository ID", id); err != nil {
+		return false, err
+	}
+	r := &YumRepository{ID: id}
+	return removeFiles(ctx, r.repoPath(), r.keyPath())
+}
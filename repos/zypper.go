@@ -0,0 +1,105 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package repos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+)
+
+var zypperServicesDir = "/etc/zypp/services.d"
+
+// ZypperService is a zypper repository index service, written to
+// /etc/zypp/services.d/<Alias>.service. The repositories of the service
+// come with their own keys, which zypper imports when refreshing it.
+type ZypperService struct {
+	Alias       string
+	DisplayName string
+	URL         string
+	// Type is the service type, "ris" by default.
+	Type string
+	// AutoRefresh refreshes the service, and so its list of repositories,
+	// whenever zypper refreshes the repositories.
+	AutoRefresh bool
+}
+
+func (s *ZypperService) validate() error {
+	if err := checkName("zypper service alias", s.Alias); err != nil {
+		return err
+	}
+	if s.URL == "" {
+		return fmt.Errorf("zypper service %q needs a URL", s.Alias)
+	}
+	return nil
+}
+
+func (s *ZypperService) servicePath() string {
+	return filepath.Join(zypperServicesDir, s.Alias+".service")
+}
+
+func (s *ZypperService) contents() []byte {
+	/*
+		# Repo file managed by Google OSConfig agent
+		[alias]
+		name=display-name
+		url=https://service-url
+		type=ris
+		enabled=1
+		autorefresh=1
+	*/
+	var buf bytes.Buffer
+	buf.WriteString("# Repo file managed by Google OSConfig agent\n")
+	fmt.Fprintf(&buf, "[%s]\n", s.Alias)
+	name := s.DisplayName
+	if name == "" {
+		name = s.Alias
+	}
+	fmt.Fprintf(&buf, "name=%s\n", name)
+	fmt.Fprintf(&buf, "url=%s\n", agentconfig.MirrorURL(s.URL))
+	typ := s.Type
+	if typ == "" {
+		typ = "ris"
+	}
+	fmt.Fprintf(&buf, "type=%s\n", typ)
+	buf.WriteString("enabled=1\n")
+	if s.AutoRefresh {
+		buf.WriteString("autorefresh=1\n")
+	} else {
+		buf.WriteString("autorefresh=0\n")
+	}
+	return buf.Bytes()
+}
+
+// SetZypperService creates or updates the zypper service s. It reports
+// whether the service file changed.
+func SetZypperService(ctx context.Context, s *ZypperService) (bool, error) {
+	if err := s.validate(); err != nil {
+		return false, err
+	}
+	return writeIfChanged(ctx, s.servicePath(), s.contents())
+}
+
+// RemoveZypperService removes the zypper service alias. It reports whether
+// it was removed.
+func RemoveZypperService(ctx context.Context, alias string) (bool, error) {
+	if err := checkName("zypper service alias", alias); err != nil {
+		return false, err
+	}
+	return removeFiles(ctx, (&ZypperService{Alias: alias}).servicePath())
+}
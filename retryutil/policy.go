@@ -0,0 +1,180 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package retryutil
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+var (
+	randFloat = rand.Float64
+	timeAfter = time.After
+)
+
+// Policy describes how Do retries an operation.
+type Policy struct {
+	// Initial is the wait after the first failed attempt.
+	Initial time.Duration
+	// Multiplier grows the wait after each further failed attempt, 1 or
+	// less keeps it constant.
+	Multiplier float64
+	// Max caps a single wait, 0 doesn't cap it.
+	Max time.Duration
+	// Jitter adds a random fraction of up to Jitter to each wait, e.g. 0.5
+	// waits up to 50% longer, so agents failing at the same time don't
+	// retry at the same time.
+	Jitter float64
+	// Throttled is the minimum wait after an error marked with Throttled.
+	Throttled time.Duration
+	// MaxElapsed stops retrying once the total time spent waiting between
+	// attempts would exceed it, the time of the attempts themselves doesn't
+	// count. 0 retries until the context is done.
+	MaxElapsed time.Duration
+	// MaxAttempts stops after this many attempts, 0 doesn't limit them.
+	MaxAttempts int
+	// RetryOn limits the retries to the errors it returns true for, nil
+	// retries all errors not marked with Permanent.
+	RetryOn func(error) bool
+}
+
+// Exponential returns a Policy doubling the wait from initial up to max.
+func Exponential(initial, max time.Duration) Policy {
+	return Policy{Initial: initial, Multiplier: 2, Max: max}
+}
+
+// WithJitter returns a copy of p with Jitter set.
+func (p Policy) WithJitter(jitter float64) Policy {
+	p.Jitter = jitter
+	return p
+}
+
+// WithMaxElapsed returns a copy of p with MaxElapsed set.
+func (p Policy) WithMaxElapsed(d time.Duration) Policy {
+	p.MaxElapsed = d
+	return p
+}
+
+// WithMaxAttempts returns a copy of p with MaxAttempts set.
+func (p Policy) WithMaxAttempts(n int) Policy {
+	p.MaxAttempts = n
+	return p
+}
+
+// WithRetryOn returns a copy of p with RetryOn set.
+func (p Policy) WithRetryOn(f func(error) bool) Policy {
+	p.RetryOn = f
+	return p
+}
+
+// Wait returns the wait after the given failed attempt, starting at 1.
+func (p Policy) Wait(attempt int) time.Duration {
+	w := float64(p.Initial)
+	if p.Multiplier > 1 && attempt > 1 {
+		w *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	if p.Max > 0 {
+		w = math.Min(w, float64(p.Max))
+	}
+	if p.Jitter > 0 {
+		w += w * p.Jitter * randFloat()
+	}
+	return time.Duration(w)
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+type throttledError struct{ err error }
+
+func (e *throttledError) Error() string { return e.err.Error() }
+func (e *throttledError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, Do returns it right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// Throttled marks err as the other side asking to slow down, Do waits at
+// least Policy.Throttled before the next attempt.
+func Throttled(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &throttledError{err}
+}
+
+// cause strips the Permanent and Throttled marks from err.
+func cause(err error) error {
+	for {
+		switch e := err.(type) {
+		case *permanentError:
+			err = e.err
+		case *throttledError:
+			err = e.err
+		default:
+			return err
+		}
+	}
+}
+
+// Do calls f until it succeeds, returns an error marked with Permanent, or
+// p or ctx stop the retries, and returns the last error of f. desc describes
+// the operation in the log messages, e.g. "fetching artifact".
+func Do(ctx context.Context, p Policy, desc string, f func() error) error {
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if IsPermanent(err) || (p.RetryOn != nil && !p.RetryOn(cause(err))) || (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) {
+			return cause(err)
+		}
+
+		wait := p.Wait(attempt)
+		var throttled *throttledError
+		if errors.As(err, &throttled) && wait < p.Throttled {
+			wait = p.Throttled
+		}
+		if p.MaxElapsed > 0 && waited+wait > p.MaxElapsed {
+			return cause(err)
+		}
+		waited += wait
+
+		clog.Warningf(ctx, "Error %s, attempt %d, retrying in %s: %v", desc, attempt, wait, cause(err))
+		select {
+		case <-ctx.Done():
+			return cause(err)
+		case <-timeAfter(wait):
+		}
+	}
+}
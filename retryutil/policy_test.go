@@ -0,0 +1,119 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package retryutil
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPolicyWait(t *testing.T) {
+	randFloat = func() float64 { return 1 }
+	defer func() { randFloat = rand.Float64 }()
+
+	p := Exponential(time.Second, 5*time.Second)
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := p.Wait(i + 1); got != want {
+			t.Errorf("Wait(%d) = %s, want %s", i+1, got, want)
+		}
+	}
+	if got, want := p.WithJitter(0.5).Wait(2), 3*time.Second; got != want {
+		t.Errorf("Wait(2) with jitter = %s, want %s", got, want)
+	}
+	if got, want := (Policy{Initial: time.Second}).Wait(4), time.Second; got != want {
+		t.Errorf("constant Wait(4) = %s, want %s", got, want)
+	}
+}
+
+func TestDo(t *testing.T) {
+	var waits []time.Duration
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		c := make(chan time.Time, 1)
+		c <- time.Time{}
+		return c
+	}
+	defer func() { timeAfter = time.After }()
+
+	errFail := errors.New("fail")
+	errOther := errors.New("other")
+	p := Exponential(time.Second, time.Minute)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		errs      []error
+		wantErr   error
+		wantWaits []time.Duration
+	}{
+		{"Success", p, nil, nil, nil},
+		{"Retried", p, []error{errFail, errFail}, nil, []time.Duration{time.Second, 2 * time.Second}},
+		{"Permanent", p, []error{errFail, Permanent(errFail)}, errFail, []time.Duration{time.Second}},
+		{"MaxAttempts", Policy{Initial: time.Second, MaxAttempts: 2}, []error{errFail, errFail, errFail}, errFail, []time.Duration{time.Second}},
+		{"MaxElapsed", p.WithMaxElapsed(5 * time.Second), []error{errFail, errFail, errFail, errFail}, errFail, []time.Duration{time.Second, 2 * time.Second}},
+		{"Throttled", Policy{Initial: time.Second, Throttled: 10 * time.Second}, []error{Throttled(errFail), errFail}, nil, []time.Duration{10 * time.Second, time.Second}},
+		{"RetryOn", p.WithRetryOn(func(err error) bool { return err == errFail }), []error{errFail, errOther}, errOther, []time.Duration{time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits = nil
+			errs := tt.errs
+			err := Do(ctx, tt.policy, "testing", func() error {
+				if len(errs) == 0 {
+					return nil
+				}
+				err := errs[0]
+				errs = errs[1:]
+				return err
+			})
+			if err != tt.wantErr {
+				t.Errorf("Do() = %v, want %v", err, tt.wantErr)
+			}
+			if len(waits) != len(tt.wantWaits) {
+				t.Fatalf("waits = %v, want %v", waits, tt.wantWaits)
+			}
+			for i := range waits {
+				if waits[i] != tt.wantWaits[i] {
+					t.Errorf("waits = %v, want %v", waits, tt.wantWaits)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDoContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errFail := errors.New("fail")
+	attempts := 0
+	err := Do(ctx, Policy{Initial: time.Hour}, "testing", func() error {
+		attempts++
+		cancel()
+		return errFail
+	})
+	if err != errFail {
+		t.Errorf("Do() = %v, want %v", err, errFail)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+	if !IsPermanent(Permanent(errFail)) || IsPermanent(errFail) || Permanent(nil) != nil {
+		t.Error("unexpected IsPermanent result")
+	}
+}
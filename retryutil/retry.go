@@ -24,7 +24,6 @@ import (
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
-	"github.com/GoogleCloudPlatform/osconfig/clog"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -48,60 +47,43 @@ func RetrySleep(base int, extra int) time.Duration {
 }
 
 // RetryFunc retries a function provided as a parameter for maxRetryTime.
-func RetryFunc(ctx context.Context, maxRetryTime time.Duration, desc string, f func() error) error {
-	var tot time.Duration
-	for i := 1; ; i++ {
-		err := f()
-		if err == nil {
-			return nil
-		}
+// defaultPolicy is the Policy of RetryFunc and RetryAPICall.
+var defaultPolicy = Exponential(time.Second, 5*time.Minute).WithJitter(0.5)
 
-		ns := RetrySleep(i, 0)
-		tot += ns
-		if tot > maxRetryTime {
-			return err
-		}
+// apiPolicy is defaultPolicy waiting longer when the API reports it is out
+// of quota.
+var apiPolicy = func() Policy {
+	p := defaultPolicy
+	p.Throttled = 15 * time.Second
+	return p
+}()
 
-		clog.Errorf(ctx, "Error %s, attempt %d, retrying in %s: %v", desc, i, ns, err)
-		time.Sleep(ns)
-	}
+func RetryFunc(ctx context.Context, maxRetryTime time.Duration, desc string, f func() error) error {
+	return Do(ctx, defaultPolicy.WithMaxElapsed(maxRetryTime), desc, f)
 }
 
-// RetryAPICall retries an API call for maxRetryTime.
 func RetryAPICall(ctx context.Context, maxRetryTime time.Duration, name string, f func() error) error {
-	var tot time.Duration
-	for i := 1; ; i++ {
-		extra := 1
+	return Do(ctx, apiPolicy.WithMaxElapsed(maxRetryTime), "calling "+name, func() error {
 		err := f()
 		if err == nil {
 			return nil
 		}
-		if s, ok := status.FromError(err); ok {
-			err := fmt.Errorf("code: %q, message: %q, details: %q", s.Code(), s.Message(), s.Details())
-			switch s.Code() {
-			// Errors we should retry.
-			case codes.DeadlineExceeded, codes.Unavailable, codes.Aborted, codes.Internal:
-			// Add additional sleep.
-			case codes.ResourceExhausted:
-				extra = 10
-			default:
-				var ndr *metadata.NotDefinedError
-				if errors.As(err, &ndr) {
-					return fmt.Errorf("no service account set for instance")
-				}
-				return err
-			}
-		} else {
-			return err
+		s, ok := status.FromError(err)
+		if !ok {
+			return Permanent(err)
 		}
-
-		ns := RetrySleep(i, extra)
-		tot += ns
-		if tot > maxRetryTime {
-			return err
+		serr := fmt.Errorf("code: %q, message: %q, details: %q", s.Code(), s.Message(), s.Details())
+		switch s.Code() {
+		// Errors we should retry.
+		case codes.DeadlineExceeded, codes.Unavailable, codes.Aborted, codes.Internal:
+			return serr
+		case codes.ResourceExhausted:
+			return Throttled(serr)
 		}
-
-		clog.Warningf(ctx, "Error calling %s, attempt %d, retrying in %s: %v", name, i, ns, err)
-		time.Sleep(ns)
-	}
+		var ndr *metadata.NotDefinedError
+		if errors.As(err, &ndr) {
+			return Permanent(fmt.Errorf("no service account set for instance"))
+		}
+		return Permanent(serr)
+	})
 }
@@ -0,0 +1,146 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// CycloneDXSpecVersion is the version of the CycloneDX specification of the
+// BOMs.
+const CycloneDXSpecVersion = "1.5"
+
+// BOM is a CycloneDX BOM, only the fields filled in by NewCycloneDX are
+// modelled.
+type BOM struct {
+	BOMFormat    string        `json:"bomFormat"`
+	SpecVersion  string        `json:"specVersion"`
+	SerialNumber string        `json:"serialNumber"`
+	Version      int           `json:"version"`
+	Metadata     *Metadata     `json:"metadata"`
+	Components   []*Component  `json:"components"`
+	Dependencies []*Dependency `json:"dependencies,omitempty"`
+}
+
+// Metadata says when a BOM was created, by which tool and for what.
+type Metadata struct {
+	Timestamp string     `json:"timestamp"`
+	Tools     *Tools     `json:"tools"`
+	Component *Component `json:"component"`
+}
+
+// Tools are the tools that created a BOM.
+type Tools struct {
+	Components []*Component `json:"components"`
+}
+
+// Component is a CycloneDX component.
+type Component struct {
+	Type    string  `json:"type"`
+	BOMRef  string  `json:"bom-ref,omitempty"`
+	Group   string  `json:"group,omitempty"`
+	Name    string  `json:"name"`
+	Version string  `json:"version,omitempty"`
+	PURL    string  `json:"purl,omitempty"`
+	Hashes  []*Hash `json:"hashes,omitempty"`
+}
+
+// Hash is a hash of a Component.
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// Dependency lists the components the component Ref depends on.
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// serialNumber returns a random version 4 UUID URN.
+func serialNumber() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// NewCycloneDX returns the CycloneDX BOM of the installed packages pkgs of
+// the system called name, with the same components as the SPDX document
+// New returns. The system is the metadata component, its dependencies are
+// all the packages.
+func NewCycloneDX(name string, pkgs *packages.Packages, opts ...Option) *BOM {
+	o := newOptions(opts)
+	bom := &BOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  CycloneDXSpecVersion,
+		SerialNumber: serialNumber(),
+		Version:      1,
+		Metadata: &Metadata{
+			Timestamp: o.created.UTC().Format(time.RFC3339),
+			Tools: &Tools{Components: []*Component{{
+				Type:    "application",
+				Group:   "google",
+				Name:    "google-osconfig-agent",
+				Version: agentconfig.Version(),
+			}}},
+			Component: &Component{Type: "operating-system", BOMRef: "system", Name: name},
+		},
+		Components: []*Component{},
+	}
+
+	root := &Dependency{Ref: "system", DependsOn: []string{}}
+	bom.Dependencies = append(bom.Dependencies, root)
+	byName := map[string][]string{}
+	for _, k := range kinds(pkgs) {
+		for i, p := range k.pkgs {
+			ref := fmt.Sprintf("%s-%d", k.name, i)
+			c := &Component{
+				Type:    "library",
+				BOMRef:  ref,
+				Name:    p.Name,
+				Version: p.Version,
+				PURL:    k.purl(o.distro, p),
+			}
+			if h, ok := o.rpmHashes[p.Name+"."+p.Arch]; ok && k.name == "rpm" {
+				c.Hashes = []*Hash{{Alg: "SHA-256", Content: h}}
+			}
+			bom.Components = append(bom.Components, c)
+			root.DependsOn = append(root.DependsOn, ref)
+			if k.name == "deb" || k.name == "rpm" {
+				byName[p.Name] = append(byName[p.Name], ref)
+			}
+		}
+	}
+
+	if o.deps != nil {
+		for _, name := range o.deps.Packages() {
+			for _, from := range byName[name] {
+				d := &Dependency{Ref: from, DependsOn: []string{}}
+				for _, dep := range o.deps.Dependencies(name) {
+					d.DependsOn = append(d.DependsOn, byName[dep]...)
+				}
+				bom.Dependencies = append(bom.Dependencies, d)
+			}
+		}
+	}
+	return bom
+}
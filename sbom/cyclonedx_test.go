@@ -0,0 +1,70 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sbom
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewCycloneDX(t *testing.T) {
+	pkgs := &packages.Packages{
+		Rpm: []*packages.PkgInfo{
+			{Name: "glibc", Arch: "x86_64", Version: "2.34-60.el9"},
+			{Name: "openssl", Arch: "x86_64", Version: "1:3.0.7-6.el9", Epoch: "1"},
+		},
+		Gem: []*packages.PkgInfo{{Name: "rake", Version: "13.0.6"}},
+	}
+	g := &packages.DepGraph{}
+	if err := json.Unmarshal([]byte(`{"glibc":[],"openssl":["glibc"]}`), g); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	b := NewCycloneDX("host1", pkgs, Distro("rhel"), Created(created), Dependencies(g), RPMHashes(map[string]string{"openssl.x86_64": "abcd"}))
+
+	if b.BOMFormat != "CycloneDX" || b.SpecVersion != "1.5" || b.Version != 1 || b.Metadata.Timestamp != "2024-05-01T12:00:00Z" {
+		t.Errorf("unexpected BOM header: %+v %+v", b, b.Metadata)
+	}
+	if !regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(b.SerialNumber) {
+		t.Errorf("SerialNumber = %q, want a version 4 UUID URN", b.SerialNumber)
+	}
+	if tool := b.Metadata.Tools.Components[0]; tool.Name != "google-osconfig-agent" {
+		t.Errorf("tool = %+v, want the agent", tool)
+	}
+
+	wantComponents := []*Component{
+		{Type: "library", BOMRef: "rpm-0", Name: "glibc", Version: "2.34-60.el9", PURL: "pkg:rpm/rhel/glibc@2.34-60.el9?arch=x86_64"},
+		{Type: "library", BOMRef: "rpm-1", Name: "openssl", Version: "1:3.0.7-6.el9", PURL: "pkg:rpm/rhel/openssl@3.0.7-6.el9?arch=x86_64&epoch=1", Hashes: []*Hash{{Alg: "SHA-256", Content: "abcd"}}},
+		{Type: "library", BOMRef: "gem-0", Name: "rake", Version: "13.0.6", PURL: "pkg:gem/rake@13.0.6"},
+	}
+	if diff := cmp.Diff(wantComponents, b.Components); diff != "" {
+		t.Errorf("Components mismatch (-want +got):\n%s", diff)
+	}
+
+	wantDeps := []*Dependency{
+		{Ref: "system", DependsOn: []string{"rpm-0", "rpm-1", "gem-0"}},
+		{Ref: "rpm-0", DependsOn: []string{}},
+		{Ref: "rpm-1", DependsOn: []string{"rpm-0"}},
+	}
+	if diff := cmp.Diff(wantDeps, b.Dependencies); diff != "" {
+		t.Errorf("Dependencies mismatch (-want +got):\n%s", diff)
+	}
+}
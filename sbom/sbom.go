@@ -0,0 +1,291 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package sbom converts the installed packages of an inventory into a
+// software bill of materials, either an SPDX 2.3 or a CycloneDX 1.5
+// document.
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// SPDXVersion is the version of the SPDX specification of the documents.
+const SPDXVersion = "SPDX-2.3"
+
+const (
+	documentID = "SPDXRef-DOCUMENT"
+	rootID     = "SPDXRef-System"
+	// noAssertion is the SPDX value for information that was not determined.
+	noAssertion = "NOASSERTION"
+)
+
+// Document is an SPDX document, only the fields filled in by New are
+// modelled.
+type Document struct {
+	SPDXVersion       string          `json:"spdxVersion"`
+	DataLicense       string          `json:"dataLicense"`
+	SPDXID            string          `json:"SPDXID"`
+	Name              string          `json:"name"`
+	DocumentNamespace string          `json:"documentNamespace"`
+	CreationInfo      *CreationInfo   `json:"creationInfo"`
+	Packages          []*Package      `json:"packages"`
+	Relationships     []*Relationship `json:"relationships"`
+}
+
+// CreationInfo says who created a Document and when.
+type CreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+// Package is an SPDX package.
+type Package struct {
+	Name                  string         `json:"name"`
+	SPDXID                string         `json:"SPDXID"`
+	VersionInfo           string         `json:"versionInfo,omitempty"`
+	DownloadLocation      string         `json:"downloadLocation"`
+	FilesAnalyzed         bool           `json:"filesAnalyzed"`
+	SourceInfo            string         `json:"sourceInfo,omitempty"`
+	PrimaryPackagePurpose string         `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []*ExternalRef `json:"externalRefs,omitempty"`
+}
+
+// ExternalRef is a reference of a Package, New adds the package URL (PURL).
+type ExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// Relationship relates two SPDX elements, e.g. "DEPENDS_ON".
+type Relationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+type options struct {
+	namespace string
+	distro    string
+	created   time.Time
+	deps      *packages.DepGraph
+	rpmHashes map[string]string
+}
+
+// Option is an option for New.
+type Option func(*options)
+
+// Namespace sets the document namespace, a URI unique to the document. By
+// default it is derived from the document name and creation time.
+func Namespace(ns string) Option {
+	return func(o *options) {
+		o.namespace = ns
+	}
+}
+
+// Distro sets the distribution ID used as the PURL namespace of deb and rpm
+// packages, the ID field of os-release such as "debian" or "rhel".
+func Distro(distro string) Option {
+	return func(o *options) {
+		o.distro = distro
+	}
+}
+
+// Created sets the creation time of the document, by default the time New
+// is called.
+func Created(t time.Time) Option {
+	return func(o *options) {
+		o.created = t
+	}
+}
+
+// Dependencies adds DEPENDS_ON relationships between the packages from g,
+// see packages.DependencyGraph.
+func Dependencies(g *packages.DepGraph) Option {
+	return func(o *options) {
+		o.deps = g
+	}
+}
+
+// RPMHashes sets the SHA-256 digests of the rpm packages keyed by
+// "name.arch", see packages.RPMHeaderDigests. Only CycloneDX documents
+// include them.
+func RPMHashes(h map[string]string) Option {
+	return func(o *options) {
+		o.rpmHashes = h
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{created: time.Now()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// kind is a list of packages.Packages and how its packages are identified.
+type kind struct {
+	name string
+	pkgs []*packages.PkgInfo
+	purl func(distro string, p *packages.PkgInfo) string
+}
+
+func escape(s string) string {
+	return url.PathEscape(s)
+}
+
+func qualifiers(q map[string]string) string {
+	var keys []string
+	for k, v := range q {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+url.QueryEscape(q[k]))
+	}
+	return "?" + strings.Join(parts, "&")
+}
+
+// osPURL formats the PURL of a deb or rpm package, the epoch is a qualifier
+// rather than part of the version.
+func osPURL(typ, distro string, p *packages.PkgInfo) string {
+	version := p.Version
+	if p.Epoch != "" {
+		version = strings.TrimPrefix(version, p.Epoch+":")
+	}
+	ns := ""
+	if distro != "" {
+		ns = escape(strings.ToLower(distro)) + "/"
+	}
+	return fmt.Sprintf("pkg:%s/%s%s@%s%s", typ, ns, escape(p.Name), escape(version), qualifiers(map[string]string{"arch": p.Arch, "epoch": p.Epoch}))
+}
+
+func simplePURL(typ string) func(string, *packages.PkgInfo) string {
+	return func(_ string, p *packages.PkgInfo) string {
+		name := p.Name
+		// PyPI names are case insensitive, the PURL spec lowercases them.
+		if typ == "pypi" {
+			name = strings.ToLower(name)
+		}
+		return fmt.Sprintf("pkg:%s/%s@%s", typ, escape(name), escape(p.Version))
+	}
+}
+
+func genericPURL(ns string) func(string, *packages.PkgInfo) string {
+	return func(_ string, p *packages.PkgInfo) string {
+		return fmt.Sprintf("pkg:generic/%s/%s@%s%s", ns, escape(p.Name), escape(p.Version), qualifiers(map[string]string{"arch": p.Arch}))
+	}
+}
+
+func kinds(pkgs *packages.Packages) []kind {
+	if pkgs == nil {
+		return nil
+	}
+	return []kind{
+		{"deb", pkgs.Deb, func(d string, p *packages.PkgInfo) string { return osPURL("deb", d, p) }},
+		{"rpm", pkgs.Rpm, func(d string, p *packages.PkgInfo) string { return osPURL("rpm", d, p) }},
+		{"cos", pkgs.COS, genericPURL("cos")},
+		{"googet", pkgs.GooGet, genericPURL("googet")},
+		{"brew", pkgs.Brew, genericPURL("brew")},
+		{"gem", pkgs.Gem, simplePURL("gem")},
+		{"pip", pkgs.Pip, simplePURL("pypi")},
+	}
+}
+
+// New returns the SPDX document of the installed packages pkgs of the
+// system called name, e.g. the hostname. The system is the package the
+// document describes, it contains all the others. Windows updates are not
+// packages in the SPDX sense and are left out.
+func New(name string, pkgs *packages.Packages, opts ...Option) *Document {
+	o := newOptions(opts)
+	created := o.created.UTC().Format(time.RFC3339)
+	if o.namespace == "" {
+		o.namespace = fmt.Sprintf("https://spdx.org/spdxdocs/osconfig/%s-%s", escape(name), created)
+	}
+
+	doc := &Document{
+		SPDXVersion:       SPDXVersion,
+		DataLicense:       "CC0-1.0",
+		SPDXID:            documentID,
+		Name:              name,
+		DocumentNamespace: o.namespace,
+		CreationInfo: &CreationInfo{
+			Created:  created,
+			Creators: []string{"Tool: google-osconfig-agent-" + agentconfig.Version()},
+		},
+		Packages: []*Package{{
+			Name:                  name,
+			SPDXID:                rootID,
+			DownloadLocation:      noAssertion,
+			PrimaryPackagePurpose: "OPERATING-SYSTEM",
+		}},
+		Relationships: []*Relationship{{SPDXElementID: documentID, RelationshipType: "DESCRIBES", RelatedSPDXElement: rootID}},
+	}
+
+	// Dependencies are by name, a package installed for several
+	// architectures depends on and is depended on through each of them.
+	byName := map[string][]string{}
+	for _, k := range kinds(pkgs) {
+		for i, p := range k.pkgs {
+			id := fmt.Sprintf("SPDXRef-Package-%s-%d", k.name, i)
+			sp := &Package{
+				Name:             p.Name,
+				SPDXID:           id,
+				VersionInfo:      p.Version,
+				DownloadLocation: noAssertion,
+				ExternalRefs: []*ExternalRef{{
+					ReferenceCategory: "PACKAGE-MANAGER",
+					ReferenceType:     "purl",
+					ReferenceLocator:  k.purl(o.distro, p),
+				}},
+			}
+			if p.Source.Name != "" && (p.Source.Name != p.Name || p.Source.Version != p.Version) {
+				sp.SourceInfo = fmt.Sprintf("built from source package %s %s", p.Source.Name, p.Source.Version)
+			}
+			doc.Packages = append(doc.Packages, sp)
+			doc.Relationships = append(doc.Relationships, &Relationship{SPDXElementID: rootID, RelationshipType: "CONTAINS", RelatedSPDXElement: id})
+			if k.name == "deb" || k.name == "rpm" {
+				byName[p.Name] = append(byName[p.Name], id)
+			}
+		}
+	}
+
+	if o.deps != nil {
+		for _, name := range o.deps.Packages() {
+			for _, from := range byName[name] {
+				for _, dep := range o.deps.Dependencies(name) {
+					for _, to := range byName[dep] {
+						doc.Relationships = append(doc.Relationships, &Relationship{SPDXElementID: from, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: to})
+					}
+				}
+			}
+		}
+	}
+	return doc
+}
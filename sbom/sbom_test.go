@@ -0,0 +1,89 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+	"github.com/google/go-cmp/cmp"
+)
+
+func purls(d *Document) map[string]string {
+	m := map[string]string{}
+	for _, p := range d.Packages {
+		for _, r := range p.ExternalRefs {
+			m[p.SPDXID] = r.ReferenceLocator
+		}
+	}
+	return m
+}
+
+func TestNew(t *testing.T) {
+	pkgs := &packages.Packages{
+		Deb: []*packages.PkgInfo{
+			{Name: "libc6", Arch: "x86_64", Version: "2.31-0ubuntu9.7", Source: packages.Source{Name: "glibc", Version: "2.31-0ubuntu9.7"}},
+			{Name: "curl", Arch: "x86_64", Version: "7.68.0-1", Source: packages.Source{Name: "curl", Version: "7.68.0-1"}},
+		},
+		Rpm: []*packages.PkgInfo{{Name: "openssl", Arch: "x86_64", Version: "1:3.0.7-6.el9", Epoch: "1"}},
+		Pip: []*packages.PkgInfo{{Name: "PyYAML", Version: "6.0"}},
+		WUA: []*packages.WUAPackage{{Title: "update"}},
+	}
+	g := &packages.DepGraph{}
+	if err := json.Unmarshal([]byte(`{"curl":["libc6"],"libc6":[]}`), g); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	d := New("host1", pkgs, Distro("ubuntu"), Created(created), Dependencies(g))
+
+	if d.SPDXVersion != "SPDX-2.3" || d.DocumentNamespace != "https://spdx.org/spdxdocs/osconfig/host1-2024-05-01T12:00:00Z" || d.CreationInfo.Created != "2024-05-01T12:00:00Z" {
+		t.Errorf("unexpected document header: %+v %+v", d, d.CreationInfo)
+	}
+
+	wantPURLs := map[string]string{
+		"SPDXRef-Package-deb-0": "pkg:deb/ubuntu/libc6@2.31-0ubuntu9.7?arch=x86_64",
+		"SPDXRef-Package-deb-1": "pkg:deb/ubuntu/curl@7.68.0-1?arch=x86_64",
+		"SPDXRef-Package-rpm-0": "pkg:rpm/ubuntu/openssl@3.0.7-6.el9?arch=x86_64&epoch=1",
+		"SPDXRef-Package-pip-0": "pkg:pypi/pyyaml@6.0",
+	}
+	if diff := cmp.Diff(wantPURLs, purls(d)); diff != "" {
+		t.Errorf("PURLs mismatch (-want +got):\n%s", diff)
+	}
+	if got := d.Packages[1].SourceInfo; got != "built from source package glibc 2.31-0ubuntu9.7" {
+		t.Errorf("libc6 SourceInfo = %q", got)
+	}
+	if got := d.Packages[2].SourceInfo; got != "" {
+		t.Errorf("curl SourceInfo = %q, want none for a package built from its own source", got)
+	}
+
+	wantRels := []*Relationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-System"},
+		{SPDXElementID: "SPDXRef-System", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-deb-0"},
+		{SPDXElementID: "SPDXRef-System", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-deb-1"},
+		{SPDXElementID: "SPDXRef-System", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-rpm-0"},
+		{SPDXElementID: "SPDXRef-System", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-pip-0"},
+		{SPDXElementID: "SPDXRef-Package-deb-1", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-deb-0"},
+	}
+	if diff := cmp.Diff(wantRels, d.Relationships); diff != "" {
+		t.Errorf("Relationships mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := json.Marshal(d); err != nil {
+		t.Errorf("json.Marshal: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultScheduleAction   = "inventory"
+	defaultScheduleInterval = time.Hour
+	defaultScheduleSplay    = 10 * time.Minute
+)
+
+// scheduleActions are the actions that do their work once and exit, the
+// ones a schedule can run.
+var scheduleActions = map[string]bool{
+	"inventory":     true,
+	"osinventory":   true,
+	"gp":            true,
+	"policies":      true,
+	"guestpolicies": true,
+	"ospackage":     true,
+}
+
+// schedule runs the agent in a one-shot mode on an interval, for
+// deployments without the resident agent service.
+type schedule struct {
+	// Exe is the agent binary to run, with Action as its argument.
+	Exe      string
+	Action   string
+	Interval time.Duration
+	// Splay is the maximum random delay added to each run so a fleet does
+	// not run in lockstep.
+	Splay time.Duration
+}
+
+// parseSchedule parses the arguments of "schedule install":
+// [action [interval [splay]]].
+func parseSchedule(args []string) (*schedule, error) {
+	s := &schedule{Action: defaultScheduleAction, Interval: defaultScheduleInterval, Splay: defaultScheduleSplay}
+	if len(args) > 3 {
+		return nil, fmt.Errorf("too many arguments %q", args)
+	}
+	if len(args) > 0 && args[0] != "" {
+		if !scheduleActions[args[0]] {
+			return nil, fmt.Errorf("action %q can not be scheduled, it does not run once and exit", args[0])
+		}
+		s.Action = args[0]
+	}
+	var err error
+	if len(args) > 1 {
+		if s.Interval, err = time.ParseDuration(args[1]); err != nil {
+			return nil, fmt.Errorf("invalid schedule interval %q: %v", args[1], err)
+		}
+		if s.Interval < time.Minute {
+			return nil, fmt.Errorf("schedule interval %s is shorter than a minute", s.Interval)
+		}
+	}
+	if len(args) > 2 {
+		if s.Splay, err = time.ParseDuration(args[2]); err != nil {
+			return nil, fmt.Errorf("invalid schedule splay %q: %v", args[2], err)
+		}
+		if s.Splay < 0 {
+			return nil, fmt.Errorf("schedule splay %s is negative", s.Splay)
+		}
+	}
+	if s.Exe, err = os.Executable(); err != nil {
+		return nil, fmt.Errorf("error finding the agent binary: %v", err)
+	}
+	return s, nil
+}
+
+func runSchedule(op string, args []string) error {
+	switch op {
+	case "install":
+		s, err := parseSchedule(args)
+		if err != nil {
+			return err
+		}
+		if err := installSchedule(s); err != nil {
+			return err
+		}
+		fmt.Printf("Scheduled %q every %s with up to %s splay.\n", s.Action, s.Interval, s.Splay)
+		return nil
+	case "remove":
+		if err := removeSchedule(); err != nil {
+			return err
+		}
+		fmt.Println("Removed the schedule.")
+		return nil
+	}
+	return fmt.Errorf("usage: schedule install [action [interval [splay]]] | schedule remove, schedulable actions: inventory, policies")
+}
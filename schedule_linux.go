@@ -0,0 +1,98 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const scheduleUnit = "google-osconfig-agent-oneshot"
+
+var systemdUnitDir = "/etc/systemd/system"
+
+func systemdSeconds(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
+
+func (s *schedule) systemdService() string {
+	return fmt.Sprintf(`[Unit]
+Description=Google OSConfig Agent %[1]s run
+After=local-fs.target network-online.target
+Wants=local-fs.target network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%[2]s %[1]s
+`, s.Action, s.Exe)
+}
+
+func (s *schedule) systemdTimer() string {
+	return fmt.Sprintf(`[Unit]
+Description=Google OSConfig Agent %s schedule
+
+[Timer]
+OnBootSec=%s
+OnUnitActiveSec=%s
+RandomizedDelaySec=%s
+
+[Install]
+WantedBy=timers.target
+`, s.Action, systemdSeconds(defaultScheduleSplay), systemdSeconds(s.Interval), systemdSeconds(s.Splay))
+}
+
+// systemctl runs systemctl with args, replaced in tests.
+var systemctl = func(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %q failed: %v, output: %q", args, err, out)
+	}
+	return nil
+}
+
+// installSchedule writes a systemd service and timer running the one-shot
+// mode and starts the timer.
+func installSchedule(s *schedule) error {
+	units := map[string]string{
+		scheduleUnit + ".service": s.systemdService(),
+		scheduleUnit + ".timer":   s.systemdTimer(),
+	}
+	for name, content := range units {
+		if err := ioutil.WriteFile(filepath.Join(systemdUnitDir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", scheduleUnit+".timer")
+}
+
+// removeSchedule stops the timer and removes the units.
+func removeSchedule() error {
+	if err := systemctl("disable", "--now", scheduleUnit+".timer"); err != nil {
+		return err
+	}
+	for _, name := range []string{scheduleUnit + ".timer", scheduleUnit + ".service"} {
+		if err := os.Remove(filepath.Join(systemdUnitDir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return systemctl("daemon-reload")
+}
@@ -0,0 +1,97 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeSystemctl(t *testing.T, err error) *[][]string {
+	oldSystemctl, oldDir := systemctl, systemdUnitDir
+	t.Cleanup(func() { systemctl, systemdUnitDir = oldSystemctl, oldDir })
+	systemdUnitDir = t.TempDir()
+	var calls [][]string
+	systemctl = func(args ...string) error {
+		calls = append(calls, args)
+		return err
+	}
+	return &calls
+}
+
+func TestInstallSchedule(t *testing.T) {
+	calls := fakeSystemctl(t, nil)
+	s := &schedule{Exe: "/usr/bin/google_osconfig_agent", Action: "policies", Interval: 30 * time.Minute, Splay: 5 * time.Minute}
+
+	if err := installSchedule(s); err != nil {
+		t.Fatalf("installSchedule: %v", err)
+	}
+	for name, want := range map[string][]string{
+		scheduleUnit + ".service": {"Type=oneshot", "ExecStart=/usr/bin/google_osconfig_agent policies"},
+		scheduleUnit + ".timer":   {"OnBootSec=600s", "OnUnitActiveSec=1800s", "RandomizedDelaySec=300s", "WantedBy=timers.target"},
+	} {
+		data, err := os.ReadFile(filepath.Join(systemdUnitDir, name))
+		if err != nil {
+			t.Fatalf("error reading %s: %v", name, err)
+		}
+		for _, line := range want {
+			if !strings.Contains(string(data), line+"\n") {
+				t.Errorf("%s does not contain %q:\n%s", name, line, data)
+			}
+		}
+	}
+	want := [][]string{{"daemon-reload"}, {"enable", "--now", scheduleUnit + ".timer"}}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("systemctl calls = %q, want %q", *calls, want)
+	}
+}
+
+func TestRemoveSchedule(t *testing.T) {
+	calls := fakeSystemctl(t, nil)
+	if err := installSchedule(&schedule{Exe: "/agent", Action: "inventory", Interval: time.Hour}); err != nil {
+		t.Fatalf("installSchedule: %v", err)
+	}
+	*calls = nil
+
+	if err := removeSchedule(); err != nil {
+		t.Fatalf("removeSchedule: %v", err)
+	}
+	for _, name := range []string{scheduleUnit + ".service", scheduleUnit + ".timer"} {
+		if _, err := os.Stat(filepath.Join(systemdUnitDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed, stat error: %v", name, err)
+		}
+	}
+	want := [][]string{{"disable", "--now", scheduleUnit + ".timer"}, {"daemon-reload"}}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("systemctl calls = %q, want %q", *calls, want)
+	}
+
+	// Removing again is fine, the units are already gone.
+	if err := removeSchedule(); err != nil {
+		t.Errorf("removeSchedule without units: %v", err)
+	}
+}
+
+func TestRemoveScheduleSystemctlError(t *testing.T) {
+	fakeSystemctl(t, errors.New("unit not loaded"))
+	if err := removeSchedule(); err == nil {
+		t.Error("removeSchedule succeeded, want the systemctl error")
+	}
+}
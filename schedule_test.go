@@ -0,0 +1,55 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    schedule
+		wantErr bool
+	}{
+		{"Defaults", nil, schedule{Action: "inventory", Interval: time.Hour, Splay: 10 * time.Minute}, false},
+		{"All", []string{"policies", "30m", "0s"}, schedule{Action: "policies", Interval: 30 * time.Minute}, false},
+		{"UnknownAction", []string{"patch"}, schedule{}, true},
+		{"InvalidInterval", []string{"inventory", "hourly"}, schedule{}, true},
+		{"ShortInterval", []string{"inventory", "30s"}, schedule{}, true},
+		{"NegativeSplay", []string{"inventory", "1h", "-1m"}, schedule{}, true},
+		{"TooManyArgs", []string{"inventory", "1h", "1m", "x"}, schedule{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSchedule(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule(%q) error = %v, wantErr %t", tt.args, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Exe == "" {
+				t.Errorf("parseSchedule(%q) did not set the agent binary", tt.args)
+			}
+			got.Exe = ""
+			if *got != tt.want {
+				t.Errorf("parseSchedule(%q) = %+v, want %+v", tt.args, *got, tt.want)
+			}
+		})
+	}
+}
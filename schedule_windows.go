@@ -0,0 +1,119 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+	"unicode/utf16"
+)
+
+const scheduleTaskName = `\Google\OSConfig Agent one-shot`
+
+func isoDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int64(d/time.Second))
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// taskXML is the Task Scheduler definition, repeating the run every
+// Interval indefinitely as the SYSTEM account.
+func (s *schedule) taskXML(start time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>Google OSConfig Agent %[1]s run</Description>
+  </RegistrationInfo>
+  <Triggers>
+    <TimeTrigger>
+      <StartBoundary>%[2]s</StartBoundary>
+      <Repetition>
+        <Interval>%[3]s</Interval>
+      </Repetition>
+      <RandomDelay>%[4]s</RandomDelay>
+      <Enabled>true</Enabled>
+    </TimeTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <UserId>S-1-5-18</UserId>
+      <RunLevel>HighestAvailable</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <StartWhenAvailable>true</StartWhenAvailable>
+    <ExecutionTimeLimit>PT0S</ExecutionTimeLimit>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>%[5]s</Command>
+      <Arguments>%[1]s</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`, xmlEscape(s.Action), start.Format("2006-01-02T15:04:05"), isoDuration(s.Interval), isoDuration(s.Splay), xmlEscape(s.Exe))
+}
+
+// utf16File encodes s as UTF-16LE with a byte order mark, schtasks only
+// accepts task definitions in that encoding.
+func utf16File(s string) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xFE})
+	binary.Write(&b, binary.LittleEndian, utf16.Encode([]rune(s)))
+	return b.Bytes()
+}
+
+// schtasks runs schtasks.exe with args, replaced in tests.
+var schtasks = func(args ...string) error {
+	out, err := exec.Command("schtasks.exe", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("schtasks %q failed: %v, output: %q", args, err, out)
+	}
+	return nil
+}
+
+// installSchedule creates a Scheduled Task running the one-shot mode,
+// replacing an existing one.
+func installSchedule(s *schedule) error {
+	f, err := ioutil.TempFile("", "osconfig_schedule_*.xml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(utf16File(s.taskXML(time.Now()))); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return schtasks("/Create", "/TN", scheduleTaskName, "/XML", f.Name(), "/F")
+}
+
+// removeSchedule deletes the Scheduled Task.
+func removeSchedule() error {
+	return schtasks("/Delete", "/TN", scheduleTaskName, "/F")
+}
@@ -0,0 +1,110 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+type taskDef struct {
+	Description string `xml:"RegistrationInfo>Description"`
+	Start       string `xml:"Triggers>TimeTrigger>StartBoundary"`
+	Interval    string `xml:"Triggers>TimeTrigger>Repetition>Interval"`
+	RandomDelay string `xml:"Triggers>TimeTrigger>RandomDelay"`
+	Command     string `xml:"Actions>Exec>Command"`
+	Arguments   string `xml:"Actions>Exec>Arguments"`
+}
+
+func decodeUTF16File(t *testing.T, data []byte) string {
+	t.Helper()
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xFE || len(data)%2 != 0 {
+		t.Fatalf("task definition is not UTF-16LE with a byte order mark: % x", data[:2])
+	}
+	u := make([]uint16, (len(data)-2)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[2+2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func TestTaskXML(t *testing.T) {
+	s := &schedule{Exe: `C:\Program Files\Google\OSConfig\google_osconfig_agent.exe`, Action: "inventory", Interval: time.Hour, Splay: 10 * time.Minute}
+	start := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	var got taskDef
+	// The UTF-16 encoding declaration is only for schtasks.
+	data := strings.Replace(s.taskXML(start), `encoding="UTF-16"`, `encoding="UTF-8"`, 1)
+	if err := xml.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("taskXML is not valid XML: %v\n%s", err, data)
+	}
+	want := taskDef{
+		Description: "Google OSConfig Agent inventory run",
+		Start:       "2024-05-01T12:30:00",
+		Interval:    "PT3600S",
+		RandomDelay: "PT600S",
+		Command:     s.Exe,
+		Arguments:   "inventory",
+	}
+	if got != want {
+		t.Errorf("taskXML = %+v, want %+v", got, want)
+	}
+}
+
+func TestInstallRemoveSchedule(t *testing.T) {
+	old := schtasks
+	defer func() { schtasks = old }()
+	var calls [][]string
+	var task string
+	schtasks = func(args ...string) error {
+		calls = append(calls, args)
+		if len(args) > 4 && args[3] == "/XML" {
+			data, err := os.ReadFile(args[4])
+			if err != nil {
+				t.Fatalf("error reading the task definition: %v", err)
+			}
+			task = decodeUTF16File(t, data)
+		}
+		return nil
+	}
+
+	if err := installSchedule(&schedule{Exe: `C:\agent.exe`, Action: "policies", Interval: time.Hour}); err != nil {
+		t.Fatalf("installSchedule: %v", err)
+	}
+	if err := removeSchedule(); err != nil {
+		t.Fatalf("removeSchedule: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("schtasks calls = %q, want a create and a delete", calls)
+	}
+	if want := []string{"/Create", "/TN", scheduleTaskName, "/XML", calls[0][4], "/F"}; !reflect.DeepEqual(calls[0], want) {
+		t.Errorf("create call = %q, want %q", calls[0], want)
+	}
+	if !strings.Contains(task, "<Arguments>policies</Arguments>") {
+		t.Errorf("task definition does not run the policies action:\n%s", task)
+	}
+	if _, err := os.Stat(calls[0][4]); !os.IsNotExist(err) {
+		t.Errorf("task definition file %s not removed, stat error: %v", calls[0][4], err)
+	}
+	if want := []string{"/Delete", "/TN", scheduleTaskName, "/F"}; !reflect.DeepEqual(calls[1], want) {
+		t.Errorf("delete call = %q, want %q", calls[1], want)
+	}
+}
@@ -0,0 +1,131 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package sdnotify implements the systemd service notification protocol
+// (sd_notify) used by Type=notify units. All functions are no-ops when the
+// agent is not started by systemd.
+package sdnotify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var socket = func() string { return os.Getenv("NOTIFY_SOCKET") }
+
+// Enabled reports whether systemd asked to be notified of state changes.
+func Enabled() bool {
+	return socket() != ""
+}
+
+// Notify sends the state string, one or more newline separated VAR=VALUE
+// assignments, to systemd. It returns nil without doing anything if the
+// process was not started with NOTIFY_SOCKET set.
+func Notify(state string) error {
+	addr := socket()
+	if addr == "" {
+		return nil
+	}
+	// Abstract namespace sockets are advertised with a leading '@'.
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("error connecting to systemd notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("error writing to systemd notify socket: %v", err)
+	}
+	return nil
+}
+
+// Ready tells systemd that service startup is finished.
+func Ready() error {
+	return Notify("READY=1")
+}
+
+// Stopping tells systemd that the service is beginning its shutdown.
+func Stopping() error {
+	return Notify("STOPPING=1")
+}
+
+// Status sets the free-form status shown by systemctl status.
+func Status(format string, a ...any) error {
+	return Notify("STATUS=" + strings.ReplaceAll(fmt.Sprintf(format, a...), "\n", " "))
+}
+
+// Watchdog updates the systemd watchdog timestamp.
+func Watchdog() error {
+	return Notify("WATCHDOG=1")
+}
+
+// ExtendTimeout asks systemd to extend the current start, stop or runtime
+// timeout so that it ends no earlier than d from now.
+func ExtendTimeout(d time.Duration) error {
+	return Notify(fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d", d.Microseconds()))
+}
+
+// WatchdogInterval returns how often systemd expects a watchdog ping, which is
+// half of the configured WatchdogSec, and whether the watchdog is enabled for
+// this process at all.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
+
+// KeepAlive extends the systemd timeout by d and pings the watchdog for up
+// to d, until the returned function is called or ctx is done. It is used
+// around long running operations, like package transactions, that should
+// not be interrupted by a systemd timeout. An operation that hangs for
+// longer than d still trips the watchdog.
+func KeepAlive(ctx context.Context, d time.Duration) func() {
+	if !Enabled() {
+		return func() {}
+	}
+
+	ExtendTimeout(d)
+	ctx, cancel := context.WithTimeout(ctx, d)
+	interval, ok := WatchdogInterval()
+	if !ok {
+		return cancel
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			Watchdog()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,159 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sdnotify
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "sdnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	defer func(f func() string) { socket = f }(socket)
+	socket = func() string { return addr }
+
+	tests := []struct {
+		name string
+		send func() error
+		want string
+	}{
+		{"Ready", Ready, "READY=1"},
+		{"Stopping", Stopping, "STOPPING=1"},
+		{"Watchdog", Watchdog, "WATCHDOG=1"},
+		{"Status", func() error { return Status("Running task %q.\n", "foo") }, `STATUS=Running task "foo". `},
+		{"ExtendTimeout", func() error { return ExtendTimeout(2 * time.Second) }, "EXTEND_TIMEOUT_USEC=2000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf[:n]); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyDisabled(t *testing.T) {
+	defer func(f func() string) { socket = f }(socket)
+	socket = func() string { return "" }
+
+	if Enabled() {
+		t.Errorf("Enabled() = true, want false")
+	}
+	if err := Ready(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// Should be a no-op.
+	KeepAlive(context.Background(), time.Second)()
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name   string
+		usec   string
+		pid    string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"Unset", "", "", 0, false},
+		{"Invalid", "foo", "", 0, false},
+		{"Enabled", "30000000", "", 15 * time.Second, true},
+		{"OurPID", "30000000", strconv.Itoa(os.Getpid()), 15 * time.Second, true},
+		{"OtherPID", "30000000", "1", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("WATCHDOG_USEC", tt.usec)
+			os.Setenv("WATCHDOG_PID", tt.pid)
+			defer os.Unsetenv("WATCHDOG_USEC")
+			defer os.Unsetenv("WATCHDOG_PID")
+
+			got, ok := WatchdogInterval()
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("WatchdogInterval() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+
+	addr := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	defer func(f func() string) { socket = f }(socket)
+	socket = func() string { return addr }
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	stop := KeepAlive(context.Background(), 100*time.Millisecond)
+	defer stop()
+
+	var got []string
+	buf := make([]byte, 1024)
+	for {
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			// No more pings after the keep-alive ran out.
+			break
+		}
+		got = append(got, string(buf[:n]))
+		if len(got) > 100 {
+			t.Fatal("KeepAlive did not stop pinging the watchdog after its duration")
+		}
+	}
+	if len(got) < 2 || got[0] != "EXTEND_TIMEOUT_USEC=100000" || got[1] != "WATCHDOG=1" {
+		t.Errorf("KeepAlive sent %q, want the timeout extended and watchdog pings", got)
+	}
+}
@@ -0,0 +1,106 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package services queries and changes the state of system services,
+// systemd units on Linux and services on Windows.
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned for services that do not exist.
+var ErrNotFound = errors.New("service not found")
+
+// Status is the state of a service.
+type Status struct {
+	Name string
+	// Active is set if the service is running.
+	Active bool
+	// Enabled is set if the service is started at boot.
+	Enabled bool
+	// State is the state reported by the service manager, e.g. "failed" or
+	// "stopped".
+	State string
+}
+
+// Want is the desired state of a service, nil fields are not managed.
+type Want struct {
+	Active  *bool
+	Enabled *bool
+}
+
+// Diff describes how s differs from w, it is empty if it does not.
+func (w Want) Diff(s *Status) []string {
+	var diffs []string
+	if w.Active != nil && *w.Active != s.Active {
+		diffs = append(diffs, fmt.Sprintf("service is %s", s.State))
+	}
+	if w.Enabled != nil && *w.Enabled != s.Enabled {
+		if s.Enabled {
+			diffs = append(diffs, "service is enabled")
+		} else {
+			diffs = append(diffs, "service is not enabled")
+		}
+	}
+	return diffs
+}
+
+// Assert returns an error describing how the service name differs from
+// want, nil if it does not.
+func Assert(ctx context.Context, name string, want Want) error {
+	s, err := Query(ctx, name)
+	if err != nil {
+		return err
+	}
+	if diffs := want.Diff(s); len(diffs) > 0 {
+		return fmt.Errorf("%s: %s", name, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// Ensure starts or stops and enables or disables the service name as
+// needed to match want, it returns the changes made.
+func Ensure(ctx context.Context, name string, want Want) ([]string, error) {
+	s, err := Query(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	// Enable first so a service failing to start is still started at boot.
+	if want.Enabled != nil && *want.Enabled != s.Enabled {
+		change, f := "enabled", Enable
+		if !*want.Enabled {
+			change, f = "disabled", Disable
+		}
+		if err := f(ctx, name); err != nil {
+			return changes, err
+		}
+		changes = append(changes, change)
+	}
+	if want.Active != nil && *want.Active != s.Active {
+		change, f := "started", Start
+		if !*want.Active {
+			change, f = "stopped", Stop
+		}
+		if err := f(ctx, name); err != nil {
+			return changes, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
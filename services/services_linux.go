@@ -0,0 +1,100 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+const systemctl = "/bin/systemctl"
+
+var runner = util.CommandRunner(&util.DefaultRunner{})
+
+func run(ctx context.Context, args ...string) ([]byte, error) {
+	stdout, stderr, err := runner.Run(ctx, exec.CommandContext(ctx, systemctl, args...))
+	if err != nil {
+		return stdout, fmt.Errorf("systemctl %s failed: %v, stderr: %q", strings.Join(args, " "), err, stderr)
+	}
+	return stdout, nil
+}
+
+// parseShow parses the key=value output of systemctl show.
+func parseShow(out []byte) map[string]string {
+	props := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), "="); ok {
+			props[k] = v
+		}
+	}
+	return props
+}
+
+// Query returns the status of the systemd unit name, e.g. "nginx.service"
+// or "nginx".
+func Query(ctx context.Context, name string) (*Status, error) {
+	out, err := run(ctx, "show", "--property=LoadState,ActiveState,UnitFileState", name)
+	if err != nil {
+		return nil, err
+	}
+	props := parseShow(out)
+	if props["LoadState"] == "not-found" {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return &Status{
+		Name:   name,
+		Active: props["ActiveState"] == "active",
+		// Static units can't be enabled, they are started by other units.
+		Enabled: props["UnitFileState"] == "enabled" || props["UnitFileState"] == "enabled-runtime",
+		State:   props["ActiveState"],
+	}, nil
+}
+
+// Start starts the unit name.
+func Start(ctx context.Context, name string) error {
+	_, err := run(ctx, "start", name)
+	return err
+}
+
+// Stop stops the unit name.
+func Stop(ctx context.Context, name string) error {
+	_, err := run(ctx, "stop", name)
+	return err
+}
+
+// Restart restarts the unit name, starting it if it is not running.
+func Restart(ctx context.Context, name string) error {
+	_, err := run(ctx, "restart", name)
+	return err
+}
+
+// Enable enables the unit name to start at boot.
+func Enable(ctx context.Context, name string) error {
+	_, err := run(ctx, "enable", name)
+	return err
+}
+
+// Disable disables the unit name from starting at boot.
+func Disable(ctx context.Context, name string) error {
+	_, err := run(ctx, "disable", name)
+	return err
+}
@@ -0,0 +1,82 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	utilmocks "github.com/GoogleCloudPlatform/osconfig/util/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+var showArgs = []string{"show", "--property=LoadState,ActiveState,UnitFileState"}
+
+func showCmd(unit string) *exec.Cmd {
+	return exec.Command(systemctl, append(showArgs, unit)...)
+}
+
+func TestQuery(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	ctx := context.Background()
+
+	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(showCmd("nginx"))).Return([]byte("LoadState=loaded\nActiveState=failed\nUnitFileState=enabled\n"), nil, nil).Times(1)
+	mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(showCmd("missing"))).Return([]byte("LoadState=not-found\nActiveState=inactive\nUnitFileState=\n"), nil, nil).Times(1)
+
+	got, err := Query(ctx, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&Status{Name: "nginx", Enabled: true, State: "failed"}, got); diff != "" {
+		t.Errorf("Query() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := Query(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Query() of a missing unit error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCommandRunner := utilmocks.NewMockCommandRunner(mockCtrl)
+	runner = mockCommandRunner
+	ctx := context.Background()
+
+	yes, no := true, false
+	gomock.InOrder(
+		mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(showCmd("nginx"))).Return([]byte("LoadState=loaded\nActiveState=inactive\nUnitFileState=disabled\n"), nil, nil),
+		mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command(systemctl, "enable", "nginx"))).Return(nil, nil, nil),
+		mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command(systemctl, "start", "nginx"))).Return(nil, nil, nil),
+		mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(showCmd("cups"))).Return([]byte("LoadState=loaded\nActiveState=active\nUnitFileState=enabled\n"), nil, nil),
+		mockCommandRunner.EXPECT().Run(ctx, utilmocks.EqCmd(exec.Command(systemctl, "stop", "cups"))).Return(nil, []byte("denied"), errors.New("exit status 1")),
+	)
+
+	changes, err := Ensure(ctx, "nginx", Want{Active: &yes, Enabled: &yes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"enabled", "started"}, changes); diff != "" {
+		t.Errorf("Ensure() changes mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := Ensure(ctx, "cups", Want{Active: &no}); err == nil {
+		t.Error("Ensure() with a failing stop succeeded")
+	}
+}
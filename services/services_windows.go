@@ -0,0 +1,148 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// pollInterval is how often the state of a service is polled while waiting
+// for it to start or stop.
+const pollInterval = 500 * time.Millisecond
+
+var stateNames = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "start-pending",
+	svc.StopPending:     "stop-pending",
+	svc.Running:         "running",
+	svc.ContinuePending: "continue-pending",
+	svc.PausePending:    "pause-pending",
+	svc.Paused:          "paused",
+}
+
+// withService opens the service name and calls f with it.
+func withService(name string, f func(*mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+			return fmt.Errorf("%s: %w", name, ErrNotFound)
+		}
+		return fmt.Errorf("error opening service %s: %v", name, err)
+	}
+	defer s.Close()
+	return f(s)
+}
+
+// waitFor polls the service until it is in state or ctx is done.
+func waitFor(ctx context.Context, s *mgr.Service, state svc.State) error {
+	for {
+		status, err := s.Query()
+		if err != nil {
+			return err
+		}
+		if status.State == state {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("service %s is %s, waiting for it to be %s: %v", s.Name, stateNames[status.State], stateNames[state], ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Query returns the status of the service name.
+func Query(ctx context.Context, name string) (*Status, error) {
+	st := &Status{Name: name}
+	err := withService(name, func(s *mgr.Service) error {
+		status, err := s.Query()
+		if err != nil {
+			return err
+		}
+		config, err := s.Config()
+		if err != nil {
+			return err
+		}
+		st.Active = status.State == svc.Running
+		st.Enabled = config.StartType == mgr.StartAutomatic
+		st.State = stateNames[status.State]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Start starts the service name and waits for it to run.
+func Start(ctx context.Context, name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		if err := s.Start(); err != nil && err != windows.ERROR_SERVICE_ALREADY_RUNNING {
+			return fmt.Errorf("error starting service %s: %v", name, err)
+		}
+		return waitFor(ctx, s, svc.Running)
+	})
+}
+
+// Stop stops the service name and waits for it to stop.
+func Stop(ctx context.Context, name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		if _, err := s.Control(svc.Stop); err != nil && err != windows.ERROR_SERVICE_NOT_ACTIVE {
+			return fmt.Errorf("error stopping service %s: %v", name, err)
+		}
+		return waitFor(ctx, s, svc.Stopped)
+	})
+}
+
+// Restart stops the service name, if it is running, and starts it.
+func Restart(ctx context.Context, name string) error {
+	if err := Stop(ctx, name); err != nil {
+		return err
+	}
+	return Start(ctx, name)
+}
+
+func setStartType(name string, startType uint32) error {
+	return withService(name, func(s *mgr.Service) error {
+		config, err := s.Config()
+		if err != nil {
+			return err
+		}
+		config.StartType = startType
+		return s.UpdateConfig(config)
+	})
+}
+
+// Enable sets the service name to start automatically at boot.
+func Enable(ctx context.Context, name string) error {
+	return setStartType(name, mgr.StartAutomatic)
+}
+
+// Disable sets the service name to only start manually, like disabled
+// systemd units.
+func Disable(ctx context.Context, name string) error {
+	return setStartType(name, mgr.StartManual)
+}
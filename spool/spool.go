@@ -0,0 +1,182 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package spool queues reports durably on disk while they can't be sent,
+// to be replayed in order once they can.
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+const suffix = ".json"
+
+// Entry is a queued report.
+type Entry struct {
+	// Kind tells the sender how to decode Data.
+	Kind string
+	// Key deduplicates entries, a new entry replaces the queued one with the
+	// same key.
+	Key    string
+	Queued time.Time
+	Data   []byte
+
+	seq uint64
+}
+
+// Spool is a queue of entries in a directory, one file per entry named
+// after its sequence number. It is safe for concurrent use within a
+// process.
+type Spool struct {
+	dir string
+	max int
+
+	// mu guards the entry files, replayMu serializes Replay which sends
+	// without holding mu.
+	mu       sync.Mutex
+	replayMu sync.Mutex
+}
+
+// New returns the Spool in dir, keeping at most max entries, 0 for no
+// limit.
+func New(dir string, max int) *Spool {
+	return &Spool{dir: dir, max: max}
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, suffix))
+}
+
+// load returns the entries in order, dropping the ones that can't be read.
+func (s *Spool) load(ctx context.Context) ([]*Entry, error) {
+	files, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, f := range files {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), suffix), 10, 64)
+		if err != nil || !strings.HasSuffix(f.Name(), suffix) {
+			continue
+		}
+		e := &Entry{}
+		data, err := os.ReadFile(s.path(seq))
+		if err == nil {
+			err = json.Unmarshal(data, e)
+		}
+		if err != nil {
+			clog.Warningf(ctx, "Dropping unreadable spooled report %s: %v", f.Name(), err)
+			os.Remove(s.path(seq))
+			continue
+		}
+		e.seq = seq
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	return entries, nil
+}
+
+// Put queues e after the queued entries, replacing the one with the same
+// Key, and drops the oldest entries beyond the limit of the spool.
+func (s *Spool) Put(ctx context.Context, e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	var seq uint64 = 1
+	if len(entries) > 0 {
+		seq = entries[len(entries)-1].seq + 1
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := util.AtomicWrite(s.path(seq), data, 0600); err != nil {
+		return err
+	}
+
+	var kept []*Entry
+	for _, old := range entries {
+		if old.Key == e.Key {
+			os.Remove(s.path(old.seq))
+			continue
+		}
+		kept = append(kept, old)
+	}
+	for s.max > 0 && len(kept) >= s.max {
+		clog.Warningf(ctx, "Report spool is full, dropping %s report %q queued at %s.", kept[0].Kind, kept[0].Key, kept[0].Queued.Format(time.RFC3339))
+		os.Remove(s.path(kept[0].seq))
+		kept = kept[1:]
+	}
+	return nil
+}
+
+// Len returns the number of queued entries.
+func (s *Spool) Len(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load(ctx)
+	return len(entries), err
+}
+
+// Replay calls send with the queued entries in order, removing each one
+// send succeeds for. It stops at the first error, keeping that entry and
+// the ones after it, and returns the error along with the number of
+// entries sent. send should return nil for entries that can never be sent
+// so they are dropped.
+func (s *Spool) Replay(ctx context.Context, send func(context.Context, *Entry) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	entries, err := s.load(ctx)
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	for i, e := range entries {
+		if err := send(ctx, e); err != nil {
+			return i, err
+		}
+		// The entry may already have been replaced by a Put.
+		s.mu.Lock()
+		err := os.Remove(s.path(e.seq))
+		s.mu.Unlock()
+		if err != nil && !os.IsNotExist(err) {
+			return i + 1, err
+		}
+	}
+	return len(entries), nil
+}
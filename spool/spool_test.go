@@ -0,0 +1,105 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package spool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func keys(t *testing.T, s *Spool) []string {
+	t.Helper()
+	entries, err := s.load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Key+"="+string(e.Data))
+	}
+	return got
+}
+
+func TestPut(t *testing.T) {
+	ctx := context.Background()
+	s := New(filepath.Join(t.TempDir(), "spool"), 3)
+	for _, e := range []*Entry{
+		{Key: "a", Data: []byte("1")},
+		{Key: "b", Data: []byte("1")},
+		{Key: "a", Data: []byte("2")},
+	} {
+		if err := s.Put(ctx, e); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	if got, want := keys(t, s), []string{"b=1", "a=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+
+	// The oldest entries are dropped beyond the limit.
+	for _, k := range []string{"c", "d"} {
+		if err := s.Put(ctx, &Entry{Key: k, Data: []byte("1")}); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	if got, want := keys(t, s), []string{"a=2", "c=1", "d=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := New(dir, 0)
+	for _, k := range []string{"a", "b", "c"} {
+		if err := s.Put(ctx, &Entry{Kind: "test", Key: k}); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	// Unreadable entries are dropped.
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000000.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	errDown := errors.New("down")
+	n, err := s.Replay(ctx, func(ctx context.Context, e *Entry) error {
+		if e.Key == "c" {
+			return errDown
+		}
+		sent = append(sent, e.Key)
+		return nil
+	})
+	if n != 2 || err != errDown {
+		t.Errorf("Replay() = %d, %v, want 2, %v", n, err, errDown)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if l, err := s.Len(ctx); err != nil || l != 1 {
+		t.Errorf("Len() = %d, %v, want 1", l, err)
+	}
+
+	if n, err := s.Replay(ctx, func(context.Context, *Entry) error { return nil }); n != 1 || err != nil {
+		t.Errorf("Replay() = %d, %v, want 1, nil", n, err)
+	}
+	if l, err := s.Len(ctx); err != nil || l != 0 {
+		t.Errorf("Len() = %d, %v, want 0", l, err)
+	}
+}
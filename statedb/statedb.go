@@ -0,0 +1,247 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package statedb keeps a local journal of the changes the agent made to the
+// system, the packages it installed, the files it wrote and the recipes it
+// ran, with the time and the policy they came from.
+package statedb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// Kinds of the things the agent changes.
+const (
+	KindPackage    = "package"
+	KindRecipe     = "recipe"
+	KindFile       = "file"
+	KindRepository = "repository"
+	KindService    = "service"
+	KindExec       = "exec"
+)
+
+// OriginGuestPolicies is the origin of the changes made for the guest
+// policies, which are applied merged rather than one by one.
+const OriginGuestPolicies = "guest policies"
+
+// maxChanges is the number of changes the default journal keeps.
+const maxChanges = 10000
+
+// Default is the journal of the agent, in its cache directory.
+var Default = New(filepath.Join(agentconfig.CacheDir(), "osconfig_state.jsonl"), maxChanges)
+
+// Change is a change the agent made.
+type Change struct {
+	// Seq orders the changes, it is set by Record.
+	Seq  uint64
+	Time time.Time
+	// Kind is one of the Kind constants.
+	Kind string
+	// Name identifies what was changed within the kind, e.g. the package
+	// name or the file path.
+	Name string
+	// Action is what was done, e.g. "installed", "removed" or "updated".
+	Action  string
+	Version string `json:",omitempty"`
+	// Origin is the policy the change was made for.
+	Origin string `json:",omitempty"`
+}
+
+// DB is a journal of changes kept in a file, one JSON encoded change per
+// line. It is safe for concurrent use within a process.
+type DB struct {
+	path string
+	max  int
+
+	mu      sync.Mutex
+	loaded  bool
+	changes []*Change
+}
+
+// New returns the DB kept in the file path, keeping at most max changes, 0
+// for no limit.
+func New(path string, max int) *DB {
+	return &DB{path: path, max: max}
+}
+
+// load reads the file once, lines that can't be decoded are dropped.
+// db.mu must be held.
+func (db *DB) load() error {
+	if db.loaded {
+		return nil
+	}
+	data, err := os.ReadFile(db.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db.loaded = true
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var c Change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil || c.Kind == "" {
+			continue
+		}
+		db.changes = append(db.changes, &c)
+	}
+	return nil
+}
+
+// Record adds c to the journal, setting its sequence number and, if unset,
+// its time.
+func (db *DB) Record(c *Change) error {
+	if c.Kind == "" || c.Name == "" {
+		return fmt.Errorf("change needs a kind and a name")
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.load(); err != nil {
+		return err
+	}
+
+	rec := *c
+	if n := len(db.changes); n > 0 {
+		rec.Seq = db.changes[n-1].Seq
+	}
+	rec.Seq++
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	db.changes = append(db.changes, &rec)
+	c.Seq, c.Time = rec.Seq, rec.Time
+
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return err
+	}
+	// Rewrite the file without the oldest changes once it has grown past
+	// max by a tenth, appending otherwise.
+	if db.max > 0 && len(db.changes) > db.max+db.max/10 {
+		db.changes = db.changes[len(db.changes)-db.max:]
+		return db.rewrite()
+	}
+	line, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(db.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite writes all changes to the file, db.mu must be held.
+func (db *DB) rewrite() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, c := range db.changes {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return util.AtomicWrite(db.path, buf.Bytes(), 0600)
+}
+
+// Query selects changes, the zero value selects all of them.
+type Query struct {
+	Kind   string
+	Name   string
+	Origin string
+	// Since and Until bound the time of the changes, when set.
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of changes returned, 0 for no limit.
+	Limit int
+}
+
+func (q *Query) match(c *Change) bool {
+	switch {
+	case q.Kind != "" && c.Kind != q.Kind,
+		q.Name != "" && c.Name != q.Name,
+		q.Origin != "" && c.Origin != q.Origin,
+		!q.Since.IsZero() && c.Time.Before(q.Since),
+		!q.Until.IsZero() && c.Time.After(q.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns the changes selected by q, newest first.
+func (db *DB) Query(q Query) ([]*Change, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	var changes []*Change
+	for i := len(db.changes) - 1; i >= 0; i-- {
+		if !q.match(db.changes[i]) {
+			continue
+		}
+		c := *db.changes[i]
+		changes = append(changes, &c)
+		if q.Limit > 0 && len(changes) == q.Limit {
+			break
+		}
+	}
+	return changes, nil
+}
+
+// Latest returns the last change of kind to name, or nil if the agent never
+// changed it.
+func (db *DB) Latest(kind, name string) (*Change, error) {
+	changes, err := db.Query(Query{Kind: kind, Name: name, Limit: 1})
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+	return changes[0], nil
+}
+
+// Record adds c to the Default journal. Errors are logged, not returned,
+// the change was made either way.
+func Record(ctx context.Context, c *Change) {
+	if err := Default.Record(c); err != nil {
+		clog.Warningf(ctx, "Error recording %s %q in the state journal: %v", c.Kind, c.Name, err)
+	}
+}
+
+// Format returns changes as a table, one change per line.
+func Format(changes []*Change) string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tKIND\tNAME\tACTION\tVERSION\tORIGIN")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Time.Format(time.RFC3339), c.Kind, c.Name, c.Action, c.Version, c.Origin)
+	}
+	w.Flush()
+	return buf.String()
+}
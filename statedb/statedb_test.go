@@ -0,0 +1,140 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package statedb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func names(changes []*Change) []string {
+	var ns []string
+	for _, c := range changes {
+		ns = append(ns, c.Name)
+	}
+	return ns
+}
+
+func TestRecordQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	db := New(path, 0)
+	t0 := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i, c := range []*Change{
+		{Kind: KindPackage, Name: "vim", Action: "installed", Origin: "a"},
+		{Kind: KindFile, Name: "/etc/motd", Action: "updated", Origin: "b"},
+		{Kind: KindPackage, Name: "curl", Action: "installed", Origin: "b"},
+		{Kind: KindPackage, Name: "vim", Action: "removed", Origin: "a"},
+	} {
+		c.Time = t0.Add(time.Duration(i) * time.Hour)
+		if err := db.Record(c); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+		if c.Seq != uint64(i+1) {
+			t.Errorf("Seq = %d, want %d", c.Seq, i+1)
+		}
+	}
+
+	// A new DB reads the journal back.
+	db = New(path, 0)
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"all", Query{}, []string{"vim", "curl", "/etc/motd", "vim"}},
+		{"kind", Query{Kind: KindPackage}, []string{"vim", "curl", "vim"}},
+		{"origin", Query{Origin: "b"}, []string{"curl", "/etc/motd"}},
+		{"since", Query{Since: t0.Add(2 * time.Hour)}, []string{"vim", "curl"}},
+		{"until", Query{Until: t0.Add(time.Hour)}, []string{"/etc/motd", "vim"}},
+		{"limit", Query{Kind: KindPackage, Limit: 2}, []string{"vim", "curl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Query(tt.q)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if !reflect.DeepEqual(names(got), tt.want) {
+				t.Errorf("Query(%+v) = %q, want %q", tt.q, names(got), tt.want)
+			}
+		})
+	}
+
+	c, err := db.Latest(KindPackage, "vim")
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if c == nil || c.Action != "removed" || c.Seq != 4 {
+		t.Errorf("Latest(vim) = %+v, want the removal", c)
+	}
+	if c, err := db.Latest(KindPackage, "emacs"); c != nil || err != nil {
+		t.Errorf("Latest(emacs) = %+v, %v, want nil, nil", c, err)
+	}
+}
+
+func TestRecordCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	db := New(path, 10)
+	for i := 0; i < 25; i++ {
+		if err := db.Record(&Change{Kind: KindExec, Name: "e", Action: "ran"}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	changes, err := New(path, 10).Query(Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(changes) > 11 || len(changes) < 10 {
+		t.Errorf("got %d changes after compaction, want 10 or 11", len(changes))
+	}
+	if changes[0].Seq != 25 {
+		t.Errorf("newest Seq = %d, want 25", changes[0].Seq)
+	}
+}
+
+func TestLoadSkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	data := `{"Seq":1,"Kind":"package","Name":"vim","Action":"installed"}
+not json
+{"Seq":2,"Kind":"file","Name":"/etc/motd","Action":"updated"}
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db := New(path, 0)
+	if err := db.Record(&Change{Kind: KindRecipe, Name: "r", Action: "installed"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	changes, err := db.Query(Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if want := []string{"r", "/etc/motd", "vim"}; !reflect.DeepEqual(names(changes), want) {
+		t.Errorf("Query() = %q, want %q", names(changes), want)
+	}
+	if changes[0].Seq != 3 {
+		t.Errorf("Seq = %d, want 3", changes[0].Seq)
+	}
+}
+
+func TestRecordNeedsKindAndName(t *testing.T) {
+	db := New(filepath.Join(t.TempDir(), "state.jsonl"), 0)
+	if err := db.Record(&Change{Kind: KindPackage}); err == nil {
+		t.Error("Record without a name succeeded")
+	}
+}
@@ -0,0 +1,197 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tasker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+var (
+	// journalPath is where the queued persistent tasks are saved, guarded
+	// by qmx.
+	journalPath string
+	kinds       = map[string]Restorer{}
+)
+
+// Restorer recreates the function of a persistent task of its kind from
+// the data it was enqueued with.
+type Restorer func(ctx context.Context, data json.RawMessage) (func(context.Context), error)
+
+type journalEntry struct {
+	Name     string
+	Kind     string
+	Priority Priority
+	Data     json.RawMessage
+}
+
+// Persistent makes the task survive an agent restart while it is queued,
+// if a journal is set. data describes the task and must marshal to JSON,
+// the Restorer registered for kind turns it back into a task.
+func Persistent(kind string, data any) Option {
+	return func(t *task) {
+		t.kind = kind
+		t.data = data
+	}
+}
+
+// RegisterKind registers the Restorer of the persistent tasks of kind, it
+// has to be called before Restore.
+func RegisterKind(kind string, r Restorer) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	kinds[kind] = r
+}
+
+// SetJournal saves the queued persistent tasks to the file at path from now
+// on, see Restore.
+func SetJournal(path string) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	journalPath = path
+}
+
+// journalWrite is a snapshot of the queued persistent tasks, written to
+// the journal once qmx is released.
+type journalWrite struct {
+	ctx  context.Context
+	path string
+	data []byte
+	gen  uint64
+}
+
+var (
+	// journalGen numbers the snapshots, guarded by qmx.
+	journalGen uint64
+	// jmx serializes the journal writes, journalWritten is the generation
+	// of the last snapshot written, guarded by jmx.
+	jmx            sync.Mutex
+	journalWritten uint64
+)
+
+// snapshotJournal returns the queued persistent tasks to write to the
+// journal, nil if there is no journal. qmx must be held, the write itself
+// is left to write so that it does not block the queue.
+func snapshotJournal(ctx context.Context) *journalWrite {
+	if journalPath == "" {
+		return nil
+	}
+	entries := []*journalEntry{}
+	for _, t := range queue {
+		if t.kind == "" {
+			continue
+		}
+		data, err := json.Marshal(t.data)
+		if err != nil {
+			clog.Errorf(ctx, "Error saving task %q to the journal: %v", t.name, err)
+			continue
+		}
+		entries = append(entries, &journalEntry{Name: t.name, Kind: t.kind, Priority: t.priority, Data: data})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		clog.Errorf(ctx, "Error encoding task journal: %v", err)
+		return nil
+	}
+	journalGen++
+	return &journalWrite{ctx: ctx, path: journalPath, data: data, gen: journalGen}
+}
+
+// write writes the snapshot to the journal unless a newer one already was,
+// so concurrent writes never leave an older queue behind. Errors are only
+// logged, the tasks still run.
+func (w *journalWrite) write() {
+	if w == nil {
+		return
+	}
+	jmx.Lock()
+	defer jmx.Unlock()
+	if w.gen <= journalWritten {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		clog.Errorf(w.ctx, "Error writing task journal %q: %v", w.path, err)
+		return
+	}
+	if err := util.AtomicWrite(w.path, w.data, 0600); err != nil {
+		clog.Errorf(w.ctx, "Error writing task journal %q: %v", w.path, err)
+		return
+	}
+	journalWritten = w.gen
+}
+
+// Restore enqueues the persistent tasks saved in the journal, those that
+// were queued when the agent stopped. Tasks of a kind without a Restorer
+// are dropped and reported in the error.
+func Restore(ctx context.Context) error {
+	qmx.Lock()
+	path := journalPath
+	qmx.Unlock()
+	if path == "" {
+		return errors.New("no task journal set")
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []*journalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("error parsing task journal %q: %v", path, err)
+	}
+
+	var errs []string
+	for _, e := range entries {
+		qmx.Lock()
+		r, ok := kinds[e.Kind]
+		qmx.Unlock()
+		if !ok {
+			errs = append(errs, fmt.Sprintf("task %q: unknown kind %q", e.Name, e.Kind))
+			continue
+		}
+		f, err := r(ctx, e.Data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("task %q: %v", e.Name, err))
+			continue
+		}
+		clog.Infof(ctx, "Restoring task %q from the journal.", e.Name)
+		t := newTask(ctx, e.Name, e.Priority, f, []Option{Persistent(e.Kind, e.Data)})
+		if err := push(ctx, t, nil, ctx.Done()); err != nil {
+			errs = append(errs, fmt.Sprintf("task %q: %v", e.Name, err))
+		}
+	}
+	// Drop what could not be restored.
+	qmx.Lock()
+	j := snapshotJournal(ctx)
+	qmx.Unlock()
+	j.write()
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tasker
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+// jittered returns interval plus a random duration of up to jitter.
+func jittered(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// EnqueueRecurring enqueues f every interval, plus a random delay of up to
+// jitter so that many agents do not run it at the same time, until ctx is
+// done or the queue is closed. The first run is one interval from now. A run
+// is skipped if the queue is full, see SetCapacity.
+func EnqueueRecurring(ctx context.Context, name string, interval, jitter time.Duration, f func(context.Context), opts ...Option) {
+	EnqueueRecurringWithPriority(ctx, name, PriorityNormal, interval, jitter, f, opts...)
+}
+
+// EnqueueRecurringWithPriority is EnqueueRecurring with the priority of the
+// runs, see EnqueueWithPriority.
+func EnqueueRecurringWithPriority(ctx context.Context, name string, prio Priority, interval, jitter time.Duration, f func(context.Context), opts ...Option) {
+	go func() {
+		timer := time.NewTimer(jittered(interval, jitter))
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			switch err := push(ctx, newTask(ctx, name, prio, f, opts), noWait, ctx.Done()); err {
+			case nil:
+			case ErrClosed:
+				return
+			default:
+				clog.Warningf(ctx, "Skipping recurring task %q: %v", name, err)
+			}
+			timer.Reset(jittered(interval, jitter))
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tasker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var failureHandler func(name string, err error)
+
+type failureKey struct{}
+
+// failure is the error a task reported with Fail.
+type failure struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *failure) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Fail reports err as the failure of the task running with ctx, which is
+// then retried if it has attempts left, see Retry. It does nothing outside
+// of a task.
+func Fail(ctx context.Context, err error) {
+	f, ok := ctx.Value(failureKey{}).(*failure)
+	if !ok || err == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Retry runs the task up to attempts times while it fails, by panicking or
+// calling Fail. The first retry is after backoff, which doubles after each
+// one. The task keeps its worker while it waits.
+func Retry(attempts int, backoff time.Duration) Option {
+	return func(t *task) {
+		if attempts > 1 {
+			t.attempts = attempts
+		}
+		t.backoff = backoff
+	}
+}
+
+// SetFailureHandler sets the function called with the name and error of
+// the tasks that failed on their last attempt, nil removes it. It is called
+// from the worker running the task.
+func SetFailureHandler(h func(name string, err error)) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	failureHandler = h
+}
+
+func currentFailureHandler() func(string, error) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	return failureHandler
+}
@@ -0,0 +1,94 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tasker
+
+import (
+	"sort"
+	"time"
+)
+
+// Observer is notified when tasks start and finish, see SetObserver. It is
+// called from the worker running the task and must not block.
+type Observer interface {
+	// TaskStarted is called when a task starts running after being queued
+	// for wait.
+	TaskStarted(name string, wait time.Duration)
+	// TaskFinished is called when a task that was queued for wait finishes
+	// after running for run.
+	TaskFinished(name string, wait, run time.Duration)
+}
+
+// SetObserver sets the Observer notified of the tasks, nil removes it.
+func SetObserver(o Observer) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	observer = o
+}
+
+func currentObserver() Observer {
+	qmx.Lock()
+	defer qmx.Unlock()
+	return observer
+}
+
+// TaskStatus describes a queued or running task.
+type TaskStatus struct {
+	Name     string    `json:"name"`
+	Priority Priority  `json:"priority"`
+	Enqueued time.Time `json:"enqueued"`
+	// Started is zero for queued tasks.
+	Started time.Time `json:"started,omitempty"`
+	// WaitMs is how long the task was queued, RunMs how long it has been
+	// running.
+	WaitMs int64 `json:"wait_ms"`
+	RunMs  int64 `json:"run_ms"`
+}
+
+// QueueStatus is what the tasker is doing, as returned by Status.
+type QueueStatus struct {
+	// Running are the running tasks, sorted by start time.
+	Running []*TaskStatus `json:"running"`
+	// Pending are the queued tasks in the order they were enqueued.
+	Pending []*TaskStatus `json:"pending"`
+}
+
+// Status returns the running and queued tasks.
+func Status() *QueueStatus {
+	qmx.Lock()
+	defer qmx.Unlock()
+
+	now := time.Now()
+	s := &QueueStatus{Running: []*TaskStatus{}, Pending: []*TaskStatus{}}
+	for _, t := range running {
+		s.Running = append(s.Running, &TaskStatus{
+			Name:     t.name,
+			Priority: t.priority,
+			Enqueued: t.enqueued,
+			Started:  t.started,
+			WaitMs:   t.started.Sub(t.enqueued).Milliseconds(),
+			RunMs:    now.Sub(t.started).Milliseconds(),
+		})
+	}
+	sort.Slice(s.Running, func(i, j int) bool { return s.Running[i].Started.Before(s.Running[j].Started) })
+	for _, t := range queue {
+		s.Pending = append(s.Pending, &TaskStatus{
+			Name:     t.name,
+			Priority: t.priority,
+			Enqueued: t.enqueued,
+			WaitMs:   now.Sub(t.enqueued).Milliseconds(),
+		})
+	}
+	return s
+}
@@ -17,65 +17,434 @@ package tasker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/agentconfig"
 	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/sdnotify"
+)
+
+// Priority decides which of the queued tasks runs next, tasks of the same
+// priority run in the order they were enqueued.
+type Priority int
+
+// Task priorities, Enqueue uses PriorityNormal.
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+var (
+	// ErrQueueFull is returned when a task can not be enqueued because the
+	// queue is at its capacity, see SetCapacity.
+	ErrQueueFull = errors.New("task queue is full")
+	// ErrClosed is returned when a task is enqueued after Close.
+	ErrClosed = errors.New("task queue is closed")
 )
 
 var (
-	tc chan *task
 	wg sync.WaitGroup
-	mx sync.Mutex
+
+	// qmx guards the variables below.
+	qmx      sync.Mutex
+	started  bool
+	queue    []*task
+	capacity int
+	workers  = 1
+	closed   bool
+	// running are the running tasks by name.
+	running  = map[string]*task{}
+	observer Observer
+	// space is closed and replaced when a task is taken off the queue, to
+	// wake up everyone waiting for room in it.
+	space = make(chan struct{})
+	// ready is closed and replaced when a task is queued or finishes or the
+	// queue is closed, to wake up the idle workers.
+	ready = make(chan struct{})
+
+	noWait = func() <-chan time.Time {
+		c := make(chan time.Time)
+		close(c)
+		return c
+	}()
 )
 
 func initTasker(ctx context.Context) {
-	tc = make(chan *task)
-	go tasker(ctx)
+	started = true
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go tasker(ctx)
+	}
 }
 
 type task struct {
-	run  func()
-	name string
+	ctx      context.Context
+	run      func(context.Context)
+	name     string
+	priority Priority
+	timeout  time.Duration
+	pending  pendingMode
+	// attempts is at least 1, the first retry is after backoff which doubles
+	// after each one.
+	attempts int
+	backoff  time.Duration
+	// kind and data describe persistent tasks, see Persistent.
+	kind string
+	data any
+
+	enqueued, started time.Time
+}
+
+// pendingMode is what to do when a task of the same name is already queued.
+type pendingMode int
+
+const (
+	pendingAdd pendingMode = iota
+	pendingCoalesce
+	pendingReplace
+)
+
+// Option is an option for the Enqueue functions.
+type Option func(*task)
+
+// Timeout cancels the context of the task d after it starts running.
+func Timeout(d time.Duration) Option {
+	return func(t *task) {
+		t.timeout = d
+	}
+}
+
+// Coalesce drops the task if a task of the same name is already queued, and
+// not yet running, so a burst of identical tasks only runs once.
+func Coalesce() Option {
+	return func(t *task) {
+		t.pending = pendingCoalesce
+	}
+}
+
+// ReplacePending replaces a queued task of the same name, that is not yet
+// running, with the task. It keeps the place of the queued one.
+func ReplacePending() Option {
+	return func(t *task) {
+		t.pending = pendingReplace
+	}
 }
 
-// Enqueue adds a task to the task queue.
-// Calls to Enqueue after a Close will block.
-func Enqueue(ctx context.Context, name string, f func()) {
-	mx.Lock()
-	if tc == nil {
-		initTasker(ctx)
+func newTask(ctx context.Context, name string, prio Priority, f func(context.Context), opts []Option) *task {
+	ctx = clog.WithLabels(ctx, map[string]string{"task_name": name})
+	t := &task{ctx: ctx, name: name, run: f, priority: prio, attempts: 1, enqueued: time.Now()}
+	for _, opt := range opts {
+		opt(t)
 	}
-	tc <- &task{name: name, run: f}
-	mx.Unlock()
+	return t
 }
 
-// Close prevents any further tasks from being enqueued and waits for the queue to empty.
-// Subsequent calls to Close() will block.
-func Close() {
-	mx.Lock()
-	close(tc)
-	wg.Wait()
+// runOnce runs t with a context derived from the one it was enqueued with,
+// which is canceled on its timeout. It returns the error the task reported
+// with Fail or the panic it recovered from.
+func runOnce(t *task) (err error) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(t.ctx, t.timeout)
+	}
+	defer cancel()
+	f := &failure{}
+	ctx = context.WithValue(ctx, failureKey{}, f)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			clog.Errorf(t.ctx, "Task %q panicked: %v\n%s", t.name, rec, debug.Stack())
+			err = fmt.Errorf("task %q panicked: %v", t.name, rec)
+		}
+	}()
+	t.run(ctx)
+	return f.get()
+}
+
+// runTask runs t until it succeeds or runs out of attempts, see Retry.
+func runTask(t *task) {
+	backoff := t.backoff
+	for attempt := 1; ; attempt++ {
+		err := runOnce(t)
+		if err == nil {
+			return
+		}
+		if attempt >= t.attempts || t.ctx.Err() != nil {
+			clog.Errorf(t.ctx, "Task %q failed after %d attempts: %v", t.name, attempt, err)
+			if h := currentFailureHandler(); h != nil {
+				h(t.name, err)
+			}
+			return
+		}
+		clog.Warningf(t.ctx, "Task %q failed, retrying in %s: %v", t.name, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-t.ctx.Done():
+		}
+		backoff *= 2
+	}
+}
+
+func wake() {
+	qmx.Lock()
+	defer qmx.Unlock()
+	close(ready)
+	ready = make(chan struct{})
+}
+
+// SetWorkers sets the number of tasks that may run at the same time, it
+// has to be called before the first task is enqueued. Tasks of the same
+// name never run at the same time. The default is 1, tasks run one after
+// the other.
+func SetWorkers(n int) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	if n < 1 {
+		n = 1
+	}
+	workers = n
+}
+
+// SetCapacity limits the number of queued tasks, not counting the running
+// one, to n. Enqueue waits for room in the queue, TryEnqueue and
+// EnqueueWithTimeout fail with ErrQueueFull. The default of 0 is no limit.
+func SetCapacity(n int) {
+	qmx.Lock()
+	defer qmx.Unlock()
+	capacity = n
+	close(space)
+	space = make(chan struct{})
+}
+
+// pendingIndex returns the index of the queued task called name, or -1.
+func pendingIndex(name string) int {
+	for i, t := range queue {
+		if t.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// push adds t to the queue, waiting for room in it until timeout fires or
+// done is closed, it returns ctx.Err() in the latter case. A nil timeout
+// waits forever, noWait does not wait at all.
+func push(ctx context.Context, t *task, timeout <-chan time.Time, done <-chan struct{}) error {
+	for {
+		qmx.Lock()
+		if closed {
+			qmx.Unlock()
+			return ErrClosed
+		}
+		if t.pending != pendingAdd {
+			if i := pendingIndex(t.name); i >= 0 {
+				var j *journalWrite
+				if t.pending == pendingReplace {
+					old := queue[i]
+					queue[i] = t
+					if old.kind != "" || t.kind != "" {
+						j = snapshotJournal(ctx)
+					}
+				}
+				qmx.Unlock()
+				j.write()
+				return nil
+			}
+		}
+		if capacity <= 0 || len(queue) < capacity {
+			if !started {
+				initTasker(ctx)
+			}
+			queue = append(queue, t)
+			var j *journalWrite
+			if t.kind != "" {
+				j = snapshotJournal(ctx)
+			}
+			qmx.Unlock()
+			j.write()
+			wake()
+			return nil
+		}
+		wait := space
+		qmx.Unlock()
+
+		select {
+		case <-wait:
+		case <-timeout:
+			return ErrQueueFull
+		case <-done:
+			return ctx.Err()
+		}
+	}
+}
+
+// Enqueue adds a task to the task queue. The task runs with a context
+// derived from ctx, so canceling ctx, like on agent shutdown, cancels it.
+// It returns ErrClosed after a Close.
+func Enqueue(ctx context.Context, name string, f func(context.Context), opts ...Option) error {
+	return EnqueueWithPriority(ctx, name, PriorityNormal, f, opts...)
+}
+
+// EnqueueWithPriority adds a task to the task queue, it runs before any
+// queued task of a lower priority. If the queue is full it waits for room
+// in it. It returns ErrClosed after a Close, also to callers waiting for
+// room when the queue is closed.
+func EnqueueWithPriority(ctx context.Context, name string, prio Priority, f func(context.Context), opts ...Option) error {
+	return push(ctx, newTask(ctx, name, prio, f, opts), nil, nil)
+}
+
+// TryEnqueue adds a task to the task queue if there is room in it, it
+// returns ErrQueueFull if not and ErrClosed after a Close.
+func TryEnqueue(ctx context.Context, name string, f func(context.Context), opts ...Option) error {
+	return push(ctx, newTask(ctx, name, PriorityNormal, f, opts), noWait, ctx.Done())
+}
+
+// EnqueueWithTimeout adds a task to the task queue, waiting up to timeout
+// for room in it. It returns ErrQueueFull if there still is none, ctx.Err()
+// if ctx is done first and ErrClosed after a Close.
+func EnqueueWithTimeout(ctx context.Context, name string, timeout time.Duration, f func(context.Context), opts ...Option) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	return push(ctx, newTask(ctx, name, PriorityNormal, f, opts), timer.C, ctx.Done())
+}
+
+// Close prevents any further tasks from being enqueued and waits for the
+// queued and running tasks to finish, or for ctx to be done. In that case
+// the tasks still queued are dropped and returned in the error, running
+// tasks are left to finish on their own. Persistent tasks that are dropped
+// stay in the journal. Close may be called more than once.
+func Close(ctx context.Context) error {
+	qmx.Lock()
+	closed = true
+	// Wake up everyone waiting for room in the queue, they get ErrClosed.
+	close(space)
+	space = make(chan struct{})
+	qmx.Unlock()
+	wake()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	qmx.Lock()
+	dropped := queue
+	queue = nil
+	qmx.Unlock()
+	// Let idle workers see the queue is empty and exit.
+	wake()
+	if len(dropped) == 0 {
+		return nil
+	}
+	var names []string
+	for _, t := range dropped {
+		names = append(names, t.name)
+	}
+	return fmt.Errorf("closing the task queue: %v, dropped %d queued tasks: %q", ctx.Err(), len(names), names)
+}
+
+// next removes the first task of the highest priority whose name is not
+// already running from the queue. If there is none it returns a channel
+// that is closed when that may have changed, or done if the queue is empty
+// and closed.
+func next() (t *task, wait <-chan struct{}, done bool) {
+	var j *journalWrite
+	// Write the journal after qmx is released.
+	defer func() { j.write() }()
+	qmx.Lock()
+	defer qmx.Unlock()
+	i := -1
+	for j, t := range queue {
+		if running[t.name] == nil && (i < 0 || t.priority > queue[i].priority) {
+			i = j
+		}
+	}
+	if i < 0 {
+		return nil, ready, closed && len(queue) == 0
+	}
+	t = queue[i]
+	queue = append(queue[:i], queue[i+1:]...)
+	if t.kind != "" {
+		j = snapshotJournal(t.ctx)
+	}
+	t.started = time.Now()
+	running[t.name] = t
+	close(space)
+	space = make(chan struct{})
+	return t, nil, false
+}
+
+// finish marks t as no longer running.
+func finish(t *task) {
+	qmx.Lock()
+	delete(running, t.name)
+	o := observer
+	qmx.Unlock()
+	wake()
+	if o != nil {
+		o.TaskFinished(t.name, t.started.Sub(t.enqueued), time.Since(t.started))
+	}
 }
 
 func tasker(ctx context.Context) {
-	wg.Add(1)
 	defer wg.Done()
+
+	// Only ping the systemd watchdog if it is enabled for this unit. It is
+	// pinged while waiting for tasks and after each one, a task that hangs
+	// trips it unless it holds it off with sdnotify.KeepAlive.
+	var watchdog <-chan time.Time
+	interval, watchdogEnabled := sdnotify.WatchdogInterval()
+	if watchdogEnabled {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	idle := true
 	for {
-		clog.Debugf(ctx, "Waiting for tasks to run.")
-		select {
-		case t, ok := <-tc:
-			// Indicates an empty and closed channel.
-			if !ok {
-				return
+		t, wait, done := next()
+		if done {
+			return
+		}
+		if t == nil {
+			if idle {
+				clog.Debugf(ctx, "Waiting for tasks to run.")
+				sdnotify.Status("Waiting for tasks to run.")
+				idle = false
 			}
-			clog.Debugf(ctx, "Tasker running %q.", t.name)
-			t.run()
-			clog.Debugf(ctx, "Finished task %q.", t.name)
-			if agentconfig.FreeOSMemory() {
-				debug.FreeOSMemory()
+			select {
+			case <-watchdog:
+				sdnotify.Watchdog()
+			case <-wait:
 			}
+			continue
+		}
+
+		clog.Debugf(ctx, "Tasker running %q.", t.name)
+		if o := currentObserver(); o != nil {
+			o.TaskStarted(t.name, t.started.Sub(t.enqueued))
+		}
+		sdnotify.Status("Running task %q.", t.name)
+		runTask(t)
+		finish(t)
+		if watchdogEnabled {
+			sdnotify.Watchdog()
+		}
+		clog.Debugf(ctx, "Finished task %q.", t.name)
+		if agentconfig.FreeOSMemory() {
+			debug.FreeOSMemory()
 		}
+		idle = true
 	}
 }
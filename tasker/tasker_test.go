@@ -16,8 +16,16 @@ package tasker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var notes []int
@@ -25,11 +33,13 @@ var notes []int
 // TestEnqueueTaskRunSequentially to set sequential
 // execution of tasks in tasker
 func TestEnqueueTaskRunSequentially(t *testing.T) {
+	reset()
+	defer reset()
 	times := 10000
 	for i := 0; i < times; i++ {
 		addToQueue(i)
 	}
-	Close()
+	Close(context.Background())
 
 	if len(notes) != times {
 		t.Fatalf("len(notes) != times, %d != %d", len(notes), times)
@@ -42,7 +52,395 @@ func TestEnqueueTaskRunSequentially(t *testing.T) {
 }
 
 func addToQueue(i int) {
-	Enqueue(context.Background(), strconv.Itoa(i), func() {
+	Enqueue(context.Background(), strconv.Itoa(i), func(context.Context) {
 		notes = append(notes, i)
 	})
 }
+
+// reset returns the tasker to its initial state after a Close.
+func reset() {
+	// Wait for the workers of the last test to exit.
+	wg.Wait()
+	qmx.Lock()
+	defer qmx.Unlock()
+	started = false
+	queue = nil
+	capacity = 0
+	workers = 1
+	running = map[string]*task{}
+	observer = nil
+	journalPath = ""
+	kinds = map[string]Restorer{}
+	failureHandler = nil
+	closed = false
+}
+
+func TestEnqueueWithPriority(t *testing.T) {
+	reset()
+	defer reset()
+
+	var order []string
+	block := make(chan struct{})
+	Enqueue(context.Background(), "first", func(context.Context) { <-block })
+	for _, tt := range []struct {
+		name string
+		prio Priority
+	}{
+		{"low", PriorityLow},
+		{"normal1", PriorityNormal},
+		{"high1", PriorityHigh},
+		{"normal2", PriorityNormal},
+		{"high2", PriorityHigh},
+	} {
+		name := tt.name
+		EnqueueWithPriority(context.Background(), name, tt.prio, func(context.Context) { order = append(order, name) })
+	}
+	close(block)
+	Close(context.Background())
+
+	want := []string{"high1", "high2", "normal1", "normal2", "low"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("tasks ran in order %q, want %q", order, want)
+	}
+}
+
+func TestTryEnqueue(t *testing.T) {
+	reset()
+	defer reset()
+	SetCapacity(1)
+	ctx := context.Background()
+
+	block := make(chan struct{})
+	running := make(chan struct{})
+	if err := TryEnqueue(ctx, "running", func(context.Context) { close(running); <-block }); err != nil {
+		t.Fatalf("TryEnqueue(running): %v", err)
+	}
+	<-running
+	if err := TryEnqueue(ctx, "queued", func(context.Context) {}); err != nil {
+		t.Fatalf("TryEnqueue(queued): %v", err)
+	}
+	if err := TryEnqueue(ctx, "full", func(context.Context) {}); err != ErrQueueFull {
+		t.Errorf("TryEnqueue(full) = %v, want %v", err, ErrQueueFull)
+	}
+	if err := EnqueueWithTimeout(ctx, "timeout", 10*time.Millisecond, func(context.Context) {}); err != ErrQueueFull {
+		t.Errorf("EnqueueWithTimeout(timeout) = %v, want %v", err, ErrQueueFull)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := EnqueueWithTimeout(cctx, "canceled", time.Hour, func(context.Context) {}); err != context.Canceled {
+		t.Errorf("EnqueueWithTimeout(canceled) = %v, want %v", err, context.Canceled)
+	}
+
+	// Room frees up once the running task finishes and the queued one starts.
+	ran := make(chan struct{})
+	go func() { close(block) }()
+	if err := EnqueueWithTimeout(ctx, "waited", time.Minute, func(context.Context) { close(ran) }); err != nil {
+		t.Errorf("EnqueueWithTimeout(waited): %v", err)
+	}
+	<-ran
+
+	Close(context.Background())
+	if err := TryEnqueue(ctx, "closed", func(context.Context) {}); err != ErrClosed {
+		t.Errorf("TryEnqueue(closed) = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestTaskContext(t *testing.T) {
+	reset()
+	defer reset()
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	var value any
+	var deadline time.Time
+	var hasDeadline bool
+	Enqueue(ctx, "value", func(ctx context.Context) { value = ctx.Value(key{}) })
+	Enqueue(ctx, "timeout", func(ctx context.Context) { deadline, hasDeadline = ctx.Deadline() }, Timeout(time.Hour))
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	var err error
+	Enqueue(cctx, "canceled", func(ctx context.Context) { err = ctx.Err() })
+	Close(context.Background())
+
+	if value != "value" {
+		t.Errorf("task context value = %v, want the value of the enqueuing context", value)
+	}
+	if !hasDeadline || time.Until(deadline) < 59*time.Minute {
+		t.Errorf("task context deadline = %v, %v, want about an hour from now", deadline, hasDeadline)
+	}
+	if err != context.Canceled {
+		t.Errorf("task context of a canceled context: err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestEnqueueRecurring(t *testing.T) {
+	reset()
+	defer reset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan struct{}, 10)
+	EnqueueRecurring(ctx, "recurring", time.Millisecond, time.Millisecond, func(context.Context) { ran <- struct{}{} })
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ran:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("recurring task ran %d times, want 3", i)
+		}
+	}
+	cancel()
+	Close(context.Background())
+}
+
+func TestSetWorkers(t *testing.T) {
+	reset()
+	defer reset()
+	SetWorkers(2)
+	ctx := context.Background()
+
+	// The first task only finishes once the second one runs alongside it.
+	second := make(chan struct{})
+	Enqueue(ctx, "first", func(context.Context) { <-second })
+	Enqueue(ctx, "second", func(context.Context) { close(second) })
+
+	// Tasks of the same name never overlap.
+	var mu sync.Mutex
+	var active, maxActive int
+	for i := 0; i < 10; i++ {
+		Enqueue(ctx, "same", func(context.Context) {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+		})
+	}
+	Close(context.Background())
+
+	if maxActive != 1 {
+		t.Errorf("%d tasks of the same name ran at the same time, want 1", maxActive)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	reset()
+	defer reset()
+	ctx := context.Background()
+
+	var order []string
+	block := make(chan struct{})
+	firstRunning := make(chan struct{})
+	Enqueue(ctx, "report", func(context.Context) { close(firstRunning); <-block })
+	<-firstRunning
+	// The running task is not pending, this one is queued.
+	Enqueue(ctx, "report", func(context.Context) { order = append(order, "report1") }, Coalesce())
+	Enqueue(ctx, "report", func(context.Context) { order = append(order, "report2") }, Coalesce())
+	Enqueue(ctx, "other", func(context.Context) { order = append(order, "other1") })
+	Enqueue(ctx, "other", func(context.Context) { order = append(order, "other2") }, ReplacePending())
+	Enqueue(ctx, "last", func(context.Context) { order = append(order, "last") })
+	close(block)
+	Close(context.Background())
+
+	want := []string{"report1", "other2", "last"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("tasks ran in order %q, want %q", order, want)
+	}
+}
+
+type testObserver struct {
+	mu       sync.Mutex
+	started  []string
+	finished []string
+}
+
+func (o *testObserver) TaskStarted(name string, wait time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, name)
+}
+
+func (o *testObserver) TaskFinished(name string, wait, run time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, name)
+}
+
+func TestStatus(t *testing.T) {
+	reset()
+	defer reset()
+	o := &testObserver{}
+	SetObserver(o)
+	ctx := context.Background()
+
+	block := make(chan struct{})
+	firstRunning := make(chan struct{})
+	Enqueue(ctx, "first", func(context.Context) { close(firstRunning); <-block })
+	<-firstRunning
+	EnqueueWithPriority(ctx, "second", PriorityHigh, func(context.Context) {})
+
+	s := Status()
+	if len(s.Running) != 1 || s.Running[0].Name != "first" || s.Running[0].Started.IsZero() {
+		t.Errorf("Status().Running = %+v, want the first task", s.Running)
+	}
+	if len(s.Pending) != 1 || s.Pending[0].Name != "second" || s.Pending[0].Priority != PriorityHigh {
+		t.Errorf("Status().Pending = %+v, want the second task", s.Pending)
+	}
+
+	close(block)
+	Close(context.Background())
+	SetObserver(nil)
+
+	if s := Status(); len(s.Running) != 0 || len(s.Pending) != 0 {
+		t.Errorf("Status() after Close = %+v, want no tasks", s)
+	}
+	want := []string{"first", "second"}
+	if !reflect.DeepEqual(o.started, want) || !reflect.DeepEqual(o.finished, want) {
+		t.Errorf("observer saw started %q and finished %q, want %q for both", o.started, o.finished, want)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	reset()
+	defer reset()
+	journal := filepath.Join(t.TempDir(), "tasks.json")
+	SetJournal(journal)
+	ctx := context.Background()
+
+	// Stop the agent while a persistent task is queued.
+	block := make(chan struct{})
+	firstRunning := make(chan struct{})
+	Enqueue(ctx, "first", func(context.Context) { close(firstRunning); <-block })
+	<-firstRunning
+	EnqueueWithPriority(ctx, "patch", PriorityHigh, func(context.Context) {}, Persistent("patch", map[string]string{"job": "j1"}))
+	Enqueue(ctx, "unknown", func(context.Context) {}, Persistent("unknown", nil))
+	Enqueue(ctx, "not persistent", func(context.Context) {})
+	saved, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(block)
+	Close(context.Background())
+
+	reset()
+	if err := os.WriteFile(journal, saved, 0600); err != nil {
+		t.Fatal(err)
+	}
+	SetJournal(journal)
+	var job string
+	var prio Priority
+	RegisterKind("patch", func(ctx context.Context, data json.RawMessage) (func(context.Context), error) {
+		var d map[string]string
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, err
+		}
+		return func(context.Context) {
+			job = d["job"]
+			prio = Status().Running[0].Priority
+		}, nil
+	})
+	if err := Restore(ctx); err == nil || !strings.Contains(err.Error(), `unknown kind "unknown"`) {
+		t.Errorf("Restore() = %v, want an error for the unknown kind", err)
+	}
+	Close(context.Background())
+
+	if job != "j1" || prio != PriorityHigh {
+		t.Errorf("restored task ran with job %q and priority %d, want %q and %d", job, prio, "j1", PriorityHigh)
+	}
+	if got, err := os.ReadFile(journal); err != nil || string(got) != "[]" {
+		t.Errorf("journal after the restored task ran = %q, %v, want []", got, err)
+	}
+}
+
+func TestJournalWriteOrder(t *testing.T) {
+	reset()
+	defer reset()
+	journal := filepath.Join(t.TempDir(), "tasks.json")
+	SetJournal(journal)
+	ctx := context.Background()
+
+	qmx.Lock()
+	queue = []*task{{name: "patch", kind: "patch", data: "j1"}}
+	older := snapshotJournal(ctx)
+	queue = nil
+	newer := snapshotJournal(ctx)
+	qmx.Unlock()
+
+	// The snapshots are written outside of qmx, the older one losing the
+	// race must not bring back the task.
+	newer.write()
+	older.write()
+	if got, err := os.ReadFile(journal); err != nil || string(got) != "[]" {
+		t.Errorf("journal = %q, %v, want the newer snapshot []", got, err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	reset()
+	defer reset()
+	ctx := context.Background()
+	var failed []string
+	SetFailureHandler(func(name string, err error) { failed = append(failed, name+": "+err.Error()) })
+
+	var flaky, panics int
+	Enqueue(ctx, "flaky", func(ctx context.Context) {
+		flaky++
+		if flaky < 3 {
+			Fail(ctx, errors.New("try again"))
+		}
+	}, Retry(3, time.Millisecond))
+	Enqueue(ctx, "panics", func(context.Context) {
+		panics++
+		panic("boom")
+	}, Retry(2, time.Millisecond))
+	Enqueue(ctx, "fails", func(ctx context.Context) { Fail(ctx, errors.New("no network")) })
+	ran := false
+	Enqueue(ctx, "after", func(context.Context) { ran = true })
+	Close(context.Background())
+
+	if flaky != 3 || panics != 2 || !ran {
+		t.Errorf("flaky ran %d times, panics %d times and after ran: %t, want 3, 2 and true", flaky, panics, ran)
+	}
+	want := []string{`panics: task "panics" panicked: boom`, "fails: no network"}
+	if !reflect.DeepEqual(failed, want) {
+		t.Errorf("failure handler got %q, want %q", failed, want)
+	}
+}
+
+func TestClose(t *testing.T) {
+	reset()
+	defer reset()
+	SetCapacity(1)
+	ctx := context.Background()
+
+	block := make(chan struct{})
+	firstRunning := make(chan struct{})
+	Enqueue(ctx, "first", func(context.Context) { close(firstRunning); <-block })
+	<-firstRunning
+	Enqueue(ctx, "queued", func(context.Context) {})
+	// The queue is full, this waits until Close.
+	waiting := make(chan error)
+	go func() { waiting <- Enqueue(ctx, "waiting", func(context.Context) {}) }()
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := Close(cctx)
+	if err == nil || !strings.Contains(err.Error(), `dropped 1 queued tasks: ["queued"]`) {
+		t.Errorf("Close() with a canceled context = %v, want the dropped task", err)
+	}
+	if err := <-waiting; err != ErrClosed {
+		t.Errorf("waiting Enqueue() = %v, want %v", err, ErrClosed)
+	}
+	if err := Enqueue(ctx, "after", func(context.Context) {}); err != ErrClosed {
+		t.Errorf("Enqueue() after Close = %v, want %v", err, ErrClosed)
+	}
+
+	close(block)
+	if err := Close(ctx); err != nil {
+		t.Errorf("second Close() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,465 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Archive formats supported by ExtractArchive.
+const (
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// ExtractOptions constrain an ExtractArchive.
+type ExtractOptions struct {
+	// Format is one of ArchiveTar, ArchiveTarGz or ArchiveZip, detected from
+	// the content if empty.
+	Format string
+	// MaxSize is the maximum total size in bytes of the extracted files,
+	// 0 for no limit.
+	MaxSize int64
+	// MaxEntries is the maximum number of entries in the archive, 0 for no
+	// limit.
+	MaxEntries int
+	// PreserveOwner gives tar entries the uid and gid of their header, it is
+	// ignored on Windows.
+	PreserveOwner bool
+	// SpecialFiles creates the character and block devices and fifos of a
+	// tar archive instead of skipping them, not supported on Windows.
+	SpecialFiles bool
+	// AnyLinkTarget lets symlinks point anywhere, to absolute paths and
+	// outside of dest included. Entries are still never written through a
+	// symlink.
+	AnyLinkTarget bool
+	// FileMode is the permission of the zip files stored without one, 0644
+	// if 0.
+	FileMode os.FileMode
+}
+
+// detectArchiveFormat tells the format of the archive from its first bytes.
+func detectArchiveFormat(f *os.File) (string, error) {
+	magic, err := bufio.NewReader(f).Peek(4)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz, nil
+	}
+	return ArchiveTar, nil
+}
+
+// extractor writes archive entries below dest, enforcing the limits.
+type extractor struct {
+	dest    string
+	opts    *ExtractOptions
+	entries int
+	size    int64
+	// traversed are the paths the targets of the symlinks extracted so far
+	// go through, they must not become symlinks themselves.
+	traversed map[string]bool
+}
+
+func (e *extractor) within(p string) bool {
+	return p == e.dest || strings.HasPrefix(p, e.dest+string(os.PathSeparator))
+}
+
+// path returns where the entry name is extracted to, refusing names that
+// would end up outside of dest or be written through a symlink.
+func (e *extractor) path(name string) (string, error) {
+	p := filepath.Join(e.dest, name)
+	if !e.within(p) {
+		return "", fmt.Errorf("archive entry %q is outside of the destination", name)
+	}
+	rel, err := filepath.Rel(e.dest, filepath.Dir(p))
+	if err != nil || rel == "." {
+		return p, err
+	}
+	cur := e.dest
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry %q is below symlink %q", name, cur)
+		}
+	}
+	return p, nil
+}
+
+// checkLinkTarget makes sure the symlink at p pointing to target resolves
+// inside of dest. Directories are never replaced by symlinks, so walking
+// target without following the symlinks extracted so far is accurate as
+// long as it does not go through one of them, and none of the paths it goes
+// through is turned into a symlink by a later entry, e.g. "a -> b/../x"
+// followed by "b -> ..". Those paths are recorded so that symlink refuses
+// them.
+func (e *extractor) checkLinkTarget(p, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("symlink %q points to absolute path %q", p, target)
+	}
+	parts := strings.FieldsFunc(target, func(r rune) bool { return r == '/' || r == os.PathSeparator })
+	cur := filepath.Dir(p)
+	for i, part := range parts {
+		switch part {
+		case ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, part)
+			if i == len(parts)-1 {
+				break
+			}
+			if fi, err := os.Lstat(cur); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("symlink %q points through symlink %q", p, cur)
+			}
+			e.traversed[cur] = true
+		}
+		if !e.within(cur) {
+			return fmt.Errorf("symlink %q points to %q outside of the destination", p, target)
+		}
+	}
+	return nil
+}
+
+func (e *extractor) entry() error {
+	e.entries++
+	if e.opts.MaxEntries > 0 && e.entries > e.opts.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", e.opts.MaxEntries)
+	}
+	return nil
+}
+
+// replace removes what is at p, so a new file or symlink can be put there.
+// Directories are not replaced.
+func replace(p string) error {
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%q is an existing directory", p)
+	}
+	return os.Remove(p)
+}
+
+// setMetadata gives the extracted file or directory at p its permission
+// bits, the umask may have cleared some of them, and modification time.
+func setMetadata(p string, mode os.FileMode, mtime time.Time) error {
+	if err := os.Chmod(p, mode.Perm()); err != nil {
+		return err
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(p, mtime, mtime)
+}
+
+func (e *extractor) dir(name string, mode os.FileMode, mtime time.Time) (string, error) {
+	p, err := e.path(name)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Lstat(p); err == nil && !fi.IsDir() {
+		return "", fmt.Errorf("%q exists and is not a directory", p)
+	}
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return "", err
+	}
+	return p, setMetadata(p, mode, mtime)
+}
+
+// create prepares the path of the new entry name, creating its parent
+// directories and removing what was there.
+func (e *extractor) create(name string) (string, error) {
+	p, err := e.path(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	return p, replace(p)
+}
+
+func (e *extractor) file(name string, mode os.FileMode, mtime time.Time, r io.Reader) (string, error) {
+	p, err := e.create(name)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return "", err
+	}
+
+	if e.opts.MaxSize > 0 {
+		r = io.LimitReader(r, e.opts.MaxSize-e.size+1)
+	}
+	n, err := io.Copy(f, r)
+	e.size += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if e.opts.MaxSize > 0 && e.size > e.opts.MaxSize {
+		return "", fmt.Errorf("archive content is larger than %d bytes", e.opts.MaxSize)
+	}
+	return p, setMetadata(p, mode, mtime)
+}
+
+func (e *extractor) symlink(name, target string) (string, error) {
+	p, err := e.path(name)
+	if err != nil {
+		return "", err
+	}
+	if !e.opts.AnyLinkTarget {
+		if e.traversed[p] {
+			return "", fmt.Errorf("symlink %q would redirect the target of an earlier symlink", p)
+		}
+		if err := e.checkLinkTarget(p, target); err != nil {
+			return "", err
+		}
+	}
+	if p, err = e.create(name); err != nil {
+		return "", err
+	}
+	return p, os.Symlink(target, p)
+}
+
+func (e *extractor) link(name, target string) (string, error) {
+	t, err := e.path(target)
+	if err != nil {
+		return "", err
+	}
+	p, err := e.create(name)
+	if err != nil {
+		return "", err
+	}
+	return p, os.Link(t, p)
+}
+
+func (e *extractor) special(h *tar.Header) (string, error) {
+	p, err := e.create(h.Name)
+	if err != nil {
+		return "", err
+	}
+	return p, mknod(p, h)
+}
+
+func (e *extractor) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := e.entry(); err != nil {
+			return err
+		}
+		var p string
+		switch h.Typeflag {
+		case tar.TypeDir:
+			p, err = e.dir(h.Name, h.FileInfo().Mode(), h.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			p, err = e.file(h.Name, h.FileInfo().Mode(), h.ModTime, tr)
+		case tar.TypeSymlink:
+			p, err = e.symlink(h.Name, h.Linkname)
+		case tar.TypeLink:
+			p, err = e.link(h.Name, h.Linkname)
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if e.opts.SpecialFiles {
+				p, err = e.special(h)
+			}
+		default:
+			// Other entry types are not extracted.
+		}
+		if err != nil {
+			return err
+		}
+		if p != "" && e.opts.PreserveOwner && runtime.GOOS != "windows" {
+			if err := os.Lchown(p, h.Uid, h.Gid); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (e *extractor) zip(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if err := e.entry(); err != nil {
+			return err
+		}
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir() || strings.HasSuffix(zf.Name, "/"):
+			if mode.Perm() == 0 {
+				mode = 0755
+			}
+			_, err = e.dir(zf.Name, mode, zf.Modified)
+		case mode&os.ModeSymlink != 0:
+			var target []byte
+			if target, err = e.readZip(zf, 4096); err == nil {
+				_, err = e.symlink(zf.Name, string(target))
+			}
+		default:
+			if mode.Perm() == 0 {
+				mode = e.opts.FileMode
+				if mode == 0 {
+					mode = 0644
+				}
+			}
+			var r io.ReadCloser
+			if r, err = zf.Open(); err == nil {
+				_, err = e.file(zf.Name, mode, zf.Modified, r)
+				r.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) readZip(zf *zip.File, max int64) ([]byte, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, errors.New("zip symlink target is too long")
+	}
+	return data, nil
+}
+
+// ExtractArchive extracts the tar, gzip compressed tar or zip archive src
+// into the directory dest, which is created if needed. Entries that would be
+// written outside of dest, directly or through a symlink, are refused, as
+// are symlinks pointing outside of dest unless AnyLinkTarget is set and
+// archives over the limits in opts. Permission bits and modification
+// times are preserved, owners only with PreserveOwner. Existing files are
+// replaced.
+//
+// Only directories, regular files and links are extracted, and the special
+// files of tar archives with SpecialFiles.
+func ExtractArchive(src, dest string, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	format := opts.Format
+	if format == "" {
+		if format, err = detectArchiveFormat(f); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case ArchiveTar:
+		err = ExtractTar(f, dest, opts)
+	case ArchiveTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(f); err == nil {
+			err = ExtractTar(gz, dest, opts)
+		}
+	case ArchiveZip:
+		e := &extractor{dest: dest, opts: opts, traversed: map[string]bool{}}
+		err = e.zip(f)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("error extracting %q: %v", src, err)
+	}
+	return nil
+}
+
+// ExtractTar extracts the uncompressed tar stream r into the directory dest
+// like ExtractArchive, for tar archives compressed in a format ExtractArchive
+// does not know. The Format of opts is ignored.
+func ExtractTar(r io.Reader, dest string, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	e := &extractor{dest: dest, opts: opts, traversed: map[string]bool{}}
+	return e.tar(r)
+}
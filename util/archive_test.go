@@ -0,0 +1,296 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tarEntry struct {
+	name     string
+	typ      byte
+	linkname string
+	body     string
+	mode     int64
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []tarEntry) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		h := &tar.Header{Name: e.name, Typeflag: e.typ, Linkname: e.linkname, Mode: mode, Size: int64(len(e.body)), ModTime: time.Unix(1500000000, 0)}
+		if e.typ != tar.TypeReg {
+			h.Size = 0
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tarFile(t *testing.T, entries []tarEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeTar(t, f, entries)
+	return path
+}
+
+func zipFile(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExtractArchiveTarGz(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "archive.tgz")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	writeTar(t, gz, []tarEntry{
+		{name: "dir/", typ: tar.TypeDir, mode: 0750},
+		{name: "dir/script", typ: tar.TypeReg, body: "#!/bin/sh", mode: 0755},
+		{name: "file", typ: tar.TypeReg, body: "content"},
+	})
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	if err := ExtractArchive(src, dest, nil); err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dest, "file")); got != "content" {
+		t.Errorf("file content = %q, want %q", got, "content")
+	}
+	fi, err := os.Stat(filepath.Join(dest, "dir", "script"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("script modification time = %v, want %v", fi.ModTime(), time.Unix(1500000000, 0))
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0755 {
+		t.Errorf("script mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0755))
+	}
+}
+
+func TestExtractArchiveZip(t *testing.T) {
+	src := zipFile(t, map[string]string{"dir/": "", "dir/file": "content"})
+	dest := t.TempDir()
+	if err := ExtractArchive(src, dest, nil); err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dest, "dir", "file")); got != "content" {
+		t.Errorf("file content = %q, want %q", got, "content")
+	}
+}
+
+func TestExtractArchiveReplacesFiles(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "file"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := tarFile(t, []tarEntry{{name: "file", typ: tar.TypeReg, body: "new"}})
+	if err := ExtractArchive(src, dest, nil); err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dest, "file")); got != "new" {
+		t.Errorf("file content = %q, want %q", got, "new")
+	}
+}
+
+func TestExtractArchiveLimits(t *testing.T) {
+	src := tarFile(t, []tarEntry{
+		{name: "a", typ: tar.TypeReg, body: "12345"},
+		{name: "b", typ: tar.TypeReg, body: "67890"},
+	})
+	tests := []struct {
+		desc    string
+		opts    *ExtractOptions
+		wantErr string
+	}{
+		{"within limits", &ExtractOptions{MaxSize: 10, MaxEntries: 2}, ""},
+		{"too large", &ExtractOptions{MaxSize: 9}, "larger than 9 bytes"},
+		{"too many entries", &ExtractOptions{MaxEntries: 1}, "more than 1 entries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := ExtractArchive(src, t.TempDir(), tt.opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ExtractArchive: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExtractArchive error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveZipSlip(t *testing.T) {
+	tests := []struct {
+		desc string
+		src  func(t *testing.T) string
+	}{
+		{"tar", func(t *testing.T) string {
+			return tarFile(t, []tarEntry{{name: "../evil", typ: tar.TypeReg, body: "evil"}})
+		}},
+		{"tar nested", func(t *testing.T) string {
+			return tarFile(t, []tarEntry{{name: "dir/../../evil", typ: tar.TypeReg, body: "evil"}})
+		}},
+		{"tar hard link", func(t *testing.T) string {
+			return tarFile(t, []tarEntry{{name: "link", typ: tar.TypeLink, linkname: "../evil"}})
+		}},
+		{"zip", func(t *testing.T) string {
+			return zipFile(t, map[string]string{"../evil": "evil"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "dest")
+			if err := ExtractArchive(tt.src(t), dest, nil); err == nil {
+				t.Error("ExtractArchive: expected error")
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil")); !os.IsNotExist(err) {
+				t.Errorf("entry was extracted outside of the destination, Lstat: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	tests := []struct {
+		desc    string
+		entries []tarEntry
+	}{
+		{"absolute target", []tarEntry{
+			{name: "link", typ: tar.TypeSymlink, linkname: "/etc"},
+		}},
+		{"relative target", []tarEntry{
+			{name: "dir/link", typ: tar.TypeSymlink, linkname: "../../secret"},
+		}},
+		{"write through symlink", []tarEntry{
+			{name: "link", typ: tar.TypeSymlink, linkname: "."},
+			{name: "link/file", typ: tar.TypeReg, body: "evil"},
+		}},
+		{"target through symlink", []tarEntry{
+			{name: "link", typ: tar.TypeSymlink, linkname: "."},
+			{name: "escape", typ: tar.TypeSymlink, linkname: "link/../secret"},
+		}},
+		{"symlink redirecting a checked target", []tarEntry{
+			{name: "escape", typ: tar.TypeSymlink, linkname: "b/../secret"},
+			{name: "b", typ: tar.TypeSymlink, linkname: "."},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			parent := t.TempDir()
+			if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			dest := filepath.Join(parent, "dest")
+			if err := ExtractArchive(tarFile(t, tt.entries), dest, nil); err == nil {
+				t.Error("ExtractArchive: expected error")
+			}
+			if got := readFile(t, filepath.Join(parent, "secret")); got != "secret" {
+				t.Errorf("secret was overwritten with %q", got)
+			}
+			if _, err := os.ReadFile(filepath.Join(dest, "escape")); err == nil {
+				t.Error("escape symlink resolves outside of the destination")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	src := tarFile(t, []tarEntry{
+		{name: "dir/file", typ: tar.TypeReg, body: "content"},
+		{name: "dir/sub/link", typ: tar.TypeSymlink, linkname: "../file"},
+		{name: "lib", typ: tar.TypeSymlink, linkname: "dir"},
+	})
+	dest := t.TempDir()
+	if err := ExtractArchive(src, dest, nil); err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dest, "dir", "sub", "link")); got != "content" {
+		t.Errorf("link content = %q, want %q", got, "content")
+	}
+	if got := readFile(t, filepath.Join(dest, "lib", "file")); got != "content" {
+		t.Errorf("lib/file content = %q, want %q", got, "content")
+	}
+}
@@ -0,0 +1,48 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mknod creates the character or block device or fifo of the tar header h
+// at p.
+func mknod(p string, h *tar.Header) error {
+	var typ uint32
+	switch h.Typeflag {
+	case tar.TypeChar:
+		typ = unix.S_IFCHR
+	case tar.TypeBlock:
+		typ = unix.S_IFBLK
+	case tar.TypeFifo:
+		typ = unix.S_IFIFO
+	default:
+		return fmt.Errorf("archive entry %q is not a special file", h.Name)
+	}
+	perm := h.FileInfo().Mode().Perm()
+	if err := unix.Mknod(p, typ|uint32(perm), int(unix.Mkdev(uint32(h.Devmajor), uint32(h.Devminor)))); err != nil {
+		return err
+	}
+	// The umask may have cleared some of the bits.
+	return os.Chmod(p, perm)
+}
@@ -0,0 +1,76 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const selinuxXattr = "security.selinux"
+
+// preserveMetadata gives tmp the owner, group and SELinux context of path,
+// if path exists. Only root can do so in general, without the permission the
+// metadata is left as is.
+func preserveMetadata(path, tmp string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && (int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid()) {
+		if err := os.Chown(tmp, int(st.Uid), int(st.Gid)); err != nil && !errors.Is(err, unix.EPERM) {
+			return err
+		}
+	}
+
+	size, err := unix.Getxattr(path, selinuxXattr, nil)
+	if err == nil && size > 0 {
+		buf := make([]byte, size)
+		if size, err = unix.Getxattr(path, selinuxXattr, buf); err == nil {
+			err = unix.Setxattr(tmp, selinuxXattr, buf[:size], 0)
+		}
+	}
+	// No SELinux context, no xattr support or no permission to set it.
+	if err != nil && !errors.Is(err, unix.ENODATA) && !errors.Is(err, unix.ENOTSUP) && !errors.Is(err, unix.EPERM) && !errors.Is(err, unix.EACCES) {
+		return err
+	}
+	return nil
+}
+
+// syncDir syncs the directory dir, making renames in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// isCrossDevice reports whether a rename failed because the destination is
+// on another filesystem or is a mount point itself, like a file bind mounted
+// into a container.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EBUSY)
+}
@@ -0,0 +1,141 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSyncDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := syncDir(dir); err != nil {
+		t.Errorf("syncDir(%q): %v", dir, err)
+	}
+	if err := syncDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("syncDir of a missing directory succeeded")
+	}
+}
+
+func TestPreserveMetadata(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	tmp := filepath.Join(dir, "file.tmp")
+	if err := os.WriteFile(tmp, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing to keep for a new file.
+	if err := preserveMetadata(path, tmp); err != nil {
+		t.Errorf("preserveMetadata of a missing file: %v", err)
+	}
+
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of a file needs root")
+	}
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+	if err := AtomicWrite(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := fi.Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("owner after AtomicWrite = %d:%d, want 1234:5678", st.Uid, st.Gid)
+	}
+}
+
+func TestIsCrossDevice(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&os.LinkError{Op: "rename", Err: syscall.EXDEV}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.EBUSY}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.EACCES}, false},
+		{os.ErrNotExist, false},
+	}
+	for _, tt := range tests {
+		if got := isCrossDevice(tt.err); got != tt.want {
+			t.Errorf("isCrossDevice(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceFileCopyFallback(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.EXDEV, syscall.EBUSY} {
+		t.Run(errno.Error(), func(t *testing.T) {
+			defer func(r func(string, string) error) { rename = r }(rename)
+			rename = func(oldpath, newpath string) error {
+				return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errno}
+			}
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "file")
+			if err := os.WriteFile(path, []byte("old content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := AtomicWrite(path, []byte("new"), 0644); err != nil {
+				t.Fatalf("AtomicWrite: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "new" {
+				t.Errorf("content = %q, want %q", data, "new")
+			}
+			if names := dirNames(t, dir); len(names) != 1 {
+				t.Errorf("temp file left behind, directory has %q", names)
+			}
+		})
+	}
+}
+
+func TestReplaceFileRenameError(t *testing.T) {
+	defer func(r func(string, string) error) { rename = r }(rename)
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EACCES}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AtomicWrite(path, []byte("new"), 0644); err == nil {
+		t.Fatal("AtomicWrite: expected error")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "old" {
+		t.Errorf("content = %q, want it untouched", data)
+	}
+	if names := dirNames(t, dir); len(names) != 1 {
+		t.Errorf("temp file left behind, directory has %q", names)
+	}
+}
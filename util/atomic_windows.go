@@ -0,0 +1,41 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// preserveMetadata does nothing on Windows, the file ACLs are inherited from
+// the directory.
+func preserveMetadata(path, tmp string) error {
+	return nil
+}
+
+// syncDir does nothing on Windows, directories can not be synced.
+func syncDir(dir string) error {
+	return nil
+}
+
+// isCrossDevice reports whether a rename failed because the destination is
+// on another volume.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
@@ -0,0 +1,182 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+)
+
+const (
+	redacted = "<redacted>"
+	// defaultAuditMaxOutput is the number of bytes of stdout and stderr kept
+	// in an AuditRecord by default.
+	defaultAuditMaxOutput = 4096
+)
+
+// DefaultAuditRedact are the words that mark an argument as sensitive.
+var DefaultAuditRedact = []string{"password", "passwd", "token", "secret", "credential", "apikey", "api-key", "api_key"}
+
+// auditLabels mark the entries of the audit stream in the agent log.
+var auditLabels = map[string]string{"log_type": "command_audit"}
+
+// AuditRecord describes a command run by an AuditRunner, with the sensitive
+// arguments redacted.
+type AuditRecord struct {
+	Path     string
+	Args     []string
+	Dir      string `json:",omitempty"`
+	Duration string
+	ExitCode int
+	Error    string `json:",omitempty"`
+	Stdout   string `json:",omitempty"`
+	Stderr   string `json:",omitempty"`
+}
+
+// AuditRunner is a CommandRunner that logs every command run through Runner
+// with its outcome to the command audit stream, agent log entries labeled
+// log_type=command_audit.
+//
+// An argument is sensitive if it contains one of the words in
+// DefaultAuditRedact or Redact, ignoring case. The value of a sensitive
+// key=value argument is redacted, as is the argument following a sensitive
+// flag, e.g. "--token abc". Passwords in URLs are always redacted. Redacted
+// values are also removed from the logged output, unless shorter than 4
+// characters.
+type AuditRunner struct {
+	Runner CommandRunner
+	// Redact are words marking arguments as sensitive in addition to
+	// DefaultAuditRedact.
+	Redact []string
+	// MaxOutput is the number of bytes of stdout and stderr logged, 4096 if
+	// 0, none if negative.
+	MaxOutput int
+	// Sink receives the records, the agent log if nil.
+	Sink func(ctx context.Context, r *AuditRecord)
+}
+
+func (a *AuditRunner) sensitive(s string) bool {
+	s = strings.ToLower(s)
+	for _, words := range [][]string{DefaultAuditRedact, a.Redact} {
+		for _, w := range words {
+			if w != "" && strings.Contains(s, strings.ToLower(w)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sensitiveValue splits arg at the first "=" preceded by a sensitive key,
+// e.g. "--setopt=proxy_password=value".
+func (a *AuditRunner) sensitiveValue(arg string) (string, string, bool) {
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '=' && a.sensitive(arg[:i]) {
+			return arg[:i], arg[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// redactArgs returns args with the sensitive values redacted, and the
+// values.
+func (a *AuditRunner) redactArgs(args []string) ([]string, []string) {
+	var out, secrets []string
+	next := false
+	for _, arg := range args {
+		if next {
+			next = false
+			out, secrets = append(out, redacted), append(secrets, arg)
+			continue
+		}
+		if k, v, ok := a.sensitiveValue(arg); ok {
+			out, secrets = append(out, k+"="+redacted), append(secrets, v)
+			continue
+		}
+		if strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") && a.sensitive(arg) {
+			next = true
+		} else if u, err := url.Parse(arg); err == nil && u.User != nil {
+			if pass, ok := u.User.Password(); ok {
+				out, secrets = append(out, u.Redacted()), append(secrets, pass)
+				continue
+			}
+		}
+		out = append(out, arg)
+	}
+	return out, secrets
+}
+
+// redactSecrets replaces the secrets in s. Very short ones are left alone,
+// they would mostly match unrelated text.
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) >= 4 {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	return s
+}
+
+func (a *AuditRunner) output(b []byte, secrets []string) string {
+	max := a.MaxOutput
+	if max == 0 {
+		max = defaultAuditMaxOutput
+	}
+	if max < 0 {
+		return ""
+	}
+	s := redactSecrets(string(b), secrets)
+	if len(s) > max {
+		s = s[:max] + "...(truncated)"
+	}
+	return s
+}
+
+// Run runs cmd with Runner and logs it.
+func (a *AuditRunner) Run(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+	start := time.Now()
+	stdout, stderr, err := a.Runner.Run(ctx, cmd)
+
+	args, secrets := a.redactArgs(cmd.Args[1:])
+	r := &AuditRecord{
+		Path:     cmd.Path,
+		Args:     args,
+		Dir:      cmd.Dir,
+		Duration: time.Since(start).String(),
+		Stdout:   a.output(stdout, secrets),
+		Stderr:   a.output(stderr, secrets),
+	}
+	if err != nil {
+		r.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			r.ExitCode = exitErr.ExitCode()
+		}
+		r.Error = redactSecrets(err.Error(), secrets)
+	}
+
+	if a.Sink != nil {
+		a.Sink(ctx, r)
+	} else {
+		clog.InfoStructured(clog.WithLabels(ctx, auditLabels), r, "Command audit: %q %q exited with %d after %s.", r.Path, r.Args, r.ExitCode, r.Duration)
+	}
+	return stdout, stderr, err
+}
@@ -0,0 +1,107 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// Supported checksum algorithms.
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+	CRC32C = "crc32c"
+)
+
+func newHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case CRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+}
+
+// HashReader returns the hex encoded checksum of the content of r computed
+// with algo, one of SHA256, SHA512 or CRC32C.
+func HashReader(r io.Reader, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashFile returns the hex encoded checksum of the file at path computed
+// with algo, one of SHA256, SHA512 or CRC32C. The file is read in chunks, it
+// is never loaded into memory as a whole.
+func HashFile(path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f, algo)
+}
+
+// parseChecksum splits expected into algorithm and hex digest. It is either
+// of the form "algo:digest" or a bare digest, in which case the algorithm is
+// told from its length.
+func parseChecksum(expected string) (string, string, error) {
+	if algo, digest, ok := strings.Cut(expected, ":"); ok {
+		return strings.ToLower(algo), digest, nil
+	}
+	switch len(expected) {
+	case sha256.Size * 2:
+		return SHA256, expected, nil
+	case sha512.Size * 2:
+		return SHA512, expected, nil
+	case crc32.Size * 2:
+		return CRC32C, expected, nil
+	}
+	return "", "", fmt.Errorf("unable to determine the algorithm of checksum %q", expected)
+}
+
+// VerifyChecksum checks that the file at path has the expected checksum,
+// given either as "algo:digest", e.g. "sha512:9b71d2...", or as a bare hex
+// digest whose algorithm is told from its length.
+func VerifyChecksum(path, expected string) error {
+	algo, want, err := parseChecksum(expected)
+	if err != nil {
+		return err
+	}
+	got, err := HashFile(path, algo)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("got %s checksum %q for %s, expected %q", algo, got, path, want)
+	}
+	return nil
+}
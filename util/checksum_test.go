@@ -0,0 +1,135 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloSHA512 = "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"
+	helloCRC32C = "9a71bb4c"
+)
+
+func TestHashReader(t *testing.T) {
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{SHA256, helloSHA256},
+		{SHA512, helloSHA512},
+		{CRC32C, helloCRC32C},
+		{"SHA256", helloSHA256},
+	}
+	for _, tt := range tests {
+		got, err := HashReader(strings.NewReader("hello"), tt.algo)
+		if err != nil {
+			t.Fatalf("HashReader(%q): %v", tt.algo, err)
+		}
+		if got != tt.want {
+			t.Errorf("HashReader(%q) = %q, want %q", tt.algo, got, tt.want)
+		}
+	}
+
+	if _, err := HashReader(strings.NewReader("hello"), "md5"); err == nil {
+		t.Error("HashReader(md5): expected error")
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := HashFile(path, SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != helloSHA256 {
+		t.Errorf("HashFile() = %q, want %q", got, helloSHA256)
+	}
+
+	if _, err := HashFile(filepath.Join(t.TempDir(), "missing"), SHA256); err == nil {
+		t.Error("HashFile(missing): expected error")
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	tests := []struct {
+		expected   string
+		wantAlgo   string
+		wantDigest string
+		wantErr    bool
+	}{
+		{"sha256:abc", SHA256, "abc", false},
+		{"SHA512:abc", SHA512, "abc", false},
+		{"crc32c:" + helloCRC32C, CRC32C, helloCRC32C, false},
+		{helloSHA256, SHA256, helloSHA256, false},
+		{helloSHA512, SHA512, helloSHA512, false},
+		{helloCRC32C, CRC32C, helloCRC32C, false},
+		{"abc", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		algo, digest, err := parseChecksum(tt.expected)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseChecksum(%q) error = %v, wantErr %v", tt.expected, err, tt.wantErr)
+			continue
+		}
+		if algo != tt.wantAlgo || digest != tt.wantDigest {
+			t.Errorf("parseChecksum(%q) = (%q, %q), want (%q, %q)", tt.expected, algo, digest, tt.wantAlgo, tt.wantDigest)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		expected string
+		wantErr  string
+	}{
+		{"bare sha256", helloSHA256, ""},
+		{"prefixed sha512", "sha512:" + helloSHA512, ""},
+		{"bare crc32c", helloCRC32C, ""},
+		{"uppercase digest", strings.ToUpper(helloSHA256), ""},
+		{"mismatch", "sha256:" + strings.Repeat("0", 64), "got sha256 checksum"},
+		{"wrong algorithm", "sha512:" + helloSHA256, "got sha512 checksum"},
+		{"unknown algorithm", "md5:5d41402abc4b2a76b9719d911017c592", "unsupported checksum algorithm"},
+		{"unknown length", "abc", "unable to determine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := VerifyChecksum(path, tt.expected)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyChecksum(%q): %v", tt.expected, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyChecksum(%q) error = %v, want error containing %q", tt.expected, err, tt.wantErr)
+			}
+		})
+	}
+}
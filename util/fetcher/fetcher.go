@@ -0,0 +1,254 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package fetcher downloads artifacts over HTTP(S) or from GCS into place,
+// resuming interrupted downloads and verifying their checksum.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/external"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+// partSuffix is appended to the destination path for the partial download,
+// it is kept between attempts so they can resume where the last one stopped.
+const partSuffix = ".part"
+
+// defaultPolicy retries failed attempts for up to 10 minutes, each attempt
+// resumes the download.
+var defaultPolicy = retryutil.Exponential(time.Second, time.Minute).WithJitter(0.5).WithMaxElapsed(10 * time.Minute)
+
+type options struct {
+	client *http.Client
+	gcs    *storage.Client
+	proxy  *url.URL
+	policy retryutil.Policy
+	mode   os.FileMode
+}
+
+// Option configures Fetch.
+type Option func(*options)
+
+// HTTPClient sets the client used for HTTP(S) downloads, by default
+// external.HTTPClient.
+func HTTPClient(c *http.Client) Option {
+	return func(o *options) { o.client = c }
+}
+
+// StorageClient sets the client used for gs:// downloads, by default one is
+// created for each Fetch.
+func StorageClient(c *storage.Client) Option {
+	return func(o *options) { o.gcs = c }
+}
+
+// Proxy sends HTTP(S) downloads through the proxy at u instead of the one
+// of the agent config, see agentconfig.Proxy.
+func Proxy(u *url.URL) Option {
+	return func(o *options) { o.proxy = u }
+}
+
+// RetryPolicy sets how failed attempts are retried.
+func RetryPolicy(p retryutil.Policy) Option {
+	return func(o *options) { o.policy = p }
+}
+
+// Mode sets the permissions of the downloaded file, 0644 by default.
+func Mode(mode os.FileMode) Option {
+	return func(o *options) { o.mode = mode }
+}
+
+func (o *options) httpClient(ctx context.Context) *http.Client {
+	c := o.client
+	if c == nil {
+		c = external.HTTPClient(ctx)
+	}
+	if o.proxy == nil {
+		return c
+	}
+
+	proxied := *c
+	switch t := c.Transport.(type) {
+	case nil:
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.Proxy = http.ProxyURL(o.proxy)
+		proxied.Transport = tr
+	case *http.Transport:
+		tr := t.Clone()
+		tr.Proxy = http.ProxyURL(o.proxy)
+		proxied.Transport = tr
+	case *external.Transport:
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		if base, ok := t.Base.(*http.Transport); ok {
+			tr = base.Clone()
+		}
+		tr.Proxy = http.ProxyURL(o.proxy)
+		proxied.Transport = &external.Transport{Chain: t.Chain, Base: tr, Mirror: t.Mirror}
+	}
+	return &proxied
+}
+
+// Fetch downloads src to dest. src is an http://, https:// or
+// gs://bucket/object URL, a GCS object generation can be selected with a
+// "#generation" suffix. checksum is required and is checked with
+// util.VerifyChecksum before the download is renamed to dest, dest is never
+// left with partial or unverified content.
+//
+// A failed attempt is retried from where it stopped. A download whose
+// checksum does not match is discarded.
+func Fetch(ctx context.Context, src, dest, checksum string, opts ...Option) error {
+	if checksum == "" {
+		return fmt.Errorf("not fetching %q, no checksum given", src)
+	}
+	o := &options{policy: defaultPolicy, mode: 0644}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return err
+	}
+	var attempt func(ctx context.Context, w *os.File, offset int64) error
+	switch u.Scheme {
+	case "http", "https":
+		client := o.httpClient(ctx)
+		attempt = func(ctx context.Context, w *os.File, offset int64) error {
+			return fetchHTTP(ctx, client, src, w, offset)
+		}
+	case "gs":
+		if o.gcs == nil {
+			if o.gcs, err = storage.NewClient(ctx); err != nil {
+				return fmt.Errorf("error creating gcs client: %v", err)
+			}
+			defer o.gcs.Close()
+		}
+		var generation int64
+		if u.Fragment != "" {
+			if generation, err = strconv.ParseInt(u.Fragment, 10, 64); err != nil {
+				return fmt.Errorf("invalid generation in %q: %v", src, err)
+			}
+		}
+		obj := o.gcs.Bucket(u.Host).Object(strings.TrimPrefix(u.Path, "/"))
+		if generation != 0 {
+			obj = obj.Generation(generation)
+		}
+		attempt = func(ctx context.Context, w *os.File, offset int64) error {
+			r, err := obj.NewRangeReader(ctx, offset, -1)
+			if errors.Is(err, storage.ErrObjectNotExist) {
+				return retryutil.Permanent(err)
+			}
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			_, err = io.Copy(w, r)
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported URL scheme %q in %q", u.Scheme, src)
+	}
+
+	part := dest + partSuffix
+	clog.Debugf(ctx, "Fetching %q to %q.", src, dest)
+	if err := retryutil.Do(ctx, o.policy, fmt.Sprintf("fetching %q", src), func() error {
+		return resume(ctx, part, o.mode, attempt)
+	}); err != nil {
+		return err
+	}
+
+	if err := util.VerifyChecksum(part, checksum); err != nil {
+		os.Remove(part)
+		return fmt.Errorf("discarding download of %q: %v", src, err)
+	}
+	return os.Rename(part, dest)
+}
+
+// resume runs attempt appending to part, at the offset of its current size.
+func resume(ctx context.Context, part string, mode os.FileMode, attempt func(context.Context, *os.File, int64) error) error {
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, mode)
+	if err != nil {
+		return retryutil.Permanent(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return retryutil.Permanent(err)
+	}
+	if fi.Size() > 0 {
+		clog.Debugf(ctx, "Resuming download to %q at offset %d.", part, fi.Size())
+	}
+
+	err = attempt(ctx, f, fi.Size())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func fetchHTTP(ctx context.Context, client *http.Client, src string, w *os.File, offset int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return retryutil.Permanent(err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+	case resp.StatusCode == http.StatusOK && offset == 0:
+	case resp.StatusCode == http.StatusOK:
+		// The whole content, drop what was downloaded so far.
+		if err := w.Truncate(0); err != nil {
+			return retryutil.Permanent(err)
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial download is already complete, or stale. The checksum
+		// tells which, a stale one is then discarded.
+		return nil
+	default:
+		err := fmt.Errorf("got http status %d when attempting to download %q", resp.StatusCode, src)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return err
+		}
+		return retryutil.Permanent(err)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+func TestFetch(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			// Send half of the content, then drop the connection.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	policy := RetryPolicy(retryutil.Policy{Initial: time.Millisecond, MaxAttempts: 3})
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	dest := filepath.Join(dir, "artifact")
+	if err := Fetch(ctx, ts.URL, dest, checksum, HTTPClient(ts.Client()), policy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("got %d bytes, %v, want %d bytes", len(got), err, len(content))
+	}
+	want := []string{"", "bytes=5000-"}
+	if len(ranges) != 2 || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("got ranges %q, want %q", ranges, want)
+	}
+	if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial download left behind: %v", err)
+	}
+
+	dest = filepath.Join(dir, "mismatch")
+	if err := Fetch(ctx, ts.URL, dest, "sha256:"+hex.EncodeToString(make([]byte, 32)), HTTPClient(ts.Client()), policy); err == nil {
+		t.Error("expected checksum error")
+	}
+	for _, p := range []string{dest, dest + partSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s exists after checksum mismatch: %v", p, err)
+		}
+	}
+
+	if err := Fetch(ctx, ts.URL, filepath.Join(dir, "nochecksum"), "", HTTPClient(ts.Client()), policy); err == nil {
+		t.Error("expected error without checksum")
+	}
+}
+
+func TestFetchNotFound(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "artifact")
+	err := Fetch(context.Background(), ts.URL, dest, "crc32c:00000000", HTTPClient(ts.Client()), RetryPolicy(retryutil.Policy{Initial: time.Millisecond, MaxAttempts: 3}))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,141 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/clog"
+	"github.com/GoogleCloudPlatform/osconfig/retryutil"
+)
+
+// RunnerFunc is a function implementing CommandRunner.
+type RunnerFunc func(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error)
+
+// Run calls f.
+func (f RunnerFunc) Run(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+	return f(ctx, cmd)
+}
+
+// Middleware wraps a CommandRunner, adding to what it does.
+type Middleware func(CommandRunner) CommandRunner
+
+// ChainRunners wraps r in the middlewares. The first one is the outermost, it
+// sees the command first and the results last.
+func ChainRunners(r CommandRunner, middlewares ...Middleware) CommandRunner {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		r = middlewares[i](r)
+	}
+	return r
+}
+
+// Audit logs the commands to the command audit stream, see AuditRunner.
+func Audit(redact []string) Middleware {
+	return func(next CommandRunner) CommandRunner {
+		return &AuditRunner{Runner: next, Redact: redact}
+	}
+}
+
+// Observe calls f with the duration and error of each command, e.g. to
+// record metrics.
+func Observe(f CommandObserver) Middleware {
+	return func(next CommandRunner) CommandRunner {
+		return RunnerFunc(func(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+			start := time.Now()
+			stdout, stderr, err := next.Run(ctx, cmd)
+			f(ctx, cmd, time.Since(start), err)
+			return stdout, stderr, err
+		})
+	}
+}
+
+// DryRun logs the commands instead of running them, they succeed without
+// output.
+func DryRun() Middleware {
+	return func(CommandRunner) CommandRunner {
+		return RunnerFunc(func(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+			clog.Infof(ctx, "Dry run, not running %q with args %q.", cmd.Path, cmd.Args[1:])
+			return nil, nil, nil
+		})
+	}
+}
+
+// RateLimit starts the commands at least every apart, waiting as needed.
+func RateLimit(every time.Duration) Middleware {
+	return func(next CommandRunner) CommandRunner {
+		var mu sync.Mutex
+		var last time.Time
+		return RunnerFunc(func(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+			mu.Lock()
+			wait := time.Until(last.Add(every))
+			if wait < 0 {
+				wait = 0
+			}
+			last = time.Now().Add(wait)
+			mu.Unlock()
+
+			if wait > 0 {
+				t := time.NewTimer(wait)
+				defer t.Stop()
+				select {
+				case <-ctx.Done():
+					return nil, nil, ctx.Err()
+				case <-t.C:
+				}
+			}
+			return next.Run(ctx, cmd)
+		})
+	}
+}
+
+// Retry runs the commands again after they fail, as p allows. A command can
+// only be started once, so the later attempts run a copy of it as it was
+// before the first one, bound to ctx instead of its own context. A Stdin
+// reader is not rewound.
+func Retry(p retryutil.Policy) Middleware {
+	return func(next CommandRunner) CommandRunner {
+		return RunnerFunc(func(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
+			// Runners set the output of cmd, keep it as it is now.
+			orig := copyCmd(ctx, cmd)
+			var stdout, stderr []byte
+			attempt := cmd
+			err := retryutil.Do(ctx, p, fmt.Sprintf("running %q", cmd.Path), func() error {
+				var err error
+				stdout, stderr, err = next.Run(ctx, attempt)
+				attempt = copyCmd(ctx, orig)
+				return err
+			})
+			return stdout, stderr, err
+		})
+	}
+}
+
+// copyCmd returns an unstarted copy of cmd bound to ctx.
+func copyCmd(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
+	c := exec.CommandContext(ctx, cmd.Path)
+	c.Args = append([]string{}, cmd.Args...)
+	c.Env = cmd.Env
+	c.Dir = cmd.Dir
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	c.ExtraFiles = cmd.ExtraFiles
+	c.SysProcAttr = cmd.SysProcAttr
+	return c
+}
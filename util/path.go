@@ -0,0 +1,90 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	longPathPrefix = `\\?\`
+	longUNCPrefix  = `\\?\UNC\`
+	devicePrefix   = `\\.\`
+)
+
+func isLongPath(path string) bool {
+	return strings.HasPrefix(path, longPathPrefix) || strings.HasPrefix(path, devicePrefix)
+}
+
+// LongPath returns the extended-length form of the absolute windows path,
+// `\\?\C:\dir` for `C:\dir` and `\\?\UNC\server\share` for
+// `\\server\share`. Forward slashes are replaced and "." and ".." elements
+// resolved, the extended-length form does not support them. Paths already in
+// extended-length or device form are returned as is. When not running on
+// windows it just returns the input path.
+func LongPath(path string) string {
+	if runtime.GOOS != "windows" || isLongPath(path) {
+		return path
+	}
+	path = filepath.Clean(strings.ReplaceAll(path, "/", `\`))
+	if strings.HasPrefix(path, `\\`) {
+		return longUNCPrefix + path[2:]
+	}
+	return longPathPrefix + path
+}
+
+// ShortPath undoes LongPath, for APIs and tools that do not accept
+// extended-length paths.
+func ShortPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, longUNCPrefix):
+		return `\\` + path[len(longUNCPrefix):]
+	case strings.HasPrefix(path, longPathPrefix):
+		return path[len(longPathPrefix):]
+	}
+	return path
+}
+
+// ResolvePath is NormPath with symlinks, and junctions on windows, resolved.
+// Only the part of the path that exists is resolved, the rest is appended
+// as is.
+func ResolvePath(path string) (string, error) {
+	path, err := filepath.Abs(ShortPath(path))
+	if err != nil {
+		return "", err
+	}
+
+	var rest []string
+	for dir := path; ; {
+		if _, err := os.Lstat(dir); err == nil {
+			resolved, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return "", err
+			}
+			path = filepath.Join(append([]string{resolved}, rest...)...)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+	return LongPath(path), nil
+}
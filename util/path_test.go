@@ -0,0 +1,95 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestShortPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`\\?\C:\dir\file`, `C:\dir\file`},
+		{`\\?\UNC\server\share\dir`, `\\server\share\dir`},
+		{`\\.\pipe\name`, `\\.\pipe\name`},
+		{`C:\dir`, `C:\dir`},
+		{`\\server\share`, `\\server\share`},
+		{"/usr/bin", "/usr/bin"},
+	}
+	for _, tt := range tests {
+		if got := ShortPath(tt.path); got != tt.want {
+			t.Errorf("ShortPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc string
+		path string
+		want string
+	}{
+		{"no symlink", target, target},
+		{"symlink", filepath.Join(dir, "link"), target},
+		{"below symlink", filepath.Join(dir, "link", "missing", "file"), filepath.Join(target, "missing", "file")},
+		{"missing", filepath.Join(dir, "missing"), filepath.Join(dir, "missing")},
+		{"unclean", filepath.Join(dir, "link") + "/../link/./file", filepath.Join(target, "file")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := ResolvePath(tt.path)
+			if err != nil {
+				t.Fatalf("ResolvePath(%q): %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolvePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormPathRelative(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NormPath(filepath.Join("dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := LongPath(filepath.Join(wd, "dir", "file")); got != want {
+		t.Errorf("NormPath(%q) = %q, want %q", filepath.Join("dir", "file"), got, want)
+	}
+}
@@ -0,0 +1,90 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`C:\dir\file`, `\\?\C:\dir\file`},
+		{`C:/dir/file`, `\\?\C:\dir\file`},
+		{`C:\dir\..\other\.\file`, `\\?\C:\other\file`},
+		{`\\server\share\dir`, `\\?\UNC\server\share\dir`},
+		{`//server/share/dir`, `\\?\UNC\server\share\dir`},
+		{`\\server\share\dir\..\file`, `\\?\UNC\server\share\file`},
+		{`\\?\C:\dir`, `\\?\C:\dir`},
+		{`\\?\UNC\server\share`, `\\?\UNC\server\share`},
+		{`\\.\pipe\name`, `\\.\pipe\name`},
+	}
+	for _, tt := range tests {
+		if got := LongPath(tt.path); got != tt.want {
+			t.Errorf("LongPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestShortPathUndoesLongPath(t *testing.T) {
+	for _, path := range []string{`C:\dir\file`, `\\server\share\dir`} {
+		if got := ShortPath(LongPath(path)); got != path {
+			t.Errorf("ShortPath(LongPath(%q)) = %q", path, got)
+		}
+	}
+}
+
+func TestNormPathWindows(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drive := filepath.VolumeName(wd)
+
+	tests := []struct {
+		desc string
+		path string
+		want string
+	}{
+		{"absolute", `C:\dir\file`, `\\?\C:\dir\file`},
+		{"UNC", `\\server\share\file`, `\\?\UNC\server\share\file`},
+		{"extended-length", `\\?\C:\dir`, `\\?\C:\dir`},
+		{"device", `\\.\pipe\name`, `\\.\pipe\name`},
+		{"relative", `dir\file`, `\\?\` + filepath.Join(wd, "dir", "file")},
+		// A drive-relative path is relative to the working directory of
+		// its drive, the current one here.
+		{"drive-relative", drive + `dir\file`, `\\?\` + filepath.Join(wd, "dir", "file")},
+		{"rooted", `\dir\file`, `\\?\` + drive + `\dir\file`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := NormPath(tt.path)
+			if err != nil {
+				t.Fatalf("NormPath(%q): %v", tt.path, err)
+			}
+			if !strings.EqualFold(got, tt.want) {
+				t.Errorf("NormPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
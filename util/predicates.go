@@ -0,0 +1,71 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"os"
+	"os/user"
+)
+
+// stat is os.Stat returning a nil FileInfo and no error for a missing path.
+func stat(path string) (os.FileInfo, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return fi, err
+}
+
+// IsFile reports whether path is a regular file, following symlinks. Unlike
+// Exists it tells a missing path, false without error, from one that could
+// not be checked, like one in a directory without search permission.
+func IsFile(path string) (bool, error) {
+	fi, err := stat(path)
+	if fi == nil {
+		return false, err
+	}
+	return fi.Mode().IsRegular(), nil
+}
+
+// IsDir reports whether path is a directory, following symlinks, see IsFile.
+func IsDir(path string) (bool, error) {
+	fi, err := stat(path)
+	if fi == nil {
+		return false, err
+	}
+	return fi.IsDir(), nil
+}
+
+// IsExecutable reports whether path is a regular file that can be executed,
+// one with an executable bit set or, on Windows, an extension listed in
+// PATHEXT. See IsFile for the errors.
+func IsExecutable(path string) (bool, error) {
+	fi, err := stat(path)
+	if fi == nil || !fi.Mode().IsRegular() {
+		return false, err
+	}
+	return isExecutable(path, fi), nil
+}
+
+// IsWritableBy reports whether u may write to path according to its
+// permission bits, root may write to anything. On Windows only the read-only
+// attribute is checked, ACLs are not. See IsFile for the errors.
+func IsWritableBy(path string, u *user.User) (bool, error) {
+	fi, err := stat(path)
+	if fi == nil {
+		return false, err
+	}
+	return isWritableBy(fi, u)
+}
@@ -0,0 +1,68 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsFileIsDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		path     string
+		wantFile bool
+		wantDir  bool
+	}{
+		{"file", file, true, false},
+		{"dir", dir, false, true},
+		{"missing", filepath.Join(dir, "missing"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			isFile, err := IsFile(tt.path)
+			if err != nil {
+				t.Errorf("IsFile(%q): %v", tt.path, err)
+			}
+			if isFile != tt.wantFile {
+				t.Errorf("IsFile(%q) = %t, want %t", tt.path, isFile, tt.wantFile)
+			}
+			isDir, err := IsDir(tt.path)
+			if err != nil {
+				t.Errorf("IsDir(%q): %v", tt.path, err)
+			}
+			if isDir != tt.wantDir {
+				t.Errorf("IsDir(%q) = %t, want %t", tt.path, isDir, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestIsExecutableDir(t *testing.T) {
+	ok, err := IsExecutable(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("IsExecutable(dir) = true, want false")
+	}
+}
@@ -0,0 +1,54 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+func isExecutable(_ string, fi os.FileInfo) bool {
+	return fi.Mode()&0111 != 0
+}
+
+func isWritableBy(fi os.FileInfo, u *user.User) (bool, error) {
+	if u.Uid == "0" {
+		return true, nil
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.Mode()&0222 != 0, nil
+	}
+	perm := fi.Mode().Perm()
+	if u.Uid == strconv.FormatUint(uint64(st.Uid), 10) {
+		return perm&0200 != 0, nil
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return false, err
+	}
+	gid := strconv.FormatUint(uint64(st.Gid), 10)
+	for _, g := range append(gids, u.Gid) {
+		if g == gid {
+			return perm&0020 != 0, nil
+		}
+	}
+	return perm&0002 != 0, nil
+}
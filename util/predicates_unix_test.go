@@ -0,0 +1,142 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsFileFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"file-link": file, "dir-link": dir, "dangling": filepath.Join(dir, "missing")} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		wantFile bool
+		wantDir  bool
+	}{
+		{"file-link", true, false},
+		{"dir-link", false, true},
+		{"dangling", false, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if got, err := IsFile(path); err != nil || got != tt.wantFile {
+			t.Errorf("IsFile(%q) = %t, %v, want %t, nil", tt.name, got, err, tt.wantFile)
+		}
+		if got, err := IsDir(path); err != nil || got != tt.wantDir {
+			t.Errorf("IsDir(%q) = %t, %v, want %t, nil", tt.name, got, err, tt.wantDir)
+		}
+	}
+}
+
+func TestIsFileUncheckable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can search any directory")
+	}
+	dir := filepath.Join(t.TempDir(), "dir")
+	if err := os.Mkdir(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+	if _, err := IsFile(filepath.Join(dir, "file")); err == nil {
+		t.Error("IsFile below a directory without search permission: expected error")
+	}
+}
+
+func TestIsExecutable(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		mode os.FileMode
+		want bool
+	}{
+		{0644, false},
+		{0744, true},
+		{0654, true},
+		{0645, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.mode.String())
+		if err := os.WriteFile(path, nil, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := IsExecutable(path); err != nil || got != tt.want {
+			t.Errorf("IsExecutable(%v) = %t, %v, want %t, nil", tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsWritableBy(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("giving the test file another owner needs root")
+	}
+	owner := &user.User{Uid: "12345", Gid: "54321", Username: "osconfig-test-owner"}
+	member := &user.User{Uid: "23456", Gid: "12345", Username: "osconfig-test-member"}
+	other := &user.User{Uid: "23456", Gid: "23456", Username: "osconfig-test-other"}
+	root := &user.User{Uid: "0", Gid: "0", Username: "root"}
+
+	tests := []struct {
+		mode os.FileMode
+		u    *user.User
+		want bool
+	}{
+		{0600, owner, true},
+		{0400, owner, false},
+		{0060, owner, false},
+		{0060, member, true},
+		{0640, member, false},
+		{0606, member, false},
+		{0006, other, true},
+		{0660, other, false},
+		{0000, root, true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, "file")
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chown(path, 12345, 12345); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := IsWritableBy(path, tt.u); err != nil || got != tt.want {
+			t.Errorf("IsWritableBy(%v, %s) = %t, %v, want %t, nil", tt.mode, tt.u.Username, got, err, tt.want)
+		}
+	}
+
+	if got, err := IsWritableBy(filepath.Join(dir, "missing"), owner); err != nil || got {
+		t.Errorf("IsWritableBy(missing) = %t, %v, want false, nil", got, err)
+	}
+}
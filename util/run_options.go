@@ -0,0 +1,75 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// RunOptions constrain a command run with RunWithOptions.
+type RunOptions struct {
+	// Env is added to the environment of the agent, later values win.
+	Env []string
+	// Dir is the working directory, the one of the agent if empty.
+	Dir string
+	// User is the user to run the command as, not supported on Windows.
+	User string
+	// Nice is the niceness adjustment, 0 leaves it unchanged. Not supported
+	// on Windows.
+	Nice int
+	// IOClass is the ionice scheduling class, 1 (realtime), 2 (best-effort)
+	// or 3 (idle), 0 leaves it unchanged. Not supported on Windows.
+	IOClass int
+	// Ulimits are resource limits by prlimit resource name, e.g. "nofile"
+	// or "as". Not supported on Windows.
+	Ulimits map[string]uint64
+}
+
+// ApplyRunOptions changes cmd, which must not have been started, to run
+// with opts. The niceness, I/O class and limits are set by running the
+// command through nice, ionice and prlimit.
+func ApplyRunOptions(cmd *exec.Cmd, opts *RunOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if len(opts.Env) > 0 {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(env, opts.Env...)
+	}
+	if opts.Dir != "" {
+		cmd.Dir = opts.Dir
+	}
+	return applyPlatformRunOptions(cmd, opts)
+}
+
+// wrap makes cmd run path with args followed by the original command.
+func wrap(cmd *exec.Cmd, path string, args ...string) {
+	cmd.Args = append(append([]string{path}, args...), append([]string{cmd.Path}, cmd.Args[1:]...)...)
+	cmd.Path = path
+}
+
+// RunWithOptions is Run with the command constrained by opts, see
+// ApplyRunOptions.
+func (r *DefaultRunner) RunWithOptions(ctx context.Context, cmd *exec.Cmd, opts *RunOptions) ([]byte, []byte, error) {
+	if err := ApplyRunOptions(cmd, opts); err != nil {
+		return nil, nil, err
+	}
+	return r.Run(ctx, cmd)
+}
@@ -0,0 +1,46 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestApplyRunOptionsEnvAndDir(t *testing.T) {
+	cmd := exec.Command("cmd", "arg")
+	cmd.Env = []string{"A=1"}
+	if err := ApplyRunOptions(cmd, &RunOptions{Env: []string{"B=2", "A=3"}, Dir: "dir"}); err != nil {
+		t.Fatalf("ApplyRunOptions: %v", err)
+	}
+	if want := []string{"A=1", "B=2", "A=3"}; !reflect.DeepEqual(cmd.Env, want) {
+		t.Errorf("Env = %q, want %q", cmd.Env, want)
+	}
+	if cmd.Dir != "dir" {
+		t.Errorf("Dir = %q, want %q", cmd.Dir, "dir")
+	}
+}
+
+func TestApplyRunOptionsNil(t *testing.T) {
+	cmd := exec.Command("cmd", "arg")
+	want := append([]string(nil), cmd.Args...)
+	if err := ApplyRunOptions(cmd, nil); err != nil {
+		t.Fatalf("ApplyRunOptions: %v", err)
+	}
+	if !reflect.DeepEqual(cmd.Args, want) || cmd.Env != nil || cmd.Dir != "" {
+		t.Errorf("ApplyRunOptions(nil) changed the command: %+v", cmd)
+	}
+}
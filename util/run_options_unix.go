@@ -0,0 +1,74 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+var (
+	nice    = "/usr/bin/nice"
+	ionice  = "/usr/bin/ionice"
+	prlimit = "/usr/bin/prlimit"
+)
+
+func applyPlatformRunOptions(cmd *exec.Cmd, opts *RunOptions) error {
+	// The wrappers are applied inside out, prlimit runs first.
+	if len(opts.Ulimits) > 0 {
+		var names []string
+		for name := range opts.Ulimits {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var args []string
+		for _, name := range names {
+			args = append(args, fmt.Sprintf("--%s=%d", name, opts.Ulimits[name]))
+		}
+		wrap(cmd, prlimit, args...)
+	}
+	if opts.IOClass != 0 {
+		wrap(cmd, ionice, "-c", strconv.Itoa(opts.IOClass))
+	}
+	if opts.Nice != 0 {
+		wrap(cmd, nice, "-n", strconv.Itoa(opts.Nice))
+	}
+	if opts.User != "" {
+		u, err := user.Lookup(opts.User)
+		if err != nil {
+			return err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("user %q has a non numeric uid %q", opts.User, u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("user %q has a non numeric gid %q", opts.User, u.Gid)
+		}
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyRunOptionsWrappers(t *testing.T) {
+	cmd := exec.Command("/bin/cmd", "arg")
+	opts := &RunOptions{Nice: 10, IOClass: 3, Ulimits: map[string]uint64{"nofile": 1024, "as": 1 << 30}}
+	if err := ApplyRunOptions(cmd, opts); err != nil {
+		t.Fatalf("ApplyRunOptions: %v", err)
+	}
+	want := []string{nice, "-n", "10", ionice, "-c", "3", prlimit, "--as=1073741824", "--nofile=1024", "/bin/cmd", "arg"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Args = %q, want %q", cmd.Args, want)
+	}
+	if cmd.Path != nice {
+		t.Errorf("Path = %q, want %q", cmd.Path, nice)
+	}
+}
+
+func TestApplyRunOptionsUser(t *testing.T) {
+	cmd := exec.Command("/bin/cmd")
+	if err := ApplyRunOptions(cmd, &RunOptions{User: "root"}); err != nil {
+		t.Fatalf("ApplyRunOptions: %v", err)
+	}
+	if cred := cmd.SysProcAttr.Credential; cred == nil || cred.Uid != 0 || cred.Gid != 0 {
+		t.Errorf("Credential = %+v, want uid and gid 0", cred)
+	}
+
+	if err := ApplyRunOptions(exec.Command("/bin/cmd"), &RunOptions{User: "osconfig-test-nosuchuser"}); err == nil {
+		t.Error("ApplyRunOptions with an unknown user: expected error")
+	}
+}
+
+func TestRunWithOptions(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(sh, "-c", `echo "$OSCONFIG_TEST"; pwd`)
+	stdout, _, err := (&DefaultRunner{}).RunWithOptions(context.Background(), cmd, &RunOptions{Env: []string{"OSCONFIG_TEST=value"}, Dir: dir})
+	if err != nil {
+		t.Fatalf("RunWithOptions: %v", err)
+	}
+	if got, want := strings.Split(strings.TrimSpace(string(stdout)), "\n"), []string{"value", dir}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	cmd = exec.Command(sh, "-c", "true")
+	if _, _, err := (&DefaultRunner{}).RunWithOptions(context.Background(), cmd, &RunOptions{User: "osconfig-test-nosuchuser"}); err == nil {
+		t.Error("RunWithOptions with an unknown user: expected error")
+	}
+	if cmd.ProcessState != nil {
+		t.Error("RunWithOptions ran the command although the options could not be applied")
+	}
+}
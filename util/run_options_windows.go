@@ -0,0 +1,32 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func applyPlatformRunOptions(cmd *exec.Cmd, opts *RunOptions) error {
+	// runas needs the password of the user, there is no way to run a
+	// command as another user without one.
+	if opts.User != "" || opts.Nice != 0 || opts.IOClass != 0 || len(opts.Ulimits) > 0 {
+		return errors.New("running as another user, niceness, I/O class and limits are not supported on Windows")
+	}
+	return nil
+}
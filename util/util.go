@@ -26,7 +26,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -45,9 +44,10 @@ type Logger struct {
 
 // NormPath transforms a windows path into an extended-length path as described in
 // https://msdn.microsoft.com/en-us/library/windows/desktop/aa365247(v=vs.85).aspx#maxpath
-// when not running on windows it will just return the input path.
+// when not running on windows it will just return the input path. Relative,
+// including drive-relative, paths are made absolute first, see LongPath.
 func NormPath(path string) (string, error) {
-	if strings.HasPrefix(path, `\\?\`) {
+	if isLongPath(path) {
 		return path, nil
 	}
 
@@ -56,14 +56,11 @@ func NormPath(path string) (string, error) {
 		return "", err
 	}
 
-	if runtime.GOOS != "windows" {
-		return path, nil
-	}
-
-	return `\\?\` + strings.ReplaceAll(path, "/", `\`), nil
+	return LongPath(path), nil
 }
 
-// Exists check for the existence of a file
+// Exists check for the existence of a file, a path that cannot be checked is
+// reported as missing, see IsFile and IsDir to tell them apart.
 func Exists(name string) bool {
 	if strings.TrimSpace(name) == "" {
 		return false
@@ -82,7 +79,7 @@ func AtomicWriteFileStream(r io.Reader, checksum, path string, mode os.FileMode)
 		return "", err
 	}
 
-	tmp, err := TempFile(filepath.Dir(path), filepath.Base(path), mode)
+	tmp, err := TempFileNear(path, mode)
 	if err != nil {
 		return "", fmt.Errorf("unable to create temp file: %v", err)
 	}
@@ -110,7 +107,7 @@ func AtomicWriteFileStream(r io.Reader, checksum, path string, mode os.FileMode)
 		return "", err
 	}
 
-	return computed, os.Rename(tmpName, path)
+	return computed, replaceFile(tmpName, path)
 }
 
 // CommandRunner will execute the commands and return the results of that
@@ -119,6 +116,18 @@ type CommandRunner interface {
 	Run(ctx context.Context, command *exec.Cmd) ([]byte, []byte, error)
 }
 
+// CommandObserver is called with the duration and error of a command once
+// it has run.
+type CommandObserver func(ctx context.Context, cmd *exec.Cmd, d time.Duration, err error)
+
+var commandObserver CommandObserver
+
+// SetCommandObserver makes DefaultRunner call f for each command it runs,
+// e.g. to record metrics. A nil f removes the observer.
+func SetCommandObserver(f CommandObserver) {
+	commandObserver = f
+}
+
 // DefaultRunner is a default CommandRunner.
 type DefaultRunner struct{}
 
@@ -126,9 +135,18 @@ type DefaultRunner struct{}
 func (r *DefaultRunner) Run(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
 	clog.Debugf(ctx, "Running %q with args %q\n", cmd.Path, cmd.Args[1:])
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
+	// A Stdout set by the caller still gets the output as it is written.
+	if cmd.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, cmd.Stdout)
+	} else {
+		cmd.Stdout = &stdout
+	}
 	cmd.Stderr = &stderr
+	start := time.Now()
 	err := cmd.Run()
+	if commandObserver != nil {
+		commandObserver(ctx, cmd, time.Since(start), err)
+	}
 	clog.DebugStructured(
 		ctx,
 		struct {
@@ -157,13 +175,21 @@ func TempFile(dir string, pattern string, mode os.FileMode) (f *os.File, err err
 }
 
 // AtomicWrite attempts to atomically write a file.
-func AtomicWrite(path string, content []byte, mode os.FileMode) (err error) {
+func AtomicWrite(path string, content []byte, mode os.FileMode) error {
+	return AtomicWriteReader(path, bytes.NewReader(content), mode)
+}
+
+// AtomicWriteReader attempts to atomically write the content of r to a file,
+// without holding it in memory. The content is synced to disk before the
+// file is replaced, and the owner, group and SELinux context of a file it
+// replaces are kept.
+func AtomicWriteReader(path string, r io.Reader, mode os.FileMode) (err error) {
 	path, err = NormPath(path)
 	if err != nil {
 		return err
 	}
 
-	tmp, err := TempFile(filepath.Dir(path), filepath.Base(path), mode)
+	tmp, err := TempFileNear(path, mode)
 	if err != nil {
 		return fmt.Errorf("unable to create temp file: %v", err)
 	}
@@ -177,11 +203,64 @@ func AtomicWrite(path string, content []byte, mode os.FileMode) (err error) {
 		}
 	}()
 
-	if _, err := tmp.Write(content); err != nil {
+	if _, err = io.Copy(tmp, r); err != nil {
 		return err
 	}
-	if err := tmp.Close(); err != nil {
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = preserveMetadata(path, tmpName); err != nil {
+		return fmt.Errorf("unable to keep the metadata of %q: %v", path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = replaceFile(tmpName, path); err != nil {
+		return err
+	}
+	// The rename is only durable once the directory is synced.
+	return syncDir(filepath.Dir(path))
+}
+
+// TempFileNear creates a temp file next to path, in the same directory and
+// so on the same filesystem, that can be renamed to path.
+func TempFileNear(path string, mode os.FileMode) (*os.File, error) {
+	return TempFile(filepath.Dir(path), filepath.Base(path), mode)
+}
+
+var rename = os.Rename
+
+// replaceFile renames tmp to path. If path can not be replaced by a rename,
+// because it is on another filesystem or is a mount point itself, the
+// content of tmp is copied into it instead and synced, which is not atomic.
+// tmp is removed either way once it is no longer needed.
+func replaceFile(tmp, path string) error {
+	err := rename(tmp, path)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	src, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
 		return err
 	}
-	return os.Rename(tmpName, path)
+	return dst.Close()
 }
@@ -0,0 +1,136 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// errReader returns the error err after the content of r.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		return n, e.err
+	}
+	return n, err
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestAtomicWriteReader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+
+	if err := AtomicWriteReader(path, strings.NewReader("first"), 0600); err != nil {
+		t.Fatalf("AtomicWriteReader of a new file: %v", err)
+	}
+	if err := AtomicWriteReader(path, strings.NewReader("second"), 0600); err != nil {
+		t.Fatalf("AtomicWriteReader replacing a file: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "second" {
+		t.Errorf("content = %q, want %q", got, "second")
+	}
+
+	// A failed read leaves the file as it was and no temp file behind.
+	wantErr := errors.New("connection reset")
+	if err := AtomicWriteReader(path, &errReader{strings.NewReader("third"), wantErr}, 0600); !errors.Is(err, wantErr) {
+		t.Errorf("AtomicWriteReader with a failing reader = %v, want %v", err, wantErr)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "second" {
+		t.Errorf("content after a failed write = %q, %v, want %q", got, err, "second")
+	}
+	if names := dirNames(t, dir); len(names) != 1 || names[0] != "file" {
+		t.Errorf("directory contains %q, want only file", names)
+	}
+
+	if err := AtomicWrite(filepath.Join(dir, "missing", "file"), nil, 0600); err == nil {
+		t.Error("AtomicWrite into a missing directory succeeded")
+	}
+}
+
+func TestTempFileNear(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	f, err := TempFileNear(path, 0600)
+	if err != nil {
+		t.Fatalf("TempFileNear: %v", err)
+	}
+	defer f.Close()
+	if got := filepath.Dir(f.Name()); got != dir {
+		t.Errorf("temp file is in %q, want %q", got, dir)
+	}
+	if !strings.HasPrefix(filepath.Base(f.Name()), "file") {
+		t.Errorf("temp file %q is not named after %q", f.Name(), path)
+	}
+	if _, err := f.WriteString("content"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		t.Errorf("renaming the temp file to %q: %v", path, err)
+	}
+}
+
+func TestSetCommandObserver(t *testing.T) {
+	var observed []string
+	var observedErr error
+	SetCommandObserver(func(_ context.Context, cmd *exec.Cmd, _ time.Duration, err error) {
+		observed = append(observed, filepath.Base(cmd.Path))
+		observedErr = err
+	})
+	defer SetCommandObserver(nil)
+
+	cmd := exec.Command(filepath.Join(t.TempDir(), "missing"))
+	_, _, err := (&DefaultRunner{}).Run(context.Background(), cmd)
+	if err == nil {
+		t.Fatal("running a missing command succeeded")
+	}
+	if len(observed) != 1 || observed[0] != "missing" {
+		t.Errorf("observed commands %q, want %q", observed, []string{"missing"})
+	}
+	if observedErr != err {
+		t.Errorf("observed error %v, want %v", observedErr, err)
+	}
+}
@@ -0,0 +1,133 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package vulnreport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// osvRecord is the part of an OSV record, see https://ossf.github.io/osv-schema/,
+// used by ParseOSV.
+type osvRecord struct {
+	ID               string   `json:"id"`
+	Aliases          []string `json:"aliases"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced string `json:"introduced"`
+				Fixed      string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+		EcosystemSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"ecosystem_specific"`
+	} `json:"affected"`
+}
+
+// osvTypes maps the OSV ecosystems of distributions, without their release
+// suffix, to the package type of their packages.
+var osvTypes = map[string]string{
+	"Debian":      "deb",
+	"Ubuntu":      "deb",
+	"AlmaLinux":   "rpm",
+	"Rocky Linux": "rpm",
+	"Red Hat":     "rpm",
+	"SUSE":        "rpm",
+	"openSUSE":    "rpm",
+}
+
+// ParseOSV parses an OSV record. Only the ECOSYSTEM ranges of the Linux
+// distribution ecosystems are used, the record is expected to be for the
+// release of the host, e.g. "Debian:12".
+func ParseOSV(data []byte) (*Advisory, error) {
+	var rec osvRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	if rec.ID == "" {
+		return nil, errors.New("OSV record without an id")
+	}
+	a := &Advisory{ID: rec.ID, Aliases: rec.Aliases, Severity: packages.NormalizeSeverity(rec.DatabaseSpecific.Severity)}
+	for _, af := range rec.Affected {
+		typ, ok := osvTypes[strings.SplitN(af.Package.Ecosystem, ":", 2)[0]]
+		if !ok {
+			continue
+		}
+		if a.Severity == packages.SeverityUnknown {
+			a.Severity = packages.NormalizeSeverity(af.EcosystemSpecific.Severity)
+		}
+		for _, r := range af.Ranges {
+			if r.Type != "ECOSYSTEM" {
+				continue
+			}
+			var introduced string
+			for _, e := range r.Events {
+				if e.Introduced != "" {
+					introduced = e.Introduced
+				}
+				if e.Fixed != "" {
+					a.Fixes = append(a.Fixes, &Fix{Type: typ, Name: af.Package.Name, Introduced: introduced, Version: e.Fixed})
+					introduced = ""
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+// LoadOSV parses the OSV records, the .json files, in dir. Records that
+// can't be parsed are skipped and reported in the error.
+func LoadOSV(dir string) ([]*Advisory, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var advs []*Advisory
+	var errs []string
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		a, err := ParseOSV(data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f, err))
+			continue
+		}
+		advs = append(advs, a)
+	}
+	if len(errs) > 0 {
+		return advs, errors.New(strings.Join(errs, "\n"))
+	}
+	return advs, nil
+}
@@ -0,0 +1,81 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package vulnreport
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+const debianOSV = `{
+  "id": "DSA-5532-1",
+  "aliases": ["CVE-2023-5363"],
+  "affected": [{
+    "package": {"ecosystem": "Debian:12", "name": "openssl"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.0.11-1~deb12u2"}]}],
+    "ecosystem_specific": {"severity": "high"}
+  }, {
+    "package": {"ecosystem": "PyPI", "name": "cryptography"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "41.0.5"}]}]
+  }]
+}`
+
+func TestParseOSV(t *testing.T) {
+	got, err := ParseOSV([]byte(debianOSV))
+	if err != nil {
+		t.Fatalf("ParseOSV() error: %v", err)
+	}
+	want := &Advisory{
+		ID:       "DSA-5532-1",
+		Aliases:  []string{"CVE-2023-5363"},
+		Severity: "important",
+		Fixes:    []*Fix{{Type: "deb", Name: "openssl", Introduced: "0", Version: "3.0.11-1~deb12u2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOSV() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseOSV([]byte(`{"affected": []}`)); err == nil {
+		t.Error("ParseOSV() without an id got nil error")
+	}
+}
+
+func TestLoadOSV(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"DSA-5532-1.json": debianOSV, "broken.json": "{", "README": "not a record"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	advs, err := LoadOSV(dir)
+	if err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("LoadOSV() error = %v, want broken.json reported", err)
+	}
+	if len(advs) != 1 || advs[0].ID != "DSA-5532-1" {
+		t.Fatalf("LoadOSV() = %+v, want DSA-5532-1", advs)
+	}
+
+	installed := &packages.Packages{Deb: []*packages.PkgInfo{{Name: "openssl", Arch: "amd64", Version: "3.0.11-1~deb12u1"}}}
+	rep := New("host", installed, nil, advs, time.Now())
+	if len(rep.Findings) != 1 || rep.Findings[0].FixPending || rep.Findings[0].Fixed != "3.0.11-1~deb12u2" {
+		t.Errorf("New() findings = %+v, want openssl fixed in 3.0.11-1~deb12u2 without an update", rep.Findings)
+	}
+}
@@ -0,0 +1,212 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package vulnreport joins the installed packages of a host with
+// vulnerability advisories, from yum updateinfo or OSV records, into a
+// report of the affected packages, the versions fixing them and whether an
+// available update already installs the fix.
+package vulnreport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+// Advisory is a vulnerability advisory and the package versions fixing it.
+type Advisory struct {
+	ID string
+	// Aliases are other IDs of the advisory, like CVE IDs.
+	Aliases []string `json:",omitempty"`
+	// Severity is one of the packages Severity constants.
+	Severity string
+	Fixes    []*Fix
+}
+
+// Fix is a package version fixing an Advisory.
+type Fix struct {
+	// Type is "deb" or "rpm", the versions are compared like the package
+	// manager does.
+	Type string
+	Name string
+	// Arch is empty if the fix is for all architectures.
+	Arch string `json:",omitempty"`
+	// Introduced is the first affected version, empty if all versions
+	// before Version are affected.
+	Introduced string `json:",omitempty"`
+	Version    string
+}
+
+// FromUpdateInfo converts advisories listed by packages.YumAdvisories, only
+// security advisories are kept.
+func FromUpdateInfo(advisories []*packages.Advisory) []*Advisory {
+	var advs []*Advisory
+	for _, a := range advisories {
+		if a.Type != "security" {
+			continue
+		}
+		adv := &Advisory{ID: a.ID, Severity: packages.NormalizeSeverity(a.Severity)}
+		for _, p := range a.Packages {
+			adv.Fixes = append(adv.Fixes, &Fix{Type: "rpm", Name: p.Name, Arch: p.Arch, Version: p.Version})
+		}
+		advs = append(advs, adv)
+	}
+	return advs
+}
+
+// Finding is an installed package affected by an advisory.
+type Finding struct {
+	Advisory string
+	Aliases  []string `json:",omitempty"`
+	Severity string
+	Type     string
+	Package  string
+	Arch     string
+	// Installed is the installed version, Fixed the first version fixing
+	// the advisory.
+	Installed string
+	Fixed     string
+	// FixPending reports whether an available update installs Fixed or a
+	// newer version, Update is the version of that update.
+	FixPending bool
+	Update     string `json:",omitempty"`
+}
+
+// Report lists the findings of a host, the most severe first.
+type Report struct {
+	Hostname   string
+	Generated  time.Time
+	Advisories int
+	Findings   []*Finding
+}
+
+var compare = map[string]func(a, b string) int{
+	"deb": packages.CompareDebVersions,
+	"rpm": packages.CompareRPMEVR,
+}
+
+func byType(pkgs *packages.Packages, installed bool) map[string][]*packages.PkgInfo {
+	if pkgs == nil {
+		return nil
+	}
+	if installed {
+		return map[string][]*packages.PkgInfo{"deb": pkgs.Deb, "rpm": pkgs.Rpm}
+	}
+	return map[string][]*packages.PkgInfo{"deb": pkgs.Apt, "rpm": append(append([]*packages.PkgInfo(nil), pkgs.Yum...), pkgs.Zypper...)}
+}
+
+// severityRank orders the severities from most to least severe.
+func severityRank(sev string) int {
+	for i, s := range []string{packages.SeverityCritical, packages.SeverityImportant, packages.SeverityModerate, packages.SeverityLow} {
+		if sev == s {
+			return i
+		}
+	}
+	return 4
+}
+
+func archMatches(fix, pkg string) bool {
+	return fix == "" || fix == pkg || fix == "noarch" || fix == "all"
+}
+
+// affects reports whether version is in the range fixed by f.
+func (f *Fix) affects(version string) bool {
+	cmp := compare[f.Type]
+	if f.Introduced != "" && f.Introduced != "0" && cmp(version, f.Introduced) < 0 {
+		return false
+	}
+	return cmp(version, f.Version) < 0
+}
+
+// New reports the installed packages affected by advisories, updates are
+// the available updates as returned by packages.GetPackageUpdates.
+func New(hostname string, installed, updates *packages.Packages, advisories []*Advisory, now time.Time) *Report {
+	r := &Report{Hostname: hostname, Generated: now.UTC(), Advisories: len(advisories)}
+	inst, upd := byType(installed, true), byType(updates, false)
+	for _, a := range advisories {
+		seen := map[string]bool{}
+		for _, f := range a.Fixes {
+			if compare[f.Type] == nil {
+				continue
+			}
+			for _, p := range inst[f.Type] {
+				key := p.Name + "." + p.Arch
+				if p.Name != f.Name || !archMatches(f.Arch, p.Arch) || seen[key] || !f.affects(p.Version) {
+					continue
+				}
+				seen[key] = true
+				finding := &Finding{
+					Advisory:  a.ID,
+					Aliases:   a.Aliases,
+					Severity:  a.Severity,
+					Type:      f.Type,
+					Package:   p.Name,
+					Arch:      p.Arch,
+					Installed: p.Version,
+					Fixed:     f.Version,
+				}
+				for _, u := range upd[f.Type] {
+					if u.Name == p.Name && archMatches(u.Arch, p.Arch) && compare[f.Type](u.Version, f.Version) >= 0 {
+						finding.FixPending, finding.Update = true, u.Version
+						break
+					}
+				}
+				r.Findings = append(r.Findings, finding)
+			}
+		}
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Advisory < b.Advisory
+	})
+	return r
+}
+
+// BySeverity counts the findings by severity.
+func (r *Report) BySeverity() map[string]int {
+	counts := map[string]int{}
+	for _, f := range r.Findings {
+		counts[f.Severity]++
+	}
+	return counts
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d packages affected by %d checked advisories on %s.\n", len(r.Findings), r.Advisories, r.Hostname)
+	if len(r.Findings) == 0 {
+		return b.String()
+	}
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tADVISORY\tPACKAGE\tINSTALLED\tFIXED\tUPDATE")
+	for _, f := range r.Findings {
+		update := "none"
+		if f.FixPending {
+			update = f.Update
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s.%s\t%s\t%s\t%s\n", f.Severity, f.Advisory, f.Package, f.Arch, f.Installed, f.Fixed, update)
+	}
+	w.Flush()
+	return b.String()
+}
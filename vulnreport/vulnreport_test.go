@@ -0,0 +1,67 @@
+//  Copyright 2024 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package vulnreport
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/packages"
+)
+
+func TestNew(t *testing.T) {
+	installed := &packages.Packages{
+		Rpm: []*packages.PkgInfo{
+			{Name: "openssl", Arch: "x86_64", Version: "1:1.0.2k-25.el7_9"},
+			{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1160.105.1.el7"},
+			{Name: "bash", Arch: "x86_64", Version: "4.2.46-35.el7_9"},
+		},
+	}
+	updates := &packages.Packages{
+		Yum: []*packages.PkgInfo{{Name: "openssl", Arch: "x86_64", Version: "1:1.0.2k-26.el7_9"}},
+	}
+	advisories := FromUpdateInfo([]*packages.Advisory{
+		{ID: "RHSA-2024:0002", Type: "security", Severity: "Important", Packages: []*packages.PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1160.108.1.el7"}}},
+		{ID: "RHSA-2024:0001", Type: "security", Severity: "Critical", Packages: []*packages.PkgInfo{{Name: "openssl", Arch: "x86_64", Version: "1:1.0.2k-26.el7_9"}}},
+		{ID: "RHSA-2023:0001", Type: "security", Severity: "Low", Packages: []*packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "4.2.46-34.el7"}}},
+		{ID: "RHBA-2024:0003", Type: "bugfix", Packages: []*packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "4.2.46-36.el7_9"}}},
+	})
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	got := New("host", installed, updates, advisories, now)
+	want := &Report{
+		Hostname:   "host",
+		Generated:  now,
+		Advisories: 3,
+		Findings: []*Finding{
+			{Advisory: "RHSA-2024:0001", Severity: "critical", Type: "rpm", Package: "openssl", Arch: "x86_64", Installed: "1:1.0.2k-25.el7_9", Fixed: "1:1.0.2k-26.el7_9", FixPending: true, Update: "1:1.0.2k-26.el7_9"},
+			{Advisory: "RHSA-2024:0002", Severity: "important", Type: "rpm", Package: "kernel", Arch: "x86_64", Installed: "3.10.0-1160.105.1.el7", Fixed: "3.10.0-1160.108.1.el7"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("New() = %s, want %s", gotJSON, wantJSON)
+	}
+	if counts := got.BySeverity(); counts["critical"] != 1 || counts["important"] != 1 {
+		t.Errorf("BySeverity() = %v, want 1 critical and 1 important", counts)
+	}
+	if s := got.String(); !strings.Contains(s, "2 packages affected by 3 checked advisories on host.") || !strings.Contains(s, "openssl.x86_64") {
+		t.Errorf("String() = %q", s)
+	}
+}